@@ -73,7 +73,8 @@ func setupCollections(client *mongo.Client) {
 	db := client.Database(dbName)
 
 	// Ensure collections exist
-	collections := []string{"users", "companies", "serviceProviders", "wholesalers"}
+	// Collections written inside Mongo transactions must exist before the first transaction
+	collections := []string{"users", "companies", "serviceProviders", "wholesalers", "processed_payments", "ledger_transactions", "ledger_accounts", "whish_reconciliation_reports", "promo_codes", "promo_code_redemptions", "invoices", "counters", "withdrawals", "commissions", "commission_records", "referral_commissions", "payout_runs", "commission_rules", "sales_targets"}
 	for _, collName := range collections {
 		db.CreateCollection(ctx, collName)
 	}
@@ -104,5 +105,145 @@ func setupCollections(client *mongo.Client) {
 		}
 	}
 
+	// Promo codes are looked up by their unique code
+	promoCodeIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection("promo_codes").Indexes().CreateOne(ctx, promoCodeIndexModel); err != nil {
+		log.Printf("Error creating promo code index: %v", err)
+	}
+
+	// Trials are matched against earlier trials by phone, email and business name
+	for _, field := range []string{"phones", "emails", "nameKey"} {
+		trialIndexModel := mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}}
+		if _, err := db.Collection("subscription_trials").Indexes().CreateOne(ctx, trialIndexModel); err != nil {
+			log.Printf("Error creating trial %s index: %v", field, err)
+		}
+	}
+
+	// Whish callbacks find their request by externalId, which must identify one request
+	for _, collName := range []string{"branch_subscription_requests", "wholesaler_branch_subscription_requests", "subscription_requests", "sponsorship_subscription_requests"} {
+		externalIDIndexModel := mongo.IndexModel{
+			Keys:    bson.D{{Key: "externalId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"externalId": bson.M{"$gt": 0}}),
+		}
+		if _, err := db.Collection(collName).Indexes().CreateOne(ctx, externalIDIndexModel); err != nil {
+			log.Printf("Error creating externalId index for %s: %v", collName, err)
+		}
+	}
+
+	// A branch or service provider has at most one subscription request waiting for payment or approval
+	for collName, entityField := range map[string]string{
+		"branch_subscription_requests":            "branchId",
+		"wholesaler_branch_subscription_requests": "branchId",
+		"subscription_requests":                   "serviceProviderId",
+	} {
+		pendingRequestIndexModel := mongo.IndexModel{
+			Keys: bson.D{{Key: entityField, Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("single_pending_request").SetPartialFilterExpression(bson.M{
+				entityField: bson.M{"$exists": true},
+				"status":    bson.M{"$in": []string{"pending", "pending_payment"}},
+			}),
+		}
+		if _, err := db.Collection(collName).Indexes().CreateOne(ctx, pendingRequestIndexModel); err != nil {
+			log.Printf("Error creating pending request index for %s: %v", collName, err)
+		}
+	}
+
+	// A subscription is refunded once; the refund record claims it before any money is sent
+	refundIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "subscriptionId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection("refunds").Indexes().CreateOne(ctx, refundIndexModel); err != nil {
+		log.Printf("Error creating refund index: %v", err)
+	}
+
+	// A payment is invoiced once, and businesses list their invoices by account
+	invoiceIndexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "referenceId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}, {Key: "sequence", Value: -1}}},
+		{Keys: bson.D{{Key: "issuedAt", Value: 1}}},
+	}
+	if _, err := db.Collection("invoices").Indexes().CreateMany(ctx, invoiceIndexModels); err != nil {
+		log.Printf("Error creating invoice indexes: %v", err)
+	}
+
+	// Only one payout run can be open for review at a time
+	payoutRunIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": "draft"}),
+	}
+	if _, err := db.Collection("payout_runs").Indexes().CreateOne(ctx, payoutRunIndexModel); err != nil {
+		log.Printf("Error creating payout run index: %v", err)
+	}
+
+	// Commission rules are looked up by the time of the sale, and their versions by rule
+	commissionRuleIndexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ruleId", Value: 1}, {Key: "version", Value: -1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "effectiveFrom", Value: 1}}},
+	}
+	if _, err := db.Collection("commission_rules").Indexes().CreateMany(ctx, commissionRuleIndexModels); err != nil {
+		log.Printf("Error creating commission rule indexes: %v", err)
+	}
+
+	// Each regeneration of a monthly statement is stored as a new version
+	commissionStatementIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "userType", Value: 1}, {Key: "period", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection("commission_statements").Indexes().CreateOne(ctx, commissionStatementIndexModel); err != nil {
+		log.Printf("Error creating commission statement index: %v", err)
+	}
+
+	// One target per salesperson and period
+	salesTargetIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "salespersonId", Value: 1}, {Key: "periodType", Value: 1}, {Key: "period", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.Collection("sales_targets").Indexes().CreateOne(ctx, salesTargetIndexModel); err != nil {
+		log.Printf("Error creating sales target index: %v", err)
+	}
+
+	// Leads are listed per salesperson and per team, and scanned for due follow-ups
+	leadIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "salespersonId", Value: 1}, {Key: "stage", Value: 1}}},
+		{Keys: bson.D{{Key: "salesManagerId", Value: 1}, {Key: "stage", Value: 1}}},
+		{Keys: bson.D{{Key: "nextFollowUpAt", Value: 1}}},
+	}
+	if _, err := db.Collection("leads").Indexes().CreateMany(ctx, leadIndexes); err != nil {
+		log.Printf("Error creating lead indexes: %v", err)
+	}
+
+	// Territories are looked up per salesperson, and leads per signed-up business
+	if _, err := db.Collection("territories").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "salespersonId", Value: 1}, {Key: "active", Value: 1}}}); err != nil {
+		log.Printf("Error creating territory index: %v", err)
+	}
+	if _, err := db.Collection("leads").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "entityId", Value: 1}}, Options: options.Index().SetSparse(true)}); err != nil {
+		log.Printf("Error creating lead entity index: %v", err)
+	}
+
+	// A place in a booking slot can be held by one booking only, so concurrent bookings of the last place conflict here
+	bookingSeatIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "serviceProviderId", Value: 1}, {Key: "bookingDate", Value: 1}, {Key: "timeSlot", Value: 1}, {Key: "seat", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"seat": bson.M{"$exists": true}}),
+	}
+	if _, err := db.Collection("bookings").Indexes().CreateOne(ctx, bookingSeatIndexModel); err != nil {
+		log.Printf("Error creating booking seat index: %v", err)
+	}
+	// The booking reminder job looks up upcoming bookings by status and start
+	if _, err := db.Collection("bookings").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "startsAt", Value: 1}}}); err != nil {
+		log.Printf("Error creating booking reminder index: %v", err)
+	}
+
+	// Emergency dispatches are found by booking and by the search still running
+	if _, err := db.Collection("emergencyDispatches").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bookingId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+	}); err != nil {
+		log.Printf("Error creating emergency dispatch indexes: %v", err)
+	}
+
 	log.Println("Database collections and indexes setup complete")
 }
@@ -11,9 +11,11 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/HSouheill/barrim_backend/config"
+	"github.com/HSouheill/barrim_backend/ledger"
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
 	"github.com/HSouheill/barrim_backend/services"
@@ -5368,18 +5370,30 @@ func (ac *AdminController) GetAdminWallet(c echo.Context) error {
 		})
 	}
 
-	// Get total income from all active subscriptions
-	totalIncome, err := ac.calculateTotalSubscriptionIncome(ctx)
+	l := ledger.New(ac.DB)
+
+	// Everything collected from customers goes through the cash account
+	cash, err := l.GetAccount(ctx, ledger.AccountCash)
+	if err != nil {
+		log.Printf("Error reading ledger cash account: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to calculate total subscription income",
+		})
+	}
+
+	// Platform share of subscription and sponsorship payments
+	revenue, err := l.GetAccount(ctx, ledger.AccountSubscriptionRevenue)
 	if err != nil {
-		log.Printf("Error calculating total subscription income: %v", err)
+		log.Printf("Error reading ledger revenue account: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to calculate total subscription income",
 		})
 	}
 
-	// Get total commissions paid to salespersons and sales managers
-	totalCommissions, err := ac.calculateTotalCommissions(ctx)
+	// Get total commissions earned by salespersons and sales managers
+	totalCommissions, commissionBreakdown, err := ac.getCommissionBreakdown(ctx, l)
 	if err != nil {
 		log.Printf("Error calculating total commissions: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
@@ -5388,60 +5402,56 @@ func (ac *AdminController) GetAdminWallet(c echo.Context) error {
 		})
 	}
 
-	// Calculate net profit (income - commissions)
-	netProfit := totalIncome - totalCommissions
+	outstandingCommissions, err := l.SumAccounts(ctx, "liabilities:")
+	if err != nil {
+		log.Printf("Error reading outstanding ledger liabilities: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to calculate total commissions",
+		})
+	}
 
 	// Get detailed breakdown by subscription type
-	incomeBreakdown, err := ac.getIncomeBreakdownByType(ctx)
+	incomeBreakdown, err := l.CreditsByReferenceType(ctx, ledger.AccountSubscriptionRevenue)
 	if err != nil {
 		log.Printf("Error getting income breakdown: %v", err)
 		// Continue without breakdown rather than failing completely
 	}
 
-	// Get commission breakdown
-	commissionBreakdown, err := ac.getCommissionBreakdown(ctx)
+	expenses, err := l.SumAccounts(ctx, "expenses:")
 	if err != nil {
-		log.Printf("Error getting commission breakdown: %v", err)
-		// Continue without breakdown rather than failing completely
+		log.Printf("Error reading ledger expense accounts: %v", err)
 	}
 
-	// Get income from admin wallet collection transactions
-	var adminWalletIncome float64
-	var withdrawalIncome float64
-	var allAdminWalletIncome float64 // Total income from all admin wallet transactions
-	cursor, err := ac.DB.Collection("admin_wallet").Find(ctx, bson.M{})
-	if err == nil {
-		defer cursor.Close(ctx)
-		for cursor.Next(ctx) {
-			var transaction models.AdminWallet
-			if err := cursor.Decode(&transaction); err == nil {
-				// Add all income types to total
-				allAdminWalletIncome += transaction.Amount
-
-				// Categorize by type
-				if transaction.Type == "subscription_income" {
-					adminWalletIncome += transaction.Amount
-				} else if transaction.Type == "withdrawal_income" {
-					withdrawalIncome += transaction.Amount
-				}
-			}
-		}
+	// Make sure the cached account totals still match their postings
+	mismatched, verifyErr := l.Verify(ctx)
+	if verifyErr != nil {
+		log.Printf("Error verifying ledger: %v", verifyErr)
 	}
+	if len(mismatched) > 0 {
+		log.Printf("Ledger accounts out of balance: %v", mismatched)
+	}
+
+	totalIncome := cash.DebitTotal
+	netProfit := revenue.Balance() - expenses.Balance()
 
-	// Calculate total admin wallet balance including admin wallet transactions and withdrawal income
-	totalAdminWallet := totalIncome + adminWalletIncome + withdrawalIncome - totalCommissions
+	// Cash held minus everything still owed to salespersons and sales managers
+	totalAdminWallet := cash.Balance() - outstandingCommissions.Balance()
 
 	walletData := map[string]interface{}{
-		"totalIncome":          totalIncome,
-		"adminWalletIncome":    adminWalletIncome,
-		"allAdminWalletIncome": allAdminWalletIncome,
-		"totalCommissions":     totalCommissions,
-		"withdrawalIncome":     withdrawalIncome,
-		"totalAdminWallet":     totalAdminWallet,
-		"netProfit":            netProfit,
-		"incomeBreakdown":      incomeBreakdown,
-		"commissionBreakdown":  commissionBreakdown,
-		"lastUpdated":          time.Now(),
+		"totalIncome":            totalIncome,
+		"adminWalletIncome":      revenue.Balance(),
+		"allAdminWalletIncome":   revenue.CreditTotal,
+		"totalCommissions":       totalCommissions,
+		"withdrawalIncome":       incomeBreakdown["withdrawal"],
+		"totalAdminWallet":       totalAdminWallet,
+		"netProfit":              netProfit,
+		"cashBalance":            cash.Balance(),
+		"outstandingCommissions": outstandingCommissions.Balance(),
+		"reconciled":             verifyErr == nil && len(mismatched) == 0,
+		"incomeBreakdown":        incomeBreakdown,
+		"commissionBreakdown":    commissionBreakdown,
+		"lastUpdated":            time.Now(),
 	}
 
 	return c.JSON(http.StatusOK, models.Response{
@@ -5451,380 +5461,39 @@ func (ac *AdminController) GetAdminWallet(c echo.Context) error {
 	})
 }
 
-// calculateTotalSubscriptionIncome calculates the total income from all active subscriptions
-func (ac *AdminController) calculateTotalSubscriptionIncome(ctx context.Context) (float64, error) {
-	var totalIncome float64
-
-	// 1. Get income from company subscriptions
-	companyIncome, err := ac.getCompanySubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting company subscription income: %v", err)
-	} else {
-		totalIncome += companyIncome
-	}
-
-	// 2. Get income from wholesaler subscriptions
-	wholesalerIncome, err := ac.getWholesalerSubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting wholesaler subscription income: %v", err)
-	} else {
-		totalIncome += wholesalerIncome
-	}
-
-	// 3. Get income from service provider subscriptions
-	serviceProviderIncome, err := ac.getServiceProviderSubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting service provider subscription income: %v", err)
-	} else {
-		totalIncome += serviceProviderIncome
-	}
-
-	// 4. Get income from sponsorship subscriptions
-	sponsorshipIncome, err := ac.getSponsorshipSubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting sponsorship subscription income: %v", err)
-	} else {
-		totalIncome += sponsorshipIncome
-	}
-
-	return totalIncome, nil
-}
-
-// getCompanySubscriptionIncome calculates income from company subscriptions
-func (ac *AdminController) getCompanySubscriptionIncome(ctx context.Context) (float64, error) {
-	collection := config.GetCollection(ac.DB.Client(), "company_subscriptions")
-
-	pipeline := []bson.M{
-		{"$match": bson.M{"status": "active"}},
-		{"$lookup": bson.M{
-			"from":         "subscription_plans",
-			"localField":   "planId",
-			"foreignField": "_id",
-			"as":           "plan",
-		}},
-		{"$unwind": "$plan"},
-		{"$group": bson.M{
-			"_id":   nil,
-			"total": bson.M{"$sum": "$plan.price"},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		Total float64 `bson:"total"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-	}
-
-	return result.Total, nil
-}
-
-// getWholesalerSubscriptionIncome calculates income from wholesaler subscriptions
-func (ac *AdminController) getWholesalerSubscriptionIncome(ctx context.Context) (float64, error) {
-	collection := config.GetCollection(ac.DB.Client(), "wholesaler_subscriptions")
-
-	pipeline := []bson.M{
-		{"$match": bson.M{"status": "active"}},
-		{"$lookup": bson.M{
-			"from":         "subscription_plans",
-			"localField":   "planId",
-			"foreignField": "_id",
-			"as":           "plan",
-		}},
-		{"$unwind": "$plan"},
-		{"$group": bson.M{
-			"_id":   nil,
-			"total": bson.M{"$sum": "$plan.price"},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		Total float64 `bson:"total"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-	}
-
-	return result.Total, nil
-}
-
-// getServiceProviderSubscriptionIncome calculates income from service provider subscriptions
-func (ac *AdminController) getServiceProviderSubscriptionIncome(ctx context.Context) (float64, error) {
-	collection := config.GetCollection(ac.DB.Client(), "service_provider_subscriptions")
-
-	pipeline := []bson.M{
-		{"$match": bson.M{"status": "active"}},
-		{"$lookup": bson.M{
-			"from":         "subscription_plans",
-			"localField":   "planId",
-			"foreignField": "_id",
-			"as":           "plan",
-		}},
-		{"$unwind": "$plan"},
-		{"$group": bson.M{
-			"_id":   nil,
-			"total": bson.M{"$sum": "$plan.price"},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		Total float64 `bson:"total"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-	}
-
-	return result.Total, nil
-}
-
-// getSponsorshipSubscriptionIncome calculates income from sponsorship subscriptions
-func (ac *AdminController) getSponsorshipSubscriptionIncome(ctx context.Context) (float64, error) {
-	collection := config.GetCollection(ac.DB.Client(), "sponsorship_subscriptions")
-
-	pipeline := []bson.M{
-		{"$match": bson.M{"status": "active"}},
-		{"$lookup": bson.M{
-			"from":         "sponsorships",
-			"localField":   "sponsorshipId",
-			"foreignField": "_id",
-			"as":           "sponsorship",
-		}},
-		{"$unwind": "$sponsorship"},
-		{"$group": bson.M{
-			"_id":   nil,
-			"total": bson.M{"$sum": "$sponsorship.price"},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		Total float64 `bson:"total"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-	}
-
-	return result.Total, nil
-}
-
-// calculateTotalCommissions calculates the total commissions paid to salespersons and sales managers
-func (ac *AdminController) calculateTotalCommissions(ctx context.Context) (float64, error) {
-	collection := config.GetCollection(ac.DB.Client(), "commissions")
-
-	pipeline := []bson.M{
-		{"$group": bson.M{
-			"_id":                         nil,
-			"totalSalespersonCommission":  bson.M{"$sum": "$salespersonCommission"},
-			"totalSalesManagerCommission": bson.M{"$sum": "$salesManagerCommission"},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		TotalSalespersonCommission  float64 `bson:"totalSalespersonCommission"`
-		TotalSalesManagerCommission float64 `bson:"totalSalesManagerCommission"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-	}
-
-	totalCommissions := result.TotalSalespersonCommission + result.TotalSalesManagerCommission
-	return totalCommissions, nil
-}
-
-// getIncomeBreakdownByType provides detailed breakdown of income by subscription type
-func (ac *AdminController) getIncomeBreakdownByType(ctx context.Context) (map[string]interface{}, error) {
-	breakdown := make(map[string]interface{})
-
-	// Company subscriptions (main company subscriptions)
-	companyIncome, err := ac.getCompanySubscriptionIncome(ctx)
-	if err != nil {
-		breakdown["company"] = map[string]interface{}{
-			"income": 0,
-			"error":  err.Error(),
-		}
-	} else {
-		breakdown["company"] = map[string]interface{}{
-			"income": companyIncome,
-			"error":  nil,
-		}
-	}
-
-	// Add company branch subscription income from admin_wallet
-	companyBranchIncome, err := ac.getCompanyBranchSubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting company branch subscription income: %v", err)
-	} else {
-		// Add branch income to company income
-		if currentCompany, ok := breakdown["company"].(map[string]interface{}); ok {
-			if currentIncome, ok := currentCompany["income"].(float64); ok {
-				currentCompany["income"] = currentIncome + companyBranchIncome
-			}
-		}
-	}
-
-	// Wholesaler subscriptions (main wholesaler subscriptions)
-	wholesalerIncome, err := ac.getWholesalerSubscriptionIncome(ctx)
-	if err != nil {
-		breakdown["wholesaler"] = map[string]interface{}{
-			"income": 0,
-			"error":  err.Error(),
-		}
-	} else {
-		breakdown["wholesaler"] = map[string]interface{}{
-			"income": wholesalerIncome,
-			"error":  nil,
-		}
-	}
-
-	// Add wholesaler branch subscription income from admin_wallet
-	wholesalerBranchIncome, err := ac.getWholesalerBranchSubscriptionIncome(ctx)
-	if err != nil {
-		log.Printf("Error getting wholesaler branch subscription income: %v", err)
-	} else {
-		// Add branch income to wholesaler income
-		if currentWholesaler, ok := breakdown["wholesaler"].(map[string]interface{}); ok {
-			if currentIncome, ok := currentWholesaler["income"].(float64); ok {
-				currentWholesaler["income"] = currentIncome + wholesalerBranchIncome
-			}
-		}
-	}
-
-	// Service provider subscriptions (main service provider subscriptions)
-	serviceProviderIncome, err := ac.getServiceProviderSubscriptionIncome(ctx)
-	if err != nil {
-		breakdown["serviceProvider"] = map[string]interface{}{
-			"income": 0,
-			"error":  err.Error(),
-		}
-	} else {
-		breakdown["serviceProvider"] = map[string]interface{}{
-			"income": serviceProviderIncome,
-			"error":  nil,
-		}
-	}
-
-	// Add service provider branch subscription income from admin_wallet
-	serviceProviderBranchIncome, err := ac.getServiceProviderBranchSubscriptionIncome(ctx)
+// getCommissionBreakdown provides detailed breakdown of commissions earned per role from the ledger
+func (ac *AdminController) getCommissionBreakdown(ctx context.Context, l *ledger.Ledger) (float64, map[string]interface{}, error) {
+	salesperson, err := l.SumAccounts(ctx, ledger.CommissionAccountPrefix("salesperson"))
 	if err != nil {
-		log.Printf("Error getting service provider branch subscription income: %v", err)
-	} else {
-		// Add branch income to service provider income
-		if currentServiceProvider, ok := breakdown["serviceProvider"].(map[string]interface{}); ok {
-			if currentIncome, ok := currentServiceProvider["income"].(float64); ok {
-				currentServiceProvider["income"] = currentIncome + serviceProviderBranchIncome
-			}
-		}
+		return 0, nil, err
 	}
-
-	// Sponsorship subscriptions
-	sponsorshipIncome, err := ac.getSponsorshipSubscriptionIncome(ctx)
+	salesManager, err := l.SumAccounts(ctx, ledger.CommissionAccountPrefix("sales_manager"))
 	if err != nil {
-		breakdown["sponsorship"] = map[string]interface{}{
-			"income": 0,
-			"error":  err.Error(),
-		}
-	} else {
-		breakdown["sponsorship"] = map[string]interface{}{
-			"income": sponsorshipIncome,
-			"error":  nil,
-		}
-	}
-
-	return breakdown, nil
-}
-
-// getCommissionBreakdown provides detailed breakdown of commissions
-func (ac *AdminController) getCommissionBreakdown(ctx context.Context) (map[string]interface{}, error) {
-	collection := config.GetCollection(ac.DB.Client(), "commissions")
-
-	pipeline := []bson.M{
-		{"$group": bson.M{
-			"_id":                         nil,
-			"totalSalespersonCommission":  bson.M{"$sum": "$salespersonCommission"},
-			"totalSalesManagerCommission": bson.M{"$sum": "$salesManagerCommission"},
-			"totalCommissions":            bson.M{"$sum": bson.M{"$add": []string{"$salespersonCommission", "$salesManagerCommission"}}},
-		}},
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		TotalSalespersonCommission  float64 `bson:"totalSalespersonCommission"`
-		TotalSalesManagerCommission float64 `bson:"totalSalesManagerCommission"`
-		TotalCommissions            float64 `bson:"totalCommissions"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return nil, err
-		}
+		return 0, nil, err
 	}
 
+	total := salesperson.CreditTotal + salesManager.CreditTotal
 	breakdown := map[string]interface{}{
 		"salesperson": map[string]interface{}{
-			"commission": result.TotalSalespersonCommission,
-			"percentage": 0, // Will calculate if total > 0
+			"commission":  salesperson.CreditTotal,
+			"outstanding": salesperson.Balance(),
+			"percentage":  0, // Will calculate if total > 0
 		},
 		"salesManager": map[string]interface{}{
-			"commission": result.TotalSalesManagerCommission,
-			"percentage": 0, // Will calculate if total > 0
+			"commission":  salesManager.CreditTotal,
+			"outstanding": salesManager.Balance(),
+			"percentage":  0, // Will calculate if total > 0
 		},
-		"total": result.TotalCommissions,
+		"total": total,
 	}
 
 	// Calculate percentages if there are commissions
-	if result.TotalCommissions > 0 {
-		if salespersonBreakdown, ok := breakdown["salesperson"].(map[string]interface{}); ok {
-			salespersonBreakdown["percentage"] = (result.TotalSalespersonCommission / result.TotalCommissions) * 100
-		}
-		if salesManagerBreakdown, ok := breakdown["salesManager"].(map[string]interface{}); ok {
-			salesManagerBreakdown["percentage"] = (result.TotalSalesManagerCommission / result.TotalCommissions) * 100
-		}
+	if total > 0 {
+		breakdown["salesperson"].(map[string]interface{})["percentage"] = (salesperson.CreditTotal / total) * 100
+		breakdown["salesManager"].(map[string]interface{})["percentage"] = (salesManager.CreditTotal / total) * 100
 	}
 
-	return breakdown, nil
+	return total, breakdown, nil
 }
 
 // CreateSalesperson allows admin to create a new salesperson
@@ -7431,8 +7100,8 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// Initialize Whish service
-	whishService := services.NewWhishService()
+	// Initialize the payment gateway
+	paymentGateway := services.NewPaymentGateway()
 
 	var allPayments []map[string]interface{}
 
@@ -7501,7 +7170,7 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 			}
 
 			// Get Whish payment status
-			whishStatus, phoneNumber, _ := whishService.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
+			whishStatus, phoneNumber, _ := paymentGateway.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
 
 			// Get user details
 			userDetails := getUserDetails(subscriptionRequest.ServiceProviderID)
@@ -7548,7 +7217,7 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 			}
 
 			// Get Whish payment status
-			whishStatus, phoneNumber, _ := whishService.GetPaymentStatus("USD", branchSubscriptionRequest.ExternalID)
+			whishStatus, phoneNumber, _ := paymentGateway.GetPaymentStatus("USD", branchSubscriptionRequest.ExternalID)
 
 			// Get user details from branch
 			userDetails := getUserFromCompanyBranch(branchSubscriptionRequest.BranchID)
@@ -7614,7 +7283,7 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 			}
 
 			// Get Whish payment status
-			whishStatus, phoneNumber, _ := whishService.GetPaymentStatus("USD", wholesalerBranchSubscriptionRequest.ExternalID)
+			whishStatus, phoneNumber, _ := paymentGateway.GetPaymentStatus("USD", wholesalerBranchSubscriptionRequest.ExternalID)
 
 			// Get user details from branch
 			userDetails := getUserFromWholesalerBranch(wholesalerBranchSubscriptionRequest.BranchID)
@@ -7680,7 +7349,7 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 			}
 
 			// Get Whish payment status
-			whishStatus, phoneNumber, _ := whishService.GetPaymentStatus("USD", sponsorshipSubscriptionRequest.ExternalID)
+			whishStatus, phoneNumber, _ := paymentGateway.GetPaymentStatus("USD", sponsorshipSubscriptionRequest.ExternalID)
 
 			// Get user details from entity
 			userDetails := getUserFromEntity(sponsorshipSubscriptionRequest.EntityType, sponsorshipSubscriptionRequest.EntityID)
@@ -7706,16 +7375,313 @@ func (ac *AdminController) GetWhishPaymentDetails(c echo.Context) error {
 		}
 	}
 
+	// Compare today's confirmed payments with the ledger, along with the last stored daily reports
+	reconciler := services.NewWhishReconcilerService(ac.DB, nil)
+	reconciliation := map[string]interface{}{}
+	if today, err := reconciler.BuildReport(ctx, time.Now().Format("2006-01-02")); err != nil {
+		log.Printf("Failed to build today's Whish reconciliation report: %v", err)
+	} else {
+		reconciliation["today"] = today
+	}
+	if reports, err := reconciler.RecentReports(ctx, 7); err != nil {
+		log.Printf("Failed to get Whish reconciliation reports: %v", err)
+	} else {
+		reconciliation["daily"] = reports
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: fmt.Sprintf("Retrieved %d subscription payments with user details", len(allPayments)),
 		Data: map[string]interface{}{
-			"total":    len(allPayments),
-			"payments": allPayments,
+			"total":          len(allPayments),
+			"payments":       allPayments,
+			"reconciliation": reconciliation,
 		},
 	})
 }
 
+// GetPaymentAnomalies lists Whish callbacks that did not match their request
+func (ac *AdminController) GetPaymentAnomalies(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "admin" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only admins can review payment anomalies",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	// Open anomalies by default, "all" returns resolved ones as well
+	filter := bson.M{"status": "open"}
+	switch status := c.QueryParam("status"); status {
+	case "", "open":
+	case "all":
+		filter = bson.M{}
+	default:
+		filter["status"] = status
+	}
+
+	collection := ac.DB.Collection("payment_anomalies")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to count payment anomalies",
+		})
+	}
+
+	cursor, err := collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}).SetSkip(int64((page-1)*limit)).SetLimit(int64(limit)))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to retrieve payment anomalies",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	anomalies := []models.PaymentAnomaly{}
+	if err := cursor.All(ctx, &anomalies); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to decode payment anomalies",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payment anomalies retrieved successfully",
+		Data: map[string]interface{}{
+			"anomalies": anomalies,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// ResolvePaymentAnomaly marks a payment anomaly as reviewed
+func (ac *AdminController) ResolvePaymentAnomaly(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "admin" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only admins can resolve payment anomalies",
+		})
+	}
+	adminID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid admin ID",
+		})
+	}
+
+	anomalyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid anomaly ID",
+		})
+	}
+
+	var req models.ResolvePaymentAnomalyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+
+	now := time.Now()
+	result, err := ac.DB.Collection("payment_anomalies").UpdateOne(ctx,
+		bson.M{"_id": anomalyID, "status": "open"},
+		bson.M{"$set": bson.M{
+			"status":         "resolved",
+			"resolvedBy":     adminID,
+			"resolutionNote": req.Note,
+			"resolvedAt":     now,
+		}})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to resolve payment anomaly",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Open payment anomaly not found",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payment anomaly resolved successfully",
+	})
+}
+
+// GetRefunds lists subscription refunds, by default those waiting for an admin to pay them out
+func (ac *AdminController) GetRefunds(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "admin" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only admins can review refunds",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	// Manual refunds by default, "all" returns every refund
+	filter := bson.M{"status": models.RefundStatusManual}
+	switch status := c.QueryParam("status"); status {
+	case "", models.RefundStatusManual:
+	case "all":
+		filter = bson.M{}
+	default:
+		filter["status"] = status
+	}
+
+	collection := ac.DB.Collection("refunds")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to count refunds",
+		})
+	}
+
+	cursor, err := collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetSkip(int64((page-1)*limit)).SetLimit(int64(limit)))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to retrieve refunds",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	refunds := []models.Refund{}
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to decode refunds",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Refunds retrieved successfully",
+		Data: map[string]interface{}{
+			"refunds": refunds,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// MarkRefundPaidOut records that an admin paid out a manual refund
+func (ac *AdminController) MarkRefundPaidOut(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "admin" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only admins can pay out refunds",
+		})
+	}
+	adminID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid admin ID",
+		})
+	}
+
+	refundID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid refund ID",
+		})
+	}
+
+	var req models.RefundPaidOutRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if strings.TrimSpace(req.Reference) == "" {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "A payout reference is required",
+		})
+	}
+
+	now := time.Now()
+	result, err := ac.DB.Collection("refunds").UpdateOne(ctx,
+		bson.M{"_id": refundID, "status": models.RefundStatusManual},
+		bson.M{"$set": bson.M{
+			"status":    models.RefundStatusPaidOut,
+			"paidOutBy": adminID,
+			"paidOutAt": now,
+			"reference": strings.TrimSpace(req.Reference),
+			"note":      req.Note,
+			"updatedAt": now,
+		}})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to update refund",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Manual refund not found",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Refund marked as paid out",
+	})
+}
+
 // GetAllBranchCommentsForAdmin retrieves all company and wholesaler branch comments for admin dashboard
 func (ac *AdminController) GetAllBranchCommentsForAdmin(c echo.Context) error {
 	// Check if user is admin
@@ -1108,6 +1108,18 @@ func (ac *AuthController) SignupServiceProviderWithLogo(ctx echo.Context) error
 			endDate := startDate.AddDate(1, 0, 0)
 			signupRequest.ServiceProviderInfo.AvailableDays = signupRequest.ServiceProviderInfo.RegenerateAvailableDaysFromWeekdays(startDate, endDate)
 		}
+
+		// Availability is read from the schedule: take the one sent, or build it from the day and hour strings
+		if signupRequest.ServiceProviderInfo.Schedule != nil {
+			if err := signupRequest.ServiceProviderInfo.Schedule.Validate(); err != nil {
+				return ctx.JSON(http.StatusBadRequest, models.Response{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid availability schedule: " + err.Error(),
+				})
+			}
+		} else {
+			signupRequest.ServiceProviderInfo.Schedule = models.ScheduleFromLegacy(signupRequest.ServiceProviderInfo)
+		}
 	}
 
 	// Validate required fields
@@ -1970,6 +1982,9 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 		UpdatedAt:       time.Now(),
 	}
 
+	// Business to route to the salesperson of its territory once the account exists
+	var signup *services.TerritorySignup
+
 	// If it's a company signup, create company record first
 	if signupData.UserType == "company" && signupData.CompanyData != nil {
 		// Create the main branch for the company
@@ -2022,6 +2037,17 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 			})
 		}
 
+		signup = &services.TerritorySignup{
+			EntityType:   "company",
+			EntityID:     company.ID,
+			BusinessName: company.BusinessName,
+			Category:     company.Category,
+			ContactName:  signupData.FullName,
+			Phone:        signupData.Phone,
+			Email:        signupData.Email,
+			Address:      company.ContactInfo.Address,
+		}
+
 		// Update user with company ID and referral code
 		user.CompanyID = &company.ID
 		user.ReferralCode = referralCode
@@ -2036,9 +2062,6 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 				// Award $1 to the salesperson
 				referralReward := 1.0
 				update := bson.M{
-					"$inc": bson.M{
-						"referralBalance": referralReward,
-					},
 					"$push": bson.M{
 						"referrals": company.ID,
 					},
@@ -2047,6 +2070,9 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 					},
 				}
 				_, _ = salespersonsCollection.UpdateByID(ctx, referrerSalesperson.ID, update)
+				if err := services.NewWalletService(ac.DB.Database("barrim")).RecordReferralReward(ctx, referrerSalesperson.ID, referralReward, company.ID, "Referral reward for company signup"); err != nil {
+					log.Printf("Failed to record referral reward: %v", err)
+				}
 
 				// Create a referral commission record
 				referralCommission := models.ReferralCommission{
@@ -2197,6 +2223,17 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 			})
 		}
 
+		signup = &services.TerritorySignup{
+			EntityType:   "wholesaler",
+			EntityID:     wholesaler.ID,
+			BusinessName: wholesaler.BusinessName,
+			Category:     wholesaler.Category,
+			ContactName:  signupData.FullName,
+			Phone:        signupData.Phone,
+			Email:        signupData.Email,
+			Address:      wholesaler.ContactInfo.Address,
+		}
+
 		// Update user with wholesaler ID and referral code
 		user.WholesalerID = &wholesalerID
 		user.ReferralCode = referralCode
@@ -2211,9 +2248,6 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 				// Award $1 to the salesperson
 				referralReward := 1.0
 				update := bson.M{
-					"$inc": bson.M{
-						"referralBalance": referralReward,
-					},
 					"$push": bson.M{
 						"referrals": wholesalerID,
 					},
@@ -2222,6 +2256,9 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 					},
 				}
 				_, _ = salespersonsCollection.UpdateByID(ctx, referrerSalesperson.ID, update)
+				if err := services.NewWalletService(ac.DB.Database("barrim")).RecordReferralReward(ctx, referrerSalesperson.ID, referralReward, wholesalerID, "Referral reward for wholesaler signup"); err != nil {
+					log.Printf("Failed to record referral reward: %v", err)
+				}
 
 				// Create a referral commission record
 				referralCommission := models.ReferralCommission{
@@ -2334,6 +2371,17 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 			})
 		}
 
+		signup = &services.TerritorySignup{
+			EntityType:   "serviceProvider",
+			EntityID:     serviceProvider.ID,
+			BusinessName: serviceProvider.BusinessName,
+			Category:     serviceProvider.Category,
+			ContactName:  signupData.FullName,
+			Phone:        signupData.Phone,
+			Email:        signupData.Email,
+			Address:      serviceProvider.ContactInfo.Address,
+		}
+
 		// Update user with service provider ID and ServiceProviderInfo
 		user.ServiceProviderID = &serviceProvider.ID
 		// Also store ServiceProviderInfo in the users collection for easy access
@@ -2352,9 +2400,6 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 			// Award $1 to the salesperson
 			referralReward := 1.0
 			update := bson.M{
-				"$inc": bson.M{
-					"referralBalance": referralReward,
-				},
 				"$push": bson.M{
 					"referrals": userID,
 				},
@@ -2363,6 +2408,9 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 				},
 			}
 			_, _ = salespersonsCollection.UpdateByID(ctx, referrerSalesperson.ID, update)
+			if err := services.NewWalletService(ac.DB.Database("barrim")).RecordReferralReward(ctx, referrerSalesperson.ID, referralReward, userID, "Referral reward for service provider signup"); err != nil {
+				log.Printf("Failed to record referral reward: %v", err)
+			}
 
 			// Create a referral commission record
 			referralCommission := models.ReferralCommission{
@@ -2396,6 +2444,13 @@ func (ac *AuthController) VerifyOTP(c echo.Context) error {
 		})
 	}
 
+	// Route the business to the salesperson of its territory (log error but do not fail request)
+	if signup != nil {
+		if err := services.NewTerritoryService(ac.DB.Database("barrim")).RouteSignup(ctx, *signup); err != nil {
+			log.Printf("Failed to route sign-up %s to its territory: %v", signup.EntityID.Hex(), err)
+		}
+	}
+
 	// Generate JWT token after all records are created
 	token, refreshToken, err := middleware.GenerateJWT(user.ID.Hex(), user.Email, user.UserType)
 	if err != nil {
@@ -3,6 +3,7 @@ package controllers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 	"github.com/HSouheill/barrim_backend/websocket"
 	"github.com/labstack/echo/v4"
@@ -33,6 +35,33 @@ func NewBookingController(db *mongo.Client, hub *websocket.Hub) *BookingControll
 	return &BookingController{db: db, hub: hub}
 }
 
+// bookingSlotErrorResponse maps booking slot service errors to HTTP responses
+func bookingSlotErrorResponse(ctx echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSlotTaken):
+		return ctx.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrSlotProviderMissing):
+		return ctx.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidTimeSlot), errors.Is(err, services.ErrSlotUnavailable):
+		return ctx.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Booking slot request failed: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process booking",
+		})
+	}
+}
+
 // CreateBooking handles the creation of a new booking
 func (c *BookingController) CreateBooking(ctx echo.Context) error {
 	// Get user from token
@@ -138,6 +167,11 @@ func (c *BookingController) CreateBooking(ctx echo.Context) error {
 		}
 	}
 
+	// Emergencies go to the nearest available providers instead of the one picked
+	if request.IsEmergency {
+		return c.dispatchEmergencyBooking(ctx, &user, request, mediaTypes, mediaURLs, thumbnailURLs)
+	}
+
 	// Validate service provider ID
 	serviceProviderID, err := primitive.ObjectIDFromHex(request.ServiceProviderID)
 	if err != nil {
@@ -166,46 +200,44 @@ func (c *BookingController) CreateBooking(ctx echo.Context) error {
 		})
 	}
 
-	// Check service provider availability using ServiceProviderInfo from serviceProviders collection
-	// if !isServiceProviderAvailable(serviceProvider, request.BookingDate, request.TimeSlot) {
-	// 	return ctx.JSON(http.StatusBadRequest, models.Response{
-	// 		Status:  http.StatusBadRequest,
-	// 		Message: "Service provider is not available at this time",
-	// 	})
-	// }
+	// The provider may refuse or ask for a confirmation from users who missed past bookings
+	confirmationRequired, err := services.NewBookingAttendanceService(c.db.Database("barrim")).CheckBookingPolicy(context.Background(), serviceProvider, user.ID)
+	if err != nil {
+		return bookingAttendanceErrorResponse(ctx, err)
+	}
 
-	// Check if the time slot is already booked
 	bookingsCollection := c.db.Database("barrim").Collection("bookings")
-	bookingDate := time.Date(
-		request.BookingDate.Year(),
-		request.BookingDate.Month(),
-		request.BookingDate.Day(),
-		0, 0, 0, 0,
-		request.BookingDate.Location(),
-	)
-
-	// Check if the time slot is already booked
-	var existingBooking models.Booking
-	err = bookingsCollection.FindOne(context.Background(), bson.M{
-		"serviceProviderId": serviceProviderID,
-		"bookingDate":       bookingDate,
-		"timeSlot":          request.TimeSlot,
-		"status":            bson.M{"$ne": "cancelled"},
-	}).Decode(&existingBooking)
-
-	if err == nil {
-		// Found an existing booking for this time slot
-		return ctx.JSON(http.StatusConflict, models.Response{
-			Status:  http.StatusConflict,
-			Message: "This time slot is already booked",
-		})
-	} else if err != mongo.ErrNoDocuments {
-		// A database error occurred
+	bookingDate := services.BookingDay(request.BookingDate)
+
+	// The provider's plan limits how many bookings it can take each month
+	entitlements, err := services.NewEntitlementService(c.db.Database("barrim")).ForServiceProvider(context.Background(), serviceProviderID)
+	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Error checking booking availability",
 		})
 	}
+	if entitlements.MaxBookingsPerMonth != models.Unlimited {
+		today := time.Now()
+		monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+		monthlyBookings, err := bookingsCollection.CountDocuments(context.Background(), bson.M{
+			"serviceProviderId": serviceProviderID,
+			"createdAt":         bson.M{"$gte": monthStart},
+			"status":            bson.M{"$ne": "cancelled"},
+		})
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Error checking booking availability",
+			})
+		}
+		if !entitlements.Allows(models.EntitlementBookingsPerMonth, int(monthlyBookings)+1) {
+			return ctx.JSON(http.StatusForbidden, models.Response{
+				Status:  http.StatusForbidden,
+				Message: "This service provider is not accepting more bookings this month",
+			})
+		}
+	}
 
 	// Create new booking
 	now := time.Now()
@@ -225,14 +257,11 @@ func (c *BookingController) CreateBooking(ctx echo.Context) error {
 		CreatedAt:         now,
 		UpdatedAt:         now,
 	}
+	booking.AttendanceConfirmationRequired = confirmationRequired
 
-	// Insert booking into database
-	_, err = bookingsCollection.InsertOne(context.Background(), booking)
-	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to create booking",
-		})
+	// The booking takes a place in one of the provider's slots
+	if err := services.NewBookingSlotService(c.db.Database("barrim")).Reserve(context.Background(), serviceProvider, &booking); err != nil {
+		return bookingSlotErrorResponse(ctx, err)
 	}
 
 	// Send WebSocket notification to service provider
@@ -262,7 +291,7 @@ func (c *BookingController) CreateBooking(ctx echo.Context) error {
 		"customerName": user.FullName,
 		"serviceType":  serviceType,
 		"bookingDate":  bookingDate.Format("2006-01-02"),
-		"timeSlot":     request.TimeSlot,
+		"timeSlot":     booking.TimeSlot,
 		"isEmergency":  fmt.Sprintf("%t", request.IsEmergency),
 	}
 
@@ -284,13 +313,76 @@ func (c *BookingController) CreateBooking(ctx echo.Context) error {
 		// Continue execution even if saving notification fails
 	}
 
+	message := "Booking created successfully"
+	if booking.AttendanceConfirmBy != nil {
+		message = fmt.Sprintf("Booking created successfully. Please confirm your attendance before %s or it will be cancelled",
+			booking.AttendanceConfirmBy.In(serviceProvider.ServiceProviderInfo.EffectiveSchedule().Location()).Format("Jan 2, 3:04 PM"))
+	}
 	return ctx.JSON(http.StatusCreated, models.BookingResponse{
 		Status:  http.StatusCreated,
-		Message: "Booking created successfully",
+		Message: message,
 		Data:    &booking,
 	})
 }
 
+// dispatchEmergencyBooking creates an emergency booking and offers it to the nearest available providers of the
+// requested service type, near the location sent or the user's saved one
+func (c *BookingController) dispatchEmergencyBooking(ctx echo.Context, user *models.User, request models.BookingRequest, mediaTypes, mediaURLs, thumbnailURLs []string) error {
+	db := c.db.Database("barrim")
+	serviceType := strings.TrimSpace(request.ServiceType)
+	if serviceType == "" {
+		if providerID, err := primitive.ObjectIDFromHex(request.ServiceProviderID); err == nil {
+			var provider models.ServiceProvider
+			if err := db.Collection("serviceProviders").FindOne(context.Background(), bson.M{"_id": providerID}).Decode(&provider); err == nil && provider.ServiceProviderInfo != nil {
+				serviceType = provider.ServiceProviderInfo.ServiceType
+			}
+		}
+	}
+	var lat, lng float64
+	if request.Lat != nil && request.Lng != nil {
+		lat, lng = *request.Lat, *request.Lng
+	} else if user.Location != nil {
+		lat, lng = user.Location.Lat, user.Location.Lng
+	}
+
+	now := time.Now()
+	booking := models.Booking{
+		ID:            primitive.NewObjectID(),
+		UserID:        user.ID,
+		BookingDate:   services.BookingDay(now),
+		TimeSlot:      now.Format("3:04 PM"),
+		PhoneNumber:   request.PhoneNumber,
+		Details:       request.Details,
+		IsEmergency:   true,
+		Status:        "pending",
+		MediaTypes:    mediaTypes,
+		MediaURLs:     mediaURLs,
+		ThumbnailURLs: thumbnailURLs,
+		StartsAt:      &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	dispatch, err := services.NewEmergencyDispatchService(db, c.hub).Start(context.Background(), &booking, serviceType, lat, lng)
+	if err != nil {
+		return emergencyDispatchErrorResponse(ctx, err)
+	}
+
+	message := "Emergency request sent to nearby providers"
+	if dispatch.Status == models.DispatchStatusExhausted {
+		booking.Status = "cancelled"
+		booking.CancelledBy = models.BookingPartySystem
+		message = "No provider is available near you right now"
+	}
+	return ctx.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: message,
+		Data: map[string]interface{}{
+			"booking":  booking,
+			"dispatch": dispatch,
+		},
+	})
+}
+
 // GetUserBookings retrieves all bookings for the authenticated user
 func (c *BookingController) GetUserBookings(ctx echo.Context) error {
 	// Get user from token
@@ -419,6 +511,7 @@ func (c *BookingController) GetProviderBookings(ctx echo.Context) error {
 	}
 
 	// Enrich bookings with user information
+	attendanceService := services.NewBookingAttendanceService(c.db.Database("barrim"))
 	var enrichedBookings []map[string]interface{}
 	for _, booking := range bookings {
 		// Get user information
@@ -428,17 +521,27 @@ func (c *BookingController) GetProviderBookings(ctx echo.Context) error {
 			log.Printf("Error fetching user info for booking %s: %v", booking.ID.Hex(), err)
 		}
 
+		// Let the provider see how reliably the customer kept past bookings
+		reliability, err := attendanceService.UserReliability(context.Background(), booking.UserID)
+		if err != nil {
+			log.Printf("Error computing reliability for booking %s: %v", booking.ID.Hex(), err)
+		}
+
 		enrichedBooking := map[string]interface{}{
 			"booking": booking,
 			"user": map[string]interface{}{
-				"id":         bookingUser.ID,
-				"fullName":   bookingUser.FullName,
-				"email":      bookingUser.Email,
-				"phone":      bookingUser.Phone,
-				"profilePic": bookingUser.ProfilePic,
-				"userType":   bookingUser.UserType,
+				"id":          bookingUser.ID,
+				"fullName":    bookingUser.FullName,
+				"email":       bookingUser.Email,
+				"phone":       bookingUser.Phone,
+				"profilePic":  bookingUser.ProfilePic,
+				"userType":    bookingUser.UserType,
+				"reliability": reliability,
 			},
 		}
+		if proposal := services.PendingProposal(&booking); proposal != nil {
+			enrichedBooking["pendingReschedule"] = proposal
+		}
 
 		enrichedBookings = append(enrichedBookings, enrichedBooking)
 	}
@@ -494,172 +597,35 @@ func (c *BookingController) GetAvailableTimeSlots(ctx echo.Context) error {
 		})
 	}
 
-	// Check if the provider is available on this date (by checking availableDays)
-	dateStr = date.Format("2006-01-02")
-	isDateAvailable := false
-
-	// Check availableDays from serviceProvider data
-	if serviceProvider.ServiceProviderInfo != nil && serviceProvider.ServiceProviderInfo.AvailableDays != nil {
-		for _, availableDate := range serviceProvider.ServiceProviderInfo.AvailableDays {
-			if availableDate == dateStr {
-				isDateAvailable = true
-				break
-			}
-		}
-	}
-
-	// If not directly in availableDays, check if the weekday is available
-	if !isDateAvailable && serviceProvider.ServiceProviderInfo != nil && serviceProvider.ServiceProviderInfo.AvailableWeekdays != nil {
-		dayOfWeek := date.Weekday().String()
-		for _, weekdayStr := range serviceProvider.ServiceProviderInfo.AvailableWeekdays {
-			// Handle comma-separated weekdays
-			weekdays := strings.Split(weekdayStr, ",")
-			for _, weekday := range weekdays {
-				if strings.TrimSpace(weekday) == dayOfWeek {
-					isDateAvailable = true
-					break
-				}
-			}
-			if isDateAvailable {
-				break
-			}
-		}
-	}
-
-	if !isDateAvailable {
-		return ctx.JSON(http.StatusOK, models.Response{
-			Status:  http.StatusOK,
-			Message: "No available slots on this day",
-			Data:    []string{},
-		})
-	}
-
-	// Generate time slots based on provider's available hours
-	var startHour, endHour time.Time
-	var availableSlots []string
-
-	// Get available hours from serviceProvider data
-	if serviceProvider.ServiceProviderInfo != nil && len(serviceProvider.ServiceProviderInfo.AvailableHours) > 0 {
-		// Handle comma-separated hours format: "09:00,10:00,11:00,12:00,13:00,14:00,15:00"
-		hoursStr := serviceProvider.ServiceProviderInfo.AvailableHours[0]
-		hours := strings.Split(hoursStr, ",")
-
-		if len(hours) >= 2 {
-			// Parse start and end hours
-			startTimeStr := strings.TrimSpace(hours[0])
-			endTimeStr := strings.TrimSpace(hours[len(hours)-1])
-
-			// Parse times in 24-hour format
-			startHour, err = time.Parse("15:04", startTimeStr)
-			if err != nil {
-				return ctx.JSON(http.StatusInternalServerError, models.Response{
-					Status:  http.StatusInternalServerError,
-					Message: "Error parsing provider start time",
-				})
-			}
-
-			endHour, err = time.Parse("15:04", endTimeStr)
-			if err != nil {
-				return ctx.JSON(http.StatusInternalServerError, models.Response{
-					Status:  http.StatusInternalServerError,
-					Message: "Error parsing provider end time",
-				})
-			}
-
-			// Generate time slots at 30-minute intervals
-			for h := startHour; h.Before(endHour); h = h.Add(30 * time.Minute) {
-				// Format time as "3:04 PM" for UI display
-				timeSlot := h.Format("3:04 PM")
-				availableSlots = append(availableSlots, timeSlot)
-			}
-		} else {
-			// If we have individual hours, create slots for each hour
-			for _, hourStr := range hours {
-				hourStr = strings.TrimSpace(hourStr)
-				if hourStr != "" {
-					// Parse the hour and create a slot
-					hour, err := time.Parse("15:04", hourStr)
-					if err == nil {
-						timeSlot := hour.Format("3:04 PM")
-						availableSlots = append(availableSlots, timeSlot)
-					}
-				}
-			}
-		}
-	} else {
-		// Default time slots if provider hasn't specified hours
-		availableSlots = []string{
-			"9:00 AM", "9:30 AM", "10:00 AM", "10:30 AM", "11:00 AM", "11:30 AM",
-			"1:00 PM", "1:30 PM", "2:00 PM", "2:30 PM", "3:00 PM", "3:30 PM",
-			"4:00 PM", "4:30 PM", "5:00 PM",
-		}
-	}
-
-	// Get bookings for this provider on this date to filter out booked slots
-	bookingsCollection := c.db.Database("barrim").Collection("bookings")
-	bookingDate := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-
-	cursor, err := bookingsCollection.Find(context.Background(), bson.M{
-		"serviceProviderId": serviceProviderID,
-		"bookingDate":       bookingDate,
-		"status":            bson.M{"$ne": "cancelled"},
-	})
-
-	if err != nil && err != mongo.ErrNoDocuments {
+	slots, err := services.NewBookingSlotService(c.db.Database("barrim")).Slots(context.Background(), serviceProvider, date)
+	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Error retrieving bookings",
 		})
 	}
 
-	// Get booked time slots
-	var bookings []models.Booking
-	if err != mongo.ErrNoDocuments {
-		defer cursor.Close(context.Background())
-		if err := cursor.All(context.Background(), &bookings); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, models.Response{
-				Status:  http.StatusInternalServerError,
-				Message: "Error decoding bookings",
-			})
-		}
-	}
-
-	// Filter out booked slots
-	bookedSlots := make(map[string]bool)
-	for _, booking := range bookings {
-		bookedSlots[booking.TimeSlot] = true
+	// details=true returns every slot with its capacity and remaining places
+	if ctx.QueryParam("details") == "true" {
+		return ctx.JSON(http.StatusOK, models.Response{
+			Status:  http.StatusOK,
+			Message: "Available time slots retrieved successfully",
+			Data:    slots,
+		})
 	}
 
-	var freeSlots []string
-	for _, slot := range availableSlots {
-		if !bookedSlots[slot] {
-			freeSlots = append(freeSlots, slot)
+	freeSlots := []string{}
+	for _, slot := range slots {
+		if slot.Remaining > 0 {
+			freeSlots = append(freeSlots, slot.TimeSlot)
 		}
 	}
-
-	// Filter out past time slots if the date is today
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-
-	if bookingDate.Equal(today) {
-		var filteredSlots []string
-		currentHour := now.Hour()
-		currentMinute := now.Minute()
-
-		for _, slot := range freeSlots {
-			// Parse time like "9:00 AM" or "1:30 PM"
-			timeComponents, err := time.Parse("3:04 PM", slot)
-			if err == nil {
-				slotHour := timeComponents.Hour()
-				slotMinute := timeComponents.Minute()
-
-				// If slot time is after current time, keep it
-				if slotHour > currentHour || (slotHour == currentHour && slotMinute > currentMinute) {
-					filteredSlots = append(filteredSlots, slot)
-				}
-			}
-		}
-		freeSlots = filteredSlots
+	if len(slots) == 0 {
+		return ctx.JSON(http.StatusOK, models.Response{
+			Status:  http.StatusOK,
+			Message: "No available slots on this day",
+			Data:    freeSlots,
+		})
 	}
 
 	return ctx.JSON(http.StatusOK, models.Response{
@@ -761,17 +727,43 @@ func (c *BookingController) UpdateBookingStatus(ctx echo.Context) error {
 		})
 	}
 
-	// Update booking status
-	_, err = collection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": objectID},
-		bson.M{
-			"$set": bson.M{
-				"status":    status,
-				"updatedAt": time.Now(),
-			},
-		},
-	)
+	// A cancelled or rejected booking has given up its slot and cannot be reopened, and a recorded outcome is final
+	if booking.Status == "cancelled" || booking.Status == "rejected" ||
+		booking.Status == models.BookingStatusCompleted || booking.Status == models.BookingStatusNoShow {
+		return ctx.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Cannot update status: booking is already " + booking.Status,
+		})
+	}
+
+	// Completion counts towards reliability scores, so it is only recorded once the booking has started
+	if status == models.BookingStatusCompleted && time.Now().Before(services.BookingStartsAt(&booking)) {
+		return ctx.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: services.ErrBookingNotStarted.Error(),
+		})
+	}
+
+	// Update booking status, freeing the slot when the booking is cancelled
+	set := bson.M{
+		"status":    status,
+		"updatedAt": time.Now(),
+	}
+	update := bson.M{"$set": set}
+	if status == "cancelled" {
+		update["$unset"] = bson.M{"seat": ""}
+		set["cancelledBy"] = models.BookingPartyUser
+		if isServiceProvider {
+			set["cancelledBy"] = models.BookingPartyServiceProvider
+		}
+		// An emergency still looking for a provider stops, and its open offers are withdrawn
+		if booking.DispatchID != nil {
+			if err := services.NewEmergencyDispatchService(c.db.Database("barrim"), c.hub).Cancel(context.Background(), booking.ID); err != nil {
+				log.Printf("Failed to cancel the emergency dispatch of booking %s: %v", booking.ID.Hex(), err)
+			}
+		}
+	}
+	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update)
 	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
@@ -792,182 +784,6 @@ func (c *BookingController) CancelBooking(ctx echo.Context) error {
 	return c.UpdateBookingStatus(ctx)
 }
 
-// Helper function to check if a service provider is available at a specific time
-func isProviderAvailable(provider models.User, bookingDate time.Time, timeSlot string) bool {
-	// Format the date for comparison with available days
-	formattedDate := bookingDate.Format("2006-01-02")
-
-	if provider.ServiceProviderInfo == nil {
-		return false
-	}
-
-	// Check if provider works on this specific date
-	dateAvailable := false
-	if provider.ServiceProviderInfo.AvailableDays != nil {
-		for _, day := range provider.ServiceProviderInfo.AvailableDays {
-			if day == formattedDate {
-				dateAvailable = true
-				break
-			}
-		}
-	}
-
-	// If not available on this specific date, check weekdays
-	if !dateAvailable && provider.ServiceProviderInfo.AvailableWeekdays != nil {
-		dayOfWeek := bookingDate.Weekday().String()
-		for _, day := range provider.ServiceProviderInfo.AvailableWeekdays {
-			if day == dayOfWeek {
-				dateAvailable = true
-				break
-			}
-		}
-	}
-
-	if !dateAvailable {
-		return false
-	}
-
-	// If the provider has available hours, check if the requested time slot is within those hours
-	if provider.ServiceProviderInfo.AvailableHours != nil && len(provider.ServiceProviderInfo.AvailableHours) >= 2 {
-		// Parse the start and end hours
-		startHourStr := provider.ServiceProviderInfo.AvailableHours[0]
-		endHourStr := provider.ServiceProviderInfo.AvailableHours[1]
-
-		startHour, err := time.Parse("15:04", startHourStr)
-		if err != nil {
-			return false
-		}
-
-		endHour, err := time.Parse("15:04", endHourStr)
-		if err != nil {
-			return false
-		}
-
-		// Parse the requested time slot (format: "3:04 PM")
-		requestedTime, err := time.Parse("3:04 PM", timeSlot)
-		if err != nil {
-			return false
-		}
-
-		// Convert to comparable format (hours and minutes only)
-		requestedHour := time.Date(0, 1, 1, requestedTime.Hour(), requestedTime.Minute(), 0, 0, time.UTC)
-		startHourNormalized := time.Date(0, 1, 1, startHour.Hour(), startHour.Minute(), 0, 0, time.UTC)
-		endHourNormalized := time.Date(0, 1, 1, endHour.Hour(), endHour.Minute(), 0, 0, time.UTC)
-
-		// Check if the requested time is within the provider's working hours
-		return (requestedHour.Equal(startHourNormalized) || requestedHour.After(startHourNormalized)) &&
-			requestedHour.Before(endHourNormalized)
-	}
-
-	// If no specific hours are defined, use default business hours logic
-	// This could be improved with more specific default hour ranges if needed
-	return true
-
-}
-
-// Helper function to check if a service provider is available at a specific time using ServiceProviderInfo from serviceProviders collection
-func isServiceProviderAvailable(serviceProvider models.ServiceProvider, bookingDate time.Time, timeSlot string) bool {
-	// Format the date for comparison with available days
-	formattedDate := bookingDate.Format("2006-01-02")
-
-	// Debug logging
-	log.Printf("DEBUG: Checking availability for date: %s, timeSlot: %s", formattedDate, timeSlot)
-	log.Printf("DEBUG: ServiceProviderInfo: %+v", serviceProvider.ServiceProviderInfo)
-
-	if serviceProvider.ServiceProviderInfo == nil {
-		log.Printf("DEBUG: ServiceProviderInfo is nil")
-		return false
-	}
-
-	// Check if provider works on this specific date
-	dateAvailable := false
-	if serviceProvider.ServiceProviderInfo.AvailableDays != nil {
-		log.Printf("DEBUG: Checking AvailableDays: %v", serviceProvider.ServiceProviderInfo.AvailableDays)
-		for _, day := range serviceProvider.ServiceProviderInfo.AvailableDays {
-			if day == formattedDate {
-				dateAvailable = true
-				log.Printf("DEBUG: Found date in AvailableDays: %s", day)
-				break
-			}
-		}
-	}
-
-	// If not available on this specific date, check weekdays
-	if !dateAvailable && serviceProvider.ServiceProviderInfo.AvailableWeekdays != nil {
-		dayOfWeek := bookingDate.Weekday().String()
-		log.Printf("DEBUG: Checking AvailableWeekdays: %v for day: %s", serviceProvider.ServiceProviderInfo.AvailableWeekdays, dayOfWeek)
-		for _, day := range serviceProvider.ServiceProviderInfo.AvailableWeekdays {
-			if day == dayOfWeek {
-				dateAvailable = true
-				log.Printf("DEBUG: Found weekday in AvailableWeekdays: %s", day)
-				break
-			}
-		}
-	}
-
-	if !dateAvailable {
-		log.Printf("DEBUG: Date not available - AvailableDays: %v, AvailableWeekdays: %v", serviceProvider.ServiceProviderInfo.AvailableDays, serviceProvider.ServiceProviderInfo.AvailableWeekdays)
-		return false
-	}
-
-	// If the provider has available hours, check if the requested time slot is within those hours
-	if serviceProvider.ServiceProviderInfo.AvailableHours != nil && len(serviceProvider.ServiceProviderInfo.AvailableHours) >= 2 {
-		// Parse the start and end hours
-		startHourStr := serviceProvider.ServiceProviderInfo.AvailableHours[0]
-		endHourStr := serviceProvider.ServiceProviderInfo.AvailableHours[1]
-
-		log.Printf("DEBUG: Checking AvailableHours: %v", serviceProvider.ServiceProviderInfo.AvailableHours)
-		log.Printf("DEBUG: Start hour: %s, End hour: %s", startHourStr, endHourStr)
-
-		startHour, err := time.Parse("15:04", startHourStr)
-		if err != nil {
-			log.Printf("DEBUG: Error parsing start hour %s: %v", startHourStr, err)
-			return false
-		}
-
-		endHour, err := time.Parse("15:04", endHourStr)
-		if err != nil {
-			log.Printf("DEBUG: Error parsing end hour %s: %v", endHourStr, err)
-			return false
-		}
-
-		// Parse the requested time slot (format: "11:00" - 24-hour format)
-		requestedTime, err := time.Parse("15:04", timeSlot)
-		if err != nil {
-			log.Printf("DEBUG: Error parsing timeSlot as 24-hour format %s: %v", timeSlot, err)
-			// Try parsing as 12-hour format ("3:04 PM")
-			requestedTime, err = time.Parse("3:04 PM", timeSlot)
-			if err != nil {
-				log.Printf("DEBUG: Error parsing timeSlot as 12-hour format %s: %v", timeSlot, err)
-				return false
-			}
-			log.Printf("DEBUG: Successfully parsed timeSlot as 12-hour format: %s", timeSlot)
-		} else {
-			log.Printf("DEBUG: Successfully parsed timeSlot as 24-hour format: %s", timeSlot)
-		}
-
-		// Convert to comparable format (hours and minutes only)
-		requestedHour := time.Date(0, 1, 1, requestedTime.Hour(), requestedTime.Minute(), 0, 0, time.UTC)
-		startHourNormalized := time.Date(0, 1, 1, startHour.Hour(), startHour.Minute(), 0, 0, time.UTC)
-		endHourNormalized := time.Date(0, 1, 1, endHour.Hour(), endHour.Minute(), 0, 0, time.UTC)
-
-		log.Printf("DEBUG: Requested hour: %02d:%02d, Start hour: %02d:%02d, End hour: %02d:%02d",
-			requestedTime.Hour(), requestedTime.Minute(),
-			startHour.Hour(), startHour.Minute(),
-			endHour.Hour(), endHour.Minute())
-
-		// Check if the requested time is within the provider's working hours
-		isWithinHours := (requestedHour.Equal(startHourNormalized) || requestedHour.After(startHourNormalized)) &&
-			requestedHour.Before(endHourNormalized)
-
-		log.Printf("DEBUG: Time slot within hours: %v", isWithinHours)
-		return isWithinHours
-	}
-
-	// If no specific hours are defined, use default business hours logic
-	return true
-}
-
 // AcceptBooking allows a service provider to accept a booking request
 func (bc *BookingController) AcceptBooking(c echo.Context) error {
 	// Get booking ID from URL parameter
@@ -1100,14 +916,26 @@ func (bc *BookingController) AcceptBooking(c echo.Context) error {
 		update["$set"].(bson.M)["providerResponse"] = req.ProviderResponse
 	}
 
-	// Update the booking in the database
-	_, err = bookingCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	// A rejected booking frees its place in the slot
+	if req.Status == "rejected" {
+		update["$unset"] = bson.M{"seat": ""}
+	}
+
+	// Update the booking in the database, only while it is still pending so a concurrent
+	// accept, reject or cancellation is never overwritten
+	result, err := bookingCollection.UpdateOne(ctx, bson.M{"_id": objID, "status": "pending"}, update)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to update booking status: " + err.Error(),
 		})
 	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: "Cannot update status: the booking is no longer pending",
+		})
+	}
 
 	// Fetch the updated booking
 	err = bookingCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&booking)
@@ -1149,64 +977,823 @@ func (bc *BookingController) AcceptBooking(c echo.Context) error {
 	})
 }
 
-// GetPendingBookings retrieves all pending bookings for a service provider
-func (bc *BookingController) GetPendingBookings(c echo.Context) error {
-	// Get current user from token
-	claims := middleware.GetUserFromToken(c)
-	if claims == nil {
-		return c.JSON(http.StatusUnauthorized, models.Response{
-			Status:  http.StatusUnauthorized,
-			Message: "Authentication failed",
+// bookingRescheduleErrorResponse maps booking reschedule service errors to HTTP responses
+func bookingRescheduleErrorResponse(ctx echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrBookingNotFound), errors.Is(err, services.ErrRescheduleNotFound), errors.Is(err, services.ErrRescheduleProviderAbsent):
+		return ctx.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
 		})
-	}
-
-	// Ensure user is a service provider
-	if claims.UserType != "serviceProvider" {
-		return c.JSON(http.StatusForbidden, models.Response{
+	case errors.Is(err, services.ErrNotBookingParty), errors.Is(err, services.ErrRescheduleOwnProposal):
+		return ctx.JSON(http.StatusForbidden, models.Response{
 			Status:  http.StatusForbidden,
-			Message: "Only service providers can access pending bookings",
+			Message: err.Error(),
 		})
-	}
-
-	// Get full user from database
-	userID, err := primitive.ObjectIDFromHex(claims.UserID)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, models.Response{
+	case errors.Is(err, services.ErrRescheduleOutstanding):
+		return ctx.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrBookingNotReschedulable), errors.Is(err, services.ErrRescheduleSameSlot):
+		return ctx.JSON(http.StatusBadRequest, models.Response{
 			Status:  http.StatusBadRequest,
-			Message: "Invalid user ID",
+			Message: err.Error(),
 		})
+	default:
+		return bookingSlotErrorResponse(ctx, err)
 	}
+}
 
-	var user models.User
-	err = bc.db.Database("barrim").Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
-	if err != nil {
-		return c.JSON(http.StatusUnauthorized, models.Response{
-			Status:  http.StatusUnauthorized,
-			Message: "User not found",
-		})
+// notifyBookingParty tells one party of a booking about a change over the websocket hub, FCM and in-app notifications
+func (bc *BookingController) notifyBookingParty(booking *models.Booking, party, notifType, title, message string, data map[string]interface{}) {
+	recipient := booking.UserID
+	if party == models.BookingPartyServiceProvider {
+		recipient = booking.ServiceProviderID
 	}
 
-	// Get the booking collection
-	bookingCollection := bc.db.Database("barrim").Collection("bookings")
+	if bc.hub != nil {
+		if err := bc.hub.SendToUser(recipient, websocket.Notification{
+			Type:    notifType,
+			Message: message,
+			Data:    booking,
+		}); err != nil {
+			log.Printf("Failed to send WebSocket notification for booking %s: %v", booking.ID.Hex(), err)
+		}
+	}
 
-	// Find all pending bookings for this service provider
-	// Use unified ID approach to handle both new and legacy booking data
-	ctx := context.Background()
+	var err error
+	if party == models.BookingPartyServiceProvider {
+		err = utils.SendFCMNotificationToServiceProvider(bc.db, recipient, title, message, data)
+	} else {
+		err = utils.SendFCMNotificationToUser(bc.db, recipient, title, message, data)
+	}
+	if err != nil {
+		log.Printf("Failed to send FCM notification for booking %s: %v", booking.ID.Hex(), err)
+	}
 
-	// Build filter with unified ID support
+	if err := utils.SaveNotification(bc.db, recipient, title, message, notifType, data); err != nil {
+		log.Printf("Failed to save in-app notification for booking %s: %v", booking.ID.Hex(), err)
+	}
+}
+
+// otherBookingParty returns the party that did not make a reschedule proposal
+func otherBookingParty(party string) string {
+	if party == models.BookingPartyUser {
+		return models.BookingPartyServiceProvider
+	}
+	return models.BookingPartyUser
+}
+
+// ProposeBookingReschedule lets the user or the provider of a booking propose a new date and time
+func (bc *BookingController) ProposeBookingReschedule(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookingID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid booking ID",
+		})
+	}
+	var req models.BookingRescheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	booking, proposal, err := services.NewBookingRescheduleService(bc.db.Database("barrim")).Propose(ctx, bookingID, userID, req)
+	if err != nil {
+		return bookingRescheduleErrorResponse(c, err)
+	}
+
+	message := fmt.Sprintf("A new time was proposed for your booking: %s at %s", proposal.BookingDate.Format("2006-01-02"), proposal.TimeSlot)
+	bc.notifyBookingParty(booking, otherBookingParty(proposal.ProposedByRole), "booking_reschedule_proposed", "Booking Reschedule Proposed", message, map[string]interface{}{
+		"bookingId":    booking.ID.Hex(),
+		"proposalId":   proposal.ID.Hex(),
+		"bookingDate":  proposal.BookingDate.Format("2006-01-02"),
+		"timeSlot":     proposal.TimeSlot,
+		"fromDate":     proposal.FromDate.Format("2006-01-02"),
+		"fromTimeSlot": proposal.FromTimeSlot,
+	})
+
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Reschedule proposed successfully",
+		Data:    booking,
+	})
+}
+
+// RespondBookingReschedule lets the other party accept or decline a reschedule proposal
+func (bc *BookingController) RespondBookingReschedule(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookingID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid booking ID",
+		})
+	}
+	proposalID, err := primitive.ObjectIDFromHex(c.Param("proposalId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid proposal ID",
+		})
+	}
+	var req models.BookingRescheduleResponseRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	booking, proposal, err := services.NewBookingRescheduleService(bc.db.Database("barrim")).Respond(ctx, bookingID, proposalID, userID, req)
+	if err != nil {
+		return bookingRescheduleErrorResponse(c, err)
+	}
+
+	title := "Booking Reschedule Accepted"
+	if proposal.Status == models.RescheduleStatusDeclined {
+		title = "Booking Reschedule Declined"
+	}
+	message := fmt.Sprintf("Your proposal to move the booking to %s at %s was %s", proposal.BookingDate.Format("2006-01-02"), proposal.TimeSlot, proposal.Status)
+	bc.notifyBookingParty(booking, proposal.ProposedByRole, "booking_reschedule_"+proposal.Status, title, message, map[string]interface{}{
+		"bookingId":   booking.ID.Hex(),
+		"proposalId":  proposal.ID.Hex(),
+		"status":      proposal.Status,
+		"bookingDate": booking.BookingDate.Format("2006-01-02"),
+		"timeSlot":    booking.TimeSlot,
+	})
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Reschedule " + proposal.Status + " successfully",
+		Data:    booking,
+	})
+}
+
+// GetBookingSlotSettings returns the slot length, buffer and capacity of the authenticated service provider
+func (bc *BookingController) GetBookingSlotSettings(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	provider, err := services.NewBookingSlotService(bc.db.Database("barrim")).ProviderForUser(ctx, userID)
+	if err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Booking slot settings retrieved successfully",
+		Data:    services.SlotSettings(provider.ServiceProviderInfo),
+	})
+}
+
+// UpdateBookingSlotSettings sets the slot length, buffer and capacity of the authenticated service provider
+func (bc *BookingController) UpdateBookingSlotSettings(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.BookingSlotSettings
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	slotService := services.NewBookingSlotService(bc.db.Database("barrim"))
+	provider, err := slotService.ProviderForUser(ctx, userID)
+	if err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	if err := slotService.UpdateSettings(ctx, provider.ID, req); err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Booking slot settings updated successfully",
+		Data:    req,
+	})
+}
+
+// bookingAttendanceErrorResponse maps booking attendance service errors to HTTP responses
+func bookingAttendanceErrorResponse(ctx echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrBookingBlocked), errors.Is(err, services.ErrNotBookingProvider):
+		return ctx.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrBookingPolicyUserMissing):
+		return ctx.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrBookingNotStarted), errors.Is(err, services.ErrBookingOutcomeNotAllowed),
+		errors.Is(err, services.ErrAttendanceNotRequired), errors.Is(err, services.ErrAttendanceNotConfirmable),
+		errors.Is(err, services.ErrBookingPolicyProviderSelf):
+		return ctx.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		return bookingRescheduleErrorResponse(ctx, err)
+	}
+}
+
+// RecordBookingOutcome lets the service provider of a booking mark it completed or no-show once its time has passed
+func (bc *BookingController) RecordBookingOutcome(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookingID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid booking ID",
+		})
+	}
+	var req models.BookingOutcomeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	booking, err := services.NewBookingAttendanceService(bc.db.Database("barrim")).RecordOutcome(ctx, bookingID, userID, req)
+	if err != nil {
+		return bookingAttendanceErrorResponse(c, err)
+	}
+
+	when := booking.BookingDate.Format("Jan 2") + " at " + booking.TimeSlot
+	message := "Your booking on " + when + " was marked as completed"
+	if req.Status == models.BookingStatusNoShow {
+		message = "Your booking on " + when + " was marked as missed"
+	}
+	bc.notifyBookingParty(booking, models.BookingPartyUser, "booking_outcome", "Booking Updated", message, map[string]interface{}{
+		"bookingId": booking.ID.Hex(),
+		"status":    booking.Status,
+	})
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Booking outcome recorded successfully",
+		Data:    booking,
+	})
+}
+
+// ConfirmBookingAttendance lets a user confirm they will come to a booking the provider asked them to confirm
+func (bc *BookingController) ConfirmBookingAttendance(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookingID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid booking ID",
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	booking, err := services.NewBookingAttendanceService(bc.db.Database("barrim")).ConfirmAttendance(ctx, bookingID, userID)
+	if err != nil {
+		return bookingAttendanceErrorResponse(c, err)
+	}
+
+	bc.notifyBookingParty(booking, models.BookingPartyServiceProvider, "booking_attendance_confirmed", "Attendance Confirmed",
+		"The customer confirmed their booking on "+booking.BookingDate.Format("Jan 2")+" at "+booking.TimeSlot,
+		map[string]interface{}{"bookingId": booking.ID.Hex()})
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Attendance confirmed successfully",
+		Data:    booking,
+	})
+}
+
+// GetBookingReliability returns the reliability score of the authenticated user or service provider
+func (bc *BookingController) GetBookingReliability(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	db := bc.db.Database("barrim")
+	attendanceService := services.NewBookingAttendanceService(db)
+	var score models.ReliabilityScore
+	if claims.UserType == "serviceProvider" {
+		ids := []primitive.ObjectID{userID}
+		if provider, err := services.NewBookingSlotService(db).ProviderForUser(ctx, userID); err == nil {
+			ids = append(ids, provider.ID)
+		}
+		score, err = attendanceService.ProviderReliability(ctx, ids...)
+	} else {
+		score, err = attendanceService.UserReliability(ctx, userID)
+	}
+	if err != nil {
+		log.Printf("Failed to compute reliability of %s: %v", userID.Hex(), err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to retrieve reliability score",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Reliability score retrieved successfully",
+		Data:    score,
+	})
+}
+
+// GetServiceProviderReliability returns the public reliability score of a service provider
+func (bc *BookingController) GetServiceProviderReliability(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	providerID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid service provider ID",
+		})
+	}
+	var provider models.ServiceProvider
+	if err := bc.db.Database("barrim").Collection("serviceProviders").FindOne(ctx, bson.M{"_id": providerID}).Decode(&provider); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, models.Response{
+				Status:  http.StatusNotFound,
+				Message: "Service provider not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Error finding service provider",
+		})
+	}
+
+	ids := []primitive.ObjectID{provider.ID}
+	if !provider.UserID.IsZero() {
+		ids = append(ids, provider.UserID)
+	}
+	score, err := services.NewBookingAttendanceService(bc.db.Database("barrim")).ProviderReliability(ctx, ids...)
+	if err != nil {
+		log.Printf("Failed to compute reliability of service provider %s: %v", providerID.Hex(), err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to retrieve reliability score",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Reliability score retrieved successfully",
+		Data:    score,
+	})
+}
+
+// GetBookingPolicy returns the no-show thresholds and blocked users of the authenticated service provider
+func (bc *BookingController) GetBookingPolicy(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	provider, err := services.NewBookingSlotService(bc.db.Database("barrim")).ProviderForUser(ctx, userID)
+	if err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Booking policy retrieved successfully",
+		Data:    services.BookingPolicyOf(*provider),
+	})
+}
+
+// UpdateBookingPolicy sets after how many no-shows users must confirm their attendance or can no longer book
+// the authenticated service provider
+func (bc *BookingController) UpdateBookingPolicy(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.BookingPolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	db := bc.db.Database("barrim")
+	provider, err := services.NewBookingSlotService(db).ProviderForUser(ctx, userID)
+	if err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	if err := services.NewBookingAttendanceService(db).UpdatePolicy(ctx, provider.ID, req); err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Booking policy updated successfully",
+		Data:    req,
+	})
+}
+
+// BlockBookingUser stops a user from booking the authenticated service provider
+func (bc *BookingController) BlockBookingUser(c echo.Context) error {
+	return bc.setBookingUserBlocked(c, true)
+}
+
+// UnblockBookingUser lets a blocked user book the authenticated service provider again
+func (bc *BookingController) UnblockBookingUser(c echo.Context) error {
+	return bc.setBookingUserBlocked(c, false)
+}
+
+// setBookingUserBlocked adds the user in the path to or removes them from the provider's blocked users
+func (bc *BookingController) setBookingUserBlocked(c echo.Context, blocked bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	blockedID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	if blockedID == userID {
+		return bookingAttendanceErrorResponse(c, services.ErrBookingPolicyProviderSelf)
+	}
+
+	db := bc.db.Database("barrim")
+	provider, err := services.NewBookingSlotService(db).ProviderForUser(ctx, userID)
+	if err != nil {
+		return bookingSlotErrorResponse(c, err)
+	}
+	if err := services.NewBookingAttendanceService(db).SetBlocked(ctx, *provider, blockedID, blocked); err != nil {
+		return bookingAttendanceErrorResponse(c, err)
+	}
+
+	message := "User blocked successfully"
+	if !blocked {
+		message = "User unblocked successfully"
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+	})
+}
+
+// emergencyDispatchErrorResponse maps emergency dispatch service errors to HTTP responses
+func emergencyDispatchErrorResponse(ctx echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrDispatchServiceType), errors.Is(err, services.ErrDispatchLocation):
+		return ctx.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrDispatchNotFound), errors.Is(err, services.ErrDispatchOfferMissing):
+		return ctx.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrDispatchTaken), errors.Is(err, services.ErrDispatchCancelled):
+		return ctx.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Emergency dispatch request failed: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process emergency request",
+		})
+	}
+}
+
+// GetEmergencyOffers lists the emergency requests the authenticated service provider can still accept
+func (bc *BookingController) GetEmergencyOffers(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	offers, err := services.NewEmergencyDispatchService(bc.db.Database("barrim"), bc.hub).OpenOffers(ctx, userID)
+	if err != nil {
+		return emergencyDispatchErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Emergency offers retrieved successfully",
+		Data:    offers,
+	})
+}
+
+// AcceptEmergencyOffer assigns an emergency request to the authenticated service provider if nobody took it first
+func (bc *BookingController) AcceptEmergencyOffer(c echo.Context) error {
+	return bc.respondEmergencyOffer(c, true)
+}
+
+// DeclineEmergencyOffer turns down an emergency request offered to the authenticated service provider
+func (bc *BookingController) DeclineEmergencyOffer(c echo.Context) error {
+	return bc.respondEmergencyOffer(c, false)
+}
+
+// respondEmergencyOffer answers the caller's offer of the dispatch in the path
+func (bc *BookingController) respondEmergencyOffer(c echo.Context, accept bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dispatchID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid emergency request ID",
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	_, booking, err := services.NewEmergencyDispatchService(bc.db.Database("barrim"), bc.hub).Respond(ctx, dispatchID, userID, accept)
+	if err != nil {
+		return emergencyDispatchErrorResponse(c, err)
+	}
+	if !accept {
+		return c.JSON(http.StatusOK, models.Response{
+			Status:  http.StatusOK,
+			Message: "Emergency request declined",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Emergency request accepted successfully",
+		Data:    booking,
+	})
+}
+
+// GetBookingDispatch shows the user of an emergency booking how the search for a provider is going
+func (bc *BookingController) GetBookingDispatch(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookingID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid booking ID",
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	dispatch, err := services.NewEmergencyDispatchService(bc.db.Database("barrim"), bc.hub).ForBooking(ctx, bookingID)
+	if err != nil {
+		return emergencyDispatchErrorResponse(c, err)
+	}
+	if dispatch.UserID != userID {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "You don't have permission to view this emergency request",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Emergency request retrieved successfully",
+		Data:    dispatch,
+	})
+}
+
+// GetEmergencyDispatchesForAdmin lists emergency dispatches with their offers and audit trail, newest first
+func (bc *BookingController) GetEmergencyDispatchesForAdmin(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	dispatches, total, err := services.NewEmergencyDispatchService(bc.db.Database("barrim"), bc.hub).List(ctx, c.QueryParam("status"), page, limit)
+	if err != nil {
+		return emergencyDispatchErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Emergency dispatches retrieved successfully",
+		Data: map[string]interface{}{
+			"dispatches": dispatches,
+			"pagination": map[string]interface{}{
+				"currentPage": page,
+				"totalPages":  (total + int64(limit) - 1) / int64(limit),
+				"totalCount":  total,
+				"limit":       limit,
+			},
+		},
+	})
+}
+
+// GetPendingBookings retrieves all pending bookings for a service provider
+func (bc *BookingController) GetPendingBookings(c echo.Context) error {
+	// Get current user from token
+	claims := middleware.GetUserFromToken(c)
+	if claims == nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Authentication failed",
+		})
+	}
+
+	// Ensure user is a service provider
+	if claims.UserType != "serviceProvider" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only service providers can access pending bookings",
+		})
+	}
+
+	// Get full user from database
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	var user models.User
+	err = bc.db.Database("barrim").Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "User not found",
+		})
+	}
+
+	// Get the booking collection
+	bookingCollection := bc.db.Database("barrim").Collection("bookings")
+
+	// Find all pending bookings for this service provider
+	// Use unified ID approach to handle both new and legacy booking data
+	ctx := context.Background()
+
+	// Bookings waiting for an answer: new requests, and reschedules the customer proposed
+	awaitingAnswer := bson.M{"$or": []bson.M{
+		{"status": "pending"},
+		{
+			"status": bson.M{"$in": services.BookingSlotHoldingStatuses},
+			"rescheduleProposals": bson.M{"$elemMatch": bson.M{
+				"status":         models.RescheduleStatusPending,
+				"proposedByRole": models.BookingPartyUser,
+			}},
+		},
+	}}
+
+	// Build filter with unified ID support
 	filter := bson.M{
-		"status": "pending",
-		"$or": []bson.M{
+		"$and": []bson.M{awaitingAnswer, {"$or": []bson.M{
 			{"serviceProviderId": user.ID},                // New unified approach
 			{"serviceProviderId": user.ServiceProviderID}, // Legacy approach
-		},
+		}}},
 	}
 
 	// Remove the $or clause if ServiceProviderID is nil
 	if user.ServiceProviderID == nil {
 		filter = bson.M{
-			"serviceProviderId": user.ID,
-			"status":            "pending",
+			"$and": []bson.M{awaitingAnswer, {"serviceProviderId": user.ID}},
 		}
 	}
 
@@ -1230,6 +1817,7 @@ func (bc *BookingController) GetPendingBookings(c echo.Context) error {
 	}
 
 	// Enrich bookings with user information
+	attendanceService := services.NewBookingAttendanceService(bc.db.Database("barrim"))
 	var enrichedBookings []map[string]interface{}
 	for _, booking := range bookings {
 		// Get user information
@@ -1239,15 +1827,22 @@ func (bc *BookingController) GetPendingBookings(c echo.Context) error {
 			log.Printf("Error fetching user info for booking %s: %v", booking.ID.Hex(), err)
 		}
 
+		// Let the provider see how reliably the customer kept past bookings
+		reliability, err := attendanceService.UserReliability(ctx, booking.UserID)
+		if err != nil {
+			log.Printf("Error computing reliability for booking %s: %v", booking.ID.Hex(), err)
+		}
+
 		enrichedBooking := map[string]interface{}{
 			"booking": booking,
 			"user": map[string]interface{}{
-				"id":         bookingUser.ID,
-				"fullName":   bookingUser.FullName,
-				"email":      bookingUser.Email,
-				"phone":      bookingUser.Phone,
-				"profilePic": bookingUser.ProfilePic,
-				"userType":   bookingUser.UserType,
+				"id":          bookingUser.ID,
+				"fullName":    bookingUser.FullName,
+				"email":       bookingUser.Email,
+				"phone":       bookingUser.Phone,
+				"profilePic":  bookingUser.ProfilePic,
+				"userType":    bookingUser.UserType,
+				"reliability": reliability,
 			},
 		}
 
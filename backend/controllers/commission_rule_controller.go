@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CommissionRuleController lets admins manage the rules that set commission percentages on subscriptions
+type CommissionRuleController struct {
+	DB *mongo.Database
+}
+
+// NewCommissionRuleController creates a new commission rule controller
+func NewCommissionRuleController(db *mongo.Database) *CommissionRuleController {
+	return &CommissionRuleController{DB: db}
+}
+
+// commissionRuleErrorResponse maps commission service errors to HTTP responses
+func commissionRuleErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrCommissionRuleNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrCommissionRuleEnded):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrCommissionRuleDate):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Commission rule request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process commission rule request",
+		})
+	}
+}
+
+// bindCommissionRule parses and validates a commission rule create or update request
+func bindCommissionRule(c echo.Context) (*models.CommissionRuleRequest, error) {
+	var req models.CommissionRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	return &req, nil
+}
+
+// GetCommissionRules lists the current version of every rule; ended rules are included with ?all=true (admin only)
+func (cc *CommissionRuleController) GetCommissionRules(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rules, err := services.NewCommissionService(cc.DB).Rules(ctx, c.QueryParam("all") == "true")
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission rules retrieved successfully",
+		Data:    rules,
+	})
+}
+
+// CreateCommissionRule creates a commission rule (admin only)
+func (cc *CommissionRuleController) CreateCommissionRule(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := bindCommissionRule(c)
+	if req == nil {
+		return err
+	}
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	rule, err := services.NewCommissionService(cc.DB).CreateRule(ctx, *req, adminID)
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Commission rule created successfully",
+		Data:    rule,
+	})
+}
+
+// UpdateCommissionRule stores a new version of a rule; commissions already recorded keep the version that produced them (admin only)
+func (cc *CommissionRuleController) UpdateCommissionRule(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("ruleId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid commission rule ID",
+		})
+	}
+	req, err := bindCommissionRule(c)
+	if req == nil {
+		return err
+	}
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	rule, err := services.NewCommissionService(cc.DB).UpdateRule(ctx, ruleID, *req, adminID)
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission rule updated successfully",
+		Data:    rule,
+	})
+}
+
+// DeleteCommissionRule ends a rule so it no longer applies to new sales (admin only)
+func (cc *CommissionRuleController) DeleteCommissionRule(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("ruleId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid commission rule ID",
+		})
+	}
+	rule, err := services.NewCommissionService(cc.DB).EndRule(ctx, ruleID)
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission rule ended successfully",
+		Data:    rule,
+	})
+}
+
+// GetCommissionRuleVersions returns every version of a rule, newest first (admin only)
+func (cc *CommissionRuleController) GetCommissionRuleVersions(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("ruleId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid commission rule ID",
+		})
+	}
+	versions, err := services.NewCommissionService(cc.DB).Versions(ctx, ruleID)
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission rule versions retrieved successfully",
+		Data:    versions,
+	})
+}
+
+// PreviewCommission shows which rule applies to a sale and how it would be split, without recording anything (admin only)
+func (cc *CommissionRuleController) PreviewCommission(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.CommissionPreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	planID, err := primitive.ObjectIDFromHex(req.PlanID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid plan ID",
+		})
+	}
+	salespersonID, err := primitive.ObjectIDFromHex(req.SalespersonID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid salesperson ID",
+		})
+	}
+
+	var plan models.SubscriptionPlan
+	if err := cc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": planID}).Decode(&plan); err != nil {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Plan not found",
+		})
+	}
+
+	sale := services.CommissionSale{
+		CreatedBy: salespersonID,
+		Plan:      plan,
+		Amount:    plan.Price,
+		Category:  req.Category,
+		Region:    req.Region,
+		Renewal:   &req.Renewal,
+	}
+	if req.Amount > 0 {
+		sale.Amount = req.Amount
+	}
+	if req.At != nil {
+		sale.At = *req.At
+	}
+	split, err := services.NewCommissionService(cc.DB).Calculate(ctx, sale)
+	if err != nil {
+		return commissionRuleErrorResponse(c, err)
+	}
+	if split.SalespersonID.IsZero() {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Salesperson not found",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission preview calculated successfully",
+		Data:    split,
+	})
+}
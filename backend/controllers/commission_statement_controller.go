@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CommissionStatementController serves the monthly commission statements of salespersons and sales managers
+type CommissionStatementController struct {
+	DB *mongo.Database
+}
+
+// NewCommissionStatementController creates a new commission statement controller
+func NewCommissionStatementController(db *mongo.Database) *CommissionStatementController {
+	return &CommissionStatementController{DB: db}
+}
+
+// commissionStatementErrorResponse maps commission statement service errors to HTTP responses
+func commissionStatementErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrCommissionStatementNotFound), errors.Is(err, services.ErrPayoutPayeeNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidStatementPeriod):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Commission statement request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process commission statement request",
+		})
+	}
+}
+
+// statementOwner returns the authenticated salesperson or sales manager
+func statementOwner(c echo.Context) (string, primitive.ObjectID, error) {
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "salesperson" && claims.UserType != "sales_manager" {
+		return "", primitive.NilObjectID, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only salespersons and sales managers have commission statements",
+		})
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return "", primitive.NilObjectID, c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+	return claims.UserType, userID, nil
+}
+
+// listStatements responds with a page of the statements matching filter
+func (sc *CommissionStatementController) listStatements(ctx context.Context, c echo.Context, filter bson.M) error {
+	page, limit := invoicePage(c)
+	statements, total, err := services.NewCommissionStatementService(sc.DB).List(ctx, filter, page, limit)
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission statements retrieved successfully",
+		Data: map[string]interface{}{
+			"statements": statements,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// GetMyCommissionStatements lists the monthly statements of the authenticated salesperson or sales manager
+func (sc *CommissionStatementController) GetMyCommissionStatements(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, userID, err := statementOwner(c)
+	if role == "" {
+		return err
+	}
+	return sc.listStatements(ctx, c, bson.M{"userId": userID, "userType": role})
+}
+
+// GetMyCommissionStatement returns the current version of one monthly statement of the authenticated user
+func (sc *CommissionStatementController) GetMyCommissionStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, userID, err := statementOwner(c)
+	if role == "" {
+		return err
+	}
+	statement, err := services.NewCommissionStatementService(sc.DB).Latest(ctx, role, userID, c.Param("period"))
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission statement retrieved successfully",
+		Data:    statement,
+	})
+}
+
+// DownloadMyCommissionStatement returns one monthly statement of the authenticated user as a PDF
+func (sc *CommissionStatementController) DownloadMyCommissionStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, userID, err := statementOwner(c)
+	if role == "" {
+		return err
+	}
+	statementService := services.NewCommissionStatementService(sc.DB)
+	statement, err := statementService.Latest(ctx, role, userID, c.Param("period"))
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return sc.sendPDF(c, statementService, statement)
+}
+
+func (sc *CommissionStatementController) sendPDF(c echo.Context, statementService *services.CommissionStatementService, statement *models.CommissionStatement) error {
+	pdf := statementService.RenderPDF(statement)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=commission-statement-%s-v%d.pdf", statement.Period, statement.Version))
+	return c.Blob(http.StatusOK, "application/pdf", pdf)
+}
+
+// GetCommissionStatements lists statements, optionally by user, user type and period; every version is listed (admin only)
+func (sc *CommissionStatementController) GetCommissionStatements(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if id := c.QueryParam("userId"); id != "" {
+		userID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid user ID",
+			})
+		}
+		filter["userId"] = userID
+	}
+	if userType := c.QueryParam("userType"); userType != "" {
+		filter["userType"] = userType
+	}
+	if period := c.QueryParam("period"); period != "" {
+		filter["period"] = period
+	}
+	return sc.listStatements(ctx, c, filter)
+}
+
+// GetCommissionStatement returns one stored statement version (admin only)
+func (sc *CommissionStatementController) GetCommissionStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid statement ID",
+		})
+	}
+	statement, err := services.NewCommissionStatementService(sc.DB).Get(ctx, id)
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Commission statement retrieved successfully",
+		Data:    statement,
+	})
+}
+
+// DownloadCommissionStatement returns one stored statement version as a PDF (admin only)
+func (sc *CommissionStatementController) DownloadCommissionStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid statement ID",
+		})
+	}
+	statementService := services.NewCommissionStatementService(sc.DB)
+	statement, err := statementService.Get(ctx, id)
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return sc.sendPDF(c, statementService, statement)
+}
+
+// RegenerateCommissionStatement stores a new version of a monthly statement from the current ledger (admin only).
+// The previous versions are kept; the audit note says why the statement was regenerated.
+func (sc *CommissionStatementController) RegenerateCommissionStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var req models.CommissionStatementRegenerateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	userID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	statement, err := services.NewCommissionStatementService(sc.DB).Regenerate(ctx, req.UserType, userID, req.Period, adminID, req.AuditNote)
+	if err != nil {
+		return commissionStatementErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Commission statement regenerated successfully",
+		Data:    statement,
+	})
+}
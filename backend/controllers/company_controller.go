@@ -334,6 +334,18 @@ func (cc *CompanyController) CreateBranch(c echo.Context) error {
 		}
 	}
 
+	// Check the new branch and its media against the company's plan
+	entitlements, err := services.NewEntitlementService(cc.DB.Database("barrim")).ForCompany(ctx, &company)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementBranches, len(company.Branches)+1)
+	}
+	if err == nil {
+		err = services.RequireBranchMedia(entitlements, len(form.File["images"]), len(form.File["videos"]))
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Handle file uploads
 	files := form.File["images"]
 	var imagePaths []string
@@ -908,6 +920,15 @@ func (cc *CompanyController) UpdateBranch(c echo.Context) error {
 		})
 	}
 
+	// Check the replacement media against the company's plan
+	entitlements, err := services.NewEntitlementService(cc.DB.Database("barrim")).ForCompany(ctx, &company)
+	if err == nil {
+		err = services.RequireBranchMedia(entitlements, len(form.File["images"]), len(form.File["videos"]))
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Handle new image uploads
 	files := form.File["images"]
 	var newImagePaths []string
@@ -2982,6 +3003,11 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 		})
 	}
 
+	// Sponsorships are only available on plans with sponsored placement
+	if err := services.NewEntitlementService(cc.DB.Database("barrim")).RequireSponsoredPlacement(ctx, services.SubscriptionKindCompanyBranch, branchObjectID); err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if sponsorship exists and is valid
 	sponsorshipCollection := config.GetCollection(cc.DB, "sponsorships")
 	var sponsorship models.Sponsorship
@@ -3059,12 +3085,31 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 		PaymentMethod: paymentMethod,
 	}
 
+	// Sponsorships set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(cc.DB.Database("barrim")).Lock(ctx, sponsorship.Price, sponsorship.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	subscriptionRequest.Amount = conversion.AmountUSD
+	paymentAmount := conversion.AmountUSD
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate external ID for Whish payment (using timestamp-based unique ID)
-		externalID = time.Now().UnixNano() / int64(time.Millisecond)
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, cc.DB.Database("barrim"))
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -3083,11 +3128,11 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 			appURL = "barrim://payment"
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 			// Continue anyway - balance check failure doesn't block payment creation
@@ -3100,7 +3145,7 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &sponsorship.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for sponsorship payments
 			Invoice:            fmt.Sprintf("Company Branch Sponsorship - %s - %s - Sponsorship: %s", company.BusinessName, branch.Name, sponsorship.Title),
 			ExternalID:         &externalID,
@@ -3111,7 +3156,7 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
 			return c.JSON(http.StatusInternalServerError, models.Response{
@@ -3150,6 +3195,8 @@ func (cc *CompanyController) CreateCompanyBranchSponsorshipRequest(c echo.Contex
 		"submittedAt":   subscriptionRequest.RequestedAt,
 		"adminNote":     subscriptionRequest.AdminNote,
 		"price":         sponsorship.Price,
+		"currency":      conversion.OriginalCurrency,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
 
@@ -3202,6 +3249,7 @@ func (cc *CompanyController) HandleWhishSponsorshipPaymentSuccess(c echo.Context
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("Sponsorship subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, db, services.WhishPaymentKindSponsorship, externalID)
 			return c.String(http.StatusNotFound, "Sponsorship subscription request not found")
 		}
 		log.Printf("Error finding sponsorship subscription request: %v", err)
@@ -3214,83 +3262,25 @@ func (cc *CompanyController) HandleWhishSponsorshipPaymentSuccess(c echo.Context
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	if status != "success" {
-		log.Printf("❌ PAYMENT FAILED: Payment not successful, status: %s", status)
-		log.Printf("   Request ID: %s", subscriptionRequest.ID.Hex())
-		log.Printf("   Entity: %s (%s)", subscriptionRequest.EntityName, subscriptionRequest.EntityType)
-		// Update request status to failed
-		requestCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		log.Printf("==========================================")
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - activate subscription immediately
-	// Get sponsorship details
-	sponsorshipCollection := db.Collection("sponsorships")
-	var sponsorship models.Sponsorship
-	err = sponsorshipCollection.FindOne(ctx, bson.M{"_id": subscriptionRequest.SponsorshipID}).Decode(&sponsorship)
-	if err != nil {
-		log.Printf("Failed to get sponsorship details: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to get sponsorship details")
-	}
-
-	// Add sponsorship income to admin wallet using sponsorship subscription controller
+	// Re-confirm the payment with Whish and activate it exactly once
+	var phoneNumber string
+	var sponsorship *models.Sponsorship
 	sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(db)
-	err = sponsorshipSubscriptionController.addSponsorshipIncomeToAdminWallet(
-		ctx,
-		sponsorship.Price,
-		subscriptionRequest.SponsorshipID,
-		fmt.Sprintf("%s - %s", sponsorship.Title, subscriptionRequest.EntityName),
-	)
-	if err != nil {
-		log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-		// Don't fail the payment if wallet update fails, but log it
-	}
-
-	// Create active subscription immediately after payment
-	err = sponsorshipSubscriptionController.createActiveSubscription(ctx, subscriptionRequest)
-	if err != nil {
-		log.Printf("Failed to create active subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
-	}
-
-	// Update entity sponsorship status to active
-	err = sponsorshipSubscriptionController.updateEntitySponsorshipStatus(ctx, subscriptionRequest.EntityType, subscriptionRequest.EntityID, true)
-	if err != nil {
-		log.Printf("Failed to update entity sponsorship status: %v", err)
-		// Don't fail the process if status update fails, but log it
-	}
-
-	// Update request status - mark as approved/active after payment
-	update := bson.M{
-		"$set": bson.M{
-			"paymentStatus": "success",
-			"status":        "approved",
-			"adminApproved": true,
-			"approvedAt":    time.Now(),
-			"paidAt":        time.Now(),
-			"processedAt":   time.Now(),
-		},
-	}
-
-	_, err = requestCollection.UpdateOne(ctx, bson.M{"_id": subscriptionRequest.ID}, update)
+	err = services.NewWhishCallbackService(db).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:          services.WhishPaymentKindSponsorship,
+		ExternalID:    externalID,
+		RequestID:     subscriptionRequest.ID,
+		SponsorshipID: subscriptionRequest.SponsorshipID,
+		Amount:        subscriptionRequest.Amount,
+		RemoteAddr:    c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		phoneNumber = payerPhone
+		var err error
+		sponsorship, err = sponsorshipSubscriptionController.activatePaidSponsorship(ctx, subscriptionRequest, payerPhone)
+		return err
+	})
 	if err != nil {
-		log.Printf("Failed to update sponsorship subscription request status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to update request status")
+		return whishCallbackErrorResponse(ctx, c, err, requestCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("✅ PAYMENT SUCCESS: Company branch sponsorship payment completed and activated")
@@ -3441,15 +3431,15 @@ func (cc *CompanyController) GetCompanyBranchSponsorshipRemainingTime(c echo.Con
 		"entityId":      branchObjectID,
 		"paymentStatus": "pending",
 		"status":        bson.M{"$in": []string{"pending", "pending_payment"}},
-	}, options.FindOne().SetSort(bson.D{{"requestedAt", -1}})).Decode(&sponsorshipRequest)
+	}, options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}})).Decode(&sponsorshipRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && sponsorshipRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying sponsorship payment for request: %s (externalId: %d)", sponsorshipRequest.ID.Hex(), sponsorshipRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify sponsorship payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -3470,56 +3460,17 @@ func (cc *CompanyController) GetCompanyBranchSponsorshipRemainingTime(c echo.Con
 				}).Decode(&existingSubscription)
 
 				if err != nil {
-					// No active subscription exists, trigger the callback handler to activate it
-					// We'll manually call the activation logic
 					dbName := os.Getenv("DB_NAME")
 					if dbName == "" {
 						dbName = "barrim"
 					}
-					db := cc.DB.Database(dbName)
-					sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(db)
-
-					// Get sponsorship details
-					sponsorshipCollection := config.GetCollection(cc.DB, "sponsorships")
-					var sponsorship models.Sponsorship
-					err = sponsorshipCollection.FindOne(ctx, bson.M{"_id": sponsorshipRequest.SponsorshipID}).Decode(&sponsorship)
-					if err == nil {
-						// Add sponsorship income to admin wallet
-						err = sponsorshipSubscriptionController.addSponsorshipIncomeToAdminWallet(
-							ctx,
-							sponsorship.Price,
-							sponsorshipRequest.SponsorshipID,
-							fmt.Sprintf("%s - %s", sponsorship.Title, sponsorshipRequest.EntityName),
-						)
-						if err != nil {
-							log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-						}
-
-						// Create active subscription
-						err = sponsorshipSubscriptionController.createActiveSubscription(ctx, sponsorshipRequest)
-						if err != nil {
-							log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
-						} else {
-							log.Printf("✅ Sponsorship subscription auto-activated successfully")
-
-							// Update entity sponsorship status to active
-							err = sponsorshipSubscriptionController.updateEntitySponsorshipStatus(ctx, sponsorshipRequest.EntityType, sponsorshipRequest.EntityID, true)
-							if err != nil {
-								log.Printf("Failed to update entity sponsorship status: %v", err)
-							}
-
-							// Update request status
-							sponsorshipRequestCollection.UpdateOne(ctx,
-								bson.M{"_id": sponsorshipRequest.ID},
-								bson.M{"$set": bson.M{
-									"paymentStatus": "success",
-									"status":        "approved",
-									"adminApproved": true,
-									"approvedAt":    time.Now(),
-									"paidAt":        time.Now(),
-									"processedAt":   time.Now(),
-								}})
-						}
+					sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(cc.DB.Database(dbName))
+
+					// No active subscription exists, activate it exactly once
+					if _, err := sponsorshipSubscriptionController.activatePaidSponsorship(ctx, sponsorshipRequest, phoneNumber); err != nil {
+						log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
+					} else {
+						log.Printf("✅ Sponsorship subscription auto-activated successfully")
 					}
 				} else {
 					log.Printf("ℹ️  Sponsorship subscription already active, updating request status")
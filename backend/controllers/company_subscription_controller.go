@@ -3,6 +3,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -73,6 +74,8 @@ func (sc *SubscriptionController) GetCompanySubscriptionPlans(c echo.Context) er
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription plans retrieved successfully",
@@ -247,12 +250,50 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 		PaymentMethod: paymentMethod,
 	}
 
+	// Plans set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(sc.DB).Lock(ctx, plan.Price, plan.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	pricedPlan := plan
+	pricedPlan.Price = conversion.AmountUSD
+	pricedPlan.Currency = models.CurrencyUSD
+
+	// Apply the promo code, if any, to the amount collected
+	promoCodeService := services.NewPromoCodeService(sc.DB)
+	promo, err := promoCodeService.Apply(ctx, c.FormValue("promoCode"), pricedPlan,
+		services.PromoAccount{ID: company.ID, BroughtInBy: company.CreatedBy},
+		services.SubscriptionKindCompanyBranch, branch.ID, subscriptionRequest.ID)
+	if err != nil {
+		return promoCodeErrorResponse(c, err)
+	}
+	paymentAmount := pricedPlan.Price
+	if promo != nil {
+		paymentAmount = promo.Amount
+		subscriptionRequest.PromoCode = promo.Code
+		subscriptionRequest.Discount = promo.Discount
+		subscriptionRequest.Amount = promo.Amount
+	} else if conversion.OriginalCurrency != models.CurrencyUSD {
+		subscriptionRequest.Amount = paymentAmount
+	}
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate externalId from ObjectID (use timestamp part as int64)
-		externalID = int64(subscriptionRequest.ID.Timestamp().Unix())
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, sc.DB)
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -271,12 +312,12 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 			appURL = baseURL // Fallback to baseURL if APP_URL not set
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
 		// This validates that your Whish merchant account is operational
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 			// Continue anyway - balance check failure doesn't block payment creation
@@ -290,7 +331,7 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &plan.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for subscription payments
 			Invoice:            fmt.Sprintf("Branch Subscription - %s - Plan: %s", branch.Name, plan.Title),
 			ExternalID:         &externalID,
@@ -301,9 +342,10 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
+			promoCodeService.Release(ctx, subscriptionRequest.ID)
 			return c.JSON(http.StatusInternalServerError, models.Response{
 				Status:  http.StatusInternalServerError,
 				Message: fmt.Sprintf("Failed to initiate payment: %v", err),
@@ -325,6 +367,7 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 	_, err = subscriptionRequestsCollection.InsertOne(ctx, subscriptionRequest)
 	if err != nil {
 		log.Printf("Failed to save subscription request: %v", err)
+		promoCodeService.Release(ctx, subscriptionRequest.ID)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to create subscription request",
@@ -337,9 +380,12 @@ func (sc *BranchSubscriptionController) CreateBranchSubscriptionRequest(c echo.C
 		"plan":          plan,
 		"status":        subscriptionRequest.Status,
 		"submittedAt":   subscriptionRequest.RequestedAt,
-		"paymentAmount": plan.Price,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
+	if promo != nil {
+		responseData["promo"] = promo
+	}
 
 	if paymentMethod == "whish" {
 		responseData["collectUrl"] = collectURL
@@ -389,6 +435,7 @@ func (sc *BranchSubscriptionController) HandleWhishPaymentSuccess(c echo.Context
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("❌ PAYMENT CALLBACK FAILED: Subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, sc.DB, services.SubscriptionKindCompanyBranch, externalID)
 			return c.String(http.StatusNotFound, "Subscription request not found")
 		}
 		log.Printf("❌ PAYMENT CALLBACK FAILED: Error finding subscription request: %v", err)
@@ -403,37 +450,22 @@ func (sc *BranchSubscriptionController) HandleWhishPaymentSuccess(c echo.Context
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("❌ PAYMENT CALLBACK FAILED: Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	log.Printf("📊 Payment status from Whish API: %s (Phone: %s)", status, phoneNumber)
-
-	if status != "success" {
-		log.Printf("❌ PAYMENT FAILED: Payment not successful, status: %s", status)
-		log.Printf("   Request ID: %s", subscriptionRequest.ID.Hex())
-		// Update request status to failed
-		subscriptionRequestsCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		log.Printf("==========================================")
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - proceed to activate subscription
-	log.Printf("🔄 Activating branch subscription...")
-	err = sc.activateBranchSubscription(ctx, subscriptionRequest, phoneNumber)
+	// Re-confirm the payment with Whish and activate it exactly once
+	var phoneNumber string
+	err = services.NewWhishCallbackService(sc.DB).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:       services.SubscriptionKindCompanyBranch,
+		ExternalID: externalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+		RemoteAddr: c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		phoneNumber = payerPhone
+		log.Printf("🔄 Activating branch subscription...")
+		return sc.activateBranchSubscription(ctx, subscriptionRequest, payerPhone)
+	})
 	if err != nil {
-		log.Printf("❌ PAYMENT CALLBACK FAILED: Failed to activate subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
+		return whishCallbackErrorResponse(ctx, c, err, subscriptionRequestsCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("✅ PAYMENT SUCCESS: Branch subscription payment completed and activated")
@@ -475,12 +507,37 @@ func (sc *BranchSubscriptionController) HandleWhishPaymentFailure(c echo.Context
 		return c.String(http.StatusInternalServerError, "Failed to update status")
 	}
 
+	releasePromoCode(ctx, subscriptionRequestsCollection, externalID)
+
 	log.Printf("Payment failed for externalId: %d", externalID)
 	return c.String(http.StatusOK, "Payment failure recorded")
 }
 
-// activateBranchSubscription activates the subscription after successful payment
+// activateBranchSubscription activates the subscription after successful payment.
+// The Whish payment is applied at most once; a replay returns services.ErrPaymentAlreadyProcessed.
 func (sc *BranchSubscriptionController) activateBranchSubscription(ctx context.Context, subscriptionRequest models.BranchSubscriptionRequest, payerPhone string) error {
+	payment := services.WhishCallback{
+		Kind:       services.SubscriptionKindCompanyBranch,
+		ExternalID: subscriptionRequest.ExternalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+	}
+	return services.NewWhishCallbackService(sc.DB).ActivateOnce(ctx, payment, payerPhone, func(sessCtx mongo.SessionContext) error {
+		return sc.applyBranchSubscription(sessCtx, subscriptionRequest)
+	})
+}
+
+// applyBranchSubscription creates the subscription, activates the entity and books the payment
+func (sc *BranchSubscriptionController) applyBranchSubscription(ctx context.Context, subscriptionRequest models.BranchSubscriptionRequest) error {
+	// Plan changes replace the running subscription instead of starting a new one
+	if subscriptionRequest.PlanChangeOf != nil {
+		return services.NewSubscriptionService(sc.DB).ApplyPlanChange(ctx, services.SubscriptionKindCompanyBranch, subscriptionRequest.ID)
+	}
+
+	// Wallet, commission and invoice records use the exchange rate locked with the request
+	ctx = services.WithLockedRate(ctx, subscriptionRequest.CurrencyConversion)
+
 	// Get plan details
 	var plan models.SubscriptionPlan
 	err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscriptionRequest.PlanID}).Decode(&plan)
@@ -512,8 +569,8 @@ func (sc *BranchSubscriptionController) activateBranchSubscription(ctx context.C
 		return fmt.Errorf("branch not found")
 	}
 
-	// Calculate subscription dates
-	startDate := time.Now()
+	// Calculate subscription dates (renewals continue from the end of the renewed subscription)
+	startDate, autoRenew := services.NewSubscriptionService(sc.DB).RenewalPeriod(ctx, services.SubscriptionKindCompanyBranch, subscriptionRequest.RenewalOf)
 	var endDate time.Time
 	switch plan.Duration {
 	case 1: // Monthly
@@ -536,7 +593,7 @@ func (sc *BranchSubscriptionController) activateBranchSubscription(ctx context.C
 		StartDate:     startDate,
 		EndDate:       endDate,
 		Status:        "active",
-		AutoRenew:     false,
+		AutoRenew:     autoRenew,
 		PaymentMethod: subscriptionRequest.PaymentMethod, // Save payment method permanently
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
@@ -586,50 +643,10 @@ func (sc *BranchSubscriptionController) activateBranchSubscription(ctx context.C
 		log.Printf("Failed to update user status to active: %v", err)
 	}
 
-	// Handle commission and admin wallet (30% salesperson, 70% admin)
-	planPrice := plan.Price
-	if company.CreatedBy != company.UserID && !company.CreatedBy.IsZero() {
-		// Company was created by a salesperson - split commission
-		var salesperson models.Salesperson
-		err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": company.CreatedBy}).Decode(&salesperson)
-		if err == nil {
-			// Calculate commissions: 30% salesperson, 70% admin
-			salespersonPercent := 30.0
-			adminPercent := 70.0
-
-			salespersonCommission := planPrice * salespersonPercent / 100.0
-			adminCommission := planPrice * adminPercent / 100.0
-
-			// Add salesperson commission (using SubscriptionController method through type assertion/conversion)
-			// We need to access the method - let's create a helper or use direct implementation
-			err = sc.addCommissionToSalespersonWalletDirect(ctx, salesperson.ID, salespersonCommission, newSubscription.ID, "branch_subscription", company.BusinessName)
-			if err != nil {
-				log.Printf("Failed to add salesperson commission: %v", err)
-			} else {
-				log.Printf("Added salesperson commission: $%.2f (30%% of $%.2f)", salespersonCommission, planPrice)
-			}
-
-			// Add admin commission
-			err = sc.addSubscriptionIncomeToAdminWalletDirect(ctx, adminCommission, newSubscription.ID, "branch_subscription_commission", company.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add admin commission: %v", err)
-			} else {
-				log.Printf("Added admin commission: $%.2f (70%% of $%.2f)", adminCommission, planPrice)
-			}
-		} else {
-			log.Printf("Salesperson not found, adding full amount to admin wallet")
-			// Salesperson not found, add full amount to admin
-			err = sc.addSubscriptionIncomeToAdminWalletDirect(ctx, planPrice, newSubscription.ID, "branch_subscription", company.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add subscription income to admin wallet: %v", err)
-			}
-		}
-	} else {
-		// Company created by itself - full amount to admin
-		err = sc.addSubscriptionIncomeToAdminWalletDirect(ctx, planPrice, newSubscription.ID, "branch_subscription", company.BusinessName, branch.Name)
-		if err != nil {
-			log.Printf("Failed to add subscription income to admin wallet: %v", err)
-		}
+	// Share the payment between the salesperson who signed the company, their sales manager and the platform
+	planPrice := subscriptionRequest.AmountDue(plan.Price)
+	if _, err := services.NewCommissionService(sc.DB).Distribute(ctx, branchCommissionSale(company, branch, plan, newSubscription.ID, planPrice)); err != nil {
+		log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
 	}
 
 	// Update subscription request status
@@ -647,108 +664,43 @@ func (sc *BranchSubscriptionController) activateBranchSubscription(ctx context.C
 		log.Printf("Failed to update subscription request status: %v", err)
 	}
 
-	log.Printf("Branch subscription activated successfully: Branch=%s, Plan=%s, Amount=$%.2f", branch.Name, plan.Title, planPrice)
-	return nil
-}
-
-// Helper methods for wallet management (direct implementations for BranchSubscriptionController)
-func (sc *BranchSubscriptionController) addSubscriptionIncomeToAdminWalletDirect(ctx context.Context, amount float64, entityID primitive.ObjectID, entityType, companyName, branchName string) error {
-	adminWalletTransaction := models.AdminWallet{
-		ID:          primitive.NewObjectID(),
-		Type:        "subscription_income",
-		Amount:      amount,
-		Description: fmt.Sprintf("Subscription income from %s - %s (%s)", companyName, branchName, entityType),
-		EntityID:    entityID,
-		EntityType:  entityType,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if err := services.NewPromoCodeService(sc.DB).Redeem(ctx, subscriptionRequest.ID); err != nil {
+		log.Printf("Failed to redeem promo code of request %s: %v", subscriptionRequest.ID.Hex(), err)
 	}
 
-	_, err := sc.DB.Collection("admin_wallet").InsertOne(ctx, adminWalletTransaction)
-	if err != nil {
-		return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
-	}
-
-	balanceCollection := sc.DB.Collection("admin_wallet_balance")
-	var balance models.AdminWalletBalance
-	err = balanceCollection.FindOne(ctx, bson.M{}).Decode(&balance)
-
-	if err == mongo.ErrNoDocuments {
-		balance = models.AdminWalletBalance{
-			ID:                    primitive.NewObjectID(),
-			TotalIncome:           amount,
-			TotalWithdrawalIncome: 0,
-			TotalCommissionsPaid:  0,
-			NetBalance:            amount,
-			LastUpdated:           time.Now(),
-		}
-		_, err = balanceCollection.InsertOne(ctx, balance)
-		if err != nil {
-			return fmt.Errorf("failed to create admin wallet balance: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to find admin wallet balance: %w", err)
-	} else {
-		update := bson.M{
-			"$inc": bson.M{
-				"totalIncome": amount,
-				"netBalance":  amount,
-			},
-			"$set": bson.M{
-				"lastUpdated": time.Now(),
-			},
-		}
-		_, err = balanceCollection.UpdateOne(ctx, bson.M{"_id": balance.ID}, update)
-		if err != nil {
-			return fmt.Errorf("failed to update admin wallet balance: %w", err)
-		}
+	if _, err := services.NewInvoiceService(sc.DB).IssueForSubscription(ctx, services.SubscriptionKindCompanyBranch, newSubscription.ID, planPrice, subscriptionRequest.ExternalID); err != nil {
+		log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
 	}
 
+	log.Printf("Branch subscription activated successfully: Branch=%s, Plan=%s, Amount=$%.2f", branch.Name, plan.Title, planPrice)
 	return nil
 }
 
-func (sc *BranchSubscriptionController) addCommissionToSalespersonWalletDirect(ctx context.Context, salespersonID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, companyName string) error {
-	// Note: CommissionRecord model might need to be checked - using similar structure
-	type CommissionRecord struct {
-		ID             primitive.ObjectID `bson:"_id,omitempty"`
-		SubscriptionID primitive.ObjectID `bson:"subscriptionId"`
-		SalespersonID  primitive.ObjectID `bson:"salespersonId"`
-		Amount         float64            `bson:"amount"`
-		Role           string             `bson:"role"`
-		Status         string             `bson:"status"`
-		CreatedAt      time.Time          `bson:"createdAt"`
-	}
-
-	commissionRecord := CommissionRecord{
-		ID:             primitive.NewObjectID(),
+// branchCommissionSale describes a paid branch subscription for the commission service. The branch
+// category and governorate are used when set, and commissions go to the salesperson who created the company.
+func branchCommissionSale(company models.Company, branch models.Branch, plan models.SubscriptionPlan, subscriptionID primitive.ObjectID, amount float64) services.CommissionSale {
+	sale := services.CommissionSale{
+		Kind:           services.SubscriptionKindCompanyBranch,
 		SubscriptionID: subscriptionID,
-		SalespersonID:  salespersonID,
+		EntityID:       branch.ID,
+		BusinessID:     company.ID,
+		BusinessName:   company.BusinessName,
+		EntityName:     branch.Name,
+		Plan:           plan,
 		Amount:         amount,
-		Role:           "salesperson",
-		Status:         "pending",
-		CreatedAt:      time.Now(),
+		Category:       branch.Category,
+		Region:         branch.Location.Governorate,
 	}
-
-	_, err := sc.DB.Collection("commission_records").InsertOne(ctx, commissionRecord)
-	if err != nil {
-		return fmt.Errorf("failed to insert salesperson commission record: %w", err)
+	if sale.Category == "" {
+		sale.Category = company.Category
 	}
-
-	_, err = sc.DB.Collection("salespersons").UpdateOne(
-		ctx,
-		bson.M{"_id": salespersonID},
-		bson.M{
-			"$inc": bson.M{"commissionBalance": amount},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update salesperson commission balance: %w", err)
+	if sale.Region == "" {
+		sale.Region = company.ContactInfo.Address.Governorate
 	}
-
-	log.Printf("Commission $%.2f added to salesperson wallet (ID: %s) from %s - %s",
-		amount, salespersonID.Hex(), entityType, companyName)
-	return nil
+	if company.CreatedBy != company.UserID {
+		sale.CreatedBy = company.CreatedBy
+	}
+	return sale
 }
 
 func (sc *SubscriptionController) CancelCompanySubscription(c echo.Context) error {
@@ -782,42 +734,40 @@ func (sc *SubscriptionController) CancelCompanySubscription(c echo.Context) erro
 		})
 	}
 
-	// Get all branch IDs for this company
-	branchIDs := make([]primitive.ObjectID, len(company.Branches))
-	for i, branch := range company.Branches {
-		branchIDs[i] = branch.ID
-	}
-
-	if len(branchIDs) == 0 {
+	if len(company.Branches) == 0 {
 		return c.JSON(http.StatusNotFound, models.Response{
 			Status:  http.StatusNotFound,
 			Message: "No branches found for this company",
 		})
 	}
 
-	// Find and update active subscriptions for all branches
-	subscriptionsCollection := sc.DB.Collection("branch_subscriptions")
-	update := bson.M{
-		"$set": bson.M{
-			"status":    "cancelled",
-			"autoRenew": false,
-			"updatedAt": time.Now(),
-		},
-	}
+	// Cancel the subscription of every branch and refund the unused days
+	subscriptionService := services.NewSubscriptionService(sc.DB)
+	refunds := []*models.Refund{}
+	cancelled := 0
+	for _, branch := range company.Branches {
+		target, err := subscriptionService.ResolveTarget(ctx, services.SubscriptionKindCompanyBranch, userID, branch.ID)
+		if err != nil {
+			return subscriptionErrorResponse(c, err)
+		}
 
-	result, err := subscriptionsCollection.UpdateMany(ctx, bson.M{
-		"branchId": bson.M{"$in": branchIDs},
-		"status":   "active",
-	}, update)
+		_, refund, err := subscriptionService.Cancel(ctx, target, userID)
+		var transitionErr *models.SubscriptionTransitionError
+		if errors.Is(err, services.ErrSubscriptionNotFound) || errors.Is(err, services.ErrAlreadyRefunded) || errors.As(err, &transitionErr) ||
+			errors.Is(err, services.ErrSubscriptionConcurrentUpdate) {
+			continue
+		}
+		if err != nil {
+			return subscriptionErrorResponse(c, err)
+		}
 
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to cancel subscription",
-		})
+		cancelled++
+		if refund != nil {
+			refunds = append(refunds, refund)
+		}
 	}
 
-	if result.MatchedCount == 0 {
+	if cancelled == 0 {
 		return c.JSON(http.StatusNotFound, models.Response{
 			Status:  http.StatusNotFound,
 			Message: "No active subscription found",
@@ -827,6 +777,10 @@ func (sc *SubscriptionController) CancelCompanySubscription(c echo.Context) erro
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription cancelled successfully",
+		Data: map[string]interface{}{
+			"cancelled": cancelled,
+			"refunds":   refunds,
+		},
 	})
 }
 
@@ -867,7 +821,7 @@ func (sc *SubscriptionController) GetCompanySubscriptionRequestStatus(c echo.Con
 	var subscriptionRequest models.SubscriptionRequest
 	err = subscriptionRequestsCollection.FindOne(ctx,
 		bson.M{"companyId": company.ID},
-		options.FindOne().SetSort(bson.D{{"requestedAt", -1}}),
+		options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}}),
 	).Decode(&subscriptionRequest)
 
 	if err != nil {
@@ -985,67 +939,28 @@ func (sc *SubscriptionController) ApproveCompanySubscriptionRequest(c echo.Conte
 			}
 		}
 
-		// --- Commission logic start ---
-		// Only proceed if company was created by a salesperson
-		if !request.CompanyID.IsZero() {
-			// Get company details first
-			var company models.Company
-			err := sc.DB.Collection("companies").FindOne(ctx, bson.M{"_id": request.CompanyID}).Decode(&company)
-			if err == nil && !company.CreatedBy.IsZero() {
-				// Get salesperson
-				var salesperson models.Salesperson
-				err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": company.CreatedBy}).Decode(&salesperson)
-				if err == nil {
-					// Get admin who created the salesperson
-					var admin models.Admin
-					err := sc.DB.Collection("admins").FindOne(ctx, bson.M{"_id": salesperson.CreatedBy}).Decode(&admin)
-					if err == nil {
-						// Get plan details
-						var plan models.SubscriptionPlan
-						err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-						if err == nil {
-							planPrice := plan.Price
-							salespersonPercent := salesperson.CommissionPercent
-
-							// Calculate admin commission (remaining percentage after salesperson commission)
-							adminPercent := 100.0 - salespersonPercent
-
-							// Calculate commissions correctly
-							// Salesperson gets their percentage directly from the plan price
-							salespersonCommission := planPrice * salespersonPercent / 100.0
-							// Admin gets the remaining percentage
-							adminCommission := planPrice * adminPercent / 100.0
-
-							// Insert commission document using Commission model
-							commission := models.Commission{
-								ID:                           primitive.NewObjectID(),
-								SubscriptionID:               request.ID,
-								CompanyID:                    request.CompanyID,
-								PlanID:                       plan.ID,
-								PlanPrice:                    planPrice,
-								AdminID:                      admin.ID,
-								AdminCommission:              adminCommission,
-								AdminCommissionPercent:       adminPercent,
-								SalespersonID:                salesperson.ID,
-								SalespersonCommission:        salespersonCommission,
-								SalespersonCommissionPercent: salespersonPercent,
-								CreatedAt:                    time.Now(),
-								Paid:                         false,
-								PaidAt:                       nil,
-							}
-							_, err := sc.DB.Collection("commissions").InsertOne(ctx, commission)
-							if err != nil {
-								log.Printf("Failed to insert commission: %v", err)
-							} else {
-								log.Printf("Commission inserted successfully - Plan Price: $%.2f, Admin Commission: $%.2f (%.1f%%), Salesperson Commission: $%.2f (%.1f%%)",
-									planPrice, adminCommission, adminPercent, salespersonCommission, salespersonPercent)
-							}
-						}
-					}
-				}
+		// Record the commission of the salesperson who created the company
+		var company models.Company
+		var plan models.SubscriptionPlan
+		if err := sc.DB.Collection("companies").FindOne(ctx, bson.M{"_id": request.CompanyID}).Decode(&company); err != nil {
+			log.Printf("Failed to get company for commission: %v", err)
+		} else if err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+			log.Printf("Failed to get plan for commission: %v", err)
+		} else if company.CreatedBy != company.UserID {
+			_, err := services.NewCommissionService(sc.DB).Record(ctx, services.CommissionSale{
+				SubscriptionID: request.ID,
+				BusinessID:     company.ID,
+				BusinessName:   company.BusinessName,
+				CreatedBy:      company.CreatedBy,
+				Plan:           plan,
+				Amount:         request.AmountDue(plan.Price),
+				Category:       company.Category,
+				Region:         company.ContactInfo.Address.Governorate,
+			})
+			if err != nil {
+				log.Printf("Failed to record commission: %v", err)
 			}
 		}
-		// --- Commission logic end ---
 	}
 
 	return c.JSON(http.StatusOK, models.Response{
@@ -1282,28 +1197,8 @@ func (sc *SubscriptionController) GetTotalCommissionBalance(c echo.Context) erro
 		})
 	}
 
-	var match bson.M
-	var sumField string
-
 	switch claims.UserType {
-	case "salesperson":
-		// Try both field name formats to handle legacy data
-		match = bson.M{
-			"$or": []bson.M{
-				{"salespersonID": userID}, // New format (uppercase ID)
-				{"salespersonId": userID}, // Legacy format (lowercase i)
-			},
-		}
-		sumField = "$salespersonCommission"
-	case "sales_manager":
-		// Try both field name formats to handle legacy data
-		match = bson.M{
-			"$or": []bson.M{
-				{"salesManagerID": userID}, // New format (uppercase ID)
-				{"salesManagerId": userID}, // Legacy format (lowercase i)
-			},
-		}
-		sumField = "$salesManagerCommission"
+	case "salesperson", "sales_manager":
 	default:
 		return c.JSON(http.StatusForbidden, models.Response{
 			Status:  http.StatusForbidden,
@@ -1311,54 +1206,17 @@ func (sc *SubscriptionController) GetTotalCommissionBalance(c echo.Context) erro
 		})
 	}
 
-	// Get total commission earned
-	pipeline := []bson.M{
-		{"$match": match},
-		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": sumField}}},
-	}
-
-	cursor, err := sc.DB.Collection("commissions").Aggregate(ctx, pipeline)
+	// Commission earned and withdrawn come from the user's ledger account
+	account, err := services.NewWalletService(sc.DB).CommissionBalance(ctx, claims.UserType, userID)
 	if err != nil {
+		log.Printf("Failed to read commission ledger account: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
-			Message: "Failed to aggregate commissions",
+			Message: "Failed to read commission balance",
 		})
 	}
-	defer cursor.Close(ctx)
-
-	total := 0.0
-	if cursor.Next(ctx) {
-		var result struct {
-			Total float64 `bson:"total"`
-		}
-		if err := cursor.Decode(&result); err == nil {
-			total = result.Total
-		}
-	}
-
-	// Calculate total withdrawn (approved withdrawals only)
-	withdrawalMatch := bson.M{"userId": userID, "userType": claims.UserType, "status": "approved"}
-	withdrawalCursor, err := sc.DB.Collection("withdrawals").Aggregate(ctx, []bson.M{
-		{"$match": withdrawalMatch},
-		{"$group": bson.M{"_id": nil, "totalWithdrawn": bson.M{"$sum": "$amount"}}},
-	})
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to aggregate withdrawals",
-		})
-	}
-	defer withdrawalCursor.Close(ctx)
-
-	totalWithdrawn := 0.0
-	if withdrawalCursor.Next(ctx) {
-		var result struct {
-			TotalWithdrawn float64 `bson:"totalWithdrawn"`
-		}
-		if err := withdrawalCursor.Decode(&result); err == nil {
-			totalWithdrawn = result.TotalWithdrawn
-		}
-	}
+	total := account.CreditTotal
+	totalWithdrawn := account.DebitTotal
 
 	// Calculate total pending withdrawals (these are reserved and not available)
 	pendingMatch := bson.M{"userId": userID, "userType": claims.UserType, "status": "pending"}
@@ -1384,8 +1242,8 @@ func (sc *SubscriptionController) GetTotalCommissionBalance(c echo.Context) erro
 		}
 	}
 
-	// Available balance = Total earned - Total withdrawn - Total pending
-	availableBalance := total - totalWithdrawn - totalPending
+	// Available balance = Ledger balance - Total pending
+	availableBalance := account.Balance() - totalPending
 
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
@@ -1434,27 +1292,8 @@ func (sc *SubscriptionController) RequestCommissionWithdrawal(c echo.Context) er
 
 	// Check if user has sufficient available balance
 	// Get current available balance using the same logic as GetTotalCommissionBalance
-	var match bson.M
-	var sumField string
 	switch claims.UserType {
-	case "salesperson":
-		// Try both field name formats to handle legacy data
-		match = bson.M{
-			"$or": []bson.M{
-				{"salespersonID": userID}, // New format (uppercase ID)
-				{"salespersonId": userID}, // Legacy format (lowercase i)
-			},
-		}
-		sumField = "$salespersonCommission"
-	case "sales_manager":
-		// Try both field name formats to handle legacy data
-		match = bson.M{
-			"$or": []bson.M{
-				{"salesManagerID": userID}, // New format (uppercase ID)
-				{"salesManagerId": userID}, // Legacy format (lowercase i)
-			},
-		}
-		sumField = "$salesManagerCommission"
+	case "salesperson", "sales_manager":
 	default:
 		return c.JSON(http.StatusForbidden, models.Response{
 			Status:  http.StatusForbidden,
@@ -1462,53 +1301,14 @@ func (sc *SubscriptionController) RequestCommissionWithdrawal(c echo.Context) er
 		})
 	}
 
-	// Get total commission earned
-	pipeline := []bson.M{
-		{"$match": match},
-		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": sumField}}},
-	}
-	cursor, err := sc.DB.Collection("commissions").Aggregate(ctx, pipeline)
+	account, err := services.NewWalletService(sc.DB).CommissionBalance(ctx, claims.UserType, userID)
 	if err != nil {
+		log.Printf("Failed to read commission ledger account: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
-			Message: "Failed to aggregate commissions",
+			Message: "Failed to read commission balance",
 		})
 	}
-	defer cursor.Close(ctx)
-
-	total := 0.0
-	if cursor.Next(ctx) {
-		var result struct {
-			Total float64 `bson:"total"`
-		}
-		if err := cursor.Decode(&result); err == nil {
-			total = result.Total
-		}
-	}
-
-	// Calculate total withdrawn (approved withdrawals only)
-	withdrawalMatch := bson.M{"userId": userID, "userType": claims.UserType, "status": "approved"}
-	withdrawalCursor, err := sc.DB.Collection("withdrawals").Aggregate(ctx, []bson.M{
-		{"$match": withdrawalMatch},
-		{"$group": bson.M{"_id": nil, "totalWithdrawn": bson.M{"$sum": "$amount"}}},
-	})
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to aggregate withdrawals",
-		})
-	}
-	defer withdrawalCursor.Close(ctx)
-
-	totalWithdrawn := 0.0
-	if withdrawalCursor.Next(ctx) {
-		var result struct {
-			TotalWithdrawn float64 `bson:"totalWithdrawn"`
-		}
-		if err := withdrawalCursor.Decode(&result); err == nil {
-			totalWithdrawn = result.TotalWithdrawn
-		}
-	}
 
 	// Calculate total pending withdrawals (these are reserved and not available)
 	pendingMatch := bson.M{"userId": userID, "userType": claims.UserType, "status": "pending"}
@@ -1534,8 +1334,8 @@ func (sc *SubscriptionController) RequestCommissionWithdrawal(c echo.Context) er
 		}
 	}
 
-	// Available balance = Total earned - Total withdrawn - Total pending
-	availableBalance := total - totalWithdrawn - totalPending
+	// Available balance = Ledger balance - Total pending
+	availableBalance := account.Balance() - totalPending
 
 	// Check if requested amount exceeds available balance
 	if req.Amount > availableBalance {
@@ -2237,18 +2037,16 @@ func (sc *SubscriptionController) ApproveWithdrawalRequest(c echo.Context) error
 		})
 	}
 
-	// Update withdrawal request with approval
-	update := bson.M{
-		"$set": bson.M{
-			"status":      "approved",
-			"adminId":     adminObjectID,
-			"adminNote":   approvalReq.AdminNote,
-			"processedAt": time.Now(),
-		},
-	}
-
-	_, err = withdrawalsCollection.UpdateOne(ctx, bson.M{"_id": withdrawalObjectID}, update)
+	// Approve the withdrawal and post the payout to the ledger in one transaction
+	_, err = services.NewWalletService(sc.DB).ApproveWithdrawal(ctx, withdrawalObjectID, adminObjectID, approvalReq.AdminNote)
 	if err != nil {
+		if errors.Is(err, services.ErrWithdrawalNotPending) {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Withdrawal request is already processed",
+			})
+		}
+		log.Printf("Failed to approve withdrawal %s: %v", withdrawalObjectID.Hex(), err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to update withdrawal request",
@@ -2553,6 +2351,22 @@ func (sc *SubscriptionController) ProcessBranchSubscriptionRequest(c echo.Contex
 		})
 	}
 
+	// Plan changes keep the request for the audit trail and replace the running subscription
+	if branchSubscriptionRequest.PlanChangeOf != nil {
+		return processPlanChangeRequest(ctx, c, sc.DB, services.SubscriptionKindCompanyBranch, requestObjectID, approvalReq.Status)
+	}
+
+	// Count the promo code use of an approved request, or give it back on rejection
+	promoCodeService := services.NewPromoCodeService(sc.DB)
+	if approvalReq.Status == "approved" {
+		err = promoCodeService.Redeem(ctx, requestObjectID)
+	} else {
+		err = promoCodeService.Release(ctx, requestObjectID)
+	}
+	if err != nil {
+		log.Printf("Failed to update promo code of request %s: %v", requestObjectID.Hex(), err)
+	}
+
 	// Delete the branch subscription request from database after processing
 	_, err = branchSubscriptionRequestsCollection.DeleteOne(ctx, bson.M{"_id": requestObjectID})
 	if err != nil {
@@ -2699,171 +2513,17 @@ func (sc *SubscriptionController) ProcessBranchSubscriptionRequest(c echo.Contex
 
 		subscription = &newSubscription
 
-		// --- Commission logic start ---
-		// Check if company was created by a salesperson or by itself (user signup)
-		log.Printf("DEBUG: Company CreatedBy field: %v (IsZero: %v)", company.CreatedBy, company.CreatedBy.IsZero())
-
-		// Check if company was created by itself (user signup) - CreatedBy equals UserID
-		if company.CreatedBy == company.UserID {
-			log.Printf("DEBUG: Company was created by user signup, adding subscription price to admin wallet")
-			// Add subscription price directly to admin wallet (no commission calculation needed)
-			err := sc.addSubscriptionIncomeToAdminWallet(ctx, plan.Price, newSubscription.ID, "branch_subscription", company.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add subscription income to admin wallet: %v", err)
-			} else {
-				log.Printf("Subscription income added to admin wallet: $%.2f from company '%s' (ID: %s) - User signup subscription",
-					plan.Price, company.BusinessName, company.ID.Hex())
-			}
-		} else if !company.CreatedBy.IsZero() {
-			log.Printf("DEBUG: Company was created by salesperson, proceeding with commission calculation")
-			// Get salesperson
-			var salesperson models.Salesperson
-			err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": company.CreatedBy}).Decode(&salesperson)
-			if err == nil {
-				log.Printf("DEBUG: Found salesperson: %s (ID: %v)", salesperson.FullName, salesperson.ID)
-				planPrice := plan.Price
-				salespersonPercent := salesperson.CommissionPercent
-
-				// Check if salesperson was created by admin (admin-created salesperson)
-				var admin models.Admin
-				err := sc.DB.Collection("admins").FindOne(ctx, bson.M{"_id": salesperson.CreatedBy}).Decode(&admin)
-				if err == nil {
-					// Admin-created salesperson: Admin gets remaining percentage after salesperson commission
-					adminPercent := 100.0 - salespersonPercent
-
-					// Calculate commissions correctly
-					// Salesperson gets their percentage directly from the plan price
-					salespersonCommission := planPrice * salespersonPercent / 100.0
-					// Admin gets the remaining percentage
-					adminCommission := planPrice * adminPercent / 100.0
-
-					// Insert commission document using Commission model
-					commission := models.Commission{
-						ID:                           primitive.NewObjectID(),
-						SubscriptionID:               newSubscription.ID,
-						CompanyID:                    company.ID,
-						PlanID:                       plan.ID,
-						PlanPrice:                    planPrice,
-						AdminID:                      admin.ID,
-						AdminCommission:              adminCommission,
-						AdminCommissionPercent:       adminPercent,
-						SalespersonID:                salesperson.ID,
-						SalespersonCommission:        salespersonCommission,
-						SalespersonCommissionPercent: salespersonPercent,
-						CreatedAt:                    time.Now(),
-						Paid:                         false,
-						PaidAt:                       nil,
-					}
-					_, err := sc.DB.Collection("commissions").InsertOne(ctx, commission)
-					if err != nil {
-						log.Printf("Failed to insert commission: %v", err)
-					} else {
-						log.Printf("Commission inserted successfully for branch subscription (admin-created salesperson) - Plan Price: $%.2f, Admin Commission: $%.2f (%.1f%%), Salesperson Commission: $%.2f (%.1f%%)",
-							planPrice, adminCommission, adminPercent, salespersonCommission, salespersonPercent)
+		// Wallet, commission and invoice records use the exchange rate locked with the request
+		ctx = services.WithLockedRate(ctx, branchSubscriptionRequest.CurrencyConversion)
 
-						// Add salesperson commission to their wallet
-						err = sc.addCommissionToSalespersonWallet(ctx, salesperson.ID, salespersonCommission, newSubscription.ID, "branch_subscription", company.BusinessName)
-						if err != nil {
-							log.Printf("Failed to add commission to salesperson wallet: %v", err)
-						}
+		// Share the payment between the salesperson who signed the company, their sales manager and the platform
+		if _, err := services.NewCommissionService(sc.DB).Distribute(ctx, branchCommissionSale(company, branch, plan, newSubscription.ID, branchSubscriptionRequest.AmountDue(plan.Price))); err != nil {
+			log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
+		}
 
-						// Add admin commission to admin wallet
-						err = sc.addSubscriptionIncomeToAdminWallet(ctx, adminCommission, newSubscription.ID, "branch_subscription_admin_commission", company.BusinessName, branch.Name)
-						if err != nil {
-							log.Printf("Failed to add admin commission to admin wallet: %v", err)
-						}
-					}
-				} else {
-					// Salesperson was created by sales manager: Handle sales manager commission
-					var salesManager models.SalesManager
-					err := sc.DB.Collection("sales_managers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-					if err != nil {
-						// Try alternative collection name
-						err = sc.DB.Collection("salesManagers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-					}
-					if err == nil {
-						log.Printf("DEBUG: Found sales manager: %s (ID: %v)", salesManager.FullName, salesManager.ID)
-						salesManagerPercent := salesManager.CommissionPercent
-
-						log.Printf("DEBUG: Plan price: $%.2f, Salesperson commission percent: %.2f%%, Sales Manager commission percent: %.2f%%",
-							planPrice, salespersonPercent, salesManagerPercent)
-
-						// Calculate commissions correctly
-						// Salesperson gets their percentage directly from the plan price
-						salespersonCommission := planPrice * salespersonPercent / 100.0
-						// Sales manager gets their percentage directly from the plan price
-						salesManagerCommission := planPrice * salesManagerPercent / 100.0
-
-						log.Printf("DEBUG: Calculated commissions - Sales Manager: $%.2f, Salesperson: $%.2f",
-							salesManagerCommission, salespersonCommission)
-
-						// Insert commission document using Commission model
-						commission := models.Commission{
-							ID:                            primitive.NewObjectID(),
-							SubscriptionID:                newSubscription.ID,
-							CompanyID:                     company.ID,
-							PlanID:                        plan.ID,
-							PlanPrice:                     planPrice,
-							SalespersonID:                 salesperson.ID,
-							SalespersonCommission:         salespersonCommission,
-							SalespersonCommissionPercent:  salespersonPercent,
-							SalesManagerID:                salesManager.ID,
-							SalesManagerCommission:        salesManagerCommission,
-							SalesManagerCommissionPercent: salesManagerPercent,
-							CreatedAt:                     time.Now(),
-							Paid:                          false,
-							PaidAt:                        nil,
-						}
-						_, err := sc.DB.Collection("commissions").InsertOne(ctx, commission)
-						if err != nil {
-							log.Printf("Failed to insert commission: %v", err)
-						} else {
-							log.Printf("Commission inserted successfully for branch subscription (sales manager-created salesperson) - Plan Price: $%.2f, Sales Manager Commission: $%.2f, Salesperson Commission: $%.2f",
-								planPrice, salesManagerCommission, salespersonCommission)
-
-							// Add salesperson commission to their wallet
-							err = sc.addCommissionToSalespersonWallet(ctx, salesperson.ID, salespersonCommission, newSubscription.ID, "branch_subscription", company.BusinessName)
-							if err != nil {
-								log.Printf("Failed to add commission to salesperson wallet: %v", err)
-							}
-
-							// Add sales manager commission to their wallet
-							err = sc.addCommissionToSalesManagerWallet(ctx, salesManager.ID, salesManagerCommission, newSubscription.ID, "branch_subscription", company.BusinessName)
-							if err != nil {
-								log.Printf("Failed to add commission to sales manager wallet: %v", err)
-							}
-
-							// Calculate remaining amount for admin wallet
-							totalCommissions := salesManagerCommission + salespersonCommission
-							adminWalletAmount := planPrice - totalCommissions
-
-							// Add remaining amount to admin wallet
-							if adminWalletAmount > 0 {
-								err = sc.addSubscriptionIncomeToAdminWallet(ctx, adminWalletAmount, newSubscription.ID, "branch_subscription_remaining", company.BusinessName, branch.Name)
-								if err != nil {
-									log.Printf("Failed to add remaining subscription income to admin wallet: %v", err)
-								} else {
-									log.Printf("Remaining subscription income added to admin wallet: $%.2f (Plan: $%.2f - Commissions: $%.2f) from company '%s'",
-										adminWalletAmount, planPrice, totalCommissions, company.BusinessName)
-								}
-							}
-						}
-					} else {
-						log.Printf("DEBUG: Failed to find sales manager for ID: %v, Error: %v", salesperson.SalesManagerID, err)
-						// Fallback: Give all to admin if sales manager not found
-						err = sc.addSubscriptionIncomeToAdminWallet(ctx, planPrice, newSubscription.ID, "branch_subscription_fallback", company.BusinessName, branch.Name)
-						if err != nil {
-							log.Printf("Failed to add fallback amount to admin wallet: %v", err)
-						}
-					}
-				}
-			} else {
-				log.Printf("DEBUG: Failed to find salesperson for ID: %v, Error: %v", company.CreatedBy, err)
-			}
-		} else {
-			log.Printf("DEBUG: Company was not created by a salesperson (CreatedBy is zero or not set)")
+		if _, err := services.NewInvoiceService(sc.DB).IssueForSubscription(ctx, services.SubscriptionKindCompanyBranch, newSubscription.ID, branchSubscriptionRequest.AmountDue(plan.Price), 0); err != nil {
+			log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
 		}
-		// --- Commission logic end ---
 
 		// Send approval notification
 		emailSubject := "Branch Subscription Request Approved! 🎉"
@@ -3328,7 +2988,7 @@ func (sc *BranchSubscriptionController) GetBranchSubscriptionRequestStatus(c ech
 	var subscriptionRequest models.BranchSubscriptionRequest
 	err = subscriptionRequestsCollection.FindOne(ctx,
 		bson.M{"branchId": branchObjectID},
-		options.FindOne().SetSort(bson.D{{"requestedAt", -1}}),
+		options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}}),
 	).Decode(&subscriptionRequest)
 
 	if err != nil {
@@ -3351,9 +3011,9 @@ func (sc *BranchSubscriptionController) GetBranchSubscriptionRequestStatus(c ech
 	if subscriptionRequest.PaymentStatus == "pending" && subscriptionRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying payment for subscription request: %s (externalId: %d)", subscriptionRequest.ID.Hex(), subscriptionRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify payment status: %v", err)
 			// Continue to return the current status even if verification fails
@@ -3638,7 +3298,7 @@ func (sc *BranchSubscriptionController) VerifyAndActivateBranchSubscription(c ec
 	var subscriptionRequest models.BranchSubscriptionRequest
 	err = subscriptionRequestsCollection.FindOne(ctx,
 		bson.M{"branchId": branchObjectID},
-		options.FindOne().SetSort(bson.D{{"requestedAt", -1}}),
+		options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}}),
 	).Decode(&subscriptionRequest)
 
 	if err != nil {
@@ -3685,9 +3345,9 @@ func (sc *BranchSubscriptionController) VerifyAndActivateBranchSubscription(c ec
 
 	log.Printf("🔄 Verifying payment status for externalId: %d", subscriptionRequest.ExternalID)
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
+	// Initialize the payment gateway and verify payment status
+	paymentGateway := services.NewPaymentGateway()
+	status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
 	if err != nil {
 		log.Printf("Failed to verify payment status: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
@@ -3732,140 +3392,3 @@ func (sc *BranchSubscriptionController) VerifyAndActivateBranchSubscription(c ec
 		},
 	})
 }
-
-// addSubscriptionIncomeToAdminWallet adds subscription income to the admin wallet
-func (sc *SubscriptionController) addSubscriptionIncomeToAdminWallet(ctx context.Context, amount float64, entityID primitive.ObjectID, entityType, companyName, branchName string) error {
-	// Create admin wallet transaction
-	adminWalletTransaction := models.AdminWallet{
-		ID:          primitive.NewObjectID(),
-		Type:        "subscription_income",
-		Amount:      amount,
-		Description: fmt.Sprintf("Subscription income from %s - %s (%s)", companyName, branchName, entityType),
-		EntityID:    entityID,
-		EntityType:  entityType,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// Insert the transaction
-	_, err := sc.DB.Collection("admin_wallet").InsertOne(ctx, adminWalletTransaction)
-	if err != nil {
-		return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
-	}
-
-	// Update or create admin wallet balance
-	balanceCollection := sc.DB.Collection("admin_wallet_balance")
-
-	// Try to find existing balance record
-	var balance models.AdminWalletBalance
-	err = balanceCollection.FindOne(ctx, bson.M{}).Decode(&balance)
-
-	if err == mongo.ErrNoDocuments {
-		// Create new balance record
-		balance = models.AdminWalletBalance{
-			ID:                    primitive.NewObjectID(),
-			TotalIncome:           amount,
-			TotalWithdrawalIncome: 0,
-			TotalCommissionsPaid:  0,
-			NetBalance:            amount,
-			LastUpdated:           time.Now(),
-		}
-		_, err = balanceCollection.InsertOne(ctx, balance)
-		if err != nil {
-			return fmt.Errorf("failed to create admin wallet balance: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to find admin wallet balance: %w", err)
-	} else {
-		// Update existing balance record
-		update := bson.M{
-			"$inc": bson.M{
-				"totalIncome": amount,
-				"netBalance":  amount,
-			},
-			"$set": bson.M{
-				"lastUpdated": time.Now(),
-			},
-		}
-		_, err = balanceCollection.UpdateOne(ctx, bson.M{"_id": balance.ID}, update)
-		if err != nil {
-			return fmt.Errorf("failed to update admin wallet balance: %w", err)
-		}
-	}
-
-	return nil
-}
-
-// addCommissionToSalespersonWallet adds commission amount to salesperson's wallet
-func (sc *SubscriptionController) addCommissionToSalespersonWallet(ctx context.Context, salespersonID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, companyName string) error {
-	// Create commission record for salesperson wallet
-	commissionRecord := models.CommissionRecord{
-		ID:             primitive.NewObjectID(),
-		SubscriptionID: subscriptionID,
-		SalespersonID:  salespersonID,
-		Amount:         amount,
-		Role:           "salesperson",
-		Status:         "pending", // Will be marked as paid when processed
-		CreatedAt:      time.Now(),
-	}
-
-	// Insert the commission record
-	_, err := sc.DB.Collection("commission_records").InsertOne(ctx, commissionRecord)
-	if err != nil {
-		return fmt.Errorf("failed to insert salesperson commission record: %w", err)
-	}
-
-	// Update salesperson's commission balance
-	_, err = sc.DB.Collection("salespersons").UpdateOne(
-		ctx,
-		bson.M{"_id": salespersonID},
-		bson.M{
-			"$inc": bson.M{"commissionBalance": amount},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update salesperson commission balance: %w", err)
-	}
-
-	log.Printf("Commission $%.2f added to salesperson wallet (ID: %s) from %s - %s",
-		amount, salespersonID.Hex(), entityType, companyName)
-	return nil
-}
-
-// addCommissionToSalesManagerWallet adds commission amount to sales manager's wallet
-func (sc *SubscriptionController) addCommissionToSalesManagerWallet(ctx context.Context, salesManagerID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, companyName string) error {
-	// Create commission record for sales manager wallet
-	commissionRecord := models.CommissionRecord{
-		ID:             primitive.NewObjectID(),
-		SubscriptionID: subscriptionID,
-		SalesManagerID: salesManagerID,
-		Amount:         amount,
-		Role:           "sales_manager",
-		Status:         "pending", // Will be marked as paid when processed
-		CreatedAt:      time.Now(),
-	}
-
-	// Insert the commission record
-	_, err := sc.DB.Collection("commission_records").InsertOne(ctx, commissionRecord)
-	if err != nil {
-		return fmt.Errorf("failed to insert sales manager commission record: %w", err)
-	}
-
-	// Update sales manager's commission balance
-	_, err = sc.DB.Collection("sales_managers").UpdateOne(
-		ctx,
-		bson.M{"_id": salesManagerID},
-		bson.M{
-			"$inc": bson.M{"commissionBalance": amount},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update sales manager commission balance: %w", err)
-	}
-
-	log.Printf("Commission $%.2f added to sales manager wallet (ID: %s) from %s - %s",
-		amount, salesManagerID.Hex(), entityType, companyName)
-	return nil
-}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -183,6 +184,15 @@ func (cvc *CompanyVoucherController) PurchaseVoucherForCompany(c echo.Context) e
 		})
 	}
 
+	// Voucher purchases are only available on plans with voucher access
+	entitlements, err := services.NewEntitlementService(cvc.DB).ForCompany(ctx, &company)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementVoucherAccess, 1)
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if company has enough points
 	if company.Points < voucher.Points {
 		return c.JSON(http.StatusBadRequest, models.Response{
@@ -240,6 +250,10 @@ func (cvc *CompanyVoucherController) PurchaseVoucherForCompany(c echo.Context) e
 		})
 	}
 
+	if _, err := services.NewInvoiceService(cvc.DB).IssueForVoucher(ctx, "company", company.ID, company.BusinessName, voucher, purchase.ID); err != nil {
+		log.Printf("Failed to issue invoice for voucher purchase %s: %v", purchase.ID.Hex(), err)
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Voucher purchased and used successfully",
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExchangeRateController lets admins view and update the USD to LBP exchange rate
+type ExchangeRateController struct {
+	DB *mongo.Database
+}
+
+// NewExchangeRateController creates a new exchange rate controller
+func NewExchangeRateController(db *mongo.Database) *ExchangeRateController {
+	return &ExchangeRateController{DB: db}
+}
+
+// GetExchangeRate returns the exchange rate used to price and display amounts
+func (ec *ExchangeRateController) GetExchangeRate(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rate, err := services.NewExchangeRateService(ec.DB).Current(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Exchange rate retrieved successfully",
+		Data:    rate,
+	})
+}
+
+// SetExchangeRate sets the exchange rate manually (admin only)
+func (ec *ExchangeRateController) SetExchangeRate(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.ExchangeRateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	rate, err := services.NewExchangeRateService(ec.DB).SetRate(ctx, req.Rate, models.ExchangeRateSourceManual, adminID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExchangeRate) {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to update exchange rate",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Exchange rate updated successfully",
+		Data:    rate,
+	})
+}
+
+// RefreshExchangeRate fetches the current rate from the payment gateway and stores it (admin only)
+func (ec *ExchangeRateController) RefreshExchangeRate(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	rate, err := services.NewExchangeRateService(ec.DB).RefreshFromGateway(ctx, adminID)
+	if err != nil {
+		log.Printf("Failed to refresh exchange rate: %v", err)
+		return c.JSON(http.StatusBadGateway, models.Response{
+			Status:  http.StatusBadGateway,
+			Message: "Failed to get the exchange rate from the payment gateway",
+		})
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Exchange rate refreshed successfully",
+		Data:    rate,
+	})
+}
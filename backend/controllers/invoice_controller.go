@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InvoiceController serves the invoices issued for subscription, sponsorship and voucher payments
+type InvoiceController struct {
+	DB *mongo.Database
+}
+
+// NewInvoiceController creates a new invoice controller
+func NewInvoiceController(db *mongo.Database) *InvoiceController {
+	return &InvoiceController{DB: db}
+}
+
+// invoiceErrorResponse maps invoice service errors to HTTP responses
+func invoiceErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotFound), errors.Is(err, services.ErrInvoiceAccountNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	default:
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process invoice request",
+		})
+	}
+}
+
+// invoiceFilter builds the invoice filter from the kind, from and to query parameters (dates as YYYY-MM-DD, to inclusive)
+func invoiceFilter(c echo.Context, filter bson.M) (bson.M, error) {
+	if kind := c.QueryParam("kind"); kind != "" {
+		filter["kind"] = kind
+	}
+	issuedAt := bson.M{}
+	if from := c.QueryParam("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		issuedAt["$gte"] = t
+	}
+	if to := c.QueryParam("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		issuedAt["$lt"] = t.AddDate(0, 0, 1)
+	}
+	if len(issuedAt) > 0 {
+		filter["issuedAt"] = issuedAt
+	}
+	return filter, nil
+}
+
+// invoicePage reads the page and limit query parameters
+func invoicePage(c echo.Context) (int64, int64) {
+	page, _ := strconv.ParseInt(c.QueryParam("page"), 10, 64)
+	limit, _ := strconv.ParseInt(c.QueryParam("limit"), 10, 64)
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// listInvoices responds with a page of the invoices matching filter
+func (ic *InvoiceController) listInvoices(ctx context.Context, c echo.Context, filter bson.M) error {
+	filter, err := invoiceFilter(c, filter)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+
+	page, limit := invoicePage(c)
+	invoices, total, err := services.NewInvoiceService(ic.DB).List(ctx, filter, page, limit)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Invoices retrieved successfully",
+		Data: map[string]interface{}{
+			"invoices": invoices,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// sendInvoicePDF responds with the PDF receipt of an invoice
+func (ic *InvoiceController) sendInvoicePDF(c echo.Context, invoice *models.Invoice) error {
+	pdf := services.NewInvoiceService(ic.DB).RenderPDF(invoice)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", invoice.Number))
+	return c.Blob(http.StatusOK, "application/pdf", pdf)
+}
+
+// accountInvoice loads an invoice and checks that it belongs to the business of the logged in user
+func (ic *InvoiceController) accountInvoice(ctx context.Context, c echo.Context) (*models.Invoice, error) {
+	invoiceService := services.NewInvoiceService(ic.DB)
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, services.ErrInvoiceAccountNotFound
+	}
+	_, accountID, err := invoiceService.AccountForUser(ctx, claims.UserType, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return nil, services.ErrInvoiceNotFound
+	}
+	invoice, err := invoiceService.Get(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.AccountID != accountID {
+		return nil, services.ErrInvoiceNotFound
+	}
+	return invoice, nil
+}
+
+// GetMyInvoices lists the invoices of the logged in company, wholesaler or service provider
+func (ic *InvoiceController) GetMyInvoices(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	_, accountID, err := services.NewInvoiceService(ic.DB).AccountForUser(ctx, claims.UserType, userID)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return ic.listInvoices(ctx, c, bson.M{"accountId": accountID})
+}
+
+// GetMyInvoice returns one invoice of the logged in business
+func (ic *InvoiceController) GetMyInvoice(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoice, err := ic.accountInvoice(ctx, c)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Invoice retrieved successfully",
+		Data:    invoice,
+	})
+}
+
+// DownloadMyInvoice returns the PDF receipt of an invoice of the logged in business
+func (ic *InvoiceController) DownloadMyInvoice(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoice, err := ic.accountInvoice(ctx, c)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+	return ic.sendInvoicePDF(c, invoice)
+}
+
+// GetInvoices lists all invoices, optionally for one account (admin only)
+func (ic *InvoiceController) GetInvoices(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if accountID := c.QueryParam("accountId"); accountID != "" {
+		id, err := primitive.ObjectIDFromHex(accountID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid account ID",
+			})
+		}
+		filter["accountId"] = id
+	}
+	return ic.listInvoices(ctx, c, filter)
+}
+
+// DownloadInvoice returns the PDF receipt of any invoice (admin only)
+func (ic *InvoiceController) DownloadInvoice(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid invoice ID",
+		})
+	}
+	invoice, err := services.NewInvoiceService(ic.DB).Get(ctx, invoiceID)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+	return ic.sendInvoicePDF(c, invoice)
+}
+
+// ExportInvoices returns the invoices issued between from and to as a CSV file for accounting (admin only)
+func (ic *InvoiceController) ExportInvoices(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	filter, err := invoiceFilter(c, bson.M{})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+
+	data, err := services.NewInvoiceService(ic.DB).ExportCSV(ctx, filter)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	filename := "invoices"
+	if from := c.QueryParam("from"); from != "" {
+		filename += "-" + from
+	}
+	if to := c.QueryParam("to"); to != "" {
+		filename += "-" + to
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	return c.Blob(http.StatusOK, "text/csv", data)
+}
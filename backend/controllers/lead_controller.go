@@ -0,0 +1,413 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/HSouheill/barrim_backend/utils"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LeadController handles the lead pipeline of salespersons
+type LeadController struct {
+	DB *mongo.Database
+}
+
+// NewLeadController creates a new lead controller
+func NewLeadController(db *mongo.Database) *LeadController {
+	return &LeadController{DB: db}
+}
+
+// leadErrorResponse maps lead service errors to HTTP responses
+func leadErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrLeadNotFound), errors.Is(err, services.ErrSalespersonNotInTeam):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrOutsideTerritory):
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrLeadConverted), errors.Is(err, services.ErrLeadSignedUp), errors.Is(err, services.ErrLeadNotWon), errors.Is(err, services.ErrLeadSameStage), errors.Is(err, services.ErrLeadClosed):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrLeadLostReason), errors.Is(err, services.ErrLeadEntityType), errors.Is(err, services.ErrLeadConversionDetails), errors.Is(err, services.ErrLeadFollowUpInPast):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Lead request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process lead request",
+		})
+	}
+}
+
+// leadScope returns the lead scope of the authenticated salesperson, sales manager or admin
+func leadScope(c echo.Context) (services.LeadScope, error) {
+	claims := middleware.GetUserFromToken(c)
+	switch claims.UserType {
+	case "salesperson", "sales_manager", "admin":
+	default:
+		return services.LeadScope{}, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only salespersons, sales managers and admins can access leads",
+		})
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return services.LeadScope{}, c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+	return services.LeadScope{UserID: userID, UserType: claims.UserType}, nil
+}
+
+// salespersonLeadScope returns the lead scope of the authenticated salesperson
+func salespersonLeadScope(c echo.Context) (services.LeadScope, error) {
+	scope, err := leadScope(c)
+	if scope.UserID.IsZero() {
+		return scope, err
+	}
+	if scope.UserType != "salesperson" {
+		return services.LeadScope{}, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only salespersons can work leads",
+		})
+	}
+	return scope, nil
+}
+
+// managerLeadScope returns the lead scope of the authenticated sales manager or admin
+func managerLeadScope(c echo.Context) (services.LeadScope, error) {
+	scope, err := leadScope(c)
+	if scope.UserID.IsZero() {
+		return scope, err
+	}
+	if scope.UserType != "sales_manager" && scope.UserType != "admin" {
+		return services.LeadScope{}, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only sales managers and admins can reassign leads",
+		})
+	}
+	return scope, nil
+}
+
+// leadID parses the :id path parameter
+func leadID(c echo.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid lead ID",
+		})
+	}
+	return id, nil
+}
+
+// bindLead binds and validates a request body; it reports false once the error response was sent
+func bindLead(c echo.Context, req interface{}) (bool, error) {
+	if err := c.Bind(req); err != nil {
+		return false, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(req); err != nil {
+		return false, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	return true, nil
+}
+
+// leadResponse responds with a lead or maps the error
+func leadResponse(c echo.Context, lead *models.Lead, err error, message string) error {
+	if err != nil {
+		return leadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+		Data:    lead,
+	})
+}
+
+// CreateLead stores a new prospect for the authenticated salesperson
+func (lc *LeadController) CreateLead(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	var req models.LeadRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).Create(ctx, scope.UserID, req)
+	if err != nil {
+		return leadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Lead created successfully",
+		Data:    lead,
+	})
+}
+
+// GetLeads lists the leads visible to the authenticated user: their own for salespersons, their team's for
+// sales managers and every lead for admins. Filters: stage, salespersonId, entityType.
+func (lc *LeadController) GetLeads(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := leadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	filter := bson.M{}
+	if stage := c.QueryParam("stage"); stage != "" {
+		filter["stage"] = stage
+	}
+	if entityType := c.QueryParam("entityType"); entityType != "" {
+		filter["entityType"] = entityType
+	}
+	if id := c.QueryParam("salespersonId"); id != "" {
+		salespersonID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid salesperson ID",
+			})
+		}
+		filter["salespersonId"] = salespersonID
+	}
+
+	page, limit := invoicePage(c)
+	leads, total, stages, err := services.NewLeadService(lc.DB).List(ctx, scope, filter, page, limit)
+	if err != nil {
+		return leadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Leads retrieved successfully",
+		Data: map[string]interface{}{
+			"leads":  leads,
+			"stages": stages,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// GetLeadFollowUps lists the open leads of the authenticated salesperson with a follow-up due today or earlier
+func (lc *LeadController) GetLeadFollowUps(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	now := time.Now()
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	leads, err := services.NewLeadService(lc.DB).DueFollowUps(ctx, scope.UserID, endOfDay)
+	if err != nil {
+		return leadErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Lead follow-ups retrieved successfully",
+		Data:    leads,
+	})
+}
+
+// GetLead returns one lead with its stage history and visits
+func (lc *LeadController) GetLead(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := leadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).Get(ctx, scope, id)
+	return leadResponse(c, lead, err, "Lead retrieved successfully")
+}
+
+// UpdateLead changes the contact details, location and notes of a lead
+func (lc *LeadController) UpdateLead(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).Update(ctx, scope, id, req)
+	return leadResponse(c, lead, err, "Lead updated successfully")
+}
+
+// MoveLeadStage moves a lead through the pipeline
+func (lc *LeadController) MoveLeadStage(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadStageRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).MoveStage(ctx, scope, id, req)
+	return leadResponse(c, lead, err, "Lead stage updated successfully")
+}
+
+// ScheduleLeadFollowUp sets the next follow-up of a lead
+func (lc *LeadController) ScheduleLeadFollowUp(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadFollowUpRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).ScheduleFollowUp(ctx, scope, id, req)
+	return leadResponse(c, lead, err, "Lead follow-up scheduled successfully")
+}
+
+// LogLeadVisit records a visit to a prospect
+func (lc *LeadController) LogLeadVisit(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadVisitRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, err := services.NewLeadService(lc.DB).LogVisit(ctx, scope, id, req)
+	return leadResponse(c, lead, err, "Lead visit logged successfully")
+}
+
+// ConvertLead turns a won lead into a pending company, wholesaler or service provider request for the
+// sales manager to approve
+func (lc *LeadController) ConvertLead(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := salespersonLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadConvertRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	lead, request, err := services.NewLeadService(lc.DB).Convert(ctx, scope, id, req)
+	if err != nil {
+		return leadErrorResponse(c, err)
+	}
+
+	// Notify sales manager (log error but do not fail request)
+	entityNames := map[string]string{"company": "Company", "wholesaler": "Wholesaler", "serviceProvider": "Service Provider"}
+	if notifyErr := utils.NotifySalesManagerOfRequest(lc.DB.Client(), scope.UserID, entityNames[lead.Conversion.EntityType], lead.BusinessName); notifyErr != nil {
+		log.Printf("Failed to notify sales manager: %v", notifyErr)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Lead converted and submitted for approval",
+		Data: map[string]interface{}{
+			"lead":    lead,
+			"request": request,
+		},
+	})
+}
+
+// ReassignLead hands a lead to another salesperson of the sales manager's team (any salesperson for admins)
+func (lc *LeadController) ReassignLead(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scope, err := managerLeadScope(c)
+	if scope.UserID.IsZero() {
+		return err
+	}
+	id, err := leadID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.LeadReassignRequest
+	if ok, err := bindLead(c, &req); !ok {
+		return err
+	}
+	salespersonID, err := primitive.ObjectIDFromHex(req.SalespersonID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid salesperson ID",
+		})
+	}
+	lead, err := services.NewLeadService(lc.DB).Reassign(ctx, scope, id, req, salespersonID)
+	return leadResponse(c, lead, err, "Lead reassigned successfully")
+}
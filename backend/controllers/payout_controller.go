@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PayoutController lets finance admins gather, review and confirm batch payouts of commission balances
+type PayoutController struct {
+	DB *mongo.Database
+}
+
+// NewPayoutController creates a new payout controller
+func NewPayoutController(db *mongo.Database) *PayoutController {
+	return &PayoutController{DB: db}
+}
+
+// payoutErrorResponse maps payout service errors to HTTP responses
+func payoutErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrPayoutRunNotFound), errors.Is(err, services.ErrPayoutItemNotFound), errors.Is(err, services.ErrPayoutPayeeNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrPayoutRunNotDraft), errors.Is(err, services.ErrPayoutRunOpen), errors.Is(err, services.ErrPayoutRunStale):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrPayoutRunEmpty), errors.Is(err, services.ErrInvalidPayoutAmount):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Payout request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process payout request",
+		})
+	}
+}
+
+// payoutParams reads the run ID and, when present, the payee ID from the URL
+func payoutParams(c echo.Context) (primitive.ObjectID, primitive.ObjectID, error) {
+	runID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("invalid payout run ID")
+	}
+	if c.Param("userId") == "" {
+		return runID, primitive.NilObjectID, nil
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("invalid user ID")
+	}
+	return runID, userID, nil
+}
+
+// GetPayoutRuns lists payout runs, optionally by status (admin only)
+func (pc *PayoutController) GetPayoutRuns(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := c.QueryParam("status"); status != "" {
+		filter["status"] = status
+	}
+	page, limit := invoicePage(c)
+	runs, total, err := services.NewPayoutService(pc.DB).List(ctx, filter, page, limit)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout runs retrieved successfully",
+		Data: map[string]interface{}{
+			"runs": runs,
+			"pagination": map[string]interface{}{
+				"page":  page,
+				"limit": limit,
+				"total": total,
+			},
+		},
+	})
+}
+
+// CreatePayoutRun gathers the balances owed now into a draft run for review (admin only)
+func (pc *PayoutController) CreatePayoutRun(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var req models.PayoutRunRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	minAmount := services.PayoutMinAmount()
+	if req.MinAmount != nil {
+		minAmount = *req.MinAmount
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	run, err := services.NewPayoutService(pc.DB).CreateRun(ctx, models.PayoutTriggerManual, &adminID, minAmount, req.Note)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Payout run gathered and waiting for confirmation",
+		Data:    run,
+	})
+}
+
+// GetPayoutRun returns a payout run with every payee (admin only)
+func (pc *PayoutController) GetPayoutRun(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, _, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	run, err := services.NewPayoutService(pc.DB).Get(ctx, runID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout run retrieved successfully",
+		Data:    run,
+	})
+}
+
+// ConfirmPayoutRun pays every included payee of a draft run at once (admin only)
+func (pc *PayoutController) ConfirmPayoutRun(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	runID, _, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	run, err := services.NewPayoutService(pc.DB).Confirm(ctx, runID, adminID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	log.Printf("Payout run %s confirmed by admin %s: %d payees, $%.2f", run.Number, adminID.Hex(), run.PayeeCount, run.TotalAmount)
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout run confirmed successfully",
+		Data:    run,
+	})
+}
+
+// CancelPayoutRun closes a draft run without paying it (admin only)
+func (pc *PayoutController) CancelPayoutRun(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, _, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	run, err := services.NewPayoutService(pc.DB).Cancel(ctx, runID, adminID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout run cancelled successfully",
+		Data:    run,
+	})
+}
+
+// HoldPayoutItem leaves one payee out of a draft run (admin only)
+func (pc *PayoutController) HoldPayoutItem(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, userID, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	var req models.PayoutHoldRequest
+	if err := c.Bind(&req); err != nil || req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "A reason is required to hold a payee",
+		})
+	}
+
+	run, err := services.NewPayoutService(pc.DB).SetItemHold(ctx, runID, userID, req.Reason)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payee held in this payout run",
+		Data:    run,
+	})
+}
+
+// ReleasePayoutItem puts a held payee back into a draft run (admin only)
+func (pc *PayoutController) ReleasePayoutItem(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, userID, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+
+	run, err := services.NewPayoutService(pc.DB).SetItemHold(ctx, runID, userID, "")
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payee released in this payout run",
+		Data:    run,
+	})
+}
+
+// ExportPayoutRun returns the payout sheet of a run as a CSV file (admin only)
+func (pc *PayoutController) ExportPayoutRun(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	runID, _, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	payoutService := services.NewPayoutService(pc.DB)
+	run, err := payoutService.Get(ctx, runID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	data, err := payoutService.ExportCSV(run)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", run.Number))
+	return c.Blob(http.StatusOK, "text/csv", data)
+}
+
+// GetPayoutStatement returns what one payee is paid in a run, entry by entry (admin only)
+func (pc *PayoutController) GetPayoutStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, userID, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	statement, err := services.NewPayoutService(pc.DB).Statement(ctx, runID, userID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout statement retrieved successfully",
+		Data:    statement,
+	})
+}
+
+// DownloadPayoutStatement returns the PDF statement of one payee of a run (admin only)
+func (pc *PayoutController) DownloadPayoutStatement(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runID, userID, err := payoutParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+	payoutService := services.NewPayoutService(pc.DB)
+	statement, err := payoutService.Statement(ctx, runID, userID)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	pdf := payoutService.RenderStatementPDF(statement)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.pdf", statement.RunNumber, userID.Hex()))
+	return c.Blob(http.StatusOK, "application/pdf", pdf)
+}
+
+// GetPayoutHolds lists the salespersons and sales managers kept out of payout runs (admin only)
+func (pc *PayoutController) GetPayoutHolds(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holds, err := services.NewPayoutService(pc.DB).Holds(ctx)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout holds retrieved successfully",
+		Data:    holds,
+	})
+}
+
+// CreatePayoutHold keeps a salesperson or sales manager out of payout runs until released (admin only)
+func (pc *PayoutController) CreatePayoutHold(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.PayoutHoldRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	userID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	if req.UserType != "salesperson" && req.UserType != "sales_manager" {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user type. Must be one of: salesperson, sales_manager",
+		})
+	}
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "A reason is required to hold a payee",
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	hold, err := services.NewPayoutService(pc.DB).Hold(ctx, req.UserType, userID, adminID, req.Reason)
+	if err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payouts held successfully",
+		Data:    hold,
+	})
+}
+
+// DeletePayoutHold lets a payee be paid by the next payout runs again (admin only)
+func (pc *PayoutController) DeletePayoutHold(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+	if err := services.NewPayoutService(pc.DB).ReleaseHold(ctx, userID); err != nil {
+		return payoutErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Payout hold released successfully",
+	})
+}
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromoCodeController manages the promo codes admins offer on subscription plans
+type PromoCodeController struct {
+	DB *mongo.Database
+}
+
+// NewPromoCodeController creates a new promo code controller
+func NewPromoCodeController(db *mongo.Database) *PromoCodeController {
+	return &PromoCodeController{DB: db}
+}
+
+// bindPromoCode parses and validates a promo code create or update request
+func (pc *PromoCodeController) bindPromoCode(c echo.Context) (*models.PromoCodeRequest, []primitive.ObjectID, error) {
+	var req models.PromoCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return nil, nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+
+	salespersonIDs := make([]primitive.ObjectID, 0, len(req.SalespersonIDs))
+	for _, id := range req.SalespersonIDs {
+		salespersonID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, nil, c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid salesperson ID: " + id,
+			})
+		}
+		salespersonIDs = append(salespersonIDs, salespersonID)
+	}
+	return &req, salespersonIDs, nil
+}
+
+// CreatePromoCode creates a promo code (admin only)
+func (pc *PromoCodeController) CreatePromoCode(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, salespersonIDs, err := pc.bindPromoCode(c)
+	if req == nil {
+		return err
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	now := time.Now()
+	promo := models.PromoCode{
+		ID:                primitive.NewObjectID(),
+		Code:              services.NormalizePromoCode(req.Code),
+		Description:       req.Description,
+		DiscountType:      req.DiscountType,
+		DiscountValue:     req.DiscountValue,
+		ValidFrom:         req.ValidFrom,
+		ValidUntil:        req.ValidUntil,
+		MaxUses:           req.MaxUses,
+		MaxUsesPerAccount: req.MaxUsesPerAccount,
+		PlanTypes:         req.PlanTypes,
+		SalespersonIDs:    salespersonIDs,
+		IsActive:          isActive,
+		CreatedBy:         adminID,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	if _, err := pc.DB.Collection("promo_codes").InsertOne(ctx, promo); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.JSON(http.StatusConflict, models.Response{
+				Status:  http.StatusConflict,
+				Message: "A promo code with this code already exists",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to create promo code",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Promo code created successfully",
+		Data:    promo,
+	})
+}
+
+// GetPromoCodes lists promo codes, optionally only the active ones (admin only)
+func (pc *PromoCodeController) GetPromoCodes(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if c.QueryParam("active") == "true" {
+		now := time.Now()
+		filter = bson.M{"isActive": true, "validFrom": bson.M{"$lte": now}, "validUntil": bson.M{"$gt": now}}
+	}
+
+	cursor, err := pc.DB.Collection("promo_codes").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch promo codes",
+		})
+	}
+	promos := []models.PromoCode{}
+	if err := cursor.All(ctx, &promos); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to decode promo codes",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Promo codes retrieved successfully",
+		Data:    promos,
+	})
+}
+
+// GetPromoCode returns a promo code with its redemptions (admin only)
+func (pc *PromoCodeController) GetPromoCode(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid ID format",
+		})
+	}
+
+	var promo models.PromoCode
+	if err := pc.DB.Collection("promo_codes").FindOne(ctx, bson.M{"_id": id}).Decode(&promo); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, models.Response{
+				Status:  http.StatusNotFound,
+				Message: "Promo code not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch promo code",
+		})
+	}
+
+	cursor, err := pc.DB.Collection("promo_code_redemptions").Find(ctx, bson.M{"promoCodeId": id},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch promo code redemptions",
+		})
+	}
+	redemptions := []models.PromoCodeRedemption{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to decode promo code redemptions",
+		})
+	}
+
+	var totalDiscount float64
+	for _, redemption := range redemptions {
+		if redemption.Status == models.PromoRedemptionRedeemed {
+			totalDiscount += redemption.Discount
+		}
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Promo code retrieved successfully",
+		Data: map[string]interface{}{
+			"promoCode":     promo,
+			"redemptions":   redemptions,
+			"totalDiscount": totalDiscount,
+		},
+	})
+}
+
+// UpdatePromoCode updates a promo code; its usage count is kept (admin only)
+func (pc *PromoCodeController) UpdatePromoCode(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid ID format",
+		})
+	}
+
+	req, salespersonIDs, err := pc.bindPromoCode(c)
+	if req == nil {
+		return err
+	}
+
+	set := bson.M{
+		"code":              services.NormalizePromoCode(req.Code),
+		"description":       req.Description,
+		"discountType":      req.DiscountType,
+		"discountValue":     req.DiscountValue,
+		"validFrom":         req.ValidFrom,
+		"validUntil":        req.ValidUntil,
+		"maxUses":           req.MaxUses,
+		"maxUsesPerAccount": req.MaxUsesPerAccount,
+		"planTypes":         req.PlanTypes,
+		"salespersonIds":    salespersonIDs,
+		"updatedAt":         time.Now(),
+	}
+	if req.IsActive != nil {
+		set["isActive"] = *req.IsActive
+	}
+
+	result, err := pc.DB.Collection("promo_codes").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.JSON(http.StatusConflict, models.Response{
+				Status:  http.StatusConflict,
+				Message: "A promo code with this code already exists",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to update promo code",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Promo code not found",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Promo code updated successfully",
+	})
+}
+
+// DeactivatePromoCode stops a promo code from being used; past redemptions are kept (admin only)
+func (pc *PromoCodeController) DeactivatePromoCode(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid ID format",
+		})
+	}
+
+	result, err := pc.DB.Collection("promo_codes").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"isActive": false, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to deactivate promo code",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: "Promo code not found",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Promo code deactivated successfully",
+	})
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 )
 
@@ -959,11 +960,24 @@ func (smc *SalesManagerController) ApprovePendingCompany(c echo.Context) error {
 		return c.JSON(500, map[string]string{"message": "Failed to get pending request details"})
 	}
 
-	err = utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "company")
+	_, err = utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "company")
 	if err != nil {
 		return c.JSON(500, map[string]string{"message": err.Error()})
 	}
 
+	// The trial covers the main branch created with the company
+	var trial *models.SubscriptionTrial
+	var trialErr error
+	if pendingDoc.TrialPlanID != nil && len(pendingDoc.Company.Branches) > 0 {
+		company := pendingDoc.Company
+		trial, trialErr = smc.startApprovalTrial(c.Request().Context(), services.SubscriptionKindCompanyBranch, company.Branches[0].ID, *pendingDoc.TrialPlanID, services.TrialApplicant{
+			BusinessName:  company.BusinessName,
+			Phones:        append([]string{company.ContactInfo.Phone, company.ContactInfo.WhatsApp}, company.AdditionalPhones...),
+			Emails:        append([]string{pendingDoc.Email}, pendingDoc.AdditionalEmails...),
+			SalespersonID: pendingDoc.SalesPersonID,
+		})
+	}
+
 	// Send notification to salesperson
 	if !pendingDoc.SalesPersonID.IsZero() {
 		title := "Company Request Approved"
@@ -978,7 +992,7 @@ func (smc *SalesManagerController) ApprovePendingCompany(c echo.Context) error {
 		// Don't fail the approval, just log the error
 	}
 
-	return c.JSON(200, map[string]string{"message": "Company request approved"})
+	return approvalResponse(c, "Company request approved", trial, trialErr)
 }
 func (smc *SalesManagerController) RejectPendingCompany(c echo.Context) error {
 	id := c.Param("id")
@@ -1128,11 +1142,24 @@ func (smc *SalesManagerController) ApprovePendingWholesaler(c echo.Context) erro
 		return c.JSON(500, map[string]string{"message": "Failed to get pending request details"})
 	}
 
-	err = utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "wholesaler")
+	_, err = utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "wholesaler")
 	if err != nil {
 		return c.JSON(500, map[string]string{"message": err.Error()})
 	}
 
+	// The trial covers the main branch created with the wholesaler
+	var trial *models.SubscriptionTrial
+	var trialErr error
+	if pendingDoc.TrialPlanID != nil && len(pendingDoc.Wholesaler.Branches) > 0 {
+		wholesaler := pendingDoc.Wholesaler
+		trial, trialErr = smc.startApprovalTrial(c.Request().Context(), services.SubscriptionKindWholesalerBranch, wholesaler.Branches[0].ID, *pendingDoc.TrialPlanID, services.TrialApplicant{
+			BusinessName:  wholesaler.BusinessName,
+			Phones:        append([]string{wholesaler.Phone, wholesaler.ContactInfo.Phone, wholesaler.ContactInfo.WhatsApp}, wholesaler.AdditionalPhones...),
+			Emails:        append([]string{pendingDoc.Email}, pendingDoc.AdditionalEmails...),
+			SalespersonID: pendingDoc.SalesPersonID,
+		})
+	}
+
 	// Send notification to salesperson
 	if !pendingDoc.SalesPersonID.IsZero() {
 		title := "Wholesaler Request Approved"
@@ -1147,7 +1174,7 @@ func (smc *SalesManagerController) ApprovePendingWholesaler(c echo.Context) erro
 		// Don't fail the approval, just log the error
 	}
 
-	return c.JSON(200, map[string]string{"message": "Wholesaler request approved"})
+	return approvalResponse(c, "Wholesaler request approved", trial, trialErr)
 }
 func (smc *SalesManagerController) RejectPendingWholesaler(c echo.Context) error {
 	id := c.Param("id")
@@ -1297,11 +1324,23 @@ func (smc *SalesManagerController) ApprovePendingServiceProvider(c echo.Context)
 		return c.JSON(500, map[string]string{"message": "Failed to get pending request details"})
 	}
 
-	err = utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "serviceProvider")
+	serviceProviderID, err := utils.ApprovePendingRequestByManager(smc.db.Client(), objID, "serviceProvider")
 	if err != nil {
 		return c.JSON(500, map[string]string{"message": err.Error()})
 	}
 
+	var trial *models.SubscriptionTrial
+	var trialErr error
+	if pendingDoc.TrialPlanID != nil {
+		serviceProvider := pendingDoc.ServiceProvider
+		trial, trialErr = smc.startApprovalTrial(c.Request().Context(), services.SubscriptionKindServiceProvider, serviceProviderID, *pendingDoc.TrialPlanID, services.TrialApplicant{
+			BusinessName:  serviceProvider.BusinessName,
+			Phones:        append([]string{serviceProvider.Phone, serviceProvider.ContactPhone, serviceProvider.ContactInfo.Phone}, serviceProvider.AdditionalPhones...),
+			Emails:        append([]string{pendingDoc.Email, serviceProvider.Email}, pendingDoc.AdditionalEmails...),
+			SalespersonID: pendingDoc.SalesPersonID,
+		})
+	}
+
 	// Send notification to salesperson
 	if !pendingDoc.SalesPersonID.IsZero() {
 		title := "Service Provider Request Approved"
@@ -1316,7 +1355,30 @@ func (smc *SalesManagerController) ApprovePendingServiceProvider(c echo.Context)
 		// Don't fail the approval, just log the error
 	}
 
-	return c.JSON(200, map[string]string{"message": "Service provider request approved"})
+	return approvalResponse(c, "Service provider request approved", trial, trialErr)
+}
+
+// startApprovalTrial grants the trial the salesperson asked for when the business was submitted.
+// A business that is no longer eligible is still approved, only without the trial.
+func (smc *SalesManagerController) startApprovalTrial(ctx context.Context, kind string, entityID, planID primitive.ObjectID, applicant services.TrialApplicant) (*models.SubscriptionTrial, error) {
+	trial, err := services.NewTrialService(smc.db).Start(ctx, kind, entityID, planID, applicant)
+	if err != nil {
+		log.Printf("Approved %s %s without a trial: %v", kind, entityID.Hex(), err)
+		return nil, err
+	}
+	return trial, nil
+}
+
+// approvalResponse reports an approved creation request together with the outcome of its trial, if one was asked for
+func approvalResponse(c echo.Context, message string, trial *models.SubscriptionTrial, trialErr error) error {
+	response := map[string]interface{}{"message": message}
+	if trial != nil {
+		response["trial"] = trial
+	}
+	if trialErr != nil {
+		response["trialError"] = trialErr.Error()
+	}
+	return c.JSON(200, response)
 }
 func (smc *SalesManagerController) RejectPendingServiceProvider(c echo.Context) error {
 	id := c.Param("id")
@@ -1393,6 +1455,75 @@ func (smc *SalesManagerController) RejectPendingServiceProvider(c echo.Context)
 	return c.JSON(200, map[string]string{"message": "Service provider request rejected"})
 }
 
+// GetTeamTrials lists the free trials granted to businesses onboarded by the sales manager's salespersons
+func (smc *SalesManagerController) GetTeamTrials(c echo.Context) error {
+	claims := middleware.GetUserFromToken(c)
+	salesManagerID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid sales manager ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := smc.db.Collection("salespersons").Find(ctx, bson.M{"salesManagerId": salesManagerID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch salespersons",
+		})
+	}
+	var salespersons []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &salespersons); err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to decode salespersons",
+		})
+	}
+	salespersonIDs := make([]primitive.ObjectID, 0, len(salespersons))
+	for _, sp := range salespersons {
+		salespersonIDs = append(salespersonIDs, sp.ID)
+	}
+
+	filter := bson.M{"salespersonId": bson.M{"$in": salespersonIDs}}
+	if requested, err := primitive.ObjectIDFromHex(c.QueryParam("salespersonId")); err == nil {
+		// Narrow the report to one salesperson, as long as they belong to the team
+		teamIDs := []primitive.ObjectID{}
+		for _, id := range salespersonIDs {
+			if id == requested {
+				teamIDs = append(teamIDs, id)
+			}
+		}
+		filter["salespersonId"] = bson.M{"$in": teamIDs}
+	}
+	if status := c.QueryParam("status"); status != "" {
+		filter["status"] = status
+	}
+
+	trials, summary, err := services.NewTrialService(smc.db).Report(ctx, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch trials",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Trials retrieved successfully",
+		Data: map[string]interface{}{
+			"trials":  trials,
+			"summary": summary,
+		},
+	})
+}
+
 // ProcessSubscriptionRequest handles the approval or rejection of a subscription request by sales manager
 func (smc *SalesManagerController) ProcessSubscriptionRequest(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -1742,12 +1873,25 @@ func (smc *SalesManagerController) GetCommissionAndWithdrawalHistory(c echo.Cont
 		})
 	}
 
+	// Balances come from the ledger so they always match the postings
+	statement, err := services.NewWalletService(smc.db).Statement(context.Background(), "sales_manager", userID, 100)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch ledger balance: " + err.Error(),
+		})
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Commission and withdrawal history retrieved successfully",
 		Data: map[string]interface{}{
-			"commissions": commissions,
-			"withdrawals": withdrawals,
+			"commissions":       commissions,
+			"withdrawals":       withdrawals,
+			"commissionBalance": statement.Commission.Balance(),
+			"totalEarned":       statement.Commission.CreditTotal,
+			"totalWithdrawn":    statement.Commission.DebitTotal,
+			"ledger":            statement.Transactions,
 		},
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,6 +34,30 @@ func getMapKeys(m map[string][]string) []string {
 	return keys
 }
 
+// requestedTrialPlan reads the optional trialPlanId form field and checks that the business can still get a
+// trial of that plan. It returns nil when no trial was asked for.
+func (spc *SalesPersonController) requestedTrialPlan(form *multipart.Form, kind string, applicant services.TrialApplicant) (*primitive.ObjectID, error) {
+	values := form.Value["trialPlanId"]
+	if len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+		return nil, nil
+	}
+	planID, err := primitive.ObjectIDFromHex(strings.TrimSpace(values[0]))
+	if err != nil {
+		return nil, services.ErrSubscriptionPlanUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trialService := services.NewTrialService(spc.DB.Database("barrim"))
+	if _, err := trialService.TrialPlan(ctx, kind, planID); err != nil {
+		return nil, err
+	}
+	if err := trialService.CheckEligibility(ctx, applicant); err != nil {
+		return nil, err
+	}
+	return &planID, nil
+}
+
 // SalesPersonController handles sales person related operations
 type SalesPersonController struct {
 	DB *mongo.Client
@@ -503,6 +529,29 @@ func (spc *SalesPersonController) CreateCompany(c echo.Context) error {
 		}
 	}
 
+	// Check the business against the territories of the salesperson
+	outsideTerritory, err := services.NewTerritoryService(spc.DB.Database("barrim")).CheckCreation(context.Background(), salesPersonID, models.Address{
+		Country:     country,
+		Governorate: governorate,
+		District:    district,
+		City:        city,
+		Lat:         lat,
+		Lng:         lng,
+	})
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+
+	// Check the optional free trial before anything is stored
+	trialPlanID, err := spc.requestedTrialPlan(form, services.SubscriptionKindCompanyBranch, services.TrialApplicant{
+		BusinessName: businessName,
+		Phones:       append([]string{phone, contactPhone}, additionalPhones...),
+		Emails:       append([]string{email}, additionalEmails...),
+	})
+	if err != nil {
+		return trialErrorResponse(c, err)
+	}
+
 	// Hash password for storage
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -594,6 +643,8 @@ func (spc *SalesPersonController) CreateCompany(c echo.Context) error {
 		Password:         string(hashedPassword),
 		SalesPersonID:    salesPersonID,
 		SalesManagerID:   primitive.NilObjectID, // Set later if needed
+		TrialPlanID:      trialPlanID,
+		OutsideTerritory: outsideTerritory,
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
@@ -1327,6 +1378,29 @@ func (spc *SalesPersonController) CreateWholesaler(c echo.Context) error {
 		}
 	}
 
+	// Check the business against the territories of the salesperson
+	outsideTerritory, err := services.NewTerritoryService(spc.DB.Database("barrim")).CheckCreation(context.Background(), salesPersonID, models.Address{
+		Country:     country,
+		Governorate: governorate,
+		District:    district,
+		City:        city,
+		Lat:         lat,
+		Lng:         lng,
+	})
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+
+	// Check the optional free trial before anything is stored
+	trialPlanID, err := spc.requestedTrialPlan(form, services.SubscriptionKindWholesalerBranch, services.TrialApplicant{
+		BusinessName: businessName,
+		Phones:       append([]string{phone, contactPhone}, additionalPhones...),
+		Emails:       append([]string{email}, additionalEmails...),
+	})
+	if err != nil {
+		return trialErrorResponse(c, err)
+	}
+
 	// Hash password for storage
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -1412,6 +1486,8 @@ func (spc *SalesPersonController) CreateWholesaler(c echo.Context) error {
 		Password:         string(hashedPassword),
 		SalesPersonID:    salesPersonID,
 		SalesManagerID:   primitive.NilObjectID, // Set later if needed
+		TrialPlanID:      trialPlanID,
+		OutsideTerritory: outsideTerritory,
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
@@ -2108,6 +2184,29 @@ func (spc *SalesPersonController) CreateServiceProvider(c echo.Context) error {
 		}
 	}
 
+	// Check the business against the territories of the salesperson
+	outsideTerritory, err := services.NewTerritoryService(spc.DB.Database("barrim")).CheckCreation(context.Background(), salesPersonID, models.Address{
+		Country:     country,
+		Governorate: governorate,
+		District:    district,
+		City:        city,
+		Lat:         lat,
+		Lng:         lng,
+	})
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+
+	// Check the optional free trial before anything is stored
+	trialPlanID, err := spc.requestedTrialPlan(form, services.SubscriptionKindServiceProvider, services.TrialApplicant{
+		BusinessName: businessName,
+		Phones:       append([]string{phone, contactPhone}, additionalPhones...),
+		Emails:       append([]string{email}, additionalEmails...),
+	})
+	if err != nil {
+		return trialErrorResponse(c, err)
+	}
+
 	// Hash password (store in pending request for later use)
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -2229,6 +2328,8 @@ func (spc *SalesPersonController) CreateServiceProvider(c echo.Context) error {
 		CreationRequestStatus: "pending",
 		SalesPersonID:         salesPersonID,
 		SalesManagerID:        primitive.NilObjectID, // Set later if needed
+		TrialPlanID:           trialPlanID,
+		OutsideTerritory:      outsideTerritory,
 		CreatedAt:             time.Now(),
 		UpdatedAt:             time.Now(),
 	}
@@ -2843,6 +2944,15 @@ func (spc *SalesPersonController) GetSalespersonCreatedUsersWithCommission(c ech
 		})
 	}
 
+	// Trials earn nothing until they convert; the report shows what converted and what was paid
+	trials, trialSummary, err := services.NewTrialService(db).Report(context.Background(), bson.M{"salespersonId": salesPersonID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch trials: " + err.Error(),
+		})
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Created users with commission info retrieved successfully",
@@ -2850,6 +2960,44 @@ func (spc *SalesPersonController) GetSalespersonCreatedUsersWithCommission(c ech
 			"companies":        companyResult,
 			"wholesalers":      wholesalerResult,
 			"serviceProviders": spResult,
+			"trials":           trials,
+			"trialSummary":     trialSummary,
+		},
+	})
+}
+
+// GetTrials lists the free trials of the businesses onboarded by the salesperson with their conversion totals
+func (spc *SalesPersonController) GetTrials(c echo.Context) error {
+	claims := middleware.GetUserFromToken(c)
+	salesPersonID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+
+	filter := bson.M{"salespersonId": salesPersonID}
+	if status := c.QueryParam("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trials, summary, err := services.NewTrialService(spc.DB.Database("barrim")).Report(ctx, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch trials",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Trials retrieved successfully",
+		Data: map[string]interface{}{
+			"trials":  trials,
+			"summary": summary,
 		},
 	})
 }
@@ -2945,7 +3093,6 @@ func (spc *SalesPersonController) GetCommissionAndWithdrawalHistory(c echo.Conte
 			bson.M{"_id": userID},
 		).Decode(&salesperson)
 		if err == nil {
-			referralBalance = salesperson.ReferralBalance
 			referralCount = len(salesperson.Referrals)
 		}
 
@@ -2961,10 +3108,26 @@ func (spc *SalesPersonController) GetCommissionAndWithdrawalHistory(c echo.Conte
 		}
 	}
 
+	// Balances come from the ledger so they always match the postings
+	statement, err := services.NewWalletService(db).Statement(context.Background(), claims.UserType, userID, 100)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to fetch ledger balance: " + err.Error(),
+		})
+	}
+	if statement.Referral != nil {
+		referralBalance = statement.Referral.Balance()
+	}
+
 	// Prepare response data
 	responseData := map[string]interface{}{
-		"commissions": commissions,
-		"withdrawals": withdrawals,
+		"commissions":       commissions,
+		"withdrawals":       withdrawals,
+		"commissionBalance": statement.Commission.Balance(),
+		"totalEarned":       statement.Commission.CreditTotal,
+		"totalWithdrawn":    statement.Commission.DebitTotal,
+		"ledger":            statement.Transactions,
 	}
 
 	// Add referral data for salespersons
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SalesTargetController handles salesperson targets and sales leaderboards
+type SalesTargetController struct {
+	DB *mongo.Database
+}
+
+// NewSalesTargetController creates a new sales target controller
+func NewSalesTargetController(db *mongo.Database) *SalesTargetController {
+	return &SalesTargetController{DB: db}
+}
+
+// salesTargetErrorResponse maps sales target service errors to HTTP responses
+func salesTargetErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSalesTargetNotFound), errors.Is(err, services.ErrSalespersonNotInTeam):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrSalesTargetExists), errors.Is(err, services.ErrSalesTargetClosed), errors.Is(err, services.ErrSalesTargetBonusPaid):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidSalesTarget), errors.Is(err, services.ErrInvalidSalesTargetPeriod), errors.Is(err, services.ErrInvalidLeaderboardMetric):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Sales target request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process sales target request",
+		})
+	}
+}
+
+// targetScope returns the authenticated admin or sales manager and the team they manage; the team is
+// empty for admins, who manage every salesperson
+func targetScope(c echo.Context) (string, primitive.ObjectID, primitive.ObjectID, error) {
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "admin" && claims.UserType != "sales_manager" {
+		return "", primitive.NilObjectID, primitive.NilObjectID, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only admins and sales managers can manage sales targets",
+		})
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return "", primitive.NilObjectID, primitive.NilObjectID, c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+	if claims.UserType == "sales_manager" {
+		return claims.UserType, userID, userID, nil
+	}
+	return claims.UserType, userID, primitive.NilObjectID, nil
+}
+
+// targetID parses the :id path parameter
+func targetID(c echo.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid target ID",
+		})
+	}
+	return id, nil
+}
+
+// listTargets responds with the targets matching filter, narrowed by the query parameters
+func (tc *SalesTargetController) listTargets(ctx context.Context, c echo.Context, filter bson.M) error {
+	if _, own := filter["salespersonId"]; !own && c.QueryParam("salespersonId") != "" {
+		id := c.QueryParam("salespersonId")
+		salespersonID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid salesperson ID",
+			})
+		}
+		filter["salespersonId"] = salespersonID
+	}
+	for _, param := range []string{"periodType", "period", "status"} {
+		if value := c.QueryParam(param); value != "" {
+			filter[param] = value
+		}
+	}
+
+	targets, err := services.NewSalesTargetService(tc.DB).List(ctx, filter)
+	if err != nil {
+		return salesTargetErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Sales targets retrieved successfully",
+		Data:    targets,
+	})
+}
+
+// CreateSalesTarget sets a monthly or quarterly target for a salesperson of the sales manager's team (any salesperson for admins)
+func (tc *SalesTargetController) CreateSalesTarget(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, userID, managerID, err := targetScope(c)
+	if role == "" {
+		return err
+	}
+	var req models.SalesTargetRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	salespersonID, err := primitive.ObjectIDFromHex(req.SalespersonID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid salesperson ID",
+		})
+	}
+
+	target, err := services.NewSalesTargetService(tc.DB).Create(ctx, req, salespersonID, managerID, userID, role)
+	if err != nil {
+		return salesTargetErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Sales target created successfully",
+		Data:    target,
+	})
+}
+
+// GetSalesTargets lists the targets of the sales manager's team (every target for admins) with their progress
+func (tc *SalesTargetController) GetSalesTargets(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, _, managerID, err := targetScope(c)
+	if role == "" {
+		return err
+	}
+	filter := bson.M{}
+	if !managerID.IsZero() {
+		filter["salesManagerId"] = managerID
+	}
+	return tc.listTargets(ctx, c, filter)
+}
+
+// UpdateSalesTarget changes the goals, bonus and note of an open target
+func (tc *SalesTargetController) UpdateSalesTarget(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, _, managerID, err := targetScope(c)
+	if role == "" {
+		return err
+	}
+	id, err := targetID(c)
+	if id.IsZero() {
+		return err
+	}
+	var req models.SalesTargetUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+
+	target, err := services.NewSalesTargetService(tc.DB).Update(ctx, id, managerID, req)
+	if err != nil {
+		return salesTargetErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Sales target updated successfully",
+		Data:    target,
+	})
+}
+
+// DeleteSalesTarget removes a target whose bonus was not paid
+func (tc *SalesTargetController) DeleteSalesTarget(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, _, managerID, err := targetScope(c)
+	if role == "" {
+		return err
+	}
+	id, err := targetID(c)
+	if id.IsZero() {
+		return err
+	}
+	if err := services.NewSalesTargetService(tc.DB).Delete(ctx, id, managerID); err != nil {
+		return salesTargetErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Sales target deleted successfully",
+	})
+}
+
+// GetSalesLeaderboard ranks the salespersons of the sales manager's team for a period. Admins see every
+// salesperson, or one team with ?salesManagerId=. The period defaults to the current month or quarter and
+// the ranking to revenue.
+func (tc *SalesTargetController) GetSalesLeaderboard(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, _, managerID, err := targetScope(c)
+	if role == "" {
+		return err
+	}
+	if id := c.QueryParam("salesManagerId"); id != "" && managerID.IsZero() {
+		managerID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid sales manager ID",
+			})
+		}
+	}
+	periodType := c.QueryParam("periodType")
+	if periodType == "" {
+		periodType = models.SalesTargetMonthly
+	}
+
+	board, err := services.NewSalesTargetService(tc.DB).Leaderboard(ctx, managerID, periodType, c.QueryParam("period"), c.QueryParam("metric"))
+	if err != nil {
+		return salesTargetErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Sales leaderboard retrieved successfully",
+		Data:    board,
+	})
+}
+
+// GetMySalesTargets lists the targets of the authenticated salesperson with their progress
+func (tc *SalesTargetController) GetMySalesTargets(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	if claims.UserType != "salesperson" {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only salespersons have sales targets",
+		})
+	}
+	salespersonID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+	return tc.listTargets(ctx, c, bson.M{"salespersonId": salespersonID})
+}
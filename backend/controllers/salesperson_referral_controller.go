@@ -14,6 +14,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 )
 
@@ -123,9 +124,6 @@ func (src *SalespersonReferralController) HandleReferral(c echo.Context) error {
 	// Update the salesperson with $1 referral reward and add user to referrals
 	referralReward := 1.0 // $1 reward
 	update := bson.M{
-		"$inc": bson.M{
-			"referralBalance": referralReward,
-		},
 		"$push": bson.M{
 			"referrals": user.ID,
 		},
@@ -135,6 +133,9 @@ func (src *SalespersonReferralController) HandleReferral(c echo.Context) error {
 	}
 
 	_, err = salespersonsCollection.UpdateByID(ctx, salesperson.ID, update)
+	if err == nil {
+		err = services.NewWalletService(src.DB).RecordReferralReward(ctx, salesperson.ID, referralReward, user.ID, "Referral reward for user referral")
+	}
 	if err != nil {
 		log.Printf("Failed to update salesperson referral balance: %v", err)
 		return c.JSON(http.StatusInternalServerError, models.Response{
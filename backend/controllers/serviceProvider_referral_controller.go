@@ -22,6 +22,7 @@ import (
 	"github.com/HSouheill/barrim_backend/config"
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 	"github.com/boombuler/barcode"
 	"github.com/boombuler/barcode/qr"
@@ -1447,6 +1448,16 @@ func (c *ServiceProviderReferralController) UpdateServiceProviderData(ctx echo.C
 		})
 	}
 
+	// Rebuild the availability schedule from the availability strings this form sends
+	_, daysUpdated := serviceProviderInfo["availableDays"]
+	_, hoursUpdated := serviceProviderInfo["availableHours"]
+	_, weekdaysUpdated := serviceProviderInfo["availableWeekdays"]
+	if daysUpdated || hoursUpdated || weekdaysUpdated {
+		if err := services.NewAvailabilityService(c.DB.Database("barrim")).SyncFromLegacy(context.Background(), "serviceProviders", bson.M{"userId": objID}); err != nil {
+			log.Printf("Failed to update availability schedule: %v", err)
+		}
+	}
+
 	return ctx.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Service provider data updated successfully",
@@ -1781,49 +1792,12 @@ func (c *ServiceProviderReferralController) GetCertificateDetails(ctx echo.Conte
 	})
 }
 
-// Helper function to check if a service provider is available at a given time
+// Helper function to check if a service provider is available at a given time, read from their availability schedule
 func (c *ServiceProviderReferralController) isServiceProviderAvailable(sp *models.User, checkTime time.Time) bool {
 	if sp.ServiceProviderInfo == nil {
 		return false
 	}
-
-	// Get current weekday
-	currentWeekday := checkTime.Weekday().String()
-
-	// Check if the current weekday is in available weekdays
-	isWeekdayAvailable := false
-	for _, weekday := range sp.ServiceProviderInfo.AvailableWeekdays {
-		if weekday == currentWeekday {
-			isWeekdayAvailable = true
-			break
-		}
-	}
-
-	if !isWeekdayAvailable {
-		return false
-	}
-
-	// Get current time in HH:MM format
-	currentTime := checkTime.Format("15:04")
-
-	// Check if current time is within available hours
-	isTimeAvailable := false
-	for _, hourRange := range sp.ServiceProviderInfo.AvailableHours {
-		// Split the range into start and end times
-		times := strings.Split(hourRange, "-")
-		if len(times) != 2 {
-			continue
-		}
-		startTime := strings.TrimSpace(times[0])
-		endTime := strings.TrimSpace(times[1])
-
-		if currentTime >= startTime && currentTime <= endTime {
-			isTimeAvailable = true
-			break
-		}
-	}
-
-	return isTimeAvailable
+	return sp.ServiceProviderInfo.EffectiveSchedule().OpenAt(checkTime)
 }
 
 // UpdateServiceProviderStatus updates the availability status of a service provider
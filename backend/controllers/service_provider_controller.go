@@ -14,6 +14,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -281,6 +282,16 @@ func (spc *ServiceProviderController) UpdateServiceProviderData(c echo.Context)
 		}
 	}
 
+	// A structured schedule replaces the availability strings
+	if updateData.ServiceProviderInfo != nil && updateData.ServiceProviderInfo.Schedule != nil {
+		if err := updateData.ServiceProviderInfo.Schedule.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid availability schedule: " + err.Error(),
+			})
+		}
+	}
+
 	// Validate and process availability schedule if provided
 	if requestBody.AvailabilitySchedule != nil {
 		// Process availability schedule into the standard format
@@ -544,6 +555,20 @@ func (spc *ServiceProviderController) UpdateServiceProviderData(c echo.Context)
 		})
 	}
 
+	// Keep the availability schedule, which bookings and search read, in line with what was sent
+	if info := updateData.ServiceProviderInfo; info != nil {
+		availability := services.NewAvailabilityService(spc.DB)
+		filter := bson.M{"_id": existingServiceProvider.ID}
+		if info.Schedule != nil {
+			_, err = availability.Save(ctx, "serviceProviders", filter, *info.Schedule)
+		} else if info.AvailableDays != nil || info.AvailableHours != nil || info.AvailableWeekdays != nil {
+			err = availability.SyncFromLegacy(ctx, "serviceProviders", filter)
+		}
+		if err != nil {
+			log.Printf("Failed to update availability schedule: %v", err)
+		}
+	}
+
 	// Log the action
 	log.Printf("Service provider data updated: ID=%s, UpdatedBy=%s",
 		existingServiceProvider.ID.Hex(), claims.UserID)
@@ -600,6 +625,19 @@ func (spc *ServiceProviderController) UploadPortfolioImage(c echo.Context) error
 		})
 	}
 
+	// Check the portfolio size against the service provider's plan
+	existingImages := 0
+	if serviceProvider.ServiceProviderInfo != nil {
+		existingImages = len(serviceProvider.ServiceProviderInfo.PortfolioImages)
+	}
+	entitlements, err := services.NewEntitlementService(spc.DB).ForServiceProvider(ctx, serviceProvider.ID)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementPortfolioImages, existingImages+1)
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Get file from form
 	file, err := c.FormFile("image")
 	if err != nil {
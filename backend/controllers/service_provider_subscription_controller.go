@@ -101,6 +101,8 @@ func (spc *ServiceProviderSubscriptionController) GetServiceProviderSubscription
 
 	log.Printf("DEBUG: Found %d subscription plans", len(plans))
 
+	services.NewExchangeRateService(spc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Service provider subscription plans retrieved successfully",
@@ -321,12 +323,50 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 		PaymentMethod:     paymentMethod,
 	}
 
+	// Plans set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(spc.DB).Lock(ctx, plan.Price, plan.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	pricedPlan := plan
+	pricedPlan.Price = conversion.AmountUSD
+	pricedPlan.Currency = models.CurrencyUSD
+
+	// Apply the promo code, if any, to the amount collected
+	promoCodeService := services.NewPromoCodeService(spc.DB)
+	promo, err := promoCodeService.Apply(ctx, c.FormValue("promoCode"), pricedPlan,
+		services.PromoAccount{ID: serviceProvider.ID, BroughtInBy: serviceProvider.CreatedBy},
+		services.SubscriptionKindServiceProvider, serviceProvider.ID, subscriptionRequest.ID)
+	if err != nil {
+		return promoCodeErrorResponse(c, err)
+	}
+	paymentAmount := pricedPlan.Price
+	if promo != nil {
+		paymentAmount = promo.Amount
+		subscriptionRequest.PromoCode = promo.Code
+		subscriptionRequest.Discount = promo.Discount
+		subscriptionRequest.Amount = promo.Amount
+	} else if conversion.OriginalCurrency != models.CurrencyUSD {
+		subscriptionRequest.Amount = paymentAmount
+	}
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate externalId from ObjectID (use timestamp part as int64)
-		externalID = int64(subscriptionRequest.ID.Timestamp().Unix())
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, spc.DB)
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -345,11 +385,11 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 			appURL = baseURL // Fallback to baseURL if APP_URL not set
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 		} else {
@@ -361,7 +401,7 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &plan.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for subscription payments
 			Invoice:            fmt.Sprintf("Service Provider Subscription - %s - Plan: %s", serviceProvider.BusinessName, plan.Title),
 			ExternalID:         &externalID,
@@ -372,9 +412,10 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
+			promoCodeService.Release(ctx, subscriptionRequest.ID)
 			return c.JSON(http.StatusInternalServerError, models.Response{
 				Status:  http.StatusInternalServerError,
 				Message: fmt.Sprintf("Failed to initiate payment: %v", err),
@@ -395,6 +436,7 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 	_, err = subscriptionRequestsCollection.InsertOne(ctx, subscriptionRequest)
 	if err != nil {
 		log.Printf("Failed to save subscription request: %v", err)
+		promoCodeService.Release(ctx, subscriptionRequest.ID)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to create subscription request",
@@ -407,9 +449,12 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSubscript
 		"plan":          plan,
 		"status":        subscriptionRequest.Status,
 		"submittedAt":   subscriptionRequest.RequestedAt,
-		"paymentAmount": plan.Price,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
+	if promo != nil {
+		responseData["promo"] = promo
+	}
 
 	if paymentMethod == "whish" {
 		responseData["collectUrl"] = collectURL
@@ -453,6 +498,7 @@ func (spc *ServiceProviderSubscriptionController) HandleWhishPaymentSuccess(c ec
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("Subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, spc.DB, services.SubscriptionKindServiceProvider, externalID)
 			return c.String(http.StatusNotFound, "Subscription request not found")
 		}
 		log.Printf("Error finding subscription request: %v", err)
@@ -465,32 +511,19 @@ func (spc *ServiceProviderSubscriptionController) HandleWhishPaymentSuccess(c ec
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	if status != "success" {
-		log.Printf("Payment not successful, status: %s", status)
-		// Update request status to failed
-		subscriptionRequestsCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - proceed to activate subscription
-	err = spc.activateServiceProviderSubscription(ctx, subscriptionRequest, phoneNumber)
+	// Re-confirm the payment with Whish and activate it exactly once
+	err = services.NewWhishCallbackService(spc.DB).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:       services.SubscriptionKindServiceProvider,
+		ExternalID: externalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+		RemoteAddr: c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		return spc.activateServiceProviderSubscription(ctx, subscriptionRequest, payerPhone)
+	})
 	if err != nil {
-		log.Printf("Failed to activate subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
+		return whishCallbackErrorResponse(ctx, c, err, subscriptionRequestsCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("Service provider subscription activated successfully for externalId: %d", externalID)
@@ -527,12 +560,37 @@ func (spc *ServiceProviderSubscriptionController) HandleWhishPaymentFailure(c ec
 		return c.String(http.StatusInternalServerError, "Failed to update status")
 	}
 
+	releasePromoCode(ctx, subscriptionRequestsCollection, externalID)
+
 	log.Printf("Payment failed for externalId: %d", externalID)
 	return c.String(http.StatusOK, "Payment failure recorded")
 }
 
-// activateServiceProviderSubscription activates the subscription after successful payment
+// activateServiceProviderSubscription activates the subscription after successful payment.
+// The Whish payment is applied at most once; a replay returns services.ErrPaymentAlreadyProcessed.
 func (spc *ServiceProviderSubscriptionController) activateServiceProviderSubscription(ctx context.Context, subscriptionRequest models.SubscriptionRequest, payerPhone string) error {
+	payment := services.WhishCallback{
+		Kind:       services.SubscriptionKindServiceProvider,
+		ExternalID: subscriptionRequest.ExternalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+	}
+	return services.NewWhishCallbackService(spc.DB).ActivateOnce(ctx, payment, payerPhone, func(sessCtx mongo.SessionContext) error {
+		return spc.applyServiceProviderSubscription(sessCtx, subscriptionRequest)
+	})
+}
+
+// applyServiceProviderSubscription creates the subscription, activates the entity and books the payment
+func (spc *ServiceProviderSubscriptionController) applyServiceProviderSubscription(ctx context.Context, subscriptionRequest models.SubscriptionRequest) error {
+	// Plan changes replace the running subscription instead of starting a new one
+	if subscriptionRequest.PlanChangeOf != nil {
+		return services.NewSubscriptionService(spc.DB).ApplyPlanChange(ctx, services.SubscriptionKindServiceProvider, subscriptionRequest.ID)
+	}
+
+	// Wallet, commission and invoice records use the exchange rate locked with the request
+	ctx = services.WithLockedRate(ctx, subscriptionRequest.CurrencyConversion)
+
 	// Get plan details
 	var plan models.SubscriptionPlan
 	err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscriptionRequest.PlanID}).Decode(&plan)
@@ -549,8 +607,8 @@ func (spc *ServiceProviderSubscriptionController) activateServiceProviderSubscri
 		return fmt.Errorf("failed to get service provider details")
 	}
 
-	// Calculate subscription dates
-	startDate := time.Now()
+	// Calculate subscription dates (renewals continue from the end of the renewed subscription)
+	startDate, autoRenew := services.NewSubscriptionService(spc.DB).RenewalPeriod(ctx, services.SubscriptionKindServiceProvider, subscriptionRequest.RenewalOf)
 	var endDate time.Time
 	switch plan.Duration {
 	case 1: // Monthly
@@ -573,7 +631,7 @@ func (spc *ServiceProviderSubscriptionController) activateServiceProviderSubscri
 		StartDate:         startDate,
 		EndDate:           endDate,
 		Status:            "active",
-		AutoRenew:         false,
+		AutoRenew:         autoRenew,
 		PaymentMethod:     subscriptionRequest.PaymentMethod, // Save payment method permanently
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
@@ -605,49 +663,10 @@ func (spc *ServiceProviderSubscriptionController) activateServiceProviderSubscri
 		log.Printf("Failed to update user status to active: %v", err)
 	}
 
-	// Handle commission and admin wallet (30% salesperson, 70% admin)
-	planPrice := plan.Price
-	if !serviceProvider.CreatedBy.IsZero() && serviceProvider.CreatedBy != serviceProvider.UserID {
-		// Service provider was created by a salesperson - split commission
-		var salesperson models.Salesperson
-		err := spc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": serviceProvider.CreatedBy}).Decode(&salesperson)
-		if err == nil {
-			// Calculate commissions: 30% salesperson, 70% admin
-			salespersonPercent := 30.0
-			adminPercent := 70.0
-
-			salespersonCommission := planPrice * salespersonPercent / 100.0
-			adminCommission := planPrice * adminPercent / 100.0
-
-			// Add salesperson commission
-			err = spc.addCommissionToSalespersonWallet(ctx, salesperson.ID, salespersonCommission, newSubscription.ID, "service_provider_subscription", serviceProvider.BusinessName)
-			if err != nil {
-				log.Printf("Failed to add salesperson commission: %v", err)
-			} else {
-				log.Printf("Added salesperson commission: $%.2f (30%% of $%.2f)", salespersonCommission, planPrice)
-			}
-
-			// Add admin commission
-			err = spc.addSubscriptionIncomeToAdminWallet(ctx, adminCommission, newSubscription.ID, "service_provider_subscription_commission", serviceProvider.BusinessName, "")
-			if err != nil {
-				log.Printf("Failed to add admin commission: %v", err)
-			} else {
-				log.Printf("Added admin commission: $%.2f (70%% of $%.2f)", adminCommission, planPrice)
-			}
-		} else {
-			log.Printf("Salesperson not found, adding full amount to admin wallet")
-			// Salesperson not found, add full amount to admin
-			err = spc.addSubscriptionIncomeToAdminWallet(ctx, planPrice, newSubscription.ID, "service_provider_subscription", serviceProvider.BusinessName, "")
-			if err != nil {
-				log.Printf("Failed to add subscription income to admin wallet: %v", err)
-			}
-		}
-	} else {
-		// Service provider created by itself - full amount to admin
-		err = spc.addSubscriptionIncomeToAdminWallet(ctx, planPrice, newSubscription.ID, "service_provider_subscription", serviceProvider.BusinessName, "")
-		if err != nil {
-			log.Printf("Failed to add subscription income to admin wallet: %v", err)
-		}
+	// Share the payment between the salesperson who signed the service provider, their sales manager and the platform
+	planPrice := subscriptionRequest.AmountDue(plan.Price)
+	if _, err := services.NewCommissionService(spc.DB).Distribute(ctx, serviceProviderCommissionSale(serviceProvider, plan, newSubscription.ID, planPrice)); err != nil {
+		log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
 	}
 
 	// Update subscription request status
@@ -665,108 +684,39 @@ func (spc *ServiceProviderSubscriptionController) activateServiceProviderSubscri
 		log.Printf("Failed to update subscription request status: %v", err)
 	}
 
-	log.Printf("Service provider subscription activated successfully: ServiceProvider=%s, Plan=%s, Amount=$%.2f", serviceProvider.BusinessName, plan.Title, planPrice)
-	return nil
-}
-
-// Helper methods for wallet management
-func (spc *ServiceProviderSubscriptionController) addSubscriptionIncomeToAdminWallet(ctx context.Context, amount float64, entityID primitive.ObjectID, entityType, serviceProviderName, branchName string) error {
-	adminWalletTransaction := models.AdminWallet{
-		ID:          primitive.NewObjectID(),
-		Type:        "subscription_income",
-		Amount:      amount,
-		Description: fmt.Sprintf("Subscription income from %s (%s)", serviceProviderName, entityType),
-		EntityID:    entityID,
-		EntityType:  entityType,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if err := services.NewPromoCodeService(spc.DB).Redeem(ctx, subscriptionRequest.ID); err != nil {
+		log.Printf("Failed to redeem promo code of request %s: %v", subscriptionRequest.ID.Hex(), err)
 	}
 
-	_, err := spc.DB.Collection("admin_wallet").InsertOne(ctx, adminWalletTransaction)
-	if err != nil {
-		return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
-	}
-
-	balanceCollection := spc.DB.Collection("admin_wallet_balance")
-	var balance models.AdminWalletBalance
-	err = balanceCollection.FindOne(ctx, bson.M{}).Decode(&balance)
-
-	if err == mongo.ErrNoDocuments {
-		balance = models.AdminWalletBalance{
-			ID:                    primitive.NewObjectID(),
-			TotalIncome:           amount,
-			TotalWithdrawalIncome: 0,
-			TotalCommissionsPaid:  0,
-			NetBalance:            amount,
-			LastUpdated:           time.Now(),
-		}
-		_, err = balanceCollection.InsertOne(ctx, balance)
-		if err != nil {
-			return fmt.Errorf("failed to create admin wallet balance: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to find admin wallet balance: %w", err)
-	} else {
-		update := bson.M{
-			"$inc": bson.M{
-				"totalIncome": amount,
-				"netBalance":  amount,
-			},
-			"$set": bson.M{
-				"lastUpdated": time.Now(),
-			},
-		}
-		_, err = balanceCollection.UpdateOne(ctx, bson.M{"_id": balance.ID}, update)
-		if err != nil {
-			return fmt.Errorf("failed to update admin wallet balance: %w", err)
-		}
+	if _, err := services.NewInvoiceService(spc.DB).IssueForSubscription(ctx, services.SubscriptionKindServiceProvider, newSubscription.ID, planPrice, subscriptionRequest.ExternalID); err != nil {
+		log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
 	}
 
+	log.Printf("Service provider subscription activated successfully: ServiceProvider=%s, Plan=%s, Amount=$%.2f", serviceProvider.BusinessName, plan.Title, planPrice)
 	return nil
 }
 
-func (spc *ServiceProviderSubscriptionController) addCommissionToSalespersonWallet(ctx context.Context, salespersonID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, serviceProviderName string) error {
-	// CommissionRecord structure
-	type CommissionRecord struct {
-		ID             primitive.ObjectID `bson:"_id,omitempty"`
-		SubscriptionID primitive.ObjectID `bson:"subscriptionId"`
-		SalespersonID  primitive.ObjectID `bson:"salespersonId"`
-		Amount         float64            `bson:"amount"`
-		Role           string             `bson:"role"`
-		Status         string             `bson:"status"`
-		CreatedAt      time.Time          `bson:"createdAt"`
-	}
-
-	commissionRecord := CommissionRecord{
-		ID:             primitive.NewObjectID(),
+// serviceProviderCommissionSale describes a paid service provider subscription for the commission service;
+// commissions go to the salesperson who created the service provider
+func serviceProviderCommissionSale(serviceProvider models.ServiceProvider, plan models.SubscriptionPlan, subscriptionID primitive.ObjectID, amount float64) services.CommissionSale {
+	sale := services.CommissionSale{
+		Kind:           services.SubscriptionKindServiceProvider,
 		SubscriptionID: subscriptionID,
-		SalespersonID:  salespersonID,
+		EntityID:       serviceProvider.ID,
+		BusinessID:     serviceProvider.ID,
+		BusinessName:   serviceProvider.BusinessName,
+		Plan:           plan,
 		Amount:         amount,
-		Role:           "salesperson",
-		Status:         "pending",
-		CreatedAt:      time.Now(),
+		Category:       serviceProvider.Category,
+		Region:         serviceProvider.Governorate,
 	}
-
-	_, err := spc.DB.Collection("commission_records").InsertOne(ctx, commissionRecord)
-	if err != nil {
-		return fmt.Errorf("failed to insert salesperson commission record: %w", err)
+	if sale.Region == "" {
+		sale.Region = serviceProvider.ContactInfo.Address.Governorate
 	}
-
-	_, err = spc.DB.Collection("salespersons").UpdateOne(
-		ctx,
-		bson.M{"_id": salespersonID},
-		bson.M{
-			"$inc": bson.M{"commissionBalance": amount},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update salesperson commission balance: %w", err)
+	if serviceProvider.CreatedBy != serviceProvider.UserID {
+		sale.CreatedBy = serviceProvider.CreatedBy
 	}
-
-	log.Printf("Commission $%.2f added to salesperson wallet (ID: %s) from %s - %s",
-		amount, salespersonID.Hex(), entityType, serviceProviderName)
-	return nil
+	return sale
 }
 
 // GetSubscriptionTimeRemaining returns the remaining time for the current subscription
@@ -809,16 +759,16 @@ func (spc *ServiceProviderSubscriptionController) GetSubscriptionTimeRemaining(c
 			"paymentStatus":     "pending",
 			"status":            bson.M{"$in": []string{"pending", "pending_payment"}},
 		},
-		options.FindOne().SetSort(bson.D{{"requestedAt", -1}}),
+		options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}}),
 	).Decode(&subscriptionRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && subscriptionRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying service provider subscription payment for request: %s (externalId: %d)", subscriptionRequest.ID.Hex(), subscriptionRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -1053,40 +1003,15 @@ func (spc *ServiceProviderSubscriptionController) CancelSubscription(c echo.Cont
 		})
 	}
 
-	// Find and update active subscription
-	subscriptionsCollection := spc.DB.Collection("serviceProviders_subscriptions")
-	now := time.Now()
-
-	result, err := subscriptionsCollection.UpdateOne(
-		ctx,
-		bson.M{
-			"serviceProviderId": serviceProvider.ID,
-			"status":            "active",
-			"endDate": bson.M{
-				"$gt": now,
-			},
-		},
-		bson.M{
-			"$set": bson.M{
-				"status":      "cancelled",
-				"cancelledAt": now,
-				"updatedAt":   now,
-			},
-		},
-	)
-
+	// Cancel the active or paused subscription and refund the unused days
+	subscriptionService := services.NewSubscriptionService(spc.DB)
+	target, err := subscriptionService.ResolveTarget(ctx, services.SubscriptionKindServiceProvider, userID, serviceProvider.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to cancel subscription",
-		})
+		return subscriptionErrorResponse(c, err)
 	}
-
-	if result.MatchedCount == 0 {
-		return c.JSON(http.StatusNotFound, models.Response{
-			Status:  http.StatusNotFound,
-			Message: "No active subscription found to cancel",
-		})
+	_, refund, err := subscriptionService.Cancel(ctx, target, userID)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
 	}
 
 	// Send notification email to admin
@@ -1100,6 +1025,7 @@ func (spc *ServiceProviderSubscriptionController) CancelSubscription(c echo.Cont
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription cancelled successfully",
+		Data:    map[string]interface{}{"refund": refund},
 	})
 }
 
@@ -1253,6 +1179,22 @@ func (spc *ServiceProviderSubscriptionController) ProcessServiceProviderSubscrip
 		})
 	}
 
+	// Plan changes keep the request for the audit trail and replace the running subscription
+	if subscriptionRequest.PlanChangeOf != nil {
+		return processPlanChangeRequest(ctx, c, spc.DB, services.SubscriptionKindServiceProvider, requestObjectID, approvalReq.Status)
+	}
+
+	// Count the promo code use of an approved request, or give it back on rejection
+	promoCodeService := services.NewPromoCodeService(spc.DB)
+	if approvalReq.Status == "approved" {
+		err = promoCodeService.Redeem(ctx, requestObjectID)
+	} else {
+		err = promoCodeService.Release(ctx, requestObjectID)
+	}
+	if err != nil {
+		log.Printf("Failed to update promo code of request %s: %v", requestObjectID.Hex(), err)
+	}
+
 	// Delete the subscription request from database after processing
 	_, err = subscriptionRequestsCollection.DeleteOne(ctx, bson.M{"_id": requestObjectID})
 	if err != nil {
@@ -1347,73 +1289,17 @@ func (spc *ServiceProviderSubscriptionController) ProcessServiceProviderSubscrip
 
 		subscription = &newSubscription
 
-		// --- Commission logic start ---
-		// Only proceed if service provider was created by a salesperson
-		log.Printf("DEBUG: Service Provider CreatedBy field: %v (IsZero: %v)", serviceProvider.CreatedBy, serviceProvider.CreatedBy.IsZero())
-		if !serviceProvider.CreatedBy.IsZero() {
-			log.Printf("DEBUG: Service provider was created by salesperson, proceeding with commission calculation")
-			// Get salesperson
-			var salesperson models.Salesperson
-			err := spc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": serviceProvider.CreatedBy}).Decode(&salesperson)
-			if err == nil {
-				log.Printf("DEBUG: Found salesperson: %s (ID: %v)", salesperson.FullName, salesperson.ID)
-				// Get admin who created the salesperson
-				var admin models.Admin
-				err := spc.DB.Collection("admins").FindOne(ctx, bson.M{"_id": salesperson.CreatedBy}).Decode(&admin)
-				if err == nil {
-					log.Printf("DEBUG: Found admin: %s (ID: %v)", admin.Email, admin.ID)
-					planPrice := plan.Price
-					salespersonPercent := salesperson.CommissionPercent
-
-					// Calculate admin commission (remaining percentage after salesperson commission)
-					adminPercent := 100.0 - salespersonPercent
-
-					log.Printf("DEBUG: Plan price: $%.2f, Salesperson commission percent: %.2f%%, Admin commission percent: %.2f%%",
-						planPrice, salespersonPercent, adminPercent)
-
-					// Calculate commissions correctly
-					// Salesperson gets their percentage directly from the plan price
-					salespersonCommission := planPrice * salespersonPercent / 100.0
-					// Admin gets the remaining percentage
-					adminCommission := planPrice * adminPercent / 100.0
-
-					log.Printf("DEBUG: Calculated commissions - Admin: $%.2f, Salesperson: $%.2f",
-						adminCommission, salespersonCommission)
-
-					// Insert commission document using Commission model
-					commission := models.Commission{
-						ID:                           primitive.NewObjectID(),
-						SubscriptionID:               newSubscription.ID,
-						CompanyID:                    primitive.NilObjectID, // No company ID for service provider
-						PlanID:                       plan.ID,
-						PlanPrice:                    planPrice,
-						AdminID:                      admin.ID,
-						AdminCommission:              adminCommission,
-						AdminCommissionPercent:       adminPercent,
-						SalespersonID:                salesperson.ID,
-						SalespersonCommission:        salespersonCommission,
-						SalespersonCommissionPercent: salespersonPercent,
-						CreatedAt:                    time.Now(),
-						Paid:                         false,
-						PaidAt:                       nil,
-					}
-					_, err := spc.DB.Collection("commissions").InsertOne(ctx, commission)
-					if err != nil {
-						log.Printf("Failed to insert commission: %v", err)
-					} else {
-						log.Printf("Commission inserted successfully for service provider subscription - Plan Price: $%.2f, Admin Commission: $%.2f (%.1f%%), Salesperson Commission: $%.2f (%.1f%%)",
-							planPrice, adminCommission, adminPercent, salespersonCommission, salespersonPercent)
-					}
-				} else {
-					log.Printf("DEBUG: Failed to find admin for ID: %v, Error: %v", salesperson.CreatedBy, err)
-				}
-			} else {
-				log.Printf("DEBUG: Failed to find salesperson for ID: %v, Error: %v", serviceProvider.CreatedBy, err)
-			}
-		} else {
-			log.Printf("DEBUG: Service provider was not created by a salesperson (CreatedBy is zero or not set)")
+		// Wallet, commission and invoice records use the exchange rate locked with the request
+		ctx = services.WithLockedRate(ctx, subscriptionRequest.CurrencyConversion)
+
+		// Share the payment between the salesperson who signed the service provider, their sales manager and the platform
+		if _, err := services.NewCommissionService(spc.DB).Distribute(ctx, serviceProviderCommissionSale(serviceProvider, plan, newSubscription.ID, subscriptionRequest.AmountDue(plan.Price))); err != nil {
+			log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
+		}
+
+		if _, err := services.NewInvoiceService(spc.DB).IssueForSubscription(ctx, services.SubscriptionKindServiceProvider, newSubscription.ID, subscriptionRequest.AmountDue(plan.Price), 0); err != nil {
+			log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
 		}
-		// --- Commission logic end ---
 
 		// Send approval notification
 		emailSubject := "Service Provider Subscription Request Approved! 🎉"
@@ -1436,7 +1322,7 @@ func (spc *ServiceProviderSubscriptionController) ProcessServiceProviderSubscrip
 		`,
 			plan.Title,
 			plan.Duration,
-			plan.Price,
+			subscriptionRequest.AmountDue(plan.Price),
 			startDate.Format("2006-01-02"),
 			endDate.Format("2006-01-02"),
 		)
@@ -1460,7 +1346,7 @@ func (spc *ServiceProviderSubscriptionController) ProcessServiceProviderSubscrip
 			If you have any questions, please contact our support team.
 		`,
 			plan.Title,
-			plan.Price,
+			subscriptionRequest.AmountDue(plan.Price),
 			plan.Duration,
 			approvalReq.AdminNote,
 		)
@@ -1700,61 +1586,19 @@ func (spc *ServiceProviderSubscriptionController) ApproveServiceProviderSubscrip
 			log.Printf("Failed to update service provider status to active: %v", err)
 		}
 
-		// --- Commission logic start ---
-		// Get service provider details
+		// Record the commission of the salesperson who created the service provider
 		var serviceProvider models.ServiceProvider
-		if err := spCollection.FindOne(ctx, bson.M{"_id": request.ServiceProviderID}).Decode(&serviceProvider); err == nil {
-			if !serviceProvider.CreatedBy.IsZero() {
-				// Get salesperson
-				var salesperson models.Salesperson
-				err := spc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": serviceProvider.CreatedBy}).Decode(&salesperson)
-				if err == nil {
-					// Get sales manager
-					var salesManager models.SalesManager
-					err := spc.DB.Collection("sales_managers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-					if err == nil {
-						// Get plan details
-						var plan models.SubscriptionPlan
-						err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-						if err == nil {
-							planPrice := plan.Price
-							salespersonPercent := salesperson.CommissionPercent
-							salesManagerPercent := salesManager.CommissionPercent
-							// Calculate commissions correctly
-							// Salesperson gets their percentage directly from the plan price
-							salespersonCommission := planPrice * salespersonPercent / 100.0
-							// Sales manager gets their percentage directly from the plan price
-							salesManagerCommission := planPrice * salesManagerPercent / 100.0
-							// Insert commission documents
-							commissionCollection := spc.DB.Collection("commissions")
-							commissionDocs := []interface{}{
-								models.Commission{
-									ID:                            primitive.NewObjectID(),
-									SubscriptionID:                request.ID,
-									CompanyID:                     primitive.NilObjectID,
-									PlanID:                        plan.ID,
-									PlanPrice:                     planPrice,
-									SalespersonID:                 salesperson.ID,
-									SalespersonCommission:         salespersonCommission,
-									SalespersonCommissionPercent:  salespersonPercent,
-									SalesManagerID:                salesManager.ID,
-									SalesManagerCommission:        salesManagerCommission,
-									SalesManagerCommissionPercent: salesManagerPercent,
-									CreatedAt:                     time.Now(),
-									Paid:                          false,
-									PaidAt:                        nil,
-								},
-							}
-							_, err := commissionCollection.InsertMany(ctx, commissionDocs)
-							if err != nil {
-								log.Printf("Failed to insert commission docs: %v", err)
-							}
-						}
-					}
-				}
+		var plan models.SubscriptionPlan
+		if err := spCollection.FindOne(ctx, bson.M{"_id": request.ServiceProviderID}).Decode(&serviceProvider); err != nil {
+			log.Printf("Failed to get service provider for commission: %v", err)
+		} else if err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+			log.Printf("Failed to get plan for commission: %v", err)
+		} else {
+			sale := serviceProviderCommissionSale(serviceProvider, plan, request.ID, request.AmountDue(plan.Price))
+			if _, err := services.NewCommissionService(spc.DB).Record(ctx, sale); err != nil {
+				log.Printf("Failed to record commission: %v", err)
 			}
 		}
-		// --- Commission logic end ---
 	}
 
 	return c.JSON(http.StatusOK, models.Response{
@@ -1899,71 +1743,19 @@ func (spc *ServiceProviderSubscriptionController) ApproveServiceProviderSubscrip
 			log.Printf("Failed to update service provider status: %v", err)
 		}
 
-		// --- Commission logic start ---
-		// Get service provider details
+		// Record the commission of the salesperson who created the service provider
 		var serviceProvider models.ServiceProvider
-		if err := spCollection.FindOne(ctx, bson.M{"_id": request.ServiceProviderID}).Decode(&serviceProvider); err == nil {
-			// Check if service provider was created by itself (user signup) - CreatedBy equals UserID
-			if serviceProvider.CreatedBy == serviceProvider.UserID {
-				log.Printf("DEBUG: Service provider was created by user signup, adding subscription price to admin wallet")
-				// Get plan details to get the price
-				var plan models.SubscriptionPlan
-				err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-				if err == nil {
-					log.Printf("Subscription income added to admin wallet: $%.2f from service provider '%s' (ID: %s) - User signup subscription",
-						plan.Price, serviceProvider.BusinessName, serviceProvider.ID.Hex())
-				}
-			} else if !serviceProvider.CreatedBy.IsZero() {
-				// Get salesperson
-				var salesperson models.Salesperson
-				err := spc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": serviceProvider.CreatedBy}).Decode(&salesperson)
-				if err == nil {
-					// Get sales manager
-					var salesManager models.SalesManager
-					err := spc.DB.Collection("sales_managers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-					if err == nil {
-						// Get plan details
-						var plan models.SubscriptionPlan
-						err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-						if err == nil {
-							planPrice := plan.Price
-							salespersonPercent := salesperson.CommissionPercent
-							salesManagerPercent := salesManager.CommissionPercent
-							// Calculate commissions correctly
-							// Salesperson gets their percentage directly from the plan price
-							salespersonCommission := planPrice * salespersonPercent / 100.0
-							// Sales manager gets their percentage directly from the plan price
-							salesManagerCommission := planPrice * salesManagerPercent / 100.0
-							// Insert commission documents
-							commissionCollection := spc.DB.Collection("commissions")
-							commissionDocs := []interface{}{
-								models.Commission{
-									ID:                            primitive.NewObjectID(),
-									SubscriptionID:                request.ID,
-									CompanyID:                     primitive.NilObjectID,
-									PlanID:                        plan.ID,
-									PlanPrice:                     planPrice,
-									SalespersonID:                 salesperson.ID,
-									SalespersonCommission:         salespersonCommission,
-									SalespersonCommissionPercent:  salespersonPercent,
-									SalesManagerID:                salesManager.ID,
-									SalesManagerCommission:        salesManagerCommission,
-									SalesManagerCommissionPercent: salesManagerPercent,
-									CreatedAt:                     time.Now(),
-									Paid:                          false,
-									PaidAt:                        nil,
-								},
-							}
-							_, err := commissionCollection.InsertMany(ctx, commissionDocs)
-							if err != nil {
-								log.Printf("Failed to insert commission docs: %v", err)
-							}
-						}
-					}
-				}
+		var plan models.SubscriptionPlan
+		if err := spCollection.FindOne(ctx, bson.M{"_id": request.ServiceProviderID}).Decode(&serviceProvider); err != nil {
+			log.Printf("Failed to get service provider for commission: %v", err)
+		} else if err := spc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+			log.Printf("Failed to get plan for commission: %v", err)
+		} else {
+			sale := serviceProviderCommissionSale(serviceProvider, plan, request.ID, request.AmountDue(plan.Price))
+			if _, err := services.NewCommissionService(spc.DB).Record(ctx, sale); err != nil {
+				log.Printf("Failed to record commission: %v", err)
 			}
 		}
-		// --- Commission logic end ---
 	}
 
 	return c.JSON(http.StatusOK, models.Response{
@@ -2115,6 +1907,11 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 		})
 	}
 
+	// Sponsorships are only available on plans with sponsored placement
+	if err := services.NewEntitlementService(spc.DB).RequireSponsoredPlacement(ctx, services.SubscriptionKindServiceProvider, serviceProvider.ID); err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if sponsorship exists and is valid
 	sponsorshipCollection := spc.DB.Collection("sponsorships")
 	var sponsorship models.Sponsorship
@@ -2192,12 +1989,31 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 		PaymentMethod: paymentMethod,
 	}
 
+	// Sponsorships set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(spc.DB).Lock(ctx, sponsorship.Price, sponsorship.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	subscriptionRequest.Amount = conversion.AmountUSD
+	paymentAmount := conversion.AmountUSD
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate external ID for Whish payment (using timestamp-based unique ID)
-		externalID = time.Now().UnixNano() / int64(time.Millisecond)
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, spc.DB)
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -2216,11 +2032,11 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 			appURL = "barrim://payment" // Fallback to baseURL if APP_URL not set
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 			// Continue anyway - balance check failure doesn't block payment creation
@@ -2233,7 +2049,7 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &sponsorship.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for sponsorship payments
 			Invoice:            fmt.Sprintf("Service Provider Sponsorship - %s - Sponsorship: %s", serviceProvider.BusinessName, sponsorship.Title),
 			ExternalID:         &externalID,
@@ -2244,7 +2060,7 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
 			return c.JSON(http.StatusInternalServerError, models.Response{
@@ -2286,6 +2102,8 @@ func (spc *ServiceProviderSubscriptionController) CreateServiceProviderSponsorsh
 		"submittedAt":   subscriptionRequest.RequestedAt,
 		"adminNote":     subscriptionRequest.AdminNote,
 		"price":         sponsorship.Price,
+		"currency":      conversion.OriginalCurrency,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
 
@@ -2352,15 +2170,15 @@ func (spc *ServiceProviderSubscriptionController) GetServiceProviderSponsorshipR
 		"entityId":      serviceProvider.ID,
 		"paymentStatus": "pending",
 		"status":        bson.M{"$in": []string{"pending", "pending_payment"}},
-	}, options.FindOne().SetSort(bson.D{{"requestedAt", -1}})).Decode(&sponsorshipRequest)
+	}, options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}})).Decode(&sponsorshipRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && sponsorshipRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying service provider sponsorship payment for request: %s (externalId: %d)", sponsorshipRequest.ID.Hex(), sponsorshipRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify sponsorship payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -2381,51 +2199,11 @@ func (spc *ServiceProviderSubscriptionController) GetServiceProviderSponsorshipR
 				}).Decode(&existingSubscription)
 
 				if err != nil {
-					// No active subscription exists, activate it
-					// Get sponsorship details
-					sponsorshipCollection := spc.DB.Collection("sponsorships")
-					var sponsorship models.Sponsorship
-					err = sponsorshipCollection.FindOne(ctx, bson.M{"_id": sponsorshipRequest.SponsorshipID}).Decode(&sponsorship)
-					if err == nil {
-						// Use sponsorship subscription controller to activate
-						sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(spc.DB)
-
-						// Add sponsorship income to admin wallet
-						err = sponsorshipSubscriptionController.addSponsorshipIncomeToAdminWallet(
-							ctx,
-							sponsorship.Price,
-							sponsorshipRequest.SponsorshipID,
-							fmt.Sprintf("%s - %s", sponsorship.Title, sponsorshipRequest.EntityName),
-						)
-						if err != nil {
-							log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-						}
-
-						// Create active subscription
-						err = sponsorshipSubscriptionController.createActiveSubscription(ctx, sponsorshipRequest)
-						if err != nil {
-							log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
-						} else {
-							log.Printf("✅ Sponsorship subscription auto-activated successfully")
-
-							// Update entity sponsorship status to active
-							err = sponsorshipSubscriptionController.updateEntitySponsorshipStatus(ctx, sponsorshipRequest.EntityType, sponsorshipRequest.EntityID, true)
-							if err != nil {
-								log.Printf("Failed to update entity sponsorship status: %v", err)
-							}
-
-							// Update request status
-							sponsorshipRequestCollection.UpdateOne(ctx,
-								bson.M{"_id": sponsorshipRequest.ID},
-								bson.M{"$set": bson.M{
-									"paymentStatus": "success",
-									"status":        "approved",
-									"adminApproved": true,
-									"approvedAt":    time.Now(),
-									"paidAt":        time.Now(),
-									"processedAt":   time.Now(),
-								}})
-						}
+					// No active subscription exists, activate it exactly once
+					if _, err := NewSponsorshipSubscriptionController(spc.DB).activatePaidSponsorship(ctx, sponsorshipRequest, phoneNumber); err != nil {
+						log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
+					} else {
+						log.Printf("✅ Sponsorship subscription auto-activated successfully")
 					}
 				} else {
 					log.Printf("ℹ️  Sponsorship subscription already active, updating request status")
@@ -2644,6 +2422,7 @@ func (spc *ServiceProviderSubscriptionController) HandleWhishSponsorshipPaymentS
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("Sponsorship subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, spc.DB, services.WhishPaymentKindSponsorship, externalID)
 			return c.String(http.StatusNotFound, "Sponsorship subscription request not found")
 		}
 		log.Printf("Error finding sponsorship subscription request: %v", err)
@@ -2656,83 +2435,25 @@ func (spc *ServiceProviderSubscriptionController) HandleWhishSponsorshipPaymentS
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	if status != "success" {
-		log.Printf("❌ PAYMENT FAILED: Payment not successful, status: %s", status)
-		log.Printf("   Request ID: %s", subscriptionRequest.ID.Hex())
-		log.Printf("   Entity: %s (%s)", subscriptionRequest.EntityName, subscriptionRequest.EntityType)
-		// Update request status to failed
-		requestCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		log.Printf("==========================================")
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - activate subscription immediately
-	// Get sponsorship details
-	sponsorshipCollection := spc.DB.Collection("sponsorships")
-	var sponsorship models.Sponsorship
-	err = sponsorshipCollection.FindOne(ctx, bson.M{"_id": subscriptionRequest.SponsorshipID}).Decode(&sponsorship)
-	if err != nil {
-		log.Printf("Failed to get sponsorship details: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to get sponsorship details")
-	}
-
-	// Add sponsorship income to admin wallet using sponsorship subscription controller
+	// Re-confirm the payment with Whish and activate it exactly once
+	var phoneNumber string
+	var sponsorship *models.Sponsorship
 	sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(spc.DB)
-	err = sponsorshipSubscriptionController.addSponsorshipIncomeToAdminWallet(
-		ctx,
-		sponsorship.Price,
-		subscriptionRequest.SponsorshipID,
-		fmt.Sprintf("%s - %s", sponsorship.Title, subscriptionRequest.EntityName),
-	)
-	if err != nil {
-		log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-		// Don't fail the payment if wallet update fails, but log it
-	}
-
-	// Create active subscription immediately after payment
-	err = sponsorshipSubscriptionController.createActiveSubscription(ctx, subscriptionRequest)
-	if err != nil {
-		log.Printf("Failed to create active subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
-	}
-
-	// Update entity sponsorship status to active
-	err = sponsorshipSubscriptionController.updateEntitySponsorshipStatus(ctx, subscriptionRequest.EntityType, subscriptionRequest.EntityID, true)
-	if err != nil {
-		log.Printf("Failed to update entity sponsorship status: %v", err)
-		// Don't fail the process if status update fails, but log it
-	}
-
-	// Update request status - mark as approved/active after payment
-	update := bson.M{
-		"$set": bson.M{
-			"paymentStatus": "success",
-			"status":        "approved",
-			"adminApproved": true,
-			"approvedAt":    time.Now(),
-			"paidAt":        time.Now(),
-			"processedAt":   time.Now(),
-		},
-	}
-
-	_, err = requestCollection.UpdateOne(ctx, bson.M{"_id": subscriptionRequest.ID}, update)
+	err = services.NewWhishCallbackService(spc.DB).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:          services.WhishPaymentKindSponsorship,
+		ExternalID:    externalID,
+		RequestID:     subscriptionRequest.ID,
+		SponsorshipID: subscriptionRequest.SponsorshipID,
+		Amount:        subscriptionRequest.Amount,
+		RemoteAddr:    c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		phoneNumber = payerPhone
+		var err error
+		sponsorship, err = sponsorshipSubscriptionController.activatePaidSponsorship(ctx, subscriptionRequest, payerPhone)
+		return err
+	})
 	if err != nil {
-		log.Printf("Failed to update sponsorship subscription request status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to update request status")
+		return whishCallbackErrorResponse(ctx, c, err, requestCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("✅ PAYMENT SUCCESS: Service provider sponsorship payment completed and activated")
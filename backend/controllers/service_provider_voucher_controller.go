@@ -9,6 +9,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -202,6 +203,15 @@ func (spvc *ServiceProviderVoucherController) PurchaseVoucherForServiceProvider(
 		currentPoints = serviceProvider.ServiceProviderInfo.Points
 	}
 
+	// Voucher purchases are only available on plans with voucher access
+	entitlements, err := services.NewEntitlementService(spvc.DB).ForServiceProvider(ctx, serviceProvider.ID)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementVoucherAccess, 1)
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if enough points
 	if currentPoints < voucher.Points {
 		return c.JSON(http.StatusBadRequest, models.Response{
@@ -266,6 +276,10 @@ func (spvc *ServiceProviderVoucherController) PurchaseVoucherForServiceProvider(
 		})
 	}
 
+	if _, err := services.NewInvoiceService(spvc.DB).IssueForVoucher(ctx, "serviceProvider", serviceProvider.ID, serviceProvider.BusinessName, voucher, purchase.ID); err != nil {
+		log.Printf("Failed to issue invoice for voucher purchase %s: %v", purchase.ID.Hex(), err)
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Voucher purchased successfully",
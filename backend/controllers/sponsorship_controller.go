@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -79,6 +80,7 @@ func (sc *SponsorshipController) CreateSponsorship(c echo.Context) error {
 	sponsorship := models.Sponsorship{
 		Title:        req.Title,
 		Price:        req.Price,
+		Currency:     models.PriceCurrency(req.Currency),
 		Duration:     req.Duration,
 		DurationInfo: durationInfo,
 		Discount:     req.Discount,
@@ -166,6 +168,7 @@ func (sc *SponsorshipController) CreateServiceProviderSponsorship(c echo.Context
 	sponsorship := models.Sponsorship{
 		Title:        "Service Provider: " + req.Title,
 		Price:        req.Price,
+		Currency:     models.PriceCurrency(req.Currency),
 		Duration:     req.Duration,
 		DurationInfo: durationInfo,
 		Discount:     req.Discount,
@@ -253,6 +256,7 @@ func (sc *SponsorshipController) CreateCompanyWholesalerSponsorship(c echo.Conte
 	sponsorship := models.Sponsorship{
 		Title:        "Company/Wholesaler: " + req.Title,
 		Price:        req.Price,
+		Currency:     models.PriceCurrency(req.Currency),
 		Duration:     req.Duration,
 		DurationInfo: durationInfo,
 		Discount:     req.Discount,
@@ -338,6 +342,8 @@ func (sc *SponsorshipController) GetSponsorships(c echo.Context) error {
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplaySponsorships(context.Background(), sponsorships)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 		"data": map[string]interface{}{
@@ -464,6 +470,9 @@ func (sc *SponsorshipController) UpdateSponsorship(c echo.Context) error {
 	if req.Price != nil {
 		update["price"] = *req.Price
 	}
+	if req.Currency != nil {
+		update["currency"] = models.PriceCurrency(*req.Currency)
+	}
 	if req.Duration != nil {
 		update["duration"] = *req.Duration
 		// Recalculate duration info when duration changes
@@ -712,6 +721,8 @@ func (sc *SponsorshipController) GetServiceProviderSponsorships(c echo.Context)
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplaySponsorships(context.Background(), sponsorships)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 		"data": map[string]interface{}{
@@ -787,6 +798,8 @@ func (sc *SponsorshipController) GetCompanyWholesalerSponsorships(c echo.Context
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplaySponsorships(context.Background(), sponsorships)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 		"data": map[string]interface{}{
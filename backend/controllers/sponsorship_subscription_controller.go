@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -45,6 +46,22 @@ func (ssc *SponsorshipSubscriptionController) CreateSponsorshipSubscriptionReque
 		})
 	}
 
+	// Sponsorships are only available on plans with sponsored placement
+	if err := services.NewEntitlementService(ssc.DB).RequireSponsoredPlacement(context.Background(), req.EntityType, req.EntityID); err != nil {
+		var entitlementErr *models.EntitlementError
+		if errors.As(err, &entitlementErr) {
+			return c.JSON(http.StatusForbidden, map[string]interface{}{
+				"success": false,
+				"message": entitlementErr.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to check subscription plan entitlements",
+			"error":   err.Error(),
+		})
+	}
+
 	// Check if sponsorship exists and is valid
 	sponsorshipCollection := ssc.DB.Collection("sponsorships")
 	var sponsorship models.Sponsorship
@@ -125,6 +142,18 @@ func (ssc *SponsorshipSubscriptionController) CreateSponsorshipSubscriptionReque
 		ManagerApproved: nil,
 	}
 
+	// Sponsorships set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(ssc.DB).Lock(context.Background(), sponsorship.Price, sponsorship.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to get exchange rate",
+			"error":   err.Error(),
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	subscriptionRequest.Amount = conversion.AmountUSD
+
 	// Insert into database
 	requestCollection := ssc.DB.Collection("sponsorship_subscription_requests")
 	result, err := requestCollection.InsertOne(context.Background(), subscriptionRequest)
@@ -355,7 +384,7 @@ func (ssc *SponsorshipSubscriptionController) ProcessSponsorshipSubscriptionRequ
 
 	// If approved, create the actual subscription and update entity sponsorship status
 	if req.Status == "approved" {
-		err = ssc.createActiveSubscription(context.Background(), subscriptionRequest)
+		subscription, err := ssc.createActiveSubscription(context.Background(), subscriptionRequest)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 				"success": false,
@@ -377,11 +406,12 @@ func (ssc *SponsorshipSubscriptionController) ProcessSponsorshipSubscriptionRequ
 		// Add sponsorship price to admin wallet only if payment hasn't been processed yet
 		// (Payment success callback already adds to wallet for paid requests)
 		if subscriptionRequest.PaymentStatus != "success" {
-			err = ssc.addSponsorshipToAdminWallet(subscriptionRequest.SponsorshipID)
+			err = ssc.addSponsorshipToAdminWallet(subscriptionRequest)
 			if err != nil {
 				log.Printf("Warning: Failed to add sponsorship to admin wallet: %v", err)
 				// Don't fail the approval if wallet update fails
 			}
+			ssc.issueSponsorshipInvoice(services.WithLockedRate(context.Background(), subscriptionRequest.CurrencyConversion), subscriptionRequest, subscription)
 		} else {
 			log.Printf("Skipping admin wallet addition - payment already processed and added to wallet")
 		}
@@ -654,15 +684,15 @@ func (ssc *SponsorshipSubscriptionController) GetTimeRemainingForWholesalerBranc
 		"entityId":      objectID,
 		"paymentStatus": "pending",
 		"status":        bson.M{"$in": []string{"pending", "pending_payment"}},
-	}, options.FindOne().SetSort(bson.D{{"requestedAt", -1}})).Decode(&sponsorshipRequest)
+	}, options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}})).Decode(&sponsorshipRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && sponsorshipRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying wholesaler branch sponsorship payment for request: %s (externalId: %d)", sponsorshipRequest.ID.Hex(), sponsorshipRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify sponsorship payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -683,48 +713,11 @@ func (ssc *SponsorshipSubscriptionController) GetTimeRemainingForWholesalerBranc
 				}).Decode(&existingSubscription)
 
 				if err != nil {
-					// No active subscription exists, activate it
-					// Get sponsorship details
-					sponsorshipCollection := ssc.DB.Collection("sponsorships")
-					var sponsorship models.Sponsorship
-					err = sponsorshipCollection.FindOne(context.Background(), bson.M{"_id": sponsorshipRequest.SponsorshipID}).Decode(&sponsorship)
-					if err == nil {
-						// Add sponsorship income to admin wallet
-						err = ssc.addSponsorshipIncomeToAdminWallet(
-							context.Background(),
-							sponsorship.Price,
-							sponsorshipRequest.SponsorshipID,
-							fmt.Sprintf("%s - %s", sponsorship.Title, sponsorshipRequest.EntityName),
-						)
-						if err != nil {
-							log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-						}
-
-						// Create active subscription
-						err = ssc.createActiveSubscription(context.Background(), sponsorshipRequest)
-						if err != nil {
-							log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
-						} else {
-							log.Printf("✅ Sponsorship subscription auto-activated successfully")
-
-							// Update entity sponsorship status to active
-							err = ssc.updateEntitySponsorshipStatus(context.Background(), sponsorshipRequest.EntityType, sponsorshipRequest.EntityID, true)
-							if err != nil {
-								log.Printf("Failed to update entity sponsorship status: %v", err)
-							}
-
-							// Update request status
-							sponsorshipRequestCollection.UpdateOne(context.Background(),
-								bson.M{"_id": sponsorshipRequest.ID},
-								bson.M{"$set": bson.M{
-									"paymentStatus": "success",
-									"status":        "approved",
-									"adminApproved": true,
-									"approvedAt":    time.Now(),
-									"paidAt":        time.Now(),
-									"processedAt":   time.Now(),
-								}})
-						}
+					// No active subscription exists, activate it exactly once
+					if _, err := ssc.activatePaidSponsorship(context.Background(), sponsorshipRequest, phoneNumber); err != nil {
+						log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
+					} else {
+						log.Printf("✅ Sponsorship subscription auto-activated successfully")
 					}
 				} else {
 					log.Printf("ℹ️  Sponsorship subscription already active, updating request status")
@@ -862,15 +855,15 @@ func (ssc *SponsorshipSubscriptionController) GetTimeRemainingForServiceProvider
 		"entityId":      objectID,
 		"paymentStatus": "pending",
 		"status":        bson.M{"$in": []string{"pending", "pending_payment"}},
-	}, options.FindOne().SetSort(bson.D{{"requestedAt", -1}})).Decode(&sponsorshipRequest)
+	}, options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}})).Decode(&sponsorshipRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && sponsorshipRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying service provider sponsorship payment for request: %s (externalId: %d)", sponsorshipRequest.ID.Hex(), sponsorshipRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", sponsorshipRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify sponsorship payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -891,48 +884,11 @@ func (ssc *SponsorshipSubscriptionController) GetTimeRemainingForServiceProvider
 				}).Decode(&existingSubscription)
 
 				if err != nil {
-					// No active subscription exists, activate it
-					// Get sponsorship details
-					sponsorshipCollection := ssc.DB.Collection("sponsorships")
-					var sponsorship models.Sponsorship
-					err = sponsorshipCollection.FindOne(context.Background(), bson.M{"_id": sponsorshipRequest.SponsorshipID}).Decode(&sponsorship)
-					if err == nil {
-						// Add sponsorship income to admin wallet
-						err = ssc.addSponsorshipIncomeToAdminWallet(
-							context.Background(),
-							sponsorship.Price,
-							sponsorshipRequest.SponsorshipID,
-							fmt.Sprintf("%s - %s", sponsorship.Title, sponsorshipRequest.EntityName),
-						)
-						if err != nil {
-							log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-						}
-
-						// Create active subscription
-						err = ssc.createActiveSubscription(context.Background(), sponsorshipRequest)
-						if err != nil {
-							log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
-						} else {
-							log.Printf("✅ Sponsorship subscription auto-activated successfully")
-
-							// Update entity sponsorship status to active
-							err = ssc.updateEntitySponsorshipStatus(context.Background(), sponsorshipRequest.EntityType, sponsorshipRequest.EntityID, true)
-							if err != nil {
-								log.Printf("Failed to update entity sponsorship status: %v", err)
-							}
-
-							// Update request status
-							sponsorshipRequestCollection.UpdateOne(context.Background(),
-								bson.M{"_id": sponsorshipRequest.ID},
-								bson.M{"$set": bson.M{
-									"paymentStatus": "success",
-									"status":        "approved",
-									"adminApproved": true,
-									"approvedAt":    time.Now(),
-									"paidAt":        time.Now(),
-									"processedAt":   time.Now(),
-								}})
-						}
+					// No active subscription exists, activate it exactly once
+					if _, err := ssc.activatePaidSponsorship(context.Background(), sponsorshipRequest, phoneNumber); err != nil {
+						log.Printf("❌ Failed to auto-activate sponsorship subscription: %v", err)
+					} else {
+						log.Printf("✅ Sponsorship subscription auto-activated successfully")
 					}
 				} else {
 					log.Printf("ℹ️  Sponsorship subscription already active, updating request status")
@@ -1278,13 +1234,13 @@ func (ssc *SponsorshipSubscriptionController) getEntityDetails(entityType string
 }
 
 // Helper function to create active subscription
-func (ssc *SponsorshipSubscriptionController) createActiveSubscription(ctx context.Context, request models.SponsorshipSubscriptionRequest) error {
+func (ssc *SponsorshipSubscriptionController) createActiveSubscription(ctx context.Context, request models.SponsorshipSubscriptionRequest) (*models.SponsorshipSubscription, error) {
 	// Get sponsorship details
 	sponsorshipCollection := ssc.DB.Collection("sponsorships")
 	var sponsorship models.Sponsorship
 	err := sponsorshipCollection.FindOne(ctx, bson.M{"_id": request.SponsorshipID}).Decode(&sponsorship)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Calculate start and end dates
@@ -1293,6 +1249,7 @@ func (ssc *SponsorshipSubscriptionController) createActiveSubscription(ctx conte
 
 	// Create active subscription
 	subscription := models.SponsorshipSubscription{
+		ID:              primitive.NewObjectID(),
 		SponsorshipID:   request.SponsorshipID,
 		EntityType:      ssc.normalizeEntityType(request.EntityType), // Normalize to snake_case for consistency
 		EntityID:        request.EntityID,
@@ -1309,7 +1266,7 @@ func (ssc *SponsorshipSubscriptionController) createActiveSubscription(ctx conte
 	subscriptionCollection := ssc.DB.Collection("sponsorship_subscriptions")
 	_, err = subscriptionCollection.InsertOne(ctx, subscription)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Update sponsorship used count
@@ -1318,8 +1275,96 @@ func (ssc *SponsorshipSubscriptionController) createActiveSubscription(ctx conte
 		bson.M{"_id": request.SponsorshipID},
 		bson.M{"$inc": bson.M{"usedCount": 1}},
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+// issueSponsorshipInvoice issues the invoice of a paid sponsorship request; failures are logged and do not undo the activation
+func (ssc *SponsorshipSubscriptionController) issueSponsorshipInvoice(ctx context.Context, request models.SponsorshipSubscriptionRequest, subscription *models.SponsorshipSubscription) {
+	var sponsorship models.Sponsorship
+	err := ssc.DB.Collection("sponsorships").FindOne(ctx, bson.M{"_id": request.SponsorshipID}).Decode(&sponsorship)
+	if err == nil {
+		_, err = services.NewInvoiceService(ssc.DB).IssueForSponsorship(ctx, request, sponsorship, *subscription)
+	}
+	if err != nil {
+		log.Printf("Failed to issue invoice for sponsorship request %s: %v", request.ID.Hex(), err)
+	}
+}
+
+// activatePaidSponsorship activates a sponsorship request paid through Whish.
+// The Whish payment is applied at most once; a replay returns services.ErrPaymentAlreadyProcessed.
+func (ssc *SponsorshipSubscriptionController) activatePaidSponsorship(ctx context.Context, request models.SponsorshipSubscriptionRequest, payerPhone string) (*models.Sponsorship, error) {
+	payment := services.WhishCallback{
+		Kind:          services.WhishPaymentKindSponsorship,
+		ExternalID:    request.ExternalID,
+		RequestID:     request.ID,
+		SponsorshipID: request.SponsorshipID,
+		Amount:        request.Amount,
+	}
+	var sponsorship *models.Sponsorship
+	err := services.NewWhishCallbackService(ssc.DB).ActivateOnce(ctx, payment, payerPhone, func(sessCtx mongo.SessionContext) error {
+		var err error
+		sponsorship, err = ssc.applyPaidSponsorship(sessCtx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sponsorship, nil
+}
+
+// applyPaidSponsorship books the sponsorship income and creates the active sponsorship subscription
+func (ssc *SponsorshipSubscriptionController) applyPaidSponsorship(ctx context.Context, request models.SponsorshipSubscriptionRequest) (*models.Sponsorship, error) {
+	// Get sponsorship details
+	var sponsorship models.Sponsorship
+	err := ssc.DB.Collection("sponsorships").FindOne(ctx, bson.M{"_id": request.SponsorshipID}).Decode(&sponsorship)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sponsorship details: %w", err)
+	}
+
+	ctx = services.WithLockedRate(ctx, request.CurrencyConversion)
+	err = ssc.addSponsorshipIncomeToAdminWallet(
+		ctx,
+		request.AmountDue(sponsorship.Price),
+		request.SponsorshipID,
+		fmt.Sprintf("%s - %s", sponsorship.Title, request.EntityName),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add sponsorship income to admin wallet: %w", err)
+	}
+
+	// Create active subscription immediately after payment
+	subscription, err := ssc.createActiveSubscription(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create active subscription: %w", err)
+	}
+	ssc.issueSponsorshipInvoice(ctx, request, subscription)
+
+	// Update entity sponsorship status to active
+	if err := ssc.updateEntitySponsorshipStatus(ctx, request.EntityType, request.EntityID, true); err != nil {
+		log.Printf("Failed to update entity sponsorship status: %v", err)
+		// Don't fail the process if status update fails, but log it
+	}
+
+	// Update request status - mark as approved/active after payment
+	_, err = ssc.DB.Collection("sponsorship_subscription_requests").UpdateOne(ctx,
+		bson.M{"_id": request.ID},
+		bson.M{"$set": bson.M{
+			"paymentStatus": "success",
+			"status":        "approved",
+			"adminApproved": true,
+			"approvedAt":    time.Now(),
+			"paidAt":        time.Now(),
+			"processedAt":   time.Now(),
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update request status: %w", err)
+	}
 
-	return err
+	return &sponsorship, nil
 }
 
 // Helper function to normalize entity type (handle both camelCase and snake_case)
@@ -1385,77 +1430,24 @@ func (ssc *SponsorshipSubscriptionController) updateEntitySponsorshipStatus(ctx
 
 // addSponsorshipToAdminWallet adds the sponsorship price to the admin wallet
 // This method creates a record of the sponsorship income for the admin wallet calculation
-func (ssc *SponsorshipSubscriptionController) addSponsorshipToAdminWallet(sponsorshipID primitive.ObjectID) error {
-	ctx := context.Background()
+func (ssc *SponsorshipSubscriptionController) addSponsorshipToAdminWallet(request models.SponsorshipSubscriptionRequest) error {
+	ctx := services.WithLockedRate(context.Background(), request.CurrencyConversion)
 	// Get sponsorship details to get the price
 	sponsorshipCollection := ssc.DB.Collection("sponsorships")
 	var sponsorship models.Sponsorship
-	err := sponsorshipCollection.FindOne(ctx, bson.M{"_id": sponsorshipID}).Decode(&sponsorship)
+	err := sponsorshipCollection.FindOne(ctx, bson.M{"_id": request.SponsorshipID}).Decode(&sponsorship)
 	if err != nil {
 		return fmt.Errorf("failed to get sponsorship details: %v", err)
 	}
 
-	return ssc.addSponsorshipIncomeToAdminWallet(ctx, sponsorship.Price, sponsorshipID, sponsorship.Title)
+	return ssc.addSponsorshipIncomeToAdminWallet(ctx, request.AmountDue(sponsorship.Price), request.SponsorshipID, sponsorship.Title)
 }
 
 // addSponsorshipIncomeToAdminWallet adds sponsorship income to the admin wallet
 func (ssc *SponsorshipSubscriptionController) addSponsorshipIncomeToAdminWallet(ctx context.Context, amount float64, entityID primitive.ObjectID, description string) error {
-	// Create admin wallet transaction
-	adminWalletTransaction := models.AdminWallet{
-		ID:          primitive.NewObjectID(),
-		Type:        "subscription_income", // Use subscription_income type for sponsorship income
-		Amount:      amount,
-		Description: fmt.Sprintf("Sponsorship income: %s", description),
-		EntityID:    entityID,
-		EntityType:  "sponsorship",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// Insert the transaction
-	_, err := ssc.DB.Collection("admin_wallet").InsertOne(ctx, adminWalletTransaction)
+	err := services.NewWalletService(ssc.DB).RecordSubscriptionIncome(ctx, amount, entityID, "sponsorship", fmt.Sprintf("Sponsorship income: %s", description))
 	if err != nil {
-		return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
-	}
-
-	// Update or create admin wallet balance
-	balanceCollection := ssc.DB.Collection("admin_wallet_balance")
-
-	// Try to find existing balance record
-	var balance models.AdminWalletBalance
-	err = balanceCollection.FindOne(ctx, bson.M{}).Decode(&balance)
-
-	if err == mongo.ErrNoDocuments {
-		// Create new balance record
-		balance = models.AdminWalletBalance{
-			ID:                    primitive.NewObjectID(),
-			TotalIncome:           amount,
-			TotalWithdrawalIncome: 0,
-			TotalCommissionsPaid:  0,
-			NetBalance:            amount,
-			LastUpdated:           time.Now(),
-		}
-		_, err = balanceCollection.InsertOne(ctx, balance)
-		if err != nil {
-			return fmt.Errorf("failed to create admin wallet balance: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to find admin wallet balance: %w", err)
-	} else {
-		// Update existing balance record
-		update := bson.M{
-			"$inc": bson.M{
-				"totalIncome": amount,
-				"netBalance":  amount,
-			},
-			"$set": bson.M{
-				"lastUpdated": time.Now(),
-			},
-		}
-		_, err = balanceCollection.UpdateOne(ctx, bson.M{"_id": balance.ID}, update)
-		if err != nil {
-			return fmt.Errorf("failed to update admin wallet balance: %w", err)
-		}
+		return err
 	}
 
 	log.Printf("Sponsorship income added to admin wallet: $%.2f - %s", amount, description)
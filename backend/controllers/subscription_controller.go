@@ -3,6 +3,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -152,6 +154,8 @@ func (sc *SubscriptionController) GetSubscriptionPlans(c echo.Context) error {
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription plans retrieved successfully",
@@ -795,21 +799,496 @@ func (sc *SubscriptionController) sendAdminNotificationEmail(subject, body strin
 	return nil
 }
 
-// PauseSubscription pauses an active subscription
+// resolveSubscriptionTarget finds the branch or service provider the caller wants to manage.
+// Companies and wholesalers pass the branch in the :branchId path parameter.
+func (sc *SubscriptionController) resolveSubscriptionTarget(ctx context.Context, c echo.Context) (*services.SubscriptionTarget, error) {
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+	}
+
+	var kind string
+	switch claims.UserType {
+	case "company":
+		kind = services.SubscriptionKindCompanyBranch
+	case "wholesaler":
+		kind = services.SubscriptionKindWholesalerBranch
+	case "serviceProvider":
+		kind = services.SubscriptionKindServiceProvider
+	default:
+		return nil, c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: "Only companies, wholesalers and service providers can manage subscriptions",
+		})
+	}
+
+	var entityID primitive.ObjectID
+	if kind != services.SubscriptionKindServiceProvider {
+		entityID, err = primitive.ObjectIDFromHex(c.Param("branchId"))
+		if err != nil {
+			return nil, c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid branch ID",
+			})
+		}
+	}
+
+	subscriptionService := services.NewSubscriptionService(sc.DB)
+	target, err := subscriptionService.ResolveTarget(ctx, kind, userID, entityID)
+	if err != nil {
+		return nil, subscriptionErrorResponse(c, err)
+	}
+	return target, nil
+}
+
+// subscriptionErrorResponse maps subscription service errors to HTTP responses
+func subscriptionErrorResponse(c echo.Context, err error) error {
+	var transitionErr *models.SubscriptionTransitionError
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound), errors.Is(err, services.ErrSubscriptionEntityNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.As(err, &transitionErr), errors.Is(err, services.ErrPendingSubscriptionRequest), errors.Is(err, services.ErrAlreadyRefunded),
+		errors.Is(err, services.ErrPlanChangeSubscriptionEnded), errors.Is(err, services.ErrSubscriptionConcurrentUpdate):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidPaymentMethod), errors.Is(err, services.ErrSubscriptionPlanUnavailable), errors.Is(err, services.ErrInvalidSubscriptionKind),
+		errors.Is(err, services.ErrSamePlan), errors.Is(err, services.ErrInvalidPlanChangeTiming), errors.Is(err, services.ErrTrialPlanChange):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Subscription operation failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process subscription: " + err.Error(),
+		})
+	}
+}
+
+// entitlementErrorResponse maps a failed entitlement check to an HTTP response
+func entitlementErrorResponse(c echo.Context, err error) error {
+	var entitlementErr *models.EntitlementError
+	if errors.As(err, &entitlementErr) {
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: entitlementErr.Error(),
+			Data: map[string]interface{}{
+				"feature": entitlementErr.Feature,
+				"limit":   entitlementErr.Limit,
+			},
+		})
+	}
+	log.Printf("Failed to check plan entitlements: %v", err)
+	return c.JSON(http.StatusInternalServerError, models.Response{
+		Status:  http.StatusInternalServerError,
+		Message: "Failed to check subscription plan entitlements",
+	})
+}
+
+// promoCodeErrorResponse maps a promo code that cannot be used to an HTTP response
+func promoCodeErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrPromoCodeNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrPromoCodeNotValid), errors.Is(err, services.ErrPromoCodeNotApplicable), errors.Is(err, services.ErrPromoCodeNotEligible):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrPromoCodeExhausted), errors.Is(err, services.ErrPromoCodeAccountLimit):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Failed to apply promo code: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to apply promo code",
+		})
+	}
+}
+
+// trialErrorResponse maps a free trial that cannot be granted or converted to an HTTP response
+func trialErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrTrialNotFound):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrTrialNotOffered), errors.Is(err, services.ErrSubscriptionPlanUnavailable):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrTrialAlreadyUsed):
+		return c.JSON(http.StatusConflict, models.Response{
+			Status:  http.StatusConflict,
+			Message: err.Error(),
+		})
+	default:
+		return subscriptionErrorResponse(c, err)
+	}
+}
+
+// whishCallbackErrorResponse maps a failed Whish success callback to the plain-text response Whish expects.
+// Requests whose payment Whish reports as failed are marked as failed; pending ones are left for the reconciler.
+func whishCallbackErrorResponse(ctx context.Context, c echo.Context, err error, requests *mongo.Collection, requestID primitive.ObjectID) error {
+	switch {
+	case errors.Is(err, services.ErrPaymentAlreadyProcessed):
+		log.Printf("Payment already processed for request: %s", requestID.Hex())
+		return c.String(http.StatusOK, "Payment already processed")
+	case errors.Is(err, services.ErrPaymentFailed):
+		log.Printf("Payment failed for request %s", requestID.Hex())
+		result, err := requests.UpdateOne(ctx,
+			bson.M{"_id": requestID, "paymentStatus": "pending"},
+			bson.M{"$set": bson.M{
+				"paymentStatus": "failed",
+				"status":        "failed",
+				"processedAt":   time.Now(),
+			}})
+		if err != nil {
+			log.Printf("Failed to mark request %s as failed: %v", requestID.Hex(), err)
+		} else if result.ModifiedCount > 0 {
+			if err := services.NewPromoCodeService(requests.Database()).Release(ctx, requestID); err != nil {
+				log.Printf("Failed to release promo code of request %s: %v", requestID.Hex(), err)
+			}
+		}
+		return c.String(http.StatusBadRequest, "Payment not successful")
+	case errors.Is(err, services.ErrPaymentNotConfirmed):
+		// Left pending: the reconciler activates or closes it once Whish reports an outcome
+		log.Printf("Payment not confirmed yet for request %s: %v", requestID.Hex(), err)
+		return c.String(http.StatusAccepted, "Payment pending")
+	case errors.Is(err, services.ErrPlanChangeSubscriptionEnded):
+		log.Printf("Plan change request %s was paid after its subscription ended, recorded for review", requestID.Hex())
+		return c.String(http.StatusConflict, "Subscription no longer running, payment recorded for review")
+	case errors.Is(err, services.ErrPaymentAmountMismatch):
+		log.Printf("Payment amount mismatch for request %s, recorded for review", requestID.Hex())
+		return c.String(http.StatusConflict, "Payment amount does not match the request")
+	default:
+		log.Printf("Failed to confirm payment for request %s: %v", requestID.Hex(), err)
+		return c.String(http.StatusInternalServerError, "Failed to activate payment")
+	}
+}
+
+// releasePromoCode gives back the promo code use of the subscription request paid with a failed Whish payment
+func releasePromoCode(ctx context.Context, requests *mongo.Collection, externalID int64) {
+	var request struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := requests.FindOne(ctx, bson.M{"externalId": externalID}).Decode(&request); err != nil {
+		return
+	}
+	if err := services.NewPromoCodeService(requests.Database()).Release(ctx, request.ID); err != nil {
+		log.Printf("Failed to release promo code of request %s: %v", request.ID.Hex(), err)
+	}
+}
+
+// recordUnknownWhishCallback records a success callback whose externalId matches no request
+func recordUnknownWhishCallback(ctx context.Context, c echo.Context, db *mongo.Database, kind string, externalID int64) {
+	services.NewWhishCallbackService(db).RecordAnomaly(ctx, services.WhishCallback{
+		Kind:       kind,
+		ExternalID: externalID,
+		RemoteAddr: c.RealIP(),
+	}, services.AnomalyUnknownExternalID, 0, 0, "")
+}
+
+// WhishActivators returns the activation of each kind of Whish payment, used by the reconciler
+// for requests whose success callback never arrived
+func WhishActivators(db *mongo.Database) map[string]services.WhishActivator {
+	return map[string]services.WhishActivator{
+		services.SubscriptionKindCompanyBranch: func(ctx context.Context, requestID primitive.ObjectID, payerPhone string) error {
+			var request models.BranchSubscriptionRequest
+			if err := db.Collection("branch_subscription_requests").FindOne(ctx, bson.M{"_id": requestID}).Decode(&request); err != nil {
+				return err
+			}
+			return NewBranchSubscriptionController(db).activateBranchSubscription(ctx, request, payerPhone)
+		},
+		services.SubscriptionKindWholesalerBranch: func(ctx context.Context, requestID primitive.ObjectID, payerPhone string) error {
+			var request models.WholesalerBranchSubscriptionRequest
+			if err := db.Collection("wholesaler_branch_subscription_requests").FindOne(ctx, bson.M{"_id": requestID}).Decode(&request); err != nil {
+				return err
+			}
+			return NewWholesalerBranchSubscriptionController(db).activateWholesalerBranchSubscription(ctx, request, payerPhone)
+		},
+		services.SubscriptionKindServiceProvider: func(ctx context.Context, requestID primitive.ObjectID, payerPhone string) error {
+			var request models.SubscriptionRequest
+			if err := db.Collection("subscription_requests").FindOne(ctx, bson.M{"_id": requestID}).Decode(&request); err != nil {
+				return err
+			}
+			return NewServiceProviderSubscriptionController(db).activateServiceProviderSubscription(ctx, request, payerPhone)
+		},
+		services.WhishPaymentKindSponsorship: func(ctx context.Context, requestID primitive.ObjectID, payerPhone string) error {
+			var request models.SponsorshipSubscriptionRequest
+			if err := db.Collection("sponsorship_subscription_requests").FindOne(ctx, bson.M{"_id": requestID}).Decode(&request); err != nil {
+				return err
+			}
+			_, err := NewSponsorshipSubscriptionController(db).activatePaidSponsorship(ctx, request, payerPhone)
+			return err
+		},
+	}
+}
+
+// PauseSubscription pauses an active subscription and freezes its remaining time
 func (sc *SubscriptionController) PauseSubscription(c echo.Context) error {
-	// TODO: Implement pausing subscription logic
-	return c.JSON(http.StatusNotImplemented, models.Response{
-		Status:  http.StatusNotImplemented,
-		Message: "Pausing subscription not implemented yet",
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	subscription, err := services.NewSubscriptionService(sc.DB).Pause(ctx, target)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Subscription paused successfully",
+		Data:    subscription,
+	})
+}
+
+// ResumeSubscription resumes a paused subscription, extending its end date by the paused time
+func (sc *SubscriptionController) ResumeSubscription(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	subscription, err := services.NewSubscriptionService(sc.DB).Resume(ctx, target)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Subscription resumed successfully",
+		Data:    subscription,
 	})
 }
 
-// RenewSubscription renews an expired or paused subscription
+// RenewSubscription creates a new subscription request for the plan of an expired subscription
 func (sc *SubscriptionController) RenewSubscription(c echo.Context) error {
-	// TODO: Implement renewing subscription logic
-	return c.JSON(http.StatusNotImplemented, models.Response{
-		Status:  http.StatusNotImplemented,
-		Message: "Renewing subscription not implemented yet",
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	var req struct {
+		PaymentMethod string `json:"paymentMethod" form:"paymentMethod"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+
+	result, err := services.NewSubscriptionService(sc.DB).Renew(ctx, target, req.PaymentMethod)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	message := "Renewal request submitted successfully. Awaiting admin approval."
+	if result.PaymentMethod == "whish" {
+		message = "Renewal request created. Please complete payment using the provided URL."
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// SetAutoRenew turns automatic renewal on or off for the caller's current subscription
+func (sc *SubscriptionController) SetAutoRenew(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	var req struct {
+		AutoRenew *bool `json:"autoRenew" form:"autoRenew"`
+	}
+	if err := c.Bind(&req); err != nil || req.AutoRenew == nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "autoRenew (true or false) is required",
+		})
+	}
+
+	subscription, err := services.NewSubscriptionService(sc.DB).SetAutoRenew(ctx, target, *req.AutoRenew)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	message := "Auto-renew disabled"
+	if subscription.AutoRenew {
+		message = "Auto-renew enabled. You will receive a payment link before your subscription ends."
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+		Data:    subscription,
+	})
+}
+
+// ChangePlan moves the caller's active subscription to another plan, immediately with a prorated credit
+// for the unused days of the current plan, or at the end of the current period
+func (sc *SubscriptionController) ChangePlan(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	var req struct {
+		PlanID        string `json:"planId" form:"planId"`
+		PaymentMethod string `json:"paymentMethod" form:"paymentMethod"`
+		Timing        string `json:"timing" form:"timing"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	planID, err := primitive.ObjectIDFromHex(req.PlanID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid plan ID",
+		})
+	}
+
+	claims := middleware.GetUserFromToken(c)
+	requestedBy, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	result, err := services.NewSubscriptionService(sc.DB).ChangePlan(ctx, target, planID, req.PaymentMethod, req.Timing, requestedBy)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	message := "Plan changed successfully"
+	switch {
+	case result.Quote.Timing == services.PlanChangePeriodEnd:
+		message = "Plan change scheduled for the end of the current period."
+		if result.Request != nil && result.Request.PaymentMethod == "whish" {
+			message += " Please complete payment using the provided URL."
+		}
+	case result.Request != nil && result.Request.PaymentMethod == "whish":
+		message = "Plan change created. Please complete payment of the difference using the provided URL."
+	case result.Request != nil:
+		message = "Plan change request submitted successfully. Awaiting admin approval."
+	case result.Refund != nil:
+		message = "Plan changed successfully. The unused credit has been refunded."
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// ConvertTrial creates the paid subscription request that continues the caller's free trial,
+// on the trialled plan or the plan given in planId. The paid period starts when the trial ends.
+func (sc *SubscriptionController) ConvertTrial(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target, err := sc.resolveSubscriptionTarget(ctx, c)
+	if target == nil {
+		return err
+	}
+
+	var req struct {
+		PlanID        string `json:"planId" form:"planId"`
+		PaymentMethod string `json:"paymentMethod" form:"paymentMethod"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	var planID primitive.ObjectID
+	if req.PlanID != "" {
+		planID, err = primitive.ObjectIDFromHex(req.PlanID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid plan ID",
+			})
+		}
+	}
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = "whish"
+	}
+
+	result, err := services.NewTrialService(sc.DB).Convert(ctx, target, planID, req.PaymentMethod)
+	if err != nil {
+		return trialErrorResponse(c, err)
+	}
+
+	message := "Subscription request submitted successfully. Awaiting admin approval."
+	if result.PaymentMethod == "whish" {
+		message = "Subscription request created. Please complete payment using the provided URL."
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// processPlanChangeRequest applies or rejects a cash plan change request on admin approval
+func processPlanChangeRequest(ctx context.Context, c echo.Context, db *mongo.Database, kind string, requestID primitive.ObjectID, status string) error {
+	subscriptionService := services.NewSubscriptionService(db)
+	var err error
+	if status == "approved" {
+		err = subscriptionService.ApplyPlanChange(ctx, kind, requestID)
+	} else {
+		err = subscriptionService.RejectPlanChange(ctx, kind, requestID)
+	}
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: fmt.Sprintf("Plan change request %s successfully", status),
 	})
 }
 
@@ -1060,6 +1539,35 @@ func (sc *SubscriptionController) CreateSubscriptionPlan(c echo.Context) error {
 		})
 	}
 
+	if req.TrialDays < 0 || req.TrialDays > 90 {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid trialDays. Must be between 0 and 90",
+		})
+	}
+
+	req.Currency = models.PriceCurrency(req.Currency)
+	if !models.ValidCurrency(req.Currency) {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid currency. Must be one of: USD, LBP",
+		})
+	}
+
+	// Validate entitlements
+	if req.Entitlements == nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Entitlements are required",
+		})
+	}
+	if err := req.Entitlements.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	}
+
 	var plans []models.SubscriptionPlan
 
 	// Create plans based on type
@@ -1067,41 +1575,50 @@ func (sc *SubscriptionController) CreateSubscriptionPlan(c echo.Context) error {
 		// Create single plan for service provider
 		plans = []models.SubscriptionPlan{
 			{
-				ID:        primitive.NewObjectID(),
-				Title:     req.Title,
-				Price:     req.Price,
-				Duration:  req.Duration,
-				Type:      "serviceProvider",
-				Benefits:  models.Benefits{Value: req.Benefits},
-				IsActive:  req.IsActive,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+				ID:           primitive.NewObjectID(),
+				Title:        req.Title,
+				Price:        req.Price,
+				Currency:     req.Currency,
+				Duration:     req.Duration,
+				Type:         "serviceProvider",
+				Benefits:     models.Benefits{Value: req.Benefits},
+				Entitlements: req.Entitlements,
+				TrialDays:    req.TrialDays,
+				IsActive:     req.IsActive,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
 			},
 		}
 	} else {
 		// Create plans for both company and wholesaler
 		plans = []models.SubscriptionPlan{
 			{
-				ID:        primitive.NewObjectID(),
-				Title:     req.Title,
-				Price:     req.Price,
-				Duration:  req.Duration,
-				Type:      "company",
-				Benefits:  models.Benefits{Value: req.Benefits},
-				IsActive:  req.IsActive,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+				ID:           primitive.NewObjectID(),
+				Title:        req.Title,
+				Price:        req.Price,
+				Currency:     req.Currency,
+				Duration:     req.Duration,
+				Type:         "company",
+				Benefits:     models.Benefits{Value: req.Benefits},
+				Entitlements: req.Entitlements,
+				TrialDays:    req.TrialDays,
+				IsActive:     req.IsActive,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
 			},
 			{
-				ID:        primitive.NewObjectID(),
-				Title:     req.Title,
-				Price:     req.Price,
-				Duration:  req.Duration,
-				Type:      "wholesaler",
-				Benefits:  models.Benefits{Value: req.Benefits},
-				IsActive:  req.IsActive,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+				ID:           primitive.NewObjectID(),
+				Title:        req.Title,
+				Price:        req.Price,
+				Currency:     req.Currency,
+				Duration:     req.Duration,
+				Type:         "wholesaler",
+				Benefits:     models.Benefits{Value: req.Benefits},
+				Entitlements: req.Entitlements,
+				TrialDays:    req.TrialDays,
+				IsActive:     req.IsActive,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
 			},
 		}
 	}
@@ -1183,18 +1700,46 @@ func (sc *SubscriptionController) UpdateSubscriptionPlan(c echo.Context) error {
 		})
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"title":     req.Title,
-			"price":     req.Price,
-			"duration":  req.Duration,
-			"type":      req.Type,
-			"benefits":  req.Benefits,
-			"isActive":  req.IsActive,
-			"updatedAt": time.Now(),
-		},
+	if req.TrialDays < 0 || req.TrialDays > 90 {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid trialDays. Must be between 0 and 90",
+		})
 	}
 
+	req.Currency = models.PriceCurrency(req.Currency)
+	if !models.ValidCurrency(req.Currency) {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid currency. Must be one of: USD, LBP",
+		})
+	}
+
+	set := bson.M{
+		"title":     req.Title,
+		"price":     req.Price,
+		"currency":  req.Currency,
+		"duration":  req.Duration,
+		"type":      req.Type,
+		"benefits":  req.Benefits,
+		"trialDays": req.TrialDays,
+		"isActive":  req.IsActive,
+		"updatedAt": time.Now(),
+	}
+
+	// Entitlements are optional on update; plans keep their current ones when omitted
+	if req.Entitlements != nil {
+		if err := req.Entitlements.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+			})
+		}
+		set["entitlements"] = req.Entitlements
+	}
+
+	update := bson.M{"$set": set}
+
 	result, err := sc.DB.Collection("subscription_plans").UpdateOne(
 		context.Background(),
 		bson.M{"_id": id},
@@ -1290,6 +1835,8 @@ func (sc *SubscriptionController) GetServiceProviderSubscriptionPlans(c echo.Con
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Service provider subscription plans retrieved successfully",
@@ -1332,6 +1879,8 @@ func (sc *SubscriptionController) GetWholesalerPlans(c echo.Context) error {
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Wholesaler subscription plans retrieved successfully",
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/middleware"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/HSouheill/barrim_backend/utils"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TerritoryController handles salesperson territories and the coverage report
+type TerritoryController struct {
+	DB *mongo.Database
+}
+
+// NewTerritoryController creates a new territory controller
+func NewTerritoryController(db *mongo.Database) *TerritoryController {
+	return &TerritoryController{DB: db}
+}
+
+// territoryErrorResponse maps territory service errors to HTTP responses
+func territoryErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrTerritoryNotFound), errors.Is(err, services.ErrTerritorySalesperson):
+		return c.JSON(http.StatusNotFound, models.Response{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrOutsideTerritory):
+		return c.JSON(http.StatusForbidden, models.Response{
+			Status:  http.StatusForbidden,
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrTerritoryEmpty), errors.Is(err, services.ErrUnknownGovernorate), errors.Is(err, services.ErrUnknownDistrict), errors.Is(err, services.ErrTerritoryPolygonShape):
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+		})
+	default:
+		log.Printf("Territory request failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to process territory request",
+		})
+	}
+}
+
+// bindTerritory binds and validates a territory request body
+func bindTerritory(c echo.Context) (*models.TerritoryRequest, error) {
+	var req models.TerritoryRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Validation failed: " + err.Error(),
+		})
+	}
+	return &req, nil
+}
+
+// territoryID parses the :id path parameter
+func territoryID(c echo.Context) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return primitive.NilObjectID, c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid territory ID",
+		})
+	}
+	return id, nil
+}
+
+// GetTerritories lists the territories, optionally of one salesperson (admin only)
+func (tc *TerritoryController) GetTerritories(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if id := c.QueryParam("salespersonId"); id != "" {
+		salespersonID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid salesperson ID",
+			})
+		}
+		filter["salespersonId"] = salespersonID
+	}
+	territories, err := services.NewTerritoryService(tc.DB).List(ctx, filter)
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Territories retrieved successfully",
+		Data:    territories,
+	})
+}
+
+// GetLebanonDistricts lists the governorates and districts territories can be made of
+func (tc *TerritoryController) GetLebanonDistricts(c echo.Context) error {
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Governorates retrieved successfully",
+		Data:    utils.LebanonDistricts,
+	})
+}
+
+// CreateTerritory defines a territory and optionally assigns it to a salesperson (admin only)
+func (tc *TerritoryController) CreateTerritory(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := bindTerritory(c)
+	if req == nil {
+		return err
+	}
+	claims := middleware.GetUserFromToken(c)
+	adminID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	territory, err := services.NewTerritoryService(tc.DB).Create(ctx, *req, adminID)
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, models.Response{
+		Status:  http.StatusCreated,
+		Message: "Territory created successfully",
+		Data:    territory,
+	})
+}
+
+// UpdateTerritory replaces the areas, salesperson and status of a territory (admin only)
+func (tc *TerritoryController) UpdateTerritory(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := territoryID(c)
+	if id.IsZero() {
+		return err
+	}
+	req, err := bindTerritory(c)
+	if req == nil {
+		return err
+	}
+	territory, err := services.NewTerritoryService(tc.DB).Update(ctx, id, *req)
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Territory updated successfully",
+		Data:    territory,
+	})
+}
+
+// DeleteTerritory removes a territory (admin only)
+func (tc *TerritoryController) DeleteTerritory(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := territoryID(c)
+	if id.IsZero() {
+		return err
+	}
+	if err := services.NewTerritoryService(tc.DB).Delete(ctx, id); err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Territory deleted successfully",
+	})
+}
+
+// GetTerritoryCoverage reports the businesses, subscription penetration and open leads of every territory (admin only)
+func (tc *TerritoryController) GetTerritoryCoverage(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := services.NewTerritoryService(tc.DB).Coverage(ctx)
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Territory coverage retrieved successfully",
+		Data:    report,
+	})
+}
+
+// GetMyTerritories lists the active territories of the authenticated salesperson
+func (tc *TerritoryController) GetMyTerritories(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims := middleware.GetUserFromToken(c)
+	salespersonID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, models.Response{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid user ID",
+		})
+	}
+	territories, err := services.NewTerritoryService(tc.DB).List(ctx, bson.M{"salespersonId": salespersonID, "active": true})
+	if err != nil {
+		return territoryErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, models.Response{
+		Status:  http.StatusOK,
+		Message: "Territories retrieved successfully",
+		Data: map[string]interface{}{
+			"territories": territories,
+			"enforcement": services.TerritoryEnforcement(),
+		},
+	})
+}
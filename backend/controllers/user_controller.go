@@ -3,6 +3,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,6 +26,7 @@ import (
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
 	"github.com/HSouheill/barrim_backend/repositories"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/HSouheill/barrim_backend/utils"
 )
 
@@ -860,10 +862,11 @@ func (uc *UserController) UpdateAvailability(c echo.Context) error {
 		})
 	}
 
-	// Parse request body
+	// Parse request body: a structured schedule, or the legacy day and hour strings
 	var availabilityReq struct {
-		AvailableDays  []string `json:"availableDays"`
-		AvailableHours []string `json:"availableHours"`
+		Schedule       *models.AvailabilitySchedule `json:"schedule"`
+		AvailableDays  []string                     `json:"availableDays"`
+		AvailableHours []string                     `json:"availableHours"`
 	}
 
 	if err := c.Bind(&availabilityReq); err != nil {
@@ -873,11 +876,34 @@ func (uc *UserController) UpdateAvailability(c echo.Context) error {
 		})
 	}
 
+	availability := services.NewAvailabilityService(uc.DB.Database("barrim"))
+	if availabilityReq.Schedule != nil {
+		schedule, err := availability.Save(ctx, "users", bson.M{"_id": userID}, *availabilityReq.Schedule)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidSchedule) {
+				return c.JSON(http.StatusBadRequest, models.Response{
+					Status:  http.StatusBadRequest,
+					Message: err.Error(),
+				})
+			}
+			log.Printf("Failed to save availability schedule: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to update availability",
+			})
+		}
+		return c.JSON(http.StatusOK, models.Response{
+			Status:  http.StatusOK,
+			Message: "Availability updated successfully",
+			Data:    schedule,
+		})
+	}
+
 	// Validate availability data
 	if len(availabilityReq.AvailableDays) == 0 || len(availabilityReq.AvailableHours) == 0 {
 		return c.JSON(http.StatusBadRequest, models.Response{
 			Status:  http.StatusBadRequest,
-			Message: "Available days and hours are required",
+			Message: "A schedule, or available days and hours, are required",
 		})
 	}
 
@@ -906,6 +932,11 @@ func (uc *UserController) UpdateAvailability(c echo.Context) error {
 		})
 	}
 
+	// The schedule stays the source of truth: rebuild it from the strings just stored
+	if err := availability.SyncFromLegacy(ctx, "users", bson.M{"_id": userID}); err != nil {
+		log.Printf("Failed to update availability schedule: %v", err)
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Availability updated successfully",
@@ -952,6 +983,20 @@ func (uc *UserController) SearchServiceProviders(c echo.Context) error {
 		filter["location.country"] = country
 	}
 
+	// availableOn=YYYY-MM-DD keeps the providers whose schedule is open that day
+	if availableOn := c.QueryParam("availableOn"); availableOn != "" {
+		date, err := time.Parse("2006-01-02", availableOn)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid availableOn date. Use YYYY-MM-DD",
+			})
+		}
+		for key, value := range services.AvailableOnFilter("serviceProviderInfo.schedule", date) {
+			filter[key] = value
+		}
+	}
+
 	// Set up options to exclude password field and apply pagination
 	opts := options.Find().
 		SetProjection(bson.M{"password": 0}).
@@ -15,6 +15,7 @@ import (
 	"github.com/HSouheill/barrim_backend/config"
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -319,6 +320,18 @@ func (wc *WholesalerController) CreateBranch(c echo.Context) error {
 		})
 	}
 
+	// Check the new branch and its media against the wholesaler's plan
+	entitlements, err := services.NewEntitlementService(wc.DB.Database("barrim")).ForWholesaler(ctx, &wholesaler)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementBranches, len(wholesaler.Branches)+1)
+	}
+	if err == nil {
+		err = services.RequireBranchMedia(entitlements, len(form.File["images"]), len(form.File["videos"]))
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Handle file uploads
 	files := form.File["images"]
 	var imagePaths []string
@@ -556,6 +569,18 @@ func (wc *WholesalerController) AddBranch(c echo.Context) error {
 		})
 	}
 
+	// Check the new branch and its media against the wholesaler's plan
+	entitlements, err := services.NewEntitlementService(wc.DB.Database("barrim")).ForWholesaler(ctx, &wholesaler)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementBranches, len(wholesaler.Branches)+1)
+	}
+	if err == nil {
+		err = services.RequireBranchMedia(entitlements, len(form.File["images"]), len(form.File["videos"]))
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Handle file uploads
 	files := form.File["images"]
 	var imagePaths []string
@@ -1117,6 +1142,15 @@ func (wc *WholesalerController) UpdateBranch(c echo.Context) error {
 		})
 	}
 
+	// Check the replacement media against the wholesaler's plan
+	entitlements, err := services.NewEntitlementService(wc.DB.Database("barrim")).ForWholesaler(ctx, &wholesaler)
+	if err == nil {
+		err = services.RequireBranchMedia(entitlements, len(form.File["images"]), len(form.File["videos"]))
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Handle new image uploads
 	files := form.File["images"]
 	var newImagePaths []string
@@ -73,6 +73,8 @@ func (wsc *WholesalerSubscriptionController) GetAvailablePlans(c echo.Context) e
 		})
 	}
 
+	services.NewExchangeRateService(wsc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription plans retrieved successfully",
@@ -279,6 +281,8 @@ func (sc *SubscriptionController) GetWholesalerSubscriptionPlans(c echo.Context)
 		})
 	}
 
+	services.NewExchangeRateService(sc.DB).DisplayPlans(ctx, plans)
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Wholesaler subscription plans retrieved successfully",
@@ -546,69 +550,28 @@ func (sc *SubscriptionController) ApproveWholesalerSubscriptionRequest(c echo.Co
 		}
 	}
 
-	// --- Commission logic start ---
-	wholesalerCollection := sc.DB.Collection("wholesalers")
-	// Get wholesaler details
+	// Record the commission of the salesperson who created the wholesaler
 	var wholesaler models.Wholesaler
-	if err := wholesalerCollection.FindOne(ctx, bson.M{"_id": request.WholesalerID}).Decode(&wholesaler); err == nil {
-		if !wholesaler.CreatedBy.IsZero() {
-			// Get salesperson
-			var salesperson models.Salesperson
-			err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": wholesaler.CreatedBy}).Decode(&salesperson)
-			if err == nil {
-				// Get admin who created the salesperson
-				var admin models.Admin
-				err := sc.DB.Collection("admins").FindOne(ctx, bson.M{"_id": salesperson.CreatedBy}).Decode(&admin)
-				if err == nil {
-					// Get plan details
-					var plan models.SubscriptionPlan
-					err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-					if err == nil {
-						planPrice := plan.Price
-						salespersonPercent := salesperson.CommissionPercent
-
-						// Calculate admin commission (remaining percentage after salesperson commission)
-						adminPercent := 100.0 - salespersonPercent
-
-						// Calculate commissions correctly
-						// Salesperson gets their percentage directly from the plan price
-						salespersonCommission := planPrice * salespersonPercent / 100.0
-						// Admin gets the remaining percentage
-						adminCommission := planPrice * adminPercent / 100.0
-
-						// Insert commission documents
-						commissionCollection := sc.DB.Collection("commissions")
-						commissionDocs := []interface{}{
-							models.Commission{
-								ID:                           primitive.NewObjectID(),
-								SubscriptionID:               request.ID,
-								CompanyID:                    primitive.NilObjectID,
-								PlanID:                       plan.ID,
-								PlanPrice:                    planPrice,
-								AdminID:                      admin.ID,
-								AdminCommission:              adminCommission,
-								AdminCommissionPercent:       adminPercent,
-								SalespersonID:                salesperson.ID,
-								SalespersonCommission:        salespersonCommission,
-								SalespersonCommissionPercent: salespersonPercent,
-								CreatedAt:                    time.Now(),
-								Paid:                         false,
-								PaidAt:                       nil,
-							},
-						}
-						_, err := commissionCollection.InsertMany(ctx, commissionDocs)
-						if err != nil {
-							log.Printf("Failed to insert commission docs: %v", err)
-						} else {
-							log.Printf("Commission inserted successfully - Plan Price: $%.2f, Admin Commission: $%.2f (%.1f%%), Salesperson Commission: $%.2f (%.1f%%)\n",
-								planPrice, adminCommission, adminPercent, salespersonCommission, salespersonPercent)
-						}
-					}
-				}
-			}
+	var plan models.SubscriptionPlan
+	if err := sc.DB.Collection("wholesalers").FindOne(ctx, bson.M{"_id": request.WholesalerID}).Decode(&wholesaler); err != nil {
+		log.Printf("Failed to get wholesaler for commission: %v", err)
+	} else if err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+		log.Printf("Failed to get plan for commission: %v", err)
+	} else if wholesaler.CreatedBy != wholesaler.UserID {
+		_, err := services.NewCommissionService(sc.DB).Record(ctx, services.CommissionSale{
+			SubscriptionID: request.ID,
+			BusinessID:     wholesaler.ID,
+			BusinessName:   wholesaler.BusinessName,
+			CreatedBy:      wholesaler.CreatedBy,
+			Plan:           plan,
+			Amount:         plan.Price,
+			Category:       wholesaler.Category,
+			Region:         wholesaler.ContactInfo.Address.Governorate,
+		})
+		if err != nil {
+			log.Printf("Failed to record commission: %v", err)
 		}
 	}
-	// --- Commission logic end ---
 
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
@@ -744,69 +707,28 @@ func (sc *SubscriptionController) ApproveWholesalerSubscriptionRequestByManager(
 		}
 	}
 
-	// --- Commission logic start ---
-	wholesalerCollection := sc.DB.Collection("wholesalers")
-	// Get wholesaler details
+	// Record the commission of the salesperson who created the wholesaler
 	var wholesaler models.Wholesaler
-	if err := wholesalerCollection.FindOne(ctx, bson.M{"_id": request.WholesalerID}).Decode(&wholesaler); err == nil {
-		if !wholesaler.CreatedBy.IsZero() {
-			// Get salesperson
-			var salesperson models.Salesperson
-			err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": wholesaler.CreatedBy}).Decode(&salesperson)
-			if err == nil {
-				// Get admin who created the salesperson
-				var admin models.Admin
-				err := sc.DB.Collection("admins").FindOne(ctx, bson.M{"_id": salesperson.CreatedBy}).Decode(&admin)
-				if err == nil {
-					// Get plan details
-					var plan models.SubscriptionPlan
-					err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan)
-					if err == nil {
-						planPrice := plan.Price
-						salespersonPercent := salesperson.CommissionPercent
-
-						// Calculate admin commission (remaining percentage after salesperson commission)
-						adminPercent := 100.0 - salespersonPercent
-
-						// Calculate commissions correctly
-						// Salesperson gets their percentage directly from the plan price
-						salespersonCommission := planPrice * salespersonPercent / 100.0
-						// Admin gets the remaining percentage
-						adminCommission := planPrice * adminPercent / 100.0
-
-						// Insert commission documents
-						commissionCollection := sc.DB.Collection("commissions")
-						commissionDocs := []interface{}{
-							models.Commission{
-								ID:                           primitive.NewObjectID(),
-								SubscriptionID:               request.ID,
-								CompanyID:                    primitive.NilObjectID,
-								PlanID:                       plan.ID,
-								PlanPrice:                    planPrice,
-								AdminID:                      admin.ID,
-								AdminCommission:              adminCommission,
-								AdminCommissionPercent:       adminPercent,
-								SalespersonID:                salesperson.ID,
-								SalespersonCommission:        salespersonCommission,
-								SalespersonCommissionPercent: salespersonPercent,
-								CreatedAt:                    time.Now(),
-								Paid:                         false,
-								PaidAt:                       nil,
-							},
-						}
-						_, err := commissionCollection.InsertMany(ctx, commissionDocs)
-						if err != nil {
-							log.Printf("Failed to insert commission docs: %v", err)
-						} else {
-							log.Printf("Commission inserted successfully - Plan Price: $%.2f, Admin Commission: $%.2f (%.1f%%), Salesperson Commission: $%.2f (%.1f%%)\n",
-								planPrice, adminCommission, adminPercent, salespersonCommission, salespersonPercent)
-						}
-					}
-				}
-			}
+	var plan models.SubscriptionPlan
+	if err := sc.DB.Collection("wholesalers").FindOne(ctx, bson.M{"_id": request.WholesalerID}).Decode(&wholesaler); err != nil {
+		log.Printf("Failed to get wholesaler for commission: %v", err)
+	} else if err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+		log.Printf("Failed to get plan for commission: %v", err)
+	} else if wholesaler.CreatedBy != wholesaler.UserID {
+		_, err := services.NewCommissionService(sc.DB).Record(ctx, services.CommissionSale{
+			SubscriptionID: request.ID,
+			BusinessID:     wholesaler.ID,
+			BusinessName:   wholesaler.BusinessName,
+			CreatedBy:      wholesaler.CreatedBy,
+			Plan:           plan,
+			Amount:         plan.Price,
+			Category:       wholesaler.Category,
+			Region:         wholesaler.ContactInfo.Address.Governorate,
+		})
+		if err != nil {
+			log.Printf("Failed to record commission: %v", err)
 		}
 	}
-	// --- Commission logic end ---
 
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
@@ -1050,12 +972,50 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 		PaymentMethod: paymentMethod,
 	}
 
+	// Plans set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(sc.DB).Lock(ctx, plan.Price, plan.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	pricedPlan := plan
+	pricedPlan.Price = conversion.AmountUSD
+	pricedPlan.Currency = models.CurrencyUSD
+
+	// Apply the promo code, if any, to the amount collected
+	promoCodeService := services.NewPromoCodeService(sc.DB)
+	promo, err := promoCodeService.Apply(ctx, c.FormValue("promoCode"), pricedPlan,
+		services.PromoAccount{ID: wholesaler.ID, BroughtInBy: wholesaler.CreatedBy},
+		services.SubscriptionKindWholesalerBranch, branch.ID, subscriptionRequest.ID)
+	if err != nil {
+		return promoCodeErrorResponse(c, err)
+	}
+	paymentAmount := pricedPlan.Price
+	if promo != nil {
+		paymentAmount = promo.Amount
+		subscriptionRequest.PromoCode = promo.Code
+		subscriptionRequest.Discount = promo.Discount
+		subscriptionRequest.Amount = promo.Amount
+	} else if conversion.OriginalCurrency != models.CurrencyUSD {
+		subscriptionRequest.Amount = paymentAmount
+	}
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate externalId from ObjectID (use timestamp part as int64)
-		externalID = int64(subscriptionRequest.ID.Timestamp().Unix())
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, sc.DB)
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -1074,11 +1034,11 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 			appURL = baseURL // Fallback to baseURL if APP_URL not set
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 			// Continue anyway - balance check failure doesn't block payment creation
@@ -1092,7 +1052,7 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &plan.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for subscription payments
 			Invoice:            fmt.Sprintf("Wholesaler Branch Subscription - %s - Plan: %s", branch.Name, plan.Title),
 			ExternalID:         &externalID,
@@ -1103,9 +1063,10 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
+			promoCodeService.Release(ctx, subscriptionRequest.ID)
 			return c.JSON(http.StatusInternalServerError, models.Response{
 				Status:  http.StatusInternalServerError,
 				Message: fmt.Sprintf("Failed to initiate payment: %v", err),
@@ -1126,6 +1087,7 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 	_, err = subscriptionRequestsCollection.InsertOne(ctx, subscriptionRequest)
 	if err != nil {
 		log.Printf("Failed to save subscription request: %v", err)
+		promoCodeService.Release(ctx, subscriptionRequest.ID)
 		return c.JSON(http.StatusInternalServerError, models.Response{
 			Status:  http.StatusInternalServerError,
 			Message: "Failed to create subscription request",
@@ -1138,9 +1100,12 @@ func (sc *WholesalerBranchSubscriptionController) CreateBranchSubscriptionReques
 		"plan":          plan,
 		"status":        subscriptionRequest.Status,
 		"submittedAt":   subscriptionRequest.RequestedAt,
-		"paymentAmount": plan.Price,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
+	if promo != nil {
+		responseData["promo"] = promo
+	}
 
 	if paymentMethod == "whish" {
 		responseData["collectUrl"] = collectURL
@@ -1184,6 +1149,7 @@ func (sc *WholesalerBranchSubscriptionController) HandleWhishPaymentSuccess(c ec
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("Subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, sc.DB, services.SubscriptionKindWholesalerBranch, externalID)
 			return c.String(http.StatusNotFound, "Subscription request not found")
 		}
 		log.Printf("Error finding subscription request: %v", err)
@@ -1196,32 +1162,19 @@ func (sc *WholesalerBranchSubscriptionController) HandleWhishPaymentSuccess(c ec
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	if status != "success" {
-		log.Printf("Payment not successful, status: %s", status)
-		// Update request status to failed
-		subscriptionRequestsCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - proceed to activate subscription
-	err = sc.activateWholesalerBranchSubscription(ctx, subscriptionRequest, phoneNumber)
+	// Re-confirm the payment with Whish and activate it exactly once
+	err = services.NewWhishCallbackService(sc.DB).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:       services.SubscriptionKindWholesalerBranch,
+		ExternalID: externalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+		RemoteAddr: c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		return sc.activateWholesalerBranchSubscription(ctx, subscriptionRequest, payerPhone)
+	})
 	if err != nil {
-		log.Printf("Failed to activate subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
+		return whishCallbackErrorResponse(ctx, c, err, subscriptionRequestsCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("Wholesaler branch subscription activated successfully for externalId: %d", externalID)
@@ -1258,12 +1211,37 @@ func (sc *WholesalerBranchSubscriptionController) HandleWhishPaymentFailure(c ec
 		return c.String(http.StatusInternalServerError, "Failed to update status")
 	}
 
+	releasePromoCode(ctx, subscriptionRequestsCollection, externalID)
+
 	log.Printf("Payment failed for externalId: %d", externalID)
 	return c.String(http.StatusOK, "Payment failure recorded")
 }
 
-// activateWholesalerBranchSubscription activates the subscription after successful payment
+// activateWholesalerBranchSubscription activates the subscription after successful payment.
+// The Whish payment is applied at most once; a replay returns services.ErrPaymentAlreadyProcessed.
 func (sc *WholesalerBranchSubscriptionController) activateWholesalerBranchSubscription(ctx context.Context, subscriptionRequest models.WholesalerBranchSubscriptionRequest, payerPhone string) error {
+	payment := services.WhishCallback{
+		Kind:       services.SubscriptionKindWholesalerBranch,
+		ExternalID: subscriptionRequest.ExternalID,
+		RequestID:  subscriptionRequest.ID,
+		PlanID:     subscriptionRequest.PlanID,
+		Amount:     subscriptionRequest.Amount,
+	}
+	return services.NewWhishCallbackService(sc.DB).ActivateOnce(ctx, payment, payerPhone, func(sessCtx mongo.SessionContext) error {
+		return sc.applyWholesalerBranchSubscription(sessCtx, subscriptionRequest)
+	})
+}
+
+// applyWholesalerBranchSubscription creates the subscription, activates the entity and books the payment
+func (sc *WholesalerBranchSubscriptionController) applyWholesalerBranchSubscription(ctx context.Context, subscriptionRequest models.WholesalerBranchSubscriptionRequest) error {
+	// Plan changes replace the running subscription instead of starting a new one
+	if subscriptionRequest.PlanChangeOf != nil {
+		return services.NewSubscriptionService(sc.DB).ApplyPlanChange(ctx, services.SubscriptionKindWholesalerBranch, subscriptionRequest.ID)
+	}
+
+	// Wallet, commission and invoice records use the exchange rate locked with the request
+	ctx = services.WithLockedRate(ctx, subscriptionRequest.CurrencyConversion)
+
 	// Get plan details
 	var plan models.SubscriptionPlan
 	err := sc.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscriptionRequest.PlanID}).Decode(&plan)
@@ -1308,8 +1286,8 @@ func (sc *WholesalerBranchSubscriptionController) activateWholesalerBranchSubscr
 		return fmt.Errorf("branch not found")
 	}
 
-	// Calculate subscription dates
-	startDate := time.Now()
+	// Calculate subscription dates (renewals continue from the end of the renewed subscription)
+	startDate, autoRenew := services.NewSubscriptionService(sc.DB).RenewalPeriod(ctx, services.SubscriptionKindWholesalerBranch, subscriptionRequest.RenewalOf)
 	var endDate time.Time
 	switch plan.Duration {
 	case 1: // Monthly
@@ -1332,7 +1310,7 @@ func (sc *WholesalerBranchSubscriptionController) activateWholesalerBranchSubscr
 		StartDate: startDate,
 		EndDate:   endDate,
 		Status:    "active",
-		AutoRenew: false,
+		AutoRenew: autoRenew,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -1375,49 +1353,10 @@ func (sc *WholesalerBranchSubscriptionController) activateWholesalerBranchSubscr
 		log.Printf("Failed to update user status to active: %v", err)
 	}
 
-	// Handle commission and admin wallet (30% salesperson, 70% admin)
-	planPrice := plan.Price
-	if wholesaler.CreatedBy != wholesaler.UserID && !wholesaler.CreatedBy.IsZero() {
-		// Wholesaler was created by a salesperson - split commission
-		var salesperson models.Salesperson
-		err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": wholesaler.CreatedBy}).Decode(&salesperson)
-		if err == nil {
-			// Calculate commissions: 30% salesperson, 70% admin
-			salespersonPercent := 30.0
-			adminPercent := 70.0
-
-			salespersonCommission := planPrice * salespersonPercent / 100.0
-			adminCommission := planPrice * adminPercent / 100.0
-
-			// Add salesperson commission
-			err = sc.addCommissionToSalespersonWallet(ctx, salesperson.ID, salespersonCommission, newSubscription.ID, "wholesaler_branch_subscription", wholesaler.BusinessName)
-			if err != nil {
-				log.Printf("Failed to add salesperson commission: %v", err)
-			} else {
-				log.Printf("Added salesperson commission: $%.2f (30%% of $%.2f)", salespersonCommission, planPrice)
-			}
-
-			// Add admin commission
-			err = sc.addSubscriptionIncomeToAdminWallet(ctx, adminCommission, newSubscription.ID, "wholesaler_branch_subscription_commission", wholesaler.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add admin commission: %v", err)
-			} else {
-				log.Printf("Added admin commission: $%.2f (70%% of $%.2f)", adminCommission, planPrice)
-			}
-		} else {
-			log.Printf("Salesperson not found, adding full amount to admin wallet")
-			// Salesperson not found, add full amount to admin
-			err = sc.addSubscriptionIncomeToAdminWallet(ctx, planPrice, newSubscription.ID, "wholesaler_branch_subscription", wholesaler.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add subscription income to admin wallet: %v", err)
-			}
-		}
-	} else {
-		// Wholesaler created by itself - full amount to admin
-		err = sc.addSubscriptionIncomeToAdminWallet(ctx, planPrice, newSubscription.ID, "wholesaler_branch_subscription", wholesaler.BusinessName, branch.Name)
-		if err != nil {
-			log.Printf("Failed to add subscription income to admin wallet: %v", err)
-		}
+	// Share the payment between the salesperson who signed the wholesaler, their sales manager and the platform
+	planPrice := subscriptionRequest.AmountDue(plan.Price)
+	if _, err := services.NewCommissionService(sc.DB).Distribute(ctx, wholesalerBranchCommissionSale(wholesaler, branch, plan, newSubscription.ID, planPrice)); err != nil {
+		log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
 	}
 
 	// Update subscription request status
@@ -1435,53 +1374,43 @@ func (sc *WholesalerBranchSubscriptionController) activateWholesalerBranchSubscr
 		log.Printf("Failed to update subscription request status: %v", err)
 	}
 
+	if err := services.NewPromoCodeService(sc.DB).Redeem(ctx, subscriptionRequest.ID); err != nil {
+		log.Printf("Failed to redeem promo code of request %s: %v", subscriptionRequest.ID.Hex(), err)
+	}
+
+	if _, err := services.NewInvoiceService(sc.DB).IssueForSubscription(ctx, services.SubscriptionKindWholesalerBranch, newSubscription.ID, planPrice, subscriptionRequest.ExternalID); err != nil {
+		log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
+	}
+
 	log.Printf("Wholesaler branch subscription activated successfully: Branch=%s, Plan=%s, Amount=$%.2f", branch.Name, plan.Title, planPrice)
 	return nil
 }
 
-// addCommissionToSalespersonWallet adds commission amount to salesperson's wallet
-func (sc *WholesalerBranchSubscriptionController) addCommissionToSalespersonWallet(ctx context.Context, salespersonID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, wholesalerName string) error {
-	// CommissionRecord structure
-	type CommissionRecord struct {
-		ID             primitive.ObjectID `bson:"_id,omitempty"`
-		SubscriptionID primitive.ObjectID `bson:"subscriptionId"`
-		SalespersonID  primitive.ObjectID `bson:"salespersonId"`
-		Amount         float64            `bson:"amount"`
-		Role           string             `bson:"role"`
-		Status         string             `bson:"status"`
-		CreatedAt      time.Time          `bson:"createdAt"`
-	}
-
-	commissionRecord := CommissionRecord{
-		ID:             primitive.NewObjectID(),
+// wholesalerBranchCommissionSale describes a paid wholesaler branch subscription for the commission service. The branch
+// category and governorate are used when set, and commissions go to the salesperson who created the wholesaler.
+func wholesalerBranchCommissionSale(wholesaler models.Wholesaler, branch models.Branch, plan models.SubscriptionPlan, subscriptionID primitive.ObjectID, amount float64) services.CommissionSale {
+	sale := services.CommissionSale{
+		Kind:           services.SubscriptionKindWholesalerBranch,
 		SubscriptionID: subscriptionID,
-		SalespersonID:  salespersonID,
+		EntityID:       branch.ID,
+		BusinessID:     wholesaler.ID,
+		BusinessName:   wholesaler.BusinessName,
+		EntityName:     branch.Name,
+		Plan:           plan,
 		Amount:         amount,
-		Role:           "salesperson",
-		Status:         "pending",
-		CreatedAt:      time.Now(),
+		Category:       branch.Category,
+		Region:         branch.Location.Governorate,
 	}
-
-	_, err := sc.DB.Collection("commission_records").InsertOne(ctx, commissionRecord)
-	if err != nil {
-		return fmt.Errorf("failed to insert salesperson commission record: %w", err)
+	if sale.Category == "" {
+		sale.Category = wholesaler.Category
 	}
-
-	_, err = sc.DB.Collection("salespersons").UpdateOne(
-		ctx,
-		bson.M{"_id": salespersonID},
-		bson.M{
-			"$inc": bson.M{"commissionBalance": amount},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update salesperson commission balance: %w", err)
+	if sale.Region == "" {
+		sale.Region = wholesaler.ContactInfo.Address.Governorate
 	}
-
-	log.Printf("Commission $%.2f added to salesperson wallet (ID: %s) from %s - %s",
-		amount, salespersonID.Hex(), entityType, wholesalerName)
-	return nil
+	if wholesaler.CreatedBy != wholesaler.UserID {
+		sale.CreatedBy = wholesaler.CreatedBy
+	}
+	return sale
 }
 
 // saveUploadedFile saves an uploaded file to the specified directory
@@ -1731,7 +1660,7 @@ func (sc *WholesalerBranchSubscriptionController) GetBranchSubscriptionRequestSt
 
 	subscriptionRequestsCollection := sc.DB.Collection("wholesaler_branch_subscription_requests")
 	var subscriptionRequest models.WholesalerBranchSubscriptionRequest
-	err = subscriptionRequestsCollection.FindOne(ctx, bson.M{"branchId": branchObjectID}, options.FindOne().SetSort(bson.D{{"requestedAt", -1}})).Decode(&subscriptionRequest)
+	err = subscriptionRequestsCollection.FindOne(ctx, bson.M{"branchId": branchObjectID}, options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}})).Decode(&subscriptionRequest)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return c.JSON(http.StatusOK, models.Response{
@@ -1785,33 +1714,35 @@ func (sc *WholesalerBranchSubscriptionController) CancelBranchSubscription(c ech
 		})
 	}
 
-	subscriptionsCollection := sc.DB.Collection("wholesaler_branch_subscriptions")
-	update := bson.M{
-		"$set": bson.M{
-			"status":    "cancelled",
-			"autoRenew": false,
-			"updatedAt": time.Now(),
-		},
+	// Get user information from token
+	claims := middleware.GetUserFromToken(c)
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
 	}
 
-	result, err := subscriptionsCollection.UpdateOne(ctx, bson.M{"branchId": branchObjectID, "status": "active"}, update)
+	subscriptionService := services.NewSubscriptionService(sc.DB)
+	target, err := subscriptionService.ResolveTarget(ctx, services.SubscriptionKindWholesalerBranch, userID, branchObjectID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, models.Response{
-			Status:  http.StatusInternalServerError,
-			Message: "Failed to cancel subscription",
-		})
+		return subscriptionErrorResponse(c, err)
 	}
 
-	if result.MatchedCount == 0 {
-		return c.JSON(http.StatusNotFound, models.Response{
-			Status:  http.StatusNotFound,
-			Message: "No active subscription found",
-		})
+	// Cancel the subscription and refund the unused days
+	subscription, refund, err := subscriptionService.Cancel(ctx, target, userID)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
 	}
 
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Subscription cancelled successfully",
+		Data: map[string]interface{}{
+			"subscription": subscription,
+			"refund":       refund,
+		},
 	})
 }
 
@@ -1883,16 +1814,16 @@ func (sc *WholesalerBranchSubscriptionController) GetBranchSubscriptionRemaining
 	var subscriptionRequest models.WholesalerBranchSubscriptionRequest
 	err = subscriptionRequestsCollection.FindOne(ctx,
 		bson.M{"branchId": branchObjectID, "paymentStatus": "pending", "status": bson.M{"$in": []string{"pending", "pending_payment"}}},
-		options.FindOne().SetSort(bson.D{{"requestedAt", -1}}),
+		options.FindOne().SetSort(bson.D{{Key: "requestedAt", Value: -1}}),
 	).Decode(&subscriptionRequest)
 
 	// If payment status is pending, automatically verify payment and activate if successful
 	if err == nil && subscriptionRequest.ExternalID != 0 {
 		log.Printf("🔄 Auto-verifying wholesaler branch subscription payment for request: %s (externalId: %d)", subscriptionRequest.ID.Hex(), subscriptionRequest.ExternalID)
 
-		// Initialize Whish service and verify payment status
-		whishService := services.NewWhishService()
-		status, phoneNumber, err := whishService.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
+		// Initialize the payment gateway and verify payment status
+		paymentGateway := services.NewPaymentGateway()
+		status, phoneNumber, err := paymentGateway.GetPaymentStatus("USD", subscriptionRequest.ExternalID)
 		if err != nil {
 			log.Printf("⚠️  Failed to auto-verify payment status: %v", err)
 			// Continue to check for existing subscription even if verification fails
@@ -2196,6 +2127,22 @@ func (sc *WholesalerBranchSubscriptionController) ProcessWholesalerBranchSubscri
 		})
 	}
 
+	// Plan changes keep the request for the audit trail and replace the running subscription
+	if subscriptionRequest.PlanChangeOf != nil {
+		return processPlanChangeRequest(ctx, c, sc.DB, services.SubscriptionKindWholesalerBranch, requestObjectID, approvalReq.Status)
+	}
+
+	// Count the promo code use of an approved request, or give it back on rejection
+	promoCodeService := services.NewPromoCodeService(sc.DB)
+	if approvalReq.Status == "approved" {
+		err = promoCodeService.Redeem(ctx, requestObjectID)
+	} else {
+		err = promoCodeService.Release(ctx, requestObjectID)
+	}
+	if err != nil {
+		log.Printf("Failed to update promo code of request %s: %v", requestObjectID.Hex(), err)
+	}
+
 	// Get wholesaler details using aggregation
 	var wholesaler models.Wholesaler
 	var branch models.Branch
@@ -2327,88 +2274,17 @@ func (sc *WholesalerBranchSubscriptionController) ProcessWholesalerBranchSubscri
 
 		subscription = &newSubscription
 
-		// --- Commission logic start ---
-		// Check if wholesaler was created by a salesperson or by itself (user signup)
-		log.Printf("DEBUG: Wholesaler CreatedBy field: %v (IsZero: %v)", wholesaler.CreatedBy, wholesaler.CreatedBy.IsZero())
-
-		// Check if wholesaler was created by itself (user signup) - CreatedBy equals UserID
-		if wholesaler.CreatedBy == wholesaler.UserID {
-			log.Printf("DEBUG: Wholesaler was created by user signup, adding subscription price to admin wallet")
-			// Add subscription price directly to admin wallet (no commission calculation needed)
-			err := sc.addSubscriptionIncomeToAdminWallet(ctx, plan.Price, newSubscription.ID, "wholesaler_branch_subscription", wholesaler.BusinessName, branch.Name)
-			if err != nil {
-				log.Printf("Failed to add subscription income to admin wallet: %v", err)
-			} else {
-				log.Printf("Subscription income added to admin wallet: $%.2f from wholesaler '%s' (ID: %s) - User signup subscription",
-					plan.Price, wholesaler.BusinessName, wholesaler.ID.Hex())
-			}
-		} else if !wholesaler.CreatedBy.IsZero() {
-			log.Printf("DEBUG: Wholesaler was created by salesperson, proceeding with commission calculation")
-			// Get salesperson
-			var salesperson models.Salesperson
-			err := sc.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": wholesaler.CreatedBy}).Decode(&salesperson)
-			if err == nil {
-				log.Printf("DEBUG: Found salesperson: %s (ID: %v)", salesperson.FullName, salesperson.ID)
-				// Get sales manager - try both collection names due to inconsistency
-				var salesManager models.SalesManager
-				err := sc.DB.Collection("sales_managers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-				if err != nil {
-					// Try the alternative collection name
-					log.Printf("DEBUG: Sales manager not found in sales_managers collection, trying salesManagers collection")
-					err = sc.DB.Collection("salesManagers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
-				}
-				if err == nil {
-					log.Printf("DEBUG: Found sales manager: %s (ID: %v)", salesManager.FullName, salesManager.ID)
-					planPrice := plan.Price
-					salespersonPercent := salesperson.CommissionPercent
-					salesManagerPercent := salesManager.CommissionPercent
-
-					log.Printf("DEBUG: Plan price: $%.2f, Salesperson commission percent: %.2f%%, Sales Manager commission percent: %.2f%%",
-						planPrice, salespersonPercent, salesManagerPercent)
-
-					// Calculate commissions correctly
-					// Salesperson gets their percentage directly from the plan price
-					salespersonCommission := planPrice * salespersonPercent / 100.0
-					// Sales manager gets their percentage directly from the plan price
-					salesManagerCommission := planPrice * salesManagerPercent / 100.0
-
-					log.Printf("DEBUG: Calculated commissions - Sales Manager: $%.2f, Salesperson: $%.2f",
-						salesManagerCommission, salespersonCommission)
-
-					// Insert commission document using Commission model
-					commission := models.Commission{
-						ID:                            primitive.NewObjectID(),
-						SubscriptionID:                newSubscription.ID,
-						CompanyID:                     wholesaler.ID, // Using wholesaler ID as the entity ID
-						PlanID:                        plan.ID,
-						PlanPrice:                     planPrice,
-						SalespersonID:                 salesperson.ID,
-						SalespersonCommission:         salespersonCommission,
-						SalespersonCommissionPercent:  salespersonPercent,
-						SalesManagerID:                salesManager.ID,
-						SalesManagerCommission:        salesManagerCommission,
-						SalesManagerCommissionPercent: salesManagerPercent,
-						CreatedAt:                     time.Now(),
-						Paid:                          false,
-						PaidAt:                        nil,
-					}
-					_, err := sc.DB.Collection("commissions").InsertOne(ctx, commission)
-					if err != nil {
-						log.Printf("Failed to insert commission: %v", err)
-					} else {
-						log.Printf("Commission inserted successfully for wholesaler branch subscription - Plan Price: $%.2f, Sales Manager Commission: $%.2f, Salesperson Commission: $%.2f",
-							planPrice, salesManagerCommission, salespersonCommission)
-					}
-				} else {
-					log.Printf("DEBUG: Failed to find sales manager for ID: %v, Error: %v", salesperson.SalesManagerID, err)
-				}
-			} else {
-				log.Printf("DEBUG: Failed to find salesperson for ID: %v, Error: %v", wholesaler.CreatedBy, err)
-			}
-		} else {
-			log.Printf("DEBUG: Wholesaler was not created by a salesperson (CreatedBy is zero or not set)")
+		// Wallet, commission and invoice records use the exchange rate locked with the request
+		ctx = services.WithLockedRate(ctx, subscriptionRequest.CurrencyConversion)
+
+		// Share the payment between the salesperson who signed the wholesaler, their sales manager and the platform
+		if _, err := services.NewCommissionService(sc.DB).Distribute(ctx, wholesalerBranchCommissionSale(wholesaler, branch, plan, newSubscription.ID, subscriptionRequest.AmountDue(plan.Price))); err != nil {
+			log.Printf("Failed to distribute commission of subscription %s: %v", newSubscription.ID.Hex(), err)
+		}
+
+		if _, err := services.NewInvoiceService(sc.DB).IssueForSubscription(ctx, services.SubscriptionKindWholesalerBranch, newSubscription.ID, subscriptionRequest.AmountDue(plan.Price), 0); err != nil {
+			log.Printf("Failed to issue invoice for subscription %s: %v", newSubscription.ID.Hex(), err)
 		}
-		// --- Commission logic end ---
 
 		// Send approval notification to wholesaler
 		if err := sc.sendWholesalerNotificationEmail(
@@ -2619,6 +2495,11 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 		})
 	}
 
+	// Sponsorships are only available on plans with sponsored placement
+	if err := services.NewEntitlementService(sc.DB).RequireSponsoredPlacement(ctx, services.SubscriptionKindWholesalerBranch, branchObjectID); err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if sponsorship exists and is valid
 	sponsorshipCollection := sc.DB.Collection("sponsorships")
 	var sponsorship models.Sponsorship
@@ -2696,12 +2577,31 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 		PaymentMethod: paymentMethod,
 	}
 
+	// Sponsorships set in LBP are charged in USD at the exchange rate of the moment of the request
+	conversion, err := services.NewExchangeRateService(sc.DB).Lock(ctx, sponsorship.Price, sponsorship.Currency)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get exchange rate",
+		})
+	}
+	subscriptionRequest.CurrencyConversion = conversion
+	subscriptionRequest.Amount = conversion.AmountUSD
+	paymentAmount := conversion.AmountUSD
+
 	var collectURL string
 	var externalID int64
 
 	if paymentMethod == "whish" {
-		// Generate external ID for Whish payment (using timestamp-based unique ID)
-		externalID = time.Now().UnixNano() / int64(time.Millisecond)
+		// Allocate a unique externalId for the Whish payment
+		externalID, err = services.NextWhishExternalID(ctx, sc.DB)
+		if err != nil {
+			log.Printf("Failed to allocate Whish externalId: %v", err)
+			return c.JSON(http.StatusInternalServerError, models.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create payment reference",
+			})
+		}
 		subscriptionRequest.ExternalID = externalID
 
 		// Create subscription request with pending_payment status
@@ -2720,11 +2620,11 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 			appURL = "barrim://payment" // Fallback to baseURL if APP_URL not set
 		}
 
-		// Initialize Whish service
-		whishService := services.NewWhishService()
+		// Initialize the payment gateway
+		paymentGateway := services.NewPaymentGateway()
 
 		// Check Whish merchant account balance to verify account is active
-		whishBalance, err := whishService.GetBalance()
+		whishBalance, err := paymentGateway.GetBalance()
 		if err != nil {
 			log.Printf("Warning: Could not check Whish account balance: %v", err)
 			// Continue anyway - balance check failure doesn't block payment creation
@@ -2737,7 +2637,7 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 
 		// Create Whish payment request
 		whishReq := models.WhishRequest{
-			Amount:             &sponsorship.Price,
+			Amount:             &paymentAmount,
 			Currency:           "USD", // Use USD for sponsorship payments
 			Invoice:            fmt.Sprintf("Wholesaler Branch Sponsorship - %s - %s - Sponsorship: %s", wholesaler.BusinessName, branch.Name, sponsorship.Title),
 			ExternalID:         &externalID,
@@ -2748,7 +2648,7 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 		}
 
 		// Call Whish API to create payment
-		collectURL, err = whishService.PostPayment(whishReq)
+		collectURL, err = paymentGateway.PostPayment(whishReq)
 		if err != nil {
 			log.Printf("Failed to create Whish payment: %v", err)
 			return c.JSON(http.StatusInternalServerError, models.Response{
@@ -2787,6 +2687,8 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 		"submittedAt":   subscriptionRequest.RequestedAt,
 		"adminNote":     subscriptionRequest.AdminNote,
 		"price":         sponsorship.Price,
+		"currency":      conversion.OriginalCurrency,
+		"paymentAmount": paymentAmount,
 		"paymentMethod": subscriptionRequest.PaymentMethod,
 	}
 
@@ -2807,69 +2709,6 @@ func (sc *WholesalerBranchSubscriptionController) CreateWholesalerBranchSponsors
 	}
 }
 
-// addSubscriptionIncomeToAdminWallet adds subscription income to the admin wallet
-func (sc *WholesalerBranchSubscriptionController) addSubscriptionIncomeToAdminWallet(ctx context.Context, amount float64, entityID primitive.ObjectID, entityType, wholesalerName, branchName string) error {
-	// Create admin wallet transaction
-	adminWalletTransaction := models.AdminWallet{
-		ID:          primitive.NewObjectID(),
-		Type:        "subscription_income",
-		Amount:      amount,
-		Description: fmt.Sprintf("Subscription income from %s - %s (%s)", wholesalerName, branchName, entityType),
-		EntityID:    entityID,
-		EntityType:  entityType,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// Insert the transaction
-	_, err := sc.DB.Collection("admin_wallet").InsertOne(ctx, adminWalletTransaction)
-	if err != nil {
-		return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
-	}
-
-	// Update or create admin wallet balance
-	balanceCollection := sc.DB.Collection("admin_wallet_balance")
-
-	// Try to find existing balance record
-	var balance models.AdminWalletBalance
-	err = balanceCollection.FindOne(ctx, bson.M{}).Decode(&balance)
-
-	if err == mongo.ErrNoDocuments {
-		// Create new balance record
-		balance = models.AdminWalletBalance{
-			ID:                    primitive.NewObjectID(),
-			TotalIncome:           amount,
-			TotalWithdrawalIncome: 0,
-			TotalCommissionsPaid:  0,
-			NetBalance:            amount,
-			LastUpdated:           time.Now(),
-		}
-		_, err = balanceCollection.InsertOne(ctx, balance)
-		if err != nil {
-			return fmt.Errorf("failed to create admin wallet balance: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to find admin wallet balance: %w", err)
-	} else {
-		// Update existing balance record
-		update := bson.M{
-			"$inc": bson.M{
-				"totalIncome": amount,
-				"netBalance":  amount,
-			},
-			"$set": bson.M{
-				"lastUpdated": time.Now(),
-			},
-		}
-		_, err = balanceCollection.UpdateOne(ctx, bson.M{"_id": balance.ID}, update)
-		if err != nil {
-			return fmt.Errorf("failed to update admin wallet balance: %w", err)
-		}
-	}
-
-	return nil
-}
-
 // HandleWhishSponsorshipPaymentSuccess handles Whish payment success callback for wholesaler branch sponsorship
 func (sc *WholesalerBranchSubscriptionController) HandleWhishSponsorshipPaymentSuccess(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -2901,6 +2740,7 @@ func (sc *WholesalerBranchSubscriptionController) HandleWhishSponsorshipPaymentS
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Printf("Sponsorship subscription request not found for externalId: %d", externalID)
+			recordUnknownWhishCallback(ctx, c, sc.DB, services.WhishPaymentKindSponsorship, externalID)
 			return c.String(http.StatusNotFound, "Sponsorship subscription request not found")
 		}
 		log.Printf("Error finding sponsorship subscription request: %v", err)
@@ -2913,83 +2753,25 @@ func (sc *WholesalerBranchSubscriptionController) HandleWhishSponsorshipPaymentS
 		return c.String(http.StatusOK, "Payment already processed")
 	}
 
-	// Initialize Whish service and verify payment status
-	whishService := services.NewWhishService()
-	status, phoneNumber, err := whishService.GetPaymentStatus("USD", externalID)
-	if err != nil {
-		log.Printf("Failed to verify payment status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to verify payment")
-	}
-
-	if status != "success" {
-		log.Printf("❌ PAYMENT FAILED: Payment not successful, status: %s", status)
-		log.Printf("   Request ID: %s", subscriptionRequest.ID.Hex())
-		log.Printf("   Entity: %s (%s)", subscriptionRequest.EntityName, subscriptionRequest.EntityType)
-		// Update request status to failed
-		requestCollection.UpdateOne(ctx,
-			bson.M{"_id": subscriptionRequest.ID},
-			bson.M{"$set": bson.M{
-				"paymentStatus": "failed",
-				"status":        "failed",
-				"processedAt":   time.Now(),
-			}})
-		log.Printf("==========================================")
-		return c.String(http.StatusBadRequest, "Payment not successful")
-	}
-
-	// Payment verified successfully - activate subscription immediately
-	// Get sponsorship details
-	sponsorshipCollection := sc.DB.Collection("sponsorships")
-	var sponsorship models.Sponsorship
-	err = sponsorshipCollection.FindOne(ctx, bson.M{"_id": subscriptionRequest.SponsorshipID}).Decode(&sponsorship)
-	if err != nil {
-		log.Printf("Failed to get sponsorship details: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to get sponsorship details")
-	}
-
-	// Add sponsorship income to admin wallet using sponsorship subscription controller
+	// Re-confirm the payment with Whish and activate it exactly once
+	var phoneNumber string
+	var sponsorship *models.Sponsorship
 	sponsorshipSubscriptionController := NewSponsorshipSubscriptionController(sc.DB)
-	err = sponsorshipSubscriptionController.addSponsorshipIncomeToAdminWallet(
-		ctx,
-		sponsorship.Price,
-		subscriptionRequest.SponsorshipID,
-		fmt.Sprintf("%s - %s", sponsorship.Title, subscriptionRequest.EntityName),
-	)
-	if err != nil {
-		log.Printf("Failed to add sponsorship income to admin wallet: %v", err)
-		// Don't fail the payment if wallet update fails, but log it
-	}
-
-	// Create active subscription immediately after payment
-	err = sponsorshipSubscriptionController.createActiveSubscription(ctx, subscriptionRequest)
-	if err != nil {
-		log.Printf("Failed to create active subscription: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to activate subscription")
-	}
-
-	// Update entity sponsorship status to active
-	err = sponsorshipSubscriptionController.updateEntitySponsorshipStatus(ctx, subscriptionRequest.EntityType, subscriptionRequest.EntityID, true)
-	if err != nil {
-		log.Printf("Failed to update entity sponsorship status: %v", err)
-		// Don't fail the process if status update fails, but log it
-	}
-
-	// Update request status - mark as approved/active after payment
-	update := bson.M{
-		"$set": bson.M{
-			"paymentStatus": "success",
-			"status":        "approved",
-			"adminApproved": true,
-			"approvedAt":    time.Now(),
-			"paidAt":        time.Now(),
-			"processedAt":   time.Now(),
-		},
-	}
-
-	_, err = requestCollection.UpdateOne(ctx, bson.M{"_id": subscriptionRequest.ID}, update)
+	err = services.NewWhishCallbackService(sc.DB).ConfirmAndActivate(ctx, services.WhishCallback{
+		Kind:          services.WhishPaymentKindSponsorship,
+		ExternalID:    externalID,
+		RequestID:     subscriptionRequest.ID,
+		SponsorshipID: subscriptionRequest.SponsorshipID,
+		Amount:        subscriptionRequest.Amount,
+		RemoteAddr:    c.RealIP(),
+	}, func(ctx context.Context, payerPhone string) error {
+		phoneNumber = payerPhone
+		var err error
+		sponsorship, err = sponsorshipSubscriptionController.activatePaidSponsorship(ctx, subscriptionRequest, payerPhone)
+		return err
+	})
 	if err != nil {
-		log.Printf("Failed to update sponsorship subscription request status: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to update request status")
+		return whishCallbackErrorResponse(ctx, c, err, requestCollection, subscriptionRequest.ID)
 	}
 
 	log.Printf("✅ PAYMENT SUCCESS: Wholesaler branch sponsorship payment completed and activated")
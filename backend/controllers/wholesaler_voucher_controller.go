@@ -8,6 +8,7 @@ import (
 
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/services"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -192,6 +193,15 @@ func (wvc *WholesalerVoucherController) PurchaseVoucherForWholesaler(c echo.Cont
 		})
 	}
 
+	// Voucher purchases are only available on plans with voucher access
+	entitlements, err := services.NewEntitlementService(wvc.DB).ForWholesaler(ctx, &wholesaler)
+	if err == nil {
+		err = services.RequireEntitlement(entitlements, models.EntitlementVoucherAccess, 1)
+	}
+	if err != nil {
+		return entitlementErrorResponse(c, err)
+	}
+
 	// Check if wholesaler has enough points
 	if wholesaler.Points < voucher.Points {
 		return c.JSON(http.StatusBadRequest, models.Response{
@@ -250,6 +260,10 @@ func (wvc *WholesalerVoucherController) PurchaseVoucherForWholesaler(c echo.Cont
 		})
 	}
 
+	if _, err := services.NewInvoiceService(wvc.DB).IssueForVoucher(ctx, "wholesaler", wholesaler.ID, wholesaler.BusinessName, voucher, purchase.ID); err != nil {
+		log.Printf("Failed to issue invoice for voucher purchase %s: %v", purchase.ID.Hex(), err)
+	}
+
 	return c.JSON(http.StatusOK, models.Response{
 		Status:  http.StatusOK,
 		Message: "Voucher purchased successfully",
@@ -0,0 +1,504 @@
+// Package ledger records every movement of money as a balanced double-entry transaction.
+//
+// Each transaction debits and credits named accounts by the same total. Account totals are
+// cached in the ledger_accounts collection inside the same Mongo transaction as the posting,
+// so a cached balance can always be checked against the sum of its postings.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	transactionsCollection = "ledger_transactions"
+	accountsCollection     = "ledger_accounts"
+)
+
+// Well-known accounts
+const (
+	AccountCash                = "assets:cash"               // Money collected from customers and not yet paid out
+	AccountSubscriptionRevenue = "revenue:subscriptions"     // Platform share of subscription and sponsorship payments
+	AccountReferralExpense     = "expenses:referral_rewards" // Rewards granted to salespersons for referrals
+	AccountRefundExpense       = "expenses:refunds"          // Money returned to customers
+	commissionAccountPrefix    = "liabilities:commissions:"  // Commission owed to salespersons and sales managers
+	referralAccountPrefix      = "liabilities:referrals:"    // Referral rewards owed to salespersons
+)
+
+// Transaction types
+const (
+	TypeSubscriptionIncome = "subscription_income"
+	TypeCommission         = "commission"
+	TypeWithdrawal         = "withdrawal"
+	TypeRefund             = "refund"
+	TypeReferralReward     = "referral_reward"
+	TypeOpeningBalance     = "opening_balance"
+)
+
+// ErrUnbalanced is returned when the debits of a transaction do not equal its credits
+var ErrUnbalanced = errors.New("ledger transaction is not balanced")
+
+// CommissionAccount returns the liability account holding commission owed to a salesperson or sales manager
+func CommissionAccount(role string, userID primitive.ObjectID) string {
+	return commissionAccountPrefix + role + ":" + userID.Hex()
+}
+
+// CommissionAccountPrefix returns the prefix shared by all commission accounts of a role ("" for every role)
+func CommissionAccountPrefix(role string) string {
+	if role == "" {
+		return commissionAccountPrefix
+	}
+	return commissionAccountPrefix + role + ":"
+}
+
+// ReferralAccount returns the liability account holding referral rewards owed to a salesperson
+func ReferralAccount(salespersonID primitive.ObjectID) string {
+	return referralAccountPrefix + "salesperson:" + salespersonID.Hex()
+}
+
+// ReferralAccountPrefix returns the prefix shared by the referral accounts of all salespersons
+func ReferralAccountPrefix() string {
+	return referralAccountPrefix + "salesperson:"
+}
+
+// Entry is one side of a posting against a single account
+type Entry struct {
+	Account string  `bson:"account" json:"account"`
+	Debit   float64 `bson:"debit,omitempty" json:"debit,omitempty"`
+	Credit  float64 `bson:"credit,omitempty" json:"credit,omitempty"`
+}
+
+// Debit creates a debit entry
+func Debit(account string, amount float64) Entry {
+	return Entry{Account: account, Debit: amount}
+}
+
+// Credit creates a credit entry
+func Credit(account string, amount float64) Entry {
+	return Entry{Account: account, Credit: amount}
+}
+
+// Transaction is a balanced set of entries describing one movement of money
+type Transaction struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type          string             `bson:"type" json:"type"`
+	ReferenceType string             `bson:"referenceType,omitempty" json:"referenceType,omitempty"` // e.g. "branch_subscription", "withdrawal"
+	ReferenceID   primitive.ObjectID `bson:"referenceId,omitempty" json:"referenceId,omitempty"`
+	Description   string             `bson:"description" json:"description"`
+	PaymentRef    string             `bson:"paymentRef,omitempty" json:"paymentRef,omitempty"` // Processed payment that caused the posting, if any
+	Entries       []Entry            `bson:"entries" json:"entries"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Account holds the cached totals of an account
+type Account struct {
+	ID          string    `bson:"_id" json:"account"`
+	DebitTotal  float64   `bson:"debitTotal" json:"debitTotal"`
+	CreditTotal float64   `bson:"creditTotal" json:"creditTotal"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Balance returns the account balance on its normal side:
+// debit minus credit for assets and expenses, credit minus debit for everything else
+func (a Account) Balance() float64 {
+	if IsDebitNormal(a.ID) {
+		return round(a.DebitTotal - a.CreditTotal)
+	}
+	return round(a.CreditTotal - a.DebitTotal)
+}
+
+// IsDebitNormal reports whether the account grows with debits
+func IsDebitNormal(account string) bool {
+	return strings.HasPrefix(account, "assets:") || strings.HasPrefix(account, "expenses:")
+}
+
+type paymentRefKey struct{}
+
+// WithPaymentReference returns a context whose postings are tagged with the given processed payment
+func WithPaymentReference(ctx context.Context, ref string) context.Context {
+	return context.WithValue(ctx, paymentRefKey{}, ref)
+}
+
+// PaymentReference returns the processed payment carried by ctx, if any
+func PaymentReference(ctx context.Context) string {
+	ref, _ := ctx.Value(paymentRefKey{}).(string)
+	return ref
+}
+
+// Ledger posts and reads double-entry transactions
+type Ledger struct {
+	DB *mongo.Database
+}
+
+// New creates a new ledger
+func New(db *mongo.Database) *Ledger {
+	return &Ledger{DB: db}
+}
+
+// RunInTransaction runs fn inside a Mongo session transaction on the given database.
+// When ctx already carries a session, fn joins that transaction instead of starting a new one.
+func RunInTransaction(ctx context.Context, db *mongo.Database, fn func(sessCtx mongo.SessionContext) error) error {
+	if session := mongo.SessionFromContext(ctx); session != nil {
+		return fn(mongo.NewSessionContext(ctx, session))
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// Post records a transaction in its own Mongo transaction
+func (l *Ledger) Post(ctx context.Context, tx *Transaction) error {
+	return RunInTransaction(ctx, l.DB, func(sessCtx mongo.SessionContext) error {
+		return l.PostInSession(sessCtx, tx)
+	})
+}
+
+// PostInSession records a transaction as part of a Mongo transaction started by the caller,
+// so the posting commits or rolls back together with the caller's other writes
+func (l *Ledger) PostInSession(sessCtx mongo.SessionContext, tx *Transaction) error {
+	if err := validate(tx); err != nil {
+		return err
+	}
+
+	if tx.ID.IsZero() {
+		tx.ID = primitive.NewObjectID()
+	}
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now()
+	}
+	if tx.PaymentRef == "" {
+		tx.PaymentRef = PaymentReference(sessCtx)
+	}
+
+	if _, err := l.DB.Collection(transactionsCollection).InsertOne(sessCtx, tx); err != nil {
+		return fmt.Errorf("failed to insert ledger transaction: %w", err)
+	}
+
+	for _, entry := range tx.Entries {
+		_, err := l.DB.Collection(accountsCollection).UpdateOne(sessCtx,
+			bson.M{"_id": entry.Account},
+			bson.M{
+				"$inc": bson.M{"debitTotal": entry.Debit, "creditTotal": entry.Credit},
+				"$set": bson.M{"updatedAt": tx.CreatedAt},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update ledger account %s: %w", entry.Account, err)
+		}
+	}
+
+	return nil
+}
+
+// GetAccount returns the cached totals of an account; unknown accounts have zero totals
+func (l *Ledger) GetAccount(ctx context.Context, account string) (Account, error) {
+	result := Account{ID: account}
+	err := l.DB.Collection(accountsCollection).FindOne(ctx, bson.M{"_id": account}).Decode(&result)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return result, err
+	}
+	return result, nil
+}
+
+// SumAccounts adds up the cached totals of every account whose name starts with prefix
+func (l *Ledger) SumAccounts(ctx context.Context, prefix string) (Account, error) {
+	result := Account{ID: prefix}
+	cursor, err := l.DB.Collection(accountsCollection).Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}},
+		{"$group": bson.M{
+			"_id":         nil,
+			"debitTotal":  bson.M{"$sum": "$debitTotal"},
+			"creditTotal": bson.M{"$sum": "$creditTotal"},
+		}},
+	})
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		var totals struct {
+			DebitTotal  float64 `bson:"debitTotal"`
+			CreditTotal float64 `bson:"creditTotal"`
+		}
+		if err := cursor.Decode(&totals); err != nil {
+			return result, err
+		}
+		result.DebitTotal = round(totals.DebitTotal)
+		result.CreditTotal = round(totals.CreditTotal)
+	}
+	return result, cursor.Err()
+}
+
+// Accounts returns the cached totals of every account whose name starts with prefix
+func (l *Ledger) Accounts(ctx context.Context, prefix string) ([]Account, error) {
+	cursor, err := l.DB.Collection(accountsCollection).Find(ctx, bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	accounts := []Account{}
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// History returns the most recent transactions touching any of the given accounts
+func (l *Ledger) History(ctx context.Context, accounts []string, limit int64) ([]Transaction, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := l.DB.Collection(transactionsCollection).Find(ctx, bson.M{"entries.account": bson.M{"$in": accounts}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// Between returns the transactions touching any of the given accounts posted from one time up to another, oldest first
+func (l *Ledger) Between(ctx context.Context, accounts []string, from, to time.Time) ([]Transaction, error) {
+	cursor, err := l.DB.Collection(transactionsCollection).Find(ctx,
+		bson.M{
+			"entries.account": bson.M{"$in": accounts},
+			"createdAt":       bson.M{"$gte": from, "$lt": to},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// BalanceBefore returns the combined balance of the given accounts from the postings made before a time
+func (l *Ledger) BalanceBefore(ctx context.Context, accounts []string, at time.Time) (float64, error) {
+	cursor, err := l.DB.Collection(transactionsCollection).Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"entries.account": bson.M{"$in": accounts}, "createdAt": bson.M{"$lt": at}}},
+		{"$unwind": "$entries"},
+		{"$match": bson.M{"entries.account": bson.M{"$in": accounts}}},
+		{"$group": bson.M{
+			"_id":         "$entries.account",
+			"debitTotal":  bson.M{"$sum": "$entries.debit"},
+			"creditTotal": bson.M{"$sum": "$entries.credit"},
+		}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []Account{}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, err
+	}
+	balance := 0.0
+	for _, account := range totals {
+		balance += account.Balance()
+	}
+	return round(balance), nil
+}
+
+// ByReference returns the transactions of the given types posted for a reference, oldest first
+func (l *Ledger) ByReference(ctx context.Context, referenceID primitive.ObjectID, types ...string) ([]Transaction, error) {
+	filter := bson.M{"referenceId": referenceID}
+	if len(types) > 0 {
+		filter["type"] = bson.M{"$in": types}
+	}
+
+	cursor, err := l.DB.Collection(transactionsCollection).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// CreditsByReferenceType sums the credits posted to accounts starting with prefix, grouped by reference type
+func (l *Ledger) CreditsByReferenceType(ctx context.Context, prefix string) (map[string]float64, error) {
+	cursor, err := l.DB.Collection(transactionsCollection).Aggregate(ctx, []bson.M{
+		{"$unwind": "$entries"},
+		{"$match": bson.M{"entries.account": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}},
+		{"$group": bson.M{
+			"_id":   "$referenceType",
+			"total": bson.M{"$sum": bson.M{"$subtract": []interface{}{"$entries.credit", "$entries.debit"}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	breakdown := map[string]float64{}
+	for cursor.Next(ctx) {
+		var row struct {
+			ReferenceType string  `bson:"_id"`
+			Total         float64 `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		key := row.ReferenceType
+		if key == "" {
+			key = "other"
+		}
+		breakdown[key] = round(row.Total)
+	}
+	return breakdown, cursor.Err()
+}
+
+// CashByPaymentRef sums the net cash posted for each of the given processed payments
+func (l *Ledger) CashByPaymentRef(ctx context.Context, refs []string) (map[string]float64, error) {
+	cursor, err := l.DB.Collection(transactionsCollection).Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"paymentRef": bson.M{"$in": refs}}},
+		{"$unwind": "$entries"},
+		{"$match": bson.M{"entries.account": AccountCash}},
+		{"$group": bson.M{
+			"_id":   "$paymentRef",
+			"total": bson.M{"$sum": bson.M{"$subtract": []interface{}{"$entries.debit", "$entries.credit"}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := map[string]float64{}
+	for cursor.Next(ctx) {
+		var row struct {
+			PaymentRef string  `bson:"_id"`
+			Total      float64 `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		totals[row.PaymentRef] = round(row.Total)
+	}
+	return totals, cursor.Err()
+}
+
+// Verify recomputes every account from its postings and returns the accounts whose cached totals differ
+func (l *Ledger) Verify(ctx context.Context) ([]string, error) {
+	cursor, err := l.DB.Collection(transactionsCollection).Aggregate(ctx, []bson.M{
+		{"$unwind": "$entries"},
+		{"$group": bson.M{
+			"_id":         "$entries.account",
+			"debitTotal":  bson.M{"$sum": "$entries.debit"},
+			"creditTotal": bson.M{"$sum": "$entries.credit"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	derived := map[string]Account{}
+	for cursor.Next(ctx) {
+		var account Account
+		if err := cursor.Decode(&account); err != nil {
+			return nil, err
+		}
+		derived[account.ID] = account
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	accountsCursor, err := l.DB.Collection(accountsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer accountsCursor.Close(ctx)
+
+	mismatched := []string{}
+	for accountsCursor.Next(ctx) {
+		var cached Account
+		if err := accountsCursor.Decode(&cached); err != nil {
+			return nil, err
+		}
+		expected := derived[cached.ID]
+		if round(cached.DebitTotal) != round(expected.DebitTotal) || round(cached.CreditTotal) != round(expected.CreditTotal) {
+			mismatched = append(mismatched, cached.ID)
+		}
+		delete(derived, cached.ID)
+	}
+	// Accounts with postings but no cached totals are mismatched as well
+	for account := range derived {
+		mismatched = append(mismatched, account)
+	}
+	return mismatched, accountsCursor.Err()
+}
+
+// validate rounds amounts to cents and checks that the transaction balances
+func validate(tx *Transaction) error {
+	if len(tx.Entries) < 2 {
+		return fmt.Errorf("ledger transaction needs at least two entries")
+	}
+
+	var debits, credits float64
+	for i := range tx.Entries {
+		entry := &tx.Entries[i]
+		entry.Debit = round(entry.Debit)
+		entry.Credit = round(entry.Credit)
+		if entry.Account == "" {
+			return fmt.Errorf("ledger entry without account")
+		}
+		if entry.Debit < 0 || entry.Credit < 0 || (entry.Debit > 0 && entry.Credit > 0) {
+			return fmt.Errorf("ledger entry for %s must be a positive debit or a positive credit", entry.Account)
+		}
+		debits += entry.Debit
+		credits += entry.Credit
+	}
+
+	if round(debits) != round(credits) {
+		return fmt.Errorf("%w: debits %.2f, credits %.2f", ErrUnbalanced, debits, credits)
+	}
+	if round(debits) == 0 {
+		return fmt.Errorf("ledger transaction has no amount")
+	}
+	return nil
+}
+
+// round rounds an amount to cents
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -19,6 +19,8 @@ import (
 	"github.com/HSouheill/barrim_backend/middleware"
 	"github.com/HSouheill/barrim_backend/repositories"
 	"github.com/HSouheill/barrim_backend/routes"
+	"github.com/HSouheill/barrim_backend/services"
+	"github.com/HSouheill/barrim_backend/utils"
 	"github.com/HSouheill/barrim_backend/websocket"
 )
 
@@ -52,6 +54,9 @@ func main() {
 	client := config.ConnectDB()
 	barrimDB := client.Database("barrim") // Ensure consistent database reference
 
+	// Background jobs lock through Mongo leases when Redis is not connected
+	utils.UseMongoJobLocks(barrimDB)
+
 	// Create WebSocket hub
 	wsHub := websocket.NewHub()
 	go wsHub.Run()
@@ -148,6 +153,84 @@ func main() {
 		}
 	}()
 
+	// Copy the legacy wallet balances into the ledger on first start, before any request can move them
+	services.NewWalletService(barrimDB).ImportOpeningBalances()
+
+	// Give service providers that only have the legacy availability strings a structured schedule
+	go services.NewAvailabilityService(barrimDB).MigrateLegacySchedules()
+
+	// Start the subscription lifecycle engine (auto-renewals, expiry of subscriptions and sponsorships)
+	subscriptionLifecycleService := services.NewSubscriptionLifecycleService(barrimDB)
+	go func() {
+		for {
+			subscriptionLifecycleService.Run()
+			time.Sleep(10 * time.Minute)
+		}
+	}()
+
+	// Start the Whish reconciler (missed callbacks, abandoned collect URLs and the daily report)
+	whishReconcilerService := services.NewWhishReconcilerService(barrimDB, controllers.WhishActivators(barrimDB))
+	go func() {
+		for {
+			whishReconcilerService.Run()
+			time.Sleep(10 * time.Minute)
+		}
+	}()
+
+	// Gather scheduled payout runs of commission balances for finance to confirm
+	payoutService := services.NewPayoutService(barrimDB)
+	go func() {
+		for {
+			payoutService.Run()
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	// Store the monthly commission statements once a month has ended
+	commissionStatementService := services.NewCommissionStatementService(barrimDB)
+	go func() {
+		for {
+			commissionStatementService.Run()
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	// Pay the bonus of reached sales targets and close the targets whose period ended
+	salesTargetService := services.NewSalesTargetService(barrimDB)
+	go func() {
+		for {
+			salesTargetService.Run()
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	// Remind salespersons of their due lead follow-ups
+	leadService := services.NewLeadService(barrimDB)
+	go func() {
+		for {
+			leadService.Run()
+			time.Sleep(15 * time.Minute)
+		}
+	}()
+
+	// Remind users and providers of upcoming bookings and cancel bookings whose attendance was not confirmed
+	bookingReminderService := services.NewBookingReminderService(barrimDB)
+	go func() {
+		for {
+			bookingReminderService.Run()
+			time.Sleep(5 * time.Minute)
+		}
+	}()
+
+	// Expire unanswered emergency offers and widen the search to the next providers
+	emergencyDispatchService := services.NewEmergencyDispatchService(barrimDB, wsHub)
+	go func() {
+		for {
+			emergencyDispatchService.Run()
+			time.Sleep(15 * time.Second)
+		}
+	}()
+
 	// Ensure uploads directory exists
 	os.MkdirAll("uploads", 0755)
 	os.MkdirAll("uploads/vouchers", 0755)
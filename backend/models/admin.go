@@ -108,6 +108,8 @@ type AdminWallet struct {
 	EntityType  string             `bson:"entityType,omitempty" json:"entityType,omitempty"` // Type of entity
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	// Amount (USD) in the currency the payment was priced in, at the rate locked for it
+	CurrencyConversion `bson:",inline"`
 }
 
 // AdminWalletBalance represents the current balance of the admin wallet
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // Asia/Beirut must resolve on hosts without a zoneinfo database
+)
+
+// DefaultAvailabilityTimezone is the timezone of schedules that do not set one
+const DefaultAvailabilityTimezone = "Asia/Beirut"
+
+// Working hours assumed for legacy availability that lists days but no hours
+var defaultLegacyRanges = []TimeRange{{Start: "09:00", End: "12:00"}, {Start: "13:00", End: "17:30"}}
+
+// TimeRange is an opening range within a day, as "15:04" times; End is exclusive
+type TimeRange struct {
+	Start string `json:"start" bson:"start"`
+	End   string `json:"end" bson:"end"`
+}
+
+// WeekdayHours are the opening ranges of a day of the week; several ranges leave breaks between them
+type WeekdayHours struct {
+	Day    string      `json:"day" bson:"day"` // "Monday" ... "Sunday"
+	Ranges []TimeRange `json:"ranges" bson:"ranges"`
+}
+
+// AvailabilityOverride replaces the weekly hours on one date; no ranges closes the day
+type AvailabilityOverride struct {
+	Date   string      `json:"date" bson:"date"` // "2006-01-02"
+	Ranges []TimeRange `json:"ranges" bson:"ranges"`
+	Note   string      `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// AvailabilityVacation closes every day from From to To, both included
+type AvailabilityVacation struct {
+	From string `json:"from" bson:"from"` // "2006-01-02"
+	To   string `json:"to" bson:"to"`
+	Note string `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// AvailabilitySchedule is when a service provider works: weekly hours, date overrides and vacations,
+// read in the schedule's timezone
+type AvailabilitySchedule struct {
+	Timezone  string                 `json:"timezone" bson:"timezone"`
+	Weekly    []WeekdayHours         `json:"weekly" bson:"weekly"`
+	Overrides []AvailabilityOverride `json:"overrides" bson:"overrides"`
+	Vacations []AvailabilityVacation `json:"vacations" bson:"vacations"`
+}
+
+// Location returns the timezone of the schedule, falling back to Asia/Beirut
+func (s *AvailabilitySchedule) Location() *time.Location {
+	name := DefaultAvailabilityTimezone
+	if s != nil && s.Timezone != "" {
+		name = s.Timezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, _ = time.LoadLocation(DefaultAvailabilityTimezone)
+	}
+	return loc
+}
+
+// RangesOn returns the opening ranges of a calendar day (the year, month and day of date)
+func (s *AvailabilitySchedule) RangesOn(date time.Time) []TimeRange {
+	if s == nil {
+		return nil
+	}
+	day := date.Format("2006-01-02")
+	for _, vacation := range s.Vacations {
+		if vacation.From <= day && day <= vacation.To {
+			return nil
+		}
+	}
+	for _, override := range s.Overrides {
+		if override.Date == day {
+			return override.Ranges
+		}
+	}
+	weekday := date.Weekday().String()
+	for _, hours := range s.Weekly {
+		if hours.Day == weekday {
+			return hours.Ranges
+		}
+	}
+	return nil
+}
+
+// OpenAt reports whether the schedule is open at the given instant
+func (s *AvailabilitySchedule) OpenAt(t time.Time) bool {
+	local := t.In(s.Location())
+	clock := local.Format("15:04")
+	for _, r := range s.RangesOn(local) {
+		if r.Start <= clock && clock < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRanges checks the times of a day's ranges and that they do not overlap
+func validateRanges(ranges []TimeRange, where string) error {
+	sorted := append([]TimeRange(nil), ranges...)
+	for _, r := range sorted {
+		start, errStart := time.Parse("15:04", r.Start)
+		end, errEnd := time.Parse("15:04", r.End)
+		if errStart != nil || errEnd != nil {
+			return fmt.Errorf("%s: times must use the HH:MM format", where)
+		}
+		if !start.Before(end) {
+			return fmt.Errorf("%s: %s-%s must start before it ends", where, r.Start, r.End)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Start < sorted[i-1].End {
+			return fmt.Errorf("%s: %s-%s overlaps %s-%s", where, sorted[i].Start, sorted[i].End, sorted[i-1].Start, sorted[i-1].End)
+		}
+	}
+	return nil
+}
+
+// Validate checks the timezone, day names, dates and ranges of the schedule
+func (s *AvailabilitySchedule) Validate() error {
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", s.Timezone)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, hours := range s.Weekly {
+		if !isWeekdayName(hours.Day) {
+			return fmt.Errorf("unknown weekday %q", hours.Day)
+		}
+		if seen[hours.Day] {
+			return fmt.Errorf("%s is listed more than once", hours.Day)
+		}
+		seen[hours.Day] = true
+		if err := validateRanges(hours.Ranges, hours.Day); err != nil {
+			return err
+		}
+	}
+	dates := make(map[string]bool)
+	for _, override := range s.Overrides {
+		if _, err := time.Parse("2006-01-02", override.Date); err != nil {
+			return fmt.Errorf("override date %q must use the YYYY-MM-DD format", override.Date)
+		}
+		if dates[override.Date] {
+			return fmt.Errorf("%s has more than one override", override.Date)
+		}
+		dates[override.Date] = true
+		if err := validateRanges(override.Ranges, override.Date); err != nil {
+			return err
+		}
+	}
+	for _, vacation := range s.Vacations {
+		_, errFrom := time.Parse("2006-01-02", vacation.From)
+		_, errTo := time.Parse("2006-01-02", vacation.To)
+		if errFrom != nil || errTo != nil {
+			return errors.New("vacation dates must use the YYYY-MM-DD format")
+		}
+		if vacation.To < vacation.From {
+			return fmt.Errorf("vacation %s to %s ends before it starts", vacation.From, vacation.To)
+		}
+	}
+	return nil
+}
+
+// LegacyFields renders the weekly hours in the old AvailableWeekdays and AvailableHours form
+// for clients that still read them
+func (s *AvailabilitySchedule) LegacyFields() (weekdays []string, hours []string) {
+	weekdays, hours = []string{}, []string{}
+	seen := make(map[string]bool)
+	for _, day := range []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"} {
+		for _, weekly := range s.Weekly {
+			if weekly.Day != day || len(weekly.Ranges) == 0 {
+				continue
+			}
+			weekdays = append(weekdays, day)
+			for _, r := range weekly.Ranges {
+				if value := r.Start + "-" + r.End; !seen[value] {
+					seen[value] = true
+					hours = append(hours, value)
+				}
+			}
+		}
+	}
+	return weekdays, hours
+}
+
+// isWeekdayName reports whether name is an English weekday name such as "Monday"
+func isWeekdayName(name string) bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if day.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyRanges reads old AvailableHours entries: "09:00-12:00" ranges are kept as they are,
+// and lists of plain times ("09:00,10:00,...,17:00") span from the earliest to the latest one
+func legacyRanges(entries []string) []TimeRange {
+	var ranges []TimeRange
+	var times []string
+	for _, entry := range entries {
+		for _, token := range strings.Split(entry, ",") {
+			token = strings.TrimSpace(token)
+			if bounds := strings.SplitN(token, "-", 2); len(bounds) == 2 {
+				start, errStart := time.Parse("15:04", strings.TrimSpace(bounds[0]))
+				end, errEnd := time.Parse("15:04", strings.TrimSpace(bounds[1]))
+				if errStart == nil && errEnd == nil && start.Before(end) {
+					ranges = append(ranges, TimeRange{Start: start.Format("15:04"), End: end.Format("15:04")})
+				}
+				continue
+			}
+			if t, err := time.Parse("15:04", token); err == nil {
+				times = append(times, t.Format("15:04"))
+			}
+		}
+	}
+	sort.Strings(times)
+	if len(times) >= 2 && times[0] < times[len(times)-1] {
+		ranges = append(ranges, TimeRange{Start: times[0], End: times[len(times)-1]})
+	} else if len(times) == 1 {
+		// A single opening time is read as a one-hour range
+		start, _ := time.Parse("15:04", times[0])
+		end := start.Add(time.Hour)
+		if end.Day() == start.Day() {
+			ranges = append(ranges, TimeRange{Start: times[0], End: end.Format("15:04")})
+		}
+	}
+	if len(ranges) == 0 {
+		return append([]TimeRange(nil), defaultLegacyRanges...)
+	}
+
+	// Merge overlapping entries so the result passes Validate
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := []TimeRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// ScheduleFromLegacy builds a schedule from the comma-joined AvailableHours, AvailableDays and
+// AvailableWeekdays strings. Weekdays open every week; listed dates that do not fall on one of them
+// become overrides. Vacations, closed-day overrides and the timezone of the current schedule are kept.
+func ScheduleFromLegacy(info *ServiceProviderInfo) *AvailabilitySchedule {
+	schedule := &AvailabilitySchedule{
+		Timezone:  DefaultAvailabilityTimezone,
+		Weekly:    []WeekdayHours{},
+		Overrides: []AvailabilityOverride{},
+		Vacations: []AvailabilityVacation{},
+	}
+	if info == nil {
+		return schedule
+	}
+	if current := info.Schedule; current != nil {
+		if current.Timezone != "" {
+			schedule.Timezone = current.Timezone
+		}
+		schedule.Vacations = append(schedule.Vacations, current.Vacations...)
+		for _, override := range current.Overrides {
+			if len(override.Ranges) == 0 {
+				schedule.Overrides = append(schedule.Overrides, override)
+			}
+		}
+	}
+
+	ranges := legacyRanges(info.AvailableHours)
+	weekly := make(map[string]bool)
+	var dates []string
+	days := append([]string(nil), info.AvailableWeekdays...)
+	days = append(days, info.AvailableDays...)
+	for _, entry := range days {
+		for _, day := range strings.Split(entry, ",") {
+			day = strings.TrimSpace(day)
+			if isWeekdayName(day) {
+				weekly[day] = true
+			} else if _, err := time.Parse("2006-01-02", day); err == nil {
+				dates = append(dates, day)
+			}
+		}
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if weekly[day.String()] {
+			schedule.Weekly = append(schedule.Weekly, WeekdayHours{Day: day.String(), Ranges: ranges})
+		}
+	}
+
+	overridden := make(map[string]bool)
+	for _, override := range schedule.Overrides {
+		overridden[override.Date] = true
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		t, _ := time.Parse("2006-01-02", date)
+		if weekly[t.Weekday().String()] || overridden[date] {
+			continue
+		}
+		overridden[date] = true
+		schedule.Overrides = append(schedule.Overrides, AvailabilityOverride{Date: date, Ranges: ranges})
+	}
+	return schedule
+}
+
+// EffectiveSchedule returns the provider's schedule, reading the legacy availability strings
+// of documents that have not been migrated yet
+func (s *ServiceProviderInfo) EffectiveSchedule() *AvailabilitySchedule {
+	if s == nil {
+		return ScheduleFromLegacy(nil)
+	}
+	if s.Schedule != nil {
+		return s.Schedule
+	}
+	return ScheduleFromLegacy(s)
+}
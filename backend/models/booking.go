@@ -8,21 +8,33 @@ import (
 
 // Booking model
 type Booking struct {
-	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	UserID            primitive.ObjectID `json:"userId" bson:"userId"`
-	ServiceProviderID primitive.ObjectID `json:"serviceProviderId" bson:"serviceProviderId"`
-	BookingDate       time.Time          `json:"bookingDate" bson:"bookingDate"`
-	TimeSlot          string             `json:"timeSlot" bson:"timeSlot"`
-	PhoneNumber       string             `json:"phoneNumber" bson:"phoneNumber"`
-	Details           string             `json:"details" bson:"details"`
-	IsEmergency       bool               `json:"isEmergency" bson:"isEmergency"`
-	Status            string             `json:"status" bson:"status"`                                         // "pending", "accepted", "rejected", "confirmed", "completed", "cancelled"
-	ProviderResponse  string             `json:"providerResponse,omitempty" bson:"providerResponse,omitempty"` // Optional message from service provider
-	MediaTypes        []string           `json:"mediaTypes,omitempty" bson:"mediaTypes,omitempty"`             // Array of "image" or "video"
-	MediaURLs         []string           `json:"mediaUrls,omitempty" bson:"mediaUrls,omitempty"`               // Array of URLs to the uploaded media
-	ThumbnailURLs     []string           `json:"thumbnailUrls,omitempty" bson:"thumbnailUrls,omitempty"`       // Array of URLs to the thumbnails (for videos)
-	CreatedAt         time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt         time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID                             primitive.ObjectID          `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID                         primitive.ObjectID          `json:"userId" bson:"userId"`
+	ServiceProviderID              primitive.ObjectID          `json:"serviceProviderId" bson:"serviceProviderId"`
+	BookingDate                    time.Time                   `json:"bookingDate" bson:"bookingDate"`
+	TimeSlot                       string                      `json:"timeSlot" bson:"timeSlot"`
+	PhoneNumber                    string                      `json:"phoneNumber" bson:"phoneNumber"`
+	Details                        string                      `json:"details" bson:"details"`
+	IsEmergency                    bool                        `json:"isEmergency" bson:"isEmergency"`
+	Status                         string                      `json:"status" bson:"status"`                                                                     // "pending", "accepted", "rejected", "confirmed", "completed", "no_show", "cancelled"
+	ProviderResponse               string                      `json:"providerResponse,omitempty" bson:"providerResponse,omitempty"`                             // Optional message from service provider
+	MediaTypes                     []string                    `json:"mediaTypes,omitempty" bson:"mediaTypes,omitempty"`                                         // Array of "image" or "video"
+	MediaURLs                      []string                    `json:"mediaUrls,omitempty" bson:"mediaUrls,omitempty"`                                           // Array of URLs to the uploaded media
+	ThumbnailURLs                  []string                    `json:"thumbnailUrls,omitempty" bson:"thumbnailUrls,omitempty"`                                   // Array of URLs to the thumbnails (for videos)
+	Seat                           *int                        `json:"seat,omitempty" bson:"seat,omitempty"`                                                     // Place held in the slot while the booking is pending, accepted or confirmed
+	RescheduleProposals            []BookingRescheduleProposal `json:"rescheduleProposals,omitempty" bson:"rescheduleProposals,omitempty"`                       // Every time change proposed, oldest first
+	StartsAt                       *time.Time                  `json:"startsAt,omitempty" bson:"startsAt,omitempty"`                                             // Start of the slot in the provider's timezone
+	RemindersSent                  []string                    `json:"remindersSent,omitempty" bson:"remindersSent,omitempty"`                                   // Reminder offsets already sent, e.g. "24h0m0s"
+	AttendanceConfirmationRequired bool                        `json:"attendanceConfirmationRequired,omitempty" bson:"attendanceConfirmationRequired,omitempty"` // The user must confirm they will come, set for users with past no-shows
+	AttendanceConfirmBy            *time.Time                  `json:"attendanceConfirmBy,omitempty" bson:"attendanceConfirmBy,omitempty"`                       // Unconfirmed bookings are cancelled after this
+	AttendanceConfirmedAt          *time.Time                  `json:"attendanceConfirmedAt,omitempty" bson:"attendanceConfirmedAt,omitempty"`
+	CancelledBy                    string                      `json:"cancelledBy,omitempty" bson:"cancelledBy,omitempty"` // "user", "serviceProvider" or "system"
+	OutcomeNote                    string                      `json:"outcomeNote,omitempty" bson:"outcomeNote,omitempty"`
+	OutcomeAt                      *time.Time                  `json:"outcomeAt,omitempty" bson:"outcomeAt,omitempty"` // When the provider marked the booking completed or no-show
+	OutcomeBy                      *primitive.ObjectID         `json:"outcomeBy,omitempty" bson:"outcomeBy,omitempty"`
+	DispatchID                     *primitive.ObjectID         `json:"dispatchId,omitempty" bson:"dispatchId,omitempty"` // Emergency dispatch looking for a provider; ServiceProviderID is unset until one accepts
+	CreatedAt                      time.Time                   `json:"createdAt" bson:"createdAt"`
+	UpdatedAt                      time.Time                   `json:"updatedAt" bson:"updatedAt"`
 }
 
 // BookingRequest model
@@ -36,6 +48,107 @@ type BookingRequest struct {
 	MediaTypes        []string  `json:"mediaTypes,omitempty"`     // Array of "image" or "video"
 	MediaFiles        []string  `json:"mediaFiles,omitempty"`     // Array of Base64 encoded media files
 	MediaFileNames    []string  `json:"mediaFileNames,omitempty"` // Array of original filenames of the media
+	// Emergency requests are dispatched to nearby providers of a service type instead of the provider above;
+	// the service type defaults to that provider's and the location to the user's
+	ServiceType string   `json:"serviceType,omitempty"`
+	Lat         *float64 `json:"lat,omitempty"`
+	Lng         *float64 `json:"lng,omitempty"`
+}
+
+// BookingSlotSettings controls how a service provider's working hours are split into bookable slots
+type BookingSlotSettings struct {
+	SlotMinutes   int `json:"slotMinutes" bson:"slotMinutes" validate:"required,min=5,max=720"`
+	BufferMinutes int `json:"bufferMinutes" bson:"bufferMinutes" validate:"min=0,max=240"` // Gap kept free after each slot
+	Capacity      int `json:"capacity" bson:"capacity" validate:"required,min=1,max=100"`  // Bookings a single slot can take
+}
+
+// BookingSlot is a bookable slot of a service provider on a given day
+type BookingSlot struct {
+	TimeSlot  string    `json:"timeSlot"` // Start time as "3:04 PM"
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Remaining int       `json:"remaining"`
+}
+
+// Parties of a booking; "system" cancels bookings whose attendance was not confirmed
+const (
+	BookingPartyUser            = "user"
+	BookingPartyServiceProvider = "serviceProvider"
+	BookingPartySystem          = "system"
+)
+
+// Booking outcomes a provider records once the booking time has passed
+const (
+	BookingStatusCompleted = "completed"
+	BookingStatusNoShow    = "no_show"
+)
+
+// BookingPolicy is how a service provider treats users who did not show up to past bookings.
+// Thresholds count the user's no-shows across all providers; zero turns a threshold off.
+type BookingPolicy struct {
+	ConfirmationAfterNoShows int                  `json:"confirmationAfterNoShows" bson:"confirmationAfterNoShows" validate:"min=0"` // Users with this many no-shows must confirm their attendance
+	BlockAfterNoShows        int                  `json:"blockAfterNoShows" bson:"blockAfterNoShows" validate:"min=0"`               // Users with this many no-shows cannot book
+	BlockedUserIDs           []primitive.ObjectID `json:"blockedUserIds" bson:"blockedUserIds"`                                      // Users blocked by hand
+}
+
+// BookingPolicyRequest represents the request body for updating a provider's no-show thresholds
+type BookingPolicyRequest struct {
+	ConfirmationAfterNoShows int `json:"confirmationAfterNoShows" validate:"min=0"`
+	BlockAfterNoShows        int `json:"blockAfterNoShows" validate:"min=0"`
+}
+
+// BookingOutcomeRequest represents the request body for marking a past booking completed or no-show
+type BookingOutcomeRequest struct {
+	Status string `json:"status" validate:"required,oneof=completed no_show"`
+	Note   string `json:"note"`
+}
+
+// ReliabilityScore summarizes how a user or provider honoured their past bookings.
+// Users are scored on completed bookings against no-shows, providers on completed bookings against their cancellations.
+type ReliabilityScore struct {
+	Completed     int     `json:"completed"`
+	NoShows       int     `json:"noShows"`
+	Cancellations int     `json:"cancellations"`
+	Score         float64 `json:"score"` // 0 to 100; 100 without history
+}
+
+// Reschedule proposal statuses
+const (
+	RescheduleStatusPending  = "pending"
+	RescheduleStatusAccepted = "accepted"
+	RescheduleStatusDeclined = "declined"
+)
+
+// BookingRescheduleProposal is a new date and time one party of a booking proposes to the other
+type BookingRescheduleProposal struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id"`
+	ProposedBy     primitive.ObjectID  `json:"proposedBy" bson:"proposedBy"`
+	ProposedByRole string              `json:"proposedByRole" bson:"proposedByRole"` // "user" or "serviceProvider"
+	FromDate       time.Time           `json:"fromDate" bson:"fromDate"`
+	FromTimeSlot   string              `json:"fromTimeSlot" bson:"fromTimeSlot"`
+	BookingDate    time.Time           `json:"bookingDate" bson:"bookingDate"`
+	TimeSlot       string              `json:"timeSlot" bson:"timeSlot"`
+	Note           string              `json:"note,omitempty" bson:"note,omitempty"`
+	Status         string              `json:"status" bson:"status"` // "pending", "accepted", "declined"
+	ResponseNote   string              `json:"responseNote,omitempty" bson:"responseNote,omitempty"`
+	RespondedBy    *primitive.ObjectID `json:"respondedBy,omitempty" bson:"respondedBy,omitempty"`
+	RespondedAt    *time.Time          `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// BookingRescheduleRequest represents the request body for proposing a new booking time
+type BookingRescheduleRequest struct {
+	BookingDate time.Time `json:"bookingDate" validate:"required"`
+	TimeSlot    string    `json:"timeSlot" validate:"required"`
+	Note        string    `json:"note"`
+}
+
+// BookingRescheduleResponseRequest represents the request body for answering a reschedule proposal
+type BookingRescheduleResponseRequest struct {
+	Status string `json:"status" validate:"required,oneof=accepted declined"`
+	Note   string `json:"note"`
 }
 
 // BookingStatusUpdateRequest model for updating booking status
@@ -28,7 +28,24 @@ type Commission struct {
 	SalesManagerCommission        float64            `bson:"salesManagerCommission,omitempty" json:"salesManagerCommission,omitempty"`
 	SalesManagerCommissionPercent float64            `bson:"salesManagerCommissionPercent,omitempty" json:"salesManagerCommissionPercent,omitempty"`
 
-	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
-	Paid      bool       `bson:"paid" json:"paid"`
-	PaidAt    *time.Time `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+	// Commission rule version that set the percentages; RuleSource is "profile" when no rule matched
+	// and the CommissionPercent of the salesperson and sales manager applied
+	RuleSource    string              `bson:"ruleSource,omitempty" json:"ruleSource,omitempty"`
+	RuleID        *primitive.ObjectID `bson:"ruleId,omitempty" json:"ruleId,omitempty"`
+	RuleVersionID *primitive.ObjectID `bson:"ruleVersionId,omitempty" json:"ruleVersionId,omitempty"`
+	RuleVersion   int                 `bson:"ruleVersion,omitempty" json:"ruleVersion,omitempty"`
+	Renewal       bool                `bson:"renewal,omitempty" json:"renewal,omitempty"`
+	PlanChange    bool                `bson:"planChange,omitempty" json:"planChange,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+
+	// Paid is set when the salesperson share is paid out; the sales manager share is tracked separately
+	Paid               bool       `bson:"paid" json:"paid"`
+	PaidAt             *time.Time `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+	SalesManagerPaid   bool       `bson:"salesManagerPaid,omitempty" json:"salesManagerPaid,omitempty"`
+	SalesManagerPaidAt *time.Time `bson:"salesManagerPaidAt,omitempty" json:"salesManagerPaidAt,omitempty"`
+
+	// Set when a refund took back part of the commission
+	ClawedBack   float64    `bson:"clawedBack,omitempty" json:"clawedBack,omitempty"`
+	ClawedBackAt *time.Time `bson:"clawedBackAt,omitempty" json:"clawedBackAt,omitempty"`
 }
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purchases a commission rule applies to
+const (
+	CommissionPurchaseAny     = ""
+	CommissionPurchaseFirst   = "first"   // First subscription of the branch or service provider
+	CommissionPurchaseRenewal = "renewal" // Any later subscription
+)
+
+// Where the percentages of a commission came from
+const (
+	CommissionSourceRule    = "rule"    // A commission rule version
+	CommissionSourceProfile = "profile" // The CommissionPercent of the salesperson and sales manager, when no rule matched
+)
+
+// CommissionRule is one version of an admin-managed commission rule. Editing a rule stores a new version
+// effective from a given date and ends the previous one then, so past commissions keep pointing at the
+// version that produced them.
+type CommissionRule struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`          // This version
+	RuleID  primitive.ObjectID `json:"ruleId" bson:"ruleId"`   // Shared by every version of the rule
+	Version int                `json:"version" bson:"version"` // Starts at 1
+	Name    string             `json:"name" bson:"name"`
+
+	// Conditions; an empty list matches everything
+	PlanTypes    []string `json:"planTypes,omitempty" bson:"planTypes,omitempty"`       // "company", "wholesaler", "serviceProvider"
+	Categories   []string `json:"categories,omitempty" bson:"categories,omitempty"`     // Business category
+	Regions      []string `json:"regions,omitempty" bson:"regions,omitempty"`           // Governorate of the business, or region of the salesperson
+	PurchaseType string   `json:"purchaseType,omitempty" bson:"purchaseType,omitempty"` // "", "first" or "renewal"
+	Priority     int      `json:"priority" bson:"priority"`                             // Highest wins when several rules match
+
+	// Percentages of the amount paid
+	SalespersonPercent  float64          `json:"salespersonPercent" bson:"salespersonPercent"`
+	SalesManagerPercent float64          `json:"salesManagerPercent" bson:"salesManagerPercent"`
+	Tiers               []CommissionTier `json:"tiers,omitempty" bson:"tiers,omitempty"`
+
+	EffectiveFrom time.Time          `json:"effectiveFrom" bson:"effectiveFrom"`
+	EffectiveTo   *time.Time         `json:"effectiveTo,omitempty" bson:"effectiveTo,omitempty"` // Open-ended when empty
+	CreatedBy     primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// CommissionTier replaces the rule percentages once the salesperson has made MinSales sales in the
+// calendar month, counting the sale being paid
+type CommissionTier struct {
+	MinSales            int     `json:"minSales" bson:"minSales"`
+	SalespersonPercent  float64 `json:"salespersonPercent" bson:"salespersonPercent"`
+	SalesManagerPercent float64 `json:"salesManagerPercent" bson:"salesManagerPercent"`
+}
+
+// CommissionRuleRequest represents the request body for creating a rule or storing a new version of it
+type CommissionRuleRequest struct {
+	Name                string           `json:"name" validate:"required"`
+	PlanTypes           []string         `json:"planTypes" validate:"omitempty,dive,oneof=company wholesaler serviceProvider"`
+	Categories          []string         `json:"categories"`
+	Regions             []string         `json:"regions"`
+	PurchaseType        string           `json:"purchaseType" validate:"omitempty,oneof=first renewal"`
+	Priority            int              `json:"priority"`
+	SalespersonPercent  float64          `json:"salespersonPercent" validate:"gte=0,lte=100"`
+	SalesManagerPercent float64          `json:"salesManagerPercent" validate:"gte=0,lte=100"`
+	Tiers               []CommissionTier `json:"tiers"`
+	EffectiveFrom       *time.Time       `json:"effectiveFrom"` // Defaults to now
+	EffectiveTo         *time.Time       `json:"effectiveTo"`
+}
+
+// Validate checks the percentages, tiers and effective dates, and sorts the tiers
+func (r *CommissionRuleRequest) Validate() error {
+	if err := validCommissionSplit(r.SalespersonPercent, r.SalesManagerPercent); err != nil {
+		return err
+	}
+	sort.Slice(r.Tiers, func(i, j int) bool { return r.Tiers[i].MinSales < r.Tiers[j].MinSales })
+	for i, tier := range r.Tiers {
+		if tier.MinSales < 1 {
+			return fmt.Errorf("tier minSales must be at least 1")
+		}
+		if i > 0 && tier.MinSales == r.Tiers[i-1].MinSales {
+			return fmt.Errorf("tiers must have different minSales")
+		}
+		if err := validCommissionSplit(tier.SalespersonPercent, tier.SalesManagerPercent); err != nil {
+			return fmt.Errorf("tier of %d sales: %w", tier.MinSales, err)
+		}
+	}
+	if r.EffectiveFrom != nil && r.EffectiveTo != nil && !r.EffectiveTo.After(*r.EffectiveFrom) {
+		return fmt.Errorf("effectiveTo must be after effectiveFrom")
+	}
+	return nil
+}
+
+func validCommissionSplit(salespersonPercent, salesManagerPercent float64) error {
+	if salespersonPercent < 0 || salesManagerPercent < 0 {
+		return fmt.Errorf("commission percentages cannot be negative")
+	}
+	if salespersonPercent+salesManagerPercent > 100 {
+		return fmt.Errorf("salesperson and sales manager percentages cannot add up to more than 100")
+	}
+	return nil
+}
+
+// Conditions returns how many conditions the rule sets; more specific rules win ties on priority
+func (r CommissionRule) Conditions() int {
+	count := 0
+	for _, set := range []bool{len(r.PlanTypes) > 0, len(r.Categories) > 0, len(r.Regions) > 0, r.PurchaseType != ""} {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
+// Percentages returns the salesperson and sales manager percentages for the monthly sales count of the salesperson
+func (r CommissionRule) Percentages(salesThisMonth int) (float64, float64) {
+	salespersonPercent, salesManagerPercent := r.SalespersonPercent, r.SalesManagerPercent
+	for _, tier := range r.Tiers {
+		if salesThisMonth >= tier.MinSales {
+			salespersonPercent, salesManagerPercent = tier.SalespersonPercent, tier.SalesManagerPercent
+		}
+	}
+	return salespersonPercent, salesManagerPercent
+}
+
+// CommissionPreviewRequest represents the request body for previewing which rule applies to a sale
+type CommissionPreviewRequest struct {
+	PlanID        string     `json:"planId" validate:"required"`
+	SalespersonID string     `json:"salespersonId" validate:"required"`
+	Amount        float64    `json:"amount"` // Defaults to the plan price
+	Category      string     `json:"category"`
+	Region        string     `json:"region"`
+	Renewal       bool       `json:"renewal"`
+	At            *time.Time `json:"at"` // Defaults to now
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Commission statement line kinds
+const (
+	StatementLineCommission = "commission"
+	StatementLineReferral   = "referral"
+	StatementLineWithdrawal = "withdrawal"
+	StatementLineRefund     = "refund"     // Commission taken back when a subscription was refunded
+	StatementLineAdjustment = "adjustment" // Opening balances and other manual postings
+)
+
+// CommissionStatement is the monthly statement of the commission and referral balances of a salesperson
+// or sales manager. Statements are never changed once stored; regenerating one stores a new version
+// that supersedes it.
+type CommissionStatement struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	UserType    string             `json:"userType" bson:"userType"` // "salesperson", "sales_manager"
+	Name        string             `json:"name" bson:"name"`
+	Email       string             `json:"email,omitempty" bson:"email,omitempty"`
+	Period      string             `json:"period" bson:"period"` // e.g. "2026-09"
+	PeriodStart time.Time          `json:"periodStart" bson:"periodStart"`
+	PeriodEnd   time.Time          `json:"periodEnd" bson:"periodEnd"` // Exclusive
+
+	OpeningBalance   float64                   `json:"openingBalance" bson:"openingBalance"`
+	TotalCommissions float64                   `json:"totalCommissions" bson:"totalCommissions"`
+	TotalReferrals   float64                   `json:"totalReferrals" bson:"totalReferrals"`
+	TotalWithdrawals float64                   `json:"totalWithdrawals" bson:"totalWithdrawals"`
+	TotalOther       float64                   `json:"totalOther,omitempty" bson:"totalOther,omitempty"` // Refunds and adjustments
+	ClosingBalance   float64                   `json:"closingBalance" bson:"closingBalance"`
+	Lines            []CommissionStatementLine `json:"lines" bson:"lines"`
+
+	Version     int                 `json:"version" bson:"version"` // Starts at 1
+	Supersedes  *primitive.ObjectID `json:"supersedes,omitempty" bson:"supersedes,omitempty"`
+	GeneratedAt time.Time           `json:"generatedAt" bson:"generatedAt"`
+	GeneratedBy *primitive.ObjectID `json:"generatedBy,omitempty" bson:"generatedBy,omitempty"` // Admin who regenerated it; empty for month-end statements
+	AuditNote   string              `json:"auditNote,omitempty" bson:"auditNote,omitempty"`
+}
+
+// CommissionStatementLine is one movement of the balance during the month
+type CommissionStatementLine struct {
+	Date          time.Time          `json:"date" bson:"date"`
+	Kind          string             `json:"kind" bson:"kind"`
+	Description   string             `json:"description" bson:"description"`
+	BusinessName  string             `json:"businessName,omitempty" bson:"businessName,omitempty"` // Company, wholesaler or service provider
+	BranchName    string             `json:"branchName,omitempty" bson:"branchName,omitempty"`
+	PlanTitle     string             `json:"planTitle,omitempty" bson:"planTitle,omitempty"`
+	ReferenceID   primitive.ObjectID `json:"referenceId,omitempty" bson:"referenceId,omitempty"`
+	TransactionID primitive.ObjectID `json:"transactionId" bson:"transactionId"`
+	Amount        float64            `json:"amount" bson:"amount"`   // Negative for withdrawals and refunds
+	Balance       float64            `json:"balance" bson:"balance"` // Running balance after the line
+}
+
+// CommissionStatementRegenerateRequest represents the request body for regenerating a statement
+type CommissionStatementRegenerateRequest struct {
+	UserID    string `json:"userId" validate:"required"`
+	UserType  string `json:"userType" validate:"required,oneof=salesperson sales_manager"`
+	Period    string `json:"period" validate:"required"` // "YYYY-MM"
+	AuditNote string `json:"auditNote" validate:"required"`
+}
@@ -141,16 +141,21 @@ type CompanySubscription struct {
 // BranchSubscription represents a branch's subscription
 // Similar to CompanySubscription but for branches
 type BranchSubscription struct {
-	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	BranchID      primitive.ObjectID `json:"branchId" bson:"branchId"` // Reference to the branch
-	PlanID        primitive.ObjectID `json:"planId" bson:"planId"`     // Reference to the subscribed plan
-	StartDate     time.Time          `json:"startDate" bson:"startDate"`
-	EndDate       time.Time          `json:"endDate" bson:"endDate"`
-	Status        string             `json:"status" bson:"status"`               // e.g., "active", "paused", "expired"
-	AutoRenew     bool               `json:"autoRenew" bson:"autoRenew"`         // Whether the subscription should auto-renew
-	PaymentMethod string             `json:"paymentMethod" bson:"paymentMethod"` // "whish" or "cash" - saved permanently
-	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID               primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	BranchID         primitive.ObjectID  `json:"branchId" bson:"branchId"` // Reference to the branch
+	PlanID           primitive.ObjectID  `json:"planId" bson:"planId"`     // Reference to the subscribed plan
+	StartDate        time.Time           `json:"startDate" bson:"startDate"`
+	EndDate          time.Time           `json:"endDate" bson:"endDate"`
+	Status           string              `json:"status" bson:"status"`                                         // e.g., "active", "paused", "expired"
+	AutoRenew        bool                `json:"autoRenew" bson:"autoRenew"`                                   // Whether the subscription should auto-renew
+	PaymentMethod    string              `json:"paymentMethod" bson:"paymentMethod"`                           // "whish" or "cash" - saved permanently
+	PausedAt         *time.Time          `json:"pausedAt,omitempty" bson:"pausedAt,omitempty"`                 // Set while the subscription is paused
+	RemainingDays    int                 `json:"remainingDays,omitempty" bson:"remainingDays,omitempty"`       // Days left when the subscription was paused
+	RenewalRequestID *primitive.ObjectID `json:"renewalRequestId,omitempty" bson:"renewalRequestId,omitempty"` // Pending auto-renewal request for the next period
+	GraceNotifiedAt  *time.Time          `json:"graceNotifiedAt,omitempty" bson:"graceNotifiedAt,omitempty"`   // When the owner was warned about the grace period
+	Trial            bool                `json:"trial,omitempty" bson:"trial,omitempty"`                       // Free trial granted on approval, nothing was paid for it
+	CreatedAt        time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time           `json:"updatedAt" bson:"updatedAt"`
 }
 
 // SubscriptionApprovalRequest represents the request body for approving/rejecting subscriptions
@@ -184,4 +189,23 @@ type BranchSubscriptionRequest struct {
 	PaymentStatus string    `json:"paymentStatus,omitempty" bson:"paymentStatus,omitempty"` // "pending", "success", "failed"
 	CollectURL    string    `json:"collectUrl,omitempty" bson:"collectUrl,omitempty"`       // Whish payment URL
 	PaidAt        time.Time `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+	// Set when the request renews an existing subscription
+	RenewalOf *primitive.ObjectID `json:"renewalOf,omitempty" bson:"renewalOf,omitempty"`
+	// Set when the request moves a running subscription to another plan
+	PlanChangeOf *primitive.ObjectID `json:"planChangeOf,omitempty" bson:"planChangeOf,omitempty"`
+	Amount       float64             `json:"amount,omitempty" bson:"amount,omitempty"` // Amount due in USD when it differs from the plan price
+	Credit       float64             `json:"credit,omitempty" bson:"credit,omitempty"` // Unused value of the replaced subscription
+	// Set when a promo code discounts the plan price; Amount then holds the discounted price
+	PromoCode string  `json:"promoCode,omitempty" bson:"promoCode,omitempty"`
+	Discount  float64 `json:"discount,omitempty" bson:"discount,omitempty"`
+	// Plan price in the currency it is set in, converted at the exchange rate locked when the payment was requested
+	CurrencyConversion `bson:",inline"`
+}
+
+// AmountDue returns what the request charges for a plan: the discounted or prorated amount when set, or the plan price
+func (r BranchSubscriptionRequest) AmountDue(planPrice float64) float64 {
+	if r.Amount > 0 {
+		return r.Amount
+	}
+	return planPrice
 }
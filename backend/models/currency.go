@@ -0,0 +1,121 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Currencies prices can be set in. Payments are always collected in USD.
+const (
+	CurrencyUSD = "USD"
+	CurrencyLBP = "LBP"
+)
+
+// ExchangeRateUSDLBP is the ID of the stored USD to LBP rate
+const ExchangeRateUSDLBP = "USD_LBP"
+
+// Where the stored exchange rate came from
+const (
+	ExchangeRateSourceDefault = "default" // EXCHANGE_RATE_USD_LBP, used until an admin sets a rate
+	ExchangeRateSourceManual  = "manual"
+	ExchangeRateSourceWhish   = "whish" // Refreshed from the payment gateway
+)
+
+// ExchangeRate is the stored number of Lebanese pounds per US dollar
+type ExchangeRate struct {
+	ID        string             `json:"id" bson:"_id"`
+	Rate      float64            `json:"rate" bson:"rate"`     // LBP per USD
+	Source    string             `json:"source" bson:"source"` // "default", "manual", or the payment gateway it was refreshed from
+	UpdatedBy primitive.ObjectID `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ExchangeRateRequest represents the request body for setting the exchange rate manually
+type ExchangeRateRequest struct {
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// ValidCurrency reports whether prices can be set in currency
+func ValidCurrency(currency string) bool {
+	return currency == CurrencyUSD || currency == CurrencyLBP
+}
+
+// PriceCurrency returns the currency a price was set in; prices stored before currencies were introduced are in USD
+func PriceCurrency(currency string) string {
+	if currency == "" {
+		return CurrencyUSD
+	}
+	return currency
+}
+
+// CurrencyConversion records an amount in the currency it was priced in, together with its USD and LBP
+// equivalents at the exchange rate that applied. It is embedded in payment requests, where the rate is
+// locked when the payment is requested, and in the wallet, commission and invoice records of the payment.
+type CurrencyConversion struct {
+	OriginalCurrency string  `json:"originalCurrency,omitempty" bson:"originalCurrency,omitempty"`
+	OriginalAmount   float64 `json:"originalAmount,omitempty" bson:"originalAmount,omitempty"`
+	AmountUSD        float64 `json:"amountUsd,omitempty" bson:"amountUsd,omitempty"`
+	AmountLBP        float64 `json:"amountLbp,omitempty" bson:"amountLbp,omitempty"`
+	ExchangeRate     float64 `json:"exchangeRate,omitempty" bson:"exchangeRate,omitempty"` // LBP per USD
+}
+
+// ConvertCurrency converts an amount priced in currency at rate LBP per USD
+func ConvertCurrency(amount float64, currency string, rate float64) CurrencyConversion {
+	conversion := CurrencyConversion{
+		OriginalCurrency: PriceCurrency(currency),
+		OriginalAmount:   amount,
+		ExchangeRate:     rate,
+	}
+	if conversion.OriginalCurrency == CurrencyLBP {
+		conversion.AmountLBP = math.Round(amount)
+		if rate > 0 {
+			conversion.AmountUSD = math.Round(amount/rate*100) / 100
+		}
+	} else {
+		conversion.AmountUSD = amount
+		conversion.AmountLBP = math.Round(amount * rate)
+	}
+	return conversion
+}
+
+// Share returns the conversion of a USD amount taken out of the payment this conversion was locked for,
+// such as a commission, expressed in the original currency at the same rate
+func (c CurrencyConversion) Share(amountUSD float64) CurrencyConversion {
+	share := CurrencyConversion{
+		OriginalCurrency: PriceCurrency(c.OriginalCurrency),
+		AmountUSD:        amountUSD,
+		AmountLBP:        math.Round(amountUSD * c.ExchangeRate),
+		ExchangeRate:     c.ExchangeRate,
+	}
+	share.OriginalAmount = share.AmountUSD
+	if share.OriginalCurrency == CurrencyLBP {
+		share.OriginalAmount = share.AmountLBP
+	}
+	return share
+}
+
+// DisplayPrice is a price shown in both currencies at the current exchange rate
+type DisplayPrice struct {
+	Currency     string  `json:"currency"` // Currency the price was set in
+	USD          float64 `json:"usd"`
+	LBP          float64 `json:"lbp"`
+	ExchangeRate float64 `json:"exchangeRate"`
+}
+
+// Convert converts an amount priced in currency at this rate
+func (r ExchangeRate) Convert(amount float64, currency string) CurrencyConversion {
+	return ConvertCurrency(amount, currency, r.Rate)
+}
+
+// Display returns an amount priced in currency in both USD and LBP at this rate
+func (r ExchangeRate) Display(amount float64, currency string) *DisplayPrice {
+	conversion := r.Convert(amount, currency)
+	return &DisplayPrice{
+		Currency:     conversion.OriginalCurrency,
+		USD:          conversion.AmountUSD,
+		LBP:          conversion.AmountLBP,
+		ExchangeRate: r.Rate,
+	}
+}
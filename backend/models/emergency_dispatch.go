@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Emergency dispatch statuses
+const (
+	DispatchStatusSearching = "searching" // Offers are out or the next round is due
+	DispatchStatusAssigned  = "assigned"  // A provider accepted
+	DispatchStatusExhausted = "exhausted" // No provider accepted within the largest radius
+	DispatchStatusCancelled = "cancelled" // The user cancelled the booking
+)
+
+// Emergency offer statuses
+const (
+	OfferStatusOffered   = "offered"
+	OfferStatusAccepted  = "accepted"
+	OfferStatusDeclined  = "declined"
+	OfferStatusExpired   = "expired"
+	OfferStatusWithdrawn = "withdrawn" // Another provider accepted first, or the dispatch ended
+)
+
+// EmergencyDispatch broadcasts an emergency booking to the nearest available providers of a service type,
+// round by round with a widening radius, until one of them accepts
+type EmergencyDispatch struct {
+	ID                 primitive.ObjectID       `json:"id,omitempty" bson:"_id,omitempty"`
+	BookingID          primitive.ObjectID       `json:"bookingId" bson:"bookingId"`
+	UserID             primitive.ObjectID       `json:"userId" bson:"userId"`
+	ServiceType        string                   `json:"serviceType" bson:"serviceType"`
+	Lat                float64                  `json:"lat" bson:"lat"`
+	Lng                float64                  `json:"lng" bson:"lng"`
+	Status             string                   `json:"status" bson:"status"`
+	Round              int                      `json:"round" bson:"round"`       // Rounds of offers sent so far
+	RadiusKm           float64                  `json:"radiusKm" bson:"radiusKm"` // Radius of the latest round
+	Offers             []EmergencyDispatchOffer `json:"offers" bson:"offers"`
+	Events             []EmergencyDispatchEvent `json:"events" bson:"events"` // Audit trail, oldest first
+	AssignedProviderID *primitive.ObjectID      `json:"assignedProviderId,omitempty" bson:"assignedProviderId,omitempty"`
+	CreatedAt          time.Time                `json:"createdAt" bson:"createdAt"`
+	UpdatedAt          time.Time                `json:"updatedAt" bson:"updatedAt"`
+}
+
+// EmergencyDispatchOffer is an emergency booking offered to one provider
+type EmergencyDispatchOffer struct {
+	ProviderUserID    primitive.ObjectID `json:"providerUserId" bson:"providerUserId"`       // The provider's user document
+	ServiceProviderID primitive.ObjectID `json:"serviceProviderId" bson:"serviceProviderId"` // Set on the booking when this provider accepts
+	ProviderName      string             `json:"providerName" bson:"providerName"`
+	DistanceKm        float64            `json:"distanceKm" bson:"distanceKm"`
+	Round             int                `json:"round" bson:"round"`
+	Status            string             `json:"status" bson:"status"`
+	OfferedAt         time.Time          `json:"offeredAt" bson:"offeredAt"`
+	ExpiresAt         time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RespondedAt       *time.Time         `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+}
+
+// EmergencyDispatchEvent is an entry of a dispatch's audit trail: "created", "offered", "declined", "expired",
+// "accepted", "withdrawn", "widened", "exhausted" or "cancelled"
+type EmergencyDispatchEvent struct {
+	Type           string              `json:"type" bson:"type"`
+	ProviderUserID *primitive.ObjectID `json:"providerUserId,omitempty" bson:"providerUserId,omitempty"`
+	Round          int                 `json:"round" bson:"round"`
+	RadiusKm       float64             `json:"radiusKm,omitempty" bson:"radiusKm,omitempty"`
+	Note           string              `json:"note,omitempty" bson:"note,omitempty"`
+	At             time.Time           `json:"at" bson:"at"`
+}
@@ -0,0 +1,151 @@
+package models
+
+import "fmt"
+
+// Unlimited marks a numeric entitlement without a limit
+const Unlimited = -1
+
+// Features checked against a plan's entitlements
+const (
+	EntitlementBranches           = "branches"
+	EntitlementImagesPerBranch    = "imagesPerBranch"
+	EntitlementVideosPerBranch    = "videosPerBranch"
+	EntitlementPortfolioImages    = "portfolioImages"
+	EntitlementSponsoredPlacement = "sponsoredPlacement"
+	EntitlementVoucherAccess      = "voucherAccess"
+	EntitlementBookingsPerMonth   = "bookingsPerMonth"
+)
+
+// Entitlements are the machine-readable limits a subscription plan grants.
+// Numeric limits use Unlimited (-1) for no limit and 0 to deny the feature.
+type Entitlements struct {
+	MaxBranches         int  `json:"maxBranches" bson:"maxBranches"`
+	MaxImagesPerBranch  int  `json:"maxImagesPerBranch" bson:"maxImagesPerBranch"`
+	MaxVideosPerBranch  int  `json:"maxVideosPerBranch" bson:"maxVideosPerBranch"`
+	MaxPortfolioImages  int  `json:"maxPortfolioImages" bson:"maxPortfolioImages"`
+	MaxBookingsPerMonth int  `json:"maxBookingsPerMonth" bson:"maxBookingsPerMonth"`
+	SponsoredPlacement  bool `json:"sponsoredPlacement" bson:"sponsoredPlacement"`
+	VoucherAccess       bool `json:"voucherAccess" bson:"voucherAccess"`
+}
+
+// FreeEntitlements are granted to accounts without an active subscription
+func FreeEntitlements() Entitlements {
+	return Entitlements{
+		MaxBranches:         1,
+		MaxImagesPerBranch:  3,
+		MaxVideosPerBranch:  0,
+		MaxPortfolioImages:  3,
+		MaxBookingsPerMonth: 10,
+	}
+}
+
+// UnlimitedEntitlements are granted by plans created before entitlements existed
+func UnlimitedEntitlements() Entitlements {
+	return Entitlements{
+		MaxBranches:         Unlimited,
+		MaxImagesPerBranch:  Unlimited,
+		MaxVideosPerBranch:  Unlimited,
+		MaxPortfolioImages:  Unlimited,
+		MaxBookingsPerMonth: Unlimited,
+		SponsoredPlacement:  true,
+		VoucherAccess:       true,
+	}
+}
+
+// Validate checks that every numeric limit is Unlimited or zero and above
+func (e Entitlements) Validate() error {
+	limits := map[string]int{
+		"maxBranches":         e.MaxBranches,
+		"maxImagesPerBranch":  e.MaxImagesPerBranch,
+		"maxVideosPerBranch":  e.MaxVideosPerBranch,
+		"maxPortfolioImages":  e.MaxPortfolioImages,
+		"maxBookingsPerMonth": e.MaxBookingsPerMonth,
+	}
+	for name, limit := range limits {
+		if limit < Unlimited {
+			return fmt.Errorf("invalid entitlement %s: must be -1 (unlimited) or 0 and above", name)
+		}
+	}
+	return nil
+}
+
+// Merge combines two sets of entitlements, keeping the more generous value of each
+func (e Entitlements) Merge(other Entitlements) Entitlements {
+	return Entitlements{
+		MaxBranches:         maxLimit(e.MaxBranches, other.MaxBranches),
+		MaxImagesPerBranch:  maxLimit(e.MaxImagesPerBranch, other.MaxImagesPerBranch),
+		MaxVideosPerBranch:  maxLimit(e.MaxVideosPerBranch, other.MaxVideosPerBranch),
+		MaxPortfolioImages:  maxLimit(e.MaxPortfolioImages, other.MaxPortfolioImages),
+		MaxBookingsPerMonth: maxLimit(e.MaxBookingsPerMonth, other.MaxBookingsPerMonth),
+		SponsoredPlacement:  e.SponsoredPlacement || other.SponsoredPlacement,
+		VoucherAccess:       e.VoucherAccess || other.VoucherAccess,
+	}
+}
+
+// Limit returns the numeric limit of a feature
+func (e Entitlements) Limit(feature string) int {
+	switch feature {
+	case EntitlementBranches:
+		return e.MaxBranches
+	case EntitlementImagesPerBranch:
+		return e.MaxImagesPerBranch
+	case EntitlementVideosPerBranch:
+		return e.MaxVideosPerBranch
+	case EntitlementPortfolioImages:
+		return e.MaxPortfolioImages
+	case EntitlementBookingsPerMonth:
+		return e.MaxBookingsPerMonth
+	case EntitlementSponsoredPlacement:
+		if e.SponsoredPlacement {
+			return Unlimited
+		}
+	case EntitlementVoucherAccess:
+		if e.VoucherAccess {
+			return Unlimited
+		}
+	}
+	return 0
+}
+
+// Allows reports whether count items of a feature fit within its limit
+func (e Entitlements) Allows(feature string, count int) bool {
+	limit := e.Limit(feature)
+	return limit == Unlimited || count <= limit
+}
+
+// EntitlementError is returned when an account's plan does not allow an action
+type EntitlementError struct {
+	Feature string
+	Limit   int
+}
+
+func (e *EntitlementError) Error() string {
+	switch {
+	case e.Feature == EntitlementSponsoredPlacement:
+		return "Your subscription plan does not include sponsored placement. Upgrade your plan to use this feature."
+	case e.Feature == EntitlementVoucherAccess:
+		return "Your subscription plan does not include voucher access. Upgrade your plan to use this feature."
+	case e.Limit == 0:
+		return fmt.Sprintf("Your subscription plan does not allow %s. Upgrade your plan to use this feature.", entitlementLabels[e.Feature])
+	default:
+		return fmt.Sprintf("Your subscription plan allows at most %d %s. Upgrade your plan to add more.", e.Limit, entitlementLabels[e.Feature])
+	}
+}
+
+var entitlementLabels = map[string]string{
+	EntitlementBranches:         "branches",
+	EntitlementImagesPerBranch:  "images per branch",
+	EntitlementVideosPerBranch:  "videos per branch",
+	EntitlementPortfolioImages:  "portfolio images",
+	EntitlementBookingsPerMonth: "bookings per month",
+}
+
+func maxLimit(a, b int) int {
+	if a == Unlimited || b == Unlimited {
+		return Unlimited
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What an invoice was issued for
+const (
+	InvoiceKindSubscription = "subscription"
+	InvoiceKindSponsorship  = "sponsorship"
+	InvoiceKindVoucher      = "voucher"
+)
+
+// Currencies invoices are issued in
+const (
+	InvoiceCurrencyUSD    = "USD"
+	InvoiceCurrencyPoints = "PTS" // Vouchers are bought with loyalty points
+)
+
+// Invoice is the receipt of one confirmed payment. Numbers are sequential across all invoices.
+type Invoice struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Number        string             `json:"number" bson:"number"` // e.g. "INV-000042"
+	Sequence      int64              `json:"sequence" bson:"sequence"`
+	Kind          string             `json:"kind" bson:"kind"`               // "subscription", "sponsorship", "voucher"
+	ReferenceID   primitive.ObjectID `json:"referenceId" bson:"referenceId"` // Subscription, sponsorship request or voucher purchase that was paid
+	EntityType    string             `json:"entityType" bson:"entityType"`   // Subscription kind, or the account type for vouchers
+	EntityID      primitive.ObjectID `json:"entityId" bson:"entityId"`       // Branch or service provider the payment was made for
+	EntityName    string             `json:"entityName" bson:"entityName"`   // Branch or business name
+	AccountType   string             `json:"accountType" bson:"accountType"` // "company", "wholesaler", "serviceProvider"
+	AccountID     primitive.ObjectID `json:"accountId" bson:"accountId"`     // Company, wholesaler or service provider document ID
+	BuyerName     string             `json:"buyerName" bson:"buyerName"`     // Business name of the account
+	ItemID        primitive.ObjectID `json:"itemId" bson:"itemId"`           // Plan, sponsorship or voucher bought
+	Description   string             `json:"description" bson:"description"` // e.g. "Branch Subscription - Gold"
+	PeriodStart   *time.Time         `json:"periodStart,omitempty" bson:"periodStart,omitempty"`
+	PeriodEnd     *time.Time         `json:"periodEnd,omitempty" bson:"periodEnd,omitempty"`
+	Amount        float64            `json:"amount" bson:"amount"`
+	Currency      string             `json:"currency" bson:"currency"`
+	PaymentMethod string             `json:"paymentMethod" bson:"paymentMethod"`               // "whish", "cash", "points"
+	ExternalID    int64              `json:"externalId,omitempty" bson:"externalId,omitempty"` // Whish externalId
+	PaymentRef    string             `json:"paymentRef,omitempty" bson:"paymentRef,omitempty"` // Processed Whish payment, if any
+	IssuedAt      time.Time          `json:"issuedAt" bson:"issuedAt"`
+	// Amount in the currency the item was priced in, at the rate locked for the payment; empty for vouchers
+	CurrencyConversion `bson:",inline"`
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lead pipeline stages
+const (
+	LeadStageNew         = "new"
+	LeadStageContacted   = "contacted"
+	LeadStageDemo        = "demo"
+	LeadStageNegotiating = "negotiating"
+	LeadStageWon         = "won"
+	LeadStageLost        = "lost"
+)
+
+// Lead sources
+const (
+	LeadSourceSalesperson = "salesperson"
+	LeadSourceSignup      = "signup"
+)
+
+// LeadStages lists the pipeline stages in order
+var LeadStages = []string{LeadStageNew, LeadStageContacted, LeadStageDemo, LeadStageNegotiating, LeadStageWon, LeadStageLost}
+
+// Lead is a prospect a salesperson is working on before the business is created
+type Lead struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id"`
+	SalespersonID  primitive.ObjectID  `json:"salespersonId" bson:"salespersonId"`
+	SalesManagerID primitive.ObjectID  `json:"salesManagerId,omitempty" bson:"salesManagerId,omitempty"`
+	BusinessName   string              `json:"businessName" bson:"businessName"`
+	EntityType     string              `json:"entityType,omitempty" bson:"entityType,omitempty"` // Expected kind of business: "company", "wholesaler", "serviceProvider"
+	Category       string              `json:"category,omitempty" bson:"category,omitempty"`
+	SubCategory    string              `json:"subCategory,omitempty" bson:"subCategory,omitempty"`
+	ContactPerson  string              `json:"contactPerson,omitempty" bson:"contactPerson,omitempty"`
+	Phone          string              `json:"phone,omitempty" bson:"phone,omitempty"`
+	WhatsApp       string              `json:"whatsapp,omitempty" bson:"whatsapp,omitempty"`
+	Email          string              `json:"email,omitempty" bson:"email,omitempty"`
+	Address        Address             `json:"address" bson:"address"`
+	Notes          string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	Source         string              `json:"source" bson:"source"`                               // "salesperson", or "signup" for businesses that signed up by themselves
+	EntityID       *primitive.ObjectID `json:"entityId,omitempty" bson:"entityId,omitempty"`       // Business that signed up by itself
+	TerritoryID    *primitive.ObjectID `json:"territoryId,omitempty" bson:"territoryId,omitempty"` // Territory a sign-up was routed through
+
+	Stage        string            `json:"stage" bson:"stage"`
+	StageHistory []LeadStageChange `json:"stageHistory" bson:"stageHistory"`
+	LostReason   string            `json:"lostReason,omitempty" bson:"lostReason,omitempty"`
+
+	NextFollowUpAt     *time.Time `json:"nextFollowUpAt,omitempty" bson:"nextFollowUpAt,omitempty"`
+	FollowUpNote       string     `json:"followUpNote,omitempty" bson:"followUpNote,omitempty"`
+	FollowUpNotifiedAt *time.Time `json:"followUpNotifiedAt,omitempty" bson:"followUpNotifiedAt,omitempty"` // Reminder sent for the current follow-up
+
+	Visits        []LeadVisit        `json:"visits" bson:"visits"`
+	Reassignments []LeadReassignment `json:"reassignments,omitempty" bson:"reassignments,omitempty"`
+	Conversion    *LeadConversion    `json:"conversion,omitempty" bson:"conversion,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// LeadStageChange records a move of a lead through the pipeline
+type LeadStageChange struct {
+	From string             `json:"from,omitempty" bson:"from,omitempty"`
+	To   string             `json:"to" bson:"to"`
+	Note string             `json:"note,omitempty" bson:"note,omitempty"`
+	By   primitive.ObjectID `json:"by" bson:"by"`
+	At   time.Time          `json:"at" bson:"at"`
+}
+
+// LeadVisit is a logged visit to a prospect
+type LeadVisit struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	VisitedAt time.Time          `json:"visitedAt" bson:"visitedAt"`
+	Lat       float64            `json:"lat,omitempty" bson:"lat,omitempty"`
+	Lng       float64            `json:"lng,omitempty" bson:"lng,omitempty"`
+	Outcome   string             `json:"outcome" bson:"outcome"`
+	By        primitive.ObjectID `json:"by" bson:"by"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// LeadReassignment records a lead moving to another salesperson
+type LeadReassignment struct {
+	From primitive.ObjectID `json:"from" bson:"from"`
+	To   primitive.ObjectID `json:"to" bson:"to"`
+	By   primitive.ObjectID `json:"by" bson:"by"`
+	Note string             `json:"note,omitempty" bson:"note,omitempty"`
+	At   time.Time          `json:"at" bson:"at"`
+}
+
+// LeadConversion links a won lead to the creation request it was turned into
+type LeadConversion struct {
+	EntityType string             `json:"entityType" bson:"entityType"` // "company", "wholesaler", "serviceProvider"
+	RequestID  primitive.ObjectID `json:"requestId" bson:"requestId"`   // Pending company, wholesaler or service provider request
+	EntityID   primitive.ObjectID `json:"entityId" bson:"entityId"`
+	At         time.Time          `json:"at" bson:"at"`
+}
+
+// LeadRequest represents the request body for creating or updating a lead
+type LeadRequest struct {
+	BusinessName   string     `json:"businessName" validate:"required"`
+	EntityType     string     `json:"entityType" validate:"omitempty,oneof=company wholesaler serviceProvider"`
+	Category       string     `json:"category"`
+	SubCategory    string     `json:"subCategory"`
+	ContactPerson  string     `json:"contactPerson"`
+	Phone          string     `json:"phone"`
+	WhatsApp       string     `json:"whatsapp"`
+	Email          string     `json:"email" validate:"omitempty,email"`
+	Address        Address    `json:"address"`
+	Notes          string     `json:"notes"`
+	NextFollowUpAt *time.Time `json:"nextFollowUpAt"`
+	FollowUpNote   string     `json:"followUpNote"`
+}
+
+// LeadStageRequest represents the request body for moving a lead to another stage
+type LeadStageRequest struct {
+	Stage      string `json:"stage" validate:"required,oneof=new contacted demo negotiating won lost"`
+	Note       string `json:"note"`
+	LostReason string `json:"lostReason"`
+}
+
+// LeadFollowUpRequest represents the request body for scheduling the next follow-up of a lead
+type LeadFollowUpRequest struct {
+	At   time.Time `json:"at" validate:"required"`
+	Note string    `json:"note"`
+}
+
+// LeadVisitRequest represents the request body for logging a visit
+type LeadVisitRequest struct {
+	VisitedAt *time.Time `json:"visitedAt"` // Defaults to now
+	Lat       float64    `json:"lat"`
+	Lng       float64    `json:"lng"`
+	Outcome   string     `json:"outcome" validate:"required"`
+}
+
+// LeadReassignRequest represents the request body for handing a lead to another salesperson
+type LeadReassignRequest struct {
+	SalespersonID string `json:"salespersonId" validate:"required"`
+	Note          string `json:"note"`
+}
+
+// LeadConvertRequest represents the request body for turning a won lead into a creation request.
+// Empty fields are filled from the lead.
+type LeadConvertRequest struct {
+	EntityType    string  `json:"entityType" validate:"omitempty,oneof=company wholesaler serviceProvider"`
+	Password      string  `json:"password" validate:"required,min=6"`
+	BusinessName  string  `json:"businessName"`
+	Category      string  `json:"category"`
+	SubCategory   string  `json:"subCategory"`
+	ContactPerson string  `json:"contactPerson"`
+	Phone         string  `json:"phone"`
+	ContactPhone  string  `json:"contactPhone"`
+	Email         string  `json:"email" validate:"omitempty,email"`
+	Address       Address `json:"address"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProcessedPayment is the idempotency record of a Whish payment that activated a request.
+// Its ID is built from the payment kind and the Whish externalId, so a payment can only be applied once.
+type ProcessedPayment struct {
+	ID          string             `json:"id" bson:"_id"`
+	Kind        string             `json:"kind" bson:"kind"` // "company_branch", "wholesaler_branch", "service_provider", "sponsorship"
+	ExternalID  int64              `json:"externalId" bson:"externalId"`
+	RequestID   primitive.ObjectID `json:"requestId" bson:"requestId"`
+	Amount      float64            `json:"amount" bson:"amount"`
+	PayerPhone  string             `json:"payerPhone,omitempty" bson:"payerPhone,omitempty"`
+	ProcessedAt time.Time          `json:"processedAt" bson:"processedAt"`
+}
+
+// PaymentAnomaly records a Whish callback that could not be matched to its request
+type PaymentAnomaly struct {
+	ID             primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Kind           string              `json:"kind" bson:"kind"`
+	ExternalID     int64               `json:"externalId" bson:"externalId"`
+	RequestID      *primitive.ObjectID `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	Reason         string              `json:"reason" bson:"reason"` // "unknown_external_id", "amount_mismatch"
+	ExpectedAmount float64             `json:"expectedAmount,omitempty" bson:"expectedAmount,omitempty"`
+	ReportedAmount float64             `json:"reportedAmount,omitempty" bson:"reportedAmount,omitempty"`
+	PayerPhone     string              `json:"payerPhone,omitempty" bson:"payerPhone,omitempty"`
+	RemoteAddr     string              `json:"remoteAddr,omitempty" bson:"remoteAddr,omitempty"`
+	Occurrences    int                 `json:"occurrences" bson:"occurrences"` // Number of callbacks received for the same anomaly
+	Status         string              `json:"status" bson:"status"`           // "open", "resolved"
+	ResolvedBy     *primitive.ObjectID `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolutionNote string              `json:"resolutionNote,omitempty" bson:"resolutionNote,omitempty"`
+	ResolvedAt     *time.Time          `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	LastSeenAt     time.Time           `json:"lastSeenAt" bson:"lastSeenAt"`
+}
+
+// ResolvePaymentAnomalyRequest is the body used by admins to close an anomaly
+type ResolvePaymentAnomalyRequest struct {
+	Note string `json:"note"`
+}
+
+// WhishReconciliationReport compares the Whish payments applied during one day with what the ledger recorded for them
+type WhishReconciliationReport struct {
+	ID             string                              `json:"id" bson:"_id"` // Day in YYYY-MM-DD
+	From           time.Time                           `json:"from" bson:"from"`
+	To             time.Time                           `json:"to" bson:"to"`
+	ConfirmedCount int                                 `json:"confirmedCount" bson:"confirmedCount"`
+	ConfirmedTotal float64                             `json:"confirmedTotal" bson:"confirmedTotal"` // Amounts confirmed by Whish
+	RecordedTotal  float64                             `json:"recordedTotal" bson:"recordedTotal"`   // Cash the ledger recorded for those payments
+	Difference     float64                             `json:"difference" bson:"difference"`
+	ByKind         map[string]WhishReconciliationTotal `json:"byKind" bson:"byKind"`
+	Mismatches     []WhishReconciliationMismatch       `json:"mismatches" bson:"mismatches"`
+	FailedCount    int                                 `json:"failedCount" bson:"failedCount"`   // Requests Whish reported as failed during the day
+	ExpiredCount   int                                 `json:"expiredCount" bson:"expiredCount"` // Requests whose collect URL expired during the day
+	PendingCount   int                                 `json:"pendingCount" bson:"pendingCount"` // Requests still waiting for payment when the report was generated
+	OpenAnomalies  int                                 `json:"openAnomalies" bson:"openAnomalies"`
+	GeneratedAt    time.Time                           `json:"generatedAt" bson:"generatedAt"`
+}
+
+// WhishReconciliationTotal holds the confirmed and recorded totals of one kind of payment
+type WhishReconciliationTotal struct {
+	Count     int     `json:"count" bson:"count"`
+	Confirmed float64 `json:"confirmed" bson:"confirmed"`
+	Recorded  float64 `json:"recorded" bson:"recorded"`
+}
+
+// WhishReconciliationMismatch is a payment whose ledger postings do not add up to the confirmed amount
+type WhishReconciliationMismatch struct {
+	PaymentID string             `json:"paymentId" bson:"paymentId"`
+	Kind      string             `json:"kind" bson:"kind"`
+	RequestID primitive.ObjectID `json:"requestId" bson:"requestId"`
+	Confirmed float64            `json:"confirmed" bson:"confirmed"`
+	Recorded  float64            `json:"recorded" bson:"recorded"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payout run statuses
+const (
+	PayoutRunDraft     = "draft"     // Gathered, waiting for a finance admin to review and confirm
+	PayoutRunConfirmed = "confirmed" // Every included payee was paid
+	PayoutRunCancelled = "cancelled"
+)
+
+// How a payout run was started
+const (
+	PayoutTriggerManual    = "manual"
+	PayoutTriggerScheduled = "scheduled"
+)
+
+// Payout item statuses
+const (
+	PayoutItemIncluded     = "included"
+	PayoutItemBelowMinimum = "below_minimum" // Balance under the minimum payout of the run
+	PayoutItemHeld         = "held"          // Payee on hold, or left out of the run by an admin
+	PayoutItemPaid         = "paid"
+)
+
+// PayoutRun is a batch payout of the commission and referral balances owed to salespersons and sales managers
+type PayoutRun struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id"`
+	Number      string              `json:"number" bson:"number"` // e.g. "PAY-000007"
+	Status      string              `json:"status" bson:"status"` // "draft", "confirmed", "cancelled"
+	Trigger     string              `json:"trigger" bson:"trigger"`
+	MinAmount   float64             `json:"minAmount" bson:"minAmount"`
+	Cutoff      time.Time           `json:"cutoff" bson:"cutoff"` // Commissions earned up to this time are settled by the run
+	Items       []PayoutItem        `json:"items" bson:"items"`
+	TotalAmount float64             `json:"totalAmount" bson:"totalAmount"` // Sum of the included items
+	PayeeCount  int                 `json:"payeeCount" bson:"payeeCount"`
+	CreatedBy   *primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"` // Empty for scheduled runs
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	ConfirmedBy *primitive.ObjectID `json:"confirmedBy,omitempty" bson:"confirmedBy,omitempty"`
+	ConfirmedAt *time.Time          `json:"confirmedAt,omitempty" bson:"confirmedAt,omitempty"`
+	CancelledBy *primitive.ObjectID `json:"cancelledBy,omitempty" bson:"cancelledBy,omitempty"`
+	CancelledAt *time.Time          `json:"cancelledAt,omitempty" bson:"cancelledAt,omitempty"`
+	Note        string              `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// PayoutItem is what one salesperson or sales manager is paid in a run
+type PayoutItem struct {
+	UserID            primitive.ObjectID `json:"userId" bson:"userId"`
+	UserType          string             `json:"userType" bson:"userType"` // "salesperson", "sales_manager"
+	Name              string             `json:"name" bson:"name"`
+	Email             string             `json:"email,omitempty" bson:"email,omitempty"`
+	CommissionBalance float64            `json:"commissionBalance" bson:"commissionBalance"`                 // Ledger balance when the run was gathered
+	ReferralBalance   float64            `json:"referralBalance,omitempty" bson:"referralBalance,omitempty"` // Ledger balance when the run was gathered
+	Amount            float64            `json:"amount" bson:"amount"`                                       // Commission and referral balance paid out
+	Status            string             `json:"status" bson:"status"`
+	HoldReason        string             `json:"holdReason,omitempty" bson:"holdReason,omitempty"`
+
+	// Pending withdrawal requests settled by the payout, and the withdrawal recorded for the rest of the balance
+	WithdrawalIDs      []primitive.ObjectID `json:"withdrawalIds,omitempty" bson:"withdrawalIds,omitempty"`
+	PayoutWithdrawalID *primitive.ObjectID  `json:"payoutWithdrawalId,omitempty" bson:"payoutWithdrawalId,omitempty"`
+
+	// Commission entries earned up to the cutoff and marked paid when the run is confirmed
+	CommissionIDs         []primitive.ObjectID `json:"commissionIds,omitempty" bson:"commissionIds,omitempty"`
+	CommissionRecordIDs   []primitive.ObjectID `json:"commissionRecordIds,omitempty" bson:"commissionRecordIds,omitempty"`
+	ReferralCommissionIDs []primitive.ObjectID `json:"referralCommissionIds,omitempty" bson:"referralCommissionIds,omitempty"`
+}
+
+// UpdateTotals recomputes the amount and number of payees paid by the run
+func (r *PayoutRun) UpdateTotals() {
+	r.TotalAmount, r.PayeeCount = 0, 0
+	for _, item := range r.Items {
+		if item.Status == PayoutItemIncluded || item.Status == PayoutItemPaid {
+			r.TotalAmount += item.Amount
+			r.PayeeCount++
+		}
+	}
+	r.TotalAmount = math.Round(r.TotalAmount*100) / 100
+}
+
+// PayoutHold keeps a salesperson or sales manager out of payout runs until it is released
+type PayoutHold struct {
+	UserID    primitive.ObjectID `json:"userId" bson:"_id"`
+	UserType  string             `json:"userType" bson:"userType"`
+	Reason    string             `json:"reason" bson:"reason"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// PayoutRunRequest represents the request body for starting a payout run
+type PayoutRunRequest struct {
+	MinAmount *float64 `json:"minAmount,omitempty"` // Defaults to PAYOUT_MIN_AMOUNT
+	Note      string   `json:"note,omitempty"`
+}
+
+// PayoutHoldRequest represents the request body for holding a payee, or an item of a draft run
+type PayoutHoldRequest struct {
+	UserID   string `json:"userId,omitempty"`
+	UserType string `json:"userType,omitempty" validate:"omitempty,oneof=salesperson sales_manager"`
+	Reason   string `json:"reason" validate:"required"`
+}
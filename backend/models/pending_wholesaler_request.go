@@ -7,14 +7,16 @@ import (
 )
 
 type PendingWholesalerRequest struct {
-	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Wholesaler       Wholesaler         `bson:"wholesaler" json:"wholesaler"`
-	Email            string             `bson:"email,omitempty" json:"email,omitempty"`
-	AdditionalEmails []string           `bson:"additionalEmails,omitempty" json:"additionalEmails,omitempty"`
-	Password         string             `bson:"password,omitempty" json:"password,omitempty"`
-	SalesPersonID    primitive.ObjectID `bson:"salesPersonId" json:"salesPersonId"`
-	SalesManagerID   primitive.ObjectID `bson:"salesManagerId" json:"salesManagerId"`
-	Reason           string             `bson:"reason,omitempty" json:"reason,omitempty"`
-	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt        time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Wholesaler       Wholesaler          `bson:"wholesaler" json:"wholesaler"`
+	Email            string              `bson:"email,omitempty" json:"email,omitempty"`
+	AdditionalEmails []string            `bson:"additionalEmails,omitempty" json:"additionalEmails,omitempty"`
+	Password         string              `bson:"password,omitempty" json:"password,omitempty"`
+	SalesPersonID    primitive.ObjectID  `bson:"salesPersonId" json:"salesPersonId"`
+	SalesManagerID   primitive.ObjectID  `bson:"salesManagerId" json:"salesManagerId"`
+	TrialPlanID      *primitive.ObjectID `bson:"trialPlanId,omitempty" json:"trialPlanId,omitempty"`           // Plan to start a free trial on once approved
+	OutsideTerritory bool                `bson:"outsideTerritory,omitempty" json:"outsideTerritory,omitempty"` // The business is outside the territories of the salesperson
+	Reason           string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt        time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt        time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
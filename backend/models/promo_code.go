@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promo code discount types
+const (
+	PromoDiscountPercentage = "percentage"
+	PromoDiscountFixed      = "fixed"
+)
+
+// Promo code redemption statuses
+const (
+	PromoRedemptionReserved = "reserved" // The request was created and awaits payment or approval
+	PromoRedemptionRedeemed = "redeemed" // The discounted subscription was activated
+	PromoRedemptionReleased = "released" // The request failed, expired or was rejected
+)
+
+// PromoCode is an admin-managed discount on subscription plans
+type PromoCode struct {
+	ID                primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	Code              string               `json:"code" bson:"code"` // Stored upper-case
+	Description       string               `json:"description,omitempty" bson:"description,omitempty"`
+	DiscountType      string               `json:"discountType" bson:"discountType"`   // "percentage" or "fixed"
+	DiscountValue     float64              `json:"discountValue" bson:"discountValue"` // Percent off, or USD off
+	ValidFrom         time.Time            `json:"validFrom" bson:"validFrom"`
+	ValidUntil        time.Time            `json:"validUntil" bson:"validUntil"`
+	MaxUses           int                  `json:"maxUses" bson:"maxUses"`                     // 0 for no total cap
+	MaxUsesPerAccount int                  `json:"maxUsesPerAccount" bson:"maxUsesPerAccount"` // 0 for no per-account cap
+	UsedCount         int                  `json:"usedCount" bson:"usedCount"`
+	PlanTypes         []string             `json:"planTypes,omitempty" bson:"planTypes,omitempty"`           // Empty for all plan types
+	SalespersonIDs    []primitive.ObjectID `json:"salespersonIds,omitempty" bson:"salespersonIds,omitempty"` // Only accounts brought in by these salespersons
+	IsActive          bool                 `json:"isActive" bson:"isActive"`
+	CreatedBy         primitive.ObjectID   `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	CreatedAt         time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// PromoCodeRequest represents the request body for creating or updating a promo code
+type PromoCodeRequest struct {
+	Code              string    `json:"code" validate:"required"`
+	Description       string    `json:"description"`
+	DiscountType      string    `json:"discountType" validate:"required,oneof=percentage fixed"`
+	DiscountValue     float64   `json:"discountValue" validate:"required,gt=0"`
+	ValidFrom         time.Time `json:"validFrom" validate:"required"`
+	ValidUntil        time.Time `json:"validUntil" validate:"required"`
+	MaxUses           int       `json:"maxUses" validate:"gte=0"`
+	MaxUsesPerAccount int       `json:"maxUsesPerAccount" validate:"gte=0"`
+	PlanTypes         []string  `json:"planTypes" validate:"omitempty,dive,oneof=company wholesaler serviceProvider"`
+	SalespersonIDs    []string  `json:"salespersonIds"`
+	IsActive          *bool     `json:"isActive"`
+}
+
+// Validate checks the discount and the validity window
+func (r PromoCodeRequest) Validate() error {
+	if r.DiscountType == PromoDiscountPercentage && r.DiscountValue >= 100 {
+		return fmt.Errorf("percentage discount must be below 100")
+	}
+	if !r.ValidUntil.After(r.ValidFrom) {
+		return fmt.Errorf("validUntil must be after validFrom")
+	}
+	return nil
+}
+
+// Discount returns the discount the code gives on a price, rounded to cents
+func (p PromoCode) Discount(price float64) float64 {
+	discount := p.DiscountValue
+	if p.DiscountType == PromoDiscountPercentage {
+		discount = price * p.DiscountValue / 100
+	}
+	return math.Round(math.Min(discount, price)*100) / 100
+}
+
+// PromoCodeRedemption records the use of a promo code by an account for one subscription request
+type PromoCodeRedemption struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	PromoCodeID    primitive.ObjectID `json:"promoCodeId" bson:"promoCodeId"`
+	Code           string             `json:"code" bson:"code"`
+	AccountID      primitive.ObjectID `json:"accountId" bson:"accountId"` // Company, wholesaler or service provider
+	Kind           string             `json:"kind" bson:"kind"`
+	EntityID       primitive.ObjectID `json:"entityId" bson:"entityId"` // Branch or service provider
+	RequestID      primitive.ObjectID `json:"requestId" bson:"requestId"`
+	PlanID         primitive.ObjectID `json:"planId" bson:"planId"`
+	OriginalAmount float64            `json:"originalAmount" bson:"originalAmount"`
+	Discount       float64            `json:"discount" bson:"discount"`
+	Amount         float64            `json:"amount" bson:"amount"`
+	Status         string             `json:"status" bson:"status"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
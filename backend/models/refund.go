@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refund statuses
+const (
+	RefundStatusProcessing = "processing" // Recorded and being sent through the payment gateway
+	RefundStatusIssued     = "issued"     // Returned to the payer through the payment gateway
+	RefundStatusManual     = "manual"     // To be paid out by an admin, in cash or from the gateway portal
+	RefundStatusPaidOut    = "paid_out"   // Paid out by an admin
+)
+
+// Refund is the prorated refund issued when a paid subscription is cancelled before its end date
+type Refund struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id"`
+	Kind           string               `json:"kind" bson:"kind"` // "company_branch", "wholesaler_branch", "service_provider"
+	SubscriptionID primitive.ObjectID   `json:"subscriptionId" bson:"subscriptionId"`
+	EntityID       primitive.ObjectID   `json:"entityId" bson:"entityId"`
+	PlanID         primitive.ObjectID   `json:"planId" bson:"planId"`
+	PaymentMethod  string               `json:"paymentMethod" bson:"paymentMethod"` // "whish" or "cash"
+	ExternalID     int64                `json:"externalId,omitempty" bson:"externalId,omitempty"`
+	PaidAmount     float64              `json:"paidAmount" bson:"paidAmount"`
+	TotalDays      int                  `json:"totalDays" bson:"totalDays"`
+	UnusedDays     int                  `json:"unusedDays" bson:"unusedDays"`
+	Amount         float64              `json:"amount" bson:"amount"`
+	Status         string               `json:"status" bson:"status"`
+	GatewayError   string               `json:"gatewayError,omitempty" bson:"gatewayError,omitempty"`
+	Clawbacks      []CommissionClawback `json:"clawbacks" bson:"clawbacks"`
+	RequestedBy    primitive.ObjectID   `json:"requestedBy" bson:"requestedBy"`
+	PaidOutBy      *primitive.ObjectID  `json:"paidOutBy,omitempty" bson:"paidOutBy,omitempty"`
+	PaidOutAt      *time.Time           `json:"paidOutAt,omitempty" bson:"paidOutAt,omitempty"`
+	Reference      string               `json:"reference,omitempty" bson:"reference,omitempty"` // Whish portal or receipt reference of a manual payout
+	Note           string               `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt      time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// RefundPaidOutRequest is the body used by admins to record a manual refund as paid out
+type RefundPaidOutRequest struct {
+	Reference string `json:"reference"`
+	Note      string `json:"note"`
+}
+
+// CommissionClawback is the part of a commission taken back from a salesperson or sales manager by a refund
+type CommissionClawback struct {
+	Role   string             `json:"role" bson:"role"` // "salesperson" or "sales_manager"
+	UserID primitive.ObjectID `json:"userId" bson:"userId"`
+	Amount float64            `json:"amount" bson:"amount"`
+	// Part of the clawback that exceeded the commission balance because it was already withdrawn;
+	// it is netted against future commissions before the next payout
+	Outstanding float64 `json:"outstanding,omitempty" bson:"outstanding,omitempty"`
+}
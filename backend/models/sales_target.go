@@ -0,0 +1,119 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sales target period types
+const (
+	SalesTargetMonthly   = "monthly"   // Period "2026-10"
+	SalesTargetQuarterly = "quarterly" // Period "2026-Q4"
+)
+
+// Sales target statuses
+const (
+	SalesTargetOpen     = "open"     // The period has not ended
+	SalesTargetAchieved = "achieved" // Every goal was reached
+	SalesTargetMissed   = "missed"   // The period ended before every goal was reached
+)
+
+// SalesGoals are the numbers a salesperson is asked to reach in a period; zero goals are not tracked
+type SalesGoals struct {
+	Companies        int     `json:"companies" bson:"companies"`               // Companies created
+	Wholesalers      int     `json:"wholesalers" bson:"wholesalers"`           // Wholesalers created
+	ServiceProviders int     `json:"serviceProviders" bson:"serviceProviders"` // Service providers created
+	Subscriptions    int     `json:"subscriptions" bson:"subscriptions"`       // Paid subscriptions of the businesses they created
+	Revenue          float64 `json:"revenue" bson:"revenue"`                   // Amount paid for those subscriptions, in USD
+}
+
+// SalesTarget is a monthly or quarterly goal set for a salesperson by their sales manager or an admin
+type SalesTarget struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	SalespersonID  primitive.ObjectID `json:"salespersonId" bson:"salespersonId"`
+	SalesManagerID primitive.ObjectID `json:"salesManagerId,omitempty" bson:"salesManagerId,omitempty"` // Team the salesperson belonged to when the target was set
+	PeriodType     string             `json:"periodType" bson:"periodType"`
+	Period         string             `json:"period" bson:"period"`
+	PeriodStart    time.Time          `json:"periodStart" bson:"periodStart"`
+	PeriodEnd      time.Time          `json:"periodEnd" bson:"periodEnd"` // Exclusive
+	Goals          SalesGoals         `json:"goals" bson:"goals"`
+	Status         string             `json:"status" bson:"status"`
+	Progress       *SalesGoals        `json:"progress,omitempty" bson:"progress,omitempty"` // Final figures, stored when the period ends
+	Note           string             `json:"note,omitempty" bson:"note,omitempty"`
+
+	// Optional bonus commission paid once every goal is reached
+	BonusAmount float64    `json:"bonusAmount,omitempty" bson:"bonusAmount,omitempty"`
+	BonusPaidAt *time.Time `json:"bonusPaidAt,omitempty" bson:"bonusPaidAt,omitempty"`
+
+	CreatedBy     primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedByType string             `json:"createdByType" bson:"createdByType"` // "admin", "sales_manager"
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SalesTargetRequest represents the request body for setting a sales target
+type SalesTargetRequest struct {
+	SalespersonID string     `json:"salespersonId" validate:"required"`
+	PeriodType    string     `json:"periodType" validate:"required,oneof=monthly quarterly"`
+	Period        string     `json:"period" validate:"required"` // "2026-10" or "2026-Q4"
+	Goals         SalesGoals `json:"goals"`
+	BonusAmount   float64    `json:"bonusAmount" validate:"gte=0"`
+	Note          string     `json:"note"`
+}
+
+// SalesTargetUpdateRequest represents the request body for changing the goals of a target
+type SalesTargetUpdateRequest struct {
+	Goals       SalesGoals `json:"goals"`
+	BonusAmount float64    `json:"bonusAmount" validate:"gte=0"`
+	Note        string     `json:"note"`
+}
+
+// Empty reports whether no goal is set
+func (g SalesGoals) Empty() bool {
+	return g.Companies <= 0 && g.Wholesalers <= 0 && g.ServiceProviders <= 0 && g.Subscriptions <= 0 && g.Revenue <= 0
+}
+
+// Valid reports whether no goal is negative
+func (g SalesGoals) Valid() bool {
+	return g.Companies >= 0 && g.Wholesalers >= 0 && g.ServiceProviders >= 0 && g.Subscriptions >= 0 && g.Revenue >= 0
+}
+
+// Completion returns how far the figures are towards the goals, from 0 to 100, averaged over the goals that are set.
+// Each goal counts for at most 100.
+func (g SalesGoals) Completion(figures SalesGoals) float64 {
+	ratios := []float64{}
+	add := func(goal, figure float64) {
+		if goal <= 0 {
+			return
+		}
+		ratio := figure / goal
+		if ratio > 1 {
+			ratio = 1
+		}
+		ratios = append(ratios, ratio)
+	}
+	add(float64(g.Companies), float64(figures.Companies))
+	add(float64(g.Wholesalers), float64(figures.Wholesalers))
+	add(float64(g.ServiceProviders), float64(figures.ServiceProviders))
+	add(float64(g.Subscriptions), float64(figures.Subscriptions))
+	add(g.Revenue, figures.Revenue)
+	if len(ratios) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, ratio := range ratios {
+		total += ratio
+	}
+	return total / float64(len(ratios)) * 100
+}
+
+// ReachedBy reports whether the figures reach every goal that is set
+func (g SalesGoals) ReachedBy(figures SalesGoals) bool {
+	return !g.Empty() &&
+		figures.Companies >= g.Companies &&
+		figures.Wholesalers >= g.Wholesalers &&
+		figures.ServiceProviders >= g.ServiceProviders &&
+		figures.Subscriptions >= g.Subscriptions &&
+		figures.Revenue >= g.Revenue
+}
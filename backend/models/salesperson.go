@@ -42,6 +42,9 @@ type CommissionRecord struct {
 	SalesManagerID primitive.ObjectID `bson:"salesManagerId" json:"salesManagerId"`
 	Amount         float64            `bson:"amount" json:"amount"`
 	Role           string             `bson:"role" json:"role"`
-	Status         string             `bson:"status" json:"status"` // pending, paid
+	Status         string             `bson:"status" json:"status"` // pending, paid, clawback
 	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	PaidAt         *time.Time         `bson:"paidAt,omitempty" json:"paidAt,omitempty"` // Set by the payout run that paid it
+	// Amount (USD) in the currency the payment was priced in, at the rate locked for it
+	CurrencyConversion `bson:",inline"`
 }
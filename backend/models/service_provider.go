@@ -8,16 +8,21 @@ import (
 
 // ServiceProviderSubscription represents a service provider's subscription
 type ServiceProviderSubscription struct {
-	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	ServiceProviderID primitive.ObjectID `json:"serviceProviderId" bson:"serviceProviderId"` // Reference to the service provider
-	PlanID            primitive.ObjectID `json:"planId" bson:"planId"`                       // Reference to the subscribed plan
-	StartDate         time.Time          `json:"startDate" bson:"startDate"`
-	EndDate           time.Time          `json:"endDate" bson:"endDate"`
-	Status            string             `json:"status" bson:"status"`               // e.g., "active", "paused", "expired"
-	AutoRenew         bool               `json:"autoRenew" bson:"autoRenew"`         // Whether the subscription should auto-renew
-	PaymentMethod     string             `json:"paymentMethod" bson:"paymentMethod"` // "whish" or "cash" - saved permanently
-	CreatedAt         time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt         time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID                primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	ServiceProviderID primitive.ObjectID  `json:"serviceProviderId" bson:"serviceProviderId"` // Reference to the service provider
+	PlanID            primitive.ObjectID  `json:"planId" bson:"planId"`                       // Reference to the subscribed plan
+	StartDate         time.Time           `json:"startDate" bson:"startDate"`
+	EndDate           time.Time           `json:"endDate" bson:"endDate"`
+	Status            string              `json:"status" bson:"status"`                                         // e.g., "active", "paused", "expired"
+	AutoRenew         bool                `json:"autoRenew" bson:"autoRenew"`                                   // Whether the subscription should auto-renew
+	PaymentMethod     string              `json:"paymentMethod" bson:"paymentMethod"`                           // "whish" or "cash" - saved permanently
+	PausedAt          *time.Time          `json:"pausedAt,omitempty" bson:"pausedAt,omitempty"`                 // Set while the subscription is paused
+	RemainingDays     int                 `json:"remainingDays,omitempty" bson:"remainingDays,omitempty"`       // Days left when the subscription was paused
+	RenewalRequestID  *primitive.ObjectID `json:"renewalRequestId,omitempty" bson:"renewalRequestId,omitempty"` // Pending auto-renewal request for the next period
+	GraceNotifiedAt   *time.Time          `json:"graceNotifiedAt,omitempty" bson:"graceNotifiedAt,omitempty"`   // When the owner was warned about the grace period
+	Trial             bool                `json:"trial,omitempty" bson:"trial,omitempty"`                       // Free trial granted on approval, nothing was paid for it
+	CreatedAt         time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         time.Time           `json:"updatedAt" bson:"updatedAt"`
 }
 
 // ServiceProviderSubscriptionRequest represents a pending subscription request that needs admin approval
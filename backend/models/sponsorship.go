@@ -54,6 +54,8 @@ type Sponsorship struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Title       string             `json:"title" bson:"title" validate:"required"`
 	Price       float64            `json:"price" bson:"price" validate:"required,gt=0"`
+	Currency    string             `json:"currency,omitempty" bson:"currency,omitempty"` // Currency Price is set in, "USD" when empty
+	Prices      *DisplayPrice      `json:"prices,omitempty" bson:"-"`                    // Price in USD and LBP, filled when sponsorships are listed
 	Duration    int                `json:"duration" bson:"duration" validate:"required,min=1,max=365"` // Duration in days
 	DurationInfo DurationInfo      `json:"durationInfo,omitempty" bson:"durationInfo,omitempty"`       // Calculated duration breakdown
 	Discount    float64            `json:"discount" bson:"discount" validate:"gte=0,lte=100"` // Discount percentage
@@ -69,6 +71,7 @@ type Sponsorship struct {
 type SponsorshipRequest struct {
 	Title     string    `json:"title" validate:"required"`
 	Price     float64   `json:"price" validate:"required,gt=0"`
+	Currency  string    `json:"currency" validate:"omitempty,oneof=USD LBP"`
 	Duration  int       `json:"duration" validate:"required,min=1,max=365"`
 	Discount  float64   `json:"discount" validate:"gte=0,lte=100"`
 	StartDate time.Time `json:"startDate" validate:"required"`
@@ -79,6 +82,7 @@ type SponsorshipRequest struct {
 type SponsorshipUpdateRequest struct {
 	Title     *string    `json:"title,omitempty"`
 	Price     *float64   `json:"price,omitempty" validate:"omitempty,gt=0"`
+	Currency  *string    `json:"currency,omitempty" validate:"omitempty,oneof=USD LBP"`
 	Duration  *int       `json:"duration,omitempty" validate:"omitempty,min=1,max=365"`
 	Discount  *float64   `json:"discount,omitempty" validate:"omitempty,gte=0,lte=100"`
 	StartDate *time.Time `json:"startDate,omitempty"`
@@ -46,6 +46,17 @@ type SponsorshipSubscriptionRequest struct {
 	PaymentStatus string    `json:"paymentStatus,omitempty" bson:"paymentStatus,omitempty"` // "pending", "success", "failed"
 	CollectURL    string    `json:"collectUrl,omitempty" bson:"collectUrl,omitempty"`       // Whish payment URL
 	PaidAt        time.Time `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+	Amount        float64   `json:"amount,omitempty" bson:"amount,omitempty"` // Amount due in USD, locked when the payment was requested
+	// Sponsorship price in the currency it is set in, converted at the exchange rate locked when the payment was requested
+	CurrencyConversion `bson:",inline"`
+}
+
+// AmountDue returns what the request charges for a sponsorship: the amount locked at request time, or the sponsorship price
+func (r SponsorshipSubscriptionRequest) AmountDue(sponsorshipPrice float64) float64 {
+	if r.Amount > 0 {
+		return r.Amount
+	}
+	return sponsorshipPrice
 }
 
 // SponsorshipSubscriptionApprovalRequest represents the request body for approving/rejecting subscriptions
@@ -82,25 +82,32 @@ func (b Benefits) GetMaps() []map[string]string {
 
 // SubscriptionPlan represents a subscription plan for companies, wholesalers, and service providers
 type SubscriptionPlan struct {
-	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Title     string             `json:"title,omitempty" bson:"title,omitempty"`
-	Price     float64            `json:"price,omitempty" bson:"price,omitempty"`
-	Duration  int                `json:"duration,omitempty" bson:"duration,omitempty"`
-	Type      string             `json:"type,omitempty" bson:"type,omitempty"`
-	Benefits  Benefits           `json:"benefits,omitempty" bson:"benefits,omitempty"`
-	CreatedAt time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
-	UpdatedAt time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
-	IsActive  bool               `json:"isActive,omitempty" bson:"isActive,omitempty"`
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title        string             `json:"title,omitempty" bson:"title,omitempty"`
+	Price        float64            `json:"price,omitempty" bson:"price,omitempty"`
+	Currency     string             `json:"currency,omitempty" bson:"currency,omitempty"` // Currency Price is set in, "USD" when empty
+	Prices       *DisplayPrice      `json:"prices,omitempty" bson:"-"`                    // Price in USD and LBP, filled when plans are listed
+	Duration     int                `json:"duration,omitempty" bson:"duration,omitempty"`
+	Type         string             `json:"type,omitempty" bson:"type,omitempty"`
+	Benefits     Benefits           `json:"benefits,omitempty" bson:"benefits,omitempty"`
+	Entitlements *Entitlements      `json:"entitlements,omitempty" bson:"entitlements,omitempty"` // Nil for plans created before entitlements, which are not limited
+	TrialDays    int                `json:"trialDays,omitempty" bson:"trialDays,omitempty"`       // Free days offered to newly approved businesses, 0 for no trial
+	CreatedAt    time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt    time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	IsActive     bool               `json:"isActive,omitempty" bson:"isActive,omitempty"`
 }
 
 // SubscriptionPlanRequest represents the request body for creating/updating subscription plans
 type SubscriptionPlanRequest struct {
-	Title    string      `json:"title" validate:"required"`
-	Price    float64     `json:"price" validate:"required,gte=0"`
-	Duration int         `json:"duration" validate:"required,gt=0"`
-	Type     string      `json:"type" validate:"required,oneof=company wholesaler serviceProvider"`
-	Benefits interface{} `json:"benefits" validate:"required"`
-	IsActive bool        `json:"isActive"`
+	Title        string        `json:"title" validate:"required"`
+	Price        float64       `json:"price" validate:"required,gte=0"`
+	Currency     string        `json:"currency" validate:"omitempty,oneof=USD LBP"`
+	Duration     int           `json:"duration" validate:"required,gt=0"`
+	Type         string        `json:"type" validate:"required,oneof=company wholesaler serviceProvider"`
+	Benefits     interface{}   `json:"benefits" validate:"required"`
+	Entitlements *Entitlements `json:"entitlements"`
+	TrialDays    int           `json:"trialDays" validate:"gte=0,lte=90"`
+	IsActive     bool          `json:"isActive"`
 }
 
 // SubscriptionPlanResponse represents the response structure for subscription plan operations
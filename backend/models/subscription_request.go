@@ -27,10 +27,29 @@ type SubscriptionRequest struct {
 	ApprovedAt      *time.Time `json:"approvedAt,omitempty" bson:"approvedAt,omitempty"`
 	RejectedAt      *time.Time `json:"rejectedAt,omitempty" bson:"rejectedAt,omitempty"`
 	// Payment method: "whish" or "cash"
-	PaymentMethod   string     `json:"paymentMethod,omitempty" bson:"paymentMethod,omitempty"` // "whish" or "cash"
+	PaymentMethod string `json:"paymentMethod,omitempty" bson:"paymentMethod,omitempty"` // "whish" or "cash"
 	// Whish payment fields
 	ExternalID    int64     `json:"externalId,omitempty" bson:"externalId,omitempty"`       // Whish payment external ID
 	PaymentStatus string    `json:"paymentStatus,omitempty" bson:"paymentStatus,omitempty"` // "pending", "success", "failed"
 	CollectURL    string    `json:"collectUrl,omitempty" bson:"collectUrl,omitempty"`       // Whish payment URL
 	PaidAt        time.Time `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+	// Set when the request renews an existing subscription
+	RenewalOf *primitive.ObjectID `json:"renewalOf,omitempty" bson:"renewalOf,omitempty"`
+	// Set when the request moves a running subscription to another plan
+	PlanChangeOf *primitive.ObjectID `json:"planChangeOf,omitempty" bson:"planChangeOf,omitempty"`
+	Amount       float64             `json:"amount,omitempty" bson:"amount,omitempty"` // Amount due in USD when it differs from the plan price
+	Credit       float64             `json:"credit,omitempty" bson:"credit,omitempty"` // Unused value of the replaced subscription
+	// Set when a promo code discounts the plan price; Amount then holds the discounted price
+	PromoCode string  `json:"promoCode,omitempty" bson:"promoCode,omitempty"`
+	Discount  float64 `json:"discount,omitempty" bson:"discount,omitempty"`
+	// Plan price in the currency it is set in, converted at the exchange rate locked when the payment was requested
+	CurrencyConversion `bson:",inline"`
+}
+
+// AmountDue returns what the request charges for a plan: the discounted or prorated amount when set, or the plan price
+func (r SubscriptionRequest) AmountDue(planPrice float64) float64 {
+	if r.Amount > 0 {
+		return r.Amount
+	}
+	return planPrice
 }
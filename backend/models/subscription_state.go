@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Subscription statuses shared by branch, wholesaler branch and service provider subscriptions
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusExpired   = "expired"
+)
+
+// SubscriptionAction is an operation that moves a subscription from one status to another
+type SubscriptionAction string
+
+const (
+	SubscriptionActionPause  SubscriptionAction = "pause"
+	SubscriptionActionResume SubscriptionAction = "resume"
+	SubscriptionActionCancel SubscriptionAction = "cancel"
+	SubscriptionActionExpire SubscriptionAction = "expire"
+	SubscriptionActionRenew  SubscriptionAction = "renew"
+
+	SubscriptionActionChangePlan   SubscriptionAction = "change_plan"
+	SubscriptionActionSetAutoRenew SubscriptionAction = "set_auto_renew" // Allowed while active or paused, keeps the status
+)
+
+// subscriptionActionVerbs phrases actions for error messages, e.g. "cannot change the plan of a subscription"
+var subscriptionActionVerbs = map[SubscriptionAction]string{
+	SubscriptionActionChangePlan:   "change the plan of",
+	SubscriptionActionSetAutoRenew: "change auto-renew of",
+}
+
+// subscriptionTransitions lists, for every action, the statuses it may start from and the status it leads to
+var subscriptionTransitions = map[SubscriptionAction]struct {
+	From []string
+	To   string
+}{
+	SubscriptionActionPause:  {From: []string{SubscriptionStatusActive}, To: SubscriptionStatusPaused},
+	SubscriptionActionResume: {From: []string{SubscriptionStatusPaused}, To: SubscriptionStatusActive},
+	SubscriptionActionCancel: {From: []string{SubscriptionStatusActive, SubscriptionStatusPaused}, To: SubscriptionStatusCancelled},
+	SubscriptionActionExpire: {From: []string{SubscriptionStatusActive}, To: SubscriptionStatusExpired},
+	SubscriptionActionRenew:  {From: []string{SubscriptionStatusExpired}, To: SubscriptionStatusActive},
+
+	SubscriptionActionChangePlan: {From: []string{SubscriptionStatusActive}, To: SubscriptionStatusActive},
+}
+
+// SubscriptionTransitionError is returned when an action is not allowed from the current status
+type SubscriptionTransitionError struct {
+	Action SubscriptionAction
+	Status string
+}
+
+func (e *SubscriptionTransitionError) Error() string {
+	verb, ok := subscriptionActionVerbs[e.Action]
+	if !ok {
+		verb = string(e.Action)
+	}
+	return fmt.Sprintf("cannot %s a subscription that is %s", verb, e.Status)
+}
+
+// NextSubscriptionStatus validates an action against the current status and returns the resulting status
+func NextSubscriptionStatus(current string, action SubscriptionAction) (string, error) {
+	transition, ok := subscriptionTransitions[action]
+	if !ok {
+		return "", fmt.Errorf("unknown subscription action: %s", action)
+	}
+	for _, from := range transition.From {
+		if from == current {
+			return transition.To, nil
+		}
+	}
+	return "", &SubscriptionTransitionError{Action: action, Status: current}
+}
+
+// SubscriptionStatusesAllowing returns the statuses from which the given action is allowed
+func SubscriptionStatusesAllowing(action SubscriptionAction) []string {
+	return subscriptionTransitions[action].From
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subscription trial statuses
+const (
+	TrialStatusActive    = "active"    // The trial subscription is running
+	TrialStatusConverted = "converted" // The business paid for a subscription after the trial
+	TrialStatusExpired   = "expired"   // The trial ended or was cancelled without a payment
+)
+
+// SubscriptionTrial records the free trial granted to a business when it was approved.
+// The normalized phones, emails and business name are kept so that a business gets a single trial
+// even when it is onboarded again under another account.
+type SubscriptionTrial struct {
+	ID                  primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Kind                string              `json:"kind" bson:"kind"`         // "company_branch", "wholesaler_branch" or "service_provider"
+	EntityID            primitive.ObjectID  `json:"entityId" bson:"entityId"` // Branch or service provider on trial
+	AccountID           primitive.ObjectID  `json:"accountId" bson:"accountId"`
+	BusinessName        string              `json:"businessName" bson:"businessName"`
+	SubscriptionID      primitive.ObjectID  `json:"subscriptionId" bson:"subscriptionId"`
+	PlanID              primitive.ObjectID  `json:"planId" bson:"planId"`
+	SalespersonID       primitive.ObjectID  `json:"salespersonId,omitempty" bson:"salespersonId,omitempty"`
+	Status              string              `json:"status" bson:"status"`
+	StartDate           time.Time           `json:"startDate" bson:"startDate"`
+	EndDate             time.Time           `json:"endDate" bson:"endDate"`
+	Phones              []string            `json:"-" bson:"phones"`
+	Emails              []string            `json:"-" bson:"emails"`
+	NameKey             string              `json:"-" bson:"nameKey"`
+	ConversionRequestID *primitive.ObjectID `json:"conversionRequestId,omitempty" bson:"conversionRequestId,omitempty"`
+	ConversionPlanID    *primitive.ObjectID `json:"conversionPlanId,omitempty" bson:"conversionPlanId,omitempty"`
+	ConversionAmount    float64             `json:"conversionAmount,omitempty" bson:"conversionAmount,omitempty"`
+	ConvertedAt         *time.Time          `json:"convertedAt,omitempty" bson:"convertedAt,omitempty"`
+	ExpiredAt           *time.Time          `json:"expiredAt,omitempty" bson:"expiredAt,omitempty"`
+	CreatedAt           time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt           time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// TrialSummary counts the trials of a salesperson or team by outcome
+type TrialSummary struct {
+	Active          int     `json:"active"`
+	Converted       int     `json:"converted"`
+	Expired         int     `json:"expired"`
+	ConversionRate  float64 `json:"conversionRate"` // Converted trials out of the finished ones, in percent
+	ConvertedAmount float64 `json:"convertedAmount"`
+}
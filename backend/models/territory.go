@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Territory enforcement modes for businesses a salesperson creates outside their territories
+const (
+	TerritoryEnforcementOff   = "off"
+	TerritoryEnforcementFlag  = "flag"  // The creation request is marked for the sales manager
+	TerritoryEnforcementBlock = "block" // The creation is refused
+)
+
+// GeoPoint is a vertex of a territory polygon
+type GeoPoint struct {
+	Lat float64 `json:"lat" bson:"lat" validate:"gte=-90,lte=90"`
+	Lng float64 `json:"lng" bson:"lng" validate:"gte=-180,lte=180"`
+}
+
+// Territory is an area assigned to a salesperson, made of Lebanese governorates, districts and drawn polygons.
+// An address belongs to the territory when it matches any of them.
+type Territory struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id"`
+	Name          string              `json:"name" bson:"name"`
+	Governorates  []string            `json:"governorates,omitempty" bson:"governorates,omitempty"`
+	Districts     []string            `json:"districts,omitempty" bson:"districts,omitempty"`
+	Polygons      [][]GeoPoint        `json:"polygons,omitempty" bson:"polygons,omitempty"`
+	SalespersonID *primitive.ObjectID `json:"salespersonId,omitempty" bson:"salespersonId,omitempty"`
+	Active        bool                `json:"active" bson:"active"`
+	CreatedBy     primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt     time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// TerritoryRequest represents the request body for creating or updating a territory
+type TerritoryRequest struct {
+	Name          string       `json:"name" validate:"required"`
+	Governorates  []string     `json:"governorates"`
+	Districts     []string     `json:"districts"`
+	Polygons      [][]GeoPoint `json:"polygons" validate:"dive,min=3,dive"`
+	SalespersonID string       `json:"salespersonId"` // Empty leaves the territory unassigned
+	Active        *bool        `json:"active"`        // Defaults to true
+}
@@ -93,23 +93,26 @@ type SocialLinks struct {
 // Update ServiceProviderInfo to include SocialLinks
 // Adding description field to ServiceProviderInfo struct
 type ServiceProviderInfo struct {
-	ServiceType              string               `json:"serviceType" bson:"serviceType"`
-	CustomServiceType        string               `json:"customServiceType,omitempty" bson:"customServiceType,omitempty"`
-	Description              string               `json:"description,omitempty" bson:"description,omitempty"`
-	YearsExperience          interface{}          `json:"yearsExperience" bson:"yearsExperience"`
-	ProfilePhoto             string               `json:"profilePhoto,omitempty" bson:"profilePhoto,omitempty"`
-	CertificateImages        []string             `json:"certificateImages,omitempty" bson:"certificateImages,omitempty"`
-	PortfolioImages          []string             `json:"portfolioImages,omitempty" bson:"portfolioImages,omitempty"`
-	AvailableHours           []string             `json:"availableHours,omitempty" bson:"availableHours,omitempty"`
-	AvailableDays            []string             `json:"availableDays,omitempty" bson:"availableDays,omitempty"`
-	ApplyToAllMonths         bool                 `json:"applyToAllMonths,omitempty" bson:"applyToAllMonths,omitempty"`
-	AvailableWeekdays        []string             `json:"availableWeekdays,omitempty" bson:"availableWeekdays,omitempty"`
-	Rating                   float64              `json:"rating" bson:"rating"`
-	ReferralCode             string               `json:"referralCode,omitempty" bson:"referralCode,omitempty"`
-	Points                   int                  `json:"points" bson:"points"`
-	Status                   string               `json:"status" bson:"status"` // "available" or "not_available"
-	ReferredServiceProviders []primitive.ObjectID `json:"referredServiceProviders,omitempty" bson:"referredServiceProviders,omitempty"`
-	SocialLinks              *SocialLinks         `json:"socialLinks,omitempty" bson:"socialLinks,omitempty"`
+	ServiceType              string                `json:"serviceType" bson:"serviceType"`
+	CustomServiceType        string                `json:"customServiceType,omitempty" bson:"customServiceType,omitempty"`
+	Description              string                `json:"description,omitempty" bson:"description,omitempty"`
+	YearsExperience          interface{}           `json:"yearsExperience" bson:"yearsExperience"`
+	ProfilePhoto             string                `json:"profilePhoto,omitempty" bson:"profilePhoto,omitempty"`
+	CertificateImages        []string              `json:"certificateImages,omitempty" bson:"certificateImages,omitempty"`
+	PortfolioImages          []string              `json:"portfolioImages,omitempty" bson:"portfolioImages,omitempty"`
+	AvailableHours           []string              `json:"availableHours,omitempty" bson:"availableHours,omitempty"`
+	AvailableDays            []string              `json:"availableDays,omitempty" bson:"availableDays,omitempty"`
+	ApplyToAllMonths         bool                  `json:"applyToAllMonths,omitempty" bson:"applyToAllMonths,omitempty"`
+	AvailableWeekdays        []string              `json:"availableWeekdays,omitempty" bson:"availableWeekdays,omitempty"`
+	Schedule                 *AvailabilitySchedule `json:"schedule,omitempty" bson:"schedule,omitempty"` // Source of truth for availability; the strings above are kept for older clients
+	SlotSettings             *BookingSlotSettings  `json:"slotSettings,omitempty" bson:"slotSettings,omitempty"`
+	BookingPolicy            *BookingPolicy        `json:"bookingPolicy,omitempty" bson:"bookingPolicy,omitempty"`
+	Rating                   float64               `json:"rating" bson:"rating"`
+	ReferralCode             string                `json:"referralCode,omitempty" bson:"referralCode,omitempty"`
+	Points                   int                   `json:"points" bson:"points"`
+	Status                   string                `json:"status" bson:"status"` // "available" or "not_available"
+	ReferredServiceProviders []primitive.ObjectID  `json:"referredServiceProviders,omitempty" bson:"referredServiceProviders,omitempty"`
+	SocialLinks              *SocialLinks          `json:"socialLinks,omitempty" bson:"socialLinks,omitempty"`
 }
 
 // Update the UpdateServiceProviderRequest to include description
@@ -224,41 +227,18 @@ type ReviewsResponse struct {
 	Data    []Review `json:"data,omitempty"`
 }
 
-// / RegenerateAvailableDaysFromWeekdays generates available days for a date range based on weekday preferences
+// RegenerateAvailableDaysFromWeekdays lists the dates of a range on which the provider's schedule is open.
+// The result only feeds the legacy AvailableDays field; availability itself is read from the schedule.
 func (s *ServiceProviderInfo) RegenerateAvailableDaysFromWeekdays(startDate, endDate time.Time) []string {
-	if s == nil || len(s.AvailableWeekdays) == 0 {
-		return []string{}
-	}
-
 	allDays := make([]string, 0)
-
-	// Create a set of selected weekdays for faster lookup
-	selectedWeekdays := make(map[time.Weekday]bool)
-	for _, weekdayStr := range s.AvailableWeekdays {
-		switch weekdayStr {
-		case "Monday":
-			selectedWeekdays[time.Monday] = true
-		case "Tuesday":
-			selectedWeekdays[time.Tuesday] = true
-		case "Wednesday":
-			selectedWeekdays[time.Wednesday] = true
-		case "Thursday":
-			selectedWeekdays[time.Thursday] = true
-		case "Friday":
-			selectedWeekdays[time.Friday] = true
-		case "Saturday":
-			selectedWeekdays[time.Saturday] = true
-		case "Sunday":
-			selectedWeekdays[time.Sunday] = true
-		}
+	if s == nil {
+		return allDays
 	}
 
-	// Iterate through each day in the date range
+	schedule := s.EffectiveSchedule()
 	for d := startDate; d.Before(endDate) || d.Equal(endDate); d = d.AddDate(0, 0, 1) {
-		// Check if this day's weekday is in our selected weekdays
-		if selectedWeekdays[d.Weekday()] {
-			dateStr := d.Format("2006-01-02")
-			allDays = append(allDays, dateStr)
+		if len(schedule.RangesOn(d)) > 0 {
+			allDays = append(allDays, d.Format("2006-01-02"))
 		}
 	}
 
@@ -38,6 +38,8 @@ type CollectURLData struct {
 
 // PaymentStatusData represents the payment status information
 type PaymentStatusData struct {
-	CollectStatus    string `json:"collectStatus"`
-	PayerPhoneNumber string `json:"payerPhoneNumber"`
+	CollectStatus    string  `json:"collectStatus"`
+	PayerPhoneNumber string  `json:"payerPhoneNumber"`
+	Amount           float64 `json:"amount,omitempty"` // Amount collected, when reported by Whish
+	Currency         string  `json:"currency,omitempty"`
 }
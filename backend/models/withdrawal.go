@@ -18,4 +18,5 @@ type Withdrawal struct {
 	AdminNote       string              `bson:"adminNote,omitempty" json:"adminNote,omitempty"`
 	UserNote        string              `bson:"userNote,omitempty" json:"userNote,omitempty"`
 	RejectionReason string              `bson:"rejectionReason,omitempty" json:"rejectionReason,omitempty"`
+	PayoutRunID     *primitive.ObjectID `bson:"payoutRunId,omitempty" json:"payoutRunId,omitempty"` // Set when paid in a batch payout run
 }
@@ -84,6 +84,26 @@ func RegisterAdminRoutes(e *echo.Echo, db *mongo.Database, hub *websocket.Hub) {
 	protected.GET("/subscription-plans/company", subscriptionController.GetCompanySubscriptionPlans)
 	protected.GET("/subscription-plans/service-provider", subscriptionController.GetServiceProviderSubscriptionPlans)
 
+	// Promo code routes
+	promoCodeController := controllers.NewPromoCodeController(db)
+	protected.POST("/promo-codes", promoCodeController.CreatePromoCode)
+	protected.GET("/promo-codes", promoCodeController.GetPromoCodes)
+	protected.GET("/promo-codes/:id", promoCodeController.GetPromoCode)
+	protected.PUT("/promo-codes/:id", promoCodeController.UpdatePromoCode)
+	protected.DELETE("/promo-codes/:id", promoCodeController.DeactivatePromoCode)
+
+	// Invoice routes
+	invoiceController := controllers.NewInvoiceController(db)
+	protected.GET("/invoices", invoiceController.GetInvoices)
+	protected.GET("/invoices/export", invoiceController.ExportInvoices)
+	protected.GET("/invoices/:id/pdf", invoiceController.DownloadInvoice)
+
+	// Exchange rate routes
+	exchangeRateController := controllers.NewExchangeRateController(db)
+	protected.GET("/exchange-rate", exchangeRateController.GetExchangeRate)
+	protected.PUT("/exchange-rate", exchangeRateController.SetExchangeRate)
+	protected.POST("/exchange-rate/refresh", exchangeRateController.RefreshExchangeRate)
+
 	// Sponsorship routes
 	sponsorshipController := controllers.NewSponsorshipController(db)
 	protected.POST("/sponsorships", sponsorshipController.CreateSponsorship)
@@ -170,6 +190,61 @@ func RegisterAdminRoutes(e *echo.Echo, db *mongo.Database, hub *websocket.Hub) {
 	protected.POST("/withdrawals/:id/approve", subscriptionController.ApproveWithdrawalRequest)
 	protected.POST("/withdrawals/:id/reject", subscriptionController.RejectWithdrawalRequest)
 
+	// Batch payout runs of commission and referral balances (admin only)
+	payoutController := controllers.NewPayoutController(db)
+	protected.GET("/payout-runs", payoutController.GetPayoutRuns)
+	protected.POST("/payout-runs", payoutController.CreatePayoutRun)
+	protected.GET("/payout-runs/:id", payoutController.GetPayoutRun)
+	protected.POST("/payout-runs/:id/confirm", payoutController.ConfirmPayoutRun)
+	protected.POST("/payout-runs/:id/cancel", payoutController.CancelPayoutRun)
+	protected.GET("/payout-runs/:id/export", payoutController.ExportPayoutRun)
+	protected.POST("/payout-runs/:id/items/:userId/hold", payoutController.HoldPayoutItem)
+	protected.DELETE("/payout-runs/:id/items/:userId/hold", payoutController.ReleasePayoutItem)
+	protected.GET("/payout-runs/:id/statements/:userId", payoutController.GetPayoutStatement)
+	protected.GET("/payout-runs/:id/statements/:userId/pdf", payoutController.DownloadPayoutStatement)
+	protected.GET("/payout-holds", payoutController.GetPayoutHolds)
+	protected.POST("/payout-holds", payoutController.CreatePayoutHold)
+	protected.DELETE("/payout-holds/:userId", payoutController.DeletePayoutHold)
+
+	// Commission rules applied to subscription sales (admin only)
+	commissionRuleController := controllers.NewCommissionRuleController(db)
+	protected.GET("/commission-rules", commissionRuleController.GetCommissionRules)
+	protected.POST("/commission-rules", commissionRuleController.CreateCommissionRule)
+	protected.POST("/commission-rules/preview", commissionRuleController.PreviewCommission)
+	protected.PUT("/commission-rules/:ruleId", commissionRuleController.UpdateCommissionRule)
+	protected.DELETE("/commission-rules/:ruleId", commissionRuleController.DeleteCommissionRule)
+	protected.GET("/commission-rules/:ruleId/versions", commissionRuleController.GetCommissionRuleVersions)
+
+	// Monthly commission statements of salespersons and sales managers (admin only)
+	commissionStatementController := controllers.NewCommissionStatementController(db)
+	protected.GET("/commission-statements", commissionStatementController.GetCommissionStatements)
+	protected.POST("/commission-statements/regenerate", commissionStatementController.RegenerateCommissionStatement)
+	protected.GET("/commission-statements/:id", commissionStatementController.GetCommissionStatement)
+	protected.GET("/commission-statements/:id/pdf", commissionStatementController.DownloadCommissionStatement)
+
+	// Salesperson targets and sales leaderboard
+	salesTargetController := controllers.NewSalesTargetController(db)
+	protected.GET("/sales-targets", salesTargetController.GetSalesTargets)
+	protected.POST("/sales-targets", salesTargetController.CreateSalesTarget)
+	protected.PUT("/sales-targets/:id", salesTargetController.UpdateSalesTarget)
+	protected.DELETE("/sales-targets/:id", salesTargetController.DeleteSalesTarget)
+	protected.GET("/sales-leaderboard", salesTargetController.GetSalesLeaderboard)
+
+	// Lead pipelines of every sales team
+	leadController := controllers.NewLeadController(db)
+	protected.GET("/leads", leadController.GetLeads)
+	protected.GET("/leads/:id", leadController.GetLead)
+	protected.POST("/leads/:id/reassign", leadController.ReassignLead)
+
+	// Salesperson territories and coverage
+	territoryController := controllers.NewTerritoryController(db)
+	protected.GET("/territories", territoryController.GetTerritories)
+	protected.POST("/territories", territoryController.CreateTerritory)
+	protected.GET("/territories/coverage", territoryController.GetTerritoryCoverage)
+	protected.GET("/territories/districts", territoryController.GetLebanonDistricts)
+	protected.PUT("/territories/:id", territoryController.UpdateTerritory)
+	protected.DELETE("/territories/:id", territoryController.DeleteTerritory)
+
 	// Toggle entity status (active/inactive) for company, wholesaler, serviceProvider
 	protected.PUT("/toggle-status/:entityType/:id", adminController.ToggleEntityStatus)
 	protected.PUT("/toggle-status/company/:companyId/branch/:branchId", adminController.ToggleCompanyBranchStatus)
@@ -187,6 +262,7 @@ func RegisterAdminRoutes(e *echo.Echo, db *mongo.Database, hub *websocket.Hub) {
 	bookingController := controllers.NewBookingController(client, hub)
 	protected.GET("/bookings", bookingController.GetAllBookingsForAdmin)
 	protected.DELETE("/bookings/:id", bookingController.DeleteBookingForAdmin)
+	protected.GET("/emergency-dispatches", bookingController.GetEmergencyDispatchesForAdmin)
 
 	// Review management routes
 	reviewController := controllers.NewReviewController(client)
@@ -243,5 +319,9 @@ func RegisterAdminRoutes(e *echo.Echo, db *mongo.Database, hub *websocket.Hub) {
 	protected.DELETE("/ads/:id", adsController.DeleteAd)
 
 	protected.GET("/whish-payments", adminController.GetWhishPaymentDetails)
+	protected.GET("/payment-anomalies", adminController.GetPaymentAnomalies)
+	protected.PUT("/payment-anomalies/:id/resolve", adminController.ResolvePaymentAnomaly)
+	protected.GET("/refunds", adminController.GetRefunds)
+	protected.PUT("/refunds/:id/paid-out", adminController.MarkRefundPaidOut)
 
 }
@@ -56,6 +56,10 @@ func RegisterAuthRoutes(e *echo.Echo, db *mongo.Client, authController *controll
 		bookingController := controllers.NewBookingController(db, nil)
 		return bookingController.GetAvailableTimeSlots(c)
 	})
+	e.GET("/api/service-providers/:id/reliability", func(c echo.Context) error {
+		bookingController := controllers.NewBookingController(db, nil)
+		return bookingController.GetServiceProviderReliability(c)
+	})
 
 	// Public company and wholesaler filter
 	e.GET("/filter/companies-wholesalers", userController.FilterCompaniesAndWholesalers)
@@ -19,8 +19,20 @@ func RegisterCompanyRoutes(e *echo.Echo, companyController *controllers.CompanyC
 	companyGroup.GET("/subscription/request/:branchId/status", companySubscriptionController.GetBranchSubscriptionRequestStatus)
 	companyGroup.POST("/subscription/:branchId/verify-activate", companySubscriptionController.VerifyAndActivateBranchSubscription)
 	companyGroup.POST("/subscription/:branchId/cancel", subscriptionController.CancelCompanySubscription)
+	companyGroup.POST("/subscription/:branchId/pause", subscriptionController.PauseSubscription)
+	companyGroup.POST("/subscription/:branchId/resume", subscriptionController.ResumeSubscription)
+	companyGroup.POST("/subscription/:branchId/renew", subscriptionController.RenewSubscription)
+	companyGroup.PUT("/subscription/:branchId/auto-renew", subscriptionController.SetAutoRenew)
+	companyGroup.POST("/subscription/:branchId/change-plan", subscriptionController.ChangePlan)
+	companyGroup.POST("/subscription/:branchId/convert-trial", subscriptionController.ConvertTrial)
 	companyGroup.GET("/subscription/:branchId/remaining-time", companySubscriptionController.GetBranchSubscriptionRemainingTime)
 
+	// Invoice routes
+	invoiceController := controllers.NewInvoiceController(subscriptionController.DB)
+	companyGroup.GET("/invoices", invoiceController.GetMyInvoices)
+	companyGroup.GET("/invoices/:id", invoiceController.GetMyInvoice)
+	companyGroup.GET("/invoices/:id/pdf", invoiceController.DownloadMyInvoice)
+
 	// Whish payment callback routes (public - no auth required for Whish callbacks)
 	e.GET("/api/whish/payment/callback/success", companySubscriptionController.HandleWhishPaymentSuccess)
 	e.GET("/api/whish/payment/callback/failure", companySubscriptionController.HandleWhishPaymentFailure)
@@ -12,6 +12,10 @@ func RegisterSalesRoutes(e *echo.Echo, db *mongo.Client) {
 	salesManagerController := controllers.NewSalesManagerController(db.Database("barrim"))
 	salesPersonController := controllers.NewSalesPersonController(db)
 	salespersonReferralController := controllers.NewSalespersonReferralController(db.Database("barrim"))
+	commissionStatementController := controllers.NewCommissionStatementController(db.Database("barrim"))
+	salesTargetController := controllers.NewSalesTargetController(db.Database("barrim"))
+	leadController := controllers.NewLeadController(db.Database("barrim"))
+	territoryController := controllers.NewTerritoryController(db.Database("barrim"))
 
 	// Sales Manager routes
 	salesManager := e.Group("/api/sales-manager")
@@ -46,6 +50,22 @@ func RegisterSalesRoutes(e *echo.Echo, db *mongo.Client) {
 	salesManager.GET("/subscription-requests/pending", salesManagerController.GetPendingSubscriptionRequests)
 	salesManager.POST("/subscription-requests/:id/process", salesManagerController.ProcessSubscriptionRequest)
 	salesManager.GET("/commission-withdrawal-history", salesManagerController.GetCommissionAndWithdrawalHistory)
+	salesManager.GET("/commission-statements", commissionStatementController.GetMyCommissionStatements)
+	salesManager.GET("/commission-statements/:period", commissionStatementController.GetMyCommissionStatement)
+	salesManager.GET("/commission-statements/:period/pdf", commissionStatementController.DownloadMyCommissionStatement)
+	salesManager.GET("/trials", salesManagerController.GetTeamTrials)
+
+	// Team targets and leaderboard
+	salesManager.POST("/targets", salesTargetController.CreateSalesTarget)
+	salesManager.GET("/targets", salesTargetController.GetSalesTargets)
+	salesManager.PUT("/targets/:id", salesTargetController.UpdateSalesTarget)
+	salesManager.DELETE("/targets/:id", salesTargetController.DeleteSalesTarget)
+	salesManager.GET("/leaderboard", salesTargetController.GetSalesLeaderboard)
+
+	// Team lead pipeline
+	salesManager.GET("/leads", leadController.GetLeads)
+	salesManager.GET("/leads/:id", leadController.GetLead)
+	salesManager.POST("/leads/:id/reassign", leadController.ReassignLead)
 
 	// Sales Person routes
 	salesPerson := e.Group("/api/sales-person")
@@ -74,8 +94,25 @@ func RegisterSalesRoutes(e *echo.Echo, db *mongo.Client) {
 
 	// Commission routes
 	salesPerson.GET("/commission-withdrawal-history", salesPersonController.GetCommissionAndWithdrawalHistory)
+	salesPerson.GET("/commission-statements", commissionStatementController.GetMyCommissionStatements)
+	salesPerson.GET("/commission-statements/:period", commissionStatementController.GetMyCommissionStatement)
+	salesPerson.GET("/commission-statements/:period/pdf", commissionStatementController.DownloadMyCommissionStatement)
 	salesPerson.GET("/created-users-details", salesPersonController.GetSalespersonCreatedUsersWithCommission)
 	salesPerson.GET("/created-users", salesPersonController.GetAllCreatedUsers)
+	salesPerson.GET("/trials", salesPersonController.GetTrials)
+	salesPerson.GET("/targets", salesTargetController.GetMySalesTargets)
+	salesPerson.GET("/territories", territoryController.GetMyTerritories)
+
+	// Lead pipeline
+	salesPerson.POST("/leads", leadController.CreateLead)
+	salesPerson.GET("/leads", leadController.GetLeads)
+	salesPerson.GET("/leads/follow-ups", leadController.GetLeadFollowUps)
+	salesPerson.GET("/leads/:id", leadController.GetLead)
+	salesPerson.PUT("/leads/:id", leadController.UpdateLead)
+	salesPerson.POST("/leads/:id/stage", leadController.MoveLeadStage)
+	salesPerson.POST("/leads/:id/follow-up", leadController.ScheduleLeadFollowUp)
+	salesPerson.POST("/leads/:id/visits", leadController.LogLeadVisit)
+	salesPerson.POST("/leads/:id/convert", leadController.ConvertLead)
 
 	// Salesperson referral routes
 	salesPerson.POST("/referral/handle", salespersonReferralController.HandleReferral)
@@ -15,6 +15,7 @@ func RegisterServiceProviderRoutes(e *echo.Echo, db *mongo.Database, serviceProv
 	log.Println("Registering service provider routes...")
 
 	serviceProviderSubscriptionController := controllers.NewServiceProviderSubscriptionController(db)
+	subscriptionController := controllers.NewSubscriptionController(db)
 	salesPersonController := controllers.NewSalesPersonController(db.Client())
 	serviceProviderController := controllers.NewServiceProviderController(db.Client())
 
@@ -56,6 +57,49 @@ func RegisterServiceProviderRoutes(e *echo.Echo, db *mongo.Database, serviceProv
 	})
 	log.Println("Registered /subscription/cancel endpoint")
 
+	protected.POST("/subscription/pause", func(c echo.Context) error {
+		log.Printf("Received request to pause subscription from %s", c.Request().RemoteAddr)
+		return subscriptionController.PauseSubscription(c)
+	})
+	log.Println("Registered /subscription/pause endpoint")
+
+	protected.POST("/subscription/resume", func(c echo.Context) error {
+		log.Printf("Received request to resume subscription from %s", c.Request().RemoteAddr)
+		return subscriptionController.ResumeSubscription(c)
+	})
+	log.Println("Registered /subscription/resume endpoint")
+
+	protected.POST("/subscription/renew", func(c echo.Context) error {
+		log.Printf("Received request to renew subscription from %s", c.Request().RemoteAddr)
+		return subscriptionController.RenewSubscription(c)
+	})
+	log.Println("Registered /subscription/renew endpoint")
+
+	protected.PUT("/subscription/auto-renew", func(c echo.Context) error {
+		log.Printf("Received request to change subscription auto-renew from %s", c.Request().RemoteAddr)
+		return subscriptionController.SetAutoRenew(c)
+	})
+	log.Println("Registered /subscription/auto-renew endpoint")
+
+	protected.POST("/subscription/change-plan", func(c echo.Context) error {
+		log.Printf("Received request to change subscription plan from %s", c.Request().RemoteAddr)
+		return subscriptionController.ChangePlan(c)
+	})
+	log.Println("Registered /subscription/change-plan endpoint")
+
+	protected.POST("/subscription/convert-trial", func(c echo.Context) error {
+		log.Printf("Received request to convert trial from %s", c.Request().RemoteAddr)
+		return subscriptionController.ConvertTrial(c)
+	})
+	log.Println("Registered /subscription/convert-trial endpoint")
+
+	// Invoice routes
+	invoiceController := controllers.NewInvoiceController(db)
+	protected.GET("/invoices", invoiceController.GetMyInvoices)
+	protected.GET("/invoices/:id", invoiceController.GetMyInvoice)
+	protected.GET("/invoices/:id/pdf", invoiceController.DownloadMyInvoice)
+	log.Println("Registered /invoices endpoints")
+
 	protected.POST("/subscription-requests", func(c echo.Context) error {
 		log.Printf("Received subscription request from %s", c.Request().RemoteAddr)
 		return serviceProviderSubscriptionController.CreateServiceProviderSubscription(c)
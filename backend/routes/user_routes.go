@@ -60,6 +60,11 @@ func RegisterUserRoutes(e *echo.Echo, db *mongo.Client, userController *controll
 	r.GET("/bookings/user", bookingController.GetUserBookings)
 	r.PUT("/bookings/:id/status", bookingController.UpdateBookingStatus)
 	r.PUT("/bookings/:id/cancel", bookingController.CancelBooking)
+	r.POST("/bookings/:id/reschedule", bookingController.ProposeBookingReschedule)
+	r.PUT("/bookings/:id/reschedule/:proposalId", bookingController.RespondBookingReschedule)
+	r.POST("/bookings/:id/confirm-attendance", bookingController.ConfirmBookingAttendance)
+	r.GET("/bookings/reliability", bookingController.GetBookingReliability)
+	r.GET("/bookings/:id/dispatch", bookingController.GetBookingDispatch)
 
 	// Favorites routes
 	r.POST("/users/favorites", userController.AddBranchToFavorites)
@@ -119,6 +124,16 @@ func RegisterUserRoutes(e *echo.Echo, db *mongo.Client, userController *controll
 	serviceProvider.GET("/bookings", bookingController.GetProviderBookings)
 	serviceProvider.GET("/bookings/pending", bookingController.GetPendingBookings)
 	serviceProvider.PUT("/bookings/:id/respond", bookingController.AcceptBooking)
+	serviceProvider.GET("/booking-settings", bookingController.GetBookingSlotSettings)
+	serviceProvider.PUT("/booking-settings", bookingController.UpdateBookingSlotSettings)
+	serviceProvider.PUT("/bookings/:id/outcome", bookingController.RecordBookingOutcome)
+	serviceProvider.GET("/booking-policy", bookingController.GetBookingPolicy)
+	serviceProvider.PUT("/booking-policy", bookingController.UpdateBookingPolicy)
+	serviceProvider.POST("/blocked-users/:userId", bookingController.BlockBookingUser)
+	serviceProvider.DELETE("/blocked-users/:userId", bookingController.UnblockBookingUser)
+	serviceProvider.GET("/emergency-offers", bookingController.GetEmergencyOffers)
+	serviceProvider.POST("/emergency-offers/:id/accept", bookingController.AcceptEmergencyOffer)
+	serviceProvider.POST("/emergency-offers/:id/decline", bookingController.DeclineEmergencyOffer)
 	serviceProvider.POST("/referral", func(c echo.Context) error {
 		serviceProviderController := controllers.NewServiceProviderReferralController(db)
 		return serviceProviderController.HandleServiceProviderReferral(c)
@@ -64,8 +64,20 @@ func RegisterWholesalerRoutes(e *echo.Echo, db *mongo.Database, wholesalerVouche
 	wholesalerGroup.POST("/subscription/:branchId/request", wholesalerBranchSubscriptionController.CreateBranchSubscriptionRequest)
 	wholesalerGroup.GET("/subscription/request/:branchId/status", wholesalerBranchSubscriptionController.GetBranchSubscriptionRequestStatus)
 	wholesalerGroup.POST("/subscription/:branchId/cancel", wholesalerBranchSubscriptionController.CancelBranchSubscription)
+	wholesalerGroup.POST("/subscription/:branchId/pause", subscriptionController.PauseSubscription)
+	wholesalerGroup.POST("/subscription/:branchId/resume", subscriptionController.ResumeSubscription)
+	wholesalerGroup.POST("/subscription/:branchId/renew", subscriptionController.RenewSubscription)
+	wholesalerGroup.PUT("/subscription/:branchId/auto-renew", subscriptionController.SetAutoRenew)
+	wholesalerGroup.POST("/subscription/:branchId/change-plan", subscriptionController.ChangePlan)
+	wholesalerGroup.POST("/subscription/:branchId/convert-trial", subscriptionController.ConvertTrial)
 	wholesalerGroup.GET("/subscription/:branchId/remaining-time", wholesalerBranchSubscriptionController.GetBranchSubscriptionRemainingTime)
 
+	// Invoice routes
+	invoiceController := controllers.NewInvoiceController(db)
+	wholesalerGroup.GET("/invoices", invoiceController.GetMyInvoices)
+	wholesalerGroup.GET("/invoices/:id", invoiceController.GetMyInvoice)
+	wholesalerGroup.GET("/invoices/:id/pdf", invoiceController.DownloadMyInvoice)
+
 	// Sponsorship routes for wholesaler branches
 	wholesalerGroup.POST("/sponsorship/:branchId/request", wholesalerBranchSubscriptionController.CreateWholesalerBranchSponsorshipRequest)
 
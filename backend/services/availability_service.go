@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors returned by the availability service
+var (
+	ErrInvalidSchedule         = errors.New("invalid availability schedule")
+	ErrScheduleProviderMissing = errors.New("service provider not found")
+)
+
+const availabilityMigrationLockKey = "barrim:jobs:availability-migration"
+
+// AvailabilityService keeps the typed availability schedule of service providers, the one source
+// every availability check reads, in sync on their user and serviceProviders documents
+type AvailabilityService struct {
+	DB *mongo.Database
+}
+
+// NewAvailabilityService creates a new availability service
+func NewAvailabilityService(db *mongo.Database) *AvailabilityService {
+	return &AvailabilityService{DB: db}
+}
+
+// normalizeSchedule validates a schedule and fills in its defaults
+func normalizeSchedule(schedule *models.AvailabilitySchedule) error {
+	if err := schedule.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = models.DefaultAvailabilityTimezone
+	}
+	if schedule.Weekly == nil {
+		schedule.Weekly = []models.WeekdayHours{}
+	}
+	if schedule.Overrides == nil {
+		schedule.Overrides = []models.AvailabilityOverride{}
+	}
+	if schedule.Vacations == nil {
+		schedule.Vacations = []models.AvailabilityVacation{}
+	}
+	return nil
+}
+
+// providerAccount is the part of a users or serviceProviders document the schedule is written from
+type providerAccount struct {
+	userID              primitive.ObjectID
+	serviceProviderID   *primitive.ObjectID
+	serviceProviderInfo *models.ServiceProviderInfo
+}
+
+// account finds the service provider document matched in collection ("users" or "serviceProviders")
+// and the ids of the user and serviceProviders documents of the same account
+func (s *AvailabilityService) account(ctx context.Context, collection string, filter bson.M) (*providerAccount, error) {
+	var doc struct {
+		ID                  primitive.ObjectID          `bson:"_id"`
+		UserType            string                      `bson:"userType,omitempty"`
+		UserID              primitive.ObjectID          `bson:"userId,omitempty"`
+		ServiceProviderID   *primitive.ObjectID         `bson:"serviceProviderId,omitempty"`
+		ServiceProviderInfo *models.ServiceProviderInfo `bson:"serviceProviderInfo"`
+	}
+	if err := s.DB.Collection(collection).FindOne(ctx, filter).Decode(&doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrScheduleProviderMissing
+		}
+		return nil, err
+	}
+	if collection == "serviceProviders" {
+		return &providerAccount{userID: doc.UserID, serviceProviderID: &doc.ID, serviceProviderInfo: doc.ServiceProviderInfo}, nil
+	}
+	if doc.UserType != "serviceProvider" {
+		return nil, ErrScheduleProviderMissing
+	}
+	return &providerAccount{userID: doc.ID, serviceProviderID: doc.ServiceProviderID, serviceProviderInfo: doc.ServiceProviderInfo}, nil
+}
+
+// Save replaces the schedule of the service provider matched in collection ("users" or "serviceProviders")
+// and rewrites the legacy availability strings from it
+func (s *AvailabilityService) Save(ctx context.Context, collection string, filter bson.M, schedule models.AvailabilitySchedule) (*models.AvailabilitySchedule, error) {
+	if err := normalizeSchedule(&schedule); err != nil {
+		return nil, err
+	}
+	account, err := s.account(ctx, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	weekdays, hours := schedule.LegacyFields()
+	info := &models.ServiceProviderInfo{Schedule: &schedule}
+	now := time.Now()
+	days := info.RegenerateAvailableDaysFromWeekdays(now, now.AddDate(1, 0, 0))
+	fields := bson.M{
+		"schedule":          schedule,
+		"availableWeekdays": weekdays,
+		"availableHours":    hours,
+		"availableDays":     days,
+	}
+	if err := s.write(ctx, account.userID, account.serviceProviderID, fields); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// SyncFromLegacy rebuilds a provider's schedule from the legacy availability strings of the document matched
+// in collection ("users" or "serviceProviders"), after a client that still sends those strings updated it
+func (s *AvailabilityService) SyncFromLegacy(ctx context.Context, collection string, filter bson.M) error {
+	account, err := s.account(ctx, collection, filter)
+	if err != nil {
+		return err
+	}
+	if account.serviceProviderInfo == nil {
+		return nil
+	}
+	return s.write(ctx, account.userID, account.serviceProviderID, bson.M{"schedule": models.ScheduleFromLegacy(account.serviceProviderInfo)})
+}
+
+// write sets serviceProviderInfo fields on a service provider's user document and on the serviceProviders
+// documents linked to it
+func (s *AvailabilityService) write(ctx context.Context, userID primitive.ObjectID, serviceProviderID *primitive.ObjectID, fields bson.M) error {
+	set := bson.M{"updatedAt": time.Now()}
+	for key, value := range fields {
+		set["serviceProviderInfo."+key] = value
+	}
+
+	var providers []bson.M
+	if !userID.IsZero() {
+		if _, err := s.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID, "userType": "serviceProvider"}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		providers = append(providers, bson.M{"userId": userID})
+	}
+	if serviceProviderID != nil {
+		providers = append(providers, bson.M{"_id": *serviceProviderID})
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+	_, err := s.DB.Collection("serviceProviders").UpdateMany(ctx, bson.M{"$or": providers}, bson.M{"$set": set})
+	return err
+}
+
+// MigrateLegacySchedules gives every service provider document that has none a schedule built from
+// its legacy availability strings. It runs under a job lock and only touches unmigrated documents.
+func (s *AvailabilityService) MigrateLegacySchedules() {
+	utils.RunWithJobLock(availabilityMigrationLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		for _, collection := range []string{"users", "serviceProviders"} {
+			migrated, err := s.migrateCollection(ctx, collection)
+			if err != nil {
+				log.Printf("Failed to migrate availability schedules of %s: %v", collection, err)
+				continue
+			}
+			if migrated > 0 {
+				log.Printf("Migrated the availability schedules of %d %s documents", migrated, collection)
+			}
+		}
+	})
+}
+
+// migrateCollection builds the missing schedules of one collection
+func (s *AvailabilityService) migrateCollection(ctx context.Context, collection string) (int, error) {
+	filter := bson.M{
+		"serviceProviderInfo":          bson.M{"$type": "object"},
+		"serviceProviderInfo.schedule": bson.M{"$exists": false},
+	}
+	if collection == "users" {
+		filter["userType"] = "serviceProvider"
+	}
+	cursor, err := s.DB.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID                  primitive.ObjectID          `bson:"_id"`
+			ServiceProviderInfo *models.ServiceProviderInfo `bson:"serviceProviderInfo"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Failed to decode %s document for the availability migration: %v", collection, err)
+			continue
+		}
+		schedule := models.ScheduleFromLegacy(doc.ServiceProviderInfo)
+		_, err := s.DB.Collection(collection).UpdateOne(ctx,
+			bson.M{"_id": doc.ID, "serviceProviderInfo.schedule": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"serviceProviderInfo.schedule": schedule}})
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+// AvailableOnFilter matches the documents whose schedule, stored under field, is open at some time of the
+// given calendar day: a dated override with hours, or weekly hours on a day without override or vacation
+func AvailableOnFilter(field string, date time.Time) bson.M {
+	day := date.Format("2006-01-02")
+	return bson.M{"$and": []bson.M{
+		{field + ".vacations": bson.M{"$not": bson.M{"$elemMatch": bson.M{"from": bson.M{"$lte": day}, "to": bson.M{"$gte": day}}}}},
+		{"$or": []bson.M{
+			{field + ".overrides": bson.M{"$elemMatch": bson.M{"date": day, "ranges.0": bson.M{"$exists": true}}}},
+			{
+				field + ".weekly":    bson.M{"$elemMatch": bson.M{"day": date.Weekday().String(), "ranges.0": bson.M{"$exists": true}}},
+				field + ".overrides": bson.M{"$not": bson.M{"$elemMatch": bson.M{"date": day}}},
+			},
+		}},
+	}}
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors returned by the booking attendance service
+var (
+	ErrBookingBlocked            = errors.New("this service provider does not accept bookings from you because of missed bookings")
+	ErrBookingNotStarted         = errors.New("the outcome of a booking can be recorded once its time has passed")
+	ErrBookingOutcomeNotAllowed  = errors.New("only accepted or confirmed bookings can be marked completed or no-show")
+	ErrNotBookingProvider        = errors.New("only the service provider of this booking can record its outcome")
+	ErrAttendanceNotRequired     = errors.New("this booking does not need an attendance confirmation")
+	ErrAttendanceNotConfirmable  = errors.New("this booking can no longer be confirmed")
+	ErrBookingPolicyUserMissing  = errors.New("user not found")
+	ErrBookingPolicyProviderSelf = errors.New("you cannot block yourself")
+)
+
+// Grace period an unconfirmed booking gets when it is made or moved close to its confirmation deadline
+const attendanceConfirmationGrace = 30 * time.Minute
+
+// AttendanceConfirmationLead is how long before the start of a booking a user asked to confirm their
+// attendance must do so, set in minutes with BOOKING_ATTENDANCE_CONFIRMATION_MINUTES (default 3 hours)
+func AttendanceConfirmationLead() time.Duration {
+	return envDuration("BOOKING_ATTENDANCE_CONFIRMATION_MINUTES", 180, time.Minute)
+}
+
+// AttendanceDeadline returns when the attendance of a booking starting at startsAt must be confirmed by.
+// It is never sooner than the grace period from now, nor later than the start.
+func AttendanceDeadline(startsAt, now time.Time) time.Time {
+	deadline := startsAt.Add(-AttendanceConfirmationLead())
+	if earliest := now.Add(attendanceConfirmationGrace); deadline.Before(earliest) {
+		deadline = earliest
+	}
+	if deadline.After(startsAt) {
+		deadline = startsAt
+	}
+	return deadline
+}
+
+// BookingAttendanceService records whether bookings took place, scores the reliability of users and providers
+// from that history and applies each provider's policy towards users who do not show up
+type BookingAttendanceService struct {
+	DB *mongo.Database
+}
+
+// NewBookingAttendanceService creates a new booking attendance service
+func NewBookingAttendanceService(db *mongo.Database) *BookingAttendanceService {
+	return &BookingAttendanceService{DB: db}
+}
+
+// reliability turns counts of kept and broken bookings into a 0-100 score
+func reliability(completed, noShows, cancellations int) models.ReliabilityScore {
+	score := models.ReliabilityScore{Completed: completed, NoShows: noShows, Cancellations: cancellations, Score: 100}
+	if total := completed + noShows + cancellations; total > 0 {
+		score.Score = float64(int(float64(completed)/float64(total)*1000+0.5)) / 10
+	}
+	return score
+}
+
+// countBookings counts the bookings matched by filter grouped by status and the party that cancelled them
+func (s *BookingAttendanceService) countBookings(ctx context.Context, filter bson.M) (map[string]int, error) {
+	cursor, err := s.DB.Collection("bookings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"status": "$status", "cancelledBy": "$cancelledBy"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			Status      string `bson:"status"`
+			CancelledBy string `bson:"cancelledBy"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, row := range rows {
+		key := row.ID.Status
+		if row.ID.CancelledBy != "" {
+			key += ":" + row.ID.CancelledBy
+		}
+		counts[key] += row.Count
+	}
+	return counts, nil
+}
+
+// UserReliability scores a user on their completed bookings against their no-shows
+func (s *BookingAttendanceService) UserReliability(ctx context.Context, userID primitive.ObjectID) (models.ReliabilityScore, error) {
+	counts, err := s.countBookings(ctx, bson.M{
+		"userId": userID,
+		"status": bson.M{"$in": []string{models.BookingStatusCompleted, models.BookingStatusNoShow}},
+	})
+	if err != nil {
+		return models.ReliabilityScore{}, err
+	}
+	return reliability(counts[models.BookingStatusCompleted], counts[models.BookingStatusNoShow], 0), nil
+}
+
+// ProviderReliability scores a provider on their completed bookings against the bookings they cancelled.
+// providerIDs are the ids bookings of the provider can carry (their serviceProviders and user documents).
+func (s *BookingAttendanceService) ProviderReliability(ctx context.Context, providerIDs ...primitive.ObjectID) (models.ReliabilityScore, error) {
+	counts, err := s.countBookings(ctx, bson.M{
+		"serviceProviderId": bson.M{"$in": providerIDs},
+		"status":            bson.M{"$in": []string{models.BookingStatusCompleted, "cancelled"}},
+	})
+	if err != nil {
+		return models.ReliabilityScore{}, err
+	}
+	return reliability(counts[models.BookingStatusCompleted], 0, counts["cancelled:"+models.BookingPartyServiceProvider]), nil
+}
+
+// BookingPolicyOf returns the no-show policy of a provider; providers that never set one have every threshold off
+func BookingPolicyOf(provider models.ServiceProvider) models.BookingPolicy {
+	if provider.ServiceProviderInfo == nil || provider.ServiceProviderInfo.BookingPolicy == nil {
+		return models.BookingPolicy{BlockedUserIDs: []primitive.ObjectID{}}
+	}
+	policy := *provider.ServiceProviderInfo.BookingPolicy
+	if policy.BlockedUserIDs == nil {
+		policy.BlockedUserIDs = []primitive.ObjectID{}
+	}
+	return policy
+}
+
+// CheckBookingPolicy applies a provider's no-show policy to a user about to book them.
+// It fails with ErrBookingBlocked for blocked users and reports whether the user must confirm their attendance.
+func (s *BookingAttendanceService) CheckBookingPolicy(ctx context.Context, provider models.ServiceProvider, userID primitive.ObjectID) (bool, error) {
+	policy := BookingPolicyOf(provider)
+	for _, blocked := range policy.BlockedUserIDs {
+		if blocked == userID {
+			return false, ErrBookingBlocked
+		}
+	}
+	if policy.BlockAfterNoShows <= 0 && policy.ConfirmationAfterNoShows <= 0 {
+		return false, nil
+	}
+
+	noShows, err := s.DB.Collection("bookings").CountDocuments(ctx, bson.M{"userId": userID, "status": models.BookingStatusNoShow})
+	if err != nil {
+		return false, err
+	}
+	if policy.BlockAfterNoShows > 0 && noShows >= int64(policy.BlockAfterNoShows) {
+		return false, ErrBookingBlocked
+	}
+	return policy.ConfirmationAfterNoShows > 0 && noShows >= int64(policy.ConfirmationAfterNoShows), nil
+}
+
+// RecordOutcome marks a booking of the provider completed or no-show once its time has passed
+func (s *BookingAttendanceService) RecordOutcome(ctx context.Context, bookingID, userID primitive.ObjectID, req models.BookingOutcomeRequest) (*models.Booking, error) {
+	booking, party, err := loadBookingParty(ctx, s.DB, bookingID, userID)
+	if err != nil {
+		if err == ErrNotBookingParty {
+			return nil, ErrNotBookingProvider
+		}
+		return nil, err
+	}
+	if party != models.BookingPartyServiceProvider {
+		return nil, ErrNotBookingProvider
+	}
+	if booking.Status != "accepted" && booking.Status != "confirmed" {
+		return nil, ErrBookingOutcomeNotAllowed
+	}
+	now := time.Now()
+	if now.Before(BookingStartsAt(booking)) {
+		return nil, ErrBookingNotStarted
+	}
+
+	set := bson.M{
+		"status":    req.Status,
+		"outcomeAt": now,
+		"outcomeBy": userID,
+		"updatedAt": now,
+	}
+	if req.Note != "" {
+		set["outcomeNote"] = req.Note
+	}
+	res, err := s.DB.Collection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "status": booking.Status},
+		bson.M{"$set": set, "$unset": bson.M{"seat": ""}})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrBookingOutcomeNotAllowed
+	}
+
+	booking.Status = req.Status
+	booking.OutcomeNote = req.Note
+	booking.OutcomeAt = &now
+	booking.OutcomeBy = &userID
+	booking.Seat = nil
+	booking.UpdatedAt = now
+	return booking, nil
+}
+
+// ConfirmAttendance records that the user of a booking that asked for it will come
+func (s *BookingAttendanceService) ConfirmAttendance(ctx context.Context, bookingID, userID primitive.ObjectID) (*models.Booking, error) {
+	booking, party, err := loadBookingParty(ctx, s.DB, bookingID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if party != models.BookingPartyUser {
+		return nil, ErrNotBookingParty
+	}
+	if !booking.AttendanceConfirmationRequired {
+		return nil, ErrAttendanceNotRequired
+	}
+	if booking.AttendanceConfirmedAt != nil {
+		return booking, nil
+	}
+	if !reschedulable(booking) {
+		return nil, ErrAttendanceNotConfirmable
+	}
+
+	now := time.Now()
+	res, err := s.DB.Collection("bookings").UpdateOne(ctx, bson.M{
+		"_id":    booking.ID,
+		"status": bson.M{"$in": BookingSlotHoldingStatuses},
+	}, bson.M{"$set": bson.M{"attendanceConfirmedAt": now, "updatedAt": now}})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrAttendanceNotConfirmable
+	}
+	booking.AttendanceConfirmedAt = &now
+	booking.UpdatedAt = now
+	return booking, nil
+}
+
+// UpdatePolicy stores the no-show thresholds of a provider, keeping their blocked users
+func (s *BookingAttendanceService) UpdatePolicy(ctx context.Context, providerID primitive.ObjectID, req models.BookingPolicyRequest) error {
+	res, err := s.DB.Collection("serviceProviders").UpdateOne(ctx, bson.M{"_id": providerID}, bson.M{"$set": bson.M{
+		"serviceProviderInfo.bookingPolicy.confirmationAfterNoShows": req.ConfirmationAfterNoShows,
+		"serviceProviderInfo.bookingPolicy.blockAfterNoShows":        req.BlockAfterNoShows,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSlotProviderMissing
+	}
+	return nil
+}
+
+// SetBlocked adds a user to or removes them from the users a provider does not take bookings from
+func (s *BookingAttendanceService) SetBlocked(ctx context.Context, provider models.ServiceProvider, userID primitive.ObjectID, blocked bool) error {
+	if userID == provider.ID || userID == provider.UserID {
+		return ErrBookingPolicyProviderSelf
+	}
+	update := bson.M{"$pull": bson.M{"serviceProviderInfo.bookingPolicy.blockedUserIds": userID}}
+	if blocked {
+		count, err := s.DB.Collection("users").CountDocuments(ctx, bson.M{"_id": userID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrBookingPolicyUserMissing
+		}
+		update = bson.M{"$addToSet": bson.M{"serviceProviderInfo.bookingPolicy.blockedUserIds": userID}}
+	}
+	update["$set"] = bson.M{"updatedAt": time.Now()}
+
+	res, err := s.DB.Collection("serviceProviders").UpdateOne(ctx, bson.M{"_id": provider.ID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSlotProviderMissing
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const bookingReminderLockKey = "barrim:jobs:booking-reminders"
+
+// Booking statuses that get reminders: the provider has taken the booking
+var bookingReminderStatuses = []string{"accepted", "confirmed"}
+
+// BookingReminderOffsets returns how long before a booking its reminders go out, largest first. They are set in
+// minutes with BOOKING_REMINDER_OFFSETS_MINUTES as a comma-separated list (default "1440,120": a day and two hours before).
+func BookingReminderOffsets() []time.Duration {
+	var offsets []time.Duration
+	for _, value := range strings.Split(os.Getenv("BOOKING_REMINDER_OFFSETS_MINUTES"), ",") {
+		if minutes, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && minutes > 0 {
+			offsets = append(offsets, time.Duration(minutes)*time.Minute)
+		}
+	}
+	if len(offsets) == 0 {
+		offsets = []time.Duration{24 * time.Hour, 2 * time.Hour}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return offsets
+}
+
+// BookingReminderService reminds users and providers of their upcoming bookings and cancels the bookings
+// whose attendance was asked for and not confirmed in time
+type BookingReminderService struct {
+	DB *mongo.Database
+}
+
+// NewBookingReminderService creates a new booking reminder service
+func NewBookingReminderService(db *mongo.Database) *BookingReminderService {
+	return &BookingReminderService{DB: db}
+}
+
+// Run sends the reminders that are due and cancels unconfirmed bookings past their deadline, under a job lock
+func (s *BookingReminderService) Run() {
+	utils.RunWithJobLock(bookingReminderLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		now := time.Now()
+		if err := s.SendDueReminders(ctx, now); err != nil {
+			log.Printf("Failed to send booking reminders: %v", err)
+		}
+		if err := s.CancelUnconfirmed(ctx, now); err != nil {
+			log.Printf("Failed to cancel unconfirmed bookings: %v", err)
+		}
+	})
+}
+
+// reminderLead renders a reminder offset for a message, e.g. "2 hours" or "1 day"
+func reminderLead(offset time.Duration) string {
+	unit, count := "minute", int(offset/time.Minute)
+	switch {
+	case offset%(24*time.Hour) == 0:
+		unit, count = "day", int(offset/(24*time.Hour))
+	case offset%time.Hour == 0:
+		unit, count = "hour", int(offset/time.Hour)
+	}
+	if count != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", count, unit)
+}
+
+// SendDueReminders sends each upcoming booking the reminder of the smallest offset it is within.
+// Larger offsets that were missed, for bookings made or moved late, are marked sent with it so a booking
+// never gets two reminders at once.
+func (s *BookingReminderService) SendDueReminders(ctx context.Context, now time.Time) error {
+	offsets := BookingReminderOffsets()
+	cursor, err := s.DB.Collection("bookings").Find(ctx, bson.M{
+		"status":   bson.M{"$in": bookingReminderStatuses},
+		"startsAt": bson.M{"$gt": now, "$lte": now.Add(offsets[0])},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var booking models.Booking
+		if err := cursor.Decode(&booking); err != nil {
+			log.Printf("Failed to decode booking for reminders: %v", err)
+			continue
+		}
+		remaining := booking.StartsAt.Sub(now)
+		var due []string
+		var offset time.Duration
+		for _, o := range offsets {
+			if remaining <= o {
+				due = append(due, o.String())
+				offset = o
+			}
+		}
+		label := offset.String()
+		sent := false
+		for _, value := range booking.RemindersSent {
+			if value == label {
+				sent = true
+				break
+			}
+		}
+		if sent {
+			continue
+		}
+
+		res, err := s.DB.Collection("bookings").UpdateOne(ctx, bson.M{
+			"_id":           booking.ID,
+			"status":        bson.M{"$in": bookingReminderStatuses},
+			"remindersSent": bson.M{"$ne": label},
+		}, bson.M{"$addToSet": bson.M{"remindersSent": bson.M{"$each": due}}})
+		if err != nil {
+			log.Printf("Failed to claim reminder %s of booking %s: %v", label, booking.ID.Hex(), err)
+			continue
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+		s.remind(&booking, offset)
+	}
+	return cursor.Err()
+}
+
+// remind notifies both parties of a booking that it starts after offset, asking the user to confirm
+// their attendance when the provider requires it
+func (s *BookingReminderService) remind(booking *models.Booking, offset time.Duration) {
+	when := fmt.Sprintf("%s at %s", booking.BookingDate.Format("Jan 2"), booking.TimeSlot)
+	data := map[string]interface{}{
+		"type":      "booking_reminder",
+		"bookingId": booking.ID.Hex(),
+		"startsAt":  booking.StartsAt,
+	}
+
+	userMessage := fmt.Sprintf("Your booking on %s starts in %s.", when, reminderLead(offset))
+	if booking.AttendanceConfirmationRequired && booking.AttendanceConfirmedAt == nil && booking.AttendanceConfirmBy != nil {
+		userMessage += fmt.Sprintf(" Please confirm you will attend within %s or it will be cancelled.",
+			reminderLead(booking.AttendanceConfirmBy.Sub(time.Now()).Round(time.Minute)))
+	}
+	s.notify(booking, models.BookingPartyUser, "booking_reminder", "Booking Reminder", userMessage, data)
+	s.notify(booking, models.BookingPartyServiceProvider, "booking_reminder", "Booking Reminder",
+		fmt.Sprintf("You have a booking on %s, starting in %s.", when, reminderLead(offset)), data)
+}
+
+// notify sends a push notification to one party of a booking and saves it as an in-app notification
+func (s *BookingReminderService) notify(booking *models.Booking, party, notifType, title, message string, data map[string]interface{}) {
+	client := s.DB.Client()
+	recipient := booking.UserID
+	var err error
+	if party == models.BookingPartyServiceProvider {
+		recipient = booking.ServiceProviderID
+		err = utils.SendFCMNotificationToServiceProvider(client, recipient, title, message, data)
+	} else {
+		err = utils.SendFCMNotificationToUser(client, recipient, title, message, data)
+	}
+	if err != nil {
+		log.Printf("Failed to send FCM notification for booking %s: %v", booking.ID.Hex(), err)
+	}
+	if err := utils.SaveNotification(client, recipient, title, message, notifType, data); err != nil {
+		log.Printf("Failed to save in-app notification for booking %s: %v", booking.ID.Hex(), err)
+	}
+}
+
+// CancelUnconfirmed cancels the bookings whose user was asked to confirm their attendance and did not
+// before the deadline, freeing their place in the slot
+func (s *BookingReminderService) CancelUnconfirmed(ctx context.Context, now time.Time) error {
+	filter := bson.M{
+		"status":                         bson.M{"$in": BookingSlotHoldingStatuses},
+		"attendanceConfirmationRequired": true,
+		"attendanceConfirmedAt":          bson.M{"$exists": false},
+		"attendanceConfirmBy":            bson.M{"$lte": now},
+	}
+	cursor, err := s.DB.Collection("bookings").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var booking models.Booking
+		if err := cursor.Decode(&booking); err != nil {
+			log.Printf("Failed to decode booking for attendance checks: %v", err)
+			continue
+		}
+		claim := bson.M{"_id": booking.ID}
+		for key, value := range filter {
+			claim[key] = value
+		}
+		res, err := s.DB.Collection("bookings").UpdateOne(ctx, claim, bson.M{
+			"$set":   bson.M{"status": "cancelled", "cancelledBy": models.BookingPartySystem, "updatedAt": now},
+			"$unset": bson.M{"seat": ""},
+		})
+		if err != nil {
+			log.Printf("Failed to cancel unconfirmed booking %s: %v", booking.ID.Hex(), err)
+			continue
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+
+		when := fmt.Sprintf("%s at %s", booking.BookingDate.Format("Jan 2"), booking.TimeSlot)
+		data := map[string]interface{}{"type": "booking_cancelled", "bookingId": booking.ID.Hex()}
+		s.notify(&booking, models.BookingPartyUser, "booking_cancelled", "Booking Cancelled",
+			fmt.Sprintf("Your booking on %s was cancelled because your attendance was not confirmed in time.", when), data)
+		s.notify(&booking, models.BookingPartyServiceProvider, "booking_cancelled", "Booking Cancelled",
+			fmt.Sprintf("The booking on %s was cancelled because the customer did not confirm their attendance.", when), data)
+	}
+	return cursor.Err()
+}
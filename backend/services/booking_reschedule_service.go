@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors returned by the booking reschedule service
+var (
+	ErrBookingNotFound          = errors.New("booking not found")
+	ErrNotBookingParty          = errors.New("you are not a party of this booking")
+	ErrBookingNotReschedulable  = errors.New("only pending, accepted or confirmed bookings can be rescheduled")
+	ErrRescheduleOutstanding    = errors.New("this booking already has a reschedule proposal waiting for an answer")
+	ErrRescheduleSameSlot       = errors.New("the proposed time is the current time of the booking")
+	ErrRescheduleNotFound       = errors.New("reschedule proposal not found or already answered")
+	ErrRescheduleOwnProposal    = errors.New("a reschedule proposal is answered by the other party")
+	ErrRescheduleProviderAbsent = errors.New("service provider of this booking not found")
+)
+
+// BookingRescheduleService lets either party of a booking propose a new date and time and the other
+// accept or decline it. Proposals are kept on the booking; accepting one moves the booking to a free
+// place of the new slot.
+type BookingRescheduleService struct {
+	DB *mongo.Database
+}
+
+// NewBookingRescheduleService creates a new booking reschedule service
+func NewBookingRescheduleService(db *mongo.Database) *BookingRescheduleService {
+	return &BookingRescheduleService{DB: db}
+}
+
+// PendingProposal returns the reschedule proposal of a booking waiting for an answer, if any
+func PendingProposal(booking *models.Booking) *models.BookingRescheduleProposal {
+	for i := range booking.RescheduleProposals {
+		if booking.RescheduleProposals[i].Status == models.RescheduleStatusPending {
+			return &booking.RescheduleProposals[i]
+		}
+	}
+	return nil
+}
+
+// reschedulable reports whether a booking still holds its slot and can change time
+func reschedulable(booking *models.Booking) bool {
+	for _, status := range BookingSlotHoldingStatuses {
+		if booking.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBookingParty finds a booking and the party the user is in it
+func loadBookingParty(ctx context.Context, db *mongo.Database, bookingID, userID primitive.ObjectID) (*models.Booking, string, error) {
+	var booking models.Booking
+	if err := db.Collection("bookings").FindOne(ctx, bson.M{"_id": bookingID}).Decode(&booking); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, "", ErrBookingNotFound
+		}
+		return nil, "", err
+	}
+	if booking.UserID == userID {
+		return &booking, models.BookingPartyUser, nil
+	}
+	if booking.ServiceProviderID == userID {
+		return &booking, models.BookingPartyServiceProvider, nil
+	}
+	var user models.User
+	err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, "", err
+	}
+	if user.ServiceProviderID != nil && *user.ServiceProviderID == booking.ServiceProviderID {
+		return &booking, models.BookingPartyServiceProvider, nil
+	}
+	return nil, "", ErrNotBookingParty
+}
+
+// provider loads the service provider a booking is with
+func (s *BookingRescheduleService) provider(ctx context.Context, booking *models.Booking) (*models.ServiceProvider, error) {
+	var provider models.ServiceProvider
+	if err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": booking.ServiceProviderID}).Decode(&provider); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRescheduleProviderAbsent
+		}
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// Propose records a new date and time for a booking, proposed by the user or the provider.
+// The slot must have a free place; it is claimed only once the other party accepts.
+func (s *BookingRescheduleService) Propose(ctx context.Context, bookingID, userID primitive.ObjectID, req models.BookingRescheduleRequest) (*models.Booking, *models.BookingRescheduleProposal, error) {
+	booking, party, err := loadBookingParty(ctx, s.DB, bookingID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !reschedulable(booking) {
+		return nil, nil, ErrBookingNotReschedulable
+	}
+	if PendingProposal(booking) != nil {
+		return nil, nil, ErrRescheduleOutstanding
+	}
+	provider, err := s.provider(ctx, booking)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	day := BookingDay(req.BookingDate)
+	timeSlot, err := NormalizeTimeSlot(req.TimeSlot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current, err := NormalizeTimeSlot(booking.TimeSlot); err == nil && current == timeSlot && BookingDay(booking.BookingDate).Equal(day) {
+		return nil, nil, ErrRescheduleSameSlot
+	}
+	if _, err := NewBookingSlotService(s.DB).OpenSlot(ctx, *provider, day, timeSlot); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	proposal := models.BookingRescheduleProposal{
+		ID:             primitive.NewObjectID(),
+		ProposedBy:     userID,
+		ProposedByRole: party,
+		FromDate:       booking.BookingDate,
+		FromTimeSlot:   booking.TimeSlot,
+		BookingDate:    day,
+		TimeSlot:       timeSlot,
+		Note:           req.Note,
+		Status:         models.RescheduleStatusPending,
+		CreatedAt:      now,
+	}
+	res, err := s.DB.Collection("bookings").UpdateOne(ctx, bson.M{
+		"_id":                 booking.ID,
+		"status":              bson.M{"$in": BookingSlotHoldingStatuses},
+		"rescheduleProposals": bson.M{"$not": bson.M{"$elemMatch": bson.M{"status": models.RescheduleStatusPending}}},
+	}, bson.M{
+		"$push": bson.M{"rescheduleProposals": proposal},
+		"$set":  bson.M{"updatedAt": now},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, nil, ErrRescheduleOutstanding
+	}
+
+	booking.RescheduleProposals = append(booking.RescheduleProposals, proposal)
+	booking.UpdatedAt = now
+	return booking, &proposal, nil
+}
+
+// Respond accepts or declines the pending reschedule proposal of a booking on behalf of the party that did not make it.
+// Accepting re-checks the new slot and moves the booking into it; when the slot filled up in the meantime the
+// proposal stays pending and ErrSlotTaken is returned.
+func (s *BookingRescheduleService) Respond(ctx context.Context, bookingID, proposalID, userID primitive.ObjectID, req models.BookingRescheduleResponseRequest) (*models.Booking, *models.BookingRescheduleProposal, error) {
+	booking, party, err := loadBookingParty(ctx, s.DB, bookingID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	proposal := PendingProposal(booking)
+	if proposal == nil || proposal.ID != proposalID {
+		return nil, nil, ErrRescheduleNotFound
+	}
+	if proposal.ProposedByRole == party {
+		return nil, nil, ErrRescheduleOwnProposal
+	}
+	if !reschedulable(booking) {
+		return nil, nil, ErrBookingNotReschedulable
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":                 booking.ID,
+		"status":              bson.M{"$in": BookingSlotHoldingStatuses},
+		"rescheduleProposals": bson.M{"$elemMatch": bson.M{"_id": proposal.ID, "status": models.RescheduleStatusPending}},
+	}
+	answer := bson.M{
+		"rescheduleProposals.$.status":      req.Status,
+		"rescheduleProposals.$.respondedBy": userID,
+		"rescheduleProposals.$.respondedAt": now,
+		"updatedAt":                         now,
+	}
+	if req.Note != "" {
+		answer["rescheduleProposals.$.responseNote"] = req.Note
+	}
+
+	var matched bool
+	if req.Status == models.RescheduleStatusAccepted {
+		provider, err := s.provider(ctx, booking)
+		if err != nil {
+			return nil, nil, err
+		}
+		if booking.AttendanceConfirmationRequired && booking.AttendanceConfirmedAt == nil {
+			startsAt := slotStartsAt(provider.ServiceProviderInfo.EffectiveSchedule(), proposal.BookingDate, proposal.TimeSlot)
+			answer["attendanceConfirmBy"] = AttendanceDeadline(startsAt, now)
+		}
+		matched, err = NewBookingSlotService(s.DB).Move(ctx, *provider, filter, proposal.BookingDate, proposal.TimeSlot, answer)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		res, err := s.DB.Collection("bookings").UpdateOne(ctx, filter, bson.M{"$set": answer})
+		if err != nil {
+			return nil, nil, err
+		}
+		matched = res.MatchedCount > 0
+	}
+	if !matched {
+		return nil, nil, ErrRescheduleNotFound
+	}
+
+	var updated models.Booking
+	if err := s.DB.Collection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(&updated); err != nil {
+		return nil, nil, err
+	}
+	for i := range updated.RescheduleProposals {
+		if updated.RescheduleProposals[i].ID == proposal.ID {
+			return &updated, &updated.RescheduleProposals[i], nil
+		}
+	}
+	return &updated, proposal, nil
+}
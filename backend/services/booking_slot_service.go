@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by the booking slot service
+var (
+	ErrInvalidTimeSlot     = errors.New("invalid time slot")
+	ErrSlotUnavailable     = errors.New("the service provider does not offer this time slot on this day")
+	ErrSlotTaken           = errors.New("this time slot is already booked")
+	ErrSlotProviderMissing = errors.New("service provider not found")
+)
+
+// BookingSlotHoldingStatuses are the booking statuses that keep a place in their slot
+var BookingSlotHoldingStatuses = []string{"pending", "accepted", "confirmed"}
+
+// DefaultBookingSlotSettings are used until a provider sets their own slot settings
+func DefaultBookingSlotSettings() models.BookingSlotSettings {
+	return models.BookingSlotSettings{SlotMinutes: 30, BufferMinutes: 0, Capacity: 1}
+}
+
+// BookingSlotService turns a provider's availability schedule into bookable slots and hands out places in them.
+// Each booking that holds a slot carries a seat number, and a unique index on
+// (serviceProviderId, bookingDate, timeSlot, seat) guarantees a place is never given out twice.
+type BookingSlotService struct {
+	DB *mongo.Database
+}
+
+// NewBookingSlotService creates a new booking slot service
+func NewBookingSlotService(db *mongo.Database) *BookingSlotService {
+	return &BookingSlotService{DB: db}
+}
+
+// SlotSettings returns the slot settings of a provider, falling back to the defaults
+func SlotSettings(info *models.ServiceProviderInfo) models.BookingSlotSettings {
+	if info == nil || info.SlotSettings == nil || info.SlotSettings.SlotMinutes <= 0 || info.SlotSettings.Capacity <= 0 {
+		return DefaultBookingSlotSettings()
+	}
+	return *info.SlotSettings
+}
+
+// BookingDay returns the calendar day of a booking date as midnight UTC, the form bookings are stored with
+func BookingDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// parseClock parses a "15:04" or "3:04 PM" time of day into minutes after midnight
+func parseClock(value string) (int, bool) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	for _, layout := range []string{"15:04", "3:04 PM", "3:04PM", "3 PM", "3PM"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour()*60 + t.Minute(), true
+		}
+	}
+	return 0, false
+}
+
+// formatClock formats minutes after midnight the way time slots are shown and stored ("3:04 PM")
+func formatClock(minutes int) string {
+	return time.Date(0, 1, 1, minutes/60, minutes%60, 0, 0, time.UTC).Format("3:04 PM")
+}
+
+// BookingStartsAt returns when a booking starts: the stored start of its slot, or for bookings made before
+// slots were stored, its time slot read in the default timezone. Bookings without a readable time slot start
+// at their booking date.
+func BookingStartsAt(booking *models.Booking) time.Time {
+	if booking.StartsAt != nil {
+		return *booking.StartsAt
+	}
+	return slotStartsAt(nil, booking.BookingDate, booking.TimeSlot)
+}
+
+// slotStartsAt returns the instant a time slot of a day starts in the timezone of schedule
+func slotStartsAt(schedule *models.AvailabilitySchedule, date time.Time, timeSlot string) time.Time {
+	day := BookingDay(date)
+	minutes, ok := parseClock(timeSlot)
+	if !ok {
+		return day
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, schedule.Location())
+}
+
+// NormalizeTimeSlot returns the canonical "3:04 PM" form of a time slot given in 12 or 24-hour format
+func NormalizeTimeSlot(slot string) (string, error) {
+	minutes, ok := parseClock(slot)
+	if !ok {
+		return "", ErrInvalidTimeSlot
+	}
+	return formatClock(minutes), nil
+}
+
+// workingWindows returns the provider's opening ranges on a day as minute ranges, read from their schedule
+func workingWindows(schedule *models.AvailabilitySchedule, day time.Time) [][2]int {
+	var windows [][2]int
+	for _, r := range schedule.RangesOn(day) {
+		start, okStart := parseClock(r.Start)
+		end, okEnd := parseClock(r.End)
+		if okStart && okEnd && start < end {
+			windows = append(windows, [2]int{start, end})
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i][0] < windows[j][0] })
+	return windows
+}
+
+// heldPlaces counts the bookings holding a place in each slot of a provider's day
+func (s *BookingSlotService) heldPlaces(ctx context.Context, providerID primitive.ObjectID, day time.Time) (map[string]int, error) {
+	cursor, err := s.DB.Collection("bookings").Find(ctx, bson.M{
+		"serviceProviderId": providerID,
+		"bookingDate":       day,
+		"status":            bson.M{"$in": BookingSlotHoldingStatuses},
+	}, options.Find().SetProjection(bson.M{"timeSlot": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var bookings []models.Booking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+	held := make(map[string]int)
+	for _, booking := range bookings {
+		slot, err := NormalizeTimeSlot(booking.TimeSlot)
+		if err != nil {
+			continue
+		}
+		held[slot]++
+	}
+	return held, nil
+}
+
+// Slots lists the provider's slots on a day with the places left in each; slots that already started are left out
+func (s *BookingSlotService) Slots(ctx context.Context, provider models.ServiceProvider, date time.Time) ([]models.BookingSlot, error) {
+	day := BookingDay(date)
+	schedule := provider.ServiceProviderInfo.EffectiveSchedule()
+	if len(workingWindows(schedule, day)) == 0 {
+		return []models.BookingSlot{}, nil
+	}
+	held, err := s.heldPlaces(ctx, provider.ID, day)
+	if err != nil {
+		return nil, err
+	}
+	return buildSlots(schedule, SlotSettings(provider.ServiceProviderInfo), day, held, time.Now()), nil
+}
+
+// buildSlots cuts the working windows of a day into slots, with held the places taken in each slot
+func buildSlots(schedule *models.AvailabilitySchedule, settings models.BookingSlotSettings, day time.Time, held map[string]int, now time.Time) []models.BookingSlot {
+	slots := []models.BookingSlot{}
+	loc := schedule.Location()
+	step := settings.SlotMinutes + settings.BufferMinutes
+	seen := make(map[int]bool)
+	for _, window := range workingWindows(schedule, day) {
+		for start := window[0]; start+settings.SlotMinutes <= window[1]; start += step {
+			if seen[start] {
+				continue
+			}
+			seen[start] = true
+			startsAt := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)
+			if !startsAt.After(now) {
+				continue
+			}
+			timeSlot := formatClock(start)
+			remaining := settings.Capacity - held[timeSlot]
+			if remaining < 0 {
+				remaining = 0
+			}
+			slots = append(slots, models.BookingSlot{
+				TimeSlot:  timeSlot,
+				Start:     startsAt,
+				End:       startsAt.Add(time.Duration(settings.SlotMinutes) * time.Minute),
+				Capacity:  settings.Capacity,
+				Booked:    held[timeSlot],
+				Remaining: remaining,
+			})
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+// OpenSlot finds a slot of the provider that still has a free place, returning it with the canonical time slot
+func (s *BookingSlotService) OpenSlot(ctx context.Context, provider models.ServiceProvider, date time.Time, timeSlot string) (*models.BookingSlot, error) {
+	timeSlot, err := NormalizeTimeSlot(timeSlot)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := s.Slots(ctx, provider, date)
+	if err != nil {
+		return nil, err
+	}
+	for i := range slots {
+		if slots[i].TimeSlot != timeSlot {
+			continue
+		}
+		if slots[i].Remaining == 0 {
+			return nil, ErrSlotTaken
+		}
+		return &slots[i], nil
+	}
+	return nil, ErrSlotUnavailable
+}
+
+// Reserve inserts a new booking into a free place of its slot.
+// Concurrent requests for the last place race on the unique seat index: exactly one insert
+// succeeds and the others fail with ErrSlotTaken.
+func (s *BookingSlotService) Reserve(ctx context.Context, provider models.ServiceProvider, booking *models.Booking) error {
+	slot, err := s.OpenSlot(ctx, provider, booking.BookingDate, booking.TimeSlot)
+	if err != nil {
+		return err
+	}
+	booking.TimeSlot = slot.TimeSlot
+	booking.BookingDate = BookingDay(booking.BookingDate)
+	startsAt := slot.Start
+	booking.StartsAt = &startsAt
+	if booking.AttendanceConfirmationRequired && booking.AttendanceConfirmedAt == nil {
+		deadline := AttendanceDeadline(startsAt, time.Now())
+		booking.AttendanceConfirmBy = &deadline
+	}
+
+	bookings := s.DB.Collection("bookings")
+	for seat := 0; seat < slot.Capacity; seat++ {
+		place := seat
+		booking.Seat = &place
+		_, err := bookings.InsertOne(ctx, booking)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			booking.Seat = nil
+			return err
+		}
+	}
+	booking.Seat = nil
+	return ErrSlotTaken
+}
+
+// Move takes a free place in another slot for an existing booking matched by filter, applying set in the same write.
+// The reminders of the booking start over for the new time.
+// It reports false when filter no longer matches the booking, and fails with ErrSlotTaken when the slot filled up.
+func (s *BookingSlotService) Move(ctx context.Context, provider models.ServiceProvider, filter bson.M, date time.Time, timeSlot string, set bson.M) (bool, error) {
+	slot, err := s.OpenSlot(ctx, provider, date, timeSlot)
+	if err != nil {
+		return false, err
+	}
+
+	bookings := s.DB.Collection("bookings")
+	for seat := 0; seat < slot.Capacity; seat++ {
+		fields := bson.M{"bookingDate": BookingDay(date), "timeSlot": slot.TimeSlot, "seat": seat, "startsAt": slot.Start, "remindersSent": []string{}}
+		for key, value := range set {
+			fields[key] = value
+		}
+		res, err := bookings.UpdateOne(ctx, filter, bson.M{"$set": fields})
+		if err == nil {
+			return res.MatchedCount > 0, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return false, err
+		}
+	}
+	return false, ErrSlotTaken
+}
+
+// ProviderForUser finds the serviceProviders document of a service provider account
+func (s *BookingSlotService) ProviderForUser(ctx context.Context, userID primitive.ObjectID) (*models.ServiceProvider, error) {
+	var user models.User
+	if err := s.DB.Collection("users").FindOne(ctx, bson.M{"_id": userID, "userType": "serviceProvider"}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSlotProviderMissing
+		}
+		return nil, err
+	}
+	ids := []primitive.ObjectID{user.ID}
+	if user.ServiceProviderID != nil {
+		ids = append([]primitive.ObjectID{*user.ServiceProviderID}, ids...)
+	}
+	for _, id := range ids {
+		var provider models.ServiceProvider
+		err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": id}).Decode(&provider)
+		if err == nil {
+			return &provider, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+	return nil, ErrSlotProviderMissing
+}
+
+// UpdateSettings stores the slot settings of a provider
+func (s *BookingSlotService) UpdateSettings(ctx context.Context, providerID primitive.ObjectID, settings models.BookingSlotSettings) error {
+	res, err := s.DB.Collection("serviceProviders").UpdateOne(ctx, bson.M{"_id": providerID}, bson.M{"$set": bson.M{
+		"serviceProviderInfo.slotSettings": settings,
+		"updatedAt":                        time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSlotProviderMissing
+	}
+	return nil
+}
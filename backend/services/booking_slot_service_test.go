@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		minutes int
+		ok      bool
+	}{
+		{"09:30", 570, true},
+		{" 14:15 ", 855, true},
+		{"9:30 AM", 570, true},
+		{"9:30am", 570, true},
+		{"3:45 PM", 945, true},
+		{"3 PM", 900, true},
+		{"3pm", 900, true},
+		{"12:00 AM", 0, true},
+		{"12 PM", 720, true},
+		{"00:00", 0, true},
+		{"25:00", 0, false},
+		{"9:75", 0, false},
+		{"noon", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		minutes, ok := parseClock(tt.value)
+		if minutes != tt.minutes || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %v; want %d, %v", tt.value, minutes, ok, tt.minutes, tt.ok)
+		}
+	}
+}
+
+func TestBuildSlots(t *testing.T) {
+	// 2026-10-19 is a Monday
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	schedule := &models.AvailabilitySchedule{
+		Timezone: "UTC",
+		Weekly: []models.WeekdayHours{
+			{Day: "Monday", Ranges: []models.TimeRange{{Start: "13:00", End: "14:00"}, {Start: "09:00", End: "11:00"}}},
+		},
+		Overrides: []models.AvailabilityOverride{{Date: "2026-10-26"}},
+		Vacations: []models.AvailabilityVacation{{From: "2026-11-02", To: "2026-11-09"}},
+	}
+	earlier := monday.AddDate(0, 0, -1)
+
+	tests := []struct {
+		name      string
+		day       time.Time
+		settings  models.BookingSlotSettings
+		held      map[string]int
+		now       time.Time
+		slots     []string
+		remaining []int
+	}{
+		{
+			name:      "half hour slots around a break",
+			day:       monday,
+			settings:  models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+			now:       earlier,
+			slots:     []string{"9:00 AM", "9:30 AM", "10:00 AM", "10:30 AM", "1:00 PM", "1:30 PM"},
+			remaining: []int{1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:      "buffer between slots and no slot past the window",
+			day:       monday,
+			settings:  models.BookingSlotSettings{SlotMinutes: 40, BufferMinutes: 5, Capacity: 1},
+			now:       earlier,
+			slots:     []string{"9:00 AM", "9:45 AM", "1:00 PM"},
+			remaining: []int{1, 1, 1},
+		},
+		{
+			name:      "held places reduce what is left",
+			day:       monday,
+			settings:  models.BookingSlotSettings{SlotMinutes: 60, Capacity: 2},
+			held:      map[string]int{"9:00 AM": 2, "10:00 AM": 1, "1:00 PM": 3},
+			now:       earlier,
+			slots:     []string{"9:00 AM", "10:00 AM", "1:00 PM"},
+			remaining: []int{0, 1, 0},
+		},
+		{
+			name:      "slots that already started are left out",
+			day:       monday,
+			settings:  models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+			now:       monday.Add(10 * time.Hour),
+			slots:     []string{"10:30 AM", "1:00 PM", "1:30 PM"},
+			remaining: []int{1, 1, 1},
+		},
+		{
+			name:     "closed weekday",
+			day:      monday.AddDate(0, 0, 1),
+			settings: models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+			now:      earlier,
+		},
+		{
+			name:     "date override closing the day",
+			day:      monday.AddDate(0, 0, 7),
+			settings: models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+			now:      earlier,
+		},
+		{
+			name:     "vacation",
+			day:      monday.AddDate(0, 0, 14),
+			settings: models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+			now:      earlier,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := buildSlots(schedule, tt.settings, tt.day, tt.held, tt.now)
+			got, remaining := []string{}, []int{}
+			for _, slot := range slots {
+				got = append(got, slot.TimeSlot)
+				remaining = append(remaining, slot.Remaining)
+				if want := slot.Start.Add(time.Duration(tt.settings.SlotMinutes) * time.Minute); !slot.End.Equal(want) {
+					t.Errorf("slot %s ends at %v, want %v", slot.TimeSlot, slot.End, want)
+				}
+			}
+			if tt.slots == nil {
+				tt.slots, tt.remaining = []string{}, []int{}
+			}
+			if !reflect.DeepEqual(got, tt.slots) {
+				t.Errorf("slots = %v, want %v", got, tt.slots)
+			}
+			if !reflect.DeepEqual(remaining, tt.remaining) {
+				t.Errorf("remaining = %v, want %v", remaining, tt.remaining)
+			}
+		})
+	}
+}
+
+// TestReserveConcurrent races reservations of a single-place slot against a real MongoDB, set with TEST_MONGODB_URI
+func TestReserveConcurrent(t *testing.T) {
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	db := client.Database("barrim_test_" + primitive.NewObjectID().Hex())
+	defer db.Drop(context.Background())
+
+	// Same seat index as config.setupCollections
+	_, err = db.Collection("bookings").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "serviceProviderId", Value: 1}, {Key: "bookingDate", Value: 1}, {Key: "timeSlot", Value: 1}, {Key: "seat", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"seat": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		t.Fatalf("create seat index: %v", err)
+	}
+
+	day := BookingDay(time.Now().AddDate(0, 0, 7))
+	provider := models.ServiceProvider{
+		ID: primitive.NewObjectID(),
+		ServiceProviderInfo: &models.ServiceProviderInfo{
+			Schedule: &models.AvailabilitySchedule{
+				Timezone: "UTC",
+				Weekly: []models.WeekdayHours{
+					{Day: day.Weekday().String(), Ranges: []models.TimeRange{{Start: "09:00", End: "10:00"}}},
+				},
+			},
+			SlotSettings: &models.BookingSlotSettings{SlotMinutes: 30, Capacity: 1},
+		},
+	}
+
+	service := NewBookingSlotService(db)
+	const attempts = 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.Reserve(ctx, provider, &models.Booking{
+				ID:                primitive.NewObjectID(),
+				UserID:            primitive.NewObjectID(),
+				ServiceProviderID: provider.ID,
+				BookingDate:       day,
+				TimeSlot:          "09:00",
+				Status:            "pending",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			reserved++
+		case errors.Is(err, ErrSlotTaken):
+		default:
+			t.Errorf("attempt %d: unexpected error %v", i, err)
+		}
+	}
+	if reserved != 1 {
+		t.Errorf("%d reservations succeeded, want 1", reserved)
+	}
+	count, err := db.Collection("bookings").CountDocuments(ctx, bson.M{"serviceProviderId": provider.ID})
+	if err != nil {
+		t.Fatalf("count bookings: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("%d bookings stored, want 1", count)
+	}
+}
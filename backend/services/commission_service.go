@@ -0,0 +1,570 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by the commission service
+var (
+	ErrCommissionRuleNotFound = errors.New("commission rule not found")
+	ErrCommissionRuleEnded    = errors.New("commission rule has ended")
+	ErrCommissionRuleDate     = errors.New("a new version cannot take effect before the current version started")
+)
+
+// commissionReferenceTypes are the wallet and ledger reference types of the subscriptions commissions are earned on
+var commissionReferenceTypes = map[string]string{
+	SubscriptionKindCompanyBranch:    "branch_subscription",
+	SubscriptionKindWholesalerBranch: "wholesaler_branch_subscription",
+	SubscriptionKindServiceProvider:  "service_provider_subscription",
+}
+
+// CommissionSale describes a paid subscription that commissions are earned on
+type CommissionSale struct {
+	Kind           string             // Subscription kind; empty for the legacy business subscriptions
+	SubscriptionID primitive.ObjectID // Subscription, or legacy request, the commission is earned on
+	EntityID       primitive.ObjectID // Branch or service provider, used to tell renewals from first purchases
+	BusinessID     primitive.ObjectID // Company, wholesaler or service provider
+	BusinessName   string
+	EntityName     string             // Branch name, if any
+	CreatedBy      primitive.ObjectID // Salesperson who created the business, if any
+	Plan           models.SubscriptionPlan
+	Amount         float64 // Amount paid in USD
+	Category       string
+	Region         string // Governorate of the business
+	Renewal        *bool  // Worked out from earlier subscriptions of the entity when nil
+	PlanChange     bool   // Paid to move a running subscription to another plan; always a renewal
+	At             time.Time
+}
+
+// CommissionSplit is how the amount paid for a sale is shared between the salesperson, their sales manager and the platform
+type CommissionSplit struct {
+	SalespersonID       primitive.ObjectID     `json:"salespersonId,omitempty"`
+	SalesManagerID      primitive.ObjectID     `json:"salesManagerId,omitempty"`
+	AdminID             primitive.ObjectID     `json:"adminId,omitempty"` // Admin who created the salesperson, if any
+	SalespersonPercent  float64                `json:"salespersonPercent"`
+	SalesManagerPercent float64                `json:"salesManagerPercent"`
+	AdminPercent        float64                `json:"adminPercent"`
+	SalespersonAmount   float64                `json:"salespersonAmount"`
+	SalesManagerAmount  float64                `json:"salesManagerAmount"`
+	PlatformAmount      float64                `json:"platformAmount"`
+	Source              string                 `json:"source,omitempty"` // "rule" or "profile"; empty when no salesperson earns on the sale
+	Rule                *models.CommissionRule `json:"rule,omitempty"`
+	Renewal             bool                   `json:"renewal"`
+	SalesThisMonth      int                    `json:"salesThisMonth,omitempty"` // Counting this sale
+}
+
+// CommissionService calculates the commissions earned on subscriptions from the admin-managed commission rules
+// and books them. Sales no rule matches fall back to the CommissionPercent of the salesperson and sales manager.
+type CommissionService struct {
+	DB *mongo.Database
+}
+
+// NewCommissionService creates a new commission service
+func NewCommissionService(db *mongo.Database) *CommissionService {
+	return &CommissionService{DB: db}
+}
+
+// Calculate works out the split of a sale without recording anything
+func (s *CommissionService) Calculate(ctx context.Context, sale CommissionSale) (*CommissionSplit, error) {
+	if sale.At.IsZero() {
+		sale.At = time.Now()
+	}
+	split := &CommissionSplit{PlatformAmount: sale.Amount, AdminPercent: 100}
+
+	// Only businesses created by a salesperson earn commissions
+	if sale.CreatedBy.IsZero() {
+		return split, nil
+	}
+	var salesperson models.Salesperson
+	err := s.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": sale.CreatedBy}).Decode(&salesperson)
+	if err == mongo.ErrNoDocuments {
+		return split, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get salesperson: %w", err)
+	}
+	split.SalespersonID = salesperson.ID
+
+	var salesManager models.SalesManager
+	if !salesperson.SalesManagerID.IsZero() {
+		err := s.DB.Collection("sales_managers").FindOne(ctx, bson.M{"_id": salesperson.SalesManagerID}).Decode(&salesManager)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to get sales manager: %w", err)
+		}
+		split.SalesManagerID = salesManager.ID
+	}
+	if split.SalesManagerID.IsZero() && !salesperson.CreatedBy.IsZero() {
+		count, err := s.DB.Collection("admins").CountDocuments(ctx, bson.M{"_id": salesperson.CreatedBy})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			split.AdminID = salesperson.CreatedBy
+		}
+	}
+
+	if sale.Renewal != nil {
+		split.Renewal = *sale.Renewal
+	} else if sale.PlanChange {
+		split.Renewal = true
+	} else if split.Renewal, err = s.isRenewal(ctx, sale); err != nil {
+		return nil, err
+	}
+	if sale.Region == "" {
+		sale.Region = salesperson.Region
+	}
+
+	monthStart := time.Date(sale.At.Year(), sale.At.Month(), 1, 0, 0, 0, 0, sale.At.Location())
+	earlier, err := s.DB.Collection("commissions").CountDocuments(ctx, bson.M{
+		"salespersonID": salesperson.ID,
+		"createdAt":     bson.M{"$gte": monthStart, "$lt": sale.At},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sales of the month: %w", err)
+	}
+	split.SalesThisMonth = int(earlier) + 1
+
+	rule, err := s.matchRule(ctx, sale, split.Renewal)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		split.Source = models.CommissionSourceRule
+		split.Rule = rule
+		split.SalespersonPercent, split.SalesManagerPercent = rule.Percentages(split.SalesThisMonth)
+	} else {
+		split.Source = models.CommissionSourceProfile
+		split.SalespersonPercent = salesperson.CommissionPercent
+		split.SalesManagerPercent = salesManager.CommissionPercent
+	}
+	if split.SalesManagerID.IsZero() {
+		split.SalesManagerPercent = 0
+	}
+
+	split.SalespersonPercent, split.SalesManagerPercent = capCommissionPercents(split.SalespersonPercent, split.SalesManagerPercent)
+	split.SalespersonAmount = roundCents(sale.Amount * split.SalespersonPercent / 100)
+	split.SalesManagerAmount = roundCents(sale.Amount * split.SalesManagerPercent / 100)
+	if split.SalespersonAmount+split.SalesManagerAmount > sale.Amount {
+		// Rounding up both shares of a full split can go a cent over
+		split.SalesManagerAmount = roundCents(sale.Amount - split.SalespersonAmount)
+	}
+	split.PlatformAmount = roundCents(sale.Amount - split.SalespersonAmount - split.SalesManagerAmount)
+	split.AdminPercent = 100 - split.SalespersonPercent - split.SalesManagerPercent
+	return split, nil
+}
+
+// capCommissionPercents scales the salesperson and sales manager percentages down in proportion when they add up
+// to more than 100. Rules are checked when saved, but the profile percentages of a salesperson and their manager
+// are set separately, and the split never pays out more than was collected.
+func capCommissionPercents(salespersonPercent, salesManagerPercent float64) (float64, float64) {
+	total := salespersonPercent + salesManagerPercent
+	if total <= 100 {
+		return salespersonPercent, salesManagerPercent
+	}
+	return salespersonPercent * 100 / total, salesManagerPercent * 100 / total
+}
+
+// isRenewal reports whether the branch or service provider had a paid subscription before this one
+func (s *CommissionService) isRenewal(ctx context.Context, sale CommissionSale) (bool, error) {
+	config, ok := subscriptionKinds[sale.Kind]
+	if !ok || sale.EntityID.IsZero() {
+		return false, nil
+	}
+	count, err := s.DB.Collection(config.SubscriptionCollection).CountDocuments(ctx, bson.M{
+		config.EntityField: sale.EntityID,
+		"_id":              bson.M{"$ne": sale.SubscriptionID},
+		"trial":            bson.M{"$ne": true},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to count earlier subscriptions: %w", err)
+	}
+	return count > 0, nil
+}
+
+// matchRule returns the rule version in effect at the time of the sale that matches it best:
+// the highest priority, then the most conditions, then the latest to take effect
+func (s *CommissionService) matchRule(ctx context.Context, sale CommissionSale, renewal bool) (*models.CommissionRule, error) {
+	rules, err := s.effectiveRules(ctx, sale.At)
+	if err != nil {
+		return nil, err
+	}
+
+	purchase := models.CommissionPurchaseFirst
+	if renewal {
+		purchase = models.CommissionPurchaseRenewal
+	}
+	var best *models.CommissionRule
+	for i := range rules {
+		rule := &rules[i]
+		if !matchesCondition(rule.PlanTypes, sale.Plan.Type) ||
+			!matchesCondition(rule.Categories, sale.Category) ||
+			!matchesCondition(rule.Regions, sale.Region) ||
+			(rule.PurchaseType != "" && rule.PurchaseType != purchase) {
+			continue
+		}
+		if best == nil || betterRule(rule, best) {
+			best = rule
+		}
+	}
+	return best, nil
+}
+
+func betterRule(rule, than *models.CommissionRule) bool {
+	if rule.Priority != than.Priority {
+		return rule.Priority > than.Priority
+	}
+	if rule.Conditions() != than.Conditions() {
+		return rule.Conditions() > than.Conditions()
+	}
+	return rule.EffectiveFrom.After(than.EffectiveFrom)
+}
+
+// matchesCondition reports whether value is one of the allowed values, ignoring case; no allowed values matches anything
+func matchesCondition(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, candidate := range allowed {
+		if strings.EqualFold(strings.TrimSpace(candidate), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveRules returns the rule versions in effect at a time, one per rule at most
+func (s *CommissionService) effectiveRules(ctx context.Context, at time.Time) ([]models.CommissionRule, error) {
+	cursor, err := s.DB.Collection("commission_rules").Find(ctx, bson.M{
+		"effectiveFrom": bson.M{"$lte": at},
+		"$or": []bson.M{
+			{"effectiveTo": bson.M{"$exists": false}},
+			{"effectiveTo": nil},
+			{"effectiveTo": bson.M{"$gt": at}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commission rules: %w", err)
+	}
+	rules := []models.CommissionRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Record calculates the split of a sale and stores its commission row, without paying anything into the wallets
+func (s *CommissionService) Record(ctx context.Context, sale CommissionSale) (*CommissionSplit, error) {
+	split, err := s.Calculate(ctx, sale)
+	if err != nil {
+		return nil, err
+	}
+	if split.SalespersonID.IsZero() {
+		return split, nil
+	}
+
+	commission := models.Commission{
+		ID:                            primitive.NewObjectID(),
+		SubscriptionID:                sale.SubscriptionID,
+		CompanyID:                     sale.BusinessID,
+		PlanID:                        sale.Plan.ID,
+		PlanPrice:                     sale.Amount,
+		AdminID:                       split.AdminID,
+		AdminCommission:               split.PlatformAmount,
+		AdminCommissionPercent:        split.AdminPercent,
+		SalespersonID:                 split.SalespersonID,
+		SalespersonCommission:         split.SalespersonAmount,
+		SalespersonCommissionPercent:  split.SalespersonPercent,
+		SalesManagerID:                split.SalesManagerID,
+		SalesManagerCommission:        split.SalesManagerAmount,
+		SalesManagerCommissionPercent: split.SalesManagerPercent,
+		RuleSource:                    split.Source,
+		Renewal:                       split.Renewal,
+		PlanChange:                    sale.PlanChange,
+		CreatedAt:                     time.Now(),
+	}
+	if split.Rule != nil {
+		commission.RuleID = &split.Rule.RuleID
+		commission.RuleVersionID = &split.Rule.ID
+		commission.RuleVersion = split.Rule.Version
+	}
+	if _, err := s.DB.Collection("commissions").InsertOne(ctx, commission); err != nil {
+		return nil, fmt.Errorf("failed to insert commission: %w", err)
+	}
+
+	log.Printf("Commission recorded (%s) - Amount: $%.2f, Salesperson: $%.2f (%.1f%%), Sales Manager: $%.2f (%.1f%%), Platform: $%.2f",
+		split.Source, sale.Amount, split.SalespersonAmount, split.SalespersonPercent, split.SalesManagerAmount, split.SalesManagerPercent, split.PlatformAmount)
+	return split, nil
+}
+
+// Distribute records the commission row of a paid subscription and books the salesperson and sales manager
+// commissions and the platform share, all in one transaction (joining the caller's, if any)
+func (s *CommissionService) Distribute(ctx context.Context, sale CommissionSale) (*CommissionSplit, error) {
+	referenceType := commissionReferenceTypes[sale.Kind]
+	if referenceType == "" {
+		return nil, ErrInvalidSubscriptionKind
+	}
+
+	var split *CommissionSplit
+	err := ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		var err error
+		split, err = s.Record(sessCtx, sale)
+		if err != nil {
+			return err
+		}
+
+		wallet := NewWalletService(s.DB)
+		description := fmt.Sprintf("Commission from %s - %s", referenceType, sale.BusinessName)
+		if sale.PlanChange {
+			description = fmt.Sprintf("Commission on plan change of %s - %s", referenceType, sale.BusinessName)
+		}
+		if err := wallet.RecordCommission(sessCtx, "salesperson", split.SalespersonID, split.SalespersonAmount, sale.SubscriptionID, referenceType, description); err != nil {
+			return err
+		}
+		if err := wallet.RecordCommission(sessCtx, "sales_manager", split.SalesManagerID, split.SalesManagerAmount, sale.SubscriptionID, referenceType, description); err != nil {
+			return err
+		}
+
+		name := sale.BusinessName
+		if sale.EntityName != "" {
+			name += " - " + sale.EntityName
+		}
+		return wallet.RecordSubscriptionIncome(sessCtx, split.PlatformAmount, sale.SubscriptionID, referenceType,
+			fmt.Sprintf("Subscription income from %s (%s)", name, referenceType))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// SaleFor describes the sale of a subscription to a branch or service provider, loading the business it belongs to
+func (s *CommissionService) SaleFor(ctx context.Context, kind string, entityID primitive.ObjectID, plan models.SubscriptionPlan, subscriptionID primitive.ObjectID, amount float64) (CommissionSale, error) {
+	sale := CommissionSale{Kind: kind, SubscriptionID: subscriptionID, EntityID: entityID, Plan: plan, Amount: amount}
+
+	switch kind {
+	case SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch:
+		var business struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			UserID       primitive.ObjectID `bson:"userId"`
+			CreatedBy    primitive.ObjectID `bson:"createdBy"`
+			BusinessName string             `bson:"businessName"`
+			Category     string             `bson:"category"`
+			ContactInfo  models.ContactInfo `bson:"contactInfo"`
+			Branches     []models.Branch    `bson:"branches"`
+		}
+		collectionName := "companies"
+		if kind == SubscriptionKindWholesalerBranch {
+			collectionName = "wholesalers"
+		}
+		if err := s.DB.Collection(collectionName).FindOne(ctx, bson.M{"branches._id": entityID}).Decode(&business); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return sale, ErrSubscriptionEntityNotFound
+			}
+			return sale, err
+		}
+		sale.BusinessID, sale.BusinessName = business.ID, business.BusinessName
+		for _, branch := range business.Branches {
+			if branch.ID == entityID {
+				sale.EntityName, sale.Category, sale.Region = branch.Name, branch.Category, branch.Location.Governorate
+				break
+			}
+		}
+		if sale.Category == "" {
+			sale.Category = business.Category
+		}
+		if sale.Region == "" {
+			sale.Region = business.ContactInfo.Address.Governorate
+		}
+		if business.CreatedBy != business.UserID {
+			sale.CreatedBy = business.CreatedBy
+		}
+
+	case SubscriptionKindServiceProvider:
+		var serviceProvider models.ServiceProvider
+		if err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": entityID}).Decode(&serviceProvider); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return sale, ErrSubscriptionEntityNotFound
+			}
+			return sale, err
+		}
+		sale.BusinessID, sale.BusinessName = serviceProvider.ID, serviceProvider.BusinessName
+		sale.Category, sale.Region = serviceProvider.Category, serviceProvider.Governorate
+		if sale.Region == "" {
+			sale.Region = serviceProvider.ContactInfo.Address.Governorate
+		}
+		if serviceProvider.CreatedBy != serviceProvider.UserID {
+			sale.CreatedBy = serviceProvider.CreatedBy
+		}
+
+	default:
+		return sale, ErrInvalidSubscriptionKind
+	}
+	return sale, nil
+}
+
+// CreateRule stores the first version of a commission rule
+func (s *CommissionService) CreateRule(ctx context.Context, req models.CommissionRuleRequest, createdBy primitive.ObjectID) (*models.CommissionRule, error) {
+	id := primitive.NewObjectID()
+	rule := newCommissionRuleVersion(req, createdBy)
+	rule.ID = id
+	rule.RuleID = id
+	rule.Version = 1
+	if _, err := s.DB.Collection("commission_rules").InsertOne(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to store commission rule: %w", err)
+	}
+	return rule, nil
+}
+
+// UpdateRule stores a new version of a rule, effective from the requested date (now by default).
+// The current version ends when the new one takes effect.
+func (s *CommissionService) UpdateRule(ctx context.Context, ruleID primitive.ObjectID, req models.CommissionRuleRequest, createdBy primitive.ObjectID) (*models.CommissionRule, error) {
+	rule := newCommissionRuleVersion(req, createdBy)
+
+	err := ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		latest, err := s.latestVersion(sessCtx, ruleID)
+		if err != nil {
+			return err
+		}
+		if latest.EffectiveTo != nil && !latest.EffectiveTo.After(time.Now()) {
+			return ErrCommissionRuleEnded
+		}
+		if !rule.EffectiveFrom.After(latest.EffectiveFrom) {
+			return ErrCommissionRuleDate
+		}
+
+		_, err = s.DB.Collection("commission_rules").UpdateOne(sessCtx,
+			bson.M{"_id": latest.ID},
+			bson.M{"$set": bson.M{"effectiveTo": rule.EffectiveFrom}},
+		)
+		if err != nil {
+			return err
+		}
+
+		rule.ID = primitive.NewObjectID()
+		rule.RuleID = ruleID
+		rule.Version = latest.Version + 1
+		_, err = s.DB.Collection("commission_rules").InsertOne(sessCtx, rule)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// EndRule stops a rule from matching sales made from now on
+func (s *CommissionService) EndRule(ctx context.Context, ruleID primitive.ObjectID) (*models.CommissionRule, error) {
+	latest, err := s.latestVersion(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if latest.EffectiveTo != nil && !latest.EffectiveTo.After(now) {
+		return nil, ErrCommissionRuleEnded
+	}
+	if _, err := s.DB.Collection("commission_rules").UpdateOne(ctx, bson.M{"_id": latest.ID}, bson.M{"$set": bson.M{"effectiveTo": now}}); err != nil {
+		return nil, err
+	}
+	latest.EffectiveTo = &now
+	return latest, nil
+}
+
+// Rules returns the latest version of every rule, optionally leaving out the rules that have ended
+func (s *CommissionService) Rules(ctx context.Context, includeEnded bool) ([]models.CommissionRule, error) {
+	cursor, err := s.DB.Collection("commission_rules").Aggregate(ctx, []bson.M{
+		{"$sort": bson.M{"version": -1}},
+		{"$group": bson.M{"_id": "$ruleId", "latest": bson.M{"$first": "$$ROOT"}}},
+		{"$replaceRoot": bson.M{"newRoot": "$latest"}},
+		{"$sort": bson.D{{Key: "priority", Value: -1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	all := []models.CommissionRule{}
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	if includeEnded {
+		return all, nil
+	}
+
+	now := time.Now()
+	rules := []models.CommissionRule{}
+	for _, rule := range all {
+		if rule.EffectiveTo == nil || rule.EffectiveTo.After(now) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Versions returns every version of a rule, newest first
+func (s *CommissionService) Versions(ctx context.Context, ruleID primitive.ObjectID) ([]models.CommissionRule, error) {
+	cursor, err := s.DB.Collection("commission_rules").Find(ctx, bson.M{"ruleId": ruleID}, options.Find().SetSort(bson.D{{Key: "version", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	versions := []models.CommissionRule{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrCommissionRuleNotFound
+	}
+	return versions, nil
+}
+
+func (s *CommissionService) latestVersion(ctx context.Context, ruleID primitive.ObjectID) (*models.CommissionRule, error) {
+	var rule models.CommissionRule
+	err := s.DB.Collection("commission_rules").FindOne(ctx, bson.M{"ruleId": ruleID}, options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommissionRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func newCommissionRuleVersion(req models.CommissionRuleRequest, createdBy primitive.ObjectID) *models.CommissionRule {
+	now := time.Now()
+	effectiveFrom := now
+	if req.EffectiveFrom != nil {
+		effectiveFrom = *req.EffectiveFrom
+	}
+	sort.Slice(req.Tiers, func(i, j int) bool { return req.Tiers[i].MinSales < req.Tiers[j].MinSales })
+	return &models.CommissionRule{
+		Name:                strings.TrimSpace(req.Name),
+		PlanTypes:           req.PlanTypes,
+		Categories:          req.Categories,
+		Regions:             req.Regions,
+		PurchaseType:        req.PurchaseType,
+		Priority:            req.Priority,
+		SalespersonPercent:  req.SalespersonPercent,
+		SalesManagerPercent: req.SalesManagerPercent,
+		Tiers:               req.Tiers,
+		EffectiveFrom:       effectiveFrom,
+		EffectiveTo:         req.EffectiveTo,
+		CreatedBy:           createdBy,
+		CreatedAt:           now,
+	}
+}
+
+// roundCents rounds an amount to cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
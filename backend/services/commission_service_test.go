@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestCapCommissionPercents(t *testing.T) {
+	tests := []struct {
+		salesperson, salesManager float64
+		wantSalesperson           float64
+		wantSalesManager          float64
+	}{
+		{10, 5, 10, 5},
+		{60, 40, 60, 40},
+		{100, 0, 100, 0},
+		{90, 30, 75, 25},
+		{150, 0, 100, 0},
+	}
+
+	for _, tt := range tests {
+		salesperson, salesManager := capCommissionPercents(tt.salesperson, tt.salesManager)
+		if salesperson != tt.wantSalesperson || salesManager != tt.wantSalesManager {
+			t.Errorf("capCommissionPercents(%v, %v) = %v, %v, want %v, %v",
+				tt.salesperson, tt.salesManager, salesperson, salesManager, tt.wantSalesperson, tt.wantSalesManager)
+		}
+	}
+}
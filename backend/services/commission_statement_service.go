@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	commissionStatementLockKey = "barrim:jobs:commission-statements"
+	commissionStatementLayout  = "2006-01"
+)
+
+// Errors returned by the commission statement service
+var (
+	ErrCommissionStatementNotFound = errors.New("commission statement not found")
+	ErrInvalidStatementPeriod      = errors.New("period must be a past month formatted YYYY-MM")
+)
+
+// CommissionStatementService generates the monthly statements of the commission and referral balances of
+// salespersons and sales managers from the ledger. Statements are stored once generated and never changed;
+// an admin can regenerate one, which stores a new version with an audit note.
+type CommissionStatementService struct {
+	DB     *mongo.Database
+	Ledger *ledger.Ledger
+}
+
+// NewCommissionStatementService creates a new commission statement service
+func NewCommissionStatementService(db *mongo.Database) *CommissionStatementService {
+	return &CommissionStatementService{DB: db, Ledger: ledger.New(db)}
+}
+
+// StatementPeriod returns the start and exclusive end of a "YYYY-MM" period, which must have ended
+func StatementPeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(commissionStatementLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidStatementPeriod
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(time.Now()) {
+		return time.Time{}, time.Time{}, ErrInvalidStatementPeriod
+	}
+	return start, end, nil
+}
+
+// Run generates the statements of the month that just ended for every salesperson and sales manager
+// with a commission or referral account. People who already have a statement for the month are skipped,
+// so the job can run as often as needed.
+func (s *CommissionStatementService) Run() {
+	ran := utils.RunWithJobLock(commissionStatementLockKey, 30*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+		defer cancel()
+
+		now := time.Now()
+		period := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0).Format(commissionStatementLayout)
+
+		payees, err := NewPayoutService(s.DB).balances(ctx)
+		if err != nil {
+			log.Printf("Failed to list commission accounts for statements: %v", err)
+			return
+		}
+
+		generated := 0
+		for _, payee := range payees {
+			count, err := s.DB.Collection("commission_statements").CountDocuments(ctx, bson.M{
+				"userId": payee.UserID, "userType": payee.UserType, "period": period,
+			})
+			if err != nil {
+				log.Printf("Failed to check statement of %s %s: %v", payee.UserType, payee.UserID.Hex(), err)
+				continue
+			}
+			if count > 0 {
+				continue
+			}
+
+			statement, err := s.build(ctx, payee.UserType, payee.UserID, period)
+			if err != nil {
+				log.Printf("Failed to build statement of %s %s for %s: %v", payee.UserType, payee.UserID.Hex(), period, err)
+				continue
+			}
+			// Nothing to report for people without a balance or any movement
+			if statement.OpeningBalance == 0 && len(statement.Lines) == 0 {
+				continue
+			}
+			if err := s.store(ctx, statement); err != nil {
+				log.Printf("Failed to store statement of %s %s for %s: %v", payee.UserType, payee.UserID.Hex(), period, err)
+				continue
+			}
+			generated++
+		}
+		if generated > 0 {
+			log.Printf("Generated %d commission statements for %s", generated, period)
+		}
+	})
+	if !ran {
+		log.Println("Commission statements skipped: another instance holds the lock")
+	}
+}
+
+// Regenerate stores a new version of a statement from the current ledger, recording who asked for it and why
+func (s *CommissionStatementService) Regenerate(ctx context.Context, role string, userID primitive.ObjectID, period string, adminID primitive.ObjectID, auditNote string) (*models.CommissionStatement, error) {
+	collection := payoutCollection(role)
+	if collection == "" {
+		return nil, ErrPayoutPayeeNotFound
+	}
+	if count, err := s.DB.Collection(collection).CountDocuments(ctx, bson.M{"_id": userID}); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, ErrPayoutPayeeNotFound
+	}
+
+	statement, err := s.build(ctx, role, userID, period)
+	if err != nil {
+		return nil, err
+	}
+	statement.GeneratedBy = &adminID
+	statement.AuditNote = strings.TrimSpace(auditNote)
+	if err := s.store(ctx, statement); err != nil {
+		return nil, err
+	}
+	log.Printf("Commission statement %s of %s %s regenerated by admin %s (version %d): %s",
+		period, role, userID.Hex(), adminID.Hex(), statement.Version, statement.AuditNote)
+	return statement, nil
+}
+
+// store saves a statement as the next version of its period
+func (s *CommissionStatementService) store(ctx context.Context, statement *models.CommissionStatement) error {
+	previous, err := s.Latest(ctx, statement.UserType, statement.UserID, statement.Period)
+	if err != nil && !errors.Is(err, ErrCommissionStatementNotFound) {
+		return err
+	}
+	statement.Version = 1
+	if previous != nil {
+		statement.Version = previous.Version + 1
+		statement.Supersedes = &previous.ID
+	}
+	if _, err := s.DB.Collection("commission_statements").InsertOne(ctx, statement); err != nil {
+		return fmt.Errorf("failed to store commission statement: %w", err)
+	}
+	return nil
+}
+
+// build computes the statement of one person for a period from the ledger, without storing it
+func (s *CommissionStatementService) build(ctx context.Context, role string, userID primitive.ObjectID, period string) (*models.CommissionStatement, error) {
+	start, end, err := StatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	payee := models.PayoutItem{UserID: userID, UserType: role}
+	if err := NewPayoutService(s.DB).describePayee(ctx, &payee); err != nil {
+		return nil, err
+	}
+
+	accounts := map[string]bool{ledger.CommissionAccount(role, userID): true}
+	if role == "salesperson" {
+		accounts[ledger.ReferralAccount(userID)] = true
+	}
+	accountIDs := make([]string, 0, len(accounts))
+	for account := range accounts {
+		accountIDs = append(accountIDs, account)
+	}
+
+	opening, err := s.Ledger.BalanceBefore(ctx, accountIDs, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute opening balance: %w", err)
+	}
+	transactions, err := s.Ledger.Between(ctx, accountIDs, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ledger transactions: %w", err)
+	}
+
+	statement := &models.CommissionStatement{
+		ID:             primitive.NewObjectID(),
+		UserID:         userID,
+		UserType:       role,
+		Name:           payee.Name,
+		Email:          payee.Email,
+		Period:         period,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		OpeningBalance: opening,
+		Lines:          []models.CommissionStatementLine{},
+		GeneratedAt:    time.Now(),
+	}
+
+	sales := map[primitive.ObjectID]statementSale{}
+	balance := opening
+	for _, tx := range transactions {
+		amount := 0.0
+		for _, entry := range tx.Entries {
+			if accounts[entry.Account] {
+				amount += entry.Credit - entry.Debit
+			}
+		}
+		amount = roundCents(amount)
+		if amount == 0 {
+			continue
+		}
+		balance = roundCents(balance + amount)
+
+		line := models.CommissionStatementLine{
+			Date:          tx.CreatedAt,
+			Description:   tx.Description,
+			ReferenceID:   tx.ReferenceID,
+			TransactionID: tx.ID,
+			Amount:        amount,
+			Balance:       balance,
+		}
+		switch tx.Type {
+		case ledger.TypeCommission:
+			line.Kind = models.StatementLineCommission
+			statement.TotalCommissions += amount
+			sale, ok := sales[tx.ReferenceID]
+			if !ok {
+				sale = s.describeSale(ctx, tx.ReferenceType, tx.ReferenceID)
+				sales[tx.ReferenceID] = sale
+			}
+			line.BusinessName, line.BranchName, line.PlanTitle = sale.BusinessName, sale.BranchName, sale.PlanTitle
+			line.Description = sale.description(tx.Description)
+		case ledger.TypeReferralReward:
+			line.Kind = models.StatementLineReferral
+			statement.TotalReferrals += amount
+		case ledger.TypeWithdrawal:
+			line.Kind = models.StatementLineWithdrawal
+			line.Description = "Withdrawal paid"
+			statement.TotalWithdrawals += -amount
+		case ledger.TypeRefund:
+			line.Kind = models.StatementLineRefund
+			statement.TotalOther += amount
+		default:
+			line.Kind = models.StatementLineAdjustment
+			statement.TotalOther += amount
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+
+	statement.TotalCommissions = roundCents(statement.TotalCommissions)
+	statement.TotalReferrals = roundCents(statement.TotalReferrals)
+	statement.TotalWithdrawals = roundCents(statement.TotalWithdrawals)
+	statement.TotalOther = roundCents(statement.TotalOther)
+	statement.ClosingBalance = balance
+	return statement, nil
+}
+
+// statementSale names the business, branch and plan a commission was earned on
+type statementSale struct {
+	BusinessName string
+	BranchName   string
+	PlanTitle    string
+}
+
+func (sale statementSale) description(fallback string) string {
+	if sale.BusinessName == "" {
+		return fallback
+	}
+	description := "Commission on " + sale.BusinessName
+	if sale.BranchName != "" {
+		description += " - " + sale.BranchName
+	}
+	if sale.PlanTitle != "" {
+		description += " (" + sale.PlanTitle + ")"
+	}
+	return description
+}
+
+// describeSale looks up the subscription a commission was posted for. Lookup failures leave the
+// line with the ledger description rather than failing the statement.
+func (s *CommissionStatementService) describeSale(ctx context.Context, referenceType string, subscriptionID primitive.ObjectID) statementSale {
+	var sale statementSale
+	var planID primitive.ObjectID
+
+	kind := ""
+	for candidate, reference := range commissionReferenceTypes {
+		if reference == referenceType {
+			kind = candidate
+		}
+	}
+	if cfg, ok := subscriptionKinds[kind]; ok {
+		var subscription struct {
+			PlanID            primitive.ObjectID `bson:"planId"`
+			BranchID          primitive.ObjectID `bson:"branchId,omitempty"`
+			ServiceProviderID primitive.ObjectID `bson:"serviceProviderId,omitempty"`
+		}
+		if err := s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx, bson.M{"_id": subscriptionID}).Decode(&subscription); err == nil {
+			planID = subscription.PlanID
+			entityID := subscription.BranchID
+			if kind == SubscriptionKindServiceProvider {
+				entityID = subscription.ServiceProviderID
+			}
+			if target, err := NewSubscriptionService(s.DB).TargetForEntity(ctx, kind, entityID); err == nil {
+				sale.BusinessName = target.OwnerName
+				if kind != SubscriptionKindServiceProvider {
+					sale.BranchName = target.EntityName
+				}
+			}
+		}
+	}
+
+	// Older commissions only reference the business from the commission row
+	if sale.BusinessName == "" || planID.IsZero() {
+		var commission models.Commission
+		if err := s.DB.Collection("commissions").FindOne(ctx, bson.M{"subscriptionId": subscriptionID}).Decode(&commission); err == nil {
+			if planID.IsZero() {
+				planID = commission.PlanID
+			}
+			if sale.BusinessName == "" && !commission.CompanyID.IsZero() {
+				sale.BusinessName = s.businessName(ctx, commission.CompanyID)
+			}
+		}
+	}
+
+	if !planID.IsZero() {
+		var plan models.SubscriptionPlan
+		if err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": planID}).Decode(&plan); err == nil {
+			sale.PlanTitle = plan.Title
+		}
+	}
+	return sale
+}
+
+// businessName finds a company, wholesaler or service provider by ID
+func (s *CommissionStatementService) businessName(ctx context.Context, id primitive.ObjectID) string {
+	for _, collection := range []string{"companies", "wholesalers", "serviceProviders"} {
+		var business struct {
+			BusinessName string `bson:"businessName"`
+		}
+		err := s.DB.Collection(collection).FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"businessName": 1})).Decode(&business)
+		if err == nil {
+			return business.BusinessName
+		}
+	}
+	return ""
+}
+
+// Latest returns the current version of a statement
+func (s *CommissionStatementService) Latest(ctx context.Context, role string, userID primitive.ObjectID, period string) (*models.CommissionStatement, error) {
+	var statement models.CommissionStatement
+	err := s.DB.Collection("commission_statements").FindOne(ctx,
+		bson.M{"userId": userID, "userType": role, "period": period},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&statement)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommissionStatementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// Get returns one stored statement version
+func (s *CommissionStatementService) Get(ctx context.Context, id primitive.ObjectID) (*models.CommissionStatement, error) {
+	var statement models.CommissionStatement
+	err := s.DB.Collection("commission_statements").FindOne(ctx, bson.M{"_id": id}).Decode(&statement)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommissionStatementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// List returns statements matching the filter, newest period first, without their lines
+func (s *CommissionStatementService) List(ctx context.Context, filter bson.M, page, limit int64) ([]models.CommissionStatement, int64, error) {
+	total, err := s.DB.Collection("commission_statements").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := s.DB.Collection("commission_statements").Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "period", Value: -1}, {Key: "version", Value: -1}}).
+		SetSkip((page-1)*limit).
+		SetLimit(limit).
+		SetProjection(bson.M{"lines": 0}),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	statements := []models.CommissionStatement{}
+	if err := cursor.All(ctx, &statements); err != nil {
+		return nil, 0, err
+	}
+	return statements, total, nil
+}
+
+// RenderPDF renders a commission statement
+func (s *CommissionStatementService) RenderPDF(statement *models.CommissionStatement) []byte {
+	doc := utils.NewPDFDocument()
+	left, right := 50.0, utils.PDFPageWidth-50
+	y := utils.PDFPageHeight - 70
+
+	doc.Text(left, y, 22, true, "Barrim")
+	doc.TextRight(right, y, 16, true, "COMMISSION STATEMENT")
+	y -= 22
+	doc.TextRight(right, y, 10, false, statement.PeriodStart.Format("January 2006"))
+	y -= 14
+	doc.TextRight(right, y, 10, false, "Generated "+statement.GeneratedAt.Format("2006-01-02"))
+	if statement.Version > 1 {
+		y -= 14
+		doc.TextRight(right, y, 10, false, fmt.Sprintf("Version %d", statement.Version))
+	}
+	y -= 30
+	doc.Line(left, y, right, y)
+
+	y -= 30
+	doc.Text(left, y, 11, true, "Statement for")
+	y -= 16
+	doc.Text(left, y, 10, false, statement.Name)
+	y -= 14
+	doc.Text(left, y, 10, false, strings.ReplaceAll(statement.UserType, "_", " "))
+	if statement.Email != "" {
+		y -= 14
+		doc.Text(left, y, 10, false, statement.Email)
+	}
+
+	y -= 40
+	doc.Text(left, y, 10, true, "Date")
+	doc.Text(left+80, y, 10, true, "Description")
+	doc.TextRight(right-90, y, 10, true, "Amount")
+	doc.TextRight(right, y, 10, true, "Balance")
+	y -= 8
+	doc.Line(left, y, right, y)
+	y -= 18
+	doc.Text(left+80, y, 9, false, "Opening balance")
+	doc.TextRight(right, y, 9, false, fmt.Sprintf("%.2f USD", statement.OpeningBalance))
+	for _, line := range statement.Lines {
+		// Keep room for the totals and the footer
+		if y < 190 {
+			y -= 18
+			doc.Text(left, y, 9, false, "More entries are included in the JSON statement.")
+			break
+		}
+		y -= 18
+		doc.Text(left, y, 9, false, line.Date.Format("2006-01-02"))
+		doc.Text(left+80, y, 9, false, line.Description)
+		doc.TextRight(right-90, y, 9, false, fmt.Sprintf("%.2f", line.Amount))
+		doc.TextRight(right, y, 9, false, fmt.Sprintf("%.2f USD", line.Balance))
+	}
+	y -= 12
+	doc.Line(left, y, right, y)
+
+	totals := []struct {
+		label  string
+		amount float64
+	}{
+		{"Opening balance", statement.OpeningBalance},
+		{"Commissions", statement.TotalCommissions},
+		{"Referral rewards", statement.TotalReferrals},
+		{"Withdrawals", -statement.TotalWithdrawals},
+	}
+	if statement.TotalOther != 0 {
+		totals = append(totals, struct {
+			label  string
+			amount float64
+		}{"Refunds and adjustments", statement.TotalOther})
+	}
+	for _, total := range totals {
+		y -= 16
+		doc.Text(right-200, y, 10, false, total.label)
+		doc.TextRight(right, y, 10, false, fmt.Sprintf("%.2f USD", total.amount))
+	}
+	y -= 18
+	doc.Text(right-200, y, 11, true, "Closing balance")
+	doc.TextRight(right, y, 11, true, fmt.Sprintf("%.2f USD", statement.ClosingBalance))
+
+	footer := "Balances are taken from the ledger for " + statement.PeriodStart.Format("2006-01-02") + " to " +
+		statement.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02") + "."
+	if statement.AuditNote != "" {
+		doc.Text(left, 64, 8, false, "Regenerated: "+statement.AuditNote)
+	}
+	doc.Text(left, 50, 8, false, footer)
+	return doc.Bytes()
+}
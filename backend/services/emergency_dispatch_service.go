@@ -0,0 +1,650 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"github.com/HSouheill/barrim_backend/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by the emergency dispatch service
+var (
+	ErrDispatchServiceType  = errors.New("an emergency request needs a service type")
+	ErrDispatchLocation     = errors.New("an emergency request needs a location")
+	ErrDispatchNotFound     = errors.New("emergency dispatch not found")
+	ErrDispatchOfferMissing = errors.New("you have no open offer for this emergency request")
+	ErrDispatchTaken        = errors.New("this emergency request was already taken by another provider")
+	ErrDispatchCancelled    = errors.New("this emergency request was cancelled by the customer")
+)
+
+const emergencyDispatchLockKey = "barrim:jobs:emergency-dispatch"
+
+// envPositive reads a positive number from the environment
+func envPositive(name string, fallback float64) float64 {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EmergencyOfferTimeout is how long a provider has to answer an emergency offer before the dispatch moves on,
+// set in seconds with EMERGENCY_OFFER_TIMEOUT_SECONDS (default 60)
+func EmergencyOfferTimeout() time.Duration {
+	return envDuration("EMERGENCY_OFFER_TIMEOUT_SECONDS", 60, time.Second)
+}
+
+// emergencyDispatchSettings returns how many providers each round is offered to (EMERGENCY_DISPATCH_PROVIDERS,
+// default 3) and the radius of the first round and the largest radius in kilometres (EMERGENCY_DISPATCH_RADIUS_KM,
+// default 5, and EMERGENCY_DISPATCH_MAX_RADIUS_KM, default 40). The radius doubles each round.
+func emergencyDispatchSettings() (providers int, radiusKm, maxRadiusKm float64) {
+	providers = int(envPositive("EMERGENCY_DISPATCH_PROVIDERS", 3))
+	radiusKm = envPositive("EMERGENCY_DISPATCH_RADIUS_KM", 5)
+	maxRadiusKm = math.Max(envPositive("EMERGENCY_DISPATCH_MAX_RADIUS_KM", 40), radiusKm)
+	return providers, radiusKm, maxRadiusKm
+}
+
+// EmergencyDispatchService offers emergency bookings to the nearest available providers of the requested service type.
+// Each round goes to a few providers at once; the first to accept gets the booking and the offer is withdrawn from
+// the others. Offers left unanswered expire, and the next round reaches further out. Every step is kept on the
+// dispatch as its audit trail.
+type EmergencyDispatchService struct {
+	DB  *mongo.Database
+	Hub *websocket.Hub // Real-time offers; nil sends push notifications only
+}
+
+// NewEmergencyDispatchService creates a new emergency dispatch service
+func NewEmergencyDispatchService(db *mongo.Database, hub *websocket.Hub) *EmergencyDispatchService {
+	return &EmergencyDispatchService{DB: db, Hub: hub}
+}
+
+// dispatchCandidate is an available provider within reach of an emergency
+type dispatchCandidate struct {
+	userID            primitive.ObjectID
+	serviceProviderID primitive.ObjectID
+	name              string
+	distanceKm        float64
+}
+
+// Start inserts an emergency booking without a provider and sends the first round of offers for it.
+// When no provider at all is within the largest radius the dispatch is exhausted and the booking cancelled.
+func (s *EmergencyDispatchService) Start(ctx context.Context, booking *models.Booking, serviceType string, lat, lng float64) (*models.EmergencyDispatch, error) {
+	if serviceType == "" {
+		return nil, ErrDispatchServiceType
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 || (lat == 0 && lng == 0) {
+		return nil, ErrDispatchLocation
+	}
+
+	now := time.Now()
+	dispatch := models.EmergencyDispatch{
+		ID:          primitive.NewObjectID(),
+		BookingID:   booking.ID,
+		UserID:      booking.UserID,
+		ServiceType: serviceType,
+		Lat:         lat,
+		Lng:         lng,
+		Status:      models.DispatchStatusSearching,
+		Offers:      []models.EmergencyDispatchOffer{},
+		Events:      []models.EmergencyDispatchEvent{{Type: "created", At: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	booking.ServiceProviderID = primitive.NilObjectID
+	booking.DispatchID = &dispatch.ID
+	if _, err := s.DB.Collection("bookings").InsertOne(ctx, booking); err != nil {
+		return nil, err
+	}
+	if _, err := s.DB.Collection("emergencyDispatches").InsertOne(ctx, dispatch); err != nil {
+		return nil, err
+	}
+	if err := s.advance(ctx, &dispatch, now); err != nil {
+		return nil, err
+	}
+	return s.load(ctx, bson.M{"_id": dispatch.ID})
+}
+
+// load finds a dispatch
+func (s *EmergencyDispatchService) load(ctx context.Context, filter bson.M) (*models.EmergencyDispatch, error) {
+	var dispatch models.EmergencyDispatch
+	if err := s.DB.Collection("emergencyDispatches").FindOne(ctx, filter).Decode(&dispatch); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDispatchNotFound
+		}
+		return nil, err
+	}
+	return &dispatch, nil
+}
+
+// ForBooking returns the dispatch of an emergency booking
+func (s *EmergencyDispatchService) ForBooking(ctx context.Context, bookingID primitive.ObjectID) (*models.EmergencyDispatch, error) {
+	return s.load(ctx, bson.M{"bookingId": bookingID})
+}
+
+// candidates finds the available providers of the dispatch's service type within radiusKm, nearest first,
+// leaving out the providers in exclude and those who blocked the user
+func (s *EmergencyDispatchService) candidates(ctx context.Context, dispatch *models.EmergencyDispatch, radiusKm float64, exclude map[primitive.ObjectID]bool, limit int) ([]dispatchCandidate, error) {
+	// A bounding box narrows the search before exact distances are computed
+	latDelta := radiusKm / 111.0
+	lngDelta := 180.0
+	if cos := math.Cos(dispatch.Lat * math.Pi / 180); cos > 0.01 {
+		lngDelta = math.Min(radiusKm/(111.0*cos), 180)
+	}
+	cursor, err := s.DB.Collection("users").Find(ctx, bson.M{
+		"_id":                             bson.M{"$ne": dispatch.UserID},
+		"userType":                        "serviceProvider",
+		"serviceProviderInfo.serviceType": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(dispatch.ServiceType) + "$", Options: "i"},
+		"serviceProviderInfo.status":      "available",
+		"location.lat":                    bson.M{"$gte": dispatch.Lat - latDelta, "$lte": dispatch.Lat + latDelta},
+		"location.lng":                    bson.M{"$gte": dispatch.Lng - lngDelta, "$lte": dispatch.Lng + lngDelta},
+	}, options.Find().SetProjection(bson.M{"fullName": 1, "location": 1, "serviceProviderId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	var found []dispatchCandidate
+	for _, user := range users {
+		if exclude[user.ID] || user.Location == nil {
+			continue
+		}
+		distanceKm := utils.CalculateDistance(dispatch.Lat, dispatch.Lng, user.Location.Lat, user.Location.Lng) / 1000
+		if distanceKm > radiusKm {
+			continue
+		}
+		found = append(found, dispatchCandidate{userID: user.ID, serviceProviderID: user.ID, name: user.FullName, distanceKm: math.Round(distanceKm*10) / 10})
+		if user.ServiceProviderID != nil {
+			found[len(found)-1].serviceProviderID = *user.ServiceProviderID
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].distanceKm < found[j].distanceKm })
+
+	attendanceService := NewBookingAttendanceService(s.DB)
+	var picked []dispatchCandidate
+	for _, candidate := range found {
+		if len(picked) == limit {
+			break
+		}
+		// Bookings carry the serviceProviders document of the provider when there is one
+		var provider models.ServiceProvider
+		err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"$or": []bson.M{
+			{"_id": candidate.serviceProviderID},
+			{"userId": candidate.userID},
+		}}).Decode(&provider)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err == nil {
+			candidate.serviceProviderID = provider.ID
+			if _, err := attendanceService.CheckBookingPolicy(ctx, provider, dispatch.UserID); errors.Is(err, ErrBookingBlocked) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		picked = append(picked, candidate)
+	}
+	return picked, nil
+}
+
+// advance starts the next round of a dispatch once none of its offers is open any more: unanswered offers expire,
+// and the radius widens until it reaches available providers who were not offered the booking yet. A dispatch
+// that finds nobody within the largest radius is exhausted and its booking cancelled.
+// Concurrent calls are settled by the round number, so a round is only ever sent once.
+func (s *EmergencyDispatchService) advance(ctx context.Context, dispatch *models.EmergencyDispatch, now time.Time) error {
+	if dispatch.Status != models.DispatchStatusSearching {
+		return nil
+	}
+	offers := append([]models.EmergencyDispatchOffer(nil), dispatch.Offers...)
+	var events []models.EmergencyDispatchEvent
+	offered := make(map[primitive.ObjectID]bool)
+	for i := range offers {
+		offered[offers[i].ProviderUserID] = true
+		if offers[i].Status != models.OfferStatusOffered {
+			continue
+		}
+		if offers[i].ExpiresAt.After(now) {
+			return nil
+		}
+		offers[i].Status = models.OfferStatusExpired
+		providerUserID := offers[i].ProviderUserID
+		events = append(events, models.EmergencyDispatchEvent{Type: "expired", ProviderUserID: &providerUserID, Round: offers[i].Round, At: now})
+	}
+
+	providers, firstRadius, maxRadius := emergencyDispatchSettings()
+	round, radius := dispatch.Round, dispatch.RadiusKm
+	var picked []dispatchCandidate
+	for {
+		if round == 0 {
+			radius = firstRadius
+		} else {
+			if radius >= maxRadius {
+				break
+			}
+			radius = math.Min(radius*2, maxRadius)
+			events = append(events, models.EmergencyDispatchEvent{Type: "widened", Round: round + 1, RadiusKm: radius, At: now})
+		}
+		round++
+		var err error
+		if picked, err = s.candidates(ctx, dispatch, radius, offered, providers); err != nil {
+			return err
+		}
+		if len(picked) > 0 {
+			break
+		}
+	}
+
+	status := models.DispatchStatusSearching
+	expiresAt := now.Add(EmergencyOfferTimeout())
+	for _, candidate := range picked {
+		offers = append(offers, models.EmergencyDispatchOffer{
+			ProviderUserID:    candidate.userID,
+			ServiceProviderID: candidate.serviceProviderID,
+			ProviderName:      candidate.name,
+			DistanceKm:        candidate.distanceKm,
+			Round:             round,
+			Status:            models.OfferStatusOffered,
+			OfferedAt:         now,
+			ExpiresAt:         expiresAt,
+		})
+		providerUserID := candidate.userID
+		events = append(events, models.EmergencyDispatchEvent{
+			Type: "offered", ProviderUserID: &providerUserID, Round: round, RadiusKm: radius,
+			Note: fmt.Sprintf("%.1f km away", candidate.distanceKm), At: now,
+		})
+	}
+	if len(picked) == 0 {
+		status = models.DispatchStatusExhausted
+		events = append(events, models.EmergencyDispatchEvent{Type: "exhausted", Round: round, RadiusKm: radius, Note: "no available provider accepted", At: now})
+	}
+
+	res, err := s.DB.Collection("emergencyDispatches").UpdateOne(ctx, bson.M{
+		"_id":    dispatch.ID,
+		"status": models.DispatchStatusSearching,
+		"round":  dispatch.Round,
+	}, bson.M{
+		"$set": bson.M{
+			"status":    status,
+			"round":     round,
+			"radiusKm":  radius,
+			"offers":    offers,
+			"updatedAt": now,
+		},
+		"$push": bson.M{"events": bson.M{"$each": events}},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return nil
+	}
+	dispatch.Status, dispatch.Round, dispatch.RadiusKm, dispatch.Offers = status, round, radius, offers
+
+	var booking models.Booking
+	if err := s.DB.Collection("bookings").FindOne(ctx, bson.M{"_id": dispatch.BookingID}).Decode(&booking); err != nil {
+		return err
+	}
+	if status == models.DispatchStatusExhausted {
+		return s.exhaust(ctx, dispatch, &booking, now)
+	}
+	for _, offer := range offers[len(offers)-len(picked):] {
+		s.sendOffer(dispatch, &booking, offer)
+	}
+	return nil
+}
+
+// exhaust cancels the booking of a dispatch no provider accepted and lets the user know
+func (s *EmergencyDispatchService) exhaust(ctx context.Context, dispatch *models.EmergencyDispatch, booking *models.Booking, now time.Time) error {
+	res, err := s.DB.Collection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID, "status": "pending"}, bson.M{"$set": bson.M{
+		"status":      "cancelled",
+		"cancelledBy": models.BookingPartySystem,
+		"updatedAt":   now,
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// The user cancelled the booking first; there is nobody left to tell
+		return nil
+	}
+	booking.Status = "cancelled"
+	booking.CancelledBy = models.BookingPartySystem
+	s.notify(dispatch.UserID, "emergency_dispatch_exhausted", "No Provider Available",
+		fmt.Sprintf("No %s is available near you right now. Please try again shortly.", dispatch.ServiceType),
+		booking, map[string]interface{}{"bookingId": booking.ID.Hex(), "dispatchId": dispatch.ID.Hex()}, true)
+	return nil
+}
+
+// offerPayload is what a provider sees of an emergency offer; the user's phone number is shared once they accept
+func offerPayload(dispatch *models.EmergencyDispatch, booking *models.Booking, offer models.EmergencyDispatchOffer) map[string]interface{} {
+	return map[string]interface{}{
+		"dispatchId":    dispatch.ID.Hex(),
+		"bookingId":     booking.ID.Hex(),
+		"serviceType":   dispatch.ServiceType,
+		"details":       booking.Details,
+		"mediaUrls":     booking.MediaURLs,
+		"thumbnailUrls": booking.ThumbnailURLs,
+		"lat":           dispatch.Lat,
+		"lng":           dispatch.Lng,
+		"distanceKm":    offer.DistanceKm,
+		"expiresAt":     offer.ExpiresAt,
+	}
+}
+
+// sendOffer offers an emergency booking to a provider in real time and by push notification
+func (s *EmergencyDispatchService) sendOffer(dispatch *models.EmergencyDispatch, booking *models.Booking, offer models.EmergencyDispatchOffer) {
+	s.notify(offer.ProviderUserID, "emergency_offer", "Emergency Request Nearby",
+		fmt.Sprintf("Emergency %s request %.1f km away. Accept within %d seconds.", dispatch.ServiceType, offer.DistanceKm, int(EmergencyOfferTimeout().Seconds())),
+		offerPayload(dispatch, booking, offer), map[string]interface{}{
+			"dispatchId": dispatch.ID.Hex(),
+			"bookingId":  booking.ID.Hex(),
+			"expiresAt":  offer.ExpiresAt.Format(time.RFC3339),
+		}, true)
+}
+
+// withdraw tells providers whose offer was withdrawn; the offer disappears from their screen, nothing is saved
+func (s *EmergencyDispatchService) withdraw(dispatch *models.EmergencyDispatch, offers []models.EmergencyDispatchOffer, reason string) {
+	for _, offer := range offers {
+		s.notify(offer.ProviderUserID, "emergency_offer_withdrawn", "Emergency Request Closed", reason,
+			map[string]interface{}{"dispatchId": dispatch.ID.Hex(), "bookingId": dispatch.BookingID.Hex()},
+			map[string]interface{}{"dispatchId": dispatch.ID.Hex(), "bookingId": dispatch.BookingID.Hex()}, false)
+	}
+}
+
+// notify sends a message over the websocket hub and as a push notification, and saves it in-app when save is set
+func (s *EmergencyDispatchService) notify(userID primitive.ObjectID, notifType, title, message string, payload interface{}, data map[string]interface{}, save bool) {
+	if s.Hub != nil {
+		if err := s.Hub.SendToUser(userID, websocket.Notification{Type: notifType, Message: message, Data: payload}); err != nil {
+			log.Printf("Failed to send WebSocket %s notification to %s: %v", notifType, userID.Hex(), err)
+		}
+	}
+	data["type"] = notifType
+	client := s.DB.Client()
+	if err := utils.SendFCMNotificationToUser(client, userID, title, message, data); err != nil {
+		log.Printf("Failed to send FCM %s notification to %s: %v", notifType, userID.Hex(), err)
+	}
+	if save {
+		if err := utils.SaveNotification(client, userID, title, message, notifType, data); err != nil {
+			log.Printf("Failed to save %s notification for %s: %v", notifType, userID.Hex(), err)
+		}
+	}
+}
+
+// openOffer returns the provider's offer of a dispatch that is still waiting for an answer
+func openOffer(dispatch *models.EmergencyDispatch, providerUserID primitive.ObjectID, now time.Time) *models.EmergencyDispatchOffer {
+	for i := range dispatch.Offers {
+		offer := &dispatch.Offers[i]
+		if offer.ProviderUserID == providerUserID && offer.Status == models.OfferStatusOffered && offer.ExpiresAt.After(now) {
+			return offer
+		}
+	}
+	return nil
+}
+
+// Respond accepts or declines a provider's open offer. The first provider to accept is assigned the booking and
+// the offer is withdrawn from everyone else; a decline that leaves no offer open starts the next round at once.
+func (s *EmergencyDispatchService) Respond(ctx context.Context, dispatchID, providerUserID primitive.ObjectID, accept bool) (*models.EmergencyDispatch, *models.Booking, error) {
+	dispatch, err := s.load(ctx, bson.M{"_id": dispatchID})
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	offer := openOffer(dispatch, providerUserID, now)
+	if offer == nil {
+		if dispatch.Status == models.DispatchStatusAssigned {
+			return nil, nil, ErrDispatchTaken
+		}
+		return nil, nil, ErrDispatchOfferMissing
+	}
+
+	status, event := models.OfferStatusDeclined, "declined"
+	set := bson.M{"updatedAt": now}
+	if accept {
+		status, event = models.OfferStatusAccepted, "accepted"
+		set["status"] = models.DispatchStatusAssigned
+		set["assignedProviderId"] = offer.ServiceProviderID
+	}
+	set["offers.$.status"] = status
+	set["offers.$.respondedAt"] = now
+	res, err := s.DB.Collection("emergencyDispatches").UpdateOne(ctx, bson.M{
+		"_id":    dispatch.ID,
+		"status": models.DispatchStatusSearching,
+		"offers": bson.M{"$elemMatch": bson.M{
+			"providerUserId": providerUserID,
+			"status":         models.OfferStatusOffered,
+			"expiresAt":      bson.M{"$gt": now},
+		}},
+	}, bson.M{
+		"$set":  set,
+		"$push": bson.M{"events": models.EmergencyDispatchEvent{Type: event, ProviderUserID: &providerUserID, Round: offer.Round, At: now}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.MatchedCount == 0 {
+		if current, err := s.load(ctx, bson.M{"_id": dispatch.ID}); err == nil && current.Status == models.DispatchStatusAssigned {
+			return nil, nil, ErrDispatchTaken
+		}
+		return nil, nil, ErrDispatchOfferMissing
+	}
+
+	if !accept {
+		dispatch, err = s.load(ctx, bson.M{"_id": dispatch.ID})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.advance(ctx, dispatch, now); err != nil {
+			return nil, nil, err
+		}
+		return dispatch, nil, nil
+	}
+
+	// The provider won: hand them the booking, unless the user cancelled it meanwhile, and close the other open offers
+	var others []models.EmergencyDispatchOffer
+	for _, other := range dispatch.Offers {
+		if other.Status == models.OfferStatusOffered && other.ProviderUserID != providerUserID {
+			others = append(others, other)
+		}
+	}
+	res, err = s.DB.Collection("bookings").UpdateOne(ctx, bson.M{"_id": dispatch.BookingID, "status": "pending"}, bson.M{"$set": bson.M{
+		"serviceProviderId": offer.ServiceProviderID,
+		"status":            "accepted",
+		"updatedAt":         now,
+	}})
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.MatchedCount == 0 {
+		s.endCancelled(ctx, dispatch, others, now)
+		return nil, nil, ErrDispatchCancelled
+	}
+
+	if len(others) > 0 {
+		var withdrawn []models.EmergencyDispatchEvent
+		for _, other := range others {
+			otherID := other.ProviderUserID
+			withdrawn = append(withdrawn, models.EmergencyDispatchEvent{Type: "withdrawn", ProviderUserID: &otherID, Round: other.Round, Note: "another provider accepted", At: now})
+		}
+		_, err := s.DB.Collection("emergencyDispatches").UpdateOne(ctx, bson.M{"_id": dispatch.ID}, bson.M{
+			"$set":  bson.M{"offers.$[open].status": models.OfferStatusWithdrawn},
+			"$push": bson.M{"events": bson.M{"$each": withdrawn}},
+		}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"open.status": models.OfferStatusOffered}}}))
+		if err != nil {
+			log.Printf("Failed to withdraw the open offers of emergency dispatch %s: %v", dispatch.ID.Hex(), err)
+		}
+		s.withdraw(dispatch, others, "Another provider accepted this emergency request.")
+	}
+
+	var booking models.Booking
+	if err := s.DB.Collection("bookings").FindOne(ctx, bson.M{"_id": dispatch.BookingID}).Decode(&booking); err != nil {
+		return nil, nil, err
+	}
+	dispatch, err = s.load(ctx, bson.M{"_id": dispatch.ID})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.notify(dispatch.UserID, "emergency_dispatch_assigned", "Provider On The Way",
+		fmt.Sprintf("%s accepted your emergency request.", offer.ProviderName), &booking,
+		map[string]interface{}{"bookingId": booking.ID.Hex(), "dispatchId": dispatch.ID.Hex()}, true)
+	return dispatch, &booking, nil
+}
+
+// endCancelled ends a dispatch that was assigned to a provider whose acceptance lost the race with the user
+// cancelling its booking, withdrawing the offers still open
+func (s *EmergencyDispatchService) endCancelled(ctx context.Context, dispatch *models.EmergencyDispatch, open []models.EmergencyDispatchOffer, now time.Time) {
+	events := []models.EmergencyDispatchEvent{{Type: "cancelled", Round: dispatch.Round, Note: "the user cancelled the booking before the acceptance went through", At: now}}
+	for _, offer := range open {
+		providerUserID := offer.ProviderUserID
+		events = append(events, models.EmergencyDispatchEvent{Type: "withdrawn", ProviderUserID: &providerUserID, Round: offer.Round, Note: "the user cancelled", At: now})
+	}
+	_, err := s.DB.Collection("emergencyDispatches").UpdateOne(ctx, bson.M{"_id": dispatch.ID, "status": models.DispatchStatusAssigned}, bson.M{
+		"$set":   bson.M{"status": models.DispatchStatusCancelled, "offers.$[open].status": models.OfferStatusWithdrawn, "updatedAt": now},
+		"$unset": bson.M{"assignedProviderId": ""},
+		"$push":  bson.M{"events": bson.M{"$each": events}},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"open.status": models.OfferStatusOffered}}}))
+	if err != nil {
+		log.Printf("Failed to end cancelled emergency dispatch %s: %v", dispatch.ID.Hex(), err)
+	}
+	s.withdraw(dispatch, open, "The customer cancelled this emergency request.")
+}
+
+// Cancel ends the search of an emergency booking the user cancelled, withdrawing its open offers
+func (s *EmergencyDispatchService) Cancel(ctx context.Context, bookingID primitive.ObjectID) error {
+	dispatch, err := s.load(ctx, bson.M{"bookingId": bookingID, "status": models.DispatchStatusSearching})
+	if err == ErrDispatchNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var open []models.EmergencyDispatchOffer
+	events := []models.EmergencyDispatchEvent{{Type: "cancelled", Round: dispatch.Round, Note: "the user cancelled the booking", At: now}}
+	for _, offer := range dispatch.Offers {
+		if offer.Status == models.OfferStatusOffered {
+			open = append(open, offer)
+			providerUserID := offer.ProviderUserID
+			events = append(events, models.EmergencyDispatchEvent{Type: "withdrawn", ProviderUserID: &providerUserID, Round: offer.Round, Note: "the user cancelled", At: now})
+		}
+	}
+	res, err := s.DB.Collection("emergencyDispatches").UpdateOne(ctx, bson.M{"_id": dispatch.ID, "status": models.DispatchStatusSearching}, bson.M{
+		"$set":  bson.M{"status": models.DispatchStatusCancelled, "offers.$[open].status": models.OfferStatusWithdrawn, "updatedAt": now},
+		"$push": bson.M{"events": bson.M{"$each": events}},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"open.status": models.OfferStatusOffered}}}))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		s.withdraw(dispatch, open, "The customer cancelled this emergency request.")
+	}
+	return nil
+}
+
+// OpenOffers lists the emergency offers a provider can still accept, for clients that reconnect
+func (s *EmergencyDispatchService) OpenOffers(ctx context.Context, providerUserID primitive.ObjectID) ([]map[string]interface{}, error) {
+	now := time.Now()
+	cursor, err := s.DB.Collection("emergencyDispatches").Find(ctx, bson.M{
+		"status": models.DispatchStatusSearching,
+		"offers": bson.M{"$elemMatch": bson.M{
+			"providerUserId": providerUserID,
+			"status":         models.OfferStatusOffered,
+			"expiresAt":      bson.M{"$gt": now},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var dispatches []models.EmergencyDispatch
+	if err := cursor.All(ctx, &dispatches); err != nil {
+		return nil, err
+	}
+
+	offers := []map[string]interface{}{}
+	for i := range dispatches {
+		offer := openOffer(&dispatches[i], providerUserID, now)
+		if offer == nil {
+			continue
+		}
+		var booking models.Booking
+		if err := s.DB.Collection("bookings").FindOne(ctx, bson.M{"_id": dispatches[i].BookingID}).Decode(&booking); err != nil {
+			log.Printf("Failed to load booking of emergency dispatch %s: %v", dispatches[i].ID.Hex(), err)
+			continue
+		}
+		offers = append(offers, offerPayload(&dispatches[i], &booking, *offer))
+	}
+	return offers, nil
+}
+
+// List returns the most recent dispatches, optionally of one status, for the admin audit view
+func (s *EmergencyDispatchService) List(ctx context.Context, status string, page, limit int) ([]models.EmergencyDispatch, int64, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	total, err := s.DB.Collection("emergencyDispatches").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := s.DB.Collection("emergencyDispatches").Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	dispatches := []models.EmergencyDispatch{}
+	if err := cursor.All(ctx, &dispatches); err != nil {
+		return nil, 0, err
+	}
+	return dispatches, total, nil
+}
+
+// Run moves on the dispatches whose offers all expired or were declined, under a job lock
+func (s *EmergencyDispatchService) Run() {
+	utils.RunWithJobLock(emergencyDispatchLockKey, time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		cursor, err := s.DB.Collection("emergencyDispatches").Find(ctx, bson.M{
+			"status": models.DispatchStatusSearching,
+			"offers": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+				"status":    models.OfferStatusOffered,
+				"expiresAt": bson.M{"$gt": now},
+			}}},
+		})
+		if err != nil {
+			log.Printf("Failed to find emergency dispatches to advance: %v", err)
+			return
+		}
+		var dispatches []models.EmergencyDispatch
+		if err := cursor.All(ctx, &dispatches); err != nil {
+			log.Printf("Failed to decode emergency dispatches: %v", err)
+			return
+		}
+		for i := range dispatches {
+			if err := s.advance(ctx, &dispatches[i], now); err != nil {
+				log.Printf("Failed to advance emergency dispatch %s: %v", dispatches[i].ID.Hex(), err)
+			}
+		}
+	})
+}
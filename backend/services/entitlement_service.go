@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EntitlementService resolves what an account's subscription plans allow it to do
+type EntitlementService struct {
+	DB *mongo.Database
+}
+
+// NewEntitlementService creates a new entitlement service
+func NewEntitlementService(db *mongo.Database) *EntitlementService {
+	return &EntitlementService{DB: db}
+}
+
+// ForEntities merges the entitlements of the active subscriptions of the given branches or service providers.
+// Entities without an active subscription only get the free tier.
+func (s *EntitlementService) ForEntities(ctx context.Context, kind string, entityIDs []primitive.ObjectID) (models.Entitlements, error) {
+	entitlements := models.FreeEntitlements()
+	cfg, ok := subscriptionKinds[kind]
+	if !ok {
+		return entitlements, ErrInvalidSubscriptionKind
+	}
+	if len(entityIDs) == 0 {
+		return entitlements, nil
+	}
+
+	planIDs, err := s.DB.Collection(cfg.SubscriptionCollection).Distinct(ctx, "planId", bson.M{
+		cfg.EntityField: bson.M{"$in": entityIDs},
+		"status":        models.SubscriptionStatusActive,
+		"endDate":       bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return entitlements, err
+	}
+	if len(planIDs) == 0 {
+		return entitlements, nil
+	}
+
+	cursor, err := s.DB.Collection("subscription_plans").Find(ctx, bson.M{"_id": bson.M{"$in": planIDs}})
+	if err != nil {
+		return entitlements, err
+	}
+	var plans []models.SubscriptionPlan
+	if err := cursor.All(ctx, &plans); err != nil {
+		return entitlements, err
+	}
+	for _, plan := range plans {
+		if plan.Entitlements == nil {
+			entitlements = entitlements.Merge(models.UnlimitedEntitlements())
+			continue
+		}
+		entitlements = entitlements.Merge(*plan.Entitlements)
+	}
+	return entitlements, nil
+}
+
+// ForCompany returns the entitlements of a company across the subscriptions of all its branches
+func (s *EntitlementService) ForCompany(ctx context.Context, company *models.Company) (models.Entitlements, error) {
+	branchIDs := make([]primitive.ObjectID, 0, len(company.Branches))
+	for _, branch := range company.Branches {
+		branchIDs = append(branchIDs, branch.ID)
+	}
+	return s.ForEntities(ctx, SubscriptionKindCompanyBranch, branchIDs)
+}
+
+// ForWholesaler returns the entitlements of a wholesaler across the subscriptions of all its branches
+func (s *EntitlementService) ForWholesaler(ctx context.Context, wholesaler *models.Wholesaler) (models.Entitlements, error) {
+	branchIDs := make([]primitive.ObjectID, 0, len(wholesaler.Branches))
+	for _, branch := range wholesaler.Branches {
+		branchIDs = append(branchIDs, branch.ID)
+	}
+	return s.ForEntities(ctx, SubscriptionKindWholesalerBranch, branchIDs)
+}
+
+// ForServiceProvider returns the entitlements of a service provider's subscription
+func (s *EntitlementService) ForServiceProvider(ctx context.Context, serviceProviderID primitive.ObjectID) (models.Entitlements, error) {
+	return s.ForEntities(ctx, SubscriptionKindServiceProvider, []primitive.ObjectID{serviceProviderID})
+}
+
+// RequireEntitlement returns an *models.EntitlementError when count items of a feature exceed the entitlements.
+// Pass a count of 1 for features that are either included or not.
+func RequireEntitlement(entitlements models.Entitlements, feature string, count int) error {
+	if entitlements.Allows(feature, count) {
+		return nil
+	}
+	return &models.EntitlementError{Feature: feature, Limit: entitlements.Limit(feature)}
+}
+
+// RequireBranchMedia checks the images and videos uploaded for a branch against the entitlements
+func RequireBranchMedia(entitlements models.Entitlements, images, videos int) error {
+	if err := RequireEntitlement(entitlements, models.EntitlementImagesPerBranch, images); err != nil {
+		return err
+	}
+	return RequireEntitlement(entitlements, models.EntitlementVideosPerBranch, videos)
+}
+
+// RequireSponsoredPlacement checks that the subscription of a branch or service provider includes sponsorships
+func (s *EntitlementService) RequireSponsoredPlacement(ctx context.Context, kind string, entityID primitive.ObjectID) error {
+	entitlements, err := s.ForEntities(ctx, kind, []primitive.ObjectID{entityID})
+	if err != nil {
+		return err
+	}
+	return RequireEntitlement(entitlements, models.EntitlementSponsoredPlacement, 1)
+}
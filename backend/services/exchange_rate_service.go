@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultExchangeRate is the LBP per USD rate used until an admin sets one and EXCHANGE_RATE_USD_LBP is not set
+const defaultExchangeRate = 89500
+
+// ErrInvalidExchangeRate is returned when a rate is not a positive number of LBP per USD
+var ErrInvalidExchangeRate = errors.New("exchange rate must be a positive number of LBP per USD")
+
+// ExchangeRateService stores the USD to LBP exchange rate used to price plans and sponsorships set in LBP,
+// to show prices in both currencies, and to convert the amounts booked for each payment
+type ExchangeRateService struct {
+	DB *mongo.Database
+}
+
+// NewExchangeRateService creates a new exchange rate service
+func NewExchangeRateService(db *mongo.Database) *ExchangeRateService {
+	return &ExchangeRateService{DB: db}
+}
+
+// envExchangeRate returns EXCHANGE_RATE_USD_LBP, or the built-in default when it is unset or invalid
+func envExchangeRate() float64 {
+	if value := os.Getenv("EXCHANGE_RATE_USD_LBP"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate > 0 {
+			return rate
+		}
+		log.Printf("WARNING: invalid EXCHANGE_RATE_USD_LBP %q, using %d", value, defaultExchangeRate)
+	}
+	return defaultExchangeRate
+}
+
+// Current returns the stored rate, or the default rate when none was set yet
+func (s *ExchangeRateService) Current(ctx context.Context) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := s.DB.Collection("exchange_rates").FindOne(ctx, bson.M{"_id": models.ExchangeRateUSDLBP}).Decode(&rate)
+	if err == mongo.ErrNoDocuments || (err == nil && rate.Rate <= 0) {
+		return models.ExchangeRate{
+			ID:     models.ExchangeRateUSDLBP,
+			Rate:   envExchangeRate(),
+			Source: models.ExchangeRateSourceDefault,
+		}, nil
+	}
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+	return rate, nil
+}
+
+// SetRate stores a new rate; payment requests made before keep the rate they locked
+func (s *ExchangeRateService) SetRate(ctx context.Context, rate float64, source string, updatedBy primitive.ObjectID) (models.ExchangeRate, error) {
+	if rate <= 0 {
+		return models.ExchangeRate{}, ErrInvalidExchangeRate
+	}
+
+	stored := models.ExchangeRate{
+		ID:        models.ExchangeRateUSDLBP,
+		Rate:      rate,
+		Source:    source,
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now(),
+	}
+	_, err := s.DB.Collection("exchange_rates").ReplaceOne(ctx,
+		bson.M{"_id": models.ExchangeRateUSDLBP},
+		stored,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("failed to store exchange rate: %w", err)
+	}
+
+	log.Printf("Exchange rate set to %.2f LBP per USD (%s)", rate, source)
+	return stored, nil
+}
+
+// RefreshFromGateway asks the payment gateway for the LBP value of one US dollar and stores it
+func (s *ExchangeRateService) RefreshFromGateway(ctx context.Context, updatedBy primitive.ObjectID) (models.ExchangeRate, error) {
+	gateway := NewPaymentGateway()
+	rate, err := gateway.GetRate(1, models.CurrencyLBP)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("failed to get rate from %s: %w", gateway.Name(), err)
+	}
+	source := models.ExchangeRateSourceWhish
+	if gateway.Name() != PaymentGatewayWhish {
+		source = gateway.Name()
+	}
+	return s.SetRate(ctx, rate, source, updatedBy)
+}
+
+// Lock converts a price at the current rate. Payment requests store the result so that the amount
+// charged, and everything booked once it is paid, uses the rate of the moment the payment was requested.
+func (s *ExchangeRateService) Lock(ctx context.Context, price float64, currency string) (models.CurrencyConversion, error) {
+	rate, err := s.Current(ctx)
+	if err != nil {
+		return models.CurrencyConversion{}, err
+	}
+	return rate.Convert(price, currency), nil
+}
+
+type lockedRateKey struct{}
+
+// WithLockedRate returns a context whose wallet, commission and invoice records are converted at the rate
+// locked by a payment request. Requests made before currencies were introduced carry no rate and leave ctx unchanged.
+func WithLockedRate(ctx context.Context, conversion models.CurrencyConversion) context.Context {
+	if conversion.ExchangeRate <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, lockedRateKey{}, conversion)
+}
+
+// ConversionFor converts a USD amount booked for a payment, at the rate locked in ctx or else the current rate
+func (s *ExchangeRateService) ConversionFor(ctx context.Context, amountUSD float64) models.CurrencyConversion {
+	if locked, ok := ctx.Value(lockedRateKey{}).(models.CurrencyConversion); ok {
+		return locked.Share(amountUSD)
+	}
+	rate, err := s.Current(ctx)
+	if err != nil {
+		log.Printf("Failed to get exchange rate, recording %.2f USD without conversion: %v", amountUSD, err)
+		return models.CurrencyConversion{OriginalCurrency: models.CurrencyUSD, OriginalAmount: amountUSD, AmountUSD: amountUSD}
+	}
+	return rate.Convert(amountUSD, models.CurrencyUSD)
+}
+
+// DisplayPlans fills the USD and LBP prices of plans at the current rate
+func (s *ExchangeRateService) DisplayPlans(ctx context.Context, plans []models.SubscriptionPlan) {
+	rate, err := s.Current(ctx)
+	if err != nil {
+		log.Printf("Failed to get exchange rate for plan prices: %v", err)
+		return
+	}
+	for i := range plans {
+		plans[i].Prices = rate.Display(plans[i].Price, plans[i].Currency)
+	}
+}
+
+// DisplaySponsorships fills the USD and LBP prices of sponsorships at the current rate
+func (s *ExchangeRateService) DisplaySponsorships(ctx context.Context, sponsorships []models.Sponsorship) {
+	rate, err := s.Current(ctx)
+	if err != nil {
+		log.Printf("Failed to get exchange rate for sponsorship prices: %v", err)
+		return
+	}
+	for i := range sponsorships {
+		sponsorships[i].Prices = rate.Display(sponsorships[i].Price, sponsorships[i].Currency)
+	}
+}
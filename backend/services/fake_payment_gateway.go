@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+// Outcomes the fake gateway can simulate
+const (
+	FakeOutcomeSuccess = "success"
+	FakeOutcomeFailure = "failed"
+	FakeOutcomeTimeout = "timeout" // The payer never pays and no callback is sent
+)
+
+// fakePayment is a collect request held by the fake gateway
+type fakePayment struct {
+	Request    models.WhishRequest
+	Status     string
+	PayerPhone string
+	Refunded   float64
+}
+
+// FakePaymentGateway is an in-process PaymentGateway that settles every collect request on its own
+// and calls the success or failure callback like Whish does. It keeps its payments in memory.
+type FakePaymentGateway struct {
+	Outcome       string        // One of the FakeOutcome constants
+	CallbackDelay time.Duration // Time between the collect request and its callback
+	PayerPhone    string
+	Client        *http.Client
+
+	mu       sync.Mutex
+	payments map[int64]*fakePayment
+	balance  float64
+}
+
+var (
+	sharedFakeGateway     *FakePaymentGateway
+	sharedFakeGatewayOnce sync.Once
+)
+
+// NewFakePaymentGateway creates a fake gateway configured from FAKE_PAYMENT_OUTCOME
+// (success, failed or timeout, default success) and FAKE_PAYMENT_CALLBACK_DELAY_SECONDS (default 2)
+func NewFakePaymentGateway() *FakePaymentGateway {
+	outcome := strings.ToLower(os.Getenv("FAKE_PAYMENT_OUTCOME"))
+	if outcome != FakeOutcomeFailure && outcome != FakeOutcomeTimeout {
+		outcome = FakeOutcomeSuccess
+	}
+
+	return &FakePaymentGateway{
+		Outcome:       outcome,
+		CallbackDelay: envDuration("FAKE_PAYMENT_CALLBACK_DELAY_SECONDS", 2, time.Second),
+		PayerPhone:    "96100000000",
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		payments:      map[int64]*fakePayment{},
+	}
+}
+
+// SharedFakePaymentGateway returns the process-wide fake gateway, so that payments created by one
+// controller can be looked up by another
+func SharedFakePaymentGateway() *FakePaymentGateway {
+	sharedFakeGatewayOnce.Do(func() {
+		sharedFakeGateway = NewFakePaymentGateway()
+		log.Printf("WARNING: using the fake payment gateway (outcome %q), no real payment will be collected", sharedFakeGateway.Outcome)
+	})
+	return sharedFakeGateway
+}
+
+// Name identifies the fake gateway
+func (g *FakePaymentGateway) Name() string {
+	return PaymentGatewayFake
+}
+
+// PostPayment stores the collect request and schedules its callback according to Outcome
+func (g *FakePaymentGateway) PostPayment(req models.WhishRequest) (string, error) {
+	if req.ExternalID == nil || req.Amount == nil {
+		return "", fmt.Errorf("fake gateway: amount and externalId are required")
+	}
+	externalID := *req.ExternalID
+
+	g.mu.Lock()
+	g.payments[externalID] = &fakePayment{Request: req, Status: "pending"}
+	outcome := g.Outcome
+	g.mu.Unlock()
+
+	if outcome != FakeOutcomeTimeout {
+		go g.settle(externalID, outcome)
+	}
+
+	// The success redirect doubles as the collect page, since there is nothing for the payer to do
+	collectURL := req.SuccessRedirectURL
+	if collectURL == "" {
+		collectURL = fmt.Sprintf("https://fake-gateway.local/collect/%d", externalID)
+	}
+	return collectURL, nil
+}
+
+// settle completes a payment after CallbackDelay and calls the matching callback URL
+func (g *FakePaymentGateway) settle(externalID int64, outcome string) {
+	time.Sleep(g.CallbackDelay)
+
+	g.mu.Lock()
+	payment, ok := g.payments[externalID]
+	if !ok || payment.Status != "pending" {
+		g.mu.Unlock()
+		return
+	}
+	payment.Status = outcome
+	callbackURL := payment.Request.FailureCallbackURL
+	if outcome == FakeOutcomeSuccess {
+		payment.PayerPhone = g.PayerPhone
+		g.balance += *payment.Request.Amount
+		callbackURL = payment.Request.SuccessCallbackURL
+	}
+	g.mu.Unlock()
+
+	if callbackURL == "" {
+		return
+	}
+	target, err := withQueryParam(callbackURL, "externalId", strconv.FormatInt(externalID, 10))
+	if err != nil {
+		log.Printf("Fake gateway: invalid callback URL %q: %v", callbackURL, err)
+		return
+	}
+
+	resp, err := g.Client.Get(target)
+	if err != nil {
+		log.Printf("Fake gateway: callback for externalId %d failed: %v", externalID, err)
+		return
+	}
+	resp.Body.Close()
+	log.Printf("Fake gateway: %s callback for externalId %d returned %d", outcome, externalID, resp.StatusCode)
+}
+
+// GetPaymentStatus returns the collect status and the payer phone number of a payment
+func (g *FakePaymentGateway) GetPaymentStatus(currency string, externalID int64) (string, string, error) {
+	details, err := g.GetPaymentDetails(currency, externalID)
+	if err != nil {
+		return "", "", err
+	}
+	return details.CollectStatus, details.PayerPhoneNumber, nil
+}
+
+// GetPaymentDetails returns the status, payer and amount of a payment
+func (g *FakePaymentGateway) GetPaymentDetails(currency string, externalID int64) (*models.PaymentStatusData, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[externalID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: unknown externalId %d", externalID)
+	}
+
+	details := &models.PaymentStatusData{
+		CollectStatus:    payment.Status,
+		PayerPhoneNumber: payment.PayerPhone,
+		Currency:         currency,
+	}
+	if payment.Status == FakeOutcomeSuccess {
+		details.Amount = *payment.Request.Amount
+	}
+	return details, nil
+}
+
+// Refund returns part or all of a successful payment
+func (g *FakePaymentGateway) Refund(currency string, externalID int64, amount float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[externalID]
+	if !ok {
+		return fmt.Errorf("fake gateway: unknown externalId %d", externalID)
+	}
+	if payment.Status != FakeOutcomeSuccess {
+		return fmt.Errorf("fake gateway: payment %d was not collected", externalID)
+	}
+	if amount <= 0 || payment.Refunded+amount > *payment.Request.Amount+0.01 {
+		return fmt.Errorf("fake gateway: refund of %.2f exceeds the refundable amount", amount)
+	}
+
+	payment.Refunded += amount
+	g.balance -= amount
+	return nil
+}
+
+// GetBalance returns the total collected minus refunds
+func (g *FakePaymentGateway) GetBalance() (float64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.balance, nil
+}
+
+// GetRate converts US dollars at EXCHANGE_RATE_USD_LBP for LBP, and one to one otherwise
+func (g *FakePaymentGateway) GetRate(amount float64, currency string) (float64, error) {
+	if currency == models.CurrencyLBP {
+		return amount * envExchangeRate(), nil
+	}
+	return amount, nil
+}
+
+// withQueryParam adds a query parameter to rawURL
+func withQueryParam(rawURL, key, value string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
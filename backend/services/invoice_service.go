@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const invoiceCounterID = "invoices"
+
+// Errors returned by the invoice service
+var (
+	ErrInvoiceNotFound        = errors.New("invoice not found")
+	ErrInvoiceAccountNotFound = errors.New("no company, wholesaler or service provider found for this account")
+)
+
+// InvoiceService issues a sequentially numbered invoice for every confirmed payment and renders its receipt
+type InvoiceService struct {
+	DB *mongo.Database
+}
+
+// NewInvoiceService creates a new invoice service
+func NewInvoiceService(db *mongo.Database) *InvoiceService {
+	return &InvoiceService{DB: db}
+}
+
+// Issue numbers and stores an invoice. A payment is only invoiced once: issuing again for the same
+// kind and reference returns the existing invoice. Called inside the activation transaction of a
+// Whish payment, the number is only consumed if the activation commits.
+func (s *InvoiceService) Issue(ctx context.Context, invoice *models.Invoice) error {
+	err := s.DB.Collection("invoices").FindOne(ctx, bson.M{"kind": invoice.Kind, "referenceId": invoice.ReferenceID}).Decode(invoice)
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = s.DB.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": invoiceCounterID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+
+	invoice.ID = primitive.NewObjectID()
+	invoice.Sequence = counter.Seq
+	invoice.Number = fmt.Sprintf("INV-%06d", counter.Seq)
+	invoice.IssuedAt = time.Now()
+	if invoice.PaymentRef == "" {
+		invoice.PaymentRef = ledger.PaymentReference(ctx)
+	}
+	if invoice.Currency == models.InvoiceCurrencyUSD && invoice.ExchangeRate == 0 {
+		invoice.CurrencyConversion = NewExchangeRateService(s.DB).ConversionFor(ctx, invoice.Amount)
+	}
+	if _, err := s.DB.Collection("invoices").InsertOne(ctx, invoice); err != nil {
+		return fmt.Errorf("failed to store invoice: %w", err)
+	}
+	return nil
+}
+
+// IssueForSubscription invoices the payment of a subscription. Trials and requests fully covered by
+// credit or a promo code were not paid for and get no invoice.
+func (s *InvoiceService) IssueForSubscription(ctx context.Context, kind string, subscriptionID primitive.ObjectID, amount float64, externalID int64) (*models.Invoice, error) {
+	cfg, ok := subscriptionKinds[kind]
+	if !ok {
+		return nil, ErrInvalidSubscriptionKind
+	}
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	var subscription struct {
+		SubscriptionRecord `bson:",inline"`
+		BranchID           primitive.ObjectID `bson:"branchId,omitempty"`
+		ServiceProviderID  primitive.ObjectID `bson:"serviceProviderId,omitempty"`
+	}
+	if err := s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx, bson.M{"_id": subscriptionID}).Decode(&subscription); err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if subscription.Trial {
+		return nil, nil
+	}
+	entityID := subscription.BranchID
+	if kind == SubscriptionKindServiceProvider {
+		entityID = subscription.ServiceProviderID
+	}
+
+	target, err := NewSubscriptionService(s.DB).TargetForEntity(ctx, kind, entityID)
+	if err != nil {
+		return nil, err
+	}
+	var plan models.SubscriptionPlan
+	if err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscription.PlanID}).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to get plan details: %w", err)
+	}
+
+	invoice := &models.Invoice{
+		Kind:          models.InvoiceKindSubscription,
+		ReferenceID:   subscription.ID,
+		ItemID:        plan.ID,
+		Description:   fmt.Sprintf("%s - %s", cfg.InvoiceLabel, plan.Title),
+		PeriodStart:   &subscription.StartDate,
+		PeriodEnd:     &subscription.EndDate,
+		Amount:        amount,
+		Currency:      models.InvoiceCurrencyUSD,
+		PaymentMethod: subscription.PaymentMethod,
+		ExternalID:    externalID,
+	}
+	setInvoiceBuyer(invoice, target)
+	if err := s.Issue(ctx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// IssueForSponsorship invoices the payment of a sponsorship request once its sponsorship subscription is active
+func (s *InvoiceService) IssueForSponsorship(ctx context.Context, request models.SponsorshipSubscriptionRequest, sponsorship models.Sponsorship, subscription models.SponsorshipSubscription) (*models.Invoice, error) {
+	amount := request.AmountDue(sponsorship.Price)
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	// Sponsorship entity types are named after the subscription kinds
+	target, err := NewSubscriptionService(s.DB).TargetForEntity(ctx, subscription.EntityType, subscription.EntityID)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentMethod := request.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = "cash"
+		if request.ExternalID != 0 {
+			paymentMethod = "whish"
+		}
+	}
+	invoice := &models.Invoice{
+		Kind:          models.InvoiceKindSponsorship,
+		ReferenceID:   request.ID,
+		ItemID:        sponsorship.ID,
+		Description:   "Sponsorship - " + sponsorship.Title,
+		PeriodStart:   &subscription.StartDate,
+		PeriodEnd:     &subscription.EndDate,
+		Amount:        amount,
+		Currency:      models.InvoiceCurrencyUSD,
+		PaymentMethod: paymentMethod,
+		ExternalID:    request.ExternalID,
+	}
+	setInvoiceBuyer(invoice, target)
+	if err := s.Issue(ctx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// IssueForVoucher invoices a voucher bought with points by a company, wholesaler or service provider
+func (s *InvoiceService) IssueForVoucher(ctx context.Context, accountType string, accountID primitive.ObjectID, buyerName string, voucher models.Voucher, purchaseID primitive.ObjectID) (*models.Invoice, error) {
+	invoice := &models.Invoice{
+		Kind:          models.InvoiceKindVoucher,
+		ReferenceID:   purchaseID,
+		EntityType:    accountType,
+		EntityID:      accountID,
+		EntityName:    buyerName,
+		AccountType:   accountType,
+		AccountID:     accountID,
+		BuyerName:     buyerName,
+		ItemID:        voucher.ID,
+		Description:   "Voucher - " + voucher.Name,
+		Amount:        float64(voucher.Points),
+		Currency:      models.InvoiceCurrencyPoints,
+		PaymentMethod: "points",
+	}
+	if err := s.Issue(ctx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// setInvoiceBuyer copies the branch or service provider and its owning account onto the invoice
+func setInvoiceBuyer(invoice *models.Invoice, target *SubscriptionTarget) {
+	invoice.EntityType = target.Kind
+	invoice.EntityID = target.EntityID
+	invoice.EntityName = target.EntityName
+	invoice.AccountType = trialPlanTypes[target.Kind] // Plan types are named after the account types
+	invoice.AccountID = target.OwnerID
+	invoice.BuyerName = target.OwnerName
+}
+
+// AccountForUser returns the account type and the company, wholesaler or service provider ID of a business user
+func (s *InvoiceService) AccountForUser(ctx context.Context, userType string, userID primitive.ObjectID) (string, primitive.ObjectID, error) {
+	var collection string
+	switch userType {
+	case "company", "user":
+		userType, collection = "company", "companies"
+	case "wholesaler":
+		collection = "wholesalers"
+	case "serviceProvider":
+		target, err := NewSubscriptionService(s.DB).ResolveTarget(ctx, SubscriptionKindServiceProvider, userID, primitive.NilObjectID)
+		if err != nil {
+			return "", primitive.NilObjectID, ErrInvoiceAccountNotFound
+		}
+		return userType, target.OwnerID, nil
+	default:
+		return "", primitive.NilObjectID, ErrInvoiceAccountNotFound
+	}
+
+	var account struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := s.DB.Collection(collection).FindOne(ctx, bson.M{"userId": userID}).Decode(&account); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", primitive.NilObjectID, ErrInvoiceAccountNotFound
+		}
+		return "", primitive.NilObjectID, err
+	}
+	return userType, account.ID, nil
+}
+
+// Get returns an invoice by ID
+func (s *InvoiceService) Get(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := s.DB.Collection("invoices").FindOne(ctx, bson.M{"_id": id}).Decode(&invoice); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// List returns a page of the invoices matching filter, latest first, and the total count
+func (s *InvoiceService) List(ctx context.Context, filter bson.M, page, limit int64) ([]models.Invoice, int64, error) {
+	total, err := s.DB.Collection("invoices").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	if limit > 0 {
+		findOptions.SetSkip((page - 1) * limit).SetLimit(limit)
+	}
+	cursor, err := s.DB.Collection("invoices").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, 0, err
+	}
+	return invoices, total, nil
+}
+
+// ExportCSV writes the invoices matching filter in number order, one row per invoice, for accounting
+func (s *InvoiceService) ExportCSV(ctx context.Context, filter bson.M) ([]byte, error) {
+	cursor, err := s.DB.Collection("invoices").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"number", "issued_at", "kind", "description", "buyer", "account_type", "account_id", "entity_type", "entity_id", "entity_name",
+		"period_start", "period_end", "amount", "currency", "original_amount", "original_currency", "amount_lbp", "exchange_rate",
+		"payment_method", "whish_external_id", "reference_id",
+	})
+	for cursor.Next(ctx) {
+		var invoice models.Invoice
+		if err := cursor.Decode(&invoice); err != nil {
+			return nil, err
+		}
+		externalID := ""
+		if invoice.ExternalID != 0 {
+			externalID = strconv.FormatInt(invoice.ExternalID, 10)
+		}
+		w.Write([]string{
+			invoice.Number,
+			invoice.IssuedAt.UTC().Format(time.RFC3339),
+			invoice.Kind,
+			invoice.Description,
+			invoice.BuyerName,
+			invoice.AccountType,
+			invoice.AccountID.Hex(),
+			invoice.EntityType,
+			invoice.EntityID.Hex(),
+			invoice.EntityName,
+			formatInvoiceDate(invoice.PeriodStart),
+			formatInvoiceDate(invoice.PeriodEnd),
+			strconv.FormatFloat(invoice.Amount, 'f', 2, 64),
+			invoice.Currency,
+			formatInvoiceFloat(invoice.OriginalAmount, 2),
+			invoice.OriginalCurrency,
+			formatInvoiceFloat(invoice.AmountLBP, 0),
+			formatInvoiceFloat(invoice.ExchangeRate, 2),
+			invoice.PaymentMethod,
+			externalID,
+			invoice.ReferenceID.Hex(),
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// RenderPDF renders the receipt of an invoice
+func (s *InvoiceService) RenderPDF(invoice *models.Invoice) []byte {
+	doc := utils.NewPDFDocument()
+	left, right := 50.0, utils.PDFPageWidth-50
+	y := utils.PDFPageHeight - 70
+
+	doc.Text(left, y, 22, true, "Barrim")
+	doc.TextRight(right, y, 16, true, "RECEIPT")
+	y -= 22
+	doc.TextRight(right, y, 10, false, "Invoice "+invoice.Number)
+	y -= 14
+	doc.TextRight(right, y, 10, false, "Issued "+invoice.IssuedAt.Format("2006-01-02"))
+	y -= 30
+	doc.Line(left, y, right, y)
+
+	y -= 30
+	doc.Text(left, y, 11, true, "Billed to")
+	y -= 16
+	doc.Text(left, y, 10, false, invoice.BuyerName)
+	if invoice.EntityName != "" && invoice.EntityName != invoice.BuyerName {
+		y -= 14
+		doc.Text(left, y, 10, false, invoice.EntityName)
+	}
+
+	y -= 40
+	doc.Text(left, y, 10, true, "Description")
+	doc.TextRight(right, y, 10, true, "Amount")
+	y -= 8
+	doc.Line(left, y, right, y)
+	y -= 18
+	doc.Text(left, y, 10, false, invoice.Description)
+	doc.TextRight(right, y, 10, false, formatInvoiceAmount(invoice))
+	if invoice.PeriodStart != nil && invoice.PeriodEnd != nil {
+		y -= 14
+		doc.Text(left, y, 9, false, fmt.Sprintf("Period: %s to %s", formatInvoiceDate(invoice.PeriodStart), formatInvoiceDate(invoice.PeriodEnd)))
+	}
+	y -= 12
+	doc.Line(left, y, right, y)
+	y -= 18
+	doc.Text(right-200, y, 11, true, "Total paid")
+	doc.TextRight(right, y, 11, true, formatInvoiceAmount(invoice))
+	if invoice.AmountLBP > 0 {
+		y -= 14
+		doc.TextRight(right, y, 9, false, fmt.Sprintf("Equivalent to %.0f LBP at %.2f LBP/USD", invoice.AmountLBP, invoice.ExchangeRate))
+	}
+
+	y -= 40
+	doc.Text(left, y, 10, false, "Payment method: "+invoice.PaymentMethod)
+	if invoice.ExternalID != 0 {
+		y -= 14
+		doc.Text(left, y, 10, false, fmt.Sprintf("Whish reference: %d", invoice.ExternalID))
+	}
+	y -= 14
+	doc.Text(left, y, 10, false, "Reference: "+invoice.ReferenceID.Hex())
+
+	doc.Text(left, 50, 8, false, "This receipt was generated electronically and is valid without a signature.")
+	return doc.Bytes()
+}
+
+func formatInvoiceAmount(invoice *models.Invoice) string {
+	if invoice.Currency == models.InvoiceCurrencyPoints {
+		return fmt.Sprintf("%.0f points", invoice.Amount)
+	}
+	return fmt.Sprintf("%.2f %s", invoice.Amount, invoice.Currency)
+}
+
+// formatInvoiceFloat leaves unset amounts blank in exports
+func formatInvoiceFloat(value float64, precision int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', precision, 64)
+}
+
+func formatInvoiceDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
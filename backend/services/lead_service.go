@@ -0,0 +1,675 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const leadFollowUpLockKey = "barrim:jobs:lead-follow-ups"
+
+// Errors returned by the lead service
+var (
+	ErrLeadNotFound          = errors.New("lead not found")
+	ErrLeadConverted         = errors.New("the lead was already converted")
+	ErrLeadNotWon            = errors.New("only won leads can be converted")
+	ErrLeadLostReason        = errors.New("a reason is required to mark a lead as lost")
+	ErrLeadSameStage         = errors.New("the lead is already at this stage")
+	ErrLeadEntityType        = errors.New("entityType must be company, wholesaler or serviceProvider")
+	ErrLeadConversionDetails = errors.New("business name, category, phone and governorate are required to convert a lead")
+	ErrLeadFollowUpInPast    = errors.New("the follow-up must be in the future")
+	ErrLeadClosed            = errors.New("follow-ups can only be scheduled on open leads")
+	ErrLeadSignedUp          = errors.New("the business of this lead already signed up by itself")
+)
+
+// LeadService keeps the prospects salespersons work on before creating a company, wholesaler or service
+// provider, moves them through the pipeline and turns won leads into creation requests
+type LeadService struct {
+	DB *mongo.Database
+}
+
+// NewLeadService creates a new lead service
+func NewLeadService(db *mongo.Database) *LeadService {
+	return &LeadService{DB: db}
+}
+
+// LeadScope restricts lead access: a salesperson sees their own leads, a sales manager the leads of their
+// team and an admin every lead
+type LeadScope struct {
+	UserID   primitive.ObjectID
+	UserType string
+}
+
+func (scope LeadScope) filter() bson.M {
+	switch scope.UserType {
+	case "salesperson":
+		return bson.M{"salespersonId": scope.UserID}
+	case "sales_manager":
+		return bson.M{"salesManagerId": scope.UserID}
+	case "admin":
+		return bson.M{}
+	default:
+		return bson.M{"_id": primitive.NilObjectID}
+	}
+}
+
+// Create stores a new lead for a salesperson
+func (s *LeadService) Create(ctx context.Context, salespersonID primitive.ObjectID, req models.LeadRequest) (*models.Lead, error) {
+	var salesperson models.Salesperson
+	if err := s.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": salespersonID}).Decode(&salesperson); err != nil {
+		return nil, fmt.Errorf("failed to load salesperson: %w", err)
+	}
+	now := time.Now()
+	if req.NextFollowUpAt != nil && !req.NextFollowUpAt.After(now) {
+		return nil, ErrLeadFollowUpInPast
+	}
+
+	lead := &models.Lead{
+		ID:             primitive.NewObjectID(),
+		SalespersonID:  salespersonID,
+		SalesManagerID: salesperson.SalesManagerID,
+		Source:         models.LeadSourceSalesperson,
+		Stage:          models.LeadStageNew,
+		StageHistory:   []models.LeadStageChange{{To: models.LeadStageNew, By: salespersonID, At: now}},
+		NextFollowUpAt: req.NextFollowUpAt,
+		FollowUpNote:   strings.TrimSpace(req.FollowUpNote),
+		Visits:         []models.LeadVisit{},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	applyLeadDetails(lead, req)
+	if _, err := s.DB.Collection("leads").InsertOne(ctx, lead); err != nil {
+		return nil, fmt.Errorf("failed to store lead: %w", err)
+	}
+	return lead, nil
+}
+
+func applyLeadDetails(lead *models.Lead, req models.LeadRequest) {
+	lead.BusinessName = strings.TrimSpace(req.BusinessName)
+	lead.EntityType = req.EntityType
+	lead.Category = strings.TrimSpace(req.Category)
+	lead.SubCategory = strings.TrimSpace(req.SubCategory)
+	lead.ContactPerson = strings.TrimSpace(req.ContactPerson)
+	lead.Phone = strings.TrimSpace(req.Phone)
+	lead.WhatsApp = strings.TrimSpace(req.WhatsApp)
+	lead.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	lead.Address = req.Address
+	lead.Notes = strings.TrimSpace(req.Notes)
+}
+
+// Get loads a lead visible in the scope
+func (s *LeadService) Get(ctx context.Context, scope LeadScope, id primitive.ObjectID) (*models.Lead, error) {
+	filter := scope.filter()
+	filter["_id"] = id
+	var lead models.Lead
+	if err := s.DB.Collection("leads").FindOne(ctx, filter).Decode(&lead); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLeadNotFound
+		}
+		return nil, err
+	}
+	return &lead, nil
+}
+
+// List returns a page of the leads in the scope matching the filter, most recently updated first, with the
+// number of leads at each stage
+func (s *LeadService) List(ctx context.Context, scope LeadScope, filter bson.M, page, limit int64) ([]models.Lead, int64, map[string]int64, error) {
+	for key, value := range scope.filter() {
+		filter[key] = value
+	}
+	collection := s.DB.Collection("leads")
+
+	stageFilter := bson.M{}
+	for key, value := range filter {
+		if key != "stage" {
+			stageFilter[key] = value
+		}
+	}
+	cursor, err := collection.Aggregate(ctx, []bson.M{
+		{"$match": stageFilter},
+		{"$group": bson.M{"_id": "$stage", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var counts []struct {
+		Stage string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, 0, nil, err
+	}
+	stages := map[string]int64{}
+	for _, stage := range models.LeadStages {
+		stages[stage] = 0
+	}
+	for _, count := range counts {
+		stages[count.Stage] = count.Count
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cursor, err = collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	leads := []models.Lead{}
+	if err := cursor.All(ctx, &leads); err != nil {
+		return nil, 0, nil, err
+	}
+	return leads, total, stages, nil
+}
+
+// DueFollowUps returns the open leads of a salesperson whose follow-up is due before a time, earliest first
+func (s *LeadService) DueFollowUps(ctx context.Context, salespersonID primitive.ObjectID, before time.Time) ([]models.Lead, error) {
+	cursor, err := s.DB.Collection("leads").Find(ctx, bson.M{
+		"salespersonId":  salespersonID,
+		"stage":          bson.M{"$nin": []string{models.LeadStageWon, models.LeadStageLost}},
+		"nextFollowUpAt": bson.M{"$lte": before},
+	}, options.Find().SetSort(bson.D{{Key: "nextFollowUpAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	leads := []models.Lead{}
+	if err := cursor.All(ctx, &leads); err != nil {
+		return nil, err
+	}
+	return leads, nil
+}
+
+// Update changes the details of a lead that was not converted
+func (s *LeadService) Update(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadRequest) (*models.Lead, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if lead.Conversion != nil {
+		return nil, ErrLeadConverted
+	}
+	applyLeadDetails(lead, req)
+	lead.UpdatedAt = time.Now()
+	_, err = s.DB.Collection("leads").UpdateOne(ctx, bson.M{"_id": lead.ID, "conversion": nil}, bson.M{"$set": bson.M{
+		"businessName":  lead.BusinessName,
+		"entityType":    lead.EntityType,
+		"category":      lead.Category,
+		"subCategory":   lead.SubCategory,
+		"contactPerson": lead.ContactPerson,
+		"phone":         lead.Phone,
+		"whatsapp":      lead.WhatsApp,
+		"email":         lead.Email,
+		"address":       lead.Address,
+		"notes":         lead.Notes,
+		"updatedAt":     lead.UpdatedAt,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return lead, nil
+}
+
+// MoveStage moves a lead to another pipeline stage. Converted leads stay won; a lost lead needs a reason
+// and drops its pending follow-up.
+func (s *LeadService) MoveStage(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadStageRequest) (*models.Lead, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if lead.Conversion != nil {
+		return nil, ErrLeadConverted
+	}
+	if lead.Stage == req.Stage {
+		return nil, ErrLeadSameStage
+	}
+	lostReason := strings.TrimSpace(req.LostReason)
+	if req.Stage == models.LeadStageLost && lostReason == "" {
+		return nil, ErrLeadLostReason
+	}
+
+	now := time.Now()
+	change := models.LeadStageChange{From: lead.Stage, To: req.Stage, Note: strings.TrimSpace(req.Note), By: scope.UserID, At: now}
+	set := bson.M{"stage": req.Stage, "lostReason": lostReason, "updatedAt": now}
+	update := bson.M{"$set": set, "$push": bson.M{"stageHistory": change}}
+	if req.Stage == models.LeadStageLost || req.Stage == models.LeadStageWon {
+		update["$unset"] = bson.M{"nextFollowUpAt": "", "followUpNote": "", "followUpNotifiedAt": ""}
+	}
+	result, err := s.DB.Collection("leads").UpdateOne(ctx, bson.M{"_id": lead.ID, "stage": lead.Stage, "conversion": nil}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrLeadConverted
+	}
+	return s.Get(ctx, scope, id)
+}
+
+// ScheduleFollowUp sets the next follow-up of an open lead; a reminder is sent to the salesperson when it is due
+func (s *LeadService) ScheduleFollowUp(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadFollowUpRequest) (*models.Lead, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if lead.Stage == models.LeadStageWon || lead.Stage == models.LeadStageLost {
+		return nil, ErrLeadClosed
+	}
+	now := time.Now()
+	if !req.At.After(now) {
+		return nil, ErrLeadFollowUpInPast
+	}
+	_, err = s.DB.Collection("leads").UpdateOne(ctx, bson.M{"_id": lead.ID}, bson.M{
+		"$set":   bson.M{"nextFollowUpAt": req.At, "followUpNote": strings.TrimSpace(req.Note), "updatedAt": now},
+		"$unset": bson.M{"followUpNotifiedAt": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, scope, id)
+}
+
+// LogVisit records a visit to the prospect
+func (s *LeadService) LogVisit(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadVisitRequest) (*models.Lead, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	visit := models.LeadVisit{
+		ID:        primitive.NewObjectID(),
+		VisitedAt: now,
+		Lat:       req.Lat,
+		Lng:       req.Lng,
+		Outcome:   strings.TrimSpace(req.Outcome),
+		By:        scope.UserID,
+		CreatedAt: now,
+	}
+	if req.VisitedAt != nil {
+		visit.VisitedAt = *req.VisitedAt
+	}
+	_, err = s.DB.Collection("leads").UpdateOne(ctx, bson.M{"_id": lead.ID}, bson.M{
+		"$push": bson.M{"visits": visit},
+		"$set":  bson.M{"updatedAt": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, scope, id)
+}
+
+// Reassign hands a lead to another salesperson. Sales managers can only move leads within their team.
+func (s *LeadService) Reassign(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadReassignRequest, salespersonID primitive.ObjectID) (*models.Lead, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if lead.Conversion != nil {
+		return nil, ErrLeadConverted
+	}
+	if lead.SalespersonID == salespersonID {
+		return lead, nil
+	}
+	filter := bson.M{"_id": salespersonID}
+	if scope.UserType == "sales_manager" {
+		filter["salesManagerId"] = scope.UserID
+	}
+	var salesperson models.Salesperson
+	if err := s.DB.Collection("salespersons").FindOne(ctx, filter).Decode(&salesperson); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSalespersonNotInTeam
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	reassignment := models.LeadReassignment{From: lead.SalespersonID, To: salesperson.ID, By: scope.UserID, Note: strings.TrimSpace(req.Note), At: now}
+	result, err := s.DB.Collection("leads").UpdateOne(ctx, bson.M{"_id": lead.ID, "salespersonId": lead.SalespersonID, "conversion": nil}, bson.M{
+		"$set":  bson.M{"salespersonId": salesperson.ID, "salesManagerId": salesperson.SalesManagerID, "updatedAt": now},
+		"$push": bson.M{"reassignments": reassignment},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrLeadConverted
+	}
+
+	if err := utils.SaveNotification(s.DB.Client(), salesperson.ID, "Lead Assigned",
+		fmt.Sprintf("The lead %s was assigned to you.", lead.BusinessName), "lead_assigned",
+		map[string]interface{}{"leadId": lead.ID.Hex()}); err != nil {
+		log.Printf("Failed to notify salesperson %s of lead %s: %v", salesperson.ID.Hex(), lead.ID.Hex(), err)
+	}
+	return s.Get(ctx, LeadScope{UserID: scope.UserID, UserType: "admin"}, id)
+}
+
+// Convert turns a won lead into a pending company, wholesaler or service provider request pre-filled from
+// the lead, which then goes through the usual sales manager approval. Returns the stored pending request.
+func (s *LeadService) Convert(ctx context.Context, scope LeadScope, id primitive.ObjectID, req models.LeadConvertRequest) (*models.Lead, interface{}, error) {
+	lead, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lead.Conversion != nil {
+		return nil, nil, ErrLeadConverted
+	}
+	if lead.EntityID != nil {
+		return nil, nil, ErrLeadSignedUp
+	}
+	if lead.Stage != models.LeadStageWon {
+		return nil, nil, ErrLeadNotWon
+	}
+
+	details := leadConversionDetails(lead, req)
+	switch details.EntityType {
+	case "company", "wholesaler", "serviceProvider":
+	default:
+		return nil, nil, ErrLeadEntityType
+	}
+	if details.BusinessName == "" || details.Category == "" || details.Phone == "" || details.Address.Governorate == "" {
+		return nil, nil, ErrLeadConversionDetails
+	}
+	outsideTerritory, err := NewTerritoryService(s.DB).CheckCreation(ctx, lead.SalespersonID, details.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var salesperson models.Salesperson
+	_ = s.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": lead.SalespersonID}).Decode(&salesperson)
+
+	// Claim the lead first so it cannot be converted twice
+	now := time.Now()
+	conversion := models.LeadConversion{
+		EntityType: details.EntityType,
+		RequestID:  primitive.NewObjectID(),
+		EntityID:   primitive.NewObjectID(),
+		At:         now,
+	}
+	result, err := s.DB.Collection("leads").UpdateOne(ctx,
+		bson.M{"_id": lead.ID, "stage": models.LeadStageWon, "conversion": nil},
+		bson.M{"$set": bson.M{"conversion": conversion, "updatedAt": now}},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, nil, ErrLeadConverted
+	}
+
+	request, err := s.storeCreationRequest(ctx, lead.SalespersonID, salesperson.SalesManagerID, conversion, details, string(hashedPassword), outsideTerritory)
+	if err != nil {
+		if _, undoErr := s.DB.Collection("leads").UpdateOne(context.Background(), bson.M{"_id": lead.ID}, bson.M{"$unset": bson.M{"conversion": ""}}); undoErr != nil {
+			log.Printf("Failed to release lead %s after a failed conversion: %v", lead.ID.Hex(), undoErr)
+		}
+		return nil, nil, err
+	}
+	lead.Conversion = &conversion
+	lead.UpdatedAt = now
+	return lead, request, nil
+}
+
+// leadConversionDetails fills the empty fields of a conversion request from the lead
+func leadConversionDetails(lead *models.Lead, req models.LeadConvertRequest) models.LeadConvertRequest {
+	pick := func(value, fallback string) string {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+		return fallback
+	}
+	details := models.LeadConvertRequest{
+		EntityType:    pick(req.EntityType, lead.EntityType),
+		BusinessName:  pick(req.BusinessName, lead.BusinessName),
+		Category:      pick(req.Category, lead.Category),
+		SubCategory:   pick(req.SubCategory, lead.SubCategory),
+		ContactPerson: pick(req.ContactPerson, lead.ContactPerson),
+		Phone:         pick(req.Phone, lead.Phone),
+		ContactPhone:  pick(req.ContactPhone, pick(lead.WhatsApp, lead.Phone)),
+		Email:         strings.ToLower(pick(req.Email, lead.Email)),
+		Address: models.Address{
+			Country:     pick(req.Address.Country, lead.Address.Country),
+			Governorate: pick(req.Address.Governorate, lead.Address.Governorate),
+			District:    pick(req.Address.District, lead.Address.District),
+			City:        pick(req.Address.City, lead.Address.City),
+			Lat:         lead.Address.Lat,
+			Lng:         lead.Address.Lng,
+		},
+	}
+	if req.Address.Lat != 0 || req.Address.Lng != 0 {
+		details.Address.Lat, details.Address.Lng = req.Address.Lat, req.Address.Lng
+	}
+	return details
+}
+
+// storeCreationRequest stores the pending creation request of a converted lead the same way salespersons
+// submit companies, wholesalers and service providers
+func (s *LeadService) storeCreationRequest(ctx context.Context, salespersonID, salesManagerID primitive.ObjectID, conversion models.LeadConversion, d models.LeadConvertRequest, hashedPassword string, outsideTerritory bool) (interface{}, error) {
+	now := time.Now()
+	contactInfo := models.ContactInfo{Phone: d.Phone, WhatsApp: d.ContactPhone, Address: d.Address}
+	branch := models.Branch{
+		ID:          primitive.NewObjectID(),
+		Name:        d.BusinessName,
+		Location:    d.Address,
+		Phone:       d.Phone,
+		Category:    d.Category,
+		SubCategory: d.SubCategory,
+		Images:      []string{},
+		Videos:      []string{},
+		Status:      "inactive", // Set to inactive until subscription approval
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	switch conversion.EntityType {
+	case "company":
+		referralCode, err := utils.GenerateCompanyReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate referral code: %w", err)
+		}
+		request := models.PendingCompanyRequest{
+			ID: conversion.RequestID,
+			Company: models.Company{
+				ID:              conversion.EntityID,
+				UserID:          primitive.NewObjectID(),
+				Email:           d.Email,
+				BusinessName:    d.BusinessName,
+				Category:        d.Category,
+				SubCategory:     d.SubCategory,
+				ReferralCode:    referralCode,
+				ContactPerson:   d.ContactPerson,
+				ContactInfo:     contactInfo,
+				Branches:        []models.Branch{branch},
+				CreatedBy:       salespersonID,
+				CreatedAt:       now,
+				UpdatedAt:       now,
+				CreationRequest: "pending",
+			},
+			Email:            d.Email,
+			Password:         hashedPassword,
+			SalesPersonID:    salespersonID,
+			SalesManagerID:   salesManagerID,
+			OutsideTerritory: outsideTerritory,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		if _, err := s.DB.Collection("pending_company_requests").InsertOne(ctx, request); err != nil {
+			return nil, fmt.Errorf("failed to submit company for approval: %w", err)
+		}
+		return request, nil
+
+	case "wholesaler":
+		referralCode, err := utils.GenerateWholesalerReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate referral code: %w", err)
+		}
+		request := models.PendingWholesalerRequest{
+			ID: conversion.RequestID,
+			Wholesaler: models.Wholesaler{
+				ID:              conversion.EntityID,
+				UserID:          primitive.NewObjectID(),
+				BusinessName:    d.BusinessName,
+				Category:        d.Category,
+				SubCategory:     d.SubCategory,
+				Phone:           d.Phone,
+				ReferralCode:    referralCode,
+				ContactPerson:   d.ContactPerson,
+				ContactInfo:     contactInfo,
+				Branches:        []models.Branch{branch},
+				CreatedBy:       salespersonID,
+				CreatedAt:       now,
+				UpdatedAt:       now,
+				CreationRequest: "pending",
+			},
+			Email:            d.Email,
+			Password:         hashedPassword,
+			SalesPersonID:    salespersonID,
+			SalesManagerID:   salesManagerID,
+			OutsideTerritory: outsideTerritory,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		if _, err := s.DB.Collection("pending_wholesaler_requests").InsertOne(ctx, request); err != nil {
+			return nil, fmt.Errorf("failed to submit wholesaler for approval: %w", err)
+		}
+		return request, nil
+
+	default:
+		// Service providers are stored inactive with their user account while the request is pending
+		referralCode, err := utils.GenerateServiceProviderReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate referral code: %w", err)
+		}
+		serviceProvider := models.ServiceProvider{
+			ID:              conversion.EntityID,
+			UserID:          primitive.NewObjectID(),
+			BusinessName:    d.BusinessName,
+			Category:        d.Category,
+			Email:           d.Email,
+			Phone:           d.Phone,
+			Password:        hashedPassword,
+			ContactPerson:   d.ContactPerson,
+			ContactPhone:    d.ContactPhone,
+			Country:         d.Address.Country,
+			District:        d.Address.District,
+			City:            d.Address.City,
+			Governorate:     d.Address.Governorate,
+			ContactInfo:     contactInfo,
+			ReferralCode:    referralCode,
+			CreatedBy:       salespersonID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			Status:          "inactive",
+			CreationRequest: "pending",
+		}
+		userEmail := d.Email
+		if userEmail == "" {
+			// Use phone number as email when email is not provided
+			userEmail = d.Phone + "@serviceprovider.local"
+		}
+		user := models.User{
+			ID:                serviceProvider.UserID,
+			Email:             userEmail,
+			Password:          hashedPassword,
+			FullName:          d.BusinessName,
+			UserType:          "serviceProvider",
+			Phone:             d.Phone,
+			ContactPerson:     d.ContactPerson,
+			ContactPhone:      d.ContactPhone,
+			ServiceProviderID: &serviceProvider.ID,
+			IsActive:          true,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		request := models.PendingServiceProviderRequest{
+			ID:                    conversion.RequestID,
+			ServiceProvider:       serviceProvider,
+			Email:                 d.Email,
+			Password:              hashedPassword,
+			CreationRequestStatus: "pending",
+			SalesPersonID:         salespersonID,
+			SalesManagerID:        salesManagerID,
+			OutsideTerritory:      outsideTerritory,
+			CreatedAt:             now,
+			UpdatedAt:             now,
+		}
+
+		if _, err := s.DB.Collection("serviceProviders").InsertOne(ctx, serviceProvider); err != nil {
+			return nil, fmt.Errorf("failed to create service provider: %w", err)
+		}
+		if _, err := s.DB.Collection("users").InsertOne(ctx, user); err != nil {
+			s.DB.Collection("serviceProviders").DeleteOne(context.Background(), bson.M{"_id": serviceProvider.ID})
+			return nil, fmt.Errorf("failed to create user account: %w", err)
+		}
+		if _, err := s.DB.Collection("pending_serviceProviders_requests").InsertOne(ctx, request); err != nil {
+			s.DB.Collection("serviceProviders").DeleteOne(context.Background(), bson.M{"_id": serviceProvider.ID})
+			s.DB.Collection("users").DeleteOne(context.Background(), bson.M{"_id": user.ID})
+			return nil, fmt.Errorf("failed to submit service provider for approval: %w", err)
+		}
+		return request, nil
+	}
+}
+
+// Run reminds salespersons of the lead follow-ups that are due
+func (s *LeadService) Run() {
+	ran := utils.RunWithJobLock(leadFollowUpLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		now := time.Now()
+		cursor, err := s.DB.Collection("leads").Find(ctx, bson.M{
+			"stage":              bson.M{"$nin": []string{models.LeadStageWon, models.LeadStageLost}},
+			"nextFollowUpAt":     bson.M{"$lte": now},
+			"followUpNotifiedAt": nil,
+		})
+		if err != nil {
+			log.Printf("Failed to load due lead follow-ups: %v", err)
+			return
+		}
+		var leads []models.Lead
+		if err := cursor.All(ctx, &leads); err != nil {
+			log.Printf("Failed to decode due lead follow-ups: %v", err)
+			return
+		}
+
+		for _, lead := range leads {
+			result, err := s.DB.Collection("leads").UpdateOne(ctx,
+				bson.M{"_id": lead.ID, "followUpNotifiedAt": nil},
+				bson.M{"$set": bson.M{"followUpNotifiedAt": now}},
+			)
+			if err != nil {
+				log.Printf("Failed to record follow-up reminder for lead %s: %v", lead.ID.Hex(), err)
+				continue
+			}
+			if result.ModifiedCount == 0 {
+				continue
+			}
+			message := fmt.Sprintf("Follow up with %s today.", lead.BusinessName)
+			if lead.FollowUpNote != "" {
+				message = fmt.Sprintf("Follow up with %s today: %s", lead.BusinessName, lead.FollowUpNote)
+			}
+			if err := utils.SaveNotification(s.DB.Client(), lead.SalespersonID, "Lead Follow-up", message, "lead_follow_up",
+				map[string]interface{}{"leadId": lead.ID.Hex(), "stage": lead.Stage}); err != nil {
+				log.Printf("Failed to send follow-up reminder for lead %s: %v", lead.ID.Hex(), err)
+			}
+		}
+	})
+	if !ran {
+		log.Println("Lead follow-up reminders skipped: another instance holds the lock")
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+// ErrRefundNotSupported is returned by gateways that cannot refund a payment through their API
+var ErrRefundNotSupported = errors.New("refunds are not supported by this payment gateway")
+
+// PaymentGateway is a provider that collects online payments for subscriptions and sponsorships.
+// Collect requests are identified by their externalId, and the provider reports the outcome
+// by calling the success or failure callback URL with that externalId.
+type PaymentGateway interface {
+	// Name identifies the provider, e.g. "whish"
+	Name() string
+	// PostPayment creates a collect request and returns the URL where the payer completes it
+	PostPayment(req models.WhishRequest) (string, error)
+	// GetPaymentStatus returns the collect status and the payer phone number of a payment
+	GetPaymentStatus(currency string, externalID int64) (string, string, error)
+	// GetPaymentDetails returns the status, payer and collected amount of a payment
+	GetPaymentDetails(currency string, externalID int64) (*models.PaymentStatusData, error)
+	// Refund returns part or all of a collected payment to the payer
+	Refund(currency string, externalID int64, amount float64) error
+	// GetBalance returns the balance of the merchant account
+	GetBalance() (float64, error)
+	// GetRate returns the value of amount US dollars in currency
+	GetRate(amount float64, currency string) (float64, error)
+}
+
+// Payment gateway names accepted in PAYMENT_GATEWAY
+const (
+	PaymentGatewayWhish = "whish"
+	PaymentGatewayFake  = "fake"
+)
+
+// NewPaymentGateway returns the gateway selected by PAYMENT_GATEWAY, defaulting to Whish.
+// The fake gateway never leaves the process and is meant for local runs and tests.
+func NewPaymentGateway() PaymentGateway {
+	switch name := strings.ToLower(os.Getenv("PAYMENT_GATEWAY")); name {
+	case "", PaymentGatewayWhish:
+		return NewWhishService()
+	case PaymentGatewayFake:
+		return SharedFakePaymentGateway()
+	default:
+		log.Printf("WARNING: unknown PAYMENT_GATEWAY %q, falling back to Whish", name)
+		return NewWhishService()
+	}
+}
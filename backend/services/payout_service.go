@@ -0,0 +1,899 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	payoutRunLockKey     = "barrim:jobs:payout-runs"
+	payoutCounterID      = "payout_runs"
+	defaultPayoutMinimum = 10.0 // Same as the minimum withdrawal request
+)
+
+// Errors returned by the payout service
+var (
+	ErrPayoutRunNotFound   = errors.New("payout run not found")
+	ErrPayoutRunNotDraft   = errors.New("payout run was already confirmed or cancelled")
+	ErrPayoutRunOpen       = errors.New("a payout run is already waiting for confirmation; confirm or cancel it first")
+	ErrPayoutRunEmpty      = errors.New("payout run has no payee to pay")
+	ErrPayoutRunStale      = errors.New("balances changed since the payout run was gathered; cancel it and start a new run")
+	ErrPayoutItemNotFound  = errors.New("payee not found in this payout run")
+	ErrPayoutPayeeNotFound = errors.New("salesperson or sales manager not found")
+	ErrInvalidPayoutAmount = errors.New("minimum payout amount cannot be negative")
+)
+
+// payoutRoles are the roles paid by payout runs, with the collection holding their profiles
+var payoutRoles = []struct {
+	Role       string
+	Collection string
+}{
+	{Role: "salesperson", Collection: "salespersons"},
+	{Role: "sales_manager", Collection: "sales_managers"},
+}
+
+// PayoutService pays the commission and referral balances of salespersons and sales managers in batches.
+// A run is gathered as a draft, reviewed by a finance admin and paid in one transaction when confirmed.
+type PayoutService struct {
+	DB     *mongo.Database
+	Ledger *ledger.Ledger
+	Wallet *WalletService
+}
+
+// NewPayoutService creates a new payout service
+func NewPayoutService(db *mongo.Database) *PayoutService {
+	return &PayoutService{
+		DB:     db,
+		Ledger: ledger.New(db),
+		Wallet: NewWalletService(db),
+	}
+}
+
+// PayoutMinAmount is the smallest balance paid by a run, from PAYOUT_MIN_AMOUNT
+func PayoutMinAmount() float64 {
+	if value := os.Getenv("PAYOUT_MIN_AMOUNT"); value != "" {
+		if amount, err := strconv.ParseFloat(value, 64); err == nil && amount >= 0 {
+			return amount
+		}
+		log.Printf("WARNING: invalid PAYOUT_MIN_AMOUNT %q, using %.2f", value, defaultPayoutMinimum)
+	}
+	return defaultPayoutMinimum
+}
+
+// payoutRunInterval is how often a run is gathered on schedule, from PAYOUT_RUN_INTERVAL_DAYS (0 disables it)
+func payoutRunInterval() time.Duration {
+	return envDays("PAYOUT_RUN_INTERVAL_DAYS", 30)
+}
+
+// Run gathers a scheduled payout run when the interval has passed since the last one.
+// The run stays a draft until a finance admin confirms it.
+func (s *PayoutService) Run() {
+	interval := payoutRunInterval()
+	if interval == 0 {
+		return
+	}
+
+	ran := utils.RunWithJobLock(payoutRunLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		var last models.PayoutRun
+		err := s.DB.Collection("payout_runs").FindOne(ctx,
+			bson.M{"status": bson.M{"$ne": models.PayoutRunCancelled}},
+			options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+		).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load the last payout run: %v", err)
+			return
+		}
+		if err == nil && (last.Status == models.PayoutRunDraft || time.Since(last.CreatedAt) < interval) {
+			return
+		}
+
+		run, err := s.CreateRun(ctx, models.PayoutTriggerScheduled, nil, PayoutMinAmount(), "")
+		if err != nil {
+			log.Printf("Failed to gather scheduled payout run: %v", err)
+			return
+		}
+		log.Printf("Payout run %s gathered %d payees for $%.2f, waiting for confirmation", run.Number, run.PayeeCount, run.TotalAmount)
+	})
+	if !ran {
+		log.Println("Payout run skipped: another instance holds the lock")
+	}
+}
+
+// CreateRun gathers the commission and referral balances owed up to now into a draft run.
+// Payees on hold and balances under minAmount are listed but not paid.
+func (s *PayoutService) CreateRun(ctx context.Context, trigger string, createdBy *primitive.ObjectID, minAmount float64, note string) (*models.PayoutRun, error) {
+	if minAmount < 0 {
+		return nil, ErrInvalidPayoutAmount
+	}
+	open, err := s.DB.Collection("payout_runs").CountDocuments(ctx, bson.M{"status": models.PayoutRunDraft})
+	if err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		return nil, ErrPayoutRunOpen
+	}
+
+	run := &models.PayoutRun{
+		ID:        primitive.NewObjectID(),
+		Status:    models.PayoutRunDraft,
+		Trigger:   trigger,
+		MinAmount: minAmount,
+		Cutoff:    time.Now(),
+		Items:     []models.PayoutItem{},
+		CreatedBy: createdBy,
+		Note:      note,
+	}
+
+	holds, err := s.holdsByUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := s.balances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, payee := range balances {
+		item := payee
+		item.Amount = roundCents(item.CommissionBalance + item.ReferralBalance)
+		if item.Amount <= 0 {
+			continue
+		}
+		if err := s.describePayee(ctx, &item); err != nil {
+			return nil, err
+		}
+
+		switch hold, held := holds[item.UserID]; {
+		case held:
+			item.Status = models.PayoutItemHeld
+			item.HoldReason = hold.Reason
+		case item.Amount < minAmount:
+			item.Status = models.PayoutItemBelowMinimum
+		default:
+			item.Status = models.PayoutItemIncluded
+			if err := s.gatherEntries(ctx, &item, run.Cutoff); err != nil {
+				return nil, err
+			}
+		}
+		run.Items = append(run.Items, item)
+	}
+	sort.SliceStable(run.Items, func(i, j int) bool { return run.Items[i].Amount > run.Items[j].Amount })
+	run.UpdateTotals()
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = s.DB.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": payoutCounterID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate payout run number: %w", err)
+	}
+	run.Number = fmt.Sprintf("PAY-%06d", counter.Seq)
+	run.CreatedAt = time.Now()
+
+	if _, err := s.DB.Collection("payout_runs").InsertOne(ctx, run); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrPayoutRunOpen
+		}
+		return nil, fmt.Errorf("failed to store payout run: %w", err)
+	}
+	return run, nil
+}
+
+// balances returns the commission and referral ledger balances owed to every salesperson and sales manager
+func (s *PayoutService) balances(ctx context.Context) ([]models.PayoutItem, error) {
+	items := []models.PayoutItem{}
+	index := map[string]int{}
+
+	add := func(prefix, role string, referral bool) error {
+		accounts, err := s.Ledger.Accounts(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			userID, err := primitive.ObjectIDFromHex(strings.TrimPrefix(account.ID, prefix))
+			if err != nil {
+				continue
+			}
+			key := role + ":" + userID.Hex()
+			i, ok := index[key]
+			if !ok {
+				items = append(items, models.PayoutItem{UserID: userID, UserType: role})
+				i = len(items) - 1
+				index[key] = i
+			}
+			if referral {
+				items[i].ReferralBalance = account.Balance()
+			} else {
+				items[i].CommissionBalance = account.Balance()
+			}
+		}
+		return nil
+	}
+
+	for _, payee := range payoutRoles {
+		if err := add(ledger.CommissionAccountPrefix(payee.Role), payee.Role, false); err != nil {
+			return nil, fmt.Errorf("failed to read %s commission balances: %w", payee.Role, err)
+		}
+	}
+	if err := add(ledger.ReferralAccountPrefix(), "salesperson", true); err != nil {
+		return nil, fmt.Errorf("failed to read referral balances: %w", err)
+	}
+	return items, nil
+}
+
+// describePayee fills the name and email of a payee
+func (s *PayoutService) describePayee(ctx context.Context, item *models.PayoutItem) error {
+	collection := payoutCollection(item.UserType)
+	if collection == "" {
+		return ErrPayoutPayeeNotFound
+	}
+	var profile struct {
+		FullName string `bson:"fullName"`
+		Email    string `bson:"email"`
+	}
+	err := s.DB.Collection(collection).FindOne(ctx, bson.M{"_id": item.UserID},
+		options.FindOne().SetProjection(bson.M{"fullName": 1, "email": 1}),
+	).Decode(&profile)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	item.Name = profile.FullName
+	item.Email = profile.Email
+	return nil
+}
+
+// gatherEntries lists the pending withdrawal requests and the unpaid commission entries settled by an included item.
+// Withdrawal requests are taken oldest first while they fit in the amount paid.
+func (s *PayoutService) gatherEntries(ctx context.Context, item *models.PayoutItem, cutoff time.Time) error {
+	cursor, err := s.DB.Collection("withdrawals").Find(ctx, bson.M{
+		"userId":    item.UserID,
+		"userType":  item.UserType,
+		"status":    "pending",
+		"createdAt": bson.M{"$lte": cutoff},
+	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var withdrawals []models.Withdrawal
+	if err := cursor.All(ctx, &withdrawals); err != nil {
+		return err
+	}
+	reserved := 0.0
+	for _, withdrawal := range withdrawals {
+		if reserved+withdrawal.Amount > item.Amount+0.005 {
+			break
+		}
+		reserved += withdrawal.Amount
+		item.WithdrawalIDs = append(item.WithdrawalIDs, withdrawal.ID)
+	}
+
+	earnedBy := bson.M{"$lte": cutoff}
+	switch item.UserType {
+	case "salesperson":
+		item.CommissionIDs, err = s.ids(ctx, "commissions", bson.M{"salespersonID": item.UserID, "paid": bson.M{"$ne": true}, "createdAt": earnedBy})
+		if err != nil {
+			return err
+		}
+		item.CommissionRecordIDs, err = s.ids(ctx, "commission_records", bson.M{"role": "salesperson", "salespersonId": item.UserID, "status": "pending", "createdAt": earnedBy})
+		if err != nil {
+			return err
+		}
+		item.ReferralCommissionIDs, err = s.ids(ctx, "referral_commissions", bson.M{"salespersonId": item.UserID, "status": "earned", "createdAt": earnedBy})
+	case "sales_manager":
+		item.CommissionIDs, err = s.ids(ctx, "commissions", bson.M{"salesManagerID": item.UserID, "salesManagerPaid": bson.M{"$ne": true}, "createdAt": earnedBy})
+		if err != nil {
+			return err
+		}
+		item.CommissionRecordIDs, err = s.ids(ctx, "commission_records", bson.M{"role": "sales_manager", "salesManagerId": item.UserID, "status": "pending", "createdAt": earnedBy})
+	}
+	return err
+}
+
+// ids returns the IDs of the documents of a collection matching filter
+func (s *PayoutService) ids(ctx context.Context, collection string, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := s.DB.Collection(collection).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", collection, err)
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids, nil
+}
+
+// Confirm pays every included item of a draft run in one transaction: pending withdrawal requests are approved,
+// a withdrawal is recorded for the rest of each balance, the payouts are posted to the ledger and the settled
+// commission and referral entries are marked paid. Nothing is paid if any balance changed since the run was gathered.
+func (s *PayoutService) Confirm(ctx context.Context, runID, adminID primitive.ObjectID) (*models.PayoutRun, error) {
+	var run models.PayoutRun
+
+	err := ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		if err := s.loadDraft(sessCtx, runID, &run); err != nil {
+			return err
+		}
+		if run.PayeeCount == 0 {
+			return ErrPayoutRunEmpty
+		}
+
+		now := time.Now()
+		for i := range run.Items {
+			if run.Items[i].Status != models.PayoutItemIncluded {
+				continue
+			}
+			if err := s.payItem(sessCtx, &run, &run.Items[i], adminID, now); err != nil {
+				return err
+			}
+		}
+
+		run.Status = models.PayoutRunConfirmed
+		run.ConfirmedBy = &adminID
+		run.ConfirmedAt = &now
+		_, err := s.DB.Collection("payout_runs").UpdateOne(sessCtx,
+			bson.M{"_id": run.ID, "status": models.PayoutRunDraft},
+			bson.M{"$set": bson.M{
+				"status":      run.Status,
+				"items":       run.Items,
+				"confirmedBy": adminID,
+				"confirmedAt": now,
+			}},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// sameCents reports whether two amounts round to the same cent
+func sameCents(a, b float64) bool {
+	return roundCents(a) == roundCents(b)
+}
+
+// payItem pays one payee of a run inside the confirmation transaction, failing with ErrPayoutRunStale when
+// the payee's commission or referral balance is no longer the one gathered into the run
+func (s *PayoutService) payItem(sessCtx mongo.SessionContext, run *models.PayoutRun, item *models.PayoutItem, adminID primitive.ObjectID, now time.Time) error {
+	commission, err := s.Ledger.GetAccount(sessCtx, ledger.CommissionAccount(item.UserType, item.UserID))
+	if err != nil {
+		return err
+	}
+	if !sameCents(commission.Balance(), item.CommissionBalance) {
+		return fmt.Errorf("%w (%s %s has a $%.2f commission balance, run was gathered at $%.2f)",
+			ErrPayoutRunStale, item.UserType, item.Name, commission.Balance(), item.CommissionBalance)
+	}
+	if item.UserType == "salesperson" {
+		referral, err := s.Ledger.GetAccount(sessCtx, ledger.ReferralAccount(item.UserID))
+		if err != nil {
+			return err
+		}
+		if !sameCents(referral.Balance(), item.ReferralBalance) {
+			return fmt.Errorf("%w (%s %s has a $%.2f referral balance, run was gathered at $%.2f)",
+				ErrPayoutRunStale, item.UserType, item.Name, referral.Balance(), item.ReferralBalance)
+		}
+	}
+
+	note := "Paid in payout run " + run.Number
+	paid := 0.0
+	for _, withdrawalID := range item.WithdrawalIDs {
+		var withdrawal models.Withdrawal
+		err := s.DB.Collection("withdrawals").FindOneAndUpdate(sessCtx,
+			bson.M{"_id": withdrawalID, "status": "pending"},
+			bson.M{"$set": bson.M{
+				"status":      "approved",
+				"adminId":     adminID,
+				"adminNote":   note,
+				"processedAt": now,
+				"payoutRunId": run.ID,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&withdrawal)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w (withdrawal %s was already processed)", ErrPayoutRunStale, withdrawalID.Hex())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to approve withdrawal %s: %w", withdrawalID.Hex(), err)
+		}
+		if err := s.Wallet.postWithdrawal(sessCtx, &withdrawal, now); err != nil {
+			return err
+		}
+		paid += withdrawal.Amount
+	}
+
+	if rest := roundCents(item.Amount - paid); rest > 0 {
+		withdrawal := models.Withdrawal{
+			ID:          primitive.NewObjectID(),
+			UserID:      item.UserID,
+			UserType:    item.UserType,
+			Amount:      rest,
+			Status:      "approved",
+			CreatedAt:   now,
+			ProcessedAt: &now,
+			AdminID:     &adminID,
+			AdminNote:   note,
+			PayoutRunID: &run.ID,
+		}
+		if _, err := s.DB.Collection("withdrawals").InsertOne(sessCtx, withdrawal); err != nil {
+			return fmt.Errorf("failed to record payout withdrawal: %w", err)
+		}
+		if err := s.Wallet.postWithdrawal(sessCtx, &withdrawal, now); err != nil {
+			return err
+		}
+		item.PayoutWithdrawalID = &withdrawal.ID
+	}
+
+	if len(item.CommissionIDs) > 0 {
+		set := bson.M{"paid": true, "paidAt": now}
+		if item.UserType == "sales_manager" {
+			set = bson.M{"salesManagerPaid": true, "salesManagerPaidAt": now}
+		}
+		if _, err := s.DB.Collection("commissions").UpdateMany(sessCtx, bson.M{"_id": bson.M{"$in": item.CommissionIDs}}, bson.M{"$set": set}); err != nil {
+			return fmt.Errorf("failed to mark commissions paid: %w", err)
+		}
+	}
+	if len(item.CommissionRecordIDs) > 0 {
+		_, err := s.DB.Collection("commission_records").UpdateMany(sessCtx,
+			bson.M{"_id": bson.M{"$in": item.CommissionRecordIDs}, "status": "pending"},
+			bson.M{"$set": bson.M{"status": "paid", "paidAt": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mark commission records paid: %w", err)
+		}
+	}
+	if len(item.ReferralCommissionIDs) > 0 {
+		_, err := s.DB.Collection("referral_commissions").UpdateMany(sessCtx,
+			bson.M{"_id": bson.M{"$in": item.ReferralCommissionIDs}, "status": "earned"},
+			bson.M{"$set": bson.M{"status": "paid", "paidAt": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mark referral commissions paid: %w", err)
+		}
+	}
+
+	item.Status = models.PayoutItemPaid
+	return nil
+}
+
+// Cancel closes a draft run without paying anything
+func (s *PayoutService) Cancel(ctx context.Context, runID, adminID primitive.ObjectID) (*models.PayoutRun, error) {
+	var run models.PayoutRun
+	now := time.Now()
+	err := s.DB.Collection("payout_runs").FindOneAndUpdate(ctx,
+		bson.M{"_id": runID, "status": models.PayoutRunDraft},
+		bson.M{"$set": bson.M{"status": models.PayoutRunCancelled, "cancelledBy": adminID, "cancelledAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		if _, err := s.Get(ctx, runID); err != nil {
+			return nil, err
+		}
+		return nil, ErrPayoutRunNotDraft
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// SetItemHold leaves a payee of a draft run out of the payout, or puts them back when reason is empty.
+// Putting a payee back applies the minimum of the run again.
+func (s *PayoutService) SetItemHold(ctx context.Context, runID, userID primitive.ObjectID, reason string) (*models.PayoutRun, error) {
+	var run models.PayoutRun
+	if err := s.loadDraft(ctx, runID, &run); err != nil {
+		return nil, err
+	}
+
+	var item *models.PayoutItem
+	for i := range run.Items {
+		if run.Items[i].UserID == userID {
+			item = &run.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, ErrPayoutItemNotFound
+	}
+
+	item.HoldReason = reason
+	item.WithdrawalIDs, item.CommissionIDs, item.CommissionRecordIDs, item.ReferralCommissionIDs = nil, nil, nil, nil
+	switch {
+	case reason != "":
+		item.Status = models.PayoutItemHeld
+	case item.Amount < run.MinAmount:
+		item.Status = models.PayoutItemBelowMinimum
+	default:
+		item.Status = models.PayoutItemIncluded
+		if err := s.gatherEntries(ctx, item, run.Cutoff); err != nil {
+			return nil, err
+		}
+	}
+	run.UpdateTotals()
+
+	result, err := s.DB.Collection("payout_runs").UpdateOne(ctx,
+		bson.M{"_id": run.ID, "status": models.PayoutRunDraft},
+		bson.M{"$set": bson.M{"items": run.Items, "totalAmount": run.TotalAmount, "payeeCount": run.PayeeCount}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrPayoutRunNotDraft
+	}
+	return &run, nil
+}
+
+// loadDraft loads a run that is still waiting for confirmation
+func (s *PayoutService) loadDraft(ctx context.Context, runID primitive.ObjectID, run *models.PayoutRun) error {
+	err := s.DB.Collection("payout_runs").FindOne(ctx, bson.M{"_id": runID}).Decode(run)
+	if err == mongo.ErrNoDocuments {
+		return ErrPayoutRunNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if run.Status != models.PayoutRunDraft {
+		return ErrPayoutRunNotDraft
+	}
+	return nil
+}
+
+// Get returns a payout run
+func (s *PayoutService) Get(ctx context.Context, runID primitive.ObjectID) (*models.PayoutRun, error) {
+	var run models.PayoutRun
+	err := s.DB.Collection("payout_runs").FindOne(ctx, bson.M{"_id": runID}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPayoutRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// List returns a page of payout runs, newest first, without their items
+func (s *PayoutService) List(ctx context.Context, filter bson.M, page, limit int64) ([]models.PayoutRun, int64, error) {
+	collection := s.DB.Collection("payout_runs")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip((page-1)*limit).
+		SetLimit(limit).
+		SetProjection(bson.M{"items": 0}))
+	if err != nil {
+		return nil, 0, err
+	}
+	runs := []models.PayoutRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// Hold keeps a salesperson or sales manager out of payout runs until the hold is released
+func (s *PayoutService) Hold(ctx context.Context, userType string, userID, adminID primitive.ObjectID, reason string) (*models.PayoutHold, error) {
+	collection := payoutCollection(userType)
+	if collection == "" {
+		return nil, ErrPayoutPayeeNotFound
+	}
+	count, err := s.DB.Collection(collection).CountDocuments(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrPayoutPayeeNotFound
+	}
+
+	hold := models.PayoutHold{
+		UserID:    userID,
+		UserType:  userType,
+		Reason:    reason,
+		CreatedBy: adminID,
+		CreatedAt: time.Now(),
+	}
+	_, err = s.DB.Collection("payout_holds").ReplaceOne(ctx, bson.M{"_id": userID}, hold, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payout hold: %w", err)
+	}
+	return &hold, nil
+}
+
+// ReleaseHold lets a payee be paid by the next payout runs again
+func (s *PayoutService) ReleaseHold(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := s.DB.Collection("payout_holds").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrPayoutPayeeNotFound
+	}
+	return nil
+}
+
+// Holds lists the payees on hold
+func (s *PayoutService) Holds(ctx context.Context) ([]models.PayoutHold, error) {
+	cursor, err := s.DB.Collection("payout_holds").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	holds := []models.PayoutHold{}
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (s *PayoutService) holdsByUser(ctx context.Context) (map[primitive.ObjectID]models.PayoutHold, error) {
+	holds, err := s.Holds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[primitive.ObjectID]models.PayoutHold, len(holds))
+	for _, hold := range holds {
+		byUser[hold.UserID] = hold
+	}
+	return byUser, nil
+}
+
+// ExportCSV writes the payout sheet of a run, one row per payee, for the finance team
+func (s *PayoutService) ExportCSV(run *models.PayoutRun) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"run", "status", "user_type", "user_id", "name", "email", "commission_balance", "referral_balance", "amount",
+		"item_status", "hold_reason", "withdrawal_requests", "commission_entries", "referral_entries",
+	})
+	for _, item := range run.Items {
+		w.Write([]string{
+			run.Number,
+			run.Status,
+			item.UserType,
+			item.UserID.Hex(),
+			item.Name,
+			item.Email,
+			strconv.FormatFloat(item.CommissionBalance, 'f', 2, 64),
+			strconv.FormatFloat(item.ReferralBalance, 'f', 2, 64),
+			strconv.FormatFloat(item.Amount, 'f', 2, 64),
+			item.Status,
+			item.HoldReason,
+			strconv.Itoa(len(item.WithdrawalIDs)),
+			strconv.Itoa(len(item.CommissionIDs) + len(item.CommissionRecordIDs)),
+			strconv.Itoa(len(item.ReferralCommissionIDs)),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// PayoutStatementLine is one entry settled by a payout
+type PayoutStatementLine struct {
+	Date        time.Time `json:"date"`
+	Kind        string    `json:"kind"` // "commission", "referral", "withdrawal_request"
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+}
+
+// PayoutStatement details what one payee was paid in a run
+type PayoutStatement struct {
+	RunID     primitive.ObjectID    `json:"runId"`
+	RunNumber string                `json:"runNumber"`
+	RunStatus string                `json:"runStatus"`
+	Cutoff    time.Time             `json:"cutoff"`
+	PaidAt    *time.Time            `json:"paidAt,omitempty"`
+	Item      models.PayoutItem     `json:"item"`
+	Lines     []PayoutStatementLine `json:"lines"`
+}
+
+// Statement returns the statement of one payee of a run
+func (s *PayoutService) Statement(ctx context.Context, runID, userID primitive.ObjectID) (*PayoutStatement, error) {
+	run, err := s.Get(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	var item *models.PayoutItem
+	for i := range run.Items {
+		if run.Items[i].UserID == userID {
+			item = &run.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, ErrPayoutItemNotFound
+	}
+
+	statement := &PayoutStatement{
+		RunID:     run.ID,
+		RunNumber: run.Number,
+		RunStatus: run.Status,
+		Cutoff:    run.Cutoff,
+		PaidAt:    run.ConfirmedAt,
+		Item:      *item,
+		Lines:     []PayoutStatementLine{},
+	}
+
+	if len(item.CommissionIDs) > 0 {
+		var commissions []models.Commission
+		if err := s.findByIDs(ctx, "commissions", item.CommissionIDs, &commissions); err != nil {
+			return nil, err
+		}
+		for _, commission := range commissions {
+			amount := commission.SalespersonCommission
+			if item.UserType == "sales_manager" {
+				amount = commission.SalesManagerCommission
+			}
+			statement.Lines = append(statement.Lines, PayoutStatementLine{
+				Date:        commission.CreatedAt,
+				Kind:        "commission",
+				Description: "Commission on subscription " + commission.SubscriptionID.Hex(),
+				Amount:      amount,
+			})
+		}
+	}
+	if len(item.CommissionRecordIDs) > 0 {
+		var records []models.CommissionRecord
+		if err := s.findByIDs(ctx, "commission_records", item.CommissionRecordIDs, &records); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			statement.Lines = append(statement.Lines, PayoutStatementLine{
+				Date:        record.CreatedAt,
+				Kind:        "commission",
+				Description: "Commission on subscription " + record.SubscriptionID.Hex(),
+				Amount:      record.Amount,
+			})
+		}
+	}
+	if len(item.ReferralCommissionIDs) > 0 {
+		var referrals []models.ReferralCommission
+		if err := s.findByIDs(ctx, "referral_commissions", item.ReferralCommissionIDs, &referrals); err != nil {
+			return nil, err
+		}
+		for _, referral := range referrals {
+			statement.Lines = append(statement.Lines, PayoutStatementLine{
+				Date:        referral.CreatedAt,
+				Kind:        "referral",
+				Description: "Referral reward, code " + referral.ReferralCode,
+				Amount:      referral.Amount,
+			})
+		}
+	}
+	if len(item.WithdrawalIDs) > 0 {
+		var withdrawals []models.Withdrawal
+		if err := s.findByIDs(ctx, "withdrawals", item.WithdrawalIDs, &withdrawals); err != nil {
+			return nil, err
+		}
+		for _, withdrawal := range withdrawals {
+			statement.Lines = append(statement.Lines, PayoutStatementLine{
+				Date:        withdrawal.CreatedAt,
+				Kind:        "withdrawal_request",
+				Description: "Withdrawal request settled by this payout",
+				Amount:      withdrawal.Amount,
+			})
+		}
+	}
+	sort.SliceStable(statement.Lines, func(i, j int) bool { return statement.Lines[i].Date.Before(statement.Lines[j].Date) })
+	return statement, nil
+}
+
+func (s *PayoutService) findByIDs(ctx context.Context, collection string, ids []primitive.ObjectID, results interface{}) error {
+	cursor, err := s.DB.Collection(collection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", collection, err)
+	}
+	return cursor.All(ctx, results)
+}
+
+// RenderStatementPDF renders the payout statement of one payee
+func (s *PayoutService) RenderStatementPDF(statement *PayoutStatement) []byte {
+	doc := utils.NewPDFDocument()
+	left, right := 50.0, utils.PDFPageWidth-50
+	y := utils.PDFPageHeight - 70
+	item := statement.Item
+
+	doc.Text(left, y, 22, true, "Barrim")
+	doc.TextRight(right, y, 16, true, "PAYOUT STATEMENT")
+	y -= 22
+	doc.TextRight(right, y, 10, false, "Payout run "+statement.RunNumber)
+	y -= 14
+	if statement.PaidAt != nil {
+		doc.TextRight(right, y, 10, false, "Paid "+statement.PaidAt.Format("2006-01-02"))
+	} else {
+		doc.TextRight(right, y, 10, false, "Status: "+statement.RunStatus)
+	}
+	y -= 30
+	doc.Line(left, y, right, y)
+
+	y -= 30
+	doc.Text(left, y, 11, true, "Paid to")
+	y -= 16
+	doc.Text(left, y, 10, false, item.Name)
+	y -= 14
+	doc.Text(left, y, 10, false, strings.ReplaceAll(item.UserType, "_", " "))
+	if item.Email != "" {
+		y -= 14
+		doc.Text(left, y, 10, false, item.Email)
+	}
+
+	y -= 40
+	doc.Text(left, y, 10, true, "Date")
+	doc.Text(left+80, y, 10, true, "Description")
+	doc.TextRight(right, y, 10, true, "Amount")
+	y -= 8
+	doc.Line(left, y, right, y)
+	for _, line := range statement.Lines {
+		// Keep room for the totals and the footer
+		if y < 160 {
+			y -= 18
+			doc.Text(left, y, 9, false, "More entries are listed in the payout sheet.")
+			break
+		}
+		y -= 18
+		doc.Text(left, y, 9, false, line.Date.Format("2006-01-02"))
+		doc.Text(left+80, y, 9, false, line.Description)
+		doc.TextRight(right, y, 9, false, fmt.Sprintf("%.2f USD", line.Amount))
+	}
+	y -= 12
+	doc.Line(left, y, right, y)
+
+	y -= 18
+	doc.Text(right-200, y, 10, false, "Commission balance")
+	doc.TextRight(right, y, 10, false, fmt.Sprintf("%.2f USD", item.CommissionBalance))
+	if item.ReferralBalance != 0 {
+		y -= 14
+		doc.Text(right-200, y, 10, false, "Referral balance")
+		doc.TextRight(right, y, 10, false, fmt.Sprintf("%.2f USD", item.ReferralBalance))
+	}
+	y -= 18
+	if item.Status == models.PayoutItemPaid || item.Status == models.PayoutItemIncluded {
+		doc.Text(right-200, y, 11, true, "Total paid")
+		doc.TextRight(right, y, 11, true, fmt.Sprintf("%.2f USD", item.Amount))
+	} else {
+		doc.Text(right-200, y, 11, true, "Not paid in this run")
+		doc.TextRight(right, y, 11, true, strings.ReplaceAll(item.Status, "_", " "))
+	}
+
+	doc.Text(left, 50, 8, false, "Balances cover commission earned up to "+statement.Cutoff.Format("2006-01-02 15:04")+".")
+	return doc.Bytes()
+}
+
+// payoutCollection returns the collection holding the profiles of a payee role
+func payoutCollection(userType string) string {
+	for _, payee := range payoutRoles {
+		if payee.Role == userType {
+			return payee.Collection
+		}
+	}
+	return ""
+}
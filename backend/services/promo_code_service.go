@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrPromoCodeNotFound      = errors.New("promo code not found")
+	ErrPromoCodeNotValid      = errors.New("promo code is not valid at this time")
+	ErrPromoCodeNotApplicable = errors.New("promo code does not apply to this plan")
+	ErrPromoCodeNotEligible   = errors.New("promo code is not available for this account")
+	ErrPromoCodeExhausted     = errors.New("promo code has reached its usage limit")
+	ErrPromoCodeAccountLimit  = errors.New("promo code has already been used the maximum number of times by this account")
+)
+
+// PromoAccount is the company, wholesaler or service provider redeeming a promo code
+type PromoAccount struct {
+	ID          primitive.ObjectID
+	BroughtInBy primitive.ObjectID // Salesperson that created the account, if any
+}
+
+// PromoQuote is the price of a plan after a promo code
+type PromoQuote struct {
+	PromoCodeID    primitive.ObjectID `json:"promoCodeId"`
+	Code           string             `json:"code"`
+	OriginalAmount float64            `json:"originalAmount"`
+	Discount       float64            `json:"discount"`
+	Amount         float64            `json:"amount"`
+}
+
+// PromoCodeService validates and tracks the use of promo codes on subscription requests
+type PromoCodeService struct {
+	DB *mongo.Database
+}
+
+// NewPromoCodeService creates a new promo code service
+func NewPromoCodeService(db *mongo.Database) *PromoCodeService {
+	return &PromoCodeService{DB: db}
+}
+
+// NormalizePromoCode returns the stored form of a promo code
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Quote checks that a promo code applies to the plan and account and returns the discounted price
+func (s *PromoCodeService) Quote(ctx context.Context, code string, plan models.SubscriptionPlan, account PromoAccount) (*PromoQuote, error) {
+	var promo models.PromoCode
+	err := s.DB.Collection("promo_codes").FindOne(ctx, bson.M{"code": NormalizePromoCode(code)}).Decode(&promo)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPromoCodeNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !promo.IsActive || now.Before(promo.ValidFrom) || !now.Before(promo.ValidUntil) {
+		return nil, ErrPromoCodeNotValid
+	}
+	if len(promo.PlanTypes) > 0 && !containsString(promo.PlanTypes, plan.Type) {
+		return nil, ErrPromoCodeNotApplicable
+	}
+	if len(promo.SalespersonIDs) > 0 && !containsObjectID(promo.SalespersonIDs, account.BroughtInBy) {
+		return nil, ErrPromoCodeNotEligible
+	}
+	if promo.MaxUses > 0 && promo.UsedCount >= promo.MaxUses {
+		return nil, ErrPromoCodeExhausted
+	}
+	if err := s.checkAccountLimit(ctx, promo, account.ID); err != nil {
+		return nil, err
+	}
+
+	discount := promo.Discount(plan.Price)
+	amount := plan.Price - discount
+	if amount <= 0 {
+		// Whish cannot collect a zero amount; free plans are created as plans, not as codes
+		return nil, fmt.Errorf("%w: the discount covers the whole price", ErrPromoCodeNotApplicable)
+	}
+	return &PromoQuote{
+		PromoCodeID:    promo.ID,
+		Code:           promo.Code,
+		OriginalAmount: plan.Price,
+		Discount:       discount,
+		Amount:         math.Round(amount*100) / 100,
+	}, nil
+}
+
+// Reserve counts a quoted promo code against its caps for a subscription request.
+// The use is released again if the request fails, expires or is rejected.
+func (s *PromoCodeService) Reserve(ctx context.Context, quote *PromoQuote, account PromoAccount, kind string, entityID, requestID, planID primitive.ObjectID) error {
+	var promo models.PromoCode
+	if err := s.DB.Collection("promo_codes").FindOne(ctx, bson.M{"_id": quote.PromoCodeID}).Decode(&promo); err != nil {
+		return err
+	}
+	if err := s.checkAccountLimit(ctx, promo, account.ID); err != nil {
+		return err
+	}
+
+	// Only take a use while the total cap allows it
+	result, err := s.DB.Collection("promo_codes").UpdateOne(ctx,
+		bson.M{
+			"_id": quote.PromoCodeID,
+			"$or": []bson.M{
+				{"maxUses": 0},
+				{"$expr": bson.M{"$lt": []string{"$usedCount", "$maxUses"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"usedCount": 1}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrPromoCodeExhausted
+	}
+
+	now := time.Now()
+	_, err = s.DB.Collection("promo_code_redemptions").InsertOne(ctx, models.PromoCodeRedemption{
+		ID:             primitive.NewObjectID(),
+		PromoCodeID:    quote.PromoCodeID,
+		Code:           quote.Code,
+		AccountID:      account.ID,
+		Kind:           kind,
+		EntityID:       entityID,
+		RequestID:      requestID,
+		PlanID:         planID,
+		OriginalAmount: quote.OriginalAmount,
+		Discount:       quote.Discount,
+		Amount:         quote.Amount,
+		Status:         models.PromoRedemptionReserved,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		s.DB.Collection("promo_codes").UpdateOne(ctx, bson.M{"_id": quote.PromoCodeID}, bson.M{"$inc": bson.M{"usedCount": -1}})
+		return err
+	}
+	return nil
+}
+
+// Apply quotes and reserves the promo code sent with a subscription request.
+// It returns a nil quote when no code was sent.
+func (s *PromoCodeService) Apply(ctx context.Context, code string, plan models.SubscriptionPlan, account PromoAccount, kind string, entityID, requestID primitive.ObjectID) (*PromoQuote, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, nil
+	}
+	quote, err := s.Quote(ctx, code, plan, account)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Reserve(ctx, quote, account, kind, entityID, requestID, plan.ID); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// Redeem marks the promo code use of a request as redeemed once its subscription is activated.
+// Requests without a promo code are ignored.
+func (s *PromoCodeService) Redeem(ctx context.Context, requestID primitive.ObjectID) error {
+	_, err := s.DB.Collection("promo_code_redemptions").UpdateOne(ctx,
+		bson.M{"requestId": requestID, "status": models.PromoRedemptionReserved},
+		bson.M{"$set": bson.M{"status": models.PromoRedemptionRedeemed, "updatedAt": time.Now()}},
+	)
+	return err
+}
+
+// Release gives back the promo code use of a request that failed, expired or was rejected.
+// Requests without a promo code are ignored.
+func (s *PromoCodeService) Release(ctx context.Context, requestID primitive.ObjectID) error {
+	var redemption models.PromoCodeRedemption
+	err := s.DB.Collection("promo_code_redemptions").FindOneAndUpdate(ctx,
+		bson.M{"requestId": requestID, "status": models.PromoRedemptionReserved},
+		bson.M{"$set": bson.M{"status": models.PromoRedemptionReleased, "updatedAt": time.Now()}},
+	).Decode(&redemption)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	_, err = s.DB.Collection("promo_codes").UpdateOne(ctx,
+		bson.M{"_id": redemption.PromoCodeID, "usedCount": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"usedCount": -1}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	return err
+}
+
+// checkAccountLimit returns ErrPromoCodeAccountLimit when the account has used the code as often as allowed
+func (s *PromoCodeService) checkAccountLimit(ctx context.Context, promo models.PromoCode, accountID primitive.ObjectID) error {
+	if promo.MaxUsesPerAccount <= 0 {
+		return nil
+	}
+	used, err := s.DB.Collection("promo_code_redemptions").CountDocuments(ctx, bson.M{
+		"promoCodeId": promo.ID,
+		"accountId":   accountID,
+		"status":      bson.M{"$in": []string{models.PromoRedemptionReserved, models.PromoRedemptionRedeemed}},
+	})
+	if err != nil {
+		return err
+	}
+	if int(used) >= promo.MaxUsesPerAccount {
+		return ErrPromoCodeAccountLimit
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsObjectID(values []primitive.ObjectID, value primitive.ObjectID) bool {
+	if value.IsZero() {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,477 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyRefunded is returned when a refund was already recorded for the subscription
+var ErrAlreadyRefunded = errors.New("this subscription has already been refunded")
+
+// RefundService cancels paid subscriptions, refunds their unused days and claws back the matching commissions
+type RefundService struct {
+	DB      *mongo.Database
+	Ledger  *ledger.Ledger
+	Gateway PaymentGateway
+}
+
+// NewRefundService creates a new refund service
+func NewRefundService(db *mongo.Database) *RefundService {
+	return &RefundService{
+		DB:      db,
+		Ledger:  ledger.New(db),
+		Gateway: NewPaymentGateway(),
+	}
+}
+
+// CancelAndRefund cancels the subscription and refunds the unused part of what was paid for it.
+// The refund is sent back through the payment gateway for Whish payments and recorded as a cash refund otherwise.
+// Commissions earned on the subscription are clawed back in the same proportion; a clawback larger than the
+// current balance leaves a negative balance that is netted against future commissions.
+// It returns a nil refund when nothing is left to refund.
+func (s *RefundService) CancelAndRefund(ctx context.Context, target *SubscriptionTarget, subscription *SubscriptionRecord, requestedBy primitive.ObjectID) (*models.Refund, error) {
+	cfg, ok := subscriptionKinds[target.Kind]
+	if !ok {
+		return nil, ErrInvalidSubscriptionKind
+	}
+
+	now := time.Now()
+	refund, err := s.prorate(ctx, target, subscription, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.issue(ctx, refund, requestedBy, now, func(sessCtx mongo.SessionContext) error {
+		result, err := s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(sessCtx,
+			bson.M{"_id": subscription.ID, "status": subscription.Status},
+			bson.M{"$set": bson.M{
+				"status":      models.SubscriptionStatusCancelled,
+				"autoRenew":   false,
+				"cancelledAt": now,
+				"updatedAt":   now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return ErrSubscriptionConcurrentUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := NewSubscriptionService(s.DB).setEntityStatus(ctx, target, "inactive"); err != nil {
+		log.Printf("Failed to deactivate %s %s after cancelling subscription: %v", target.Kind, target.EntityID.Hex(), err)
+	}
+	s.notify(target, refund)
+	return refund, nil
+}
+
+// RefundPlanCredit refunds the part of a subscription's unused credit that a cheaper plan does not use up.
+// apply switches the plan and runs in the same transaction as the refund.
+func (s *RefundService) RefundPlanCredit(ctx context.Context, target *SubscriptionTarget, subscription *SubscriptionRecord, amount float64, requestedBy primitive.ObjectID, apply func(sessCtx mongo.SessionContext) error) (*models.Refund, error) {
+	now := time.Now()
+	refund, err := s.prorate(ctx, target, subscription, now)
+	if err != nil {
+		return nil, err
+	}
+	if refund != nil {
+		refund.Amount = math.Min(math.Round(amount*100)/100, refund.Amount)
+		if refund.Amount <= 0 {
+			refund = nil
+		}
+	}
+
+	if err := s.issue(ctx, refund, requestedBy, now, apply); err != nil {
+		return nil, err
+	}
+	if refund != nil {
+		s.notifyClawbacks(target, refund)
+	}
+	return refund, nil
+}
+
+// issue claws back commissions, then runs update and records the refund in one transaction.
+// The refund record is unique per subscription and claims it: only after the transaction commits is the money
+// sent back through the payment gateway, so a retried or concurrent call can never refund twice.
+// A nil refund only runs update.
+func (s *RefundService) issue(ctx context.Context, refund *models.Refund, requestedBy primitive.ObjectID, now time.Time, update func(sessCtx mongo.SessionContext) error) error {
+	if refund != nil {
+		var err error
+		refund.RequestedBy = requestedBy
+		refund.Clawbacks, err = s.clawbacks(ctx, refund.SubscriptionID, refund.Amount/refund.PaidAmount)
+		if err != nil {
+			return err
+		}
+		if refund.ExternalID != 0 {
+			refund.Status = models.RefundStatusProcessing
+		}
+	}
+
+	err := ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		if err := update(sessCtx); err != nil {
+			return err
+		}
+		if refund == nil {
+			return nil
+		}
+		return s.recordRefund(sessCtx, refund, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	if refund != nil && refund.Status == models.RefundStatusProcessing {
+		s.sendRefund(ctx, refund)
+	}
+	return nil
+}
+
+// sendRefund returns a recorded refund to the payer through the payment gateway.
+// Refunds the gateway does not take are left to an admin in the manual refund queue.
+func (s *RefundService) sendRefund(ctx context.Context, refund *models.Refund) {
+	status, gatewayError := models.RefundStatusIssued, ""
+	if err := s.Gateway.Refund("USD", refund.ExternalID, refund.Amount); err != nil {
+		status, gatewayError = models.RefundStatusManual, err.Error()
+		if !errors.Is(err, ErrRefundNotSupported) {
+			log.Printf("Payment gateway refused refund %s of $%.2f for externalId %d: %v", refund.ID.Hex(), refund.Amount, refund.ExternalID, err)
+		}
+	}
+
+	set := bson.M{"status": status, "updatedAt": time.Now()}
+	if gatewayError != "" {
+		set["gatewayError"] = gatewayError
+	}
+	_, err := s.DB.Collection("refunds").UpdateOne(ctx,
+		bson.M{"_id": refund.ID, "status": models.RefundStatusProcessing},
+		bson.M{"$set": set})
+	if err != nil {
+		// The refund stays processing and is moved to the manual queue by SweepStalledRefunds
+		log.Printf("CRITICAL: refund %s was sent to the gateway (%s) but its status was not saved: %v", refund.ID.Hex(), status, err)
+	}
+	refund.Status = status
+	refund.GatewayError = gatewayError
+}
+
+// stalledRefundAfter is how long a refund may wait for the gateway before it is handed to an admin
+const stalledRefundAfter = 10 * time.Minute
+
+// SweepStalledRefunds moves the refunds whose gateway call never reported back, because the process stopped
+// in between, to the manual queue. An admin checks in the Whish portal whether the money left before paying out.
+func (s *RefundService) SweepStalledRefunds(ctx context.Context) {
+	result, err := s.DB.Collection("refunds").UpdateMany(ctx,
+		bson.M{
+			"status":    models.RefundStatusProcessing,
+			"createdAt": bson.M{"$lte": time.Now().Add(-stalledRefundAfter)},
+		},
+		bson.M{"$set": bson.M{
+			"status":       models.RefundStatusManual,
+			"gatewayError": "gateway outcome unknown: check the payment before paying out",
+			"updatedAt":    time.Now(),
+		}})
+	if err != nil {
+		log.Printf("Failed to sweep stalled refunds: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Moved %d stalled refunds to the manual queue", result.ModifiedCount)
+	}
+}
+
+// prorate computes the refund owed for the unused days of the subscription, or nil when there is none
+func (s *RefundService) prorate(ctx context.Context, target *SubscriptionTarget, subscription *SubscriptionRecord, now time.Time) (*models.Refund, error) {
+	total := subscription.EndDate.Sub(subscription.StartDate)
+	var unused time.Duration
+	switch {
+	case subscription.Status == models.SubscriptionStatusPaused:
+		unused = time.Duration(subscription.RemainingDays) * 24 * time.Hour
+	case now.Before(subscription.StartDate):
+		unused = total
+	default:
+		unused = subscription.EndDate.Sub(now)
+	}
+	if total <= 0 || unused <= 0 {
+		return nil, nil
+	}
+	if unused > total {
+		unused = total
+	}
+
+	paid, paymentRef, err := amountPaid(ctx, s.DB, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := math.Round(paid*unused.Hours()/total.Hours()*100) / 100
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	refund := &models.Refund{
+		ID:             primitive.NewObjectID(),
+		Kind:           target.Kind,
+		SubscriptionID: subscription.ID,
+		EntityID:       target.EntityID,
+		PlanID:         subscription.PlanID,
+		PaymentMethod:  subscription.PaymentMethod,
+		PaidAmount:     paid,
+		TotalDays:      int(math.Round(total.Hours() / 24)),
+		UnusedDays:     int(math.Ceil(unused.Hours() / 24)),
+		Amount:         amount,
+		Status:         models.RefundStatusManual,
+	}
+
+	if subscription.PaymentMethod == "whish" && paymentRef != "" {
+		var payment models.ProcessedPayment
+		if err := s.DB.Collection("processed_payments").FindOne(ctx, bson.M{"_id": paymentRef}).Decode(&payment); err == nil {
+			refund.ExternalID = payment.ExternalID
+		}
+	}
+	return refund, nil
+}
+
+// amountPaid returns what was paid for a subscription, including the credit carried over from a plan change,
+// and the processed payment it came from
+func amountPaid(ctx context.Context, db *mongo.Database, subscription *SubscriptionRecord) (float64, string, error) {
+	if subscription.Trial {
+		// Nothing was collected for a free trial
+		return 0, "", nil
+	}
+
+	// The postings made when the payment was applied tell how much was collected and through which payment
+	postings, err := ledger.New(db).ByReference(ctx, subscription.ID, ledger.TypeSubscriptionIncome, ledger.TypeCommission)
+	if err != nil {
+		return 0, "", err
+	}
+	var paid float64
+	var paymentRef string
+	for _, tx := range postings {
+		for _, entry := range tx.Entries {
+			if entry.Account == ledger.AccountCash {
+				paid += entry.Debit - entry.Credit
+			}
+		}
+		if paymentRef == "" {
+			paymentRef = tx.PaymentRef
+		}
+	}
+	if paid <= 0 && subscription.CarriedCredit <= 0 {
+		// Subscriptions applied before the ledger existed: fall back to the plan price
+		var plan models.SubscriptionPlan
+		if err := db.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscription.PlanID}).Decode(&plan); err != nil {
+			return 0, "", fmt.Errorf("failed to get plan details: %w", err)
+		}
+		paid = plan.Price
+	}
+	return paid + subscription.CarriedCredit, paymentRef, nil
+}
+
+// clawbacks returns the share of each commission earned on the subscription that the refund takes back
+func (s *RefundService) clawbacks(ctx context.Context, subscriptionID primitive.ObjectID, fraction float64) ([]models.CommissionClawback, error) {
+	cursor, err := s.DB.Collection("commission_records").Find(ctx, bson.M{
+		"subscriptionId": subscriptionID,
+		"status":         bson.M{"$ne": "clawback"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var records []models.CommissionRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	clawbacks := []models.CommissionClawback{}
+	for _, record := range records {
+		userID := record.SalespersonID
+		if record.Role == "sales_manager" {
+			userID = record.SalesManagerID
+		}
+		amount := math.Round(record.Amount*fraction*100) / 100
+		if amount <= 0 || userID.IsZero() {
+			continue
+		}
+
+		clawback := models.CommissionClawback{Role: record.Role, UserID: userID, Amount: amount}
+		account, err := s.Ledger.GetAccount(ctx, ledger.CommissionAccount(record.Role, userID))
+		if err != nil {
+			return nil, err
+		}
+		if available := math.Max(account.Balance(), 0); amount > available {
+			clawback.Outstanding = math.Round((amount-available)*100) / 100
+		}
+		clawbacks = append(clawbacks, clawback)
+	}
+	return clawbacks, nil
+}
+
+// recordRefund stores the refund, reverses the commissions and posts the refund to the ledger
+func (s *RefundService) recordRefund(sessCtx mongo.SessionContext, refund *models.Refund, now time.Time) error {
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+	if _, err := s.DB.Collection("refunds").InsertOne(sessCtx, refund); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyRefunded
+		}
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	entries := []ledger.Entry{ledger.Credit(ledger.AccountCash, refund.Amount)}
+	platformShare := refund.Amount
+
+	for _, clawback := range refund.Clawbacks {
+		collectionName := "salespersons"
+		record := models.CommissionRecord{
+			ID:             primitive.NewObjectID(),
+			SubscriptionID: refund.SubscriptionID,
+			Amount:         -clawback.Amount,
+			Role:           clawback.Role,
+			Status:         "clawback",
+			CreatedAt:      now,
+		}
+		if clawback.Role == "sales_manager" {
+			collectionName = "sales_managers"
+			record.SalesManagerID = clawback.UserID
+		} else {
+			record.SalespersonID = clawback.UserID
+		}
+
+		if _, err := s.DB.Collection("commission_records").InsertOne(sessCtx, record); err != nil {
+			return fmt.Errorf("failed to insert %s clawback record: %w", clawback.Role, err)
+		}
+		_, err := s.DB.Collection(collectionName).UpdateOne(sessCtx,
+			bson.M{"_id": clawback.UserID},
+			bson.M{
+				"$inc": bson.M{"commissionBalance": -clawback.Amount},
+				"$set": bson.M{"updatedAt": now},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update %s commission balance: %w", clawback.Role, err)
+		}
+
+		entries = append(entries, ledger.Debit(ledger.CommissionAccount(clawback.Role, clawback.UserID), clawback.Amount))
+		platformShare -= clawback.Amount
+	}
+
+	// Legacy commission documents keep track of how much of them was taken back
+	var legacy []models.Commission
+	cursor, err := s.DB.Collection("commissions").Find(sessCtx, bson.M{"subscriptionId": refund.SubscriptionID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(sessCtx, &legacy); err != nil {
+		return err
+	}
+	for _, commission := range legacy {
+		clawedBack := math.Round((commission.SalespersonCommission+commission.SalesManagerCommission)*refund.Amount/refund.PaidAmount*100) / 100
+		if clawedBack <= 0 {
+			continue
+		}
+		_, err := s.DB.Collection("commissions").UpdateOne(sessCtx,
+			bson.M{"_id": commission.ID},
+			bson.M{"$inc": bson.M{"clawedBack": clawedBack}, "$set": bson.M{"clawedBackAt": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update commission: %w", err)
+		}
+	}
+
+	platformShare = math.Round(platformShare*100) / 100
+	if platformShare > 0 {
+		entries = append(entries, ledger.Debit(ledger.AccountRefundExpense, platformShare))
+
+		_, err := s.DB.Collection("admin_wallet").InsertOne(sessCtx, models.AdminWallet{
+			ID:          primitive.NewObjectID(),
+			Type:        "refund",
+			Amount:      -platformShare,
+			Description: fmt.Sprintf("Refund of %d unused days (%s)", refund.UnusedDays, refund.Kind),
+			EntityID:    refund.SubscriptionID,
+			EntityType:  refund.Kind,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
+		}
+		_, err = s.DB.Collection("admin_wallet_balance").UpdateOne(sessCtx,
+			bson.M{},
+			bson.M{
+				"$inc": bson.M{"netBalance": -platformShare, "totalRefunds": platformShare},
+				"$set": bson.M{"lastUpdated": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update admin wallet balance: %w", err)
+		}
+	}
+
+	return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+		Type:          ledger.TypeRefund,
+		ReferenceType: refund.Kind,
+		ReferenceID:   refund.SubscriptionID,
+		Description:   fmt.Sprintf("Refund of %d unused days out of %d", refund.UnusedDays, refund.TotalDays),
+		Entries:       entries,
+		CreatedAt:     now,
+	})
+}
+
+// notify tells the owner about the cancellation and every salesperson or sales manager about their clawback
+func (s *RefundService) notify(target *SubscriptionTarget, refund *models.Refund) {
+	client := s.DB.Client()
+
+	title := "Subscription Cancelled"
+	message := fmt.Sprintf("The subscription of %s has been cancelled.", target.EntityName)
+	data := map[string]interface{}{"type": "subscription_cancelled", "entityId": target.EntityID.Hex()}
+	if refund != nil {
+		data["refundId"] = refund.ID.Hex()
+		data["refundAmount"] = refund.Amount
+		if refund.Status == models.RefundStatusIssued {
+			message += fmt.Sprintf(" $%.2f for the %d unused days has been refunded to your Whish account.", refund.Amount, refund.UnusedDays)
+		} else {
+			message += fmt.Sprintf(" A refund of $%.2f for the %d unused days will be paid to you by our team.", refund.Amount, refund.UnusedDays)
+		}
+	}
+	if !target.OwnerUserID.IsZero() {
+		if err := utils.SaveNotification(client, target.OwnerUserID, title, message, "subscription_cancelled", data); err != nil {
+			log.Printf("Failed to save cancellation notification for user %s: %v", target.OwnerUserID.Hex(), err)
+		}
+	}
+
+	if refund != nil {
+		s.notifyClawbacks(target, refund)
+	}
+}
+
+// notifyClawbacks tells every salesperson or sales manager how much of their commission a refund took back
+func (s *RefundService) notifyClawbacks(target *SubscriptionTarget, refund *models.Refund) {
+	client := s.DB.Client()
+	for _, clawback := range refund.Clawbacks {
+		message := fmt.Sprintf("The subscription of %s was cancelled and refunded. $%.2f of your commission has been reversed.", target.EntityName, clawback.Amount)
+		if clawback.Outstanding > 0 {
+			message += fmt.Sprintf(" $%.2f was already withdrawn and will be deducted from your next commissions.", clawback.Outstanding)
+		}
+		err := utils.SaveNotification(client, clawback.UserID, "Commission Reversed", message, "commission_clawback", map[string]interface{}{
+			"refundId": refund.ID.Hex(),
+			"amount":   clawback.Amount,
+		})
+		if err != nil {
+			log.Printf("Failed to save clawback notification for %s %s: %v", clawback.Role, clawback.UserID.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const salesTargetLockKey = "barrim:jobs:sales-targets"
+
+// Errors returned by the sales target service
+var (
+	ErrSalesTargetNotFound      = errors.New("sales target not found")
+	ErrSalesTargetExists        = errors.New("the salesperson already has a target for this period")
+	ErrInvalidSalesTarget       = errors.New("set at least one goal; goals cannot be negative")
+	ErrInvalidSalesTargetPeriod = errors.New("period must be formatted YYYY-MM for monthly targets and YYYY-Qn for quarterly targets")
+	ErrSalesTargetClosed        = errors.New("the period of this target has ended")
+	ErrSalesTargetBonusPaid     = errors.New("the bonus of this target was already paid")
+	ErrSalespersonNotInTeam     = errors.New("salesperson not found in your team")
+	ErrInvalidLeaderboardMetric = errors.New("metric must be one of revenue, subscriptions, companies, wholesalers, serviceProviders or completion")
+)
+
+// SalesTargetService sets monthly and quarterly goals for salespersons, measures their progress from the
+// businesses they created and the subscriptions those businesses paid for, ranks sales teams and pays the
+// optional bonus commission once every goal of a target is reached.
+type SalesTargetService struct {
+	DB     *mongo.Database
+	Wallet *WalletService
+}
+
+// NewSalesTargetService creates a new sales target service
+func NewSalesTargetService(db *mongo.Database) *SalesTargetService {
+	return &SalesTargetService{DB: db, Wallet: NewWalletService(db)}
+}
+
+// SalesTargetPeriod returns the start and exclusive end of a monthly ("2026-10") or quarterly ("2026-Q4") period
+func SalesTargetPeriod(periodType, period string) (time.Time, time.Time, error) {
+	switch periodType {
+	case models.SalesTargetMonthly:
+		start, err := time.ParseInLocation("2006-01", period, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidSalesTargetPeriod
+		}
+		return start, start.AddDate(0, 1, 0), nil
+	case models.SalesTargetQuarterly:
+		parts := strings.Split(strings.ToUpper(period), "-Q")
+		if len(parts) != 2 {
+			return time.Time{}, time.Time{}, ErrInvalidSalesTargetPeriod
+		}
+		year, err := strconv.Atoi(parts[0])
+		quarter, qerr := strconv.Atoi(parts[1])
+		if err != nil || qerr != nil || year < 2000 || quarter < 1 || quarter > 4 {
+			return time.Time{}, time.Time{}, ErrInvalidSalesTargetPeriod
+		}
+		start := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(0, 3, 0), nil
+	default:
+		return time.Time{}, time.Time{}, ErrInvalidSalesTargetPeriod
+	}
+}
+
+// CurrentSalesPeriod returns the period of the given type containing a time
+func CurrentSalesPeriod(periodType string, at time.Time) string {
+	if periodType == models.SalesTargetQuarterly {
+		return fmt.Sprintf("%d-Q%d", at.Year(), (int(at.Month())-1)/3+1)
+	}
+	return at.Format("2006-01")
+}
+
+// SalesTargetView is a target with the figures reached so far
+type SalesTargetView struct {
+	models.SalesTarget `bson:",inline"`
+	SalespersonName    string            `json:"salespersonName,omitempty"`
+	Current            models.SalesGoals `json:"current"`
+	Completion         float64           `json:"completion"` // Percentage of the goals reached
+	Achieved           bool              `json:"achieved"`
+}
+
+// LeaderboardEntry is the standing of one salesperson in a period
+type LeaderboardEntry struct {
+	Rank          int                 `json:"rank"`
+	SalespersonID primitive.ObjectID  `json:"salespersonId"`
+	Name          string              `json:"name"`
+	Region        string              `json:"region,omitempty"`
+	Figures       models.SalesGoals   `json:"figures"`
+	TargetID      *primitive.ObjectID `json:"targetId,omitempty"`
+	Goals         *models.SalesGoals  `json:"goals,omitempty"`
+	Completion    float64             `json:"completion"`
+	Achieved      bool                `json:"achieved"`
+}
+
+// Leaderboard ranks salespersons for a period
+type Leaderboard struct {
+	PeriodType  string             `json:"periodType"`
+	Period      string             `json:"period"`
+	PeriodStart time.Time          `json:"periodStart"`
+	PeriodEnd   time.Time          `json:"periodEnd"`
+	Metric      string             `json:"metric"`
+	Entries     []LeaderboardEntry `json:"entries"`
+	TeamTotals  models.SalesGoals  `json:"teamTotals"`
+}
+
+// teamSalesperson loads a salesperson, checking they belong to the manager's team (any salesperson for a zero managerID)
+func (s *SalesTargetService) teamSalesperson(ctx context.Context, salespersonID, managerID primitive.ObjectID) (*models.Salesperson, error) {
+	filter := bson.M{"_id": salespersonID}
+	if !managerID.IsZero() {
+		filter["salesManagerId"] = managerID
+	}
+	var salesperson models.Salesperson
+	err := s.DB.Collection("salespersons").FindOne(ctx, filter).Decode(&salesperson)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSalespersonNotInTeam
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &salesperson, nil
+}
+
+// Create sets a target for a salesperson. Sales managers can only set targets for their own team;
+// admins pass a zero managerID.
+func (s *SalesTargetService) Create(ctx context.Context, req models.SalesTargetRequest, salespersonID, managerID, createdBy primitive.ObjectID, createdByType string) (*models.SalesTarget, error) {
+	if req.Goals.Empty() || !req.Goals.Valid() {
+		return nil, ErrInvalidSalesTarget
+	}
+	start, end, err := SalesTargetPeriod(req.PeriodType, req.Period)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !end.After(now) {
+		return nil, ErrSalesTargetClosed
+	}
+	salesperson, err := s.teamSalesperson(ctx, salespersonID, managerID)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &models.SalesTarget{
+		ID:             primitive.NewObjectID(),
+		SalespersonID:  salesperson.ID,
+		SalesManagerID: salesperson.SalesManagerID,
+		PeriodType:     req.PeriodType,
+		Period:         CurrentSalesPeriod(req.PeriodType, start),
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Goals:          req.Goals,
+		Status:         models.SalesTargetOpen,
+		Note:           strings.TrimSpace(req.Note),
+		BonusAmount:    roundCents(req.BonusAmount),
+		CreatedBy:      createdBy,
+		CreatedByType:  createdByType,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if _, err := s.DB.Collection("sales_targets").InsertOne(ctx, target); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSalesTargetExists
+		}
+		return nil, fmt.Errorf("failed to store sales target: %w", err)
+	}
+	return target, nil
+}
+
+// get loads a target, checking it was set for the manager's team (any target for a zero managerID)
+func (s *SalesTargetService) get(ctx context.Context, id, managerID primitive.ObjectID) (*models.SalesTarget, error) {
+	var target models.SalesTarget
+	if err := s.DB.Collection("sales_targets").FindOne(ctx, bson.M{"_id": id}).Decode(&target); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSalesTargetNotFound
+		}
+		return nil, err
+	}
+	if !managerID.IsZero() && target.SalesManagerID != managerID {
+		return nil, ErrSalesTargetNotFound
+	}
+	return &target, nil
+}
+
+// Update changes the goals, bonus and note of a target whose period has not ended
+func (s *SalesTargetService) Update(ctx context.Context, id, managerID primitive.ObjectID, req models.SalesTargetUpdateRequest) (*models.SalesTarget, error) {
+	if req.Goals.Empty() || !req.Goals.Valid() {
+		return nil, ErrInvalidSalesTarget
+	}
+	target, err := s.get(ctx, id, managerID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Status != models.SalesTargetOpen {
+		return nil, ErrSalesTargetClosed
+	}
+	if target.BonusPaidAt != nil {
+		return nil, ErrSalesTargetBonusPaid
+	}
+
+	target.Goals = req.Goals
+	target.BonusAmount = roundCents(req.BonusAmount)
+	target.Note = strings.TrimSpace(req.Note)
+	target.UpdatedAt = time.Now()
+	_, err = s.DB.Collection("sales_targets").UpdateOne(ctx,
+		bson.M{"_id": target.ID, "status": models.SalesTargetOpen, "bonusPaidAt": nil},
+		bson.M{"$set": bson.M{
+			"goals":       target.Goals,
+			"bonusAmount": target.BonusAmount,
+			"note":        target.Note,
+			"updatedAt":   target.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Delete removes a target whose bonus was not paid
+func (s *SalesTargetService) Delete(ctx context.Context, id, managerID primitive.ObjectID) error {
+	target, err := s.get(ctx, id, managerID)
+	if err != nil {
+		return err
+	}
+	result, err := s.DB.Collection("sales_targets").DeleteOne(ctx, bson.M{"_id": target.ID, "bonusPaidAt": nil})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSalesTargetBonusPaid
+	}
+	return nil
+}
+
+// List returns the targets matching the filter with the figures reached so far, latest period first
+func (s *SalesTargetService) List(ctx context.Context, filter bson.M) ([]SalesTargetView, error) {
+	cursor, err := s.DB.Collection("sales_targets").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "periodStart", Value: -1}, {Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	targets := []models.SalesTarget{}
+	if err := cursor.All(ctx, &targets); err != nil {
+		return nil, err
+	}
+
+	names, err := s.salespersonNames(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]SalesTargetView, 0, len(targets))
+	for _, target := range targets {
+		view := SalesTargetView{SalesTarget: target, SalespersonName: names[target.SalespersonID]}
+		if target.Progress != nil {
+			view.Current = *target.Progress
+		} else {
+			figures, err := s.Figures(ctx, []primitive.ObjectID{target.SalespersonID}, target.PeriodStart, target.PeriodEnd)
+			if err != nil {
+				return nil, err
+			}
+			view.Current = *figures[target.SalespersonID]
+		}
+		view.Completion = roundCents(target.Goals.Completion(view.Current))
+		view.Achieved = target.Goals.ReachedBy(view.Current)
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func (s *SalesTargetService) salespersonNames(ctx context.Context, targets []models.SalesTarget) (map[primitive.ObjectID]string, error) {
+	ids := make([]primitive.ObjectID, 0, len(targets))
+	for _, target := range targets {
+		ids = append(ids, target.SalespersonID)
+	}
+	names := map[primitive.ObjectID]string{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+	cursor, err := s.DB.Collection("salespersons").Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"fullName": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var salespersons []models.Salesperson
+	if err := cursor.All(ctx, &salespersons); err != nil {
+		return nil, err
+	}
+	for _, salesperson := range salespersons {
+		names[salesperson.ID] = salesperson.FullName
+	}
+	return names, nil
+}
+
+// Figures counts what each salesperson achieved in a period: the businesses they created, and the paid
+// subscriptions of their businesses with the amount paid, taken from the commission rows
+func (s *SalesTargetService) Figures(ctx context.Context, salespersonIDs []primitive.ObjectID, start, end time.Time) (map[primitive.ObjectID]*models.SalesGoals, error) {
+	figures := map[primitive.ObjectID]*models.SalesGoals{}
+	for _, id := range salespersonIDs {
+		figures[id] = &models.SalesGoals{}
+	}
+	if len(salespersonIDs) == 0 {
+		return figures, nil
+	}
+	period := bson.M{"$gte": start, "$lt": end}
+
+	created := []struct {
+		Collection string
+		Add        func(*models.SalesGoals, int)
+	}{
+		{"companies", func(g *models.SalesGoals, n int) { g.Companies += n }},
+		{"wholesalers", func(g *models.SalesGoals, n int) { g.Wholesalers += n }},
+		{"serviceProviders", func(g *models.SalesGoals, n int) { g.ServiceProviders += n }},
+	}
+	for _, entity := range created {
+		cursor, err := s.DB.Collection(entity.Collection).Aggregate(ctx, []bson.M{
+			{"$match": bson.M{"createdBy": bson.M{"$in": salespersonIDs}, "createdAt": period}},
+			{"$group": bson.M{"_id": "$createdBy", "count": bson.M{"$sum": 1}}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", entity.Collection, err)
+		}
+		var counts []struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int                `bson:"count"`
+		}
+		if err := cursor.All(ctx, &counts); err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			entity.Add(figures[count.ID], count.Count)
+		}
+	}
+
+	cursor, err := s.DB.Collection("commissions").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"salespersonID": bson.M{"$in": salespersonIDs}, "createdAt": period}},
+		{"$group": bson.M{"_id": "$salespersonID", "count": bson.M{"$sum": 1}, "revenue": bson.M{"$sum": "$planPrice"}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum subscriptions: %w", err)
+	}
+	var sales []struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Count   int                `bson:"count"`
+		Revenue float64            `bson:"revenue"`
+	}
+	if err := cursor.All(ctx, &sales); err != nil {
+		return nil, err
+	}
+	for _, sale := range sales {
+		figures[sale.ID].Subscriptions = sale.Count
+		figures[sale.ID].Revenue = roundCents(sale.Revenue)
+	}
+	return figures, nil
+}
+
+// Leaderboard ranks the salespersons of a manager's team (every salesperson for a zero managerID) for a period
+func (s *SalesTargetService) Leaderboard(ctx context.Context, managerID primitive.ObjectID, periodType, period, metric string) (*Leaderboard, error) {
+	if metric == "" {
+		metric = "revenue"
+	}
+	value, ok := leaderboardMetrics[metric]
+	if !ok {
+		return nil, ErrInvalidLeaderboardMetric
+	}
+	if period == "" {
+		period = CurrentSalesPeriod(periodType, time.Now())
+	}
+	start, end, err := SalesTargetPeriod(periodType, period)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{}
+	if !managerID.IsZero() {
+		filter["salesManagerId"] = managerID
+	}
+	cursor, err := s.DB.Collection("salespersons").Find(ctx, filter, options.Find().SetProjection(bson.M{"fullName": 1, "region": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var salespersons []models.Salesperson
+	if err := cursor.All(ctx, &salespersons); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(salespersons))
+	for _, salesperson := range salespersons {
+		ids = append(ids, salesperson.ID)
+	}
+
+	figures, err := s.Figures(ctx, ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[primitive.ObjectID]models.SalesTarget{}
+	if len(ids) > 0 {
+		cursor, err := s.DB.Collection("sales_targets").Find(ctx, bson.M{"salespersonId": bson.M{"$in": ids}, "periodType": periodType, "period": CurrentSalesPeriod(periodType, start)})
+		if err != nil {
+			return nil, err
+		}
+		var list []models.SalesTarget
+		if err := cursor.All(ctx, &list); err != nil {
+			return nil, err
+		}
+		for _, target := range list {
+			targets[target.SalespersonID] = target
+		}
+	}
+
+	board := &Leaderboard{
+		PeriodType:  periodType,
+		Period:      CurrentSalesPeriod(periodType, start),
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Metric:      metric,
+		Entries:     make([]LeaderboardEntry, 0, len(salespersons)),
+	}
+	for _, salesperson := range salespersons {
+		entry := LeaderboardEntry{
+			SalespersonID: salesperson.ID,
+			Name:          salesperson.FullName,
+			Region:        salesperson.Region,
+			Figures:       *figures[salesperson.ID],
+		}
+		if target, ok := targets[salesperson.ID]; ok {
+			entry.TargetID = &target.ID
+			entry.Goals = &target.Goals
+			entry.Completion = roundCents(target.Goals.Completion(entry.Figures))
+			entry.Achieved = target.Goals.ReachedBy(entry.Figures)
+		}
+		board.Entries = append(board.Entries, entry)
+
+		board.TeamTotals.Companies += entry.Figures.Companies
+		board.TeamTotals.Wholesalers += entry.Figures.Wholesalers
+		board.TeamTotals.ServiceProviders += entry.Figures.ServiceProviders
+		board.TeamTotals.Subscriptions += entry.Figures.Subscriptions
+		board.TeamTotals.Revenue += entry.Figures.Revenue
+	}
+	board.TeamTotals.Revenue = roundCents(board.TeamTotals.Revenue)
+
+	sort.SliceStable(board.Entries, func(i, j int) bool {
+		a, b := value(board.Entries[i]), value(board.Entries[j])
+		if a != b {
+			return a > b
+		}
+		return board.Entries[i].Name < board.Entries[j].Name
+	})
+	for i := range board.Entries {
+		board.Entries[i].Rank = i + 1
+		// Equal scores share a rank
+		if i > 0 && value(board.Entries[i]) == value(board.Entries[i-1]) {
+			board.Entries[i].Rank = board.Entries[i-1].Rank
+		}
+	}
+	return board, nil
+}
+
+// leaderboardMetrics are the values salespersons can be ranked by
+var leaderboardMetrics = map[string]func(LeaderboardEntry) float64{
+	"revenue":          func(e LeaderboardEntry) float64 { return e.Figures.Revenue },
+	"subscriptions":    func(e LeaderboardEntry) float64 { return float64(e.Figures.Subscriptions) },
+	"companies":        func(e LeaderboardEntry) float64 { return float64(e.Figures.Companies) },
+	"wholesalers":      func(e LeaderboardEntry) float64 { return float64(e.Figures.Wholesalers) },
+	"serviceProviders": func(e LeaderboardEntry) float64 { return float64(e.Figures.ServiceProviders) },
+	"completion":       func(e LeaderboardEntry) float64 { return e.Completion },
+}
+
+// Run pays the bonus of open targets whose goals were reached and closes the targets whose period ended
+func (s *SalesTargetService) Run() {
+	ran := utils.RunWithJobLock(salesTargetLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		now := time.Now()
+		cursor, err := s.DB.Collection("sales_targets").Find(ctx, bson.M{
+			"status":      models.SalesTargetOpen,
+			"periodStart": bson.M{"$lte": now},
+		})
+		if err != nil {
+			log.Printf("Failed to load open sales targets: %v", err)
+			return
+		}
+		var targets []models.SalesTarget
+		if err := cursor.All(ctx, &targets); err != nil {
+			log.Printf("Failed to decode open sales targets: %v", err)
+			return
+		}
+
+		for _, target := range targets {
+			figures, err := s.Figures(ctx, []primitive.ObjectID{target.SalespersonID}, target.PeriodStart, target.PeriodEnd)
+			if err != nil {
+				log.Printf("Failed to measure sales target %s: %v", target.ID.Hex(), err)
+				continue
+			}
+			current := *figures[target.SalespersonID]
+			reached := target.Goals.ReachedBy(current)
+
+			if reached && target.BonusAmount > 0 && target.BonusPaidAt == nil {
+				if err := s.payBonus(ctx, target); err != nil {
+					log.Printf("Failed to pay the bonus of sales target %s: %v", target.ID.Hex(), err)
+					continue
+				}
+			}
+
+			if target.PeriodEnd.After(now) {
+				continue
+			}
+			status := models.SalesTargetMissed
+			if reached {
+				status = models.SalesTargetAchieved
+			}
+			_, err = s.DB.Collection("sales_targets").UpdateOne(ctx,
+				bson.M{"_id": target.ID, "status": models.SalesTargetOpen},
+				bson.M{"$set": bson.M{"status": status, "progress": current, "updatedAt": now}},
+			)
+			if err != nil {
+				log.Printf("Failed to close sales target %s: %v", target.ID.Hex(), err)
+			}
+		}
+	})
+	if !ran {
+		log.Println("Sales targets skipped: another instance holds the lock")
+	}
+}
+
+// payBonus books the bonus of a target as a commission of the salesperson, once
+func (s *SalesTargetService) payBonus(ctx context.Context, target models.SalesTarget) error {
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		now := time.Now()
+		result, err := s.DB.Collection("sales_targets").UpdateOne(sessCtx,
+			bson.M{"_id": target.ID, "bonusPaidAt": nil},
+			bson.M{"$set": bson.M{"bonusPaidAt": now, "updatedAt": now}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return nil
+		}
+		log.Printf("Sales target %s reached by salesperson %s, paying bonus of $%.2f", target.ID.Hex(), target.SalespersonID.Hex(), target.BonusAmount)
+		return s.Wallet.RecordCommission(sessCtx, "salesperson", target.SalespersonID, target.BonusAmount, target.ID, "sales_target_bonus",
+			fmt.Sprintf("Bonus for reaching the %s target %s", target.PeriodType, target.Period))
+	})
+}
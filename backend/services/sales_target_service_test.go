@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+func TestSalesTargetPeriod(t *testing.T) {
+	date := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		periodType string
+		period     string
+		start, end time.Time
+		invalid    bool
+	}{
+		{periodType: models.SalesTargetMonthly, period: "2026-03", start: date(2026, time.March), end: date(2026, time.April)},
+		{periodType: models.SalesTargetMonthly, period: "2026-12", start: date(2026, time.December), end: date(2027, time.January)},
+		{periodType: models.SalesTargetQuarterly, period: "2026-Q1", start: date(2026, time.January), end: date(2026, time.April)},
+		{periodType: models.SalesTargetQuarterly, period: "2026-q4", start: date(2026, time.October), end: date(2027, time.January)},
+		{periodType: models.SalesTargetMonthly, period: "2026-13", invalid: true},
+		{periodType: models.SalesTargetMonthly, period: "2026-Q1", invalid: true},
+		{periodType: models.SalesTargetQuarterly, period: "2026-Q5", invalid: true},
+		{periodType: models.SalesTargetQuarterly, period: "1999-Q1", invalid: true},
+		{periodType: models.SalesTargetQuarterly, period: "2026-03", invalid: true},
+		{periodType: "weekly", period: "2026-03", invalid: true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := SalesTargetPeriod(tt.periodType, tt.period)
+		if tt.invalid {
+			if err != ErrInvalidSalesTargetPeriod {
+				t.Errorf("SalesTargetPeriod(%q, %q) error = %v, want ErrInvalidSalesTargetPeriod", tt.periodType, tt.period, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SalesTargetPeriod(%q, %q) error = %v", tt.periodType, tt.period, err)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("SalesTargetPeriod(%q, %q) = %v, %v; want %v, %v", tt.periodType, tt.period, start, end, tt.start, tt.end)
+		}
+	}
+}
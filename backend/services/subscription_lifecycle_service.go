@@ -0,0 +1,739 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const subscriptionLifecycleLockKey = "barrim:jobs:subscription-lifecycle"
+
+// SubscriptionLifecycleService moves subscriptions through their lifecycle in the background
+type SubscriptionLifecycleService struct {
+	DB *mongo.Database
+}
+
+// NewSubscriptionLifecycleService creates a new subscription lifecycle service
+func NewSubscriptionLifecycleService(db *mongo.Database) *SubscriptionLifecycleService {
+	return &SubscriptionLifecycleService{
+		DB: db,
+	}
+}
+
+// Run executes one lifecycle pass under a distributed lock so that only one replica works at a time
+func (s *SubscriptionLifecycleService) Run() {
+	ran := utils.RunWithJobLock(subscriptionLifecycleLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		s.ProcessAutoRenewals(ctx)
+		s.ExpireSubscriptions(ctx)
+		s.ProcessTrials(ctx)
+	})
+	if !ran {
+		log.Println("Subscription lifecycle pass skipped: another instance holds the lock")
+	}
+}
+
+// ExpireSubscriptions marks every subscription past its end date as expired and removes the perks it granted
+func (s *SubscriptionLifecycleService) ExpireSubscriptions(ctx context.Context) {
+	now := time.Now()
+
+	for _, kind := range []string{SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch, SubscriptionKindServiceProvider} {
+		if err := s.expireSubscriptions(ctx, kind, now); err != nil {
+			log.Printf("Failed to expire %s subscriptions: %v", kind, err)
+		}
+	}
+	if err := s.expireSponsorshipSubscriptions(ctx, now); err != nil {
+		log.Printf("Failed to expire sponsorship subscriptions: %v", err)
+	}
+	if err := s.expireLegacySubscriptions(ctx, now, "company_subscriptions"); err != nil {
+		log.Printf("Failed to expire company subscriptions: %v", err)
+	}
+	if err := s.expireLegacySubscriptions(ctx, now, "wholesaler_subscriptions"); err != nil {
+		log.Printf("Failed to expire wholesaler subscriptions: %v", err)
+	}
+}
+
+// expiryFilter matches active subscriptions past their end date.
+// Subscriptions waiting on an auto-renewal payment are kept until the grace period is over.
+func expiryFilter(now time.Time) bson.M {
+	return bson.M{
+		"status": "active",
+		"$or": []bson.M{
+			{"endDate": bson.M{"$lte": now}, "renewalRequestId": bson.M{"$exists": false}},
+			{"endDate": bson.M{"$lte": now.Add(-autoRenewGracePeriod())}},
+		},
+	}
+}
+
+// autoRenewLeadTime is how long before the end date the renewal request is created (AUTO_RENEW_LEAD_DAYS, default 3)
+func autoRenewLeadTime() time.Duration {
+	return envDays("AUTO_RENEW_LEAD_DAYS", 3)
+}
+
+// autoRenewGracePeriod is how long an unpaid renewal keeps the subscription alive (AUTO_RENEW_GRACE_DAYS, default 3)
+func autoRenewGracePeriod() time.Duration {
+	return envDays("AUTO_RENEW_GRACE_DAYS", 3)
+}
+
+// trialConversionWindow is how long after a trial ends a first payment still counts as its conversion
+// (TRIAL_CONVERSION_WINDOW_DAYS, default 30)
+func trialConversionWindow() time.Duration {
+	return envDays("TRIAL_CONVERSION_WINDOW_DAYS", 30)
+}
+
+func envDays(name string, fallback int) time.Duration {
+	return envDuration(name, fallback, 24*time.Hour)
+}
+
+// envDuration reads a non-negative whole number of units from the environment
+func envDuration(name string, fallback int, unit time.Duration) time.Duration {
+	count := fallback
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			count = parsed
+		}
+	}
+	return time.Duration(count) * unit
+}
+
+// ProcessAutoRenewals creates the next-period payment request for subscriptions with auto-renew enabled
+// and follows up on renewals that were not paid by the end date
+func (s *SubscriptionLifecycleService) ProcessAutoRenewals(ctx context.Context) {
+	now := time.Now()
+
+	for _, kind := range []string{SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch, SubscriptionKindServiceProvider} {
+		if err := s.createRenewalRequests(ctx, kind, now); err != nil {
+			log.Printf("Failed to create %s renewal requests: %v", kind, err)
+		}
+		if err := s.followUpRenewals(ctx, kind, now); err != nil {
+			log.Printf("Failed to follow up %s renewals: %v", kind, err)
+		}
+	}
+}
+
+// createRenewalRequests issues a Whish collect link for every auto-renewing subscription close to its end date
+func (s *SubscriptionLifecycleService) createRenewalRequests(ctx context.Context, kind string, now time.Time) error {
+	cfg := subscriptionKinds[kind]
+	collection := s.DB.Collection(cfg.SubscriptionCollection)
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"status":           "active",
+		"autoRenew":        true,
+		"renewalRequestId": bson.M{"$exists": false},
+		"endDate":          bson.M{"$lte": now.Add(autoRenewLeadTime())},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var subscription SubscriptionRecord
+		if err := cursor.Decode(&subscription); err != nil {
+			log.Printf("Failed to decode %s subscription: %v", kind, err)
+			continue
+		}
+		entityID, _ := cursor.Current.Lookup(cfg.EntityField).ObjectIDOK()
+
+		if err := s.createRenewalRequest(ctx, kind, subscription, entityID, false); err != nil {
+			log.Printf("Failed to create renewal for %s subscription %s: %v", kind, subscription.ID.Hex(), err)
+		}
+	}
+
+	return cursor.Err()
+}
+
+// requestedAmount renders the USD amount collected by a payment request for a message, with its Lebanese pound
+// equivalent at the locked rate when the plan is priced in LBP, e.g. "$50.00 (4,475,000 LBP)"
+func requestedAmount(result *PaymentRequestResult) string {
+	amount := fmt.Sprintf("$%.2f", result.PaymentAmount)
+	if result.Price.OriginalCurrency == models.CurrencyLBP && result.Price.ExchangeRate > 0 {
+		amount += fmt.Sprintf(" (%s LBP)", groupThousands(int64(math.Round(result.PaymentAmount*result.Price.ExchangeRate))))
+	}
+	return amount
+}
+
+// groupThousands formats n with commas between groups of three digits
+func groupThousands(n int64) string {
+	if n < 0 {
+		return "-" + groupThousands(-n)
+	}
+	digits := strconv.FormatInt(n, 10)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// createRenewalRequest creates the renewal payment request for one subscription and sends the collect link to its owner
+func (s *SubscriptionLifecycleService) createRenewalRequest(ctx context.Context, kind string, subscription SubscriptionRecord, entityID primitive.ObjectID, inGrace bool) error {
+	cfg := subscriptionKinds[kind]
+	subscriptionService := NewSubscriptionService(s.DB)
+
+	target, err := subscriptionService.TargetForEntity(ctx, kind, entityID)
+	if err != nil {
+		return err
+	}
+
+	var plan models.SubscriptionPlan
+	err = s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": subscription.PlanID, "isActive": true}).Decode(&plan)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+		// The plan was retired; stop trying and let the owner pick a new plan
+		_, err = s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+			bson.M{"_id": subscription.ID},
+			bson.M{"$set": bson.M{"autoRenew": false, "updatedAt": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		s.notifyRenewal(target, "Auto-Renewal Stopped",
+			fmt.Sprintf("Your plan is no longer available, so %s will not renew automatically. Choose a new plan before your subscription ends.", target.EntityName),
+			"subscription_renewal_stopped",
+			map[string]interface{}{"subscriptionId": subscription.ID.Hex()})
+		return nil
+	}
+
+	result, err := subscriptionService.CreatePaymentRequest(ctx, target, plan, "whish", &subscription.ID)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"renewalRequestId": result.RequestID, "updatedAt": time.Now()}
+	if inGrace {
+		set["graceNotifiedAt"] = time.Now()
+	}
+	_, err = s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx, bson.M{"_id": subscription.ID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	title := "Subscription Renewal"
+	message := fmt.Sprintf("Your %s subscription for %s renews on %s. Complete the payment of %s to keep it active.",
+		plan.Title, target.EntityName, subscription.EndDate.Format("2006-01-02"), requestedAmount(result))
+	notifType := "subscription_renewal"
+	if inGrace {
+		title = "Subscription Payment Overdue"
+		message = fmt.Sprintf("Your %s subscription for %s ended on %s. Pay %s before %s to keep it active.",
+			plan.Title, target.EntityName, subscription.EndDate.Format("2006-01-02"), requestedAmount(result),
+			subscription.EndDate.Add(autoRenewGracePeriod()).Format("2006-01-02"))
+		notifType = "subscription_renewal_grace"
+	}
+
+	s.notifyRenewal(target, title, message, notifType, map[string]interface{}{
+		"subscriptionId": subscription.ID.Hex(),
+		"requestId":      result.RequestID.Hex(),
+		"collectUrl":     result.CollectURL,
+		"amount":         fmt.Sprintf("%.2f", result.PaymentAmount),
+	})
+
+	log.Printf("Created renewal request %s for %s subscription %s", result.RequestID.Hex(), kind, subscription.ID.Hex())
+	return nil
+}
+
+// followUpRenewals handles auto-renewing subscriptions that reached their end date with a renewal request outstanding.
+// Paid renewals retire the old subscription quietly, unpaid ones get a single grace-period reminder with a fresh
+// collect link if needed, and renewals still unpaid after the grace period are closed so normal expiry can proceed.
+func (s *SubscriptionLifecycleService) followUpRenewals(ctx context.Context, kind string, now time.Time) error {
+	cfg := subscriptionKinds[kind]
+
+	cursor, err := s.DB.Collection(cfg.SubscriptionCollection).Find(ctx, bson.M{
+		"status":           "active",
+		"endDate":          bson.M{"$lte": now},
+		"renewalRequestId": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var subscription SubscriptionRecord
+		if err := cursor.Decode(&subscription); err != nil {
+			log.Printf("Failed to decode %s subscription: %v", kind, err)
+			continue
+		}
+		entityID, _ := cursor.Current.Lookup(cfg.EntityField).ObjectIDOK()
+
+		var request struct {
+			Status string `bson:"status"`
+		}
+		err := s.DB.Collection(cfg.RequestCollection).FindOne(ctx, bson.M{"_id": *subscription.RenewalRequestID}).Decode(&request)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load renewal request %s: %v", subscription.RenewalRequestID.Hex(), err)
+			continue
+		}
+
+		switch {
+		case request.Status == "active":
+			// Renewal paid: the next-period subscription takes over
+			if _, err := s.markExpired(ctx, cfg.SubscriptionCollection, subscription.ID, now); err != nil {
+				log.Printf("Failed to retire renewed %s subscription %s: %v", kind, subscription.ID.Hex(), err)
+			}
+
+		case !now.Before(subscription.EndDate.Add(autoRenewGracePeriod())):
+			// Grace period over: close the unpaid request and let ExpireSubscriptions take the subscription down
+			_, err := s.DB.Collection(cfg.RequestCollection).UpdateOne(ctx,
+				bson.M{"_id": *subscription.RenewalRequestID, "status": "pending_payment"},
+				bson.M{"$set": bson.M{"status": "expired", "paymentStatus": "expired", "processedAt": now}},
+			)
+			if err != nil {
+				log.Printf("Failed to close renewal request %s: %v", subscription.RenewalRequestID.Hex(), err)
+			}
+
+		case subscription.GraceNotifiedAt == nil:
+			if request.Status == "pending_payment" {
+				target, err := NewSubscriptionService(s.DB).TargetForEntity(ctx, kind, entityID)
+				if err != nil {
+					log.Printf("Failed to resolve %s %s for grace reminder: %v", kind, entityID.Hex(), err)
+					continue
+				}
+				_, err = s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+					bson.M{"_id": subscription.ID},
+					bson.M{"$set": bson.M{"graceNotifiedAt": now}},
+				)
+				if err != nil {
+					log.Printf("Failed to record grace reminder for %s subscription %s: %v", kind, subscription.ID.Hex(), err)
+					continue
+				}
+				s.notifyRenewal(target, "Subscription Payment Overdue",
+					fmt.Sprintf("Your subscription for %s ended on %s. Complete the pending payment before %s to keep it active.",
+						target.EntityName, subscription.EndDate.Format("2006-01-02"),
+						subscription.EndDate.Add(autoRenewGracePeriod()).Format("2006-01-02")),
+					"subscription_renewal_grace",
+					map[string]interface{}{
+						"subscriptionId": subscription.ID.Hex(),
+						"requestId":      subscription.RenewalRequestID.Hex(),
+					})
+				continue
+			}
+
+			// The first collect link failed or was rejected; issue a new one for the grace period
+			if err := s.createRenewalRequest(ctx, kind, subscription, entityID, true); err != nil {
+				log.Printf("Failed to create grace renewal for %s subscription %s: %v", kind, subscription.ID.Hex(), err)
+			}
+		}
+	}
+
+	return cursor.Err()
+}
+
+// ProcessTrials sends the paid subscription request to trials about to end, records the trials whose business
+// paid for a subscription and closes the trials that ended without a payment
+func (s *SubscriptionLifecycleService) ProcessTrials(ctx context.Context) {
+	now := time.Now()
+
+	if err := s.requestTrialConversions(ctx, now); err != nil {
+		log.Printf("Failed to create trial conversion requests: %v", err)
+	}
+	if err := s.settleTrials(ctx, now); err != nil {
+		log.Printf("Failed to settle trials: %v", err)
+	}
+}
+
+// requestTrialConversions issues a Whish collect link for the trialled plan to every trial close to its end
+func (s *SubscriptionLifecycleService) requestTrialConversions(ctx context.Context, now time.Time) error {
+	cursor, err := s.DB.Collection("subscription_trials").Find(ctx, bson.M{
+		"status":              models.TrialStatusActive,
+		"conversionRequestId": bson.M{"$exists": false},
+		"endDate":             bson.M{"$lte": now.Add(autoRenewLeadTime())},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	trialService := NewTrialService(s.DB)
+	for cursor.Next(ctx) {
+		var trial models.SubscriptionTrial
+		if err := cursor.Decode(&trial); err != nil {
+			log.Printf("Failed to decode trial: %v", err)
+			continue
+		}
+
+		target, err := NewSubscriptionService(s.DB).TargetForEntity(ctx, trial.Kind, trial.EntityID)
+		if err != nil {
+			log.Printf("Failed to resolve %s %s for trial conversion: %v", trial.Kind, trial.EntityID.Hex(), err)
+			continue
+		}
+		result, err := trialService.Convert(ctx, target, primitive.NilObjectID, "whish")
+		if err != nil {
+			log.Printf("Failed to create conversion request for trial %s: %v", trial.ID.Hex(), err)
+			continue
+		}
+
+		s.notifyRenewal(target, "Free Trial Ending",
+			fmt.Sprintf("The free trial of %s ends on %s. Complete the payment of %s to keep it active.",
+				target.EntityName, trial.EndDate.Format("2006-01-02"), requestedAmount(result)),
+			"subscription_trial_ending",
+			map[string]interface{}{
+				"trialId":    trial.ID.Hex(),
+				"requestId":  result.RequestID.Hex(),
+				"collectUrl": result.CollectURL,
+				"amount":     fmt.Sprintf("%.2f", result.PaymentAmount),
+			})
+		log.Printf("Created conversion request %s for trial %s", result.RequestID.Hex(), trial.ID.Hex())
+	}
+
+	return cursor.Err()
+}
+
+// settleTrials marks trials converted once their business has paid, and expired once their trial subscription
+// is over without a payment. Expired trials are still watched for a late first payment during the conversion window.
+func (s *SubscriptionLifecycleService) settleTrials(ctx context.Context, now time.Time) error {
+	cursor, err := s.DB.Collection("subscription_trials").Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"status": models.TrialStatusActive},
+			{"status": models.TrialStatusExpired, "expiredAt": bson.M{"$gte": now.Add(-trialConversionWindow())}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	trialService := NewTrialService(s.DB)
+	for cursor.Next(ctx) {
+		var trial models.SubscriptionTrial
+		if err := cursor.Decode(&trial); err != nil {
+			log.Printf("Failed to decode trial: %v", err)
+			continue
+		}
+
+		converted, err := trialService.RecordConversion(ctx, &trial)
+		if err != nil {
+			log.Printf("Failed to check conversion of trial %s: %v", trial.ID.Hex(), err)
+			continue
+		}
+		if converted {
+			if !trial.SalespersonID.IsZero() {
+				s.notifyOwner(trial.SalespersonID, "Trial Converted",
+					fmt.Sprintf("%s paid for a subscription after its free trial.", trial.BusinessName),
+					"subscription_trial_converted",
+					map[string]interface{}{"trialId": trial.ID.Hex(), "entityId": trial.EntityID.Hex()})
+			}
+			log.Printf("Trial %s converted (%s %s)", trial.ID.Hex(), trial.Kind, trial.EntityID.Hex())
+			continue
+		}
+		if trial.Status != models.TrialStatusActive {
+			continue
+		}
+
+		var subscription SubscriptionRecord
+		cfg := subscriptionKinds[trial.Kind]
+		if err := s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx, bson.M{"_id": trial.SubscriptionID}).Decode(&subscription); err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Failed to load subscription of trial %s: %v", trial.ID.Hex(), err)
+			continue
+		}
+		if subscription.Status == models.SubscriptionStatusActive || subscription.Status == models.SubscriptionStatusPaused {
+			continue
+		}
+		if _, err := trialService.Expire(ctx, trial.ID); err != nil {
+			log.Printf("Failed to expire trial %s: %v", trial.ID.Hex(), err)
+			continue
+		}
+		log.Printf("Trial %s expired without a payment (%s %s)", trial.ID.Hex(), trial.Kind, trial.EntityID.Hex())
+	}
+
+	return cursor.Err()
+}
+
+// notifyRenewal sends a renewal message to the owner both in-app and through FCM
+func (s *SubscriptionLifecycleService) notifyRenewal(target *SubscriptionTarget, title, message, notifType string, data map[string]interface{}) {
+	data["type"] = notifType
+	data["entityType"] = target.Kind
+	data["entityId"] = target.EntityID.Hex()
+
+	s.notifyOwner(target.OwnerUserID, title, message, notifType, data)
+
+	var err error
+	if target.Kind == SubscriptionKindServiceProvider {
+		err = utils.SendFCMNotificationToServiceProvider(s.DB.Client(), target.EntityID, title, message, data)
+	} else if !target.OwnerUserID.IsZero() {
+		err = utils.SendFCMNotificationToUser(s.DB.Client(), target.OwnerUserID, title, message, data)
+	}
+	if err != nil {
+		log.Printf("Failed to send %s push notification for %s %s: %v", notifType, target.Kind, target.EntityID.Hex(), err)
+	}
+}
+
+// markExpired flips a single subscription from active to expired.
+// It returns false when another replica or request already changed the status.
+func (s *SubscriptionLifecycleService) markExpired(ctx context.Context, collectionName string, subscriptionID primitive.ObjectID, now time.Time) (bool, error) {
+	result, err := s.DB.Collection(collectionName).UpdateOne(ctx,
+		bson.M{"_id": subscriptionID, "status": "active"},
+		bson.M{"$set": bson.M{
+			"status":    "expired",
+			"updatedAt": now,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// hasOtherActiveSubscription reports whether the entity is still covered by another active subscription
+func (s *SubscriptionLifecycleService) hasOtherActiveSubscription(ctx context.Context, collectionName string, filter bson.M, now time.Time) bool {
+	filter["status"] = "active"
+	filter["endDate"] = bson.M{"$gt": now}
+	count, err := s.DB.Collection(collectionName).CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Failed to check active subscriptions in %s: %v", collectionName, err)
+		// Assume coverage so that a transient error never strips a paying customer
+		return true
+	}
+	return count > 0
+}
+
+// expireSubscriptions expires the subscriptions of one kind past their end date, hides the branch or service
+// provider when no other subscription covers it and lets the owner know
+func (s *SubscriptionLifecycleService) expireSubscriptions(ctx context.Context, kind string, now time.Time) error {
+	cfg := subscriptionKinds[kind]
+	cursor, err := s.DB.Collection(cfg.SubscriptionCollection).Find(ctx, expiryFilter(now))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	subscriptionService := NewSubscriptionService(s.DB)
+	for cursor.Next(ctx) {
+		var subscription SubscriptionRecord
+		if err := cursor.Decode(&subscription); err != nil {
+			log.Printf("Failed to decode %s subscription: %v", kind, err)
+			continue
+		}
+		entityID, _ := cursor.Current.Lookup(cfg.EntityField).ObjectIDOK()
+
+		expired, err := s.markExpired(ctx, cfg.SubscriptionCollection, subscription.ID, now)
+		if err != nil {
+			log.Printf("Failed to expire %s subscription %s: %v", kind, subscription.ID.Hex(), err)
+			continue
+		}
+		if !expired {
+			continue
+		}
+
+		target, err := subscriptionService.TargetForEntity(ctx, kind, entityID)
+		if err != nil {
+			log.Printf("Failed to find %s %s of expired subscription %s: %v", kind, entityID.Hex(), subscription.ID.Hex(), err)
+			continue
+		}
+
+		if !s.hasOtherActiveSubscription(ctx, cfg.SubscriptionCollection, bson.M{cfg.EntityField: entityID}, now) {
+			if err := subscriptionService.setEntityStatus(ctx, target, "inactive"); err != nil {
+				log.Printf("Failed to deactivate %s %s: %v", kind, entityID.Hex(), err)
+			}
+		}
+
+		message := fmt.Sprintf("The subscription for your branch %s has expired. Renew it to keep the branch visible.", target.EntityName)
+		if kind == SubscriptionKindServiceProvider {
+			message = "Your subscription has expired. Renew it to stay visible to customers."
+		}
+		s.notifyOwner(target.OwnerUserID, "Subscription Expired", message, "subscription_expired",
+			map[string]interface{}{
+				"subscriptionId": subscription.ID.Hex(),
+				cfg.EntityField:  entityID.Hex(),
+				"planId":         subscription.PlanID.Hex(),
+				"entityType":     kind,
+			})
+
+		log.Printf("%s subscription %s expired (%s)", kind, subscription.ID.Hex(), entityID.Hex())
+	}
+
+	return cursor.Err()
+}
+
+func (s *SubscriptionLifecycleService) expireSponsorshipSubscriptions(ctx context.Context, now time.Time) error {
+	cursor, err := s.DB.Collection("sponsorship_subscriptions").Find(ctx, bson.M{
+		"status":  "active",
+		"endDate": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var subscription models.SponsorshipSubscription
+		if err := cursor.Decode(&subscription); err != nil {
+			log.Printf("Failed to decode sponsorship subscription: %v", err)
+			continue
+		}
+
+		expired, err := s.markExpired(ctx, "sponsorship_subscriptions", subscription.ID, now)
+		if err != nil {
+			log.Printf("Failed to expire sponsorship subscription %s: %v", subscription.ID.Hex(), err)
+			continue
+		}
+		if !expired {
+			continue
+		}
+
+		stillSponsored := s.hasOtherActiveSubscription(ctx, "sponsorship_subscriptions", bson.M{"entityId": subscription.EntityID}, now)
+		if !stillSponsored {
+			if err := s.clearSponsorship(ctx, subscription.EntityType, subscription.EntityID, now); err != nil {
+				log.Printf("Failed to clear sponsorship for %s %s: %v", subscription.EntityType, subscription.EntityID.Hex(), err)
+			}
+		}
+
+		ownerID, entityName, err := s.findSponsorshipOwner(ctx, subscription.EntityType, subscription.EntityID)
+		if err != nil {
+			log.Printf("Failed to find owner for expired sponsorship subscription %s: %v", subscription.ID.Hex(), err)
+			continue
+		}
+
+		s.notifyOwner(ownerID, "Sponsorship Expired",
+			fmt.Sprintf("The sponsorship for %s has expired and it is no longer featured.", entityName),
+			"sponsorship_expired",
+			map[string]interface{}{
+				"subscriptionId": subscription.ID.Hex(),
+				"sponsorshipId":  subscription.SponsorshipID.Hex(),
+				"entityId":       subscription.EntityID.Hex(),
+				"entityType":     subscription.EntityType,
+			})
+
+		log.Printf("Sponsorship subscription %s expired (%s %s)", subscription.ID.Hex(), subscription.EntityType, subscription.EntityID.Hex())
+	}
+
+	return cursor.Err()
+}
+
+// expireLegacySubscriptions expires the older company-level and wholesaler-level subscriptions
+func (s *SubscriptionLifecycleService) expireLegacySubscriptions(ctx context.Context, now time.Time, collectionName string) error {
+	result, err := s.DB.Collection(collectionName).UpdateMany(ctx,
+		bson.M{"status": "active", "endDate": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{
+			"status":    "expired",
+			"updatedAt": now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Expired %d subscriptions in %s", result.ModifiedCount, collectionName)
+	}
+	return nil
+}
+
+// clearSponsorship removes the sponsorship flag from an entity and from its parent when no branch is sponsored anymore
+func (s *SubscriptionLifecycleService) clearSponsorship(ctx context.Context, entityType string, entityID primitive.ObjectID, now time.Time) error {
+	switch normalizeSponsorshipEntityType(entityType) {
+	case "service_provider":
+		_, err := s.DB.Collection("serviceProviders").UpdateOne(ctx,
+			bson.M{"_id": entityID},
+			bson.M{"$set": bson.M{"sponsorship": false, "updatedAt": now}},
+		)
+		return err
+
+	case "company_branch":
+		return s.clearBranchSponsorship(ctx, "companies", entityID, now)
+
+	case "wholesaler_branch":
+		return s.clearBranchSponsorship(ctx, "wholesalers", entityID, now)
+
+	default:
+		return fmt.Errorf("invalid entity type: %s", entityType)
+	}
+}
+
+func (s *SubscriptionLifecycleService) clearBranchSponsorship(ctx context.Context, collectionName string, branchID primitive.ObjectID, now time.Time) error {
+	collection := s.DB.Collection(collectionName)
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"branches._id": branchID},
+		bson.M{"$set": bson.M{
+			"branches.$.sponsorship": false,
+			"branches.$.updatedAt":   now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// The parent flag only stays on while at least one branch is still sponsored
+	_, err = collection.UpdateOne(ctx,
+		bson.M{
+			"branches._id":         branchID,
+			"branches.sponsorship": bson.M{"$ne": true},
+		},
+		bson.M{"$set": bson.M{"sponsorship": false, "updatedAt": now}},
+	)
+	return err
+}
+
+// findSponsorshipOwner returns the user that owns a sponsored entity along with a display name
+func (s *SubscriptionLifecycleService) findSponsorshipOwner(ctx context.Context, entityType string, entityID primitive.ObjectID) (primitive.ObjectID, string, error) {
+	switch normalizeSponsorshipEntityType(entityType) {
+	case "service_provider":
+		var serviceProvider models.ServiceProvider
+		if err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": entityID}).Decode(&serviceProvider); err != nil {
+			return primitive.NilObjectID, "", err
+		}
+		return serviceProvider.UserID, serviceProvider.BusinessName, nil
+
+	case "company_branch":
+		var company models.Company
+		if err := s.DB.Collection("companies").FindOne(ctx, bson.M{"branches._id": entityID}).Decode(&company); err != nil {
+			return primitive.NilObjectID, "", err
+		}
+		for _, b := range company.Branches {
+			if b.ID == entityID {
+				return company.UserID, b.Name, nil
+			}
+		}
+		return company.UserID, company.BusinessName, nil
+
+	case "wholesaler_branch":
+		var wholesaler models.Wholesaler
+		if err := s.DB.Collection("wholesalers").FindOne(ctx, bson.M{"branches._id": entityID}).Decode(&wholesaler); err != nil {
+			return primitive.NilObjectID, "", err
+		}
+		for _, b := range wholesaler.Branches {
+			if b.ID == entityID {
+				return wholesaler.UserID, b.Name, nil
+			}
+		}
+		return wholesaler.UserID, wholesaler.BusinessName, nil
+
+	default:
+		return primitive.NilObjectID, "", fmt.Errorf("invalid entity type: %s", entityType)
+	}
+}
+
+func (s *SubscriptionLifecycleService) notifyOwner(userID primitive.ObjectID, title, message, notifType string, data map[string]interface{}) {
+	if userID.IsZero() {
+		return
+	}
+	if err := utils.SaveNotification(s.DB.Client(), userID, title, message, notifType, data); err != nil {
+		log.Printf("Failed to save %s notification for user %s: %v", notifType, userID.Hex(), err)
+	}
+}
+
+// normalizeSponsorshipEntityType handles both camelCase and snake_case entity types
+func normalizeSponsorshipEntityType(entityType string) string {
+	switch entityType {
+	case "serviceProvider":
+		return "service_provider"
+	case "companyBranch":
+		return "company_branch"
+	case "wholesalerBranch":
+		return "wholesaler_branch"
+	default:
+		return entityType
+	}
+}
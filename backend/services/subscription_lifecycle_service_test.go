@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+func TestRequestedAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		result PaymentRequestResult
+		want   string
+	}{
+		{"usd plan", PaymentRequestResult{PaymentAmount: 25, Price: models.ConvertCurrency(25, models.CurrencyUSD, 89500)}, "$25.00"},
+		{"lbp plan", PaymentRequestResult{PaymentAmount: 50, Price: models.ConvertCurrency(4475000, models.CurrencyLBP, 89500)}, "$50.00 (4,475,000 LBP)"},
+		{"lbp plan without a rate", PaymentRequestResult{PaymentAmount: 50, Price: models.CurrencyConversion{OriginalCurrency: models.CurrencyLBP}}, "$50.00"},
+		{"legacy plan", PaymentRequestResult{PaymentAmount: 9.99}, "$9.99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestedAmount(&tt.result); got != tt.want {
+				t.Errorf("requestedAmount = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
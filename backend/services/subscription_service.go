@@ -0,0 +1,1053 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Subscription kinds handled by the shared subscription flows
+const (
+	SubscriptionKindCompanyBranch    = "company_branch"
+	SubscriptionKindWholesalerBranch = "wholesaler_branch"
+	SubscriptionKindServiceProvider  = "service_provider"
+)
+
+// Errors returned by the subscription service
+var (
+	ErrSubscriptionNotFound         = errors.New("no subscription found")
+	ErrSubscriptionEntityNotFound   = errors.New("branch or service provider not found or you do not have access")
+	ErrPendingSubscriptionRequest   = errors.New("a subscription request is already pending payment or approval")
+	ErrInvalidPaymentMethod         = errors.New("invalid payment method. Must be 'whish' or 'cash'")
+	ErrSubscriptionPlanUnavailable  = errors.New("subscription plan not found or inactive")
+	ErrInvalidSubscriptionKind      = errors.New("invalid subscription kind")
+	ErrSamePlan                     = errors.New("the subscription is already on this plan")
+	ErrInvalidPlanChangeTiming      = errors.New("invalid timing. Must be 'immediate' or 'period_end'")
+	ErrTrialPlanChange              = errors.New("a free trial cannot change plan. Convert it to a paid subscription instead")
+	ErrPlanChangeSubscriptionEnded  = errors.New("the subscription this plan change was requested for is no longer running")
+	ErrSubscriptionConcurrentUpdate = errors.New("the subscription was changed by another request at the same time; try again")
+)
+
+// When a plan change takes effect
+const (
+	PlanChangeImmediate = "immediate"  // Switch now, crediting the unused days of the current plan
+	PlanChangePeriodEnd = "period_end" // Switch when the current subscription ends, at the full price of the new plan
+)
+
+// subscriptionKindConfig describes where each kind of subscription keeps its documents
+type subscriptionKindConfig struct {
+	SubscriptionCollection string
+	RequestCollection      string
+	EntityField            string // Field holding the entity ID on subscriptions and requests
+	CallbackPath           string // Whish callback path, without the /success or /failure suffix
+	InvoiceLabel           string
+}
+
+var subscriptionKinds = map[string]subscriptionKindConfig{
+	SubscriptionKindCompanyBranch: {
+		SubscriptionCollection: "branch_subscriptions",
+		RequestCollection:      "branch_subscription_requests",
+		EntityField:            "branchId",
+		CallbackPath:           "/api/whish/payment/callback",
+		InvoiceLabel:           "Branch Subscription",
+	},
+	SubscriptionKindWholesalerBranch: {
+		SubscriptionCollection: "wholesaler_branch_subscriptions",
+		RequestCollection:      "wholesaler_branch_subscription_requests",
+		EntityField:            "branchId",
+		CallbackPath:           "/api/whish/wholesaler-branch/payment/callback",
+		InvoiceLabel:           "Wholesaler Branch Subscription",
+	},
+	SubscriptionKindServiceProvider: {
+		SubscriptionCollection: "serviceProviders_subscriptions",
+		RequestCollection:      "subscription_requests",
+		EntityField:            "serviceProviderId",
+		CallbackPath:           "/api/whish/service-provider/payment/callback",
+		InvoiceLabel:           "Service Provider Subscription",
+	},
+}
+
+// SubscriptionTarget is the branch or service provider a subscription belongs to
+type SubscriptionTarget struct {
+	Kind        string
+	EntityID    primitive.ObjectID
+	EntityName  string
+	OwnerID     primitive.ObjectID // Company, wholesaler or service provider document ID
+	OwnerName   string
+	OwnerUserID primitive.ObjectID
+	CreatedBy   primitive.ObjectID // Salesperson who created the business, if any
+}
+
+// SubscriptionRecord holds the fields shared by all subscription documents
+type SubscriptionRecord struct {
+	ID               primitive.ObjectID  `json:"id" bson:"_id"`
+	PlanID           primitive.ObjectID  `json:"planId" bson:"planId"`
+	StartDate        time.Time           `json:"startDate" bson:"startDate"`
+	EndDate          time.Time           `json:"endDate" bson:"endDate"`
+	Status           string              `json:"status" bson:"status"`
+	AutoRenew        bool                `json:"autoRenew" bson:"autoRenew"`
+	PaymentMethod    string              `json:"paymentMethod" bson:"paymentMethod"`
+	PausedAt         *time.Time          `json:"pausedAt,omitempty" bson:"pausedAt,omitempty"`
+	RemainingDays    int                 `json:"remainingDays,omitempty" bson:"remainingDays,omitempty"`
+	RenewalRequestID *primitive.ObjectID `json:"renewalRequestId,omitempty" bson:"renewalRequestId,omitempty"`
+	GraceNotifiedAt  *time.Time          `json:"graceNotifiedAt,omitempty" bson:"graceNotifiedAt,omitempty"`
+	CarriedCredit    float64             `json:"carriedCredit,omitempty" bson:"carriedCredit,omitempty"` // Unused value brought over from the plan it replaced
+	Trial            bool                `json:"trial,omitempty" bson:"trial,omitempty"`
+}
+
+// PaymentRequestResult describes a subscription request created through the Whish or cash flow
+type PaymentRequestResult struct {
+	RequestID     primitive.ObjectID        `json:"requestId"`
+	Plan          models.SubscriptionPlan   `json:"plan"`
+	Status        string                    `json:"status"`
+	PaymentMethod string                    `json:"paymentMethod"`
+	PaymentAmount float64                   `json:"paymentAmount"` // In USD
+	Price         models.CurrencyConversion `json:"price"`         // Plan price at the locked exchange rate
+	CollectURL    string                    `json:"collectUrl,omitempty"`
+	ExternalID    int64                     `json:"externalId,omitempty"`
+	SubmittedAt   time.Time                 `json:"submittedAt"`
+}
+
+// SubscriptionService implements the subscription flows shared by company branches, wholesaler branches and service providers
+type SubscriptionService struct {
+	DB *mongo.Database
+}
+
+// NewSubscriptionService creates a new subscription service
+func NewSubscriptionService(db *mongo.Database) *SubscriptionService {
+	return &SubscriptionService{DB: db}
+}
+
+func (s *SubscriptionService) kindConfig(kind string) (subscriptionKindConfig, error) {
+	cfg, ok := subscriptionKinds[kind]
+	if !ok {
+		return subscriptionKindConfig{}, ErrInvalidSubscriptionKind
+	}
+	return cfg, nil
+}
+
+// ResolveTarget finds the subscribed entity and checks that it belongs to the given user.
+// entityID is the branch ID for branch kinds and is ignored for service providers.
+func (s *SubscriptionService) ResolveTarget(ctx context.Context, kind string, userID, entityID primitive.ObjectID) (*SubscriptionTarget, error) {
+	switch kind {
+	case SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch:
+		return s.branchTarget(ctx, kind, bson.M{"userId": userID, "branches._id": entityID}, entityID)
+
+	case SubscriptionKindServiceProvider:
+		var serviceProvider models.ServiceProvider
+		err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"userId": userID}).Decode(&serviceProvider)
+		if err == mongo.ErrNoDocuments {
+			// Older accounts only reference the service provider from the user document
+			var user models.User
+			if userErr := s.DB.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); userErr != nil || user.ServiceProviderID == nil {
+				return nil, ErrSubscriptionEntityNotFound
+			}
+			err = s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": *user.ServiceProviderID}).Decode(&serviceProvider)
+		}
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrSubscriptionEntityNotFound
+			}
+			return nil, err
+		}
+		if serviceProvider.UserID.IsZero() {
+			serviceProvider.UserID = userID
+		}
+		return serviceProviderTarget(serviceProvider), nil
+
+	default:
+		return nil, ErrInvalidSubscriptionKind
+	}
+}
+
+// TargetForEntity finds the subscribed entity by its ID without an ownership check, for background jobs
+func (s *SubscriptionService) TargetForEntity(ctx context.Context, kind string, entityID primitive.ObjectID) (*SubscriptionTarget, error) {
+	switch kind {
+	case SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch:
+		return s.branchTarget(ctx, kind, bson.M{"branches._id": entityID}, entityID)
+
+	case SubscriptionKindServiceProvider:
+		var serviceProvider models.ServiceProvider
+		if err := s.DB.Collection("serviceProviders").FindOne(ctx, bson.M{"_id": entityID}).Decode(&serviceProvider); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrSubscriptionEntityNotFound
+			}
+			return nil, err
+		}
+		if serviceProvider.UserID.IsZero() {
+			// Older accounts only reference the service provider from the user document
+			var user models.User
+			if err := s.DB.Collection("users").FindOne(ctx, bson.M{"serviceProviderId": entityID}).Decode(&user); err == nil {
+				serviceProvider.UserID = user.ID
+			}
+		}
+		return serviceProviderTarget(serviceProvider), nil
+
+	default:
+		return nil, ErrInvalidSubscriptionKind
+	}
+}
+
+// branchTarget loads a company or wholesaler branch target matching the filter
+func (s *SubscriptionService) branchTarget(ctx context.Context, kind string, filter bson.M, branchID primitive.ObjectID) (*SubscriptionTarget, error) {
+	target := &SubscriptionTarget{Kind: kind, EntityID: branchID}
+
+	if kind == SubscriptionKindCompanyBranch {
+		var company models.Company
+		if err := s.DB.Collection("companies").FindOne(ctx, filter).Decode(&company); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrSubscriptionEntityNotFound
+			}
+			return nil, err
+		}
+		target.OwnerID, target.OwnerName, target.OwnerUserID, target.CreatedBy = company.ID, company.BusinessName, company.UserID, company.CreatedBy
+		for _, b := range company.Branches {
+			if b.ID == branchID {
+				target.EntityName = b.Name
+				break
+			}
+		}
+		return target, nil
+	}
+
+	var wholesaler models.Wholesaler
+	if err := s.DB.Collection("wholesalers").FindOne(ctx, filter).Decode(&wholesaler); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionEntityNotFound
+		}
+		return nil, err
+	}
+	target.OwnerID, target.OwnerName, target.OwnerUserID, target.CreatedBy = wholesaler.ID, wholesaler.BusinessName, wholesaler.UserID, wholesaler.CreatedBy
+	for _, b := range wholesaler.Branches {
+		if b.ID == branchID {
+			target.EntityName = b.Name
+			break
+		}
+	}
+	return target, nil
+}
+
+func serviceProviderTarget(serviceProvider models.ServiceProvider) *SubscriptionTarget {
+	return &SubscriptionTarget{
+		Kind:        SubscriptionKindServiceProvider,
+		EntityID:    serviceProvider.ID,
+		EntityName:  serviceProvider.BusinessName,
+		OwnerID:     serviceProvider.ID,
+		OwnerName:   serviceProvider.BusinessName,
+		OwnerUserID: serviceProvider.UserID,
+		CreatedBy:   serviceProvider.CreatedBy,
+	}
+}
+
+// LatestSubscription returns the most recent subscription of the target, whatever its status
+func (s *SubscriptionService) LatestSubscription(ctx context.Context, target *SubscriptionTarget) (*SubscriptionRecord, error) {
+	cfg, err := s.kindConfig(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var record SubscriptionRecord
+	err = s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx,
+		bson.M{cfg.EntityField: target.EntityID},
+		options.FindOne().SetSort(bson.D{{Key: "endDate", Value: -1}}),
+	).Decode(&record)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Pause freezes the remaining time of an active subscription
+func (s *SubscriptionService) Pause(ctx context.Context, target *SubscriptionTarget) (*SubscriptionRecord, error) {
+	cfg, err := s.kindConfig(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	status := record.Status
+	if status == models.SubscriptionStatusActive && !record.EndDate.After(now) {
+		// The lifecycle job has not caught up yet; treat it as expired
+		status = models.SubscriptionStatusExpired
+	}
+	nextStatus, err := models.NextSubscriptionStatus(status, models.SubscriptionActionPause)
+	if err != nil {
+		return nil, err
+	}
+
+	remainingDays := int(math.Ceil(record.EndDate.Sub(now).Hours() / 24))
+	result, err := s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+		bson.M{"_id": record.ID, "status": record.Status},
+		bson.M{"$set": bson.M{
+			"status":        nextStatus,
+			"pausedAt":      now,
+			"remainingDays": remainingDays,
+			"updatedAt":     now,
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == 0 {
+		return nil, ErrSubscriptionConcurrentUpdate
+	}
+
+	if err := s.setEntityStatus(ctx, target, "inactive"); err != nil {
+		log.Printf("Failed to deactivate %s %s after pausing subscription: %v", target.Kind, target.EntityID.Hex(), err)
+	}
+
+	record.Status = nextStatus
+	record.PausedAt = &now
+	record.RemainingDays = remainingDays
+	return record, nil
+}
+
+// Resume reactivates a paused subscription and pushes its end date forward by the time spent paused
+func (s *SubscriptionService) Resume(ctx context.Context, target *SubscriptionTarget) (*SubscriptionRecord, error) {
+	cfg, err := s.kindConfig(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	nextStatus, err := models.NextSubscriptionStatus(record.Status, models.SubscriptionActionResume)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	endDate := record.EndDate
+	if record.PausedAt != nil {
+		endDate = endDate.Add(now.Sub(*record.PausedAt))
+	}
+
+	result, err := s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+		bson.M{"_id": record.ID, "status": record.Status},
+		bson.M{
+			"$set": bson.M{
+				"status":    nextStatus,
+				"endDate":   endDate,
+				"updatedAt": now,
+			},
+			"$unset": bson.M{"pausedAt": "", "remainingDays": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == 0 {
+		return nil, ErrSubscriptionConcurrentUpdate
+	}
+
+	if err := s.setEntityStatus(ctx, target, "active"); err != nil {
+		log.Printf("Failed to reactivate %s %s after resuming subscription: %v", target.Kind, target.EntityID.Hex(), err)
+	}
+
+	record.Status = nextStatus
+	record.EndDate = endDate
+	record.PausedAt = nil
+	record.RemainingDays = 0
+	return record, nil
+}
+
+// Renew creates a new subscription request for the plan of an expired subscription
+func (s *SubscriptionService) Renew(ctx context.Context, target *SubscriptionTarget, paymentMethod string) (*PaymentRequestResult, error) {
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	status := record.Status
+	if status == models.SubscriptionStatusActive && !record.EndDate.After(time.Now()) {
+		status = models.SubscriptionStatusExpired
+	}
+	if _, err := models.NextSubscriptionStatus(status, models.SubscriptionActionRenew); err != nil {
+		return nil, err
+	}
+
+	if paymentMethod == "" {
+		paymentMethod = record.PaymentMethod
+	}
+
+	var plan models.SubscriptionPlan
+	err = s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": record.PlanID, "isActive": true}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionPlanUnavailable
+		}
+		return nil, err
+	}
+
+	return s.CreatePaymentRequest(ctx, target, plan, paymentMethod, &record.ID)
+}
+
+// Cancel cancels the current active or paused subscription and refunds its unused days.
+// The returned refund is nil when nothing was left to refund.
+func (s *SubscriptionService) Cancel(ctx context.Context, target *SubscriptionTarget, requestedBy primitive.ObjectID) (*SubscriptionRecord, *models.Refund, error) {
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := record.Status
+	if status == models.SubscriptionStatusActive && !record.EndDate.After(time.Now()) {
+		status = models.SubscriptionStatusExpired
+	}
+	nextStatus, err := models.NextSubscriptionStatus(status, models.SubscriptionActionCancel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refund, err := NewRefundService(s.DB).CancelAndRefund(ctx, target, record, requestedBy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record.Status = nextStatus
+	record.AutoRenew = false
+	return record, refund, nil
+}
+
+// SetAutoRenew turns automatic renewal on or off for the current active or paused subscription
+func (s *SubscriptionService) SetAutoRenew(ctx context.Context, target *SubscriptionTarget, autoRenew bool) (*SubscriptionRecord, error) {
+	cfg, err := s.kindConfig(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != models.SubscriptionStatusActive && record.Status != models.SubscriptionStatusPaused {
+		return nil, &models.SubscriptionTransitionError{Action: models.SubscriptionActionSetAutoRenew, Status: record.Status}
+	}
+
+	_, err = s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+		bson.M{"_id": record.ID},
+		bson.M{"$set": bson.M{"autoRenew": autoRenew, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	record.AutoRenew = autoRenew
+	return record, nil
+}
+
+// RenewalPeriod returns when a subscription bought through a request should start and whether it keeps auto-renew.
+// Renewals start when the renewed subscription ends so paying early never loses days.
+func (s *SubscriptionService) RenewalPeriod(ctx context.Context, kind string, renewalOf *primitive.ObjectID) (time.Time, bool) {
+	now := time.Now()
+	if renewalOf == nil {
+		return now, false
+	}
+
+	cfg, err := s.kindConfig(kind)
+	if err != nil {
+		return now, false
+	}
+
+	var previous SubscriptionRecord
+	if err := s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx, bson.M{"_id": *renewalOf}).Decode(&previous); err != nil {
+		log.Printf("Failed to load renewed subscription %s: %v", renewalOf.Hex(), err)
+		return now, false
+	}
+
+	if previous.Status == models.SubscriptionStatusActive && previous.EndDate.After(now) {
+		return previous.EndDate, previous.AutoRenew
+	}
+	return now, previous.AutoRenew
+}
+
+// CreatePaymentRequest creates a subscription request for the target through the Whish or cash flow.
+// Whish requests use the same callbacks as first-time purchases so activation follows the existing path.
+// renewalOf links the request to the subscription it renews, if any.
+func (s *SubscriptionService) CreatePaymentRequest(ctx context.Context, target *SubscriptionTarget, plan models.SubscriptionPlan, paymentMethod string, renewalOf *primitive.ObjectID) (*PaymentRequestResult, error) {
+	return s.createRequest(ctx, target, plan, paymentMethod, renewalOf, nil)
+}
+
+// planChange describes the running subscription a request moves to another plan and what is left to pay
+type planChange struct {
+	Of     primitive.ObjectID
+	Amount float64 // Amount due; nothing is collected when it is zero
+	Credit float64
+}
+
+func (s *SubscriptionService) createRequest(ctx context.Context, target *SubscriptionTarget, plan models.SubscriptionPlan, paymentMethod string, renewalOf *primitive.ObjectID, change *planChange) (*PaymentRequestResult, error) {
+	cfg, err := s.kindConfig(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if paymentMethod != "whish" && paymentMethod != "cash" {
+		return nil, ErrInvalidPaymentMethod
+	}
+
+	requestsCollection := s.DB.Collection(cfg.RequestCollection)
+
+	// Plans set in LBP are charged in USD at the rate of the moment of the request
+	conversion, err := NewExchangeRateService(s.DB).Lock(ctx, plan.Price, plan.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID := primitive.NewObjectID()
+	now := time.Now()
+	result := &PaymentRequestResult{
+		RequestID:     requestID,
+		Plan:          plan,
+		PaymentMethod: paymentMethod,
+		PaymentAmount: conversion.AmountUSD,
+		Price:         conversion,
+		SubmittedAt:   now,
+	}
+
+	var planChangeOf *primitive.ObjectID
+	var amountDue, credit float64
+	if conversion.OriginalCurrency != models.CurrencyUSD {
+		amountDue = conversion.AmountUSD
+	}
+	if change != nil {
+		planChangeOf = &change.Of
+		amountDue = change.Amount
+		credit = change.Credit
+		result.PaymentAmount = change.Amount
+	}
+
+	paymentStatus := "cash_pending"
+	result.Status = "pending"
+	if change != nil && change.Amount <= 0 {
+		// Nothing to collect: the plan is switched right away by the caller
+		result.Status = "approved"
+		paymentStatus = "not_required"
+	} else if paymentMethod == "whish" {
+		result.Status = "pending_payment"
+		paymentStatus = "pending"
+		result.ExternalID, err = NextWhishExternalID(ctx, s.DB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var document interface{}
+	switch target.Kind {
+	case SubscriptionKindCompanyBranch:
+		document = models.BranchSubscriptionRequest{
+			ID:            requestID,
+			BranchID:      target.EntityID,
+			PlanID:        plan.ID,
+			Status:        result.Status,
+			RequestedAt:   now,
+			PaymentMethod: paymentMethod,
+			ExternalID:    result.ExternalID,
+			PaymentStatus: paymentStatus,
+			RenewalOf:     renewalOf,
+			PlanChangeOf:  planChangeOf,
+			Amount:        amountDue,
+			Credit:        credit,
+
+			CurrencyConversion: conversion,
+		}
+	case SubscriptionKindWholesalerBranch:
+		document = models.WholesalerBranchSubscriptionRequest{
+			ID:            requestID,
+			BranchID:      target.EntityID,
+			PlanID:        plan.ID,
+			Status:        result.Status,
+			RequestedAt:   now,
+			PaymentMethod: paymentMethod,
+			ExternalID:    result.ExternalID,
+			PaymentStatus: paymentStatus,
+			RenewalOf:     renewalOf,
+			PlanChangeOf:  planChangeOf,
+			Amount:        amountDue,
+			Credit:        credit,
+
+			CurrencyConversion: conversion,
+		}
+	case SubscriptionKindServiceProvider:
+		document = models.SubscriptionRequest{
+			ID:                requestID,
+			ServiceProviderID: target.EntityID,
+			PlanID:            plan.ID,
+			Status:            result.Status,
+			RequestedAt:       now,
+			PaymentMethod:     paymentMethod,
+			ExternalID:        result.ExternalID,
+			PaymentStatus:     paymentStatus,
+			RenewalOf:         renewalOf,
+			PlanChangeOf:      planChangeOf,
+			Amount:            amountDue,
+			Credit:            credit,
+
+			CurrencyConversion: conversion,
+		}
+	}
+
+	// The request is stored before Whish is asked for a collect link; the unique pending request index
+	// turns a concurrent second request away before it can create a payment
+	if _, err := requestsCollection.InsertOne(ctx, document); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrPendingSubscriptionRequest
+		}
+		return nil, fmt.Errorf("failed to create subscription request: %w", err)
+	}
+
+	if result.Status == "pending_payment" {
+		collectURL, err := s.postWhishPayment(cfg, target, plan, result)
+		if err != nil {
+			// Free the pending slot so the owner can try again
+			_, failErr := requestsCollection.UpdateOne(ctx,
+				bson.M{"_id": requestID, "status": "pending_payment"},
+				bson.M{"$set": bson.M{"status": "failed", "paymentStatus": "failed", "updatedAt": time.Now()}},
+			)
+			if failErr != nil {
+				log.Printf("Failed to mark subscription request %s failed: %v", requestID.Hex(), failErr)
+			}
+			return nil, fmt.Errorf("failed to initiate payment: %w", err)
+		}
+		result.CollectURL = collectURL
+		_, err = requestsCollection.UpdateOne(ctx, bson.M{"_id": requestID}, bson.M{"$set": bson.M{"collectUrl": collectURL}})
+		if err != nil {
+			log.Printf("Failed to store the collect URL of subscription request %s: %v", requestID.Hex(), err)
+		}
+	}
+
+	log.Printf("Subscription request %s created for %s %s (plan %s, %s)", requestID.Hex(), target.Kind, target.EntityID.Hex(), plan.Title, paymentMethod)
+	return result, nil
+}
+
+// postWhishPayment asks Whish for the collect link of a stored subscription request
+func (s *SubscriptionService) postWhishPayment(cfg subscriptionKindConfig, target *SubscriptionTarget, plan models.SubscriptionPlan, result *PaymentRequestResult) (string, error) {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://barrim.online" // Default fallback
+	}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = baseURL // Fallback to baseURL if APP_URL not set
+	}
+
+	amount := result.PaymentAmount
+	externalID := result.ExternalID
+	whishReq := models.WhishRequest{
+		Amount:             &amount,
+		Currency:           "USD", // Use USD for subscription payments
+		Invoice:            fmt.Sprintf("%s - %s - Plan: %s", cfg.InvoiceLabel, target.EntityName, plan.Title),
+		ExternalID:         &externalID,
+		SuccessCallbackURL: fmt.Sprintf("%s%s/success", baseURL, cfg.CallbackPath),
+		FailureCallbackURL: fmt.Sprintf("%s%s/failure", baseURL, cfg.CallbackPath),
+		SuccessRedirectURL: fmt.Sprintf("%s/payment-success?requestId=%s", appURL, result.RequestID.Hex()),
+		FailureRedirectURL: fmt.Sprintf("%s/payment-failed?requestId=%s", appURL, result.RequestID.Hex()),
+	}
+
+	return NewPaymentGateway().PostPayment(whishReq)
+}
+
+// PlanChangeQuote is the prorated cost of moving a subscription to another plan
+type PlanChangeQuote struct {
+	CurrentPlanID primitive.ObjectID `json:"currentPlanId"`
+	NewPlanID     primitive.ObjectID `json:"newPlanId"`
+	Timing        string             `json:"timing"`
+	TotalDays     int                `json:"totalDays"`
+	UnusedDays    int                `json:"unusedDays"`
+	Credit        float64            `json:"credit"` // Unused value of the current subscription
+	NewPlanPrice  float64            `json:"newPlanPrice"`
+	AmountDue     float64            `json:"amountDue"`
+	RefundAmount  float64            `json:"refundAmount"`
+	EffectiveAt   time.Time          `json:"effectiveAt"`
+}
+
+// PlanChangeResult describes a plan change: the payment request when something is due,
+// or the new subscription and refund when the plan was switched right away
+type PlanChangeResult struct {
+	Quote        PlanChangeQuote       `json:"quote"`
+	Request      *PaymentRequestResult `json:"request,omitempty"`
+	Subscription *SubscriptionRecord   `json:"subscription,omitempty"`
+	Refund       *models.Refund        `json:"refund,omitempty"`
+}
+
+// planChangeRequest holds the fields of a subscription request that moves a running subscription to another plan
+type planChangeRequest struct {
+	ID                primitive.ObjectID  `bson:"_id"`
+	BranchID          primitive.ObjectID  `bson:"branchId,omitempty"`
+	ServiceProviderID primitive.ObjectID  `bson:"serviceProviderId,omitempty"`
+	PlanID            primitive.ObjectID  `bson:"planId"`
+	PaymentMethod     string              `bson:"paymentMethod"`
+	PlanChangeOf      *primitive.ObjectID `bson:"planChangeOf"`
+	Amount            float64             `bson:"amount"`
+	ExternalID        int64               `bson:"externalId,omitempty"`
+
+	models.CurrencyConversion `bson:",inline"`
+}
+
+// ChangePlan moves the current active subscription to another plan.
+// Immediate changes credit the unused days of the current plan: a positive difference is collected through
+// the Whish or cash request flow and the plan switches once it is paid, while a negative difference is refunded
+// and the plan switches right away. Period-end changes request the new plan as a renewal of the current one.
+func (s *SubscriptionService) ChangePlan(ctx context.Context, target *SubscriptionTarget, planID primitive.ObjectID, paymentMethod, timing string, requestedBy primitive.ObjectID) (*PlanChangeResult, error) {
+	if timing == "" {
+		timing = PlanChangeImmediate
+	}
+	if timing != PlanChangeImmediate && timing != PlanChangePeriodEnd {
+		return nil, ErrInvalidPlanChangeTiming
+	}
+
+	record, err := s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	status := record.Status
+	if status == models.SubscriptionStatusActive && !record.EndDate.After(now) {
+		status = models.SubscriptionStatusExpired
+	}
+	if _, err := models.NextSubscriptionStatus(status, models.SubscriptionActionChangePlan); err != nil {
+		return nil, err
+	}
+	if record.Trial {
+		return nil, ErrTrialPlanChange
+	}
+	if record.PlanID == planID {
+		return nil, ErrSamePlan
+	}
+
+	var newPlan models.SubscriptionPlan
+	err = s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": planID, "isActive": true}).Decode(&newPlan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionPlanUnavailable
+		}
+		return nil, err
+	}
+	var currentPlan models.SubscriptionPlan
+	if err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": record.PlanID}).Decode(&currentPlan); err != nil {
+		return nil, fmt.Errorf("failed to get current plan details: %w", err)
+	}
+	if paymentMethod == "" {
+		paymentMethod = record.PaymentMethod
+	}
+
+	// Plans set in different currencies are compared in USD at the current rate
+	rate, err := NewExchangeRateService(s.DB).Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quote := QuotePlanChange(record, planInUSD(currentPlan, rate), planInUSD(newPlan, rate), timing, now)
+	result := &PlanChangeResult{Quote: quote}
+
+	if timing == PlanChangePeriodEnd {
+		request, err := s.CreatePaymentRequest(ctx, target, newPlan, paymentMethod, &record.ID)
+		if err != nil {
+			return nil, err
+		}
+		cfg, _ := s.kindConfig(target.Kind)
+		_, err = s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(ctx,
+			bson.M{"_id": record.ID},
+			bson.M{"$set": bson.M{"renewalRequestId": request.RequestID, "updatedAt": now}},
+		)
+		if err != nil {
+			log.Printf("Failed to link plan change request %s to subscription %s: %v", request.RequestID.Hex(), record.ID.Hex(), err)
+		}
+		result.Request = request
+		return result, nil
+	}
+
+	change := &planChange{Of: record.ID, Amount: quote.AmountDue, Credit: quote.Credit}
+	request, err := s.createRequest(ctx, target, newPlan, paymentMethod, nil, change)
+	if err != nil {
+		return nil, err
+	}
+	if quote.AmountDue > 0 {
+		result.Request = request
+		return result, nil
+	}
+
+	// The credit covers the new plan: refund what is left over and switch now
+	refund, err := NewRefundService(s.DB).RefundPlanCredit(ctx, target, record, quote.RefundAmount, requestedBy, func(sessCtx mongo.SessionContext) error {
+		return s.ApplyPlanChange(sessCtx, target.Kind, request.RequestID)
+	})
+	if err != nil {
+		cfg, _ := s.kindConfig(target.Kind)
+		if _, delErr := s.DB.Collection(cfg.RequestCollection).DeleteOne(ctx, bson.M{"_id": request.RequestID}); delErr != nil {
+			log.Printf("Failed to remove plan change request %s: %v", request.RequestID.Hex(), delErr)
+		}
+		return nil, err
+	}
+	result.Refund = refund
+	result.Subscription, err = s.LatestSubscription(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// planInUSD returns plan with its price converted to USD at rate
+func planInUSD(plan models.SubscriptionPlan, rate models.ExchangeRate) models.SubscriptionPlan {
+	plan.Price = rate.Convert(plan.Price, plan.Currency).AmountUSD
+	plan.Currency = models.CurrencyUSD
+	return plan
+}
+
+// QuotePlanChange computes the credit for the unused days of the current plan and what is due for the new one.
+// Both plans must be priced in the same currency.
+func QuotePlanChange(record *SubscriptionRecord, currentPlan, newPlan models.SubscriptionPlan, timing string, now time.Time) PlanChangeQuote {
+	quote := PlanChangeQuote{
+		CurrentPlanID: record.PlanID,
+		NewPlanID:     newPlan.ID,
+		Timing:        timing,
+		NewPlanPrice:  newPlan.Price,
+		AmountDue:     newPlan.Price,
+		EffectiveAt:   record.EndDate,
+	}
+	if timing == PlanChangePeriodEnd {
+		return quote
+	}
+
+	quote.EffectiveAt = now
+	total := record.EndDate.Sub(record.StartDate)
+	unused := record.EndDate.Sub(now)
+	if now.Before(record.StartDate) {
+		unused = total
+	}
+	if total > 0 && unused > 0 {
+		quote.TotalDays = int(math.Round(total.Hours() / 24))
+		quote.UnusedDays = int(math.Ceil(unused.Hours() / 24))
+		quote.Credit = math.Round(currentPlan.Price*unused.Hours()/total.Hours()*100) / 100
+	}
+
+	difference := math.Round((newPlan.Price-quote.Credit)*100) / 100
+	if difference > 0 {
+		quote.AmountDue = difference
+	} else {
+		quote.AmountDue = 0
+		quote.RefundAmount = -difference
+	}
+	return quote
+}
+
+// ApplyPlanChange switches the subscription a plan change request was made for to the requested plan.
+// The new plan starts now for its full duration; commissions are only earned on the amount paid for the change.
+func (s *SubscriptionService) ApplyPlanChange(ctx context.Context, kind string, requestID primitive.ObjectID) error {
+	cfg, err := s.kindConfig(kind)
+	if err != nil {
+		return err
+	}
+
+	var request planChangeRequest
+	if err := s.DB.Collection(cfg.RequestCollection).FindOne(ctx, bson.M{"_id": requestID}).Decode(&request); err != nil {
+		return fmt.Errorf("failed to get plan change request: %w", err)
+	}
+	if request.PlanChangeOf == nil {
+		return fmt.Errorf("request %s is not a plan change", requestID.Hex())
+	}
+	entityID := request.BranchID
+	if kind == SubscriptionKindServiceProvider {
+		entityID = request.ServiceProviderID
+	}
+
+	var plan models.SubscriptionPlan
+	if err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": request.PlanID}).Decode(&plan); err != nil {
+		return fmt.Errorf("failed to get plan details: %w", err)
+	}
+	now := time.Now()
+	endDate, err := planEndDate(now, plan.Duration)
+	if err != nil {
+		return err
+	}
+
+	planPrice := plan.Price
+	if request.AmountUSD > 0 {
+		planPrice = request.AmountUSD
+	}
+
+	err = ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		var previous SubscriptionRecord
+		if err := s.DB.Collection(cfg.SubscriptionCollection).FindOne(sessCtx, bson.M{"_id": *request.PlanChangeOf}).Decode(&previous); err != nil {
+			return fmt.Errorf("failed to get replaced subscription: %w", err)
+		}
+
+		newID := primitive.NewObjectID()
+		replaced, err := s.DB.Collection(cfg.SubscriptionCollection).UpdateOne(sessCtx,
+			bson.M{"_id": previous.ID, "status": bson.M{"$in": []string{models.SubscriptionStatusActive, models.SubscriptionStatusPaused}}},
+			bson.M{"$set": bson.M{
+				"status":      models.SubscriptionStatusCancelled,
+				"autoRenew":   false,
+				"replacedBy":  newID,
+				"cancelledAt": now,
+				"updatedAt":   now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if replaced.MatchedCount == 0 {
+			// Cancelled, expired or already replaced since the request was made
+			return ErrPlanChangeSubscriptionEnded
+		}
+
+		_, err = s.DB.Collection(cfg.SubscriptionCollection).InsertOne(sessCtx, bson.M{
+			"_id":           newID,
+			cfg.EntityField: entityID,
+			"planId":        plan.ID,
+			"startDate":     now,
+			"endDate":       endDate,
+			"status":        models.SubscriptionStatusActive,
+			"autoRenew":     previous.AutoRenew,
+			"paymentMethod": request.PaymentMethod,
+			"planChangeOf":  previous.ID,
+			"carriedCredit": math.Max(math.Round((planPrice-request.Amount)*100)/100, 0),
+			"createdAt":     now,
+			"updatedAt":     now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+
+		lockedCtx := WithLockedRate(sessCtx, request.CurrencyConversion)
+		if err := s.bookPlanChange(lockedCtx, kind, entityID, plan, newID, request.Amount); err != nil {
+			return err
+		}
+		if _, err := NewInvoiceService(s.DB).IssueForSubscription(lockedCtx, kind, newID, request.Amount, request.ExternalID); err != nil {
+			return err
+		}
+
+		set := bson.M{"status": "active", "processedAt": now}
+		if request.Amount > 0 {
+			set["paymentStatus"] = "success"
+			set["paidAt"] = now
+		}
+		_, err = s.DB.Collection(cfg.RequestCollection).UpdateOne(sessCtx, bson.M{"_id": request.ID}, bson.M{"$set": set})
+		return err
+	})
+	if errors.Is(err, ErrPlanChangeSubscriptionEnded) && request.PaymentMethod == "whish" && request.Amount > 0 {
+		s.holdPlanChangePayment(kind, cfg.RequestCollection, &request)
+	}
+	if err != nil {
+		return err
+	}
+
+	if target, err := s.TargetForEntity(ctx, kind, entityID); err == nil {
+		if err := s.setEntityStatus(ctx, target, "active"); err != nil {
+			log.Printf("Failed to activate %s %s after plan change: %v", kind, entityID.Hex(), err)
+		}
+	}
+	log.Printf("Plan of %s %s changed to %s (paid $%.2f)", kind, entityID.Hex(), plan.Title, request.Amount)
+	return nil
+}
+
+// holdPlanChangePayment closes a Whish plan change request whose subscription ended before the payment arrived
+// and records the payment as an anomaly for admins to refund. It writes outside the caller's transaction,
+// which is rolled back.
+func (s *SubscriptionService) holdPlanChangePayment(kind, requestCollection string, request *planChangeRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.DB.Collection(requestCollection).UpdateOne(ctx,
+		bson.M{"_id": request.ID, "paymentStatus": "pending"},
+		bson.M{"$set": bson.M{"status": "failed", "paymentStatus": "review", "processedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to close plan change request %s: %v", request.ID.Hex(), err)
+	}
+	NewWhishCallbackService(s.DB).RecordAnomaly(ctx, WhishCallback{
+		Kind:       kind,
+		ExternalID: request.ExternalID,
+		RequestID:  request.ID,
+		PlanID:     request.PlanID,
+		Amount:     request.Amount,
+	}, AnomalyPlanChangeSubscriptionEnded, request.Amount, request.Amount, "")
+}
+
+// RejectPlanChange closes a cash plan change request refused by an admin; the current subscription is kept
+func (s *SubscriptionService) RejectPlanChange(ctx context.Context, kind string, requestID primitive.ObjectID) error {
+	cfg, err := s.kindConfig(kind)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Collection(cfg.RequestCollection).UpdateOne(ctx,
+		bson.M{"_id": requestID, "status": "pending"},
+		bson.M{"$set": bson.M{"status": "rejected", "processedAt": time.Now()}},
+	)
+	return err
+}
+
+// bookPlanChange shares the amount paid for a plan change between the platform and the salespersons and
+// sales managers under the commission rules, as a renewal of the business
+func (s *SubscriptionService) bookPlanChange(ctx context.Context, kind string, entityID primitive.ObjectID, plan models.SubscriptionPlan, subscriptionID primitive.ObjectID, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	commissions := NewCommissionService(s.DB)
+	sale, err := commissions.SaleFor(ctx, kind, entityID, plan, subscriptionID, amount)
+	if err != nil {
+		return err
+	}
+	sale.PlanChange = true
+	_, err = commissions.Distribute(ctx, sale)
+	return err
+}
+
+// planEndDate returns when a subscription starting at start ends for a plan duration in months
+func planEndDate(start time.Time, duration int) (time.Time, error) {
+	switch duration {
+	case 1, 3, 6, 12:
+		return start.AddDate(0, duration, 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid plan duration")
+	}
+}
+
+// setEntityStatus updates the visibility status of the subscribed branch or service provider
+func (s *SubscriptionService) setEntityStatus(ctx context.Context, target *SubscriptionTarget, status string) error {
+	now := time.Now()
+	switch target.Kind {
+	case SubscriptionKindCompanyBranch, SubscriptionKindWholesalerBranch:
+		collectionName := "companies"
+		if target.Kind == SubscriptionKindWholesalerBranch {
+			collectionName = "wholesalers"
+		}
+		_, err := s.DB.Collection(collectionName).UpdateOne(ctx,
+			bson.M{"_id": target.OwnerID, "branches._id": target.EntityID},
+			bson.M{"$set": bson.M{
+				"branches.$.status":    status,
+				"branches.$.updatedAt": now,
+			}},
+		)
+		return err
+
+	case SubscriptionKindServiceProvider:
+		_, err := s.DB.Collection("serviceProviders").UpdateOne(ctx,
+			bson.M{"_id": target.EntityID},
+			bson.M{"$set": bson.M{"status": status, "updatedAt": now}},
+		)
+		return err
+
+	default:
+		return ErrInvalidSubscriptionKind
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+func TestQuotePlanChange(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := &SubscriptionRecord{StartDate: start, EndDate: start.AddDate(0, 0, 30)}
+	current := models.SubscriptionPlan{Price: 30}
+
+	tests := []struct {
+		name       string
+		newPrice   float64
+		timing     string
+		now        time.Time
+		unusedDays int
+		credit     float64
+		amountDue  float64
+		refund     float64
+	}{
+		{name: "upgrade halfway", newPrice: 60, timing: PlanChangeImmediate, now: start.AddDate(0, 0, 15), unusedDays: 15, credit: 15, amountDue: 45},
+		{name: "downgrade halfway refunds the difference", newPrice: 10, timing: PlanChangeImmediate, now: start.AddDate(0, 0, 15), unusedDays: 15, credit: 15, refund: 5},
+		{name: "same price as the credit", newPrice: 15, timing: PlanChangeImmediate, now: start.AddDate(0, 0, 15), unusedDays: 15, credit: 15},
+		{name: "partial day counts as unused", newPrice: 60, timing: PlanChangeImmediate, now: start.AddDate(0, 0, 20).Add(12 * time.Hour), unusedDays: 10, credit: 9.5, amountDue: 50.5},
+		{name: "not started yet credits everything", newPrice: 60, timing: PlanChangeImmediate, now: start.AddDate(0, 0, -3), unusedDays: 30, credit: 30, amountDue: 30},
+		{name: "ended subscription has no credit", newPrice: 60, timing: PlanChangeImmediate, now: start.AddDate(0, 0, 31), amountDue: 60},
+		{name: "period end pays the full price", newPrice: 60, timing: PlanChangePeriodEnd, now: start.AddDate(0, 0, 15), amountDue: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote := QuotePlanChange(record, current, models.SubscriptionPlan{Price: tt.newPrice}, tt.timing, tt.now)
+			if quote.UnusedDays != tt.unusedDays {
+				t.Errorf("UnusedDays = %d, want %d", quote.UnusedDays, tt.unusedDays)
+			}
+			if quote.Credit != tt.credit {
+				t.Errorf("Credit = %v, want %v", quote.Credit, tt.credit)
+			}
+			if quote.AmountDue != tt.amountDue {
+				t.Errorf("AmountDue = %v, want %v", quote.AmountDue, tt.amountDue)
+			}
+			if quote.RefundAmount != tt.refund {
+				t.Errorf("RefundAmount = %v, want %v", quote.RefundAmount, tt.refund)
+			}
+
+			wantEffective := tt.now
+			if tt.timing == PlanChangePeriodEnd {
+				wantEffective = record.EndDate
+			}
+			if !quote.EffectiveAt.Equal(wantEffective) {
+				t.Errorf("EffectiveAt = %v, want %v", quote.EffectiveAt, wantEffective)
+			}
+		})
+	}
+}
@@ -0,0 +1,572 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by the territory service
+var (
+	ErrTerritoryNotFound     = errors.New("territory not found")
+	ErrTerritoryEmpty        = errors.New("a territory needs at least one governorate, district or polygon")
+	ErrUnknownGovernorate    = errors.New("unknown Lebanese governorate")
+	ErrUnknownDistrict       = errors.New("unknown Lebanese district")
+	ErrTerritorySalesperson  = errors.New("salesperson not found")
+	ErrOutsideTerritory      = errors.New("the business is outside your territory")
+	ErrTerritoryPolygonShape = errors.New("each polygon needs at least three points")
+)
+
+// TerritoryService defines the territories of salespersons, checks the businesses they create against them,
+// routes businesses that sign up by themselves to the salesperson of their territory and reports coverage
+type TerritoryService struct {
+	DB *mongo.Database
+}
+
+// NewTerritoryService creates a new territory service
+func NewTerritoryService(db *mongo.Database) *TerritoryService {
+	return &TerritoryService{DB: db}
+}
+
+// TerritoryEnforcement returns what happens to businesses created outside a salesperson's territories,
+// from TERRITORY_ENFORCEMENT ("off", "flag" or "block"; defaults to "flag")
+func TerritoryEnforcement() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("TERRITORY_ENFORCEMENT"))); mode {
+	case models.TerritoryEnforcementOff, models.TerritoryEnforcementBlock:
+		return mode
+	default:
+		return models.TerritoryEnforcementFlag
+	}
+}
+
+// apply validates a territory request and copies it onto the territory with canonical place names
+func (s *TerritoryService) apply(ctx context.Context, territory *models.Territory, req models.TerritoryRequest) error {
+	governorates := []string{}
+	for _, name := range req.Governorates {
+		governorate := utils.NormalizeGovernorate(name)
+		if governorate == "" {
+			return fmt.Errorf("%w: %s", ErrUnknownGovernorate, name)
+		}
+		governorates = appendUnique(governorates, governorate)
+	}
+	districts := []string{}
+	for _, name := range req.Districts {
+		district := utils.NormalizeDistrict(name)
+		if district == "" {
+			return fmt.Errorf("%w: %s", ErrUnknownDistrict, name)
+		}
+		districts = appendUnique(districts, district)
+	}
+	for _, polygon := range req.Polygons {
+		if len(polygon) < 3 {
+			return ErrTerritoryPolygonShape
+		}
+	}
+	if len(governorates) == 0 && len(districts) == 0 && len(req.Polygons) == 0 {
+		return ErrTerritoryEmpty
+	}
+
+	territory.SalespersonID = nil
+	if req.SalespersonID != "" {
+		salespersonID, err := primitive.ObjectIDFromHex(req.SalespersonID)
+		if err != nil {
+			return ErrTerritorySalesperson
+		}
+		count, err := s.DB.Collection("salespersons").CountDocuments(ctx, bson.M{"_id": salespersonID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrTerritorySalesperson
+		}
+		territory.SalespersonID = &salespersonID
+	}
+
+	territory.Name = strings.TrimSpace(req.Name)
+	territory.Governorates = governorates
+	territory.Districts = districts
+	territory.Polygons = req.Polygons
+	territory.Active = req.Active == nil || *req.Active
+	return nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// Create stores a new territory
+func (s *TerritoryService) Create(ctx context.Context, req models.TerritoryRequest, adminID primitive.ObjectID) (*models.Territory, error) {
+	now := time.Now()
+	territory := &models.Territory{
+		ID:        primitive.NewObjectID(),
+		CreatedBy: adminID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.apply(ctx, territory, req); err != nil {
+		return nil, err
+	}
+	if _, err := s.DB.Collection("territories").InsertOne(ctx, territory); err != nil {
+		return nil, fmt.Errorf("failed to store territory: %w", err)
+	}
+	return territory, nil
+}
+
+// Get loads a territory
+func (s *TerritoryService) Get(ctx context.Context, id primitive.ObjectID) (*models.Territory, error) {
+	var territory models.Territory
+	if err := s.DB.Collection("territories").FindOne(ctx, bson.M{"_id": id}).Decode(&territory); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTerritoryNotFound
+		}
+		return nil, err
+	}
+	return &territory, nil
+}
+
+// Update replaces the areas, salesperson and status of a territory
+func (s *TerritoryService) Update(ctx context.Context, id primitive.ObjectID, req models.TerritoryRequest) (*models.Territory, error) {
+	territory, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, territory, req); err != nil {
+		return nil, err
+	}
+	territory.UpdatedAt = time.Now()
+	if _, err := s.DB.Collection("territories").ReplaceOne(ctx, bson.M{"_id": territory.ID}, territory); err != nil {
+		return nil, fmt.Errorf("failed to update territory: %w", err)
+	}
+	return territory, nil
+}
+
+// Delete removes a territory
+func (s *TerritoryService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.DB.Collection("territories").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTerritoryNotFound
+	}
+	return nil
+}
+
+// List returns the territories matching the filter by name
+func (s *TerritoryService) List(ctx context.Context, filter bson.M) ([]models.Territory, error) {
+	cursor, err := s.DB.Collection("territories").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	territories := []models.Territory{}
+	if err := cursor.All(ctx, &territories); err != nil {
+		return nil, err
+	}
+	return territories, nil
+}
+
+// territoryMatch scores how precisely an address falls in a territory: 3 inside a polygon, 2 in one of its
+// districts, 1 in one of its governorates and 0 outside
+func territoryMatch(territory models.Territory, address models.Address) int {
+	if address.Lat != 0 || address.Lng != 0 {
+		for _, polygon := range territory.Polygons {
+			vertices := make([][2]float64, 0, len(polygon))
+			for _, point := range polygon {
+				vertices = append(vertices, [2]float64{point.Lat, point.Lng})
+			}
+			if utils.PointInPolygon(address.Lat, address.Lng, vertices) {
+				return 3
+			}
+		}
+	}
+	if district := utils.NormalizeDistrict(address.District); district != "" {
+		for _, candidate := range territory.Districts {
+			if candidate == district {
+				return 2
+			}
+		}
+	}
+	if governorate := utils.NormalizeGovernorate(address.Governorate); governorate != "" {
+		for _, candidate := range territory.Governorates {
+			if candidate == governorate {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// bestTerritory returns the territory matching an address most precisely, or nil
+func bestTerritory(territories []models.Territory, address models.Address) *models.Territory {
+	var best *models.Territory
+	bestScore := 0
+	for i := range territories {
+		if score := territoryMatch(territories[i], address); score > bestScore {
+			best, bestScore = &territories[i], score
+		}
+	}
+	return best
+}
+
+// CheckCreation checks a business a salesperson is about to create against their territories. It reports
+// whether the business is outside them, or fails with ErrOutsideTerritory when enforcement blocks it.
+// Salespersons without an active territory are not restricted.
+func (s *TerritoryService) CheckCreation(ctx context.Context, salespersonID primitive.ObjectID, address models.Address) (bool, error) {
+	mode := TerritoryEnforcement()
+	if mode == models.TerritoryEnforcementOff {
+		return false, nil
+	}
+	territories, err := s.List(ctx, bson.M{"salespersonId": salespersonID, "active": true})
+	if err != nil {
+		return false, err
+	}
+	if len(territories) == 0 || bestTerritory(territories, address) != nil {
+		return false, nil
+	}
+	if mode == models.TerritoryEnforcementBlock {
+		return true, ErrOutsideTerritory
+	}
+	return true, nil
+}
+
+// TerritorySignup is a business that signed up by itself
+type TerritorySignup struct {
+	EntityType   string // "company", "wholesaler", "serviceProvider"
+	EntityID     primitive.ObjectID
+	BusinessName string
+	Category     string
+	ContactName  string
+	Phone        string
+	Email        string
+	Address      models.Address
+}
+
+// RouteSignup hands a business that signed up by itself to the salesperson of its territory as a lead to
+// follow up, and notifies them. Businesses outside every assigned territory are left alone.
+func (s *TerritoryService) RouteSignup(ctx context.Context, signup TerritorySignup) error {
+	territories, err := s.List(ctx, bson.M{"active": true, "salespersonId": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+	territory := bestTerritory(territories, signup.Address)
+	if territory == nil {
+		return nil
+	}
+	count, err := s.DB.Collection("leads").CountDocuments(ctx, bson.M{"entityId": signup.EntityID})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var salesperson models.Salesperson
+	if err := s.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": *territory.SalespersonID}).Decode(&salesperson); err != nil {
+		return fmt.Errorf("failed to load salesperson of territory %s: %w", territory.ID.Hex(), err)
+	}
+	now := time.Now()
+	lead := models.Lead{
+		ID:                 primitive.NewObjectID(),
+		SalespersonID:      salesperson.ID,
+		SalesManagerID:     salesperson.SalesManagerID,
+		BusinessName:       signup.BusinessName,
+		EntityType:         signup.EntityType,
+		Category:           signup.Category,
+		ContactPerson:      signup.ContactName,
+		Phone:              signup.Phone,
+		Email:              signup.Email,
+		Address:            signup.Address,
+		Source:             models.LeadSourceSignup,
+		EntityID:           &signup.EntityID,
+		TerritoryID:        &territory.ID,
+		Stage:              models.LeadStageNew,
+		StageHistory:       []models.LeadStageChange{{To: models.LeadStageNew, Note: "Signed up in " + territory.Name, By: salesperson.ID, At: now}},
+		NextFollowUpAt:     &now,
+		FollowUpNote:       "Welcome the new sign-up",
+		FollowUpNotifiedAt: &now,
+		Visits:             []models.LeadVisit{},
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if _, err := s.DB.Collection("leads").InsertOne(ctx, lead); err != nil {
+		return fmt.Errorf("failed to store sign-up lead: %w", err)
+	}
+
+	if err := utils.SaveNotification(s.DB.Client(), salesperson.ID, "New Sign-up in Your Territory",
+		fmt.Sprintf("%s signed up in %s. Follow up with them.", signup.BusinessName, territory.Name), "territory_signup",
+		map[string]interface{}{"leadId": lead.ID.Hex(), "entityType": signup.EntityType, "entityId": signup.EntityID.Hex()}); err != nil {
+		log.Printf("Failed to notify salesperson %s of sign-up %s: %v", salesperson.ID.Hex(), signup.EntityID.Hex(), err)
+	}
+	return nil
+}
+
+// TerritoryCoverage is the presence of the platform and of the sales team in one territory
+type TerritoryCoverage struct {
+	TerritoryID      *primitive.ObjectID `json:"territoryId,omitempty"` // Empty for businesses outside every territory
+	Name             string              `json:"name"`
+	SalespersonID    *primitive.ObjectID `json:"salespersonId,omitempty"`
+	SalespersonName  string              `json:"salespersonName,omitempty"`
+	Companies        int                 `json:"companies"`
+	Wholesalers      int                 `json:"wholesalers"`
+	ServiceProviders int                 `json:"serviceProviders"`
+	Businesses       int                 `json:"businesses"`
+	Subscribed       int                 `json:"subscribed"`  // Businesses with an active subscription
+	Penetration      float64             `json:"penetration"` // Percentage of the businesses with an active subscription
+	ByOwnSalesperson int                 `json:"byOwnSalesperson"`
+	ByOtherSales     int                 `json:"byOtherSales"` // Created by salespersons outside the territory
+	Organic          int                 `json:"organic"`      // Signed up by themselves
+	OpenLeads        int                 `json:"openLeads"`
+}
+
+// DistrictCoverage lists the territories covering a district by name
+type DistrictCoverage struct {
+	Governorate string   `json:"governorate"`
+	District    string   `json:"district"`
+	Territories []string `json:"territories"`
+}
+
+// CoverageReport is the coverage and penetration of every territory
+type CoverageReport struct {
+	Territories []TerritoryCoverage `json:"territories"`
+	Unassigned  TerritoryCoverage   `json:"unassigned"`
+	Districts   []DistrictCoverage  `json:"districts"`
+	Enforcement string              `json:"enforcement"`
+	GeneratedAt time.Time           `json:"generatedAt"`
+}
+
+// territoryBusiness is a business placed on the map for the coverage report
+type territoryBusiness struct {
+	EntityType string
+	Address    models.Address
+	CreatedBy  primitive.ObjectID
+	Subscribed bool
+}
+
+// Coverage counts the businesses, subscriptions and open leads of each active territory from the governorate,
+// district and coordinates of their address
+func (s *TerritoryService) Coverage(ctx context.Context) (*CoverageReport, error) {
+	territories, err := s.List(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	businesses, err := s.businesses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	salespersonIDs := map[primitive.ObjectID]bool{}
+	ids, err := s.DB.Collection("salespersons").Distinct(ctx, "_id", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			salespersonIDs[oid] = true
+		}
+	}
+
+	report := &CoverageReport{
+		Territories: make([]TerritoryCoverage, len(territories)),
+		Unassigned:  TerritoryCoverage{Name: "Outside every territory"},
+		Enforcement: TerritoryEnforcement(),
+		GeneratedAt: time.Now(),
+	}
+	index := map[primitive.ObjectID]int{}
+	for i, territory := range territories {
+		id := territory.ID
+		report.Territories[i] = TerritoryCoverage{TerritoryID: &id, Name: territory.Name, SalespersonID: territory.SalespersonID}
+		index[territory.ID] = i
+		if territory.SalespersonID != nil {
+			var salesperson models.Salesperson
+			if err := s.DB.Collection("salespersons").FindOne(ctx, bson.M{"_id": *territory.SalespersonID}, options.FindOne().SetProjection(bson.M{"fullName": 1})).Decode(&salesperson); err == nil {
+				report.Territories[i].SalespersonName = salesperson.FullName
+			}
+		}
+	}
+	entry := func(address models.Address) (*TerritoryCoverage, *models.Territory) {
+		if territory := bestTerritory(territories, address); territory != nil {
+			return &report.Territories[index[territory.ID]], territory
+		}
+		return &report.Unassigned, nil
+	}
+
+	for _, business := range businesses {
+		coverage, territory := entry(business.Address)
+		switch business.EntityType {
+		case "company":
+			coverage.Companies++
+		case "wholesaler":
+			coverage.Wholesalers++
+		default:
+			coverage.ServiceProviders++
+		}
+		coverage.Businesses++
+		if business.Subscribed {
+			coverage.Subscribed++
+		}
+		switch {
+		case !salespersonIDs[business.CreatedBy]:
+			coverage.Organic++
+		case territory != nil && territory.SalespersonID != nil && *territory.SalespersonID == business.CreatedBy:
+			coverage.ByOwnSalesperson++
+		default:
+			coverage.ByOtherSales++
+		}
+	}
+
+	cursor, err := s.DB.Collection("leads").Find(ctx,
+		bson.M{"stage": bson.M{"$nin": []string{models.LeadStageWon, models.LeadStageLost}}},
+		options.Find().SetProjection(bson.M{"address": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var leads []models.Lead
+	if err := cursor.All(ctx, &leads); err != nil {
+		return nil, err
+	}
+	for _, lead := range leads {
+		coverage, _ := entry(lead.Address)
+		coverage.OpenLeads++
+	}
+
+	for i := range report.Territories {
+		report.Territories[i].Penetration = penetration(report.Territories[i])
+	}
+	report.Unassigned.Penetration = penetration(report.Unassigned)
+	report.Districts = districtCoverage(territories)
+	return report, nil
+}
+
+func penetration(coverage TerritoryCoverage) float64 {
+	if coverage.Businesses == 0 {
+		return 0
+	}
+	return roundCents(float64(coverage.Subscribed) / float64(coverage.Businesses) * 100)
+}
+
+// districtCoverage lists every Lebanese district with the territories covering it by governorate or district
+func districtCoverage(territories []models.Territory) []DistrictCoverage {
+	governorates := make([]string, 0, len(utils.LebanonDistricts))
+	for governorate := range utils.LebanonDistricts {
+		governorates = append(governorates, governorate)
+	}
+	sort.Strings(governorates)
+
+	coverage := []DistrictCoverage{}
+	for _, governorate := range governorates {
+		for _, district := range utils.LebanonDistricts[governorate] {
+			entry := DistrictCoverage{Governorate: governorate, District: district, Territories: []string{}}
+			for _, territory := range territories {
+				if territoryMatch(territory, models.Address{Governorate: governorate, District: district}) > 0 {
+					entry.Territories = append(entry.Territories, territory.Name)
+				}
+			}
+			coverage = append(coverage, entry)
+		}
+	}
+	return coverage
+}
+
+// businesses loads the address, creator and subscription state of every company, wholesaler and approved
+// service provider
+func (s *TerritoryService) businesses(ctx context.Context) ([]territoryBusiness, error) {
+	active := map[string]map[primitive.ObjectID]bool{}
+	for kind, cfg := range subscriptionKinds {
+		ids, err := s.DB.Collection(cfg.SubscriptionCollection).Distinct(ctx, cfg.EntityField, bson.M{
+			"status":  models.SubscriptionStatusActive,
+			"endDate": bson.M{"$gt": time.Now()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		active[kind] = map[primitive.ObjectID]bool{}
+		for _, id := range ids {
+			if oid, ok := id.(primitive.ObjectID); ok {
+				active[kind][oid] = true
+			}
+		}
+	}
+
+	businesses := []territoryBusiness{}
+	owners := []struct {
+		EntityType string
+		Collection string
+		Kind       string
+	}{
+		{"company", "companies", SubscriptionKindCompanyBranch},
+		{"wholesaler", "wholesalers", SubscriptionKindWholesalerBranch},
+	}
+	for _, owner := range owners {
+		cursor, err := s.DB.Collection(owner.Collection).Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+			"contactInfo.address": 1, "branches._id": 1, "branches.location": 1, "createdBy": 1,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		var docs []struct {
+			ContactInfo models.ContactInfo `bson:"contactInfo"`
+			Branches    []models.Branch    `bson:"branches"`
+			CreatedBy   primitive.ObjectID `bson:"createdBy"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			business := territoryBusiness{EntityType: owner.EntityType, Address: doc.ContactInfo.Address, CreatedBy: doc.CreatedBy}
+			if business.Address.Governorate == "" && business.Address.District == "" && len(doc.Branches) > 0 {
+				business.Address = doc.Branches[0].Location
+			}
+			for _, branch := range doc.Branches {
+				if active[owner.Kind][branch.ID] {
+					business.Subscribed = true
+				}
+			}
+			businesses = append(businesses, business)
+		}
+	}
+
+	cursor, err := s.DB.Collection("serviceProviders").Find(ctx, bson.M{"creationRequest": bson.M{"$ne": "pending"}}, options.Find().SetProjection(bson.M{
+		"contactInfo.address": 1, "governorate": 1, "district": 1, "createdBy": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var serviceProviders []models.ServiceProvider
+	if err := cursor.All(ctx, &serviceProviders); err != nil {
+		return nil, err
+	}
+	for _, serviceProvider := range serviceProviders {
+		address := serviceProvider.ContactInfo.Address
+		if address.Governorate == "" {
+			address.Governorate = serviceProvider.Governorate
+		}
+		if address.District == "" {
+			address.District = serviceProvider.District
+		}
+		businesses = append(businesses, territoryBusiness{
+			EntityType: "serviceProvider",
+			Address:    address,
+			CreatedBy:  serviceProvider.CreatedBy,
+			Subscribed: active[SubscriptionKindServiceProvider][serviceProvider.ID],
+		})
+	}
+	return businesses, nil
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+func TestTerritoryMatch(t *testing.T) {
+	territory := models.Territory{
+		Governorates: []string{"Mount Lebanon"},
+		Districts:    []string{"Matn"},
+		Polygons: [][]models.GeoPoint{
+			{{Lat: 33.86, Lng: 35.48}, {Lat: 33.92, Lng: 35.48}, {Lat: 33.92, Lng: 35.56}, {Lat: 33.86, Lng: 35.56}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		address models.Address
+		score   int
+	}{
+		{"inside the polygon", models.Address{Lat: 33.89, Lng: 35.50, Governorate: "North"}, 3},
+		{"district alias outside the polygon", models.Address{Lat: 34.40, Lng: 35.80, District: "El Metn"}, 2},
+		{"district without coordinates", models.Address{District: "matn"}, 2},
+		{"governorate alias", models.Address{Governorate: "Mont Liban", District: "Chouf"}, 1},
+		{"other governorate", models.Address{Governorate: "South", District: "Tyre"}, 0},
+		{"unknown place", models.Address{Governorate: "Atlantis"}, 0},
+		{"empty address", models.Address{}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := territoryMatch(territory, tt.address); got != tt.score {
+			t.Errorf("%s: territoryMatch = %d, want %d", tt.name, got, tt.score)
+		}
+	}
+}
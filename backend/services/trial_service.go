@@ -0,0 +1,431 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors returned by the trial service
+var (
+	ErrTrialNotOffered  = errors.New("this plan does not offer a free trial")
+	ErrTrialAlreadyUsed = errors.New("this business has already used its free trial")
+	ErrTrialNotFound    = errors.New("no active free trial found")
+)
+
+// trialPlanTypes maps each subscription kind to the SubscriptionPlan type it may be trialled on
+var trialPlanTypes = map[string]string{
+	SubscriptionKindCompanyBranch:    "company",
+	SubscriptionKindWholesalerBranch: "wholesaler",
+	SubscriptionKindServiceProvider:  "serviceProvider",
+}
+
+// Words left out of business names before comparing them, so "Barrim SAL" and "barrim s.a.l." match
+var businessNameSuffixes = map[string]bool{
+	"sal": true, "sarl": true, "llc": true, "ltd": true, "inc": true, "co": true, "company": true, "the": true,
+}
+
+// TrialApplicant identifies the business asking for a trial
+type TrialApplicant struct {
+	BusinessName  string
+	Phones        []string
+	Emails        []string
+	SalespersonID primitive.ObjectID // Salesperson that onboarded the business, if any
+}
+
+// TrialService grants free trials to newly approved businesses and tracks whether they convert
+type TrialService struct {
+	DB *mongo.Database
+}
+
+// NewTrialService creates a new trial service
+func NewTrialService(db *mongo.Database) *TrialService {
+	return &TrialService{DB: db}
+}
+
+// TrialPlan returns the active plan for the subscription kind if it offers a trial
+func (s *TrialService) TrialPlan(ctx context.Context, kind string, planID primitive.ObjectID) (*models.SubscriptionPlan, error) {
+	planType, ok := trialPlanTypes[kind]
+	if !ok {
+		return nil, ErrInvalidSubscriptionKind
+	}
+
+	var plan models.SubscriptionPlan
+	err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": planID, "isActive": true}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionPlanUnavailable
+		}
+		return nil, err
+	}
+	if plan.TrialDays <= 0 || plan.Type != planType {
+		return nil, ErrTrialNotOffered
+	}
+	return &plan, nil
+}
+
+// CheckEligibility returns ErrTrialAlreadyUsed when a trial was already granted to a business
+// sharing a phone number, an email or the business name with the applicant
+func (s *TrialService) CheckEligibility(ctx context.Context, applicant TrialApplicant) error {
+	phones, emails, nameKey := applicant.keys()
+
+	var matches []bson.M
+	if len(phones) > 0 {
+		matches = append(matches, bson.M{"phones": bson.M{"$in": phones}})
+	}
+	if len(emails) > 0 {
+		matches = append(matches, bson.M{"emails": bson.M{"$in": emails}})
+	}
+	if nameKey != "" {
+		matches = append(matches, bson.M{"nameKey": nameKey})
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	count, err := s.DB.Collection("subscription_trials").CountDocuments(ctx, bson.M{"$or": matches})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTrialAlreadyUsed
+	}
+	return nil
+}
+
+// Start grants the applicant a free trial of the plan on the branch or service provider.
+// The trial runs as an active subscription flagged as a trial; nothing is paid and no commission is earned on it.
+// The eligibility check, the claim of the applicant's keys and both inserts run in one transaction.
+func (s *TrialService) Start(ctx context.Context, kind string, entityID, planID primitive.ObjectID, applicant TrialApplicant) (*models.SubscriptionTrial, error) {
+	cfg, err := NewSubscriptionService(s.DB).kindConfig(kind)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.TrialPlan(ctx, kind, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionService := NewSubscriptionService(s.DB)
+	target, err := subscriptionService.TargetForEntity(ctx, kind, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	endDate := now.AddDate(0, 0, plan.TrialDays)
+	subscriptionID := primitive.NewObjectID()
+	phones, emails, nameKey := applicant.keys()
+	trial := &models.SubscriptionTrial{
+		ID:             primitive.NewObjectID(),
+		Kind:           kind,
+		EntityID:       entityID,
+		AccountID:      target.OwnerID,
+		BusinessName:   applicant.BusinessName,
+		SubscriptionID: subscriptionID,
+		PlanID:         plan.ID,
+		SalespersonID:  applicant.SalespersonID,
+		Status:         models.TrialStatusActive,
+		StartDate:      now,
+		EndDate:        endDate,
+		Phones:         phones,
+		Emails:         emails,
+		NameKey:        nameKey,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	err = ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		if err := s.CheckEligibility(sessCtx, applicant); err != nil {
+			return err
+		}
+		if err := s.claimKeys(sessCtx, trial); err != nil {
+			return err
+		}
+
+		_, err := s.DB.Collection(cfg.SubscriptionCollection).InsertOne(sessCtx, bson.M{
+			"_id":           subscriptionID,
+			cfg.EntityField: entityID,
+			"planId":        plan.ID,
+			"startDate":     now,
+			"endDate":       endDate,
+			"status":        models.SubscriptionStatusActive,
+			"autoRenew":     false,
+			"paymentMethod": "trial",
+			"trial":         true,
+			"createdAt":     now,
+			"updatedAt":     now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create trial subscription: %w", err)
+		}
+		if _, err := s.DB.Collection("subscription_trials").InsertOne(sessCtx, trial); err != nil {
+			return fmt.Errorf("failed to record trial: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := subscriptionService.setEntityStatus(ctx, target, "active"); err != nil {
+		log.Printf("Failed to activate %s %s for its trial: %v", kind, entityID.Hex(), err)
+	}
+
+	log.Printf("Started %d-day trial of %s for %s %s", plan.TrialDays, plan.Title, kind, entityID.Hex())
+	return trial, nil
+}
+
+// claimKeys reserves the phone numbers, emails and business name of a trial in trial_keys, whose _id makes
+// each of them unique. A key claimed by a concurrent trial fails the claim, so two applications of the
+// same business can never both pass the eligibility check.
+func (s *TrialService) claimKeys(sessCtx mongo.SessionContext, trial *models.SubscriptionTrial) error {
+	var keys []interface{}
+	for _, phone := range trial.Phones {
+		keys = append(keys, bson.M{"_id": "phone:" + phone, "trialId": trial.ID, "createdAt": trial.CreatedAt})
+	}
+	for _, email := range trial.Emails {
+		keys = append(keys, bson.M{"_id": "email:" + email, "trialId": trial.ID, "createdAt": trial.CreatedAt})
+	}
+	if trial.NameKey != "" {
+		keys = append(keys, bson.M{"_id": "name:" + trial.NameKey, "trialId": trial.ID, "createdAt": trial.CreatedAt})
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := s.DB.Collection("trial_keys").InsertMany(sessCtx, keys)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTrialAlreadyUsed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim trial keys: %w", err)
+	}
+	return nil
+}
+
+// ActiveTrial returns the running trial of the target
+func (s *TrialService) ActiveTrial(ctx context.Context, target *SubscriptionTarget) (*models.SubscriptionTrial, error) {
+	var trial models.SubscriptionTrial
+	err := s.DB.Collection("subscription_trials").FindOne(ctx, bson.M{
+		"kind":     target.Kind,
+		"entityId": target.EntityID,
+		"status":   models.TrialStatusActive,
+	}).Decode(&trial)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTrialNotFound
+		}
+		return nil, err
+	}
+	return &trial, nil
+}
+
+// Convert creates the paid subscription request that follows the trial, on the trialled plan unless planID is set.
+// The request renews the trial subscription so the paid period starts when the trial ends.
+func (s *TrialService) Convert(ctx context.Context, target *SubscriptionTarget, planID primitive.ObjectID, paymentMethod string) (*PaymentRequestResult, error) {
+	trial, err := s.ActiveTrial(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if planID.IsZero() {
+		planID = trial.PlanID
+	}
+
+	var plan models.SubscriptionPlan
+	err = s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{
+		"_id":      planID,
+		"isActive": true,
+		"type":     trialPlanTypes[target.Kind],
+	}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionPlanUnavailable
+		}
+		return nil, err
+	}
+
+	result, err := NewSubscriptionService(s.DB).CreatePaymentRequest(ctx, target, plan, paymentMethod, &trial.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.DB.Collection("subscription_trials").UpdateOne(ctx,
+		bson.M{"_id": trial.ID},
+		bson.M{"$set": bson.M{
+			"conversionRequestId": result.RequestID,
+			"conversionPlanId":    plan.ID,
+			"updatedAt":           time.Now(),
+		}},
+	)
+	if err != nil {
+		log.Printf("Failed to link conversion request %s to trial %s: %v", result.RequestID.Hex(), trial.ID.Hex(), err)
+	}
+	return result, nil
+}
+
+// RecordConversion marks the trial as converted when the business has paid for a subscription since it started.
+// It reports whether the trial converted.
+func (s *TrialService) RecordConversion(ctx context.Context, trial *models.SubscriptionTrial) (bool, error) {
+	cfg, err := NewSubscriptionService(s.DB).kindConfig(trial.Kind)
+	if err != nil {
+		return false, err
+	}
+
+	var paid SubscriptionRecord
+	err = s.DB.Collection(cfg.SubscriptionCollection).FindOne(ctx,
+		bson.M{
+			cfg.EntityField: trial.EntityID,
+			"trial":         bson.M{"$ne": true},
+			"createdAt":     bson.M{"$gte": trial.CreatedAt},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	).Decode(&paid)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+
+	amount, _, err := amountPaid(ctx, s.DB, &paid)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	result, err := s.DB.Collection("subscription_trials").UpdateOne(ctx,
+		bson.M{"_id": trial.ID, "status": bson.M{"$ne": models.TrialStatusConverted}},
+		bson.M{"$set": bson.M{
+			"status":           models.TrialStatusConverted,
+			"conversionPlanId": paid.PlanID,
+			"conversionAmount": math.Round(amount*100) / 100,
+			"convertedAt":      now,
+			"updatedAt":        now,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Expire marks a trial that ended without a payment as expired
+func (s *TrialService) Expire(ctx context.Context, trialID primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	result, err := s.DB.Collection("subscription_trials").UpdateOne(ctx,
+		bson.M{"_id": trialID, "status": models.TrialStatusActive},
+		bson.M{"$set": bson.M{"status": models.TrialStatusExpired, "expiredAt": now, "updatedAt": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Report lists the trials matching the filter, newest first, with their totals by outcome
+func (s *TrialService) Report(ctx context.Context, filter bson.M) ([]models.SubscriptionTrial, models.TrialSummary, error) {
+	var summary models.TrialSummary
+	cursor, err := s.DB.Collection("subscription_trials").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, summary, err
+	}
+	trials := []models.SubscriptionTrial{}
+	if err := cursor.All(ctx, &trials); err != nil {
+		return nil, summary, err
+	}
+
+	for _, trial := range trials {
+		switch trial.Status {
+		case models.TrialStatusActive:
+			summary.Active++
+		case models.TrialStatusConverted:
+			summary.Converted++
+			summary.ConvertedAmount += trial.ConversionAmount
+		case models.TrialStatusExpired:
+			summary.Expired++
+		}
+	}
+	if finished := summary.Converted + summary.Expired; finished > 0 {
+		summary.ConversionRate = math.Round(float64(summary.Converted)/float64(finished)*10000) / 100
+	}
+	summary.ConvertedAmount = math.Round(summary.ConvertedAmount*100) / 100
+	return trials, summary, nil
+}
+
+// keys returns the normalized phones, emails and business name used to recognise a business
+func (a TrialApplicant) keys() ([]string, []string, string) {
+	phones := []string{}
+	for _, phone := range a.Phones {
+		if key := normalizeTrialPhone(phone); key != "" && !containsString(phones, key) {
+			phones = append(phones, key)
+		}
+	}
+	emails := []string{}
+	for _, email := range a.Emails {
+		if key := normalizeTrialEmail(email); key != "" && !containsString(emails, key) {
+			emails = append(emails, key)
+		}
+	}
+	return phones, emails, normalizeBusinessName(a.BusinessName)
+}
+
+// normalizeTrialPhone keeps the national digits of a phone number so +961, 00961 and 0 prefixes match
+func normalizeTrialPhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	digits = strings.TrimPrefix(digits, "00")
+	digits = strings.TrimPrefix(digits, "961")
+	digits = strings.TrimLeft(digits, "0")
+	if len(digits) < 6 {
+		return ""
+	}
+	return digits
+}
+
+// normalizeTrialEmail lowercases an email and drops any +tag from its local part.
+// Placeholder addresses generated from phone numbers are ignored.
+func normalizeTrialEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || strings.HasSuffix(email, ".local") {
+		return ""
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	return local + "@" + domain
+}
+
+// normalizeBusinessName reduces a business name to its letters and digits, without legal suffixes
+func normalizeBusinessName(name string) string {
+	name = strings.NewReplacer(".", "", "'", "").Replace(strings.ToLower(name))
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var key strings.Builder
+	for _, word := range words {
+		if !businessNameSuffixes[word] {
+			key.WriteString(word)
+		}
+	}
+	return key.String()
+}
@@ -0,0 +1,49 @@
+package services
+
+import "testing"
+
+func TestNormalizeTrialPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+961 3 123 456", "3123456"},
+		{"00961 71-123-456", "71123456"},
+		{"03 123456", "3123456"},
+		{"71 123 456", "71123456"},
+		{"(961) 1-234-567", "1234567"},
+		{"12345", ""},
+		{"not a phone", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeTrialPhone(tt.phone); got != tt.want {
+			t.Errorf("normalizeTrialPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeBusinessName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Barrim SAL", "barrim"},
+		{"barrim s.a.l.", "barrim"},
+		{"BARRIM S.A.R.L", "barrim"},
+		{"The Coffee Co.", "coffee"},
+		{"Joe's Pizza", "joespizza"},
+		{"Joes-Pizza LLC", "joespizza"},
+		{"Café Beirut", "cafébeirut"},
+		{"Studio 54", "studio54"},
+		{"SAL", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeBusinessName(tt.name); got != tt.want {
+			t.Errorf("normalizeBusinessName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ledgerOpeningBalanceLockKey = "barrim:jobs:ledger-opening-balances"
+
+// ErrWithdrawalNotPending is returned when a withdrawal was already approved or rejected
+var ErrWithdrawalNotPending = errors.New("withdrawal request is already processed")
+
+// WalletService moves money between wallets and records every movement in the ledger.
+// Each method updates the legacy wallet documents and posts the ledger transaction inside one Mongo transaction.
+type WalletService struct {
+	DB     *mongo.Database
+	Ledger *ledger.Ledger
+}
+
+// NewWalletService creates a new wallet service
+func NewWalletService(db *mongo.Database) *WalletService {
+	return &WalletService{
+		DB:     db,
+		Ledger: ledger.New(db),
+	}
+}
+
+// RecordSubscriptionIncome books the platform share of a subscription or sponsorship payment
+func (s *WalletService) RecordSubscriptionIncome(ctx context.Context, amount float64, entityID primitive.ObjectID, entityType, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		now := time.Now()
+		adminWalletTransaction := models.AdminWallet{
+			ID:          primitive.NewObjectID(),
+			Type:        "subscription_income",
+			Amount:      amount,
+			Description: description,
+			EntityID:    entityID,
+			EntityType:  entityType,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+
+			CurrencyConversion: NewExchangeRateService(s.DB).ConversionFor(sessCtx, amount),
+		}
+		if _, err := s.DB.Collection("admin_wallet").InsertOne(sessCtx, adminWalletTransaction); err != nil {
+			return fmt.Errorf("failed to insert admin wallet transaction: %w", err)
+		}
+
+		_, err := s.DB.Collection("admin_wallet_balance").UpdateOne(sessCtx,
+			bson.M{},
+			bson.M{
+				"$inc": bson.M{"totalIncome": amount, "netBalance": amount},
+				"$set": bson.M{"lastUpdated": now},
+				"$setOnInsert": bson.M{
+					"totalWithdrawalIncome": 0,
+					"totalCommissionsPaid":  0,
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update admin wallet balance: %w", err)
+		}
+
+		return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+			Type:          ledger.TypeSubscriptionIncome,
+			ReferenceType: entityType,
+			ReferenceID:   entityID,
+			Description:   description,
+			Entries: []ledger.Entry{
+				ledger.Debit(ledger.AccountCash, amount),
+				ledger.Credit(ledger.AccountSubscriptionRevenue, amount),
+			},
+			CreatedAt: now,
+		})
+	})
+}
+
+// RecordCommission books the commission owed to a salesperson or sales manager ("salesperson" or "sales_manager")
+func (s *WalletService) RecordCommission(ctx context.Context, role string, userID primitive.ObjectID, amount float64, subscriptionID primitive.ObjectID, entityType, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	var collectionName string
+	commissionRecord := models.CommissionRecord{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: subscriptionID,
+		Amount:         amount,
+		Role:           role,
+		Status:         "pending", // Will be marked as paid when processed
+		CreatedAt:      time.Now(),
+
+		CurrencyConversion: NewExchangeRateService(s.DB).ConversionFor(ctx, amount),
+	}
+	switch role {
+	case "salesperson":
+		collectionName = "salespersons"
+		commissionRecord.SalespersonID = userID
+	case "sales_manager":
+		collectionName = "sales_managers"
+		commissionRecord.SalesManagerID = userID
+	default:
+		return fmt.Errorf("invalid commission role: %s", role)
+	}
+
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		if _, err := s.DB.Collection("commission_records").InsertOne(sessCtx, commissionRecord); err != nil {
+			return fmt.Errorf("failed to insert %s commission record: %w", role, err)
+		}
+
+		_, err := s.DB.Collection(collectionName).UpdateOne(sessCtx,
+			bson.M{"_id": userID},
+			bson.M{
+				"$inc": bson.M{"commissionBalance": amount},
+				"$set": bson.M{"updatedAt": commissionRecord.CreatedAt},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update %s commission balance: %w", role, err)
+		}
+
+		return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+			Type:          ledger.TypeCommission,
+			ReferenceType: entityType,
+			ReferenceID:   subscriptionID,
+			Description:   description,
+			Entries: []ledger.Entry{
+				ledger.Debit(ledger.AccountCash, amount),
+				ledger.Credit(ledger.CommissionAccount(role, userID), amount),
+			},
+			CreatedAt: commissionRecord.CreatedAt,
+		})
+	})
+}
+
+// RecordReferralReward credits a salesperson's referral balance
+func (s *WalletService) RecordReferralReward(ctx context.Context, salespersonID primitive.ObjectID, amount float64, referredID primitive.ObjectID, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		now := time.Now()
+		_, err := s.DB.Collection("salespersons").UpdateOne(sessCtx,
+			bson.M{"_id": salespersonID},
+			bson.M{
+				"$inc": bson.M{"referralBalance": amount},
+				"$set": bson.M{"updatedAt": now},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update salesperson referral balance: %w", err)
+		}
+
+		return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+			Type:          ledger.TypeReferralReward,
+			ReferenceType: "referral",
+			ReferenceID:   referredID,
+			Description:   description,
+			Entries: []ledger.Entry{
+				ledger.Debit(ledger.AccountReferralExpense, amount),
+				ledger.Credit(ledger.ReferralAccount(salespersonID), amount),
+			},
+			CreatedAt: now,
+		})
+	})
+}
+
+// ApproveWithdrawal marks a pending withdrawal as approved and pays it out of the user's commission account
+func (s *WalletService) ApproveWithdrawal(ctx context.Context, withdrawalID, adminID primitive.ObjectID, adminNote string) (*models.Withdrawal, error) {
+	var withdrawal models.Withdrawal
+
+	err := ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		now := time.Now()
+		err := s.DB.Collection("withdrawals").FindOneAndUpdate(sessCtx,
+			bson.M{"_id": withdrawalID, "status": "pending"},
+			bson.M{"$set": bson.M{
+				"status":      "approved",
+				"adminId":     adminID,
+				"adminNote":   adminNote,
+				"processedAt": now,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&withdrawal)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrWithdrawalNotPending
+			}
+			return fmt.Errorf("failed to update withdrawal request: %w", err)
+		}
+
+		return s.postWithdrawal(sessCtx, &withdrawal, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &withdrawal, nil
+}
+
+// postWithdrawal posts an approved withdrawal to the ledger inside the caller's transaction.
+// For salespersons, any amount above the commission balance is taken from the referral balance.
+func (s *WalletService) postWithdrawal(sessCtx mongo.SessionContext, withdrawal *models.Withdrawal, now time.Time) error {
+	commissionAccount := ledger.CommissionAccount(withdrawal.UserType, withdrawal.UserID)
+	entries := []ledger.Entry{ledger.Credit(ledger.AccountCash, withdrawal.Amount)}
+
+	fromCommission := withdrawal.Amount
+	if withdrawal.UserType == "salesperson" {
+		account, err := s.Ledger.GetAccount(sessCtx, commissionAccount)
+		if err != nil {
+			return err
+		}
+		if available := account.Balance(); available < fromCommission {
+			if available < 0 {
+				available = 0
+			}
+			fromCommission = available
+			entries = append(entries, ledger.Debit(ledger.ReferralAccount(withdrawal.UserID), withdrawal.Amount-available))
+		}
+	}
+	if fromCommission > 0 {
+		entries = append(entries, ledger.Debit(commissionAccount, fromCommission))
+	}
+
+	return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+		Type:          ledger.TypeWithdrawal,
+		ReferenceType: "withdrawal",
+		ReferenceID:   withdrawal.ID,
+		Description:   fmt.Sprintf("Withdrawal paid to %s %s", withdrawal.UserType, withdrawal.UserID.Hex()),
+		Entries:       entries,
+		CreatedAt:     now,
+	})
+}
+
+// CommissionBalance returns the ledger account of a salesperson or sales manager
+func (s *WalletService) CommissionBalance(ctx context.Context, role string, userID primitive.ObjectID) (ledger.Account, error) {
+	return s.Ledger.GetAccount(ctx, ledger.CommissionAccount(role, userID))
+}
+
+// WalletStatement is the ledger view of a salesperson or sales manager wallet
+type WalletStatement struct {
+	Commission   ledger.Account       `json:"commission"`
+	Referral     *ledger.Account      `json:"referral,omitempty"`
+	Transactions []ledger.Transaction `json:"transactions"`
+}
+
+// Statement returns the ledger balances and the most recent postings of a salesperson or sales manager
+func (s *WalletService) Statement(ctx context.Context, role string, userID primitive.ObjectID, limit int64) (*WalletStatement, error) {
+	accounts := []string{ledger.CommissionAccount(role, userID)}
+
+	commission, err := s.Ledger.GetAccount(ctx, accounts[0])
+	if err != nil {
+		return nil, err
+	}
+	statement := &WalletStatement{Commission: commission}
+
+	// Salespersons also earn referral rewards on their own account
+	if role == "salesperson" {
+		referral, err := s.Ledger.GetAccount(ctx, ledger.ReferralAccount(userID))
+		if err != nil {
+			return nil, err
+		}
+		statement.Referral = &referral
+		accounts = append(accounts, referral.ID)
+	}
+
+	statement.Transactions, err = s.Ledger.History(ctx, accounts, limit)
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// ImportOpeningBalances copies the balances of the legacy wallets into the ledger once, under a job lock.
+// It is called before the server starts taking traffic, so wallets do not move while they are copied; while
+// another instance holds the lock it waits for that import to finish. It does nothing when opening balances
+// were already imported.
+func (s *WalletService) ImportOpeningBalances() {
+	for !utils.RunWithJobLock(ledgerOpeningBalanceLockKey, 10*time.Minute, s.importOpeningBalancesOnce) {
+		log.Println("Waiting for the ledger opening balance import held by another instance")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (s *WalletService) importOpeningBalancesOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	count, err := s.DB.Collection("ledger_migrations").CountDocuments(ctx, bson.M{"_id": ledger.TypeOpeningBalance})
+	if err != nil {
+		log.Printf("Failed to check ledger opening balances: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	if err := s.importOpeningBalances(ctx); err != nil {
+		log.Printf("Failed to import ledger opening balances: %v", err)
+		return
+	}
+	log.Println("Imported legacy wallet balances into the ledger")
+}
+
+func (s *WalletService) importOpeningBalances(ctx context.Context) error {
+	// Platform revenue recorded in the admin wallet
+	revenue, err := s.sum(ctx, "admin_wallet", bson.M{"type": "subscription_income"}, "$amount")
+	if err != nil {
+		return err
+	}
+
+	// Commission earned per salesperson and sales manager
+	earned := map[string]map[primitive.ObjectID]float64{}
+	for role, field := range map[string]string{"salesperson": "$salespersonId", "sales_manager": "$salesManagerId"} {
+		totals, err := s.sumByUser(ctx, "commission_records", bson.M{"role": role}, field)
+		if err != nil {
+			return err
+		}
+		earned[role] = totals
+	}
+
+	// Approved withdrawals per user
+	withdrawn := map[string]map[primitive.ObjectID]float64{}
+	for _, role := range []string{"salesperson", "sales_manager"} {
+		totals, err := s.sumByUser(ctx, "withdrawals", bson.M{"userType": role, "status": "approved"}, "$userId")
+		if err != nil {
+			return err
+		}
+		withdrawn[role] = totals
+	}
+
+	// Referral balances of salespersons
+	referrals, err := s.sumByUser(ctx, "salespersons", bson.M{"referralBalance": bson.M{"$gt": 0}}, "$_id")
+	if err != nil {
+		return err
+	}
+
+	entries := []ledger.Entry{}
+	var cashIn, cashOut, referralTotal float64
+	if revenue > 0 {
+		entries = append(entries, ledger.Credit(ledger.AccountSubscriptionRevenue, revenue))
+		cashIn += revenue
+	}
+	for role, totals := range earned {
+		for userID, amount := range totals {
+			if amount > 0 {
+				entries = append(entries, ledger.Credit(ledger.CommissionAccount(role, userID), amount))
+				cashIn += amount
+			}
+		}
+	}
+	for userID, amount := range referrals {
+		entries = append(entries, ledger.Credit(ledger.ReferralAccount(userID), amount))
+		referralTotal += amount
+	}
+	for role, totals := range withdrawn {
+		for userID, amount := range totals {
+			if amount <= 0 {
+				continue
+			}
+			cashOut += amount
+			// Salesperson withdrawals beyond the commission earned were paid from the referral balance
+			fromCommission := amount
+			if role == "salesperson" && earned[role][userID] < amount {
+				fromCommission = earned[role][userID]
+				entries = append(entries, ledger.Debit(ledger.ReferralAccount(userID), amount-fromCommission))
+			}
+			if fromCommission > 0 {
+				entries = append(entries, ledger.Debit(ledger.CommissionAccount(role, userID), fromCommission))
+			}
+		}
+	}
+
+	if cashIn > 0 {
+		entries = append(entries, ledger.Debit(ledger.AccountCash, cashIn))
+	}
+	if cashOut > 0 {
+		entries = append(entries, ledger.Credit(ledger.AccountCash, cashOut))
+	}
+	if referralTotal > 0 {
+		entries = append(entries, ledger.Debit(ledger.AccountReferralExpense, referralTotal))
+	}
+
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		// The marker makes the import run once even when there was nothing to import
+		_, err := s.DB.Collection("ledger_migrations").InsertOne(sessCtx, bson.M{"_id": ledger.TypeOpeningBalance, "createdAt": time.Now()})
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return s.Ledger.PostInSession(sessCtx, &ledger.Transaction{
+			Type:        ledger.TypeOpeningBalance,
+			Description: "Opening balances imported from the legacy wallets",
+			Entries:     entries,
+		})
+	})
+}
+
+// sum adds up a numeric field of the matching documents
+func (s *WalletService) sum(ctx context.Context, collectionName string, match bson.M, field string) (float64, error) {
+	cursor, err := s.DB.Collection(collectionName).Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": field}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total float64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.Total, cursor.Err()
+}
+
+// sumByUser adds up the amount of the matching documents grouped by the user ID in groupField.
+// For the salespersons collection the referral balance is summed instead of the amount.
+func (s *WalletService) sumByUser(ctx context.Context, collectionName string, match bson.M, groupField string) (map[primitive.ObjectID]float64, error) {
+	amountField := "$amount"
+	if collectionName == "salespersons" {
+		amountField = "$referralBalance"
+	}
+
+	cursor, err := s.DB.Collection(collectionName).Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": groupField, "total": bson.M{"$sum": amountField}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := map[primitive.ObjectID]float64{}
+	for cursor.Next(ctx) {
+		var row struct {
+			UserID primitive.ObjectID `bson:"_id"`
+			Total  float64            `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		if !row.UserID.IsZero() {
+			totals[row.UserID] = row.Total
+		}
+	}
+	return totals, cursor.Err()
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WhishPaymentKindSponsorship identifies sponsorship payments; subscription payments use the subscription kinds
+const WhishPaymentKindSponsorship = "sponsorship"
+
+// Reasons recorded on payment anomalies
+const (
+	AnomalyUnknownExternalID = "unknown_external_id"
+	AnomalyAmountMismatch    = "amount_mismatch"
+	// A plan change was paid for after its subscription ended; the payment is to be refunded
+	AnomalyPlanChangeSubscriptionEnded = "plan_change_subscription_ended"
+)
+
+var (
+	ErrPaymentAlreadyProcessed = errors.New("payment already processed")
+	ErrPaymentNotConfirmed     = errors.New("payment not confirmed by Whish")
+	ErrPaymentFailed           = errors.New("payment failed on Whish")
+	ErrPaymentAmountMismatch   = errors.New("paid amount does not match the request")
+)
+
+// WhishCallback describes a success callback received from Whish
+type WhishCallback struct {
+	Kind          string
+	ExternalID    int64
+	RequestID     primitive.ObjectID
+	PlanID        primitive.ObjectID // Set for subscription payments
+	SponsorshipID primitive.ObjectID // Set for sponsorship payments
+	Amount        float64            // Amount requested when it differs from the plan price, e.g. for plan changes
+	RemoteAddr    string
+}
+
+// WhishCallbackService confirms Whish success callbacks with the Whish API and applies each payment exactly once
+type WhishCallbackService struct {
+	DB      *mongo.Database
+	Gateway PaymentGateway
+}
+
+// NewWhishCallbackService creates a new Whish callback service
+func NewWhishCallbackService(db *mongo.Database) *WhishCallbackService {
+	return &WhishCallbackService{
+		DB:      db,
+		Gateway: NewPaymentGateway(),
+	}
+}
+
+// ConfirmAndActivate re-checks a success callback with the Whish API before calling activate.
+// A payment that Whish does not report as successful, or whose amount differs from the request, is never activated.
+func (s *WhishCallbackService) ConfirmAndActivate(ctx context.Context, cb WhishCallback, activate func(ctx context.Context, payerPhone string) error) error {
+	details, err := s.Gateway.GetPaymentDetails("USD", cb.ExternalID)
+	if err != nil {
+		return fmt.Errorf("failed to verify payment: %w", err)
+	}
+	switch details.CollectStatus {
+	case "success":
+	case "failed":
+		return ErrPaymentFailed
+	default:
+		// Still pending on Whish: the reconciler settles it once Whish reports an outcome
+		return fmt.Errorf("%w: status %q", ErrPaymentNotConfirmed, details.CollectStatus)
+	}
+
+	if err := s.checkAmount(ctx, cb, details); err != nil {
+		return err
+	}
+
+	return activate(ctx, details.PayerPhoneNumber)
+}
+
+// checkAmount compares the amount collected by Whish with the request and records an anomaly when they differ.
+// Whish does not always report the collected amount, in which case there is nothing to compare.
+func (s *WhishCallbackService) checkAmount(ctx context.Context, cb WhishCallback, details *models.PaymentStatusData) error {
+	if details.Amount <= 0 {
+		return nil
+	}
+
+	expected, err := s.expectedAmount(ctx, cb)
+	if err != nil {
+		return err
+	}
+	if math.Abs(details.Amount-expected) > 0.01 {
+		s.RecordAnomaly(ctx, cb, AnomalyAmountMismatch, expected, details.Amount, details.PayerPhoneNumber)
+		return ErrPaymentAmountMismatch
+	}
+	return nil
+}
+
+// ActivateOnce runs apply inside a Mongo transaction together with the idempotency record of the payment,
+// so a replayed callback or a concurrent status check can never activate the same payment twice.
+// apply must use sessCtx for every write that belongs to the activation.
+func (s *WhishCallbackService) ActivateOnce(ctx context.Context, cb WhishCallback, payerPhone string, apply func(sessCtx mongo.SessionContext) error) error {
+	amount, err := s.expectedAmount(ctx, cb)
+	if err != nil {
+		return err
+	}
+
+	// Ledger postings made by apply are tagged with the payment for the reconciliation report
+	paymentID := ProcessedPaymentID(cb.Kind, cb.ExternalID)
+	ctx = ledger.WithPaymentReference(ctx, paymentID)
+
+	return ledger.RunInTransaction(ctx, s.DB, func(sessCtx mongo.SessionContext) error {
+		_, err := s.DB.Collection("processed_payments").InsertOne(sessCtx, models.ProcessedPayment{
+			ID:          paymentID,
+			Kind:        cb.Kind,
+			ExternalID:  cb.ExternalID,
+			RequestID:   cb.RequestID,
+			Amount:      amount,
+			PayerPhone:  payerPhone,
+			ProcessedAt: time.Now(),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrPaymentAlreadyProcessed
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record payment: %w", err)
+		}
+		return apply(sessCtx)
+	})
+}
+
+// whishExternalIDCounterID is the counter externalIds are allocated from
+const whishExternalIDCounterID = "whish_external_ids"
+
+// whishExternalIDBase keeps allocated externalIds clear of the second and millisecond timestamps older requests used
+const whishExternalIDBase int64 = 10000000000000
+
+// NextWhishExternalID allocates the externalId of a new Whish payment. Every request gets its own,
+// which keeps the idempotency keys of processed payments from colliding.
+func NextWhishExternalID(ctx context.Context, db *mongo.Database) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := db.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": whishExternalIDCounterID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate Whish externalId: %w", err)
+	}
+	return whishExternalIDBase + counter.Seq, nil
+}
+
+// ProcessedPaymentID returns the idempotency key of a Whish payment; externalIds are unique per request
+func ProcessedPaymentID(kind string, externalID int64) string {
+	return fmt.Sprintf("%s:%d", kind, externalID)
+}
+
+// RecordAnomaly stores a callback that does not match its request for admins to review.
+// Repeated callbacks for the same externalId and reason are folded into one open anomaly.
+func (s *WhishCallbackService) RecordAnomaly(ctx context.Context, cb WhishCallback, reason string, expected, reported float64, payerPhone string) {
+	now := time.Now()
+	set := bson.M{
+		"lastSeenAt":     now,
+		"expectedAmount": expected,
+		"reportedAmount": reported,
+		"remoteAddr":     cb.RemoteAddr,
+	}
+	if !cb.RequestID.IsZero() {
+		set["requestId"] = cb.RequestID
+	}
+	if payerPhone != "" {
+		set["payerPhone"] = payerPhone
+	}
+
+	_, err := s.DB.Collection("payment_anomalies").UpdateOne(ctx,
+		bson.M{"kind": cb.Kind, "externalId": cb.ExternalID, "reason": reason, "status": "open"},
+		bson.M{
+			"$set":         set,
+			"$inc":         bson.M{"occurrences": 1},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Failed to record payment anomaly for externalId %d: %v", cb.ExternalID, err)
+		return
+	}
+	log.Printf("Recorded payment anomaly %s for %s externalId %d", reason, cb.Kind, cb.ExternalID)
+}
+
+// expectedAmount returns the price that was sent to Whish when the payment was requested
+func (s *WhishCallbackService) expectedAmount(ctx context.Context, cb WhishCallback) (float64, error) {
+	if cb.Amount > 0 {
+		return cb.Amount, nil
+	}
+	if cb.Kind == WhishPaymentKindSponsorship {
+		var sponsorship models.Sponsorship
+		if err := s.DB.Collection("sponsorships").FindOne(ctx, bson.M{"_id": cb.SponsorshipID}).Decode(&sponsorship); err != nil {
+			return 0, fmt.Errorf("failed to get sponsorship details: %w", err)
+		}
+		return sponsorship.Price, nil
+	}
+
+	var plan models.SubscriptionPlan
+	if err := s.DB.Collection("subscription_plans").FindOne(ctx, bson.M{"_id": cb.PlanID}).Decode(&plan); err != nil {
+		return 0, fmt.Errorf("failed to get plan details: %w", err)
+	}
+	return plan.Price, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/models"
+)
+
+// fakeCallback is what the callback endpoint of TestFakeGatewayPurchase saw
+type fakeCallback struct {
+	path       string
+	activated  bool
+	payerPhone string
+	err        error
+}
+
+// TestFakeGatewayPurchase runs a purchase through the fake gateway: the collect request is settled, the gateway
+// calls back and the callback confirms the payment with the gateway before activating it
+func TestFakeGatewayPurchase(t *testing.T) {
+	tests := []struct {
+		outcome   string
+		path      string
+		activated bool
+		err       error
+	}{
+		{outcome: FakeOutcomeSuccess, path: "/success", activated: true},
+		{outcome: FakeOutcomeFailure, path: "/failure", err: ErrPaymentFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			gateway := NewFakePaymentGateway()
+			gateway.Outcome = tt.outcome
+			gateway.CallbackDelay = 0
+			service := &WhishCallbackService{Gateway: gateway}
+
+			callbacks := make(chan fakeCallback, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				externalID, _ := strconv.ParseInt(r.URL.Query().Get("externalId"), 10, 64)
+				callback := fakeCallback{path: r.URL.Path}
+				callback.err = service.ConfirmAndActivate(r.Context(), WhishCallback{
+					Kind:       SubscriptionKindServiceProvider,
+					ExternalID: externalID,
+					Amount:     25,
+				}, func(ctx context.Context, payerPhone string) error {
+					callback.activated = true
+					callback.payerPhone = payerPhone
+					return nil
+				})
+				callbacks <- callback
+			}))
+			defer server.Close()
+			gateway.Client = server.Client()
+
+			amount, externalID := 25.0, int64(1001)
+			_, err := gateway.PostPayment(models.WhishRequest{
+				Amount:             &amount,
+				Currency:           "USD",
+				ExternalID:         &externalID,
+				SuccessCallbackURL: server.URL + "/success",
+				FailureCallbackURL: server.URL + "/failure",
+			})
+			if err != nil {
+				t.Fatalf("PostPayment: %v", err)
+			}
+
+			select {
+			case callback := <-callbacks:
+				if callback.path != tt.path {
+					t.Errorf("callback path = %s, want %s", callback.path, tt.path)
+				}
+				if !errors.Is(callback.err, tt.err) {
+					t.Errorf("ConfirmAndActivate error = %v, want %v", callback.err, tt.err)
+				}
+				if callback.activated != tt.activated {
+					t.Errorf("activated = %v, want %v", callback.activated, tt.activated)
+				}
+				if tt.activated && callback.payerPhone != gateway.PayerPhone {
+					t.Errorf("payer phone = %q, want %q", callback.payerPhone, gateway.PayerPhone)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the fake gateway never called back")
+			}
+		})
+	}
+}
+
+// TestConfirmPendingPayment checks that a payment Whish has not settled yet is neither activated nor failed
+func TestConfirmPendingPayment(t *testing.T) {
+	gateway := NewFakePaymentGateway()
+	gateway.Outcome = FakeOutcomeTimeout
+	service := &WhishCallbackService{Gateway: gateway}
+
+	amount, externalID := 25.0, int64(1002)
+	if _, err := gateway.PostPayment(models.WhishRequest{Amount: &amount, ExternalID: &externalID}); err != nil {
+		t.Fatalf("PostPayment: %v", err)
+	}
+
+	activated := false
+	err := service.ConfirmAndActivate(context.Background(), WhishCallback{ExternalID: externalID, Amount: amount},
+		func(ctx context.Context, payerPhone string) error {
+			activated = true
+			return nil
+		})
+	if !errors.Is(err, ErrPaymentNotConfirmed) {
+		t.Errorf("ConfirmAndActivate error = %v, want ErrPaymentNotConfirmed", err)
+	}
+	if activated {
+		t.Error("a pending payment was activated")
+	}
+}
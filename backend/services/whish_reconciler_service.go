@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/ledger"
+	"github.com/HSouheill/barrim_backend/models"
+	"github.com/HSouheill/barrim_backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const whishReconcilerLockKey = "barrim:jobs:whish-reconciler"
+
+// reportDateLayout is the layout of reconciliation report IDs
+const reportDateLayout = "2006-01-02"
+
+// WhishActivator activates a paid request; it must apply the payment at most once (see WhishCallbackService.ActivateOnce)
+type WhishActivator func(ctx context.Context, requestID primitive.ObjectID, payerPhone string) error
+
+// whishPaymentSource is a collection of requests paid through Whish
+type whishPaymentSource struct {
+	Kind       string
+	Collection string
+}
+
+var whishPaymentSources = []whishPaymentSource{
+	{Kind: SubscriptionKindCompanyBranch, Collection: "branch_subscription_requests"},
+	{Kind: SubscriptionKindWholesalerBranch, Collection: "wholesaler_branch_subscription_requests"},
+	{Kind: SubscriptionKindServiceProvider, Collection: "subscription_requests"},
+	{Kind: WhishPaymentKindSponsorship, Collection: "sponsorship_subscription_requests"},
+}
+
+// pendingWhishRequest holds the fields shared by every request waiting for a Whish payment
+type pendingWhishRequest struct {
+	ID            primitive.ObjectID  `bson:"_id"`
+	ExternalID    int64               `bson:"externalId"`
+	PlanID        primitive.ObjectID  `bson:"planId,omitempty"`
+	SponsorshipID primitive.ObjectID  `bson:"sponsorshipId,omitempty"`
+	Amount        float64             `bson:"amount,omitempty"`
+	RequestedAt   time.Time           `bson:"requestedAt"`
+	RenewalOf     *primitive.ObjectID `bson:"renewalOf,omitempty"`
+}
+
+// WhishReconcilerService settles Whish payments whose callback never arrived and reports on the collected money
+type WhishReconcilerService struct {
+	DB         *mongo.Database
+	Callbacks  *WhishCallbackService
+	Activators map[string]WhishActivator // Keyed by payment kind
+}
+
+// NewWhishReconcilerService creates a new Whish reconciler
+func NewWhishReconcilerService(db *mongo.Database, activators map[string]WhishActivator) *WhishReconcilerService {
+	return &WhishReconcilerService{
+		DB:         db,
+		Callbacks:  NewWhishCallbackService(db),
+		Activators: activators,
+	}
+}
+
+// whishPollAfter is how long a request waits for its callback before the reconciler asks Whish, from WHISH_RECONCILE_AFTER_MINUTES
+func whishPollAfter() time.Duration {
+	return envDuration("WHISH_RECONCILE_AFTER_MINUTES", 15, time.Minute)
+}
+
+// whishCollectURLTTL is how long a collect URL stays usable before its request expires, from WHISH_COLLECT_URL_TTL_HOURS
+func whishCollectURLTTL() time.Duration {
+	return envDuration("WHISH_COLLECT_URL_TTL_HOURS", 24, time.Hour)
+}
+
+// Run executes one reconciliation pass under a distributed lock so that only one replica works at a time
+func (s *WhishReconcilerService) Run() {
+	ran := utils.RunWithJobLock(whishReconcilerLockKey, 10*time.Minute, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		s.SweepPendingPayments(ctx)
+		NewRefundService(s.DB).SweepStalledRefunds(ctx)
+		s.EnsureDailyReport(ctx)
+	})
+	if !ran {
+		log.Println("Whish reconciliation pass skipped: another instance holds the lock")
+	}
+}
+
+// SweepPendingPayments asks Whish about requests still waiting for their callback.
+// Paid requests are activated, failed ones are closed and abandoned collect URLs expire after the TTL.
+func (s *WhishReconcilerService) SweepPendingPayments(ctx context.Context) {
+	now := time.Now()
+
+	for _, source := range whishPaymentSources {
+		cursor, err := s.DB.Collection(source.Collection).Find(ctx, bson.M{
+			"paymentStatus": "pending",
+			"externalId":    bson.M{"$gt": 0},
+			"requestedAt":   bson.M{"$lte": now.Add(-whishPollAfter())},
+		}, options.Find().SetSort(bson.D{{Key: "requestedAt", Value: 1}}).SetLimit(200))
+		if err != nil {
+			log.Printf("Failed to load pending %s payments: %v", source.Kind, err)
+			continue
+		}
+
+		var requests []pendingWhishRequest
+		err = cursor.All(ctx, &requests)
+		cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Failed to decode pending %s payments: %v", source.Kind, err)
+			continue
+		}
+
+		for _, request := range requests {
+			s.reconcile(ctx, source, request, now)
+		}
+	}
+}
+
+// reconcile settles one pending request according to the status Whish reports for it
+func (s *WhishReconcilerService) reconcile(ctx context.Context, source whishPaymentSource, request pendingWhishRequest, now time.Time) {
+	payment := WhishCallback{
+		Kind:          source.Kind,
+		ExternalID:    request.ExternalID,
+		RequestID:     request.ID,
+		PlanID:        request.PlanID,
+		SponsorshipID: request.SponsorshipID,
+		Amount:        request.Amount,
+		RemoteAddr:    "reconciler",
+	}
+
+	details, err := s.Callbacks.Gateway.GetPaymentDetails("USD", request.ExternalID)
+	if err != nil {
+		log.Printf("Failed to check Whish status of %s request %s: %v", source.Kind, request.ID.Hex(), err)
+		return
+	}
+
+	switch details.CollectStatus {
+	case "success":
+		activate, ok := s.Activators[source.Kind]
+		if !ok {
+			log.Printf("No activator registered for %s payments", source.Kind)
+			return
+		}
+		// Mismatched amounts are recorded as anomalies and left pending for an admin
+		if err := s.Callbacks.checkAmount(ctx, payment, details); err != nil {
+			log.Printf("Not activating %s request %s: %v", source.Kind, request.ID.Hex(), err)
+			return
+		}
+		err := activate(ctx, request.ID, details.PayerPhoneNumber)
+		if err != nil && !errors.Is(err, ErrPaymentAlreadyProcessed) {
+			log.Printf("Failed to activate %s request %s: %v", source.Kind, request.ID.Hex(), err)
+			return
+		}
+		log.Printf("Reconciled paid %s request %s (externalId %d)", source.Kind, request.ID.Hex(), request.ExternalID)
+
+	case "failed":
+		s.closeRequest(ctx, source, request.ID, "failed", now)
+
+	default:
+		// Renewal requests stay open until the renewal grace period ends
+		if request.RenewalOf == nil && now.Sub(request.RequestedAt) >= whishCollectURLTTL() {
+			s.closeRequest(ctx, source, request.ID, "expired", now)
+		}
+	}
+}
+
+// closeRequest marks a pending request as failed or expired and drops its collect URL
+func (s *WhishReconcilerService) closeRequest(ctx context.Context, source whishPaymentSource, requestID primitive.ObjectID, status string, now time.Time) {
+	result, err := s.DB.Collection(source.Collection).UpdateOne(ctx,
+		bson.M{"_id": requestID, "paymentStatus": "pending"},
+		bson.M{
+			"$set":   bson.M{"paymentStatus": status, "status": status, "processedAt": now},
+			"$unset": bson.M{"collectUrl": ""},
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to mark %s request %s as %s: %v", source.Kind, requestID.Hex(), status, err)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		return
+	}
+	log.Printf("Marked %s request %s as %s", source.Kind, requestID.Hex(), status)
+
+	if err := NewPromoCodeService(s.DB).Release(ctx, requestID); err != nil {
+		log.Printf("Failed to release promo code of %s request %s: %v", source.Kind, requestID.Hex(), err)
+	}
+}
+
+// EnsureDailyReport stores the reconciliation report of the previous day if it was not generated yet
+func (s *WhishReconcilerService) EnsureDailyReport(ctx context.Context) {
+	yesterday := time.Now().AddDate(0, 0, -1).Format(reportDateLayout)
+
+	count, err := s.DB.Collection("whish_reconciliation_reports").CountDocuments(ctx, bson.M{"_id": yesterday})
+	if err != nil || count > 0 {
+		return
+	}
+
+	report, err := s.BuildReport(ctx, yesterday)
+	if err != nil {
+		log.Printf("Failed to build Whish reconciliation report for %s: %v", yesterday, err)
+		return
+	}
+	if _, err := s.DB.Collection("whish_reconciliation_reports").InsertOne(ctx, report); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Failed to store Whish reconciliation report for %s: %v", yesterday, err)
+		return
+	}
+	if report.Difference != 0 || len(report.Mismatches) > 0 {
+		log.Printf("Whish reconciliation for %s is off by $%.2f across %d payments", yesterday, report.Difference, len(report.Mismatches))
+	}
+}
+
+// BuildReport compares the payments confirmed by Whish on the given day (YYYY-MM-DD, server time)
+// with the cash the ledger recorded for them
+func (s *WhishReconcilerService) BuildReport(ctx context.Context, day string) (*models.WhishReconciliationReport, error) {
+	from, err := time.ParseInLocation(reportDateLayout, day, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(0, 0, 1)
+
+	report := &models.WhishReconciliationReport{
+		ID:          day,
+		From:        from,
+		To:          to,
+		ByKind:      map[string]models.WhishReconciliationTotal{},
+		Mismatches:  []models.WhishReconciliationMismatch{},
+		GeneratedAt: time.Now(),
+	}
+
+	cursor, err := s.DB.Collection("processed_payments").Find(ctx, bson.M{"processedAt": bson.M{"$gte": from, "$lt": to}})
+	if err != nil {
+		return nil, err
+	}
+	var payments []models.ProcessedPayment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		refs = append(refs, payment.ID)
+	}
+	recorded, err := ledger.New(s.DB).CashByPaymentRef(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, payment := range payments {
+		cash := recorded[payment.ID]
+
+		totals := report.ByKind[payment.Kind]
+		totals.Count++
+		totals.Confirmed += payment.Amount
+		totals.Recorded += cash
+		report.ByKind[payment.Kind] = totals
+
+		report.ConfirmedCount++
+		report.ConfirmedTotal += payment.Amount
+		report.RecordedTotal += cash
+
+		if math.Abs(payment.Amount-cash) > 0.01 {
+			report.Mismatches = append(report.Mismatches, models.WhishReconciliationMismatch{
+				PaymentID: payment.ID,
+				Kind:      payment.Kind,
+				RequestID: payment.RequestID,
+				Confirmed: payment.Amount,
+				Recorded:  cash,
+			})
+		}
+	}
+	report.Difference = math.Round((report.ConfirmedTotal-report.RecordedTotal)*100) / 100
+
+	for _, source := range whishPaymentSources {
+		coll := s.DB.Collection(source.Collection)
+		failed, err := coll.CountDocuments(ctx, bson.M{"paymentStatus": "failed", "processedAt": bson.M{"$gte": from, "$lt": to}})
+		if err != nil {
+			return nil, err
+		}
+		expired, err := coll.CountDocuments(ctx, bson.M{"paymentStatus": "expired", "processedAt": bson.M{"$gte": from, "$lt": to}})
+		if err != nil {
+			return nil, err
+		}
+		pending, err := coll.CountDocuments(ctx, bson.M{"paymentStatus": "pending", "externalId": bson.M{"$gt": 0}})
+		if err != nil {
+			return nil, err
+		}
+		report.FailedCount += int(failed)
+		report.ExpiredCount += int(expired)
+		report.PendingCount += int(pending)
+	}
+
+	anomalies, err := s.DB.Collection("payment_anomalies").CountDocuments(ctx, bson.M{"status": "open"})
+	if err != nil {
+		return nil, err
+	}
+	report.OpenAnomalies = int(anomalies)
+
+	return report, nil
+}
+
+// RecentReports returns the stored daily reports, newest first
+func (s *WhishReconcilerService) RecentReports(ctx context.Context, limit int64) ([]models.WhishReconciliationReport, error) {
+	cursor, err := s.DB.Collection("whish_reconciliation_reports").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []models.WhishReconciliationReport{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
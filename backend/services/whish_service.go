@@ -70,6 +70,11 @@ func NewWhishService() *WhishService {
 	}
 }
 
+// Name identifies Whish as the payment gateway
+func (s *WhishService) Name() string {
+	return PaymentGatewayWhish
+}
+
 // getHeaders returns the standard headers required for Whish API requests
 func (s *WhishService) getHeaders() map[string]string {
 	return map[string]string{
@@ -242,6 +247,15 @@ func (s *WhishService) PostPayment(req models.WhishRequest) (string, error) {
 
 // GetPaymentStatus returns the status of a payment transaction
 func (s *WhishService) GetPaymentStatus(currency string, externalID int64) (string, string, error) {
+	details, err := s.GetPaymentDetails(currency, externalID)
+	if err != nil {
+		return "", "", err
+	}
+	return details.CollectStatus, details.PayerPhoneNumber, nil
+}
+
+// GetPaymentDetails returns the status, payer and collected amount of a payment transaction
+func (s *WhishService) GetPaymentDetails(currency string, externalID int64) (*models.PaymentStatusData, error) {
 	payload := models.WhishRequest{
 		Currency:   currency,
 		ExternalID: &externalID,
@@ -249,19 +263,29 @@ func (s *WhishService) GetPaymentStatus(currency string, externalID int64) (stri
 
 	resp, err := s.makeRequest("POST", "payment/collect/status", payload)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	// Extract status and phone number from response
-	var status, phoneNumber string
+	// Extract status, phone number and amount from response
+	details := &models.PaymentStatusData{Currency: currency}
 
 	if s, ok := resp.Data["collectStatus"].(string); ok {
-		status = s
+		details.CollectStatus = s
 	}
 
 	if pn, ok := resp.Data["payerPhoneNumber"].(string); ok {
-		phoneNumber = pn
+		details.PayerPhoneNumber = pn
+	}
+
+	if amount, ok := resp.Data["amount"].(float64); ok {
+		details.Amount = amount
 	}
 
-	return status, phoneNumber, nil
+	return details, nil
+}
+
+// Refund is not exposed by the Whish merchant API. Whish refunds land in the manual refund queue and are
+// paid out by an admin from the merchant portal.
+func (s *WhishService) Refund(currency string, externalID int64, amount float64) error {
+	return ErrRefundNotSupported
 }
@@ -9,8 +9,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// ApprovePendingRequestByManager approves a pending request and inserts the entity into the main collection
-func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.ObjectID, entityType string) error {
+// ApprovePendingRequestByManager approves a pending request, inserts the entity into the main collection
+// and returns the ID of the inserted entity
+func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.ObjectID, entityType string) (primitive.ObjectID, error) {
 	ctx := context.Background()
 	var pendingCollectionName, mainCollectionName, requestField string
 
@@ -28,7 +29,7 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 		mainCollectionName = "serviceProviders"
 		requestField = "serviceProvider"
 	default:
-		return fmt.Errorf("invalid entity type")
+		return primitive.NilObjectID, fmt.Errorf("invalid entity type")
 	}
 
 	pendingColl := db.Database("barrim").Collection(pendingCollectionName)
@@ -38,7 +39,7 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 	var pendingDoc bson.M
 	err := pendingColl.FindOne(ctx, bson.M{"_id": requestID}).Decode(&pendingDoc)
 	if err != nil {
-		return fmt.Errorf("pending request not found: %w", err)
+		return primitive.NilObjectID, fmt.Errorf("pending request not found: %w", err)
 	}
 
 	// Debug: Print the pending document structure
@@ -48,7 +49,7 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 	// Extract the entity object from the request field
 	entityDoc, ok := pendingDoc[requestField].(bson.M)
 	if !ok {
-		return fmt.Errorf("invalid pending request structure: missing %s", requestField)
+		return primitive.NilObjectID, fmt.Errorf("invalid pending request structure: missing %s", requestField)
 	}
 
 	// Get the entity ID if it exists
@@ -79,26 +80,26 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 		// Insert into main collection
 		insertResult, err = mainColl.InsertOne(ctx, entityDoc)
 		if err != nil {
-			return fmt.Errorf("failed to insert into main collection: %w", err)
+			return primitive.NilObjectID, fmt.Errorf("failed to insert into main collection: %w", err)
 		}
 
 		// Get the new entity's ID
 		newEntityID, ok := insertResult.InsertedID.(primitive.ObjectID)
 		if !ok {
-			return fmt.Errorf("failed to get inserted entity ID")
+			return primitive.NilObjectID, fmt.Errorf("failed to get inserted entity ID")
 		}
 		entityID = newEntityID
 	} else {
 		// Insert into main collection
 		insertResult, err = mainColl.InsertOne(ctx, entityDoc)
 		if err != nil {
-			return fmt.Errorf("failed to insert into main collection: %w", err)
+			return primitive.NilObjectID, fmt.Errorf("failed to insert into main collection: %w", err)
 		}
 
 		// Get the new entity's ID
 		entityID, ok = insertResult.InsertedID.(primitive.ObjectID)
 		if !ok {
-			return fmt.Errorf("failed to get inserted entity ID")
+			return primitive.NilObjectID, fmt.Errorf("failed to get inserted entity ID")
 		}
 	}
 
@@ -286,7 +287,7 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 	if userDoc != nil && userDoc["email"] != "" && userDoc["password"] != "" {
 		insertRes, err := usersColl.InsertOne(ctx, userDoc)
 		if err != nil {
-			return fmt.Errorf("failed to create user account: %w", err)
+			return primitive.NilObjectID, fmt.Errorf("failed to create user account: %w", err)
 		}
 
 		// Update the newly inserted entity with the user's ID for easy lookup later
@@ -304,10 +305,10 @@ func ApprovePendingRequestByManager(db *mongo.Client, requestID primitive.Object
 	// Update the pending request status to approved
 	_, err = pendingColl.UpdateOne(ctx, bson.M{"_id": requestID}, bson.M{"$set": bson.M{"status": "approved", "requestStatus": "approved"}})
 	if err != nil {
-		return fmt.Errorf("failed to update pending request status: %w", err)
+		return primitive.NilObjectID, fmt.Errorf("failed to update pending request status: %w", err)
 	}
 
-	return nil
+	return entityID, nil
 }
 
 // RejectPendingRequestByManager rejects a pending request and sets its status to rejected
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/HSouheill/barrim_backend/config"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// jobLockDB holds the lease documents used in place of Redis locks when Redis is not connected
+var jobLockDB *mongo.Database
+
+// UseMongoJobLocks makes job locks fall back to leases in the job_locks collection of db when Redis is not connected
+func UseMongoJobLocks(db *mongo.Database) {
+	jobLockDB = db
+}
+
+// releaseLockScript deletes the lock only if it is still held by the caller's token
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// renewLockScript extends the lock only if it is still held by the caller's token
+var renewLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// AcquireJobLock tries to take a Redis lock so only one replica runs a background job at a time.
+// It returns the lock token and whether the lock was acquired. When Redis is not connected the lock
+// is a Mongo lease instead; with neither available the lock is refused so no job runs unguarded.
+func AcquireJobLock(key string, ttl time.Duration) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	redisClient := config.GetRedisClient()
+	if redisClient == nil {
+		if jobLockDB == nil {
+			log.Printf("Skipping job %s: no Redis or Mongo connection to lock it with", key)
+			return "", false
+		}
+		return acquireJobLease(ctx, key, ttl)
+	}
+
+	token := uuid.New().String()
+	acquired, err := redisClient.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		log.Printf("Failed to acquire job lock %s: %v", key, err)
+		return "", false
+	}
+
+	return token, acquired
+}
+
+// acquireJobLease takes the job lock as a lease document that expires after ttl.
+// A live lease makes the upsert collide on _id, which means another replica holds the lock.
+func acquireJobLease(ctx context.Context, key string, ttl time.Duration) (string, bool) {
+	now := time.Now()
+	token := uuid.New().String()
+	_, err := jobLockDB.Collection("job_locks").UpdateOne(ctx,
+		bson.M{"_id": key, "expiresAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"token": token, "expiresAt": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", false
+	}
+	if err != nil {
+		log.Printf("Failed to acquire job lease %s: %v", key, err)
+		return "", false
+	}
+	return token, true
+}
+
+// ReleaseJobLock releases a lock previously taken with AcquireJobLock
+func ReleaseJobLock(key, token string) {
+	if token == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	redisClient := config.GetRedisClient()
+	if redisClient == nil {
+		if jobLockDB == nil {
+			return
+		}
+		if _, err := jobLockDB.Collection("job_locks").DeleteOne(ctx, bson.M{"_id": key, "token": token}); err != nil {
+			log.Printf("Failed to release job lease %s: %v", key, err)
+		}
+		return
+	}
+
+	if err := releaseLockScript.Run(ctx, redisClient, []string{key}, token).Err(); err != nil && err != redis.Nil {
+		log.Printf("Failed to release job lock %s: %v", key, err)
+	}
+}
+
+// RenewJobLock pushes the expiry of a lock previously taken with AcquireJobLock to ttl from now.
+// It returns false when the lock is no longer held by token.
+func RenewJobLock(key, token string, ttl time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	redisClient := config.GetRedisClient()
+	if redisClient == nil {
+		if jobLockDB == nil {
+			return false
+		}
+		res, err := jobLockDB.Collection("job_locks").UpdateOne(ctx,
+			bson.M{"_id": key, "token": token},
+			bson.M{"$set": bson.M{"expiresAt": time.Now().Add(ttl)}},
+		)
+		if err != nil {
+			log.Printf("Failed to renew job lease %s: %v", key, err)
+			return false
+		}
+		return res.MatchedCount == 1
+	}
+
+	renewed, err := renewLockScript.Run(ctx, redisClient, []string{key}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		log.Printf("Failed to renew job lock %s: %v", key, err)
+		return false
+	}
+	return renewed == 1
+}
+
+// RunWithJobLock runs fn while holding the named job lock, renewing it every third of ttl so a job that
+// runs longer than ttl keeps it. It returns false without running fn when another replica holds the lock.
+func RunWithJobLock(key string, ttl time.Duration, fn func()) bool {
+	token, acquired := AcquireJobLock(key, ttl)
+	if !acquired {
+		return false
+	}
+	defer ReleaseJobLock(key, token)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !RenewJobLock(key, token, ttl) {
+					log.Printf("Lost job lock %s while the job was running", key)
+					return
+				}
+			}
+		}
+	}()
+
+	fn()
+	return true
+}
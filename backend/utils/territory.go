@@ -0,0 +1,116 @@
+package utils
+
+import "strings"
+
+// LebanonDistricts lists the districts of each Lebanese governorate
+var LebanonDistricts = map[string][]string{
+	"Beirut":         {"Beirut"},
+	"Mount Lebanon":  {"Baabda", "Aley", "Chouf", "Matn"},
+	"Keserwan-Jbeil": {"Keserwan", "Jbeil"},
+	"North":          {"Tripoli", "Zgharta", "Koura", "Batroun", "Bsharri", "Minieh-Danniyeh"},
+	"Akkar":          {"Akkar"},
+	"Beqaa":          {"Zahle", "West Beqaa", "Rashaya"},
+	"Baalbek-Hermel": {"Baalbek", "Hermel"},
+	"South":          {"Sidon", "Tyre", "Jezzine"},
+	"Nabatieh":       {"Nabatieh", "Marjeyoun", "Hasbaya", "Bint Jbeil"},
+}
+
+// Common spellings of governorates and districts, keyed by their normalized form
+var lebanonAliases = map[string]string{
+	"mount lebanon governorate": "Mount Lebanon",
+	"mont liban":                "Mount Lebanon",
+	"jabal lubnan":              "Mount Lebanon",
+	"keserwan jbeil":            "Keserwan-Jbeil",
+	"kesrouan jbeil":            "Keserwan-Jbeil",
+	"north lebanon":             "North",
+	"north governorate":         "North",
+	"bekaa":                     "Beqaa",
+	"beka":                      "Beqaa",
+	"baalbek hermel":            "Baalbek-Hermel",
+	"south lebanon":             "South",
+	"south governorate":         "South",
+	"nabatiyeh":                 "Nabatieh",
+	"nabatiye":                  "Nabatieh",
+	"metn":                      "Matn",
+	"el metn":                   "Matn",
+	"shouf":                     "Chouf",
+	"kesrouan":                  "Keserwan",
+	"kesrwan":                   "Keserwan",
+	"byblos":                    "Jbeil",
+	"jbail":                     "Jbeil",
+	"trablos":                   "Tripoli",
+	"bcharre":                   "Bsharri",
+	"bsharre":                   "Bsharri",
+	"minieh danniyeh":           "Minieh-Danniyeh",
+	"miniyeh danniyeh":          "Minieh-Danniyeh",
+	"zahleh":                    "Zahle",
+	"western beqaa":             "West Beqaa",
+	"west bekaa":                "West Beqaa",
+	"rachaya":                   "Rashaya",
+	"saida":                     "Sidon",
+	"sayda":                     "Sidon",
+	"sour":                      "Tyre",
+	"tyr":                       "Tyre",
+	"jezzin":                    "Jezzine",
+	"marjayoun":                 "Marjeyoun",
+	"hasbaiya":                  "Hasbaya",
+	"bint jbail":                "Bint Jbeil",
+}
+
+// normalizePlace lowercases a place name and drops punctuation so spellings can be compared
+func normalizePlace(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("-", " ", "_", " ", ".", "", "'", "").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// NormalizeGovernorate returns the canonical name of a Lebanese governorate, or "" when it is not one
+func NormalizeGovernorate(name string) string {
+	key := normalizePlace(name)
+	if key == "" {
+		return ""
+	}
+	if canonical, ok := lebanonAliases[key]; ok {
+		if _, governorate := LebanonDistricts[canonical]; governorate {
+			return canonical
+		}
+	}
+	for governorate := range LebanonDistricts {
+		if normalizePlace(governorate) == key {
+			return governorate
+		}
+	}
+	return ""
+}
+
+// NormalizeDistrict returns the canonical name of a Lebanese district, or "" when it is not one
+func NormalizeDistrict(name string) string {
+	key := normalizePlace(name)
+	if key == "" {
+		return ""
+	}
+	if canonical, ok := lebanonAliases[key]; ok {
+		key = normalizePlace(canonical)
+	}
+	for _, districts := range LebanonDistricts {
+		for _, district := range districts {
+			if normalizePlace(district) == key {
+				return district
+			}
+		}
+	}
+	return ""
+}
+
+// PointInPolygon reports whether a coordinate lies inside a polygon given as lat/lng vertices (ray casting)
+func PointInPolygon(lat, lng float64, polygon [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		latI, lngI := polygon[i][0], polygon[i][1]
+		latJ, lngJ := polygon[j][0], polygon[j][1]
+		if (lngI > lng) != (lngJ > lng) && lat < (latJ-latI)*(lng-lngI)/(lngJ-lngI)+latI {
+			inside = !inside
+		}
+	}
+	return inside
+}
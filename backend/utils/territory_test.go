@@ -0,0 +1,33 @@
+package utils
+
+import "testing"
+
+func TestPointInPolygon(t *testing.T) {
+	square := [][2]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	// An L shape: the top right quarter of a 10x10 square is cut out
+	lShape := [][2]float64{{0, 0}, {0, 10}, {5, 10}, {5, 5}, {10, 5}, {10, 0}}
+	triangle := [][2]float64{{33.80, 35.45}, {33.95, 35.50}, {33.85, 35.60}}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		polygon  [][2]float64
+		inside   bool
+	}{
+		{"centre of a square", 5, 5, square, true},
+		{"outside a square", 11, 5, square, false},
+		{"beyond a corner", -1, -1, square, false},
+		{"inside the foot of an L", 8, 2, lShape, true},
+		{"inside the stem of an L", 2, 8, lShape, true},
+		{"in the notch of an L", 8, 8, lShape, false},
+		{"inside a triangle", 33.86, 35.51, triangle, true},
+		{"outside a triangle", 33.95, 35.60, triangle, false},
+		{"empty polygon", 5, 5, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := PointInPolygon(tt.lat, tt.lng, tt.polygon); got != tt.inside {
+			t.Errorf("%s: PointInPolygon(%v, %v) = %v, want %v", tt.name, tt.lat, tt.lng, got, tt.inside)
+		}
+	}
+}